@@ -20,11 +20,35 @@ import (
 )
 
 type Config struct {
-	ServerMetricsPort   int
-	LogLevel            logging.Level
-	Client              continuoustest.ClientConfig
-	Manager             continuoustest.ManagerConfig
-	WriteReadSeriesTest continuoustest.WriteReadSeriesTestConfig
+	ServerMetricsPort          int
+	LogLevel                   logging.Level
+	Client                     continuoustest.ClientConfig
+	Manager                    continuoustest.ManagerConfig
+	DualCluster                continuoustest.DualClusterConfig
+	DirectQuerier              continuoustest.DirectQuerierConfig
+	FailureWebhook             continuoustest.WebhookNotifierConfig
+	RunReports                 continuoustest.RunReportsConfig
+	TraceExport                continuoustest.TraceExportConfig
+	WriteReadSeriesTest        continuoustest.WriteReadSeriesTestConfig
+	InvalidWritesTest          continuoustest.InvalidWritesTestConfig
+	APIProbesTest              continuoustest.APIProbesTestConfig
+	BlockUploadTest            continuoustest.BlockUploadTestConfig
+	ConflictingWritesTest      continuoustest.ConflictingWritesTestConfig
+	AlertForDurationTest       continuoustest.AlertForDurationTestConfig
+	QueryAssertionsTest        continuoustest.QueryAssertionsTestConfig
+	SortOrderingTest           continuoustest.SortOrderingTestConfig
+	ClassicHistogramTest       continuoustest.ClassicHistogramTestConfig
+	ReadOnlyTest               continuoustest.ReadOnlyTestConfig
+	EmptyResultsTest           continuoustest.EmptyResultsTestConfig
+	OTLPResourceAttributesTest continuoustest.OTLPResourceAttributesTestConfig
+	IngestionLimitsTest        continuoustest.IngestionLimitsTestConfig
+	ActiveSeriesTrackersTest   continuoustest.ActiveSeriesTrackersTestConfig
+	TenantIsolationTest        continuoustest.TenantIsolationTestConfig
+	ZoneAwareTest              continuoustest.ZoneAwareTestConfig
+	TenantDeletionTest         continuoustest.TenantDeletionTestConfig
+	CardinalityLimitTest       continuoustest.CardinalityLimitTestConfig
+	PromQLFunctionsTest        continuoustest.PromQLFunctionsTestConfig
+	MetaMetricsTest            continuoustest.MetaMetricsTestConfig
 }
 
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
@@ -32,10 +56,40 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	cfg.LogLevel.RegisterFlags(f)
 	cfg.Client.RegisterFlags(f)
 	cfg.Manager.RegisterFlags(f)
+	cfg.DualCluster.RegisterFlags(f)
+	cfg.DirectQuerier.RegisterFlags(f)
+	cfg.FailureWebhook.RegisterFlags(f)
+	cfg.RunReports.RegisterFlags(f, util_log.Logger)
+	cfg.TraceExport.RegisterFlags(f)
 	cfg.WriteReadSeriesTest.RegisterFlags(f)
+	cfg.InvalidWritesTest.RegisterFlags(f)
+	cfg.APIProbesTest.RegisterFlags(f)
+	cfg.BlockUploadTest.RegisterFlags(f)
+	cfg.ConflictingWritesTest.RegisterFlags(f)
+	cfg.AlertForDurationTest.RegisterFlags(f)
+	cfg.QueryAssertionsTest.RegisterFlags(f)
+	cfg.SortOrderingTest.RegisterFlags(f)
+	cfg.ClassicHistogramTest.RegisterFlags(f)
+	cfg.ReadOnlyTest.RegisterFlags(f)
+	cfg.EmptyResultsTest.RegisterFlags(f)
+	cfg.OTLPResourceAttributesTest.RegisterFlags(f)
+	cfg.IngestionLimitsTest.RegisterFlags(f)
+	cfg.ActiveSeriesTrackersTest.RegisterFlags(f)
+	cfg.TenantIsolationTest.RegisterFlags(f)
+	cfg.ZoneAwareTest.RegisterFlags(f)
+	cfg.TenantDeletionTest.RegisterFlags(f)
+	cfg.CardinalityLimitTest.RegisterFlags(f)
+	cfg.PromQLFunctionsTest.RegisterFlags(f)
+	cfg.MetaMetricsTest.RegisterFlags(f)
 }
 
 func main() {
+	os.Exit(run())
+}
+
+// run runs the continuous test and returns the process exit code. The exit code is returned
+// instead of exiting, to run the deferred functions (e.g. flushing the traces) before exiting.
+func run() int {
 	// Parse CLI flags.
 	cfg := &Config{}
 	cfg.RegisterFlags(flag.CommandLine)
@@ -45,37 +99,357 @@ func main() {
 		LogLevel: cfg.LogLevel,
 	})
 
-	// Setting the environment variable JAEGER_AGENT_HOST enables tracing.
-	if trace, err := tracing.NewFromEnv("mimir-continuous-test"); err != nil {
-		level.Error(util_log.Logger).Log("msg", "Failed to setup tracing", "err", err.Error())
-	} else {
-		defer trace.Close()
+	// Setting the environment variable JAEGER_AGENT_HOST enables tracing. When the test run traces are exported,
+	// the tracer is installed along with the trace exporter.
+	if cfg.TraceExport.Endpoint.URL == nil {
+		if trace, err := tracing.NewFromEnv("mimir-continuous-test"); err != nil {
+			level.Error(util_log.Logger).Log("msg", "Failed to setup tracing", "err", err.Error())
+		} else {
+			defer trace.Close()
+		}
 	}
 
 	logger := util_log.Logger
 
-	// Run the instrumentation server.
+	if err := cfg.Manager.Validate(); err != nil {
+		level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+		return 1
+	}
+	if err := cfg.Client.Validate(); err != nil {
+		level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+		return 1
+	}
+	// The read endpoint is only optional when the tool doesn't run any query.
+	if cfg.Client.ReadBaseEndpoint.URL == nil && !cfg.WriteReadSeriesTest.WriteOnly {
+		level.Error(logger).Log("msg", "Invalid configuration", "err", "the read endpoint has not been set")
+		return 1
+	}
+	if err := cfg.DualCluster.Validate(); err != nil {
+		level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+		return 1
+	}
+	if err := cfg.FailureWebhook.Validate(); err != nil {
+		level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+		return 1
+	}
+	if err := cfg.RunReports.Validate(); err != nil {
+		level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+		return 1
+	}
+	if err := cfg.TraceExport.Validate(); err != nil {
+		level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+		return 1
+	}
+	if err := cfg.WriteReadSeriesTest.Validate(); err != nil {
+		level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+		return 1
+	}
+	if cfg.APIProbesTest.AlertmanagerEnabled && cfg.Client.AlertmanagerBaseEndpoint.URL == nil {
+		level.Error(logger).Log("msg", "Invalid configuration", "err", "the alertmanager endpoint must be set to probe the Alertmanager API")
+		return 1
+	}
+	if cfg.BlockUploadTest.Enabled {
+		if err := cfg.BlockUploadTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+	}
+	if cfg.ConflictingWritesTest.Enabled {
+		if err := cfg.ConflictingWritesTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+	}
+	if cfg.AlertForDurationTest.Enabled {
+		if err := cfg.AlertForDurationTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+	}
+	if cfg.QueryAssertionsTest.Enabled {
+		if err := cfg.QueryAssertionsTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+	}
+	if cfg.SortOrderingTest.Enabled {
+		if err := cfg.SortOrderingTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+	}
+	if cfg.ClassicHistogramTest.Enabled {
+		if err := cfg.ClassicHistogramTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+	}
+	if cfg.OTLPResourceAttributesTest.Enabled {
+		if err := cfg.OTLPResourceAttributesTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+	}
+	if cfg.IngestionLimitsTest.Enabled {
+		if err := cfg.IngestionLimitsTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+	}
+	if cfg.ActiveSeriesTrackersTest.Enabled {
+		if err := cfg.ActiveSeriesTrackersTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+		if cfg.WriteReadSeriesTest.ChurnInterval > 0 {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", "the active series trackers test can't be enabled along with the series churn of the write-read series test")
+			return 1
+		}
+		if len(cfg.WriteReadSeriesTest.RampSchedule) > 0 {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", "the active series trackers test can't be enabled along with the ramp schedule of the write-read series test")
+			return 1
+		}
+	}
+	if cfg.TenantIsolationTest.Enabled {
+		if err := cfg.TenantIsolationTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+		if cfg.Client.BasicAuthUser != "" || cfg.Client.BearerToken != "" {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", "the tenant isolation test can't be enabled along with basic or bearer token authentication")
+			return 1
+		}
+	}
+	if cfg.ZoneAwareTest.Enabled {
+		if err := cfg.ZoneAwareTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+	}
+	if cfg.TenantDeletionTest.Enabled {
+		if err := cfg.TenantDeletionTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+		if cfg.Client.BasicAuthUser != "" || cfg.Client.BearerToken != "" {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", "the tenant deletion test can't be enabled along with basic or bearer token authentication")
+			return 1
+		}
+	}
+	if cfg.CardinalityLimitTest.Enabled {
+		if err := cfg.CardinalityLimitTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+		if cfg.Client.BasicAuthUser != "" || cfg.Client.BearerToken != "" {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", "the cardinality limit test can't be enabled along with basic or bearer token authentication")
+			return 1
+		}
+	}
+	if cfg.MetaMetricsTest.Enabled {
+		if err := cfg.MetaMetricsTest.Validate(); err != nil {
+			level.Error(logger).Log("msg", "Invalid configuration", "err", err.Error())
+			return 1
+		}
+	}
+
+	// Create the instrumentation server. It is started once the tests have been added to the manager.
 	registry := prometheus.NewRegistry()
 	registry.MustRegister(collectors.NewGoCollector())
 
 	i := instrumentation.NewMetricsServer(cfg.ServerMetricsPort, registry)
-	if err := i.Start(); err != nil {
-		level.Error(logger).Log("msg", "Unable to start instrumentation server", "err", err.Error())
-		os.Exit(1)
-	}
 
-	// Init the client used to write/read to/from Mimir.
-	client, err := continuoustest.NewClient(cfg.Client, logger)
+	// Init the client used to write/read to/from Mimir. The request phases metrics are shared by all the clients.
+	clientMetrics := continuoustest.NewClientMetrics(registry)
+	var client continuoustest.MimirClient
+	client, err := continuoustest.NewClient(cfg.Client, logger, clientMetrics)
 	if err != nil {
 		level.Error(logger).Log("msg", "Failed to initialize client", "err", err.Error())
-		os.Exit(1)
+		return 1
+	}
+
+	// Each query is run through the querier too, bypassing the query-frontend, and the results are compared.
+	if cfg.DirectQuerier.Enabled() {
+		querierClientCfg := cfg.Client
+		querierClientCfg.ReadBaseEndpoint = cfg.DirectQuerier.ReadBaseEndpoint
+
+		querierClient, err := continuoustest.NewClient(querierClientCfg, logger, clientMetrics)
+		if err != nil {
+			level.Error(logger).Log("msg", "Failed to initialize client for the direct querier", "err", err.Error())
+			return 1
+		}
+
+		client = continuoustest.NewDirectQuerierClient(client, querierClient, logger, registry)
+	}
+
+	// In dual-cluster mode, the same data is written to a secondary cluster too, and query results are compared.
+	// In shadow mode, the secondary backend is only queried.
+	if cfg.DualCluster.Enabled() {
+		secondaryClientCfg := cfg.Client
+		secondaryClientCfg.ReadBaseEndpoint = cfg.DualCluster.SecondaryReadBaseEndpoint
+		if !cfg.DualCluster.ShadowMode() {
+			secondaryClientCfg.WriteBaseEndpoint = cfg.DualCluster.SecondaryWriteBaseEndpoint
+			secondaryClientCfg.WritePath = cfg.DualCluster.SecondaryWritePath()
+		}
+
+		secondaryClient, err := continuoustest.NewClient(secondaryClientCfg, logger, clientMetrics)
+		if err != nil {
+			level.Error(logger).Log("msg", "Failed to initialize client for the secondary cluster", "err", err.Error())
+			return 1
+		}
+
+		client = continuoustest.NewDualClusterClient(client, secondaryClient, cfg.DualCluster, logger, registry)
+	}
+
+	// Record the outcome of each query in the run reports.
+	if cfg.RunReports.Enabled {
+		client = continuoustest.NewReportingClient(client)
 	}
 
 	// Run continuous testing.
 	m := continuoustest.NewManager(cfg.Manager, logger)
+	checkResults := continuoustest.NewCheckResults()
+	m.SetCheckResults(checkResults)
+	if cfg.FailureWebhook.URL.URL != nil {
+		m.SetNotifier(continuoustest.NewWebhookNotifier(cfg.FailureWebhook, logger, registry))
+	}
+	if cfg.RunReports.Enabled {
+		uploader, err := continuoustest.NewRunReportUploader(cfg.RunReports, logger, registry)
+		if err != nil {
+			level.Error(logger).Log("msg", "Failed to initialize the run reports uploader", "err", err.Error())
+			return 1
+		}
+		m.SetRunReportUploader(uploader)
+	}
+	if cfg.TraceExport.Endpoint.URL != nil {
+		exporter := continuoustest.NewTraceExporter(cfg.TraceExport, logger, registry)
+		trace, err := exporter.InstallTracer("mimir-continuous-test")
+		if err != nil {
+			level.Error(logger).Log("msg", "Failed to setup tracing", "err", err.Error())
+			return 1
+		}
+		defer trace.Close()
+		m.SetTraceExporter(exporter)
+	}
 	m.AddTest(continuoustest.NewWriteReadSeriesTest(cfg.WriteReadSeriesTest, client, logger, registry))
+	if cfg.InvalidWritesTest.Enabled {
+		m.AddTest(continuoustest.NewInvalidWritesTest(cfg.InvalidWritesTest, client, logger, registry))
+	}
+	if cfg.APIProbesTest.Enabled() {
+		m.AddTest(continuoustest.NewAPIProbesTest(cfg.APIProbesTest, client, logger, registry))
+	}
+	if cfg.BlockUploadTest.Enabled {
+		m.AddTest(continuoustest.NewBlockUploadTest(cfg.BlockUploadTest, client, logger, registry))
+	}
+	if cfg.ConflictingWritesTest.Enabled {
+		// The second writer writes through a different endpoint, if configured.
+		var secondClient continuoustest.MimirClient = client
+		if cfg.ConflictingWritesTest.SecondWriteEndpoint.URL != nil {
+			secondClientCfg := cfg.Client
+			secondClientCfg.WriteBaseEndpoint = cfg.ConflictingWritesTest.SecondWriteEndpoint
+
+			if secondClient, err = continuoustest.NewClient(secondClientCfg, logger, clientMetrics); err != nil {
+				level.Error(logger).Log("msg", "Failed to initialize client for the second writer", "err", err.Error())
+				return 1
+			}
+		}
+
+		m.AddTest(continuoustest.NewConflictingWritesTest(cfg.ConflictingWritesTest, client, secondClient, logger, registry))
+	}
+	if cfg.AlertForDurationTest.Enabled {
+		m.AddTest(continuoustest.NewAlertForDurationTest(cfg.AlertForDurationTest, client, logger, registry))
+	}
+	if cfg.QueryAssertionsTest.Enabled {
+		m.AddTest(continuoustest.NewQueryAssertionsTest(cfg.QueryAssertionsTest, client, logger, registry))
+	}
+	if cfg.SortOrderingTest.Enabled {
+		m.AddTest(continuoustest.NewSortOrderingTest(cfg.SortOrderingTest, client, logger, registry))
+	}
+	if cfg.ClassicHistogramTest.Enabled {
+		m.AddTest(continuoustest.NewClassicHistogramTest(cfg.ClassicHistogramTest, client, logger, registry))
+	}
+	if cfg.ReadOnlyTest.Enabled {
+		m.AddTest(continuoustest.NewReadOnlyTest(cfg.ReadOnlyTest, client, logger, registry))
+	}
+	if cfg.EmptyResultsTest.Enabled {
+		m.AddTest(continuoustest.NewEmptyResultsTest(cfg.EmptyResultsTest, client, logger, registry))
+	}
+	if cfg.OTLPResourceAttributesTest.Enabled {
+		m.AddTest(continuoustest.NewOTLPResourceAttributesTest(cfg.OTLPResourceAttributesTest, client, logger, registry))
+	}
+	if cfg.IngestionLimitsTest.Enabled {
+		m.AddTest(continuoustest.NewIngestionLimitsTest(cfg.IngestionLimitsTest, client, logger, registry))
+	}
+	if cfg.ActiveSeriesTrackersTest.Enabled {
+		m.AddTest(continuoustest.NewActiveSeriesTrackersTest(cfg.ActiveSeriesTrackersTest, cfg.Client.TenantID, cfg.WriteReadSeriesTest.NumSeries, logger, registry))
+	}
+	if cfg.TenantIsolationTest.Enabled {
+		// Each tenant is written and queried through a dedicated client.
+		tenantClients := make(map[string]continuoustest.MimirClient, len(cfg.TenantIsolationTest.Tenants))
+		for _, tenantID := range cfg.TenantIsolationTest.Tenants {
+			tenantClientCfg := cfg.Client
+			tenantClientCfg.TenantID = tenantID
+
+			if tenantClients[tenantID], err = continuoustest.NewClient(tenantClientCfg, logger, clientMetrics); err != nil {
+				level.Error(logger).Log("msg", "Failed to initialize client for the tenant isolation test", "tenant", tenantID, "err", err.Error())
+				return 1
+			}
+		}
+
+		m.AddTest(continuoustest.NewTenantIsolationTest(cfg.TenantIsolationTest, tenantClients, logger, registry))
+	}
+	if cfg.ZoneAwareTest.Enabled {
+		// Each zone is written and queried through a dedicated client, pinned to the zone.
+		zoneClients := make(map[string]continuoustest.MimirClient, len(cfg.ZoneAwareTest.Zones))
+		for _, zone := range cfg.ZoneAwareTest.Zones {
+			if zoneClients[zone], err = continuoustest.NewClient(cfg.ZoneAwareTest.ClientConfig(cfg.Client, zone), logger, clientMetrics); err != nil {
+				level.Error(logger).Log("msg", "Failed to initialize client for the zone-aware test", "zone", zone, "err", err.Error())
+				return 1
+			}
+		}
+
+		m.AddTest(continuoustest.NewZoneAwareTest(cfg.ZoneAwareTest, zoneClients, logger, registry))
+	}
+	if cfg.TenantDeletionTest.Enabled {
+		// Each disposable tenant is written, queried and deleted through a dedicated client.
+		m.AddTest(continuoustest.NewTenantDeletionTest(cfg.TenantDeletionTest, func(tenantID string) (continuoustest.TenantDeletionClient, error) {
+			tenantClientCfg := cfg.Client
+			tenantClientCfg.TenantID = tenantID
+			return continuoustest.NewClient(tenantClientCfg, logger, clientMetrics)
+		}, logger, registry))
+	}
+	if cfg.CardinalityLimitTest.Enabled {
+		// The series limit is exceeded in a dedicated tenant, written through a dedicated client.
+		tenantClientCfg := cfg.Client
+		tenantClientCfg.TenantID = cfg.CardinalityLimitTest.TenantID
+
+		tenantClient, err := continuoustest.NewClient(tenantClientCfg, logger, clientMetrics)
+		if err != nil {
+			level.Error(logger).Log("msg", "Failed to initialize client for the cardinality limit test", "tenant", cfg.CardinalityLimitTest.TenantID, "err", err.Error())
+			return 1
+		}
+
+		m.AddTest(continuoustest.NewCardinalityLimitTest(cfg.CardinalityLimitTest, tenantClient, logger, registry))
+	}
+	if cfg.PromQLFunctionsTest.Enabled {
+		m.AddTest(continuoustest.NewPromQLFunctionsTest(cfg.PromQLFunctionsTest, client, logger, registry))
+	}
+	if cfg.MetaMetricsTest.Enabled {
+		m.AddTest(continuoustest.NewMetaMetricsTest(cfg.MetaMetricsTest, client, registry, logger, registry))
+	}
+
+	// Allow to trigger test runs on-demand.
+	i.Handle("/continuous-test/run", m)
+	// Expose the outcome of the most recent query result checks for external SLO tooling.
+	i.Handle("/continuous-test/check-results", checkResults)
+	if err := i.Start(); err != nil {
+		level.Error(logger).Log("msg", "Unable to start instrumentation server", "err", err.Error())
+		return 1
+	}
+
 	if err := m.Run(context.Background()); err != nil {
 		level.Error(logger).Log("msg", "Failed to run continuous test", "err", err.Error())
-		os.Exit(1)
+		return 1
 	}
+	return 0
 }
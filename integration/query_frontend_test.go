@@ -351,7 +351,7 @@ func runQueryFrontendTest(t *testing.T, cfg queryFrontendTestConfig) {
 		if userID == 0 && cfg.queryStatsEnabled {
 			res, _, err := c.QueryRaw("{instance=~\"hello.*\"}")
 			require.NoError(t, err)
-			require.Regexp(t, "querier_wall_time;dur=[0-9.]*, response_time;dur=[0-9.]*$", res.Header.Values("Server-Timing")[0])
+			require.Regexp(t, "querier_wall_time;dur=[0-9.]*, response_time;dur=[0-9.]*, fetched_series_count;val=[0-9]*, fetched_chunk_bytes;val=[0-9]*, fetched_chunks_count;val=[0-9]*, fetched_index_bytes;val=[0-9]*, sharded_queries;val=[0-9]*, split_queries;val=[0-9]*$", res.Header.Values("Server-Timing")[0])
 		}
 
 		// Beyond the range of -querier.query-ingesters-within should return nothing. No need to repeat it for each user.
@@ -504,6 +504,8 @@ overrides:
 		query         func(*e2emimir.Client) (*http.Response, []byte, error)
 		expStatusCode int
 		expBody       string
+		// expQueryFrontendBody is the expected body of the query-frontend responses, when it differs from the querier one.
+		expQueryFrontendBody string
 	}{
 		{
 			name: "maximum resolution error",
@@ -512,6 +514,8 @@ overrides:
 			},
 			expStatusCode: http.StatusBadRequest,
 			expBody:       `{"error":"exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)", "errorType":"bad_data", "status":"error"}`,
+			// The query-frontend suggests the step and time range the query would be accepted with.
+			expQueryFrontendBody: `{"error":"exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX): retry with step >= 8s or range <= 3h3m20s", "errorType":"bad_data", "status":"error"}`,
 		},
 		{
 			name: "negative step",
@@ -614,15 +618,20 @@ overrides:
 			assert.Equal(t, tc.expStatusCode, resp.StatusCode, "querier returns unexpected statusCode")
 			assert.JSONEq(t, tc.expBody, string(body), "querier returns unexpected body")
 
+			expQueryFrontendBody := tc.expBody
+			if tc.expQueryFrontendBody != "" {
+				expQueryFrontendBody = tc.expQueryFrontendBody
+			}
+
 			resp, body, err = tc.query(cQueryFrontend)
 			require.NoError(t, err)
 			assert.Equal(t, tc.expStatusCode, resp.StatusCode, "query-frontend returns unexpected statusCode")
-			assert.JSONEq(t, tc.expBody, string(body), "query-frontend returns unexpected body")
+			assert.JSONEq(t, expQueryFrontendBody, string(body), "query-frontend returns unexpected body")
 
 			resp, body, err = tc.query(cQueryFrontendWithQuerySharding)
 			require.NoError(t, err)
 			assert.Equal(t, tc.expStatusCode, resp.StatusCode, "query-frontend with query-sharding returns unexpected statusCode")
-			assert.JSONEq(t, tc.expBody, string(body), "query-frontend with query-sharding returns unexpected body")
+			assert.JSONEq(t, expQueryFrontendBody, string(body), "query-frontend with query-sharding returns unexpected body")
 		})
 	}
 }
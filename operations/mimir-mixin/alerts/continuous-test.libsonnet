@@ -9,7 +9,7 @@
           alert: $.alertName('ContinuousTestNotRunningOnWrites'),
           'for': '1h',
           expr: |||
-            sum by(%(alert_aggregation_labels)s, test) (rate(mimir_continuous_test_writes_failed_total[5m])) > 0
+            sum by(%(alert_aggregation_labels)s, test) (rate(mimir_continuous_test_writes_failed_total{maintenance!="true"}[5m])) > 0
           ||| % $._config,
           labels: {
             severity: 'warning',
@@ -24,7 +24,7 @@
           alert: $.alertName('ContinuousTestNotRunningOnReads'),
           'for': '1h',
           expr: |||
-            sum by(%(alert_aggregation_labels)s, test) (rate(mimir_continuous_test_queries_failed_total[5m])) > 0
+            sum by(%(alert_aggregation_labels)s, test) (rate(mimir_continuous_test_queries_failed_total{maintenance!="true"}[5m])) > 0
           ||| % $._config,
           labels: {
             severity: 'warning',
@@ -38,7 +38,7 @@
           // should have no "grace period" and alert as soon as the test fails.
           alert: $.alertName('ContinuousTestFailed'),
           expr: |||
-            sum by(%(alert_aggregation_labels)s, test) (rate(mimir_continuous_test_query_result_checks_failed_total[10m])) > 0
+            sum by(%(alert_aggregation_labels)s, test) (rate(mimir_continuous_test_query_result_checks_failed_total{maintenance!="true"}[10m])) > 0
           ||| % $._config,
           labels: {
             severity: 'warning',
@@ -47,6 +47,35 @@
             message: '%(product)s continuous test {{ $labels.test }} in %(alert_aggregation_variables)s failed when asserting query results.' % $._config,
           },
         },
+        {
+          // Alert if Mimir continuous test wrote invalid data which has been accepted by Mimir. This alert has no "for"
+          // duration because invalid data should never be accepted.
+          alert: $.alertName('ContinuousTestInvalidWritesAccepted'),
+          expr: |||
+            sum by(%(alert_aggregation_labels)s, test, case) (rate(mimir_continuous_test_invalid_writes_accepted_total[10m])) > 0
+          ||| % $._config,
+          labels: {
+            severity: 'warning',
+          },
+          annotations: {
+            message: '%(product)s continuous test {{ $labels.test }} in %(alert_aggregation_variables)s wrote invalid data ({{ $labels.case }}) which has been unexpectedly accepted.' % $._config,
+          },
+        },
+        {
+          // Alert if Mimir continuous test failed to probe the availability of a Mimir API.
+          // This alert tolerates short failures, due to temporarily outages in the Mimir cluster.
+          alert: $.alertName('ContinuousTestAPIProbesFailing'),
+          'for': '1h',
+          expr: |||
+            sum by(%(alert_aggregation_labels)s, test, api) (rate(mimir_continuous_test_api_probes_failed_total{maintenance!="true"}[5m])) > 0
+          ||| % $._config,
+          labels: {
+            severity: 'warning',
+          },
+          annotations: {
+            message: '%(product)s continuous test {{ $labels.test }} in %(alert_aggregation_variables)s failed to probe the {{ $labels.api }} API.' % $._config,
+          },
+        },
       ],
     },
   ],
@@ -5,7 +5,10 @@
 
 package alertspb
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	ErrNotFound = errors.New("alertmanager storage object not found")
@@ -35,3 +38,13 @@ func ParseTemplates(cfg AlertConfigDesc) map[string]string {
 	}
 	return templates
 }
+
+// AlertConfigVersionDesc is a version of a user's alertmanager configuration, stored in the
+// configuration history along with the metadata about when and by whom it was created.
+type AlertConfigVersionDesc struct {
+	// Version uniquely identifies the version within the user's configuration history.
+	Version   string          `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+	Author    string          `json:"author,omitempty"`
+	Config    AlertConfigDesc `json:"config"`
+}
@@ -8,7 +8,9 @@ package bucketclient
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
+	"sort"
 	"strings"
 	"sync"
 
@@ -34,6 +36,11 @@ const (
 	//     alertmanager/<user-id>/<object>
 	AlertmanagerPrefix = "alertmanager"
 
+	// AlertsHistoryPrefix is the bucket prefix under which the history of tenants alertmanager configs is stored.
+	// Note that objects stored under this prefix follow the pattern:
+	//     alerts-history/<user-id>/<version>
+	AlertsHistoryPrefix = "alerts-history"
+
 	// The name of alertmanager full state objects (notification log + silences).
 	fullStateName = "fullstate"
 
@@ -44,18 +51,20 @@ const (
 // BucketAlertStore is used to support the AlertStore interface against an object storage backend. It is implemented
 // using the Thanos objstore.Bucket interface
 type BucketAlertStore struct {
-	alertsBucket objstore.Bucket
-	amBucket     objstore.Bucket
-	cfgProvider  bucket.TenantConfigProvider
-	logger       log.Logger
+	alertsBucket        objstore.Bucket
+	alertsHistoryBucket objstore.Bucket
+	amBucket            objstore.Bucket
+	cfgProvider         bucket.TenantConfigProvider
+	logger              log.Logger
 }
 
 func NewBucketAlertStore(bkt objstore.Bucket, cfgProvider bucket.TenantConfigProvider, logger log.Logger) *BucketAlertStore {
 	return &BucketAlertStore{
-		alertsBucket: bucket.NewPrefixedBucketClient(bkt, AlertsPrefix),
-		amBucket:     bucket.NewPrefixedBucketClient(bkt, AlertmanagerPrefix),
-		cfgProvider:  cfgProvider,
-		logger:       logger,
+		alertsBucket:        bucket.NewPrefixedBucketClient(bkt, AlertsPrefix),
+		alertsHistoryBucket: bucket.NewPrefixedBucketClient(bkt, AlertsHistoryPrefix),
+		amBucket:            bucket.NewPrefixedBucketClient(bkt, AlertmanagerPrefix),
+		cfgProvider:         cfgProvider,
+		logger:              logger,
 	}
 }
 
@@ -118,15 +127,19 @@ func (s *BucketAlertStore) SetAlertConfig(ctx context.Context, cfg alertspb.Aler
 	return s.getUserBucket(cfg.User).Upload(ctx, cfg.User, bytes.NewBuffer(cfgBytes))
 }
 
-// DeleteAlertConfig implements alertstore.AlertStore.
+// DeleteAlertConfig implements alertstore.AlertStore. The history of the config versions is deleted too.
 func (s *BucketAlertStore) DeleteAlertConfig(ctx context.Context, userID string) error {
 	userBkt := s.getUserBucket(userID)
 
 	err := userBkt.Delete(ctx, userID)
-	if userBkt.IsObjNotFoundErr(err) {
-		return nil
+	if err != nil && !userBkt.IsObjNotFoundErr(err) {
+		return err
 	}
-	return err
+
+	if _, err := bucket.DeletePrefix(ctx, s.getAlertsHistoryUserBucket(userID), "", s.logger); err != nil {
+		return errors.Wrapf(err, "failed to delete alertmanager config versions for user %s", userID)
+	}
+	return nil
 }
 
 // ListUsersWithFullState implements alertstore.AlertStore.
@@ -177,6 +190,108 @@ func (s *BucketAlertStore) DeleteFullState(ctx context.Context, userID string) e
 	return err
 }
 
+// ListAlertConfigVersions implements alertstore.AlertStore.
+func (s *BucketAlertStore) ListAlertConfigVersions(ctx context.Context, userID string) ([]alertspb.AlertConfigVersionDesc, error) {
+	bkt := s.getAlertsHistoryUserBucket(userID)
+
+	var versionIDs []string
+	err := bkt.Iter(ctx, "", func(key string) error {
+		versionIDs = append(versionIDs, key)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list alertmanager config versions for user %s", userID)
+	}
+
+	var (
+		versionsMx = sync.Mutex{}
+		versions   = make([]alertspb.AlertConfigVersionDesc, 0, len(versionIDs))
+	)
+
+	err = concurrency.ForEachJob(ctx, len(versionIDs), fetchConcurrency, func(ctx context.Context, idx int) error {
+		version, err := s.getAlertConfigVersion(ctx, bkt, versionIDs[idx])
+		if bkt.IsObjNotFoundErr(err) {
+			// The version may have been deleted in the meanwhile.
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to fetch alertmanager config version %s for user %s", versionIDs[idx], userID)
+		}
+
+		versionsMx.Lock()
+		versions = append(versions, version)
+		versionsMx.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort versions from the newest to the oldest one.
+	sort.Slice(versions, func(i, j int) bool {
+		if !versions[i].CreatedAt.Equal(versions[j].CreatedAt) {
+			return versions[i].CreatedAt.After(versions[j].CreatedAt)
+		}
+		return versions[i].Version > versions[j].Version
+	})
+
+	return versions, nil
+}
+
+// GetAlertConfigVersion implements alertstore.AlertStore.
+func (s *BucketAlertStore) GetAlertConfigVersion(ctx context.Context, userID, version string) (alertspb.AlertConfigVersionDesc, error) {
+	bkt := s.getAlertsHistoryUserBucket(userID)
+
+	desc, err := s.getAlertConfigVersion(ctx, bkt, version)
+	if bkt.IsObjNotFoundErr(err) {
+		return desc, alertspb.ErrNotFound
+	}
+
+	return desc, err
+}
+
+// SetAlertConfigVersion implements alertstore.AlertStore.
+func (s *BucketAlertStore) SetAlertConfigVersion(ctx context.Context, version alertspb.AlertConfigVersionDesc) error {
+	if version.Version == "" || strings.Contains(version.Version, objstore.DirDelim) {
+		return errors.Errorf("invalid alertmanager config version %q", version.Version)
+	}
+
+	versionBytes, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+
+	return s.getAlertsHistoryUserBucket(version.Config.User).Upload(ctx, version.Version, bytes.NewBuffer(versionBytes))
+}
+
+// DeleteAlertConfigVersion implements alertstore.AlertStore.
+func (s *BucketAlertStore) DeleteAlertConfigVersion(ctx context.Context, userID, version string) error {
+	bkt := s.getAlertsHistoryUserBucket(userID)
+
+	err := bkt.Delete(ctx, version)
+	if bkt.IsObjNotFoundErr(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *BucketAlertStore) getAlertConfigVersion(ctx context.Context, bkt objstore.Bucket, version string) (alertspb.AlertConfigVersionDesc, error) {
+	desc := alertspb.AlertConfigVersionDesc{}
+
+	readCloser, err := bkt.Get(ctx, version)
+	if err != nil {
+		return desc, err
+	}
+
+	defer runutil.CloseWithLogOnErr(s.logger, readCloser, "close bucket reader")
+
+	if err := json.NewDecoder(readCloser).Decode(&desc); err != nil {
+		return desc, errors.Wrapf(err, "failed to deserialize alertmanager config version %s", version)
+	}
+
+	return desc, nil
+}
+
 func (s *BucketAlertStore) getAlertConfig(ctx context.Context, userID string) (alertspb.AlertConfigDesc, error) {
 	config := alertspb.AlertConfigDesc{}
 	err := s.get(ctx, s.getUserBucket(userID), userID, &config)
@@ -209,6 +324,13 @@ func (s *BucketAlertStore) getUserBucket(userID string) objstore.Bucket {
 	return bucket.NewSSEBucketClient(userID, s.alertsBucket, s.cfgProvider)
 }
 
+func (s *BucketAlertStore) getAlertsHistoryUserBucket(userID string) objstore.Bucket {
+	// The versions are stored under the user prefix. Inject server-side encryption based on the tenant config,
+	// like for the current config.
+	userBkt := bucket.NewPrefixedBucketClient(s.alertsHistoryBucket, userID)
+	return bucket.NewSSEBucketClient(userID, userBkt, s.cfgProvider).WithExpectedErrs(userBkt.IsObjNotFoundErr)
+}
+
 func (s *BucketAlertStore) getAlertmanagerUserBucket(userID string) objstore.Bucket {
 	return bucket.NewUserBucketClient(userID, s.amBucket, s.cfgProvider).WithExpectedErrs(s.amBucket.IsObjNotFoundErr)
 }
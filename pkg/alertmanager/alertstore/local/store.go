@@ -125,6 +125,26 @@ func (f *Store) DeleteFullState(ctx context.Context, user string) error {
 	return errState
 }
 
+// ListAlertConfigVersions implements alertstore.AlertStore.
+func (f *Store) ListAlertConfigVersions(_ context.Context, _ string) ([]alertspb.AlertConfigVersionDesc, error) {
+	return nil, nil
+}
+
+// GetAlertConfigVersion implements alertstore.AlertStore.
+func (f *Store) GetAlertConfigVersion(_ context.Context, _, _ string) (alertspb.AlertConfigVersionDesc, error) {
+	return alertspb.AlertConfigVersionDesc{}, alertspb.ErrNotFound
+}
+
+// SetAlertConfigVersion implements alertstore.AlertStore.
+func (f *Store) SetAlertConfigVersion(_ context.Context, _ alertspb.AlertConfigVersionDesc) error {
+	return errReadOnly
+}
+
+// DeleteAlertConfigVersion implements alertstore.AlertStore.
+func (f *Store) DeleteAlertConfigVersion(_ context.Context, _, _ string) error {
+	return errReadOnly
+}
+
 func (f *Store) reloadConfigs() (map[string]alertspb.AlertConfigDesc, error) {
 	configs := map[string]alertspb.AlertConfigDesc{}
 	err := filepath.Walk(f.cfg.Path, func(path string, info os.FileInfo, err error) error {
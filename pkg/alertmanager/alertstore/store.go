@@ -34,7 +34,7 @@ type AlertStore interface {
 	// SetAlertConfig stores the alertmanager configuration for an user.
 	SetAlertConfig(ctx context.Context, cfg alertspb.AlertConfigDesc) error
 
-	// DeleteAlertConfig deletes the alertmanager configuration for an user.
+	// DeleteAlertConfig deletes the alertmanager configuration for an user, along with the history of its versions.
 	// If configuration for the user doesn't exist, no error is reported.
 	DeleteAlertConfig(ctx context.Context, user string) error
 
@@ -50,6 +50,20 @@ type AlertStore interface {
 	// DeleteFullState deletes the alertmanager state for an user.
 	// If state for the user doesn't exist, no error is reported.
 	DeleteFullState(ctx context.Context, user string) error
+
+	// ListAlertConfigVersions returns the versions of the alertmanager configuration stored in
+	// the history of the given user, sorted from the newest to the oldest one.
+	ListAlertConfigVersions(ctx context.Context, user string) ([]alertspb.AlertConfigVersionDesc, error)
+
+	// GetAlertConfigVersion loads and returns a version of the alertmanager configuration from the history of the given user.
+	GetAlertConfigVersion(ctx context.Context, user, version string) (alertspb.AlertConfigVersionDesc, error)
+
+	// SetAlertConfigVersion stores a version of the alertmanager configuration in the history of an user.
+	SetAlertConfigVersion(ctx context.Context, version alertspb.AlertConfigVersionDesc) error
+
+	// DeleteAlertConfigVersion deletes a version of the alertmanager configuration from the history of an user.
+	// If the version doesn't exist, no error is reported.
+	DeleteAlertConfigVersion(ctx context.Context, user, version string) error
 }
 
 // NewAlertStore returns a alertmanager store backend client based on the provided cfg.
@@ -8,6 +8,7 @@ package alertstore
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/prometheus/alertmanager/cluster/clusterpb"
@@ -129,9 +130,11 @@ func TestAlertStore_DeleteAlertConfig(t *testing.T) {
 	user1Cfg := alertspb.AlertConfigDesc{User: "user-1", RawConfig: "content-1"}
 	user2Cfg := alertspb.AlertConfigDesc{User: "user-2", RawConfig: "content-2"}
 
-	// Upload the config for 2 users.
+	// Upload the config for 2 users, along with their history.
 	require.NoError(t, store.SetAlertConfig(ctx, user1Cfg))
 	require.NoError(t, store.SetAlertConfig(ctx, user2Cfg))
+	require.NoError(t, store.SetAlertConfigVersion(ctx, alertspb.AlertConfigVersionDesc{Version: "1", Config: user1Cfg}))
+	require.NoError(t, store.SetAlertConfigVersion(ctx, alertspb.AlertConfigVersionDesc{Version: "1", Config: user2Cfg}))
 
 	// Ensure the config has been correctly uploaded.
 	config, err := store.GetAlertConfig(ctx, "user-1")
@@ -153,6 +156,15 @@ func TestAlertStore_DeleteAlertConfig(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, user2Cfg, config)
 
+	// Ensure the history of the deleted config has been deleted too.
+	versions, err := store.ListAlertConfigVersions(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+
+	versions, err = store.ListAlertConfigVersions(ctx, "user-2")
+	require.NoError(t, err)
+	assert.Len(t, versions, 1)
+
 	// Delete again (should be idempotent).
 	require.NoError(t, store.DeleteAlertConfig(ctx, "user-1"))
 }
@@ -239,3 +251,87 @@ func TestBucketAlertStore_GetSetDeleteFullState(t *testing.T) {
 		require.NoError(t, store.DeleteFullState(ctx, "user-1"))
 	}
 }
+
+func TestBucketAlertStore_GetSetDeleteAlertConfigVersions(t *testing.T) {
+	bucket := objstore.NewInMemBucket()
+	store := bucketclient.NewBucketAlertStore(bucket, nil, log.NewNopLogger())
+
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0).UTC()
+	version1 := alertspb.AlertConfigVersionDesc{
+		Version:   "1",
+		CreatedAt: now.Add(-time.Minute),
+		Author:    "author-1",
+		Config:    alertspb.AlertConfigDesc{User: "user-1", RawConfig: "content-1"},
+	}
+	version2 := alertspb.AlertConfigVersionDesc{
+		Version:   "2",
+		CreatedAt: now,
+		Config:    alertspb.AlertConfigDesc{User: "user-1", RawConfig: "content-2"},
+	}
+
+	// The storage is empty.
+	{
+		_, err := store.GetAlertConfigVersion(ctx, "user-1", "1")
+		assert.Equal(t, alertspb.ErrNotFound, err)
+
+		versions, err := store.ListAlertConfigVersions(ctx, "user-1")
+		require.NoError(t, err)
+		assert.Empty(t, versions)
+	}
+
+	// The storage contains versions.
+	{
+		require.NoError(t, store.SetAlertConfigVersion(ctx, version1))
+		require.NoError(t, store.SetAlertConfigVersion(ctx, version2))
+
+		res, err := store.GetAlertConfigVersion(ctx, "user-1", "1")
+		require.NoError(t, err)
+		assert.Equal(t, version1, res)
+
+		// Ensure the version is stored at the expected location.
+		exists, err := bucket.Exists(ctx, "alerts-history/user-1/1")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		// Versions are sorted from the newest to the oldest one.
+		versions, err := store.ListAlertConfigVersions(ctx, "user-1")
+		require.NoError(t, err)
+		assert.Equal(t, []alertspb.AlertConfigVersionDesc{version2, version1}, versions)
+
+		// Versions of other users are not listed.
+		versions, err = store.ListAlertConfigVersions(ctx, "user-2")
+		require.NoError(t, err)
+		assert.Empty(t, versions)
+
+		// The config history doesn't interfere with the list of users.
+		users, err := store.ListAllUsers(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, users)
+	}
+
+	// The storage has had a version deleted.
+	{
+		require.NoError(t, store.DeleteAlertConfigVersion(ctx, "user-1", "1"))
+
+		_, err := store.GetAlertConfigVersion(ctx, "user-1", "1")
+		assert.Equal(t, alertspb.ErrNotFound, err)
+
+		versions, err := store.ListAlertConfigVersions(ctx, "user-1")
+		require.NoError(t, err)
+		assert.Equal(t, []alertspb.AlertConfigVersionDesc{version2}, versions)
+
+		// Delete again (should be idempotent).
+		require.NoError(t, store.DeleteAlertConfigVersion(ctx, "user-1", "1"))
+	}
+
+	// Invalid version names are rejected.
+	{
+		invalid := version1
+		invalid.Version = "a/b"
+		require.Error(t, store.SetAlertConfigVersion(ctx, invalid))
+
+		invalid.Version = ""
+		require.Error(t, store.SetAlertConfigVersion(ctx, invalid))
+	}
+}
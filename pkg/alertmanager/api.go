@@ -13,11 +13,15 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/grafana/dskit/concurrency"
+	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/prometheus/alertmanager/config"
 	"github.com/prometheus/alertmanager/template"
 	commoncfg "github.com/prometheus/common/config"
@@ -41,6 +45,13 @@ const (
 	errConfigurationTooBig   = "Alertmanager configuration is too big, limit: %d bytes"
 	errTooManyTemplates      = "too many templates in the configuration: %d (limit: %d)"
 	errTemplateTooBig        = "template %s is too big: %d bytes (limit: %d bytes)"
+	errListingVersions       = "unable to list the Alertmanager config versions"
+	errReadingVersion        = "unable to read the Alertmanager config version"
+	errDiffingVersions       = "unable to compare the Alertmanager config versions"
+
+	// configAuthorHeader is the HTTP header used to specify the author of an Alertmanager config change,
+	// tracked in the config history.
+	configAuthorHeader = "X-Config-Author"
 
 	fetchConcurrency = 16
 )
@@ -66,6 +77,13 @@ type UserConfig struct {
 	AlertmanagerConfig string            `yaml:"alertmanager_config"`
 }
 
+// UserConfigVersion describes a version of a user alertmanager config stored in the config history.
+type UserConfigVersion struct {
+	Version   string    `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Author    string    `json:"author,omitempty"`
+}
+
 func (am *MultitenantAlertmanager) GetUserConfig(w http.ResponseWriter, r *http.Request) {
 	logger := util_log.WithContext(r.Context(), am.logger)
 
@@ -86,11 +104,7 @@ func (am *MultitenantAlertmanager) GetUserConfig(w http.ResponseWriter, r *http.
 		return
 	}
 
-	d, err := yaml.Marshal(&UserConfig{
-		TemplateFiles:      alertspb.ParseTemplates(cfg),
-		AlertmanagerConfig: cfg.RawConfig,
-	})
-
+	d, err := marshalUserConfig(cfg)
 	if err != nil {
 		level.Error(logger).Log("msg", errMarshallingYAML, "err", err, "user", userID)
 		http.Error(w, fmt.Sprintf("%s: %s", errMarshallingYAML, err.Error()), http.StatusInternalServerError)
@@ -159,6 +173,8 @@ func (am *MultitenantAlertmanager) SetUserConfig(w http.ResponseWriter, r *http.
 		return
 	}
 
+	am.storeUserConfigVersion(r.Context(), logger, cfgDesc, configAuthor(r))
+
 	w.WriteHeader(http.StatusCreated)
 }
 
@@ -183,6 +199,235 @@ func (am *MultitenantAlertmanager) DeleteUserConfig(w http.ResponseWriter, r *ht
 	w.WriteHeader(http.StatusOK)
 }
 
+// ListUserConfigVersions returns the versions of the user alertmanager config stored in the config history,
+// sorted from the newest to the oldest one.
+func (am *MultitenantAlertmanager) ListUserConfigVersions(w http.ResponseWriter, r *http.Request) {
+	logger := util_log.WithContext(r.Context(), am.logger)
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		level.Error(logger).Log("msg", errNoOrgID, "err", err.Error())
+		http.Error(w, fmt.Sprintf("%s: %s", errNoOrgID, err.Error()), http.StatusUnauthorized)
+		return
+	}
+
+	versions, err := am.store.ListAlertConfigVersions(r.Context(), userID)
+	if err != nil {
+		level.Error(logger).Log("msg", errListingVersions, "err", err.Error())
+		http.Error(w, fmt.Sprintf("%s: %s", errListingVersions, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]UserConfigVersion, 0, len(versions))
+	for _, v := range versions {
+		out = append(out, UserConfigVersion{Version: v.Version, CreatedAt: v.CreatedAt, Author: v.Author})
+	}
+
+	util.WriteJSONResponse(w, out)
+}
+
+// GetUserConfigVersion returns a version of the user alertmanager config stored in the config history.
+func (am *MultitenantAlertmanager) GetUserConfigVersion(w http.ResponseWriter, r *http.Request) {
+	logger := util_log.WithContext(r.Context(), am.logger)
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		level.Error(logger).Log("msg", errNoOrgID, "err", err.Error())
+		http.Error(w, fmt.Sprintf("%s: %s", errNoOrgID, err.Error()), http.StatusUnauthorized)
+		return
+	}
+
+	version, ok := am.getUserConfigVersion(w, r, logger, userID, mux.Vars(r)["version"])
+	if !ok {
+		return
+	}
+
+	d, err := marshalUserConfig(version.Config)
+	if err != nil {
+		level.Error(logger).Log("msg", errMarshallingYAML, "err", err, "user", userID)
+		http.Error(w, fmt.Sprintf("%s: %s", errMarshallingYAML, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	if _, err := w.Write(d); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DiffUserConfigVersions returns the unified diff between a version of the user alertmanager config
+// stored in the config history and either another version (if the "compare_to" parameter is set) or
+// the current user alertmanager config.
+func (am *MultitenantAlertmanager) DiffUserConfigVersions(w http.ResponseWriter, r *http.Request) {
+	logger := util_log.WithContext(r.Context(), am.logger)
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		level.Error(logger).Log("msg", errNoOrgID, "err", err.Error())
+		http.Error(w, fmt.Sprintf("%s: %s", errNoOrgID, err.Error()), http.StatusUnauthorized)
+		return
+	}
+
+	from, ok := am.getUserConfigVersion(w, r, logger, userID, mux.Vars(r)["version"])
+	if !ok {
+		return
+	}
+
+	var (
+		to     alertspb.AlertConfigDesc
+		toName = "current"
+	)
+
+	if compareTo := r.FormValue("compare_to"); compareTo != "" {
+		version, ok := am.getUserConfigVersion(w, r, logger, userID, compareTo)
+		if !ok {
+			return
+		}
+
+		to = version.Config
+		toName = version.Version
+	} else {
+		to, err = am.store.GetAlertConfig(r.Context(), userID)
+		if err != nil && !errors.Is(err, alertspb.ErrNotFound) {
+			level.Error(logger).Log("msg", errReadingConfiguration, "err", err.Error())
+			http.Error(w, fmt.Sprintf("%s: %s", errReadingConfiguration, err.Error()), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	diff, err := diffUserConfigs(from.Config, from.Version, to, toName)
+	if err != nil {
+		level.Error(logger).Log("msg", errDiffingVersions, "err", err.Error())
+		http.Error(w, fmt.Sprintf("%s: %s", errDiffingVersions, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	util.WriteTextResponse(w, diff)
+}
+
+// RollbackUserConfig replaces the user alertmanager config with a version stored in the config history.
+// The rollback is tracked in the config history as a new version.
+func (am *MultitenantAlertmanager) RollbackUserConfig(w http.ResponseWriter, r *http.Request) {
+	logger := util_log.WithContext(r.Context(), am.logger)
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		level.Error(logger).Log("msg", errNoOrgID, "err", err.Error())
+		http.Error(w, fmt.Sprintf("%s: %s", errNoOrgID, err.Error()), http.StatusUnauthorized)
+		return
+	}
+
+	version, ok := am.getUserConfigVersion(w, r, logger, userID, mux.Vars(r)["version"])
+	if !ok {
+		return
+	}
+
+	// The limits may have changed since the version has been stored, so we validate it again.
+	cfgDesc := version.Config
+	cfgDesc.User = userID
+	if err := validateUserConfig(logger, cfgDesc, am.limits, userID); err != nil {
+		level.Warn(logger).Log("msg", errValidatingConfig, "err", err.Error())
+		http.Error(w, fmt.Sprintf("%s: %s", errValidatingConfig, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if err := am.store.SetAlertConfig(r.Context(), cfgDesc); err != nil {
+		level.Error(logger).Log("msg", errStoringConfiguration, "err", err.Error())
+		http.Error(w, fmt.Sprintf("%s: %s", errStoringConfiguration, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	level.Info(logger).Log("msg", "rolled back Alertmanager config", "version", version.Version)
+	am.storeUserConfigVersion(r.Context(), logger, cfgDesc, configAuthor(r))
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// getUserConfigVersion loads a version of the user alertmanager config from the config history.
+// If the version can't be loaded, the error is written to the response and false is returned.
+func (am *MultitenantAlertmanager) getUserConfigVersion(w http.ResponseWriter, r *http.Request, logger log.Logger, userID, version string) (alertspb.AlertConfigVersionDesc, bool) {
+	desc, err := am.store.GetAlertConfigVersion(r.Context(), userID, version)
+	if err != nil {
+		if errors.Is(err, alertspb.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("%s %s: %s", errReadingVersion, version, err.Error()), http.StatusNotFound)
+		} else {
+			level.Error(logger).Log("msg", errReadingVersion, "version", version, "err", err.Error())
+			http.Error(w, fmt.Sprintf("%s %s: %s", errReadingVersion, version, err.Error()), http.StatusInternalServerError)
+		}
+		return desc, false
+	}
+
+	return desc, true
+}
+
+// storeUserConfigVersion stores the input config in the user config history, and deletes the oldest
+// versions exceeding the configured max number of versions. Failures are logged but not returned,
+// because the config history is a best-effort safety net and shouldn't fail config updates.
+func (am *MultitenantAlertmanager) storeUserConfigVersion(ctx context.Context, logger log.Logger, cfg alertspb.AlertConfigDesc, author string) {
+	if am.cfg.MaxConfigVersions <= 0 {
+		return
+	}
+
+	now := time.Now()
+	version := alertspb.AlertConfigVersionDesc{
+		Version:   strconv.FormatInt(now.UnixNano(), 10),
+		CreatedAt: now.UTC(),
+		Author:    author,
+		Config:    cfg,
+	}
+
+	if err := am.store.SetAlertConfigVersion(ctx, version); err != nil {
+		level.Warn(logger).Log("msg", "failed to store Alertmanager config version", "err", err)
+		return
+	}
+
+	versions, err := am.store.ListAlertConfigVersions(ctx, cfg.User)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to list Alertmanager config versions", "err", err)
+		return
+	}
+
+	// Versions are sorted from the newest to the oldest one.
+	for i := am.cfg.MaxConfigVersions; i < len(versions); i++ {
+		if err := am.store.DeleteAlertConfigVersion(ctx, cfg.User, versions[i].Version); err != nil {
+			level.Warn(logger).Log("msg", "failed to delete old Alertmanager config version", "version", versions[i].Version, "err", err)
+		}
+	}
+}
+
+// configAuthor returns the author of the config change requested by r.
+func configAuthor(r *http.Request) string {
+	if author := r.Header.Get(configAuthorHeader); author != "" {
+		return author
+	}
+	return r.UserAgent()
+}
+
+func marshalUserConfig(cfg alertspb.AlertConfigDesc) ([]byte, error) {
+	return yaml.Marshal(&UserConfig{
+		TemplateFiles:      alertspb.ParseTemplates(cfg),
+		AlertmanagerConfig: cfg.RawConfig,
+	})
+}
+
+// diffUserConfigs returns the unified diff between the YAML representation of two user configs.
+func diffUserConfigs(from alertspb.AlertConfigDesc, fromName string, to alertspb.AlertConfigDesc, toName string) (string, error) {
+	fromYAML, err := marshalUserConfig(from)
+	if err != nil {
+		return "", err
+	}
+
+	toYAML, err := marshalUserConfig(to)
+	if err != nil {
+		return "", err
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(fromYAML)),
+		B:        difflib.SplitLines(string(toYAML)),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+}
+
 // Partially copied from: https://github.com/prometheus/alertmanager/blob/8e861c646bf67599a1704fc843c6a94d519ce312/cli/check_config.go#L65-L96
 func validateUserConfig(logger log.Logger, cfg alertspb.AlertConfigDesc, limits Limits, user string) error {
 	// We don't have a valid use case for empty configurations. If a tenant does not have a
@@ -8,6 +8,7 @@ package alertmanager
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -830,6 +831,7 @@ alertmanager_config: |
 
 	limits := &mockAlertManagerLimits{}
 	am := &MultitenantAlertmanager{
+		cfg:    &MultitenantAlertmanagerConfig{},
 		store:  prepareInMemoryAlertStore(),
 		logger: util_log.Logger,
 		limits: limits,
@@ -1143,3 +1145,115 @@ func TestValidateAlertmanagerConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestMultitenantAlertmanager_UserConfigVersions(t *testing.T) {
+	const (
+		cfg1 = `
+alertmanager_config: |
+  route:
+    receiver: 'receiver-1'
+  receivers:
+    - name: receiver-1
+`
+		cfg2 = `
+alertmanager_config: |
+  route:
+    receiver: 'receiver-2'
+  receivers:
+    - name: receiver-2
+`
+	)
+
+	am := &MultitenantAlertmanager{
+		cfg:    &MultitenantAlertmanagerConfig{MaxConfigVersions: 2},
+		store:  prepareInMemoryAlertStore(),
+		logger: util_log.Logger,
+		limits: &mockAlertManagerLimits{},
+	}
+
+	router := mux.NewRouter()
+	router.Path("/api/v1/alerts").Methods(http.MethodPost).HandlerFunc(am.SetUserConfig)
+	router.Path("/api/v1/alerts/versions").Methods(http.MethodGet).HandlerFunc(am.ListUserConfigVersions)
+	router.Path("/api/v1/alerts/versions/{version}").Methods(http.MethodGet).HandlerFunc(am.GetUserConfigVersion)
+	router.Path("/api/v1/alerts/versions/{version}/diff").Methods(http.MethodGet).HandlerFunc(am.DiffUserConfigVersions)
+	router.Path("/api/v1/alerts/versions/{version}/rollback").Methods(http.MethodPost).HandlerFunc(am.RollbackUserConfig)
+
+	doRequest := func(method, path, body string, header http.Header) *http.Response {
+		req := httptest.NewRequest(method, "http://alertmanager"+path, bytes.NewReader([]byte(body)))
+		req = req.WithContext(user.InjectOrgID(req.Context(), "user-1"))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	listVersions := func() []UserConfigVersion {
+		resp := doRequest(http.MethodGet, "/api/v1/alerts/versions", "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var versions []UserConfigVersion
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&versions))
+		return versions
+	}
+
+	// The config history is empty.
+	require.Empty(t, listVersions())
+
+	resp := doRequest(http.MethodGet, "/api/v1/alerts/versions/unknown", "", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Store the configs, tracking the author.
+	resp = doRequest(http.MethodPost, "/api/v1/alerts", cfg1, http.Header{configAuthorHeader: []string{"author-1"}})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = doRequest(http.MethodPost, "/api/v1/alerts", cfg2, http.Header{"User-Agent": []string{"author-2"}})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	versions := listVersions()
+	require.Len(t, versions, 2)
+	assert.Equal(t, "author-2", versions[0].Author)
+	assert.Equal(t, "author-1", versions[1].Author)
+
+	// Get the first version.
+	resp = doRequest(http.MethodGet, "/api/v1/alerts/versions/"+versions[1].Version, "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/yaml", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.YAMLEq(t, "template_files: {}\n"+cfg1, string(body))
+
+	// Diff the first version against the current config.
+	resp = doRequest(http.MethodGet, "/api/v1/alerts/versions/"+versions[1].Version+"/diff", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "--- "+versions[1].Version+"\n+++ current\n")
+	assert.Contains(t, string(body), "-      receiver: 'receiver-1'\n")
+	assert.Contains(t, string(body), "+      receiver: 'receiver-2'\n")
+
+	// Diff the first version against the second one.
+	resp = doRequest(http.MethodGet, "/api/v1/alerts/versions/"+versions[1].Version+"/diff?compare_to="+versions[0].Version, "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "--- "+versions[1].Version+"\n+++ "+versions[0].Version+"\n")
+
+	// Roll back to the first version.
+	resp = doRequest(http.MethodPost, "/api/v1/alerts/versions/"+versions[1].Version+"/rollback", "", http.Header{configAuthorHeader: []string{"author-3"}})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	current, err := am.store.GetAlertConfig(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Contains(t, current.RawConfig, "receiver-1")
+
+	// The rollback is tracked as a new version, and the oldest version has been deleted.
+	rolledBack := listVersions()
+	require.Len(t, rolledBack, 2)
+	assert.Equal(t, "author-3", rolledBack[0].Author)
+	assert.Equal(t, versions[0], rolledBack[1])
+
+	resp = doRequest(http.MethodPost, "/api/v1/alerts/versions/"+versions[1].Version+"/rollback", "", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -194,6 +194,10 @@ func (a *API) RegisterAlertmanager(am *alertmanager.MultitenantAlertmanager, api
 		a.RegisterRoute("/api/v1/alerts", http.HandlerFunc(am.GetUserConfig), true, true, "GET")
 		a.RegisterRoute("/api/v1/alerts", http.HandlerFunc(am.SetUserConfig), true, true, "POST")
 		a.RegisterRoute("/api/v1/alerts", http.HandlerFunc(am.DeleteUserConfig), true, true, "DELETE")
+		a.RegisterRoute("/api/v1/alerts/versions", http.HandlerFunc(am.ListUserConfigVersions), true, true, "GET")
+		a.RegisterRoute("/api/v1/alerts/versions/{version}", http.HandlerFunc(am.GetUserConfigVersion), true, true, "GET")
+		a.RegisterRoute("/api/v1/alerts/versions/{version}/diff", http.HandlerFunc(am.DiffUserConfigVersions), true, true, "GET")
+		a.RegisterRoute("/api/v1/alerts/versions/{version}/rollback", http.HandlerFunc(am.RollbackUserConfig), true, true, "POST")
 	}
 }
 
@@ -228,18 +232,20 @@ func (a *API) RegisterRuntimeConfig(runtimeConfigHandler http.HandlerFunc, userL
 func (a *API) RegisterDistributor(d *distributor.Distributor, pushConfig distributor.Config, reg prometheus.Registerer) {
 	distributorpb.RegisterDistributorServer(a.server.GRPC, d)
 
-	a.RegisterRoute("/api/v1/push", push.Handler(pushConfig.MaxRecvMsgSize, a.sourceIPs, a.cfg.SkipLabelNameValidationHeader, d.PushWithMiddlewares), true, false, "POST")
+	a.RegisterRoute("/api/v1/push", push.Handler(pushConfig.MaxRecvMsgSize, pushConfig.MaxRequestLabelBytes, a.sourceIPs, a.cfg.SkipLabelNameValidationHeader, reg, d.PushWithMiddlewares), true, false, "POST")
 	a.RegisterRoute("/otlp/v1/metrics", push.OTLPHandler(pushConfig.MaxRecvMsgSize, a.sourceIPs, a.cfg.SkipLabelNameValidationHeader, reg, d.PushWithMiddlewares), true, false, "POST")
 
 	a.indexPage.AddLinks(defaultWeight, "Distributor", []IndexPageLink{
 		{Desc: "Ring status", Path: "/distributor/ring"},
 		{Desc: "Usage statistics", Path: "/distributor/all_user_stats"},
 		{Desc: "HA tracker status", Path: "/distributor/ha_tracker"},
+		{Desc: "Read-only tenants", Path: "/distributor/read_only_tenants"},
 	})
 
 	a.RegisterRoute("/distributor/ring", d, false, true, "GET", "POST")
 	a.RegisterRoute("/distributor/all_user_stats", http.HandlerFunc(d.AllUserStatsHandler), false, true, "GET")
 	a.RegisterRoute("/distributor/ha_tracker", d.HATracker, false, true, "GET")
+	a.RegisterRoute("/distributor/read_only_tenants", http.HandlerFunc(d.ReadOnlyTenantsHandler), false, true, "GET", "POST")
 }
 
 // Ingester is defined as an interface to allow for alternative implementations
@@ -263,7 +269,7 @@ func (a *API) RegisterIngester(i Ingester, pushConfig distributor.Config) {
 
 	a.RegisterRoute("/ingester/flush", http.HandlerFunc(i.FlushHandler), false, true, "GET", "POST")
 	a.RegisterRoute("/ingester/shutdown", http.HandlerFunc(i.ShutdownHandler), false, true, "GET", "POST")
-	a.RegisterRoute("/ingester/push", push.Handler(pushConfig.MaxRecvMsgSize, a.sourceIPs, a.cfg.SkipLabelNameValidationHeader, i.PushWithCleanup), true, false, "POST") // For testing and debugging.
+	a.RegisterRoute("/ingester/push", push.Handler(pushConfig.MaxRecvMsgSize, pushConfig.MaxRequestLabelBytes, a.sourceIPs, a.cfg.SkipLabelNameValidationHeader, nil, i.PushWithCleanup), true, false, "POST") // For testing and debugging.
 	a.RegisterRoute("/ingester/tsdb_metrics", http.HandlerFunc(i.UserRegistryHandler), true, true, "GET")
 }
 
@@ -321,6 +327,7 @@ func (a *API) RegisterStoreGateway(s *storegateway.StoreGateway) {
 	})
 	a.RegisterRoute("/store-gateway/ring", http.HandlerFunc(s.RingHandler), false, true, "GET", "POST")
 	a.RegisterRoute("/store-gateway/tenants", http.HandlerFunc(s.TenantsHandler), false, true, "GET")
+	a.RegisterRoute("/store-gateway/tenants/usage", http.HandlerFunc(s.TenantsUsageHandler), false, true, "GET")
 	a.RegisterRoute("/store-gateway/tenant/{tenant}/blocks", http.HandlerFunc(s.BlocksHandler), false, true, "GET")
 }
 
@@ -330,6 +337,7 @@ func (a *API) RegisterCompactor(c *compactor.MultitenantCompactor) {
 		{Desc: "Ring status", Path: "/compactor/ring"},
 	})
 	a.RegisterRoute("/compactor/ring", http.HandlerFunc(c.RingHandler), false, true, "GET", "POST")
+	a.RegisterRoute("/compactor/tenants/usage", http.HandlerFunc(c.TenantsUsageHandler), false, true, "GET")
 	a.RegisterRoute("/api/v1/upload/block/{block}/start", http.HandlerFunc(c.StartBlockUpload), true, false, http.MethodPost)
 	a.RegisterRoute("/api/v1/upload/block/{block}/files", http.HandlerFunc(c.UploadBlockFile), true, false, http.MethodPost)
 	a.RegisterRoute("/api/v1/upload/block/{block}/finish", http.HandlerFunc(c.FinishBlockUpload), true, false, http.MethodPost)
@@ -353,6 +361,13 @@ func (a *API) RegisterQueryable(
 	a.RegisterRoute("/api/v1/user_stats", http.HandlerFunc(distributor.UserStatsHandler), true, true, "GET")
 }
 
+// RegisterExportAPI registers the routes of the export API with the provided handler. The export jobs are
+// run by the queriers, so the handler is either the internal querier handler or the query-frontend one.
+func (a *API) RegisterExportAPI(handler http.Handler) {
+	a.RegisterRoute("/api/v1/export", handler, true, true, http.MethodGet, http.MethodPost)
+	a.RegisterRoute("/api/v1/export/{job}", handler, true, true, http.MethodGet)
+}
+
 // RegisterQueryAPI registers the Prometheus API routes with the provided handler.
 func (a *API) RegisterQueryAPI(handler http.Handler, buildInfoHandler http.Handler) {
 	a.RegisterRoute(path.Join(a.cfg.PrometheusHTTPPrefix, "/api/v1/read"), handler, true, true, "POST")
@@ -373,6 +388,9 @@ func (a *API) RegisterQueryAPI(handler http.Handler, buildInfoHandler http.Handl
 // with the Querier.
 func (a *API) RegisterQueryFrontendHandler(h http.Handler, buildInfoHandler http.Handler) {
 	a.RegisterQueryAPI(h, buildInfoHandler)
+
+	// The federation endpoint is served by the query-frontend only, which runs each selector as an instant query.
+	a.RegisterRoute(path.Join(a.cfg.PrometheusHTTPPrefix, "/federate"), h, true, true, "GET", "POST")
 }
 
 func (a *API) RegisterQueryFrontend1(f *frontendv1.Frontend) {
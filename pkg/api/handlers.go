@@ -32,6 +32,7 @@ import (
 	"github.com/weaveworks/common/middleware"
 
 	"github.com/grafana/mimir/pkg/querier"
+	"github.com/grafana/mimir/pkg/querier/export"
 	"github.com/grafana/mimir/pkg/querier/stats"
 	"github.com/grafana/mimir/pkg/usagestats"
 	"github.com/grafana/mimir/pkg/util"
@@ -204,6 +205,7 @@ func NewQuerierHandler(
 	reg prometheus.Registerer,
 	logger log.Logger,
 	limits *validation.Overrides,
+	exportManager *export.Manager,
 ) http.Handler {
 	// Prometheus histograms for requests to the querier.
 	querierRequestDuration := promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
@@ -305,6 +307,13 @@ func NewQuerierHandler(
 	router.Path(path.Join(prefix, "/api/v1/cardinality/label_names")).Methods("GET", "POST").Handler(cardinalityQueryStats.Wrap(querier.LabelNamesCardinalityHandler(distributor, limits)))
 	router.Path(path.Join(prefix, "/api/v1/cardinality/label_values")).Methods("GET", "POST").Handler(cardinalityQueryStats.Wrap(querier.LabelValuesCardinalityHandler(distributor, limits)))
 
+	// The export API is served by the querier only if enabled. It's not under the Prometheus HTTP prefix.
+	if exportManager != nil {
+		router.Path(path.Join(cfg.ServerPrefix, "/api/v1/export")).Methods("POST").Handler(http.HandlerFunc(exportManager.CreateJobHandler))
+		router.Path(path.Join(cfg.ServerPrefix, "/api/v1/export")).Methods("GET").Handler(http.HandlerFunc(exportManager.ListJobsHandler))
+		router.Path(path.Join(cfg.ServerPrefix, "/api/v1/export/{job}")).Methods("GET").Handler(http.HandlerFunc(exportManager.JobStatusHandler))
+	}
+
 	// Track execution time.
 	return stats.NewWallTimeMiddleware().Wrap(router)
 }
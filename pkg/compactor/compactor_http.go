@@ -13,6 +13,8 @@ import (
 	"github.com/go-kit/log/level"
 	"github.com/grafana/dskit/services"
 
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/util"
 	util_log "github.com/grafana/mimir/pkg/util/log"
 )
 
@@ -45,3 +47,30 @@ func (c *MultitenantCompactor) RingHandler(w http.ResponseWriter, req *http.Requ
 
 	c.ring.ServeHTTP(w, req)
 }
+
+type tenantsUsageResponse struct {
+	Tenants []bucketindex.Usage `json:"tenants"`
+}
+
+// TenantsUsageHandler responds with the storage usage summary of each tenant, computed from the bucket indexes.
+func (c *MultitenantCompactor) TenantsUsageHandler(w http.ResponseWriter, req *http.Request) {
+	if c.State() != services.Running {
+		// The bucket client is created when the compactor starts.
+		http.Error(w, "Compactor is not running yet.", http.StatusServiceUnavailable)
+		return
+	}
+
+	userIDs, err := c.discoverUsers(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usages, err := bucketindex.ReadUsages(req.Context(), c.bucketClient, userIDs, c.cfgProvider, c.logger)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	util.WriteJSONResponse(w, tenantsUsageResponse{Tenants: usages})
+}
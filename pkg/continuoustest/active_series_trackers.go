@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/concurrency"
+	"github.com/grafana/dskit/flagext"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/grafana/mimir/pkg/util/instrumentation"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	// activeSeriesCustomTrackerMetricName is the metric exported by the ingesters with the number of active
+	// series matching each custom tracker, by tenant.
+	activeSeriesCustomTrackerMetricName = "cortex_ingester_active_series_custom_tracker"
+
+	activeSeriesTrackersReasonScrapeFailed = "scrape_failed"
+	activeSeriesTrackersReasonMismatch     = "mismatch"
+
+	// activeSeriesTrackersScrapeConcurrency is the maximum number of metrics endpoints scraped concurrently.
+	activeSeriesTrackersScrapeConcurrency = 16
+)
+
+type ActiveSeriesTrackersTestConfig struct {
+	Enabled           bool
+	TrackerName       string
+	TenantID          string
+	MetricsEndpoints  flagext.StringSliceCSV
+	ReplicationFactor int
+	ScrapeTimeout     time.Duration
+	GracePeriod       time.Duration
+}
+
+func (cfg *ActiveSeriesTrackersTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.active-series-trackers-test.enabled", false, "Enable the test which periodically scrapes the ingesters metrics endpoints, and checks whether the active series counted by the custom tracker matching the series written by the write-read series test are equal to the number of written series. The series churn of the write-read series test must be disabled.")
+	f.StringVar(&cfg.TrackerName, "tests.active-series-trackers-test.tracker-name", "continuous_test", "Name of the active series custom tracker configured in Mimir for the tenant, whose matcher selects all and only the series written by the write-read series test, for example continuous_test:{__name__=\"mimir_continuous_test_sine_wave\"}.")
+	f.StringVar(&cfg.TenantID, "tests.active-series-trackers-test.tenant-id", "", "The tenant ID of the active series to check. Defaults to -tests.tenant-id.")
+	f.Var(&cfg.MetricsEndpoints, "tests.active-series-trackers-test.metrics-endpoints", "Comma-separated list of URLs of the metrics endpoints of all the ingesters, for example http://ingester-0:8080/metrics. The active series counted by each ingester are summed.")
+	f.IntVar(&cfg.ReplicationFactor, "tests.active-series-trackers-test.replication-factor", 3, "Replication factor of the ingesters, by which the sum of the active series counted by each ingester is divided.")
+	f.DurationVar(&cfg.ScrapeTimeout, "tests.active-series-trackers-test.scrape-timeout", 10*time.Second, "The timeout for scraping a single metrics endpoint.")
+	f.DurationVar(&cfg.GracePeriod, "tests.active-series-trackers-test.grace-period", 11*time.Minute, "How long to wait after the testing tool startup before checking the active series. It should be greater than the sum of the active series idle timeout and the active series metrics update period configured in the ingesters, so that the series written before a restart, or not written yet, don't affect the check.")
+}
+
+func (cfg *ActiveSeriesTrackersTestConfig) Validate() error {
+	if cfg.TrackerName == "" {
+		return errors.New("the tracker name of the active series trackers test must be set")
+	}
+	if len(cfg.MetricsEndpoints) == 0 {
+		return errors.New("at least one metrics endpoint must be configured for the active series trackers test")
+	}
+	if cfg.ReplicationFactor <= 0 {
+		return errors.New("the replication factor of the active series trackers test must be greater than 0")
+	}
+	if cfg.ScrapeTimeout <= 0 {
+		return errors.New("the scrape timeout of the active series trackers test must be greater than 0")
+	}
+	if cfg.GracePeriod < 0 {
+		return errors.New("the grace period of the active series trackers test must be greater than or equal to 0")
+	}
+	return nil
+}
+
+// ActiveSeriesTrackersTest periodically scrapes the metrics endpoints of the ingesters, and checks whether the
+// active series counted by a custom tracker, matching the series written by the write-read series test, are
+// equal to the number of series written.
+type ActiveSeriesTrackersTest struct {
+	name       string
+	cfg        ActiveSeriesTrackersTestConfig
+	tenantID   string
+	numSeries  int
+	httpClient *http.Client
+	logger     log.Logger
+	metrics    *TestMetrics
+
+	// initTime is the time the test has been initialised at, used to honor the grace period.
+	initTime time.Time
+
+	checksTotal       prometheus.Counter
+	checksFailedTotal *prometheus.CounterVec
+	activeSeries      prometheus.Gauge
+}
+
+// NewActiveSeriesTrackersTest returns a test checking the active series of the input tenant, unless a different
+// tenant is configured, which are expected to be numSeries.
+func NewActiveSeriesTrackersTest(cfg ActiveSeriesTrackersTestConfig, tenantID string, numSeries int, logger log.Logger, reg prometheus.Registerer) *ActiveSeriesTrackersTest {
+	const name = "active-series-trackers"
+
+	if cfg.TenantID != "" {
+		tenantID = cfg.TenantID
+	}
+
+	t := &ActiveSeriesTrackersTest{
+		name:       name,
+		cfg:        cfg,
+		tenantID:   tenantID,
+		numSeries:  numSeries,
+		httpClient: &http.Client{Transport: instrumentation.TracerTransport{}},
+		logger:     log.With(logger, "test", name),
+		metrics:    NewTestMetrics(name, reg),
+		checksTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_active_series_trackers_checks_total",
+			Help:        "Total number of checks of the active series counted by the custom tracker.",
+			ConstLabels: map[string]string{"test": name},
+		}),
+		checksFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_active_series_trackers_checks_failed_total",
+			Help:        "Total number of failed checks of the active series counted by the custom tracker, because the metrics endpoints couldn't be scraped or the active series didn't match the written series.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"reason"}),
+		activeSeries: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "mimir_continuous_test_active_series_trackers_series",
+			Help:        "Number of active series counted by the custom tracker at the last check, divided by the replication factor.",
+			ConstLabels: map[string]string{"test": name},
+		}),
+	}
+
+	// Initialise the metrics so that they're exported even if no failure occurred.
+	for _, reason := range []string{activeSeriesTrackersReasonScrapeFailed, activeSeriesTrackersReasonMismatch} {
+		t.checksFailedTotal.WithLabelValues(reason)
+	}
+
+	return t
+}
+
+// Name implements Test.
+func (t *ActiveSeriesTrackersTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *ActiveSeriesTrackersTest) Init(_ context.Context, now time.Time) error {
+	t.initTime = now
+	return nil
+}
+
+// Run implements Test.
+func (t *ActiveSeriesTrackersTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "ActiveSeriesTrackersTest.Run")
+	defer sp.Finish()
+
+	if now.Sub(t.initTime) < t.cfg.GracePeriod {
+		level.Debug(sp).Log("msg", "Skipped the active series check because the grace period since startup hasn't elapsed yet", "grace_period", t.cfg.GracePeriod)
+		return nil
+	}
+
+	t.checksTotal.Inc()
+
+	total, err := t.scrapeActiveSeries(ctx)
+	if err != nil {
+		t.checksFailedTotal.WithLabelValues(activeSeriesTrackersReasonScrapeFailed).Inc()
+		level.Warn(sp).Log("msg", "Failed to scrape the active series custom tracker", "err", err)
+		return errors.Wrap(err, "failed to scrape the active series custom tracker")
+	}
+
+	t.activeSeries.Set(total / float64(t.cfg.ReplicationFactor))
+
+	if err := verifyActiveSeries(total, t.numSeries, t.cfg.ReplicationFactor); err != nil {
+		t.checksFailedTotal.WithLabelValues(activeSeriesTrackersReasonMismatch).Inc()
+		level.Warn(sp).Log("msg", "Active series check failed", "tenant", t.tenantID, "tracker", t.cfg.TrackerName, "err", err)
+		return errors.Wrapf(err, "active series check failed for tracker %s", t.cfg.TrackerName)
+	}
+
+	level.Debug(sp).Log("msg", "Active series check succeeded", "tenant", t.tenantID, "tracker", t.cfg.TrackerName, "active_series", total)
+	return nil
+}
+
+// scrapeActiveSeries returns the sum of the active series counted by the custom tracker for the tenant
+// across all the metrics endpoints.
+func (t *ActiveSeriesTrackersTest) scrapeActiveSeries(ctx context.Context) (float64, error) {
+	var (
+		mtx   sync.Mutex
+		total float64
+	)
+
+	err := concurrency.ForEachJob(ctx, len(t.cfg.MetricsEndpoints), activeSeriesTrackersScrapeConcurrency, func(ctx context.Context, idx int) error {
+		value, err := t.scrapeEndpoint(ctx, t.cfg.MetricsEndpoints[idx])
+		if err != nil {
+			return errors.Wrapf(err, "failed to scrape %s", t.cfg.MetricsEndpoints[idx])
+		}
+
+		mtx.Lock()
+		total += value
+		mtx.Unlock()
+		return nil
+	})
+
+	return total, err
+}
+
+// scrapeEndpoint returns the active series counted by the custom tracker for the tenant in the input metrics
+// endpoint. An ingester not exporting the metric for the tenant doesn't hold any of its active series.
+func (t *ActiveSeriesTrackersTest) scrapeEndpoint(ctx context.Context, endpoint string) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.ScrapeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", string(expfmt.FmtText))
+
+	res, err := t.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode/100 != 2 {
+		return 0, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(res.Body)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse metrics")
+	}
+
+	family, ok := families[activeSeriesCustomTrackerMetricName]
+	if !ok {
+		return 0, nil
+	}
+
+	var value float64
+	for _, m := range family.GetMetric() {
+		var user, tracker string
+		for _, l := range m.GetLabel() {
+			switch l.GetName() {
+			case "user":
+				user = l.GetValue()
+			case "name":
+				tracker = l.GetValue()
+			}
+		}
+		if user == t.tenantID && tracker == t.cfg.TrackerName {
+			value += m.GetGauge().GetValue()
+		}
+	}
+	return value, nil
+}
+
+// verifyActiveSeries checks whether the input sum of the active series counted by the ingesters matches
+// the expected number of series, replicated to replicationFactor ingesters.
+func verifyActiveSeries(total float64, numSeries, replicationFactor int) error {
+	expected := float64(numSeries * replicationFactor)
+	if total == expected {
+		return nil
+	}
+	if total == 0 {
+		return fmt.Errorf("expected %d active series but the custom tracker didn't count any series: check whether the tracker is configured in Mimir", numSeries)
+	}
+	return fmt.Errorf("expected %d active series (%.0f across the ingesters with replication factor %d) but got %.2f (%.0f across the ingesters)", numSeries, expected, replicationFactor, total/float64(replicationFactor), total)
+}
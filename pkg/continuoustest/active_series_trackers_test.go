@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveSeriesTrackersTestConfig_Validate(t *testing.T) {
+	cfg := ActiveSeriesTrackersTestConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.ErrorContains(t, cfg.Validate(), "metrics endpoint")
+
+	cfg.MetricsEndpoints = []string{"http://ingester-0/metrics"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TrackerName = ""
+	assert.ErrorContains(t, cfg.Validate(), "tracker name")
+
+	cfg.TrackerName = "continuous_test"
+	cfg.ReplicationFactor = 0
+	assert.ErrorContains(t, cfg.Validate(), "replication factor")
+
+	cfg.ReplicationFactor = 3
+	cfg.ScrapeTimeout = 0
+	assert.ErrorContains(t, cfg.Validate(), "scrape timeout")
+
+	cfg.ScrapeTimeout = time.Second
+	cfg.GracePeriod = -time.Second
+	assert.ErrorContains(t, cfg.Validate(), "grace period")
+}
+
+func TestActiveSeriesTrackersTest_Run(t *testing.T) {
+	const numSeries = 10
+	now := time.Unix(1000, 0)
+
+	// newIngester returns a metrics endpoint exporting the input active series of the custom trackers,
+	// along with the active series of another tenant and tracker which must be ignored.
+	newIngester := func(t *testing.T, activeSeries float64) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, strings.Join([]string{
+				"# HELP cortex_ingester_active_series_custom_tracker Number of currently active series matching a pre-configured label matchers per user.",
+				"# TYPE cortex_ingester_active_series_custom_tracker gauge",
+				`cortex_ingester_active_series_custom_tracker{name="continuous_test",user="anonymous"} %v`,
+				`cortex_ingester_active_series_custom_tracker{name="continuous_test",user="another"} 1000`,
+				`cortex_ingester_active_series_custom_tracker{name="another",user="anonymous"} 1000`,
+				"",
+			}, "\n"), activeSeries)
+		}))
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+
+	newTest := func(endpoints []string, reg prometheus.Registerer) *ActiveSeriesTrackersTest {
+		cfg := ActiveSeriesTrackersTestConfig{}
+		flagext.DefaultValues(&cfg)
+		cfg.Enabled = true
+		cfg.MetricsEndpoints = endpoints
+		cfg.ReplicationFactor = 2
+		cfg.GracePeriod = time.Minute
+
+		test := NewActiveSeriesTrackersTest(cfg, "anonymous", numSeries, log.NewNopLogger(), reg)
+		require.NoError(t, test.Init(context.Background(), now))
+		return test
+	}
+
+	t.Run("should succeed if the active series match the written series", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		test := newTest([]string{newIngester(t, 7), newIngester(t, 6), newIngester(t, 7)}, reg)
+
+		require.NoError(t, test.Run(context.Background(), now.Add(time.Minute)))
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_active_series_trackers_checks_total Total number of checks of the active series counted by the custom tracker.
+			# TYPE mimir_continuous_test_active_series_trackers_checks_total counter
+			mimir_continuous_test_active_series_trackers_checks_total{test="active-series-trackers"} 1
+
+			# HELP mimir_continuous_test_active_series_trackers_checks_failed_total Total number of failed checks of the active series counted by the custom tracker, because the metrics endpoints couldn't be scraped or the active series didn't match the written series.
+			# TYPE mimir_continuous_test_active_series_trackers_checks_failed_total counter
+			mimir_continuous_test_active_series_trackers_checks_failed_total{reason="mismatch",test="active-series-trackers"} 0
+			mimir_continuous_test_active_series_trackers_checks_failed_total{reason="scrape_failed",test="active-series-trackers"} 0
+
+			# HELP mimir_continuous_test_active_series_trackers_series Number of active series counted by the custom tracker at the last check, divided by the replication factor.
+			# TYPE mimir_continuous_test_active_series_trackers_series gauge
+			mimir_continuous_test_active_series_trackers_series{test="active-series-trackers"} 10
+		`), "mimir_continuous_test_active_series_trackers_checks_total", "mimir_continuous_test_active_series_trackers_checks_failed_total", "mimir_continuous_test_active_series_trackers_series"))
+	})
+
+	t.Run("should skip the check during the grace period", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		test := newTest([]string{newIngester(t, 0)}, reg)
+
+		require.NoError(t, test.Run(context.Background(), now.Add(30*time.Second)))
+		assert.Equal(t, 0.0, testutil.ToFloat64(test.checksTotal))
+	})
+
+	t.Run("should fail if the active series don't match the written series", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		test := newTest([]string{newIngester(t, 7), newIngester(t, 7), newIngester(t, 7)}, reg)
+
+		err := test.Run(context.Background(), now.Add(time.Minute))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "expected 10 active series")
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.checksFailedTotal.WithLabelValues(activeSeriesTrackersReasonMismatch)))
+		assert.Equal(t, 10.5, testutil.ToFloat64(test.activeSeries))
+	})
+
+	t.Run("should fail if the tracker isn't configured", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		t.Cleanup(srv.Close)
+
+		test := newTest([]string{srv.URL}, prometheus.NewPedanticRegistry())
+
+		err := test.Run(context.Background(), now.Add(time.Minute))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "didn't count any series")
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.checksFailedTotal.WithLabelValues(activeSeriesTrackersReasonMismatch)))
+	})
+
+	t.Run("should fail if a metrics endpoint can't be scraped", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(srv.Close)
+
+		test := newTest([]string{newIngester(t, 10), srv.URL}, prometheus.NewPedanticRegistry())
+
+		err := test.Run(context.Background(), now.Add(time.Minute))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unexpected status code 503")
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.checksFailedTotal.WithLabelValues(activeSeriesTrackersReasonScrapeFailed)))
+	})
+}
@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/dskit/multierror"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	alertForDurationNamespace = "mimir-continuous-test"
+	alertForDurationGroupName = "alert-for-duration"
+	alertForDurationAlertName = "MimirContinuousTestAlertForDuration"
+
+	// The alert condition is active for alertForDurationActivePeriod at the beginning of
+	// each alertForDurationCyclePeriod, and inactive for the rest of the cycle.
+	alertForDurationCyclePeriod  = 20 * time.Minute
+	alertForDurationActivePeriod = 10 * time.Minute
+
+	// alertForDurationRuleLoadDelay is how long to wait after the rule group has been set before the alert
+	// is expected to be evaluated. It accounts for the time the ruler takes to sync the rule groups.
+	alertForDurationRuleLoadDelay = 5 * time.Minute
+
+	alertStatePending = "pending"
+	alertStateFiring  = "firing"
+	alertStateNone    = "inactive"
+)
+
+var (
+	// The alert condition is a function of the evaluation time, so that the expected alert state transitions
+	// don't depend on the latency of writes and can be computed exactly.
+	alertForDurationExpr = fmt.Sprintf("vector(time() %% %d) < %d", int(alertForDurationCyclePeriod.Seconds()), int(alertForDurationActivePeriod.Seconds()))
+
+	alertForDurationQuery = fmt.Sprintf("ALERTS{alertname=%q}", alertForDurationAlertName)
+)
+
+type AlertForDurationTestConfig struct {
+	Enabled            bool
+	ForDuration        time.Duration
+	EvaluationInterval time.Duration
+}
+
+func (cfg *AlertForDurationTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.alert-for-duration-test.enabled", false, "Enable the test which creates an alerting rule with a 'for' duration, whose condition is periodically toggled, and checks whether the alert transitions from pending to firing to resolved at the expected times. The ruler must be enabled in Mimir for the tenant.")
+	f.DurationVar(&cfg.ForDuration, "tests.alert-for-duration-test.for-duration", 2*time.Minute, "The 'for' duration of the alerting rule.")
+	f.DurationVar(&cfg.EvaluationInterval, "tests.alert-for-duration-test.evaluation-interval", time.Minute, "The evaluation interval of the rule group containing the alerting rule.")
+}
+
+func (cfg *AlertForDurationTestConfig) Validate() error {
+	// The cycle period is a multiple of the active period, so evaluations are aligned to both.
+	if cfg.EvaluationInterval <= 0 || alertForDurationActivePeriod%cfg.EvaluationInterval != 0 {
+		return fmt.Errorf("the evaluation interval must be greater than 0 and a divisor of %s", alertForDurationActivePeriod)
+	}
+	if cfg.ForDuration <= 0 || cfg.ForDuration > alertForDurationActivePeriod-2*cfg.EvaluationInterval {
+		return fmt.Errorf("the for duration must be greater than 0 and not greater than %s minus twice the evaluation interval", alertForDurationActivePeriod)
+	}
+	return nil
+}
+
+// alertStateCheck is the expected state of the alert at a given evaluation timestamp.
+type alertStateCheck struct {
+	ts    time.Time
+	state string
+}
+
+// AlertForDurationTest creates an alerting rule with a "for" duration, whose condition is active for a fixed
+// period at the beginning of each cycle, and checks the alert state transitions through the ALERTS series
+// written by the ruler.
+type AlertForDurationTest struct {
+	name    string
+	cfg     AlertForDurationTestConfig
+	client  MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	// The start of the next cycle to verify, or zero if the rule group has not been set yet.
+	nextCycleStart time.Time
+}
+
+func NewAlertForDurationTest(cfg AlertForDurationTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *AlertForDurationTest {
+	const name = "alert-for-duration"
+
+	return &AlertForDurationTest{
+		name:    name,
+		cfg:     cfg,
+		client:  client,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+	}
+}
+
+// Name implements Test.
+func (t *AlertForDurationTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *AlertForDurationTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *AlertForDurationTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	if t.nextCycleStart.IsZero() {
+		if err := t.setRuleGroup(ctx, now); err != nil {
+			return err
+		}
+	}
+
+	// Verify all the cycles whose alert has been resolved, leaving an evaluation interval to the ruler
+	// to evaluate the rule group and write the ALERTS series.
+	for !t.nextCycleStart.Add(alertForDurationActivePeriod + t.cfg.EvaluationInterval).After(now) {
+		checked, err := t.verifyCycle(ctx, t.nextCycleStart)
+		if checked {
+			t.nextCycleStart = t.nextCycleStart.Add(alertForDurationCyclePeriod)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *AlertForDurationTest) setRuleGroup(ctx context.Context, now time.Time) error {
+	alertNode, exprNode := yaml.Node{}, yaml.Node{}
+	alertNode.SetString(alertForDurationAlertName)
+	exprNode.SetString(alertForDurationExpr)
+
+	group := rulefmt.RuleGroup{
+		Name:     alertForDurationGroupName,
+		Interval: model.Duration(t.cfg.EvaluationInterval),
+		// Evaluations must be aligned to the interval in order to compute the exact transition times.
+		AlignEvaluationTimeOnInterval: true,
+		Rules: []rulefmt.RuleNode{{
+			Alert: alertNode,
+			Expr:  exprNode,
+			For:   model.Duration(t.cfg.ForDuration),
+		}},
+	}
+
+	if err := t.client.SetRuleGroup(ctx, alertForDurationNamespace, group); err != nil {
+		level.Warn(t.logger).Log("msg", "Failed to set the rule group", "err", err)
+		return errors.Wrap(err, "failed to set the rule group")
+	}
+
+	// The first cycle to verify is the first one in which the rule group is expected to be evaluated
+	// since the evaluation preceding the start of the cycle.
+	t.nextCycleStart = firstCycleStartNotBefore(now.Add(alertForDurationRuleLoadDelay + t.cfg.EvaluationInterval))
+
+	level.Info(t.logger).Log("msg", "Rule group set", "first_cycle_start", t.nextCycleStart.UnixMilli())
+	return nil
+}
+
+// verifyCycle checks the alert state at the evaluations around each expected transition of the cycle
+// starting at the input time. Returns whether the alert state has been checked, and an error if the alert state
+// could not be queried or didn't match the expected one. A cycle which has not been checked should be retried.
+func (t *AlertForDurationTest) verifyCycle(ctx context.Context, start time.Time) (bool, error) {
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "AlertForDurationTest.verifyCycle")
+	defer sp.Finish()
+	logger := log.With(sp, "cycle_start", start.UnixMilli(), "query", alertForDurationQuery)
+
+	checks := t.expectedAlertStates(start)
+	states := make([]string, 0, len(checks))
+	for _, check := range checks {
+		t.metrics.queriesTotal.Inc()
+		queryStart := time.Now()
+		vector, err := t.client.Query(ctx, alertForDurationQuery, check.ts, WithResultsCacheEnabled(false))
+		t.metrics.observeQueryDuration(queryTypeInstant, false, queryStart)
+		if err != nil {
+			t.metrics.queriesFailedTotal.Inc()
+			t.metrics.observeFailure(outcomeTypeQuery)
+			level.Warn(logger).Log("msg", "Failed to execute instant query", "ts", check.ts.UnixMilli(), "err", err)
+			return false, errors.Wrap(err, "failed to execute instant query")
+		}
+		t.metrics.observeSuccess(outcomeTypeQuery)
+
+		states = append(states, alertStateFromVector(vector))
+	}
+
+	t.metrics.queryResultChecksTotal.Inc()
+
+	errs := multierror.New()
+	for i, check := range checks {
+		if states[i] != check.state {
+			errs.Add(fmt.Errorf("expected alert state %s at %s but got %s", check.state, check.ts.UTC().Format(time.RFC3339), states[i]))
+		}
+	}
+
+	if err := errs.Err(); err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Alert state transitions check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: alertForDurationQuery, Start: checks[0].ts, End: checks[len(checks)-1].ts, Error: err.Error()})
+		return true, errors.Wrap(err, "alert state transitions check failed")
+	}
+
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+	level.Debug(logger).Log("msg", "Alert state transitions check succeeded")
+	return true, nil
+}
+
+// expectedAlertStates returns the expected alert state at the evaluations before and after each transition
+// of the cycle starting at the input time. Since evaluations are aligned to the interval, the alert is expected
+// to be pending at the cycle start, firing at the first evaluation after the "for" duration elapsed, and resolved
+// at the end of the active period.
+func (t *AlertForDurationTest) expectedAlertStates(start time.Time) []alertStateCheck {
+	interval := t.cfg.EvaluationInterval
+	firingAt := start.Add(((t.cfg.ForDuration + interval - 1) / interval) * interval)
+	resolvedAt := start.Add(alertForDurationActivePeriod)
+
+	return []alertStateCheck{
+		{ts: start.Add(-interval), state: alertStateNone},
+		{ts: start, state: alertStatePending},
+		{ts: firingAt.Add(-interval), state: alertStatePending},
+		{ts: firingAt, state: alertStateFiring},
+		{ts: resolvedAt.Add(-interval), state: alertStateFiring},
+		{ts: resolvedAt, state: alertStateNone},
+	}
+}
+
+// alertStateFromVector returns the alert state from the ALERTS series in the input vector.
+func alertStateFromVector(vector model.Vector) string {
+	switch len(vector) {
+	case 0:
+		return alertStateNone
+	case 1:
+		return string(vector[0].Metric["alertstate"])
+	default:
+		return fmt.Sprintf("unexpected %d series", len(vector))
+	}
+}
+
+// firstCycleStartNotBefore returns the start of the first alert condition cycle which is not before the input time.
+func firstCycleStartNotBefore(ts time.Time) time.Time {
+	start := alignTimestampToInterval(ts, alertForDurationCyclePeriod)
+	if start.Before(ts) {
+		start = start.Add(alertForDurationCyclePeriod)
+	}
+	return start
+}
@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertForDurationTestConfig_Validate(t *testing.T) {
+	cfg := AlertForDurationTestConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.EvaluationInterval = 0
+	assert.Error(t, cfg.Validate())
+
+	cfg.EvaluationInterval = 3 * time.Minute
+	assert.Error(t, cfg.Validate())
+
+	cfg.EvaluationInterval = time.Minute
+	cfg.ForDuration = 8 * time.Minute
+	assert.NoError(t, cfg.Validate())
+
+	cfg.ForDuration = 9 * time.Minute
+	assert.Error(t, cfg.Validate())
+
+	cfg.ForDuration = 0
+	assert.Error(t, cfg.Validate())
+}
+
+func TestAlertForDurationTest_Run(t *testing.T) {
+	logger := log.NewNopLogger()
+	cfg := AlertForDurationTestConfig{}
+	flagext.DefaultValues(&cfg)
+
+	// The rule group is set at the beginning of a cycle, so the first verified cycle is the next one.
+	setAt := time.Unix(100*int64(alertForDurationCyclePeriod.Seconds()), 0)
+	cycleStart := setAt.Add(alertForDurationCyclePeriod)
+	verifyAt := cycleStart.Add(alertForDurationActivePeriod + cfg.EvaluationInterval)
+
+	alertVector := func(state string) model.Vector {
+		if state == alertStateNone {
+			return model.Vector{}
+		}
+		return model.Vector{{Metric: model.Metric{"alertname": alertForDurationAlertName, "alertstate": model.LabelValue(state)}}}
+	}
+
+	// mockQueries mocks the query results at each evaluation, based on the input alert states by offset from the cycle start.
+	mockQueries := func(client *ClientMock, states map[time.Duration]string) {
+		for offset, state := range states {
+			client.On("Query", mock.Anything, alertForDurationQuery, cycleStart.Add(offset), mock.Anything).Return(alertVector(state), nil)
+		}
+	}
+
+	expectedStates := map[time.Duration]string{
+		-time.Minute:     alertStateNone,
+		0:                alertStatePending,
+		time.Minute:      alertStatePending,
+		2 * time.Minute:  alertStateFiring,
+		9 * time.Minute:  alertStateFiring,
+		10 * time.Minute: alertStateNone,
+	}
+
+	t.Run("should set the rule group and check the alert state transitions", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("SetRuleGroup", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		mockQueries(client, expectedStates)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewAlertForDurationTest(cfg, client, logger, reg)
+
+		require.NoError(t, test.Run(context.Background(), setAt))
+		client.AssertNumberOfCalls(t, "SetRuleGroup", 1)
+		client.AssertNumberOfCalls(t, "Query", 0)
+		assert.Equal(t, cycleStart, test.nextCycleStart)
+
+		group := client.Calls[0].Arguments.Get(2).(rulefmt.RuleGroup)
+		assert.Equal(t, alertForDurationNamespace, client.Calls[0].Arguments.String(1))
+		assert.Equal(t, alertForDurationGroupName, group.Name)
+		assert.Equal(t, model.Duration(time.Minute), group.Interval)
+		assert.True(t, group.AlignEvaluationTimeOnInterval)
+		require.Len(t, group.Rules, 1)
+		assert.Equal(t, alertForDurationAlertName, group.Rules[0].Alert.Value)
+		assert.Equal(t, "vector(time() % 1200) < 600", group.Rules[0].Expr.Value)
+		assert.Equal(t, model.Duration(2*time.Minute), group.Rules[0].For)
+
+		// The cycle is not verified until the alert is expected to be resolved.
+		require.NoError(t, test.Run(context.Background(), verifyAt.Add(-time.Second)))
+		client.AssertNumberOfCalls(t, "Query", 0)
+
+		require.NoError(t, test.Run(context.Background(), verifyAt))
+		client.AssertNumberOfCalls(t, "SetRuleGroup", 1)
+		client.AssertNumberOfCalls(t, "Query", len(expectedStates))
+		assert.Equal(t, cycleStart.Add(alertForDurationCyclePeriod), test.nextCycleStart)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_queries_total Total number of attempted query requests.
+			# TYPE mimir_continuous_test_queries_total counter
+			mimir_continuous_test_queries_total{test="alert-for-duration"} 6
+
+			# HELP mimir_continuous_test_query_result_checks_total Total number of query results checked for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_total counter
+			mimir_continuous_test_query_result_checks_total{test="alert-for-duration"} 1
+
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="alert-for-duration"} 0
+		`), "mimir_continuous_test_queries_total", "mimir_continuous_test_query_result_checks_total", "mimir_continuous_test_query_result_checks_failed_total"))
+	})
+
+	t.Run("should fail if the alert fires before the for duration elapsed", func(t *testing.T) {
+		states := map[time.Duration]string{}
+		for offset, state := range expectedStates {
+			states[offset] = state
+		}
+		states[time.Minute] = alertStateFiring
+
+		client := &ClientMock{}
+		client.On("SetRuleGroup", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		mockQueries(client, states)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewAlertForDurationTest(cfg, client, logger, reg)
+
+		require.NoError(t, test.Run(context.Background(), setAt))
+		err := test.Run(context.Background(), verifyAt)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "expected alert state pending")
+
+		// The failed cycle is not checked again.
+		assert.Equal(t, cycleStart.Add(alertForDurationCyclePeriod), test.nextCycleStart)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="alert-for-duration"} 1
+		`), "mimir_continuous_test_query_result_checks_failed_total"))
+	})
+
+	t.Run("should retry the cycle if the alert state could not be queried", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("SetRuleGroup", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{}, errors.New("failed"))
+
+		test := NewAlertForDurationTest(cfg, client, logger, prometheus.NewPedanticRegistry())
+
+		require.NoError(t, test.Run(context.Background(), setAt))
+		require.Error(t, test.Run(context.Background(), verifyAt))
+		assert.Equal(t, cycleStart, test.nextCycleStart)
+	})
+
+	t.Run("should retry setting the rule group if it failed", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("SetRuleGroup", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("failed")).Once()
+		client.On("SetRuleGroup", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+		test := NewAlertForDurationTest(cfg, client, logger, prometheus.NewPedanticRegistry())
+
+		require.Error(t, test.Run(context.Background(), setAt))
+		assert.True(t, test.nextCycleStart.IsZero())
+
+		require.NoError(t, test.Run(context.Background(), setAt.Add(time.Minute)))
+		client.AssertNumberOfCalls(t, "SetRuleGroup", 2)
+		assert.Equal(t, cycleStart, test.nextCycleStart)
+	})
+}
+
+func TestAlertForDurationTest_expectedAlertStates(t *testing.T) {
+	cfg := AlertForDurationTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.ForDuration = 90 * time.Second
+
+	test := NewAlertForDurationTest(cfg, &ClientMock{}, log.NewNopLogger(), nil)
+	start := time.Unix(1200, 0)
+
+	// The alert fires at the first evaluation after the for duration elapsed.
+	assert.Equal(t, []alertStateCheck{
+		{ts: start.Add(-time.Minute), state: alertStateNone},
+		{ts: start, state: alertStatePending},
+		{ts: start.Add(time.Minute), state: alertStatePending},
+		{ts: start.Add(2 * time.Minute), state: alertStateFiring},
+		{ts: start.Add(9 * time.Minute), state: alertStateFiring},
+		{ts: start.Add(10 * time.Minute), state: alertStateNone},
+	}, test.expectedAlertStates(start))
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const apiProbesAPILabel = "api"
+
+type APIProbesTestConfig struct {
+	RulerEnabled        bool
+	AlertmanagerEnabled bool
+}
+
+func (cfg *APIProbesTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.RulerEnabled, "tests.api-probes-test.ruler-enabled", false, "Enable probing the availability of the ruler API, listing the rules at each test run.")
+	f.BoolVar(&cfg.AlertmanagerEnabled, "tests.api-probes-test.alertmanager-enabled", false, "Enable probing the availability of the Alertmanager API, getting the Alertmanager status at each test run. Requires -tests.alertmanager-endpoint to be set.")
+}
+
+// Enabled returns whether any API probe is enabled.
+func (cfg *APIProbesTestConfig) Enabled() bool {
+	return cfg.RulerEnabled || cfg.AlertmanagerEnabled
+}
+
+// apiProbe is a request sent to a Mimir API to check whether it's available.
+type apiProbe struct {
+	api   string
+	probe func(ctx context.Context) error
+}
+
+// APIProbesTest periodically sends lightweight requests to the Mimir configuration APIs, which are not
+// exercised by the write and read path tests, and checks whether they succeed.
+type APIProbesTest struct {
+	name   string
+	cfg    APIProbesTestConfig
+	client MimirClient
+	logger log.Logger
+	probes []apiProbe
+
+	probesTotal       *prometheus.CounterVec
+	probesFailedTotal *prometheus.CounterVec
+	probeDuration     *prometheus.HistogramVec
+}
+
+func NewAPIProbesTest(cfg APIProbesTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *APIProbesTest {
+	const name = "api-probes"
+
+	t := &APIProbesTest{
+		name:   name,
+		cfg:    cfg,
+		client: client,
+		logger: log.With(logger, "test", name),
+
+		probesTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_api_probes_total",
+			Help:        "Total number of attempted API probe requests.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{apiProbesAPILabel}),
+		probesFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_api_probes_failed_total",
+			Help:        "Total number of failed API probe requests.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{apiProbesAPILabel, maintenanceLabel}),
+		probeDuration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "mimir_continuous_test_api_probe_duration_seconds",
+			Help:        "Duration of API probe requests.",
+			ConstLabels: map[string]string{"test": name},
+			Buckets:     prometheus.DefBuckets,
+		}, []string{apiProbesAPILabel}),
+	}
+
+	if cfg.RulerEnabled {
+		t.probes = append(t.probes, apiProbe{api: "ruler", probe: client.ListRules})
+	}
+	if cfg.AlertmanagerEnabled {
+		t.probes = append(t.probes, apiProbe{api: "alertmanager", probe: client.GetAlertmanagerStatus})
+	}
+
+	// Initialise the metrics so that they're exported even if no failure occurred.
+	for _, p := range t.probes {
+		t.probesTotal.WithLabelValues(p.api)
+		t.probesFailedTotal.WithLabelValues(p.api, "false")
+	}
+
+	return t
+}
+
+// Name implements Test.
+func (t *APIProbesTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *APIProbesTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *APIProbesTest) Run(ctx context.Context, _ time.Time) error {
+	errs := new(multierror.MultiError)
+
+	for _, p := range t.probes {
+		errs.Add(t.runProbe(ctx, p))
+	}
+
+	return errs.Err()
+}
+
+func (t *APIProbesTest) runProbe(ctx context.Context, p apiProbe) error {
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "APIProbesTest.runProbe")
+	defer sp.Finish()
+	logger := log.With(sp, "api", p.api)
+
+	t.probesTotal.WithLabelValues(p.api).Inc()
+	start := time.Now()
+	err := p.probe(ctx)
+	t.probeDuration.WithLabelValues(p.api).Observe(time.Since(start).Seconds())
+
+	if err == nil {
+		level.Debug(logger).Log("msg", "API probe succeeded")
+		return nil
+	}
+
+	// Failures are not tracked at all if they're suppressed during maintenance.
+	if state := maintenanceStateFromContext(ctx); state != maintenanceSuppressed {
+		t.probesFailedTotal.WithLabelValues(p.api, strconv.FormatBool(state != maintenanceNone)).Inc()
+	}
+
+	level.Warn(logger).Log("msg", "API probe failed", "err", err)
+	return errors.Wrapf(err, "%s API probe failed", p.api)
+}
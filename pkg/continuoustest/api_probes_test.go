@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIProbesTest_Run(t *testing.T) {
+	logger := log.NewNopLogger()
+	cfg := APIProbesTestConfig{RulerEnabled: true, AlertmanagerEnabled: true}
+	now := time.Now()
+
+	t.Run("should probe the enabled APIs and track no failure if all probes succeed", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("ListRules", mock.Anything).Return(nil)
+		client.On("GetAlertmanagerStatus", mock.Anything).Return(nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewAPIProbesTest(cfg, client, logger, reg)
+
+		require.NoError(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "ListRules", 1)
+		client.AssertNumberOfCalls(t, "GetAlertmanagerStatus", 1)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_api_probes_total Total number of attempted API probe requests.
+			# TYPE mimir_continuous_test_api_probes_total counter
+			mimir_continuous_test_api_probes_total{api="alertmanager",test="api-probes"} 1
+			mimir_continuous_test_api_probes_total{api="ruler",test="api-probes"} 1
+
+			# HELP mimir_continuous_test_api_probes_failed_total Total number of failed API probe requests.
+			# TYPE mimir_continuous_test_api_probes_failed_total counter
+			mimir_continuous_test_api_probes_failed_total{api="alertmanager",maintenance="false",test="api-probes"} 0
+			mimir_continuous_test_api_probes_failed_total{api="ruler",maintenance="false",test="api-probes"} 0
+		`), "mimir_continuous_test_api_probes_total", "mimir_continuous_test_api_probes_failed_total"))
+
+		count, err := testutil.GatherAndCount(reg, "mimir_continuous_test_api_probe_duration_seconds")
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("should track failed probes", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("ListRules", mock.Anything).Return(nil)
+		client.On("GetAlertmanagerStatus", mock.Anything).Return(errors.New("service unavailable"))
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewAPIProbesTest(cfg, client, logger, reg)
+
+		err := test.Run(context.Background(), now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "alertmanager API probe failed")
+
+		// Failures during maintenance are tracked with the maintenance label, or not tracked at all if suppressed.
+		require.Error(t, test.Run(contextWithMaintenanceState(context.Background(), maintenanceTracked), now))
+		require.Error(t, test.Run(contextWithMaintenanceState(context.Background(), maintenanceSuppressed), now))
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_api_probes_total Total number of attempted API probe requests.
+			# TYPE mimir_continuous_test_api_probes_total counter
+			mimir_continuous_test_api_probes_total{api="alertmanager",test="api-probes"} 3
+			mimir_continuous_test_api_probes_total{api="ruler",test="api-probes"} 3
+
+			# HELP mimir_continuous_test_api_probes_failed_total Total number of failed API probe requests.
+			# TYPE mimir_continuous_test_api_probes_failed_total counter
+			mimir_continuous_test_api_probes_failed_total{api="alertmanager",maintenance="false",test="api-probes"} 1
+			mimir_continuous_test_api_probes_failed_total{api="alertmanager",maintenance="true",test="api-probes"} 1
+			mimir_continuous_test_api_probes_failed_total{api="ruler",maintenance="false",test="api-probes"} 0
+		`), "mimir_continuous_test_api_probes_total", "mimir_continuous_test_api_probes_failed_total"))
+	})
+
+	t.Run("should probe only the enabled APIs", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("ListRules", mock.Anything).Return(nil)
+
+		test := NewAPIProbesTest(APIProbesTestConfig{RulerEnabled: true}, client, logger, prometheus.NewPedanticRegistry())
+
+		require.NoError(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "ListRules", 1)
+		client.AssertNotCalled(t, "GetAlertmanagerStatus", mock.Anything)
+	})
+}
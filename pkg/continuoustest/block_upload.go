@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	blockUploadMetricName = "mimir_continuous_test_block_upload_sine_wave"
+	blockUploadBlockRange = time.Hour
+)
+
+var (
+	// See queryMetricSum for the reason why max_over_time() is used.
+	blockUploadQueryMetricSum = fmt.Sprintf("sum(max_over_time(%s[1s]))", blockUploadMetricName)
+)
+
+type BlockUploadTestConfig struct {
+	Enabled          bool
+	NumSeries        int
+	BlockAge         time.Duration
+	UploadInterval   time.Duration
+	UploadTimeout    time.Duration
+	QueryableTimeout time.Duration
+}
+
+func (cfg *BlockUploadTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.block-upload-test.enabled", false, "Enable the test which periodically builds a TSDB block with historical samples, uploads it through the block upload API, and checks whether the samples can be queried back. Block upload must be enabled in Mimir for the tenant.")
+	f.IntVar(&cfg.NumSeries, "tests.block-upload-test.num-series", 100, "Number of series in each uploaded block.")
+	f.DurationVar(&cfg.BlockAge, "tests.block-upload-test.block-age", 7*24*time.Hour, "How old the samples in each uploaded block are. It must be greater than the time range covered by the ingesters, and lower than the tenant retention.")
+	f.DurationVar(&cfg.UploadInterval, "tests.block-upload-test.upload-interval", time.Hour, "How frequently a new block should be uploaded.")
+	f.DurationVar(&cfg.UploadTimeout, "tests.block-upload-test.upload-timeout", 5*time.Minute, "How long to wait for a block to be uploaded and validated by Mimir.")
+	f.DurationVar(&cfg.QueryableTimeout, "tests.block-upload-test.queryable-timeout", time.Hour, "How long to wait for an uploaded block to become queryable before the test fails.")
+}
+
+func (cfg *BlockUploadTestConfig) Validate() error {
+	if cfg.NumSeries <= 0 {
+		return errors.New("the number of series in the uploaded blocks must be greater than 0")
+	}
+	if cfg.BlockAge < blockUploadBlockRange {
+		return fmt.Errorf("the age of the uploaded blocks must be at least %s", blockUploadBlockRange)
+	}
+	return nil
+}
+
+// uploadedBlock is a block which has been uploaded but whose samples have not been successfully queried yet.
+type uploadedBlock struct {
+	start      time.Time
+	end        time.Time
+	uploadedAt time.Time
+}
+
+// BlockUploadTest periodically builds a TSDB block containing historical sine wave samples, uploads it
+// through the block upload API, waits until it becomes queryable and then checks the queried samples.
+type BlockUploadTest struct {
+	name    string
+	cfg     BlockUploadTestConfig
+	client  MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	uploadsTotal       prometheus.Counter
+	uploadsFailedTotal *prometheus.CounterVec
+
+	// The last block uploaded and not queried yet, or nil if there's no such block.
+	pending        *uploadedBlock
+	lastUploadTime time.Time
+}
+
+func NewBlockUploadTest(cfg BlockUploadTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *BlockUploadTest {
+	const name = "block-upload"
+
+	t := &BlockUploadTest{
+		name:    name,
+		cfg:     cfg,
+		client:  client,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+
+		uploadsTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_block_uploads_total",
+			Help:        "Total number of attempted block uploads.",
+			ConstLabels: map[string]string{"test": name},
+		}),
+		uploadsFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_block_uploads_failed_total",
+			Help:        "Total number of failed block uploads.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{maintenanceLabel}),
+	}
+
+	// Initialise the metric so that it's exported even if no failure occurred.
+	t.uploadsFailedTotal.WithLabelValues("false")
+
+	return t
+}
+
+// Name implements Test.
+func (t *BlockUploadTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *BlockUploadTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *BlockUploadTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	// Wait until the previously uploaded block has been queried successfully before uploading a new one.
+	if t.pending != nil {
+		return t.queryPendingBlock(ctx, now)
+	}
+
+	if !t.lastUploadTime.IsZero() && now.Sub(t.lastUploadTime) < t.cfg.UploadInterval {
+		return nil
+	}
+
+	return t.uploadBlock(ctx, now)
+}
+
+func (t *BlockUploadTest) uploadBlock(ctx context.Context, now time.Time) error {
+	end := alignTimestampToInterval(now.Add(-t.cfg.BlockAge), blockUploadBlockRange)
+	start := end.Add(-blockUploadBlockRange)
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "BlockUploadTest.uploadBlock")
+	defer sp.Finish()
+	logger := log.With(sp, "start", start.UnixMilli(), "end", end.UnixMilli(), "num_series", t.cfg.NumSeries)
+
+	// The upload is attempted once per interval, regardless of its outcome.
+	t.lastUploadTime = now
+	t.uploadsTotal.Inc()
+
+	err := t.buildAndUploadBlock(ctx, start, end)
+	if err != nil {
+		// Failures are not tracked at all if they're suppressed during maintenance.
+		if state := maintenanceStateFromContext(ctx); state != maintenanceSuppressed {
+			t.uploadsFailedTotal.WithLabelValues(strconv.FormatBool(state != maintenanceNone)).Inc()
+		}
+
+		level.Warn(logger).Log("msg", "Failed to upload block", "err", err)
+		return errors.Wrap(err, "failed to upload block")
+	}
+
+	level.Info(logger).Log("msg", "Block uploaded, waiting for it to become queryable")
+	t.pending = &uploadedBlock{start: start, end: end, uploadedAt: now}
+	return nil
+}
+
+func (t *BlockUploadTest) buildAndUploadBlock(ctx context.Context, start, end time.Time) error {
+	dir, err := os.MkdirTemp("", "mimir-continuous-test-block-upload")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+
+	blockDir, err := writeSineWaveBlock(ctx, t.logger, dir, blockUploadMetricName, start, end, t.cfg.NumSeries)
+	if err != nil {
+		return errors.Wrap(err, "failed to write block")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.UploadTimeout)
+	defer cancel()
+
+	return t.client.UploadBlock(ctx, blockDir)
+}
+
+// queryPendingBlock runs a range query over the time range of the pending block and checks the result.
+// The pending block is cleared once the check succeeds, or if it didn't succeed within the queryable timeout.
+func (t *BlockUploadTest) queryPendingBlock(ctx context.Context, now time.Time) error {
+	start, end := t.pending.start, t.pending.end.Add(-writeInterval)
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "BlockUploadTest.queryPendingBlock")
+	defer sp.Finish()
+	logger := log.With(sp, "query", blockUploadQueryMetricSum, "start", start.UnixMilli(), "end", end.UnixMilli(), "step", writeInterval)
+
+	t.metrics.queriesTotal.Inc()
+	queryStart := time.Now()
+	matrix, err := t.client.QueryRange(ctx, blockUploadQueryMetricSum, start, end, writeInterval, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeRange, false, queryStart)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute range query", "err", err)
+		return errors.Wrap(err, "failed to execute range query")
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	// The uploaded block may take a while before it's discovered by store-gateways and queriers,
+	// so we don't account for a failed check until the queryable timeout has expired.
+	_, err = verifySineWaveSamplesSum(matrix, t.cfg.NumSeries, writeInterval)
+	if err != nil && now.Sub(t.pending.uploadedAt) < t.cfg.QueryableTimeout {
+		level.Debug(logger).Log("msg", "Uploaded block is not queryable yet", "err", err)
+		return nil
+	}
+
+	t.pending = nil
+	t.metrics.queryResultChecksTotal.Inc()
+	if err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Uploaded block query result check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: blockUploadQueryMetricSum, Start: start, End: end, Step: writeInterval.String(), Error: err.Error()})
+		return errors.Wrap(err, "uploaded block query result check failed")
+	}
+
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+	level.Info(logger).Log("msg", "Uploaded block query result check succeeded")
+	return nil
+}
+
+// writeSineWaveBlock writes a TSDB block in the input directory, containing numSeries sine wave series with
+// a sample every writeInterval in the [start, end) time range. Returns the directory of the written block.
+func writeSineWaveBlock(ctx context.Context, logger log.Logger, dir, name string, start, end time.Time, numSeries int) (string, error) {
+	return writeSeriesBlock(ctx, logger, dir, start, end, func(ts time.Time) []prompb.TimeSeries {
+		return generateSineWaveSeries(name, ts, numSeries)
+	})
+}
+
+// writeSeriesBlock writes a TSDB block in the input directory, containing the series returned by the generate
+// function for each writeInterval-aligned timestamp in the [start, end) time range. Returns the directory of
+// the written block.
+func writeSeriesBlock(ctx context.Context, logger log.Logger, dir string, start, end time.Time, generate func(ts time.Time) []prompb.TimeSeries) (string, error) {
+	w, err := tsdb.NewBlockWriter(logger, dir, end.Sub(start).Milliseconds())
+	if err != nil {
+		return "", err
+	}
+	defer w.Close()
+
+	app := w.Appender(ctx)
+	for ts := start; ts.Before(end); ts = ts.Add(writeInterval) {
+		for _, series := range generate(ts) {
+			builder := labels.NewScratchBuilder(len(series.Labels))
+			for _, l := range series.Labels {
+				builder.Add(l.Name, l.Value)
+			}
+			builder.Sort()
+
+			for _, s := range series.Samples {
+				if _, err := app.Append(0, builder.Labels(), s.Timestamp, s.Value); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	if err := app.Commit(); err != nil {
+		return "", err
+	}
+
+	id, err := w.Flush(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, id.String()), nil
+}
@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockUploadTest_Run(t *testing.T) {
+	logger := log.NewNopLogger()
+	cfg := BlockUploadTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+	cfg.BlockAge = 24 * time.Hour
+
+	now := time.Unix(10*86400+1800, 0)
+	expectedStart := time.Unix(9*86400-3600, 0)
+	expectedEnd := time.Unix(9*86400, 0)
+
+	t.Run("should upload a block with historical samples and then query it back", func(t *testing.T) {
+		var uploadedBlocks []tsdb.BlockMeta
+
+		client := &ClientMock{}
+		client.On("UploadBlock", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			// Read the block meta while the block directory still exists.
+			b, err := tsdb.OpenBlock(logger, args.String(1), nil)
+			require.NoError(t, err)
+			uploadedBlocks = append(uploadedBlocks, b.Meta())
+			require.NoError(t, b.Close())
+		}).Return(nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewBlockUploadTest(cfg, client, logger, reg)
+
+		// The first run uploads the block.
+		require.NoError(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "UploadBlock", 1)
+		client.AssertNumberOfCalls(t, "QueryRange", 0)
+		require.NotNil(t, test.pending)
+
+		require.Len(t, uploadedBlocks, 1)
+		assert.Equal(t, expectedStart.UnixMilli(), uploadedBlocks[0].MinTime)
+		assert.Equal(t, expectedEnd.Add(-writeInterval).UnixMilli()+1, uploadedBlocks[0].MaxTime)
+		assert.Equal(t, uint64(2), uploadedBlocks[0].Stats.NumSeries)
+		assert.Equal(t, uint64(2*180), uploadedBlocks[0].Stats.NumSamples)
+
+		// The block is not queryable yet.
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil).Once()
+		require.NoError(t, test.Run(context.Background(), now.Add(5*time.Minute)))
+		client.AssertNumberOfCalls(t, "UploadBlock", 1)
+		client.AssertCalled(t, "QueryRange", mock.Anything, "sum(max_over_time(mimir_continuous_test_block_upload_sine_wave[1s]))", expectedStart, expectedEnd.Add(-writeInterval), writeInterval, mock.Anything)
+		require.NotNil(t, test.pending)
+
+		// The block is now queryable.
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(generateSineWaveSumMatrix(expectedStart, expectedEnd.Add(-writeInterval), 2), nil).Once()
+		require.NoError(t, test.Run(context.Background(), now.Add(10*time.Minute)))
+		require.Nil(t, test.pending)
+
+		// No new block is uploaded until the upload interval has elapsed.
+		require.NoError(t, test.Run(context.Background(), now.Add(15*time.Minute)))
+		client.AssertNumberOfCalls(t, "UploadBlock", 1)
+		client.AssertNumberOfCalls(t, "QueryRange", 2)
+
+		require.NoError(t, test.Run(context.Background(), now.Add(cfg.UploadInterval)))
+		client.AssertNumberOfCalls(t, "UploadBlock", 2)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_block_uploads_total Total number of attempted block uploads.
+			# TYPE mimir_continuous_test_block_uploads_total counter
+			mimir_continuous_test_block_uploads_total{test="block-upload"} 2
+
+			# HELP mimir_continuous_test_block_uploads_failed_total Total number of failed block uploads.
+			# TYPE mimir_continuous_test_block_uploads_failed_total counter
+			mimir_continuous_test_block_uploads_failed_total{maintenance="false",test="block-upload"} 0
+
+			# HELP mimir_continuous_test_queries_total Total number of attempted query requests.
+			# TYPE mimir_continuous_test_queries_total counter
+			mimir_continuous_test_queries_total{test="block-upload"} 2
+
+			# HELP mimir_continuous_test_query_result_checks_total Total number of query results checked for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_total counter
+			mimir_continuous_test_query_result_checks_total{test="block-upload"} 1
+
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="block-upload"} 0
+		`),
+			"mimir_continuous_test_block_uploads_total", "mimir_continuous_test_block_uploads_failed_total",
+			"mimir_continuous_test_queries_total",
+			"mimir_continuous_test_query_result_checks_total", "mimir_continuous_test_query_result_checks_failed_total"))
+	})
+
+	t.Run("should fail if the uploaded block doesn't become queryable within the timeout", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("UploadBlock", mock.Anything, mock.Anything).Return(nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewBlockUploadTest(cfg, client, logger, reg)
+
+		require.NoError(t, test.Run(context.Background(), now))
+		require.NoError(t, test.Run(context.Background(), now.Add(cfg.QueryableTimeout/2)))
+		require.Error(t, test.Run(context.Background(), now.Add(cfg.QueryableTimeout)))
+		require.Nil(t, test.pending)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_total Total number of query results checked for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_total counter
+			mimir_continuous_test_query_result_checks_total{test="block-upload"} 1
+
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="block-upload"} 1
+		`), "mimir_continuous_test_query_result_checks_total", "mimir_continuous_test_query_result_checks_failed_total"))
+	})
+
+	t.Run("should track failed block uploads", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("UploadBlock", mock.Anything, mock.Anything).Return(errors.New("block upload is disabled"))
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewBlockUploadTest(cfg, client, logger, reg)
+
+		require.Error(t, test.Run(context.Background(), now))
+		require.Nil(t, test.pending)
+
+		// The upload is not retried until the upload interval has elapsed.
+		require.NoError(t, test.Run(context.Background(), now.Add(time.Minute)))
+		client.AssertNumberOfCalls(t, "UploadBlock", 1)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_block_uploads_total Total number of attempted block uploads.
+			# TYPE mimir_continuous_test_block_uploads_total counter
+			mimir_continuous_test_block_uploads_total{test="block-upload"} 1
+
+			# HELP mimir_continuous_test_block_uploads_failed_total Total number of failed block uploads.
+			# TYPE mimir_continuous_test_block_uploads_failed_total counter
+			mimir_continuous_test_block_uploads_failed_total{maintenance="false",test="block-upload"} 1
+		`), "mimir_continuous_test_block_uploads_total", "mimir_continuous_test_block_uploads_failed_total"))
+	})
+}
+
+// generateSineWaveSumMatrix returns the expected result of a range query summing numSeries sine wave
+// series with a sample every writeInterval in the [start, end] time range.
+func generateSineWaveSumMatrix(start, end time.Time, numSeries int) model.Matrix {
+	var values []model.SamplePair
+	for ts := start; !ts.After(end); ts = ts.Add(writeInterval) {
+		values = append(values, model.SamplePair{
+			Timestamp: model.Time(ts.UnixMilli()),
+			Value:     model.SampleValue(generateSineWaveValue(ts) * float64(numSeries)),
+		})
+	}
+
+	return model.Matrix{{Values: values}}
+}
@@ -0,0 +1,238 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/globalerror"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	// cardinalityLimitMetricName is the name of the throwaway metric written to exceed the series limit.
+	cardinalityLimitMetricName = "mimir_continuous_test_cardinality_limit"
+	cardinalityLimitCycleLabel = "cycle"
+)
+
+type CardinalityLimitTestConfig struct {
+	Enabled          bool
+	TenantID         string
+	MaxSeriesPerUser int
+	RecoveryTimeout  time.Duration
+}
+
+func (cfg *CardinalityLimitTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.cardinality-limit-test.enabled", false, "Enable the test which writes series of a throwaway metric to a dedicated tenant until the per-tenant series limit is exceeded, checks that the writes are rejected with the expected status code and error, and then stops writing and checks over the following test runs that new series are accepted again once the throwaway series have been removed from the ingesters' heads. The tenant is selected with the X-Scope-OrgID header, so the test can't be used with basic or bearer token authentication.")
+	f.StringVar(&cfg.TenantID, "tests.cardinality-limit-test.tenant-id", "mimir-continuous-test-cardinality-limit", "The ID of the dedicated tenant whose series limit is exceeded. It must not be used by other writers.")
+	f.IntVar(&cfg.MaxSeriesPerUser, "tests.cardinality-limit-test.max-series-per-user", 0, "Maximum number of in-memory series configured in Mimir for the dedicated tenant. The test doubles the number of series written until the limit is hit, up to twice the limit. The ingestion rate limit must allow writing these series in a single burst.")
+	f.DurationVar(&cfg.RecoveryTimeout, "tests.cardinality-limit-test.recovery-timeout", 6*time.Hour, "Maximum time from exceeding the series limit until new series are expected to be accepted again. It should account for the TSDB block range and the head compaction interval, after which the idle series are removed from the ingesters' heads.")
+}
+
+func (cfg *CardinalityLimitTestConfig) Validate() error {
+	if cfg.TenantID == "" {
+		return errors.New("the tenant ID of the cardinality limit test must not be empty")
+	}
+	if cfg.MaxSeriesPerUser <= 0 {
+		return errors.New("the max series per user of the cardinality limit test must be greater than 0")
+	}
+	if cfg.RecoveryTimeout <= 0 {
+		return errors.New("the recovery timeout of the cardinality limit test must be greater than 0")
+	}
+	return nil
+}
+
+// cardinalityLimitCycle holds the state of a cycle of the test, from exceeding the series limit until the
+// tenant recovers.
+type cardinalityLimitCycle struct {
+	// id is the value of the cycle label of the throwaway series, so that the series of each cycle are new.
+	id         string
+	exceededAt time.Time
+
+	// violated is whether the recovery timeout has been exceeded, so that the violation is tracked once.
+	violated bool
+}
+
+// CardinalityLimitTest continuously verifies the accounting of the per-tenant series limit. Each cycle writes series
+// of a throwaway metric to a dedicated tenant until the writes are rejected because of the series limit, and then
+// stops writing them and tries to write a new series on each test run, until it's accepted again because the
+// throwaway series have been removed from the ingesters' heads.
+//
+// The state of the current cycle is kept in memory, so a cycle interrupted by a restart of the tool is not verified.
+type CardinalityLimitTest struct {
+	name    string
+	cfg     CardinalityLimitTestConfig
+	client  MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	cycle *cardinalityLimitCycle
+
+	probesFailedTotal *prometheus.CounterVec
+	recoveryDuration  prometheus.Histogram
+}
+
+func NewCardinalityLimitTest(cfg CardinalityLimitTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *CardinalityLimitTest {
+	const name = "cardinality-limit"
+
+	t := &CardinalityLimitTest{
+		name:    name,
+		cfg:     cfg,
+		client:  client,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+		probesFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_cardinality_limit_probes_failed_total",
+			Help:        "Total number of failed cycles of the cardinality limit test, because the series limit hasn't been enforced, the writes failed with an unexpected error, or new series haven't been accepted again within the recovery timeout.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"reason"}),
+		recoveryDuration: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:        "mimir_continuous_test_cardinality_limit_recovery_duration_seconds",
+			Help:        "Time elapsed from exceeding the series limit until new series were accepted again.",
+			ConstLabels: map[string]string{"test": name},
+			Buckets:     prometheus.ExponentialBuckets(15*60, 2, 8),
+		}),
+	}
+
+	// Initialise the metrics so that they're exported even if no failure occurred.
+	for _, reason := range []string{limitProbeReasonNotEnforced, limitProbeReasonUnexpectedErr, limitProbeReasonNotRecovered} {
+		t.probesFailedTotal.WithLabelValues(reason)
+	}
+
+	return t
+}
+
+// Name implements Test.
+func (t *CardinalityLimitTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *CardinalityLimitTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *CardinalityLimitTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "CardinalityLimitTest.Run")
+	defer sp.Finish()
+
+	if t.cycle == nil {
+		return t.exceedLimit(ctx, log.With(sp, "tenant", t.cfg.TenantID), now)
+	}
+	return t.verifyRecovered(ctx, log.With(sp, "tenant", t.cfg.TenantID, "cycle", t.cycle.id), now)
+}
+
+// exceedLimit doubles the number of throwaway series written until the write is rejected because of the series
+// limit, up to twice the limit. Once the limit has been hit, a new cycle starts.
+func (t *CardinalityLimitTest) exceedLimit(ctx context.Context, logger log.Logger, now time.Time) error {
+	cycleID := strconv.FormatInt(now.Unix(), 10)
+	logger = log.With(logger, "cycle", cycleID)
+
+	generate := func(from, to int) []prompb.TimeSeries {
+		return generateCardinalityLimitSeries(now, cycleID, from, to)
+	}
+	written, end, statusCode, err := rampUpSeriesUntilRejected(ctx, t.cfg.MaxSeriesPerUser, t.write, generate)
+
+	switch {
+	case statusCode/100 == 2:
+		t.probesFailedTotal.WithLabelValues(limitProbeReasonNotEnforced).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Series above the series limit have been unexpectedly accepted", "series", written)
+		return errors.Errorf("%d series, above the series limit %d, have been unexpectedly accepted in tenant %s", written, t.cfg.MaxSeriesPerUser, t.cfg.TenantID)
+
+	case isWriteRejectedWithErrorID(statusCode, err, http.StatusBadRequest, globalerror.MaxSeriesPerUser):
+		t.metrics.observeSuccess(outcomeTypeWrite)
+		t.cycle = &cardinalityLimitCycle{id: cycleID, exceededAt: now}
+		level.Info(logger).Log("msg", "Write request has been rejected because of the series limit, as expected", "series", end, "status_code", statusCode)
+		return nil
+
+	default:
+		return t.unexpectedError(logger, statusCode, err)
+	}
+}
+
+// verifyRecovered writes a new series, which is expected to be rejected until the throwaway series have been
+// removed from the ingesters' heads. The check fails only once the recovery timeout has elapsed since the series
+// limit was exceeded.
+func (t *CardinalityLimitTest) verifyRecovered(ctx context.Context, logger log.Logger, now time.Time) error {
+	elapsed := now.Sub(t.cycle.exceededAt)
+	logger = log.With(logger, "elapsed_since_exceeded", elapsed)
+
+	// Each attempt writes a different series, so that an accepted series doesn't make the following attempts pass.
+	id := int(elapsed / time.Second)
+	statusCode, err := t.write(ctx, generateCardinalityLimitSeries(now, t.cycle.id+"-recovery", id, id+1))
+
+	switch {
+	case statusCode/100 == 2:
+		t.recoveryDuration.Observe(elapsed.Seconds())
+		t.metrics.observeSuccess(outcomeTypeWrite)
+		level.Info(logger).Log("msg", "New series have been accepted again after exceeding the series limit")
+		t.cycle = nil
+		return nil
+
+	case isWriteRejectedWithErrorID(statusCode, err, http.StatusBadRequest, globalerror.MaxSeriesPerUser):
+		if elapsed <= t.cfg.RecoveryTimeout {
+			level.Debug(logger).Log("msg", "New series are still rejected because of the series limit, within the recovery timeout")
+			return nil
+		}
+
+		if !t.cycle.violated {
+			t.cycle.violated = true
+			t.probesFailedTotal.WithLabelValues(limitProbeReasonNotRecovered).Inc()
+		}
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "New series are still rejected because of the series limit after the recovery timeout", "status_code", statusCode, "err", err)
+		return errors.Errorf("new series are still rejected in tenant %s %s after exceeding the series limit, exceeding the recovery timeout of %s (error: %v)", t.cfg.TenantID, elapsed, t.cfg.RecoveryTimeout, err)
+
+	default:
+		return t.unexpectedError(logger, statusCode, err)
+	}
+}
+
+func (t *CardinalityLimitTest) unexpectedError(logger log.Logger, statusCode int, err error) error {
+	t.probesFailedTotal.WithLabelValues(limitProbeReasonUnexpectedErr).Inc()
+	t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+	t.metrics.observeFailure(outcomeTypeWrite)
+	level.Warn(logger).Log("msg", "Write request failed with an unexpected error", "status_code", statusCode, "expected_status_code", http.StatusBadRequest, "expected_error_id", mimirErrorIDPrefix+string(globalerror.MaxSeriesPerUser), "err", err)
+	return errors.Errorf("write request failed with status code %d while %d with error %s%s or success was expected in tenant %s (error: %v)", statusCode, http.StatusBadRequest, mimirErrorIDPrefix, globalerror.MaxSeriesPerUser, t.cfg.TenantID, err)
+}
+
+func (t *CardinalityLimitTest) write(ctx context.Context, series []prompb.TimeSeries) (int, error) {
+	t.metrics.writesTotal.Inc()
+	start := time.Now()
+	statusCode, err := t.client.WriteSeries(ctx, series)
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+	return statusCode, err
+}
+
+// generateCardinalityLimitSeries returns the throwaway series of the input cycle with ID in the range [from, to),
+// each one with a single sample.
+func generateCardinalityLimitSeries(t time.Time, cycleID string, from, to int) []prompb.TimeSeries {
+	series := make([]prompb.TimeSeries, 0, to-from)
+	for id := from; id < to; id++ {
+		series = append(series, prompb.TimeSeries{
+			Labels: []prompb.Label{
+				{Name: model.MetricNameLabel, Value: cardinalityLimitMetricName},
+				{Name: cardinalityLimitCycleLabel, Value: cycleID},
+				{Name: "series_id", Value: strconv.Itoa(id)},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: t.UnixMilli()}},
+		})
+	}
+	return series
+}
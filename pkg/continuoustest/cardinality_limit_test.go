@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCardinalityLimitTestConfig_Validate(t *testing.T) {
+	cfg := CardinalityLimitTestConfig{TenantID: "cardinality", MaxSeriesPerUser: 10, RecoveryTimeout: time.Hour}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TenantID = ""
+	assert.ErrorContains(t, cfg.Validate(), "tenant ID")
+
+	cfg.TenantID = "cardinality"
+	cfg.MaxSeriesPerUser = 0
+	assert.ErrorContains(t, cfg.Validate(), "max series per user")
+
+	cfg.MaxSeriesPerUser = 10
+	cfg.RecoveryTimeout = 0
+	assert.ErrorContains(t, cfg.Validate(), "recovery timeout")
+}
+
+func TestCardinalityLimitTest_Run(t *testing.T) {
+	const (
+		maxSeries       = 10
+		recoveryTimeout = time.Hour
+	)
+	cfg := CardinalityLimitTestConfig{Enabled: true, TenantID: "cardinality", MaxSeriesPerUser: maxSeries, RecoveryTimeout: recoveryTimeout}
+	start := time.Unix(1000, 0)
+	limitErr := errors.New("per-user series limit of 10 exceeded (err-mimir-max-series-per-user)")
+
+	// seriesCount matches write requests with the input number of series.
+	seriesCount := func(count int) interface{} {
+		return mock.MatchedBy(func(series []prompb.TimeSeries) bool { return len(series) == count })
+	}
+
+	t.Run("should exceed the limit and start a new cycle once new series are accepted again", func(t *testing.T) {
+		client := &ClientMock{}
+		// 1+2+4 series are accepted, then the 8 series exceeding the limit are rejected.
+		client.On("WriteSeries", mock.Anything, generateCardinalityLimitSeries(start, "1000", 0, 1)).Return(200, nil).Once()
+		client.On("WriteSeries", mock.Anything, generateCardinalityLimitSeries(start, "1000", 1, 3)).Return(200, nil).Once()
+		client.On("WriteSeries", mock.Anything, generateCardinalityLimitSeries(start, "1000", 3, 7)).Return(200, nil).Once()
+		client.On("WriteSeries", mock.Anything, generateCardinalityLimitSeries(start, "1000", 7, 15)).Return(http.StatusBadRequest, limitErr).Once()
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewCardinalityLimitTest(cfg, client, log.NewNopLogger(), reg)
+
+		require.NoError(t, test.Run(context.Background(), start))
+		require.NotNil(t, test.cycle)
+		assert.Equal(t, "1000", test.cycle.id)
+		client.AssertNumberOfCalls(t, "WriteSeries", 4)
+
+		// New series are still rejected, within the recovery timeout.
+		recovering := start.Add(recoveryTimeout / 2)
+		client.On("WriteSeries", mock.Anything, generateCardinalityLimitSeries(recovering, "1000-recovery", 1800, 1801)).Return(http.StatusBadRequest, limitErr).Once()
+		require.NoError(t, test.Run(context.Background(), recovering))
+		require.NotNil(t, test.cycle)
+
+		// New series are accepted again.
+		recovered := start.Add(recoveryTimeout)
+		client.On("WriteSeries", mock.Anything, generateCardinalityLimitSeries(recovered, "1000-recovery", 3600, 3601)).Return(200, nil).Once()
+		require.NoError(t, test.Run(context.Background(), recovered))
+		assert.Nil(t, test.cycle)
+		client.AssertExpectations(t)
+
+		assert.Equal(t, 1, testutil.CollectAndCount(test.recoveryDuration))
+		assert.Equal(t, 0.0, testutil.ToFloat64(test.probesFailedTotal.WithLabelValues(limitProbeReasonNotRecovered)))
+	})
+
+	t.Run("should fail if the series above the limit are accepted", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+
+		test := NewCardinalityLimitTest(cfg, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+		err := test.Run(context.Background(), start)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "20 series, above the series limit 10, have been unexpectedly accepted in tenant cardinality")
+		assert.Nil(t, test.cycle)
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.probesFailedTotal.WithLabelValues(limitProbeReasonNotEnforced)))
+	})
+
+	t.Run("should fail if the writes are rejected with an unexpected error", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, seriesCount(1)).Return(200, nil)
+		client.On("WriteSeries", mock.Anything, seriesCount(2)).Return(http.StatusTooManyRequests, errors.New("ingestion rate limit exceeded (err-mimir-tenant-max-ingestion-rate)"))
+
+		test := NewCardinalityLimitTest(cfg, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+		err := test.Run(context.Background(), start)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "write request failed with status code 429 while 400 with error err-mimir-max-series-per-user or success was expected")
+		assert.Nil(t, test.cycle)
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.probesFailedTotal.WithLabelValues(limitProbeReasonUnexpectedErr)))
+	})
+
+	t.Run("should track a violation once if new series are still rejected after the recovery timeout", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, seriesCount(1)).Return(http.StatusBadRequest, limitErr).Times(3)
+		client.On("WriteSeries", mock.Anything, seriesCount(1)).Return(200, nil).Once()
+
+		test := NewCardinalityLimitTest(cfg, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+		// The tenant is already at the limit, so the first write is rejected.
+		require.NoError(t, test.Run(context.Background(), start))
+		require.NotNil(t, test.cycle)
+
+		err := test.Run(context.Background(), start.Add(recoveryTimeout+time.Minute))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "new series are still rejected in tenant cardinality 1h1m0s after exceeding the series limit")
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.probesFailedTotal.WithLabelValues(limitProbeReasonNotRecovered)))
+
+		require.Error(t, test.Run(context.Background(), start.Add(recoveryTimeout+2*time.Minute)))
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.probesFailedTotal.WithLabelValues(limitProbeReasonNotRecovered)))
+
+		// Once new series are accepted again, the cycle completes.
+		require.NoError(t, test.Run(context.Background(), start.Add(recoveryTimeout+3*time.Minute)))
+		assert.Nil(t, test.cycle)
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.probesFailedTotal.WithLabelValues(limitProbeReasonNotRecovered)))
+	})
+}
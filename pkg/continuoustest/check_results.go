@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const checkResultsMetricName = "mimir_continuous_test_query_result_check_success"
+
+type checkResultKey struct {
+	test      string
+	ageBucket string
+}
+
+type checkResult struct {
+	success   bool
+	timestamp time.Time
+}
+
+// CheckResults holds the outcome of the query result checks run by the most recent test run, partitioned by
+// test and by age bucket of the queried time range. Unlike the cumulative counters exported by the tests, the
+// results are exposed as gauges with an explicit timestamp, which is the start time of the test run.
+type CheckResults struct {
+	mtx     sync.Mutex
+	results map[checkResultKey]checkResult
+}
+
+func NewCheckResults() *CheckResults {
+	return &CheckResults{results: map[checkResultKey]checkResult{}}
+}
+
+// update stores the results of a test run. Age buckets not checked by the run keep their previous result.
+func (c *CheckResults) update(r *runCheckResults) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for bucket, failed := range r.failed {
+		c.results[checkResultKey{test: r.test, ageBucket: bucket}] = checkResult{success: !failed, timestamp: r.start}
+	}
+}
+
+// ServeHTTP exposes the most recent check results in the OpenMetrics text format.
+func (c *CheckResults) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", string(expfmt.FmtOpenMetrics))
+	_, _ = expfmt.MetricFamilyToOpenMetrics(w, c.metricFamily())
+	_, _ = expfmt.FinalizeOpenMetrics(w)
+}
+
+func (c *CheckResults) metricFamily() *dto.MetricFamily {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	keys := make([]checkResultKey, 0, len(c.results))
+	for key := range c.results {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].test != keys[j].test {
+			return keys[i].test < keys[j].test
+		}
+		return keys[i].ageBucket < keys[j].ageBucket
+	})
+
+	name, help, typ := checkResultsMetricName, "Whether the query result checks of the most recent test run, on time ranges ending within the age bucket, succeeded (1) or failed (0).", dto.MetricType_GAUGE
+	family := &dto.MetricFamily{Name: &name, Help: &help, Type: &typ}
+	for _, key := range keys {
+		result := c.results[key]
+		value := 0.
+		if result.success {
+			value = 1
+		}
+		timestampMs := result.timestamp.UnixMilli()
+
+		family.Metric = append(family.Metric, &dto.Metric{
+			Label:       []*dto.LabelPair{labelPair("age_bucket", key.ageBucket), labelPair("test", key.test)},
+			Gauge:       &dto.Gauge{Value: &value},
+			TimestampMs: &timestampMs,
+		})
+	}
+	return family
+}
+
+func labelPair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: &name, Value: &value}
+}
+
+// runCheckResults collects the outcome of the query result checks of a single test run, by age bucket.
+type runCheckResults struct {
+	test  string
+	start time.Time
+
+	mtx    sync.Mutex
+	failed map[string]bool
+}
+
+func newRunCheckResults(test string, start time.Time) *runCheckResults {
+	return &runCheckResults{test: test, start: start, failed: map[string]bool{}}
+}
+
+// add records the outcome of a check. An age bucket is failed if any of its checks failed within the run.
+func (r *runCheckResults) add(end time.Time, success bool) {
+	bucket := failingWindowAgeBucket(r.start.Sub(end))
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.failed[bucket] = r.failed[bucket] || !success
+}
+
+type checkResultsContextKey int
+
+const checkResultsKey checkResultsContextKey = 0
+
+// contextWithCheckResults returns a new context with the run check results attached.
+func contextWithCheckResults(ctx context.Context, r *runCheckResults) context.Context {
+	return context.WithValue(ctx, checkResultsKey, r)
+}
+
+// recordQueryResultCheck records the outcome of a query result check on a time range ending at end
+// to the run check results attached to the context, if any.
+func recordQueryResultCheck(ctx context.Context, end time.Time, err error) {
+	if r, ok := ctx.Value(checkResultsKey).(*runCheckResults); ok && r != nil {
+		r.add(end, err == nil)
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_CheckResults(t *testing.T) {
+	checkResults := NewCheckResults()
+
+	manager := NewManager(ManagerConfig{}, log.NewNopLogger())
+	manager.SetCheckResults(checkResults)
+
+	// The first run checks both recent and old data, and fails on recent data only.
+	firstRun := time.Unix(1000000, 0)
+	test := &testFunc{run: func(ctx context.Context, now time.Time) error {
+		recordQueryResultCheck(ctx, now, nil)
+		recordQueryResultCheck(ctx, now, errors.New("sample mismatch"))
+		recordQueryResultCheck(ctx, now.Add(-2*time.Hour), nil)
+		return nil
+	}}
+	require.NoError(t, manager.runTest(context.Background(), test, firstRun))
+
+	// The second run only checks recent data, which succeeds.
+	secondRun := firstRun.Add(time.Minute)
+	test = &testFunc{run: func(ctx context.Context, now time.Time) error {
+		recordQueryResultCheck(ctx, now.Add(-time.Minute), nil)
+		return nil
+	}}
+	require.NoError(t, manager.runTest(context.Background(), test, secondRun))
+
+	res := httptest.NewRecorder()
+	checkResults.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/continuous-test/check-results", nil))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, string(expfmt.FmtOpenMetrics), res.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP mimir_continuous_test_query_result_check_success Whether the query result checks of the most recent test run, on time ranges ending within the age bucket, succeeded (1) or failed (0).
+# TYPE mimir_continuous_test_query_result_check_success gauge
+mimir_continuous_test_query_result_check_success{age_bucket="1h-24h",test="dummyTest"} 1.0 1e+06
+mimir_continuous_test_query_result_check_success{age_bucket="<1h",test="dummyTest"} 1.0 1.00006e+06
+# EOF
+`, string(body))
+
+	t.Run("should report the failed checks of the most recent run", func(t *testing.T) {
+		test := &testFunc{run: func(ctx context.Context, now time.Time) error {
+			recordQueryResultCheck(ctx, now, errors.New("sample mismatch"))
+			return nil
+		}}
+		require.NoError(t, manager.runTest(context.Background(), test, secondRun.Add(time.Minute)))
+
+		assert.Equal(t, checkResult{success: false, timestamp: secondRun.Add(time.Minute)}, checkResults.results[checkResultKey{test: "dummyTest", ageBucket: "<1h"}])
+	})
+
+	t.Run("should not store the check results while failures are suppressed because of a planned maintenance", func(t *testing.T) {
+		run := secondRun.Add(time.Hour)
+
+		cfg := ManagerConfig{SuppressFailuresDuringMaintenance: true, MaintenanceWindows: MaintenanceWindows{{Start: 0, End: 24 * time.Hour}}}
+		manager := NewManager(cfg, log.NewNopLogger())
+		manager.SetCheckResults(checkResults)
+
+		test := &testFunc{run: func(ctx context.Context, now time.Time) error {
+			recordQueryResultCheck(ctx, now.Add(-48*time.Hour), errors.New("sample mismatch"))
+			return nil
+		}}
+		require.NoError(t, manager.runTest(context.Background(), test, run))
+
+		assert.NotContains(t, checkResults.results, checkResultKey{test: "dummyTest", ageBucket: "24h-7d"})
+	})
+}
@@ -0,0 +1,275 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	classicHistogramMetricName = "mimir_continuous_test_classic_histogram"
+
+	// classicHistogramRateRange is the range of the rate() function in the test queries. The test queries
+	// are run only once the samples have been written without gaps for at least this range.
+	classicHistogramRateRange = time.Minute
+)
+
+var (
+	// classicHistogramBucketBounds are the upper bounds of the histogram buckets.
+	classicHistogramBucketBounds = []float64{0.5, 1, 2.5, 5, math.Inf(+1)}
+
+	// classicHistogramBucketObservations is the number of observations added to each bucket (not cumulative)
+	// of each series every write interval, and classicHistogramObservationValues is the value of each of them.
+	classicHistogramBucketObservations = []float64{1, 2, 4, 2, 1}
+	classicHistogramObservationValues  = []float64{0.25, 0.75, 1.75, 3.75, 7.5}
+
+	classicHistogramQuantiles = []float64{0.5, 0.9}
+
+	classicHistogramCountRateQuery = fmt.Sprintf("sum(rate(%s_count[%s]))", classicHistogramMetricName, model.Duration(classicHistogramRateRange))
+)
+
+type ClassicHistogramTestConfig struct {
+	Enabled   bool
+	NumSeries int
+}
+
+func (cfg *ClassicHistogramTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.classic-histogram-test.enabled", false, "Enable the test which periodically writes classic histograms, as separate _bucket, _sum and _count series, and checks whether histogram_quantile() and the rate of the _count series return the expected values.")
+	f.IntVar(&cfg.NumSeries, "tests.classic-histogram-test.num-series", 10, "Number of classic histograms written by the test. Each histogram is written as one series per bucket, plus the _sum and _count series.")
+}
+
+func (cfg *ClassicHistogramTestConfig) Validate() error {
+	if cfg.NumSeries <= 0 {
+		return errors.New("the number of classic histograms written by the classic histogram test must be greater than 0")
+	}
+	return nil
+}
+
+// ClassicHistogramTest periodically writes classic histograms whose counters grow at a constant rate, and checks
+// the results of histogram_quantile() and of the rate of the _count series, which are computed exactly from the
+// fixed distribution of the observations.
+type ClassicHistogramTest struct {
+	name    string
+	cfg     ClassicHistogramTestConfig
+	client  MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	lastWrittenTimestamp time.Time
+
+	// The oldest timestamp since which samples have been written without gaps, or zero if none.
+	contiguousSince time.Time
+}
+
+func NewClassicHistogramTest(cfg ClassicHistogramTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *ClassicHistogramTest {
+	const name = "classic-histogram"
+
+	return &ClassicHistogramTest{
+		name:    name,
+		cfg:     cfg,
+		client:  client,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+	}
+}
+
+// Name implements Test.
+func (t *ClassicHistogramTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *ClassicHistogramTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *ClassicHistogramTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	// Write samples for each expected timestamp until now.
+	for timestamp := t.nextWriteTimestamp(now); !timestamp.After(now); timestamp = t.nextWriteTimestamp(now) {
+		if err := t.writeSamples(ctx, timestamp); err != nil {
+			return err
+		}
+	}
+
+	// The rate can be checked only if there are no gaps in the samples within the rate range.
+	if t.contiguousSince.IsZero() || t.lastWrittenTimestamp.Sub(t.contiguousSince) < classicHistogramRateRange {
+		return nil
+	}
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "ClassicHistogramTest.Run")
+	defer sp.Finish()
+
+	ts := t.lastWrittenTimestamp
+	errs := multierror.New()
+	for _, q := range classicHistogramQuantiles {
+		query := fmt.Sprintf("histogram_quantile(%g, sum by (le) (rate(%s_bucket[%s])))", q, classicHistogramMetricName, model.Duration(classicHistogramRateRange))
+		errs.Add(t.runQueryAndVerifyResult(ctx, sp, query, ts, classicHistogramQuantile(q)))
+	}
+	errs.Add(t.runQueryAndVerifyResult(ctx, sp, classicHistogramCountRateQuery, ts, float64(t.cfg.NumSeries)*classicHistogramCountIncrease()/writeInterval.Seconds()))
+	return errs.Err()
+}
+
+func (t *ClassicHistogramTest) nextWriteTimestamp(now time.Time) time.Time {
+	if t.lastWrittenTimestamp.IsZero() {
+		return alignTimestampToInterval(now, writeInterval)
+	}
+
+	return t.lastWrittenTimestamp.Add(writeInterval)
+}
+
+func (t *ClassicHistogramTest) writeSamples(ctx context.Context, timestamp time.Time) error {
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "ClassicHistogramTest.writeSamples")
+	defer sp.Finish()
+	logger := log.With(sp, "timestamp", timestamp.UnixMilli(), "num_series", t.cfg.NumSeries)
+
+	start := time.Now()
+	statusCode, err := t.client.WriteSeries(ctx, generateClassicHistogramSeries(timestamp, t.cfg.NumSeries))
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+
+	t.metrics.writesTotal.Inc()
+	if statusCode/100 != 2 {
+		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Failed to remote write series", "status_code", statusCode, "err", err)
+	} else {
+		t.metrics.observeSuccess(outcomeTypeWrite)
+	}
+
+	// If the write request failed because of a 4xx error, retrying the request isn't expected to succeed.
+	// We keep writing the next interval, but the samples are not contiguous anymore.
+	if statusCode/100 == 4 {
+		t.lastWrittenTimestamp = timestamp
+		t.contiguousSince = time.Time{}
+		return nil
+	}
+
+	// If the write request failed because of a network or 5xx error, we'll retry to write series
+	// in the next test run.
+	if statusCode/100 != 2 {
+		return errors.Wrapf(err, "remote write series failed with status code %d", statusCode)
+	}
+
+	t.lastWrittenTimestamp = timestamp
+	if t.contiguousSince.IsZero() {
+		t.contiguousSince = timestamp
+	}
+	return nil
+}
+
+func (t *ClassicHistogramTest) runQueryAndVerifyResult(ctx context.Context, logger log.Logger, query string, ts time.Time, expected float64) error {
+	logger = log.With(logger, "query", query, "ts", ts.UnixMilli())
+
+	t.metrics.queriesTotal.Inc()
+	start := time.Now()
+	vector, err := t.client.Query(ctx, query, ts, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute instant query", "err", err)
+		return errors.Wrapf(err, "failed to execute instant query %s", query)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	t.metrics.queryResultChecksTotal.Inc()
+	if err := verifyClassicHistogramResult(vector, expected); err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Query result check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: query, Start: ts, End: ts, Error: err.Error()})
+		return errors.Wrapf(err, "query result check failed for query %s", query)
+	}
+
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+	level.Debug(logger).Log("msg", "Query result check succeeded")
+	return nil
+}
+
+func verifyClassicHistogramResult(vector model.Vector, expected float64) error {
+	if len(vector) != 1 {
+		return fmt.Errorf("expected 1 series in the result but got %d", len(vector))
+	}
+	if actual := float64(vector[0].Value); !compareSampleValues(actual, expected) {
+		return fmt.Errorf("expected value %f but got %f", expected, actual)
+	}
+	return nil
+}
+
+// generateClassicHistogramSeries returns the _bucket, _sum and _count series of numSeries classic histograms
+// at the input timestamp. The counters are a function of the timestamp, growing by the same number of
+// observations every write interval.
+func generateClassicHistogramSeries(t time.Time, numSeries int) []prompb.TimeSeries {
+	intervals := float64(t.UnixMilli() / writeInterval.Milliseconds())
+	out := make([]prompb.TimeSeries, 0, numSeries*(len(classicHistogramBucketBounds)+2))
+
+	newSeries := func(name, seriesID string, value float64, extraLabels ...prompb.Label) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels:  append([]prompb.Label{{Name: "__name__", Value: name}, {Name: "series_id", Value: seriesID}}, extraLabels...),
+			Samples: []prompb.Sample{{Value: value, Timestamp: t.UnixMilli()}},
+		}
+	}
+
+	for i := 0; i < numSeries; i++ {
+		seriesID := strconv.Itoa(i)
+
+		cumulative, sum := 0.0, 0.0
+		for b, bound := range classicHistogramBucketBounds {
+			cumulative += classicHistogramBucketObservations[b]
+			sum += classicHistogramBucketObservations[b] * classicHistogramObservationValues[b]
+
+			le := strconv.FormatFloat(bound, 'f', -1, 64)
+			out = append(out, newSeries(classicHistogramMetricName+"_bucket", seriesID, intervals*cumulative, prompb.Label{Name: "le", Value: le}))
+		}
+
+		out = append(out, newSeries(classicHistogramMetricName+"_sum", seriesID, intervals*sum))
+		out = append(out, newSeries(classicHistogramMetricName+"_count", seriesID, intervals*cumulative))
+	}
+
+	return out
+}
+
+// classicHistogramCountIncrease returns the number of observations added to each histogram every write interval.
+func classicHistogramCountIncrease() float64 {
+	count := 0.0
+	for _, observations := range classicHistogramBucketObservations {
+		count += observations
+	}
+	return count
+}
+
+// classicHistogramQuantile returns the quantile q of the observations added to the histograms, computed
+// like histogram_quantile() does: the quantile is linearly interpolated within the bucket it falls into.
+func classicHistogramQuantile(q float64) float64 {
+	rank := q * classicHistogramCountIncrease()
+
+	lowerBound, lowerCount := 0.0, 0.0
+	for b, bound := range classicHistogramBucketBounds {
+		count := lowerCount + classicHistogramBucketObservations[b]
+		if count >= rank {
+			if math.IsInf(bound, +1) {
+				return lowerBound
+			}
+			return lowerBound + (bound-lowerBound)*(rank-lowerCount)/(count-lowerCount)
+		}
+		lowerBound, lowerCount = bound, count
+	}
+	return lowerBound
+}
@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassicHistogramTestConfig_Validate(t *testing.T) {
+	cfg := ClassicHistogramTestConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.NumSeries = 0
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClassicHistogramTest_Run(t *testing.T) {
+	cfg := ClassicHistogramTestConfig{}
+	flagext.DefaultValues(&cfg)
+
+	const (
+		p50Query = `histogram_quantile(0.5, sum by (le) (rate(mimir_continuous_test_classic_histogram_bucket[1m])))`
+		p90Query = `histogram_quantile(0.9, sum by (le) (rate(mimir_continuous_test_classic_histogram_bucket[1m])))`
+	)
+
+	now := time.Unix(1000*int64(writeInterval.Seconds()), 0)
+
+	t.Run("should check the query results once samples have been written without gaps for the rate range", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("Query", mock.Anything, p50Query, mock.Anything, mock.Anything).Return(model.Vector{{Value: 1.75}}, nil)
+		client.On("Query", mock.Anything, p90Query, mock.Anything, mock.Anything).Return(model.Vector{{Value: 5}}, nil)
+		client.On("Query", mock.Anything, classicHistogramCountRateQuery, mock.Anything, mock.Anything).Return(model.Vector{{Value: 5}}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewClassicHistogramTest(cfg, client, log.NewNopLogger(), reg)
+
+		// The first run writes a single timestamp, so the rate can't be checked yet.
+		require.NoError(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "WriteSeries", 1)
+		client.AssertNumberOfCalls(t, "Query", 0)
+
+		// The next run writes all the missing timestamps, and checks the query results.
+		require.NoError(t, test.Run(context.Background(), now.Add(classicHistogramRateRange)))
+		client.AssertNumberOfCalls(t, "WriteSeries", 4)
+		client.AssertNumberOfCalls(t, "Query", 3)
+		for _, call := range client.Calls {
+			if call.Method == "Query" {
+				assert.Equal(t, now.Add(classicHistogramRateRange), call.Arguments.Get(2))
+			}
+		}
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_total Total number of query results checked for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_total counter
+			mimir_continuous_test_query_result_checks_total{test="classic-histogram"} 3
+
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="classic-histogram"} 0
+		`), "mimir_continuous_test_query_result_checks_total", "mimir_continuous_test_query_result_checks_failed_total"))
+	})
+
+	t.Run("should fail if the query results don't match the expected values", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("Query", mock.Anything, p50Query, mock.Anything, mock.Anything).Return(model.Vector{{Value: 2}}, nil)
+		client.On("Query", mock.Anything, p90Query, mock.Anything, mock.Anything).Return(model.Vector{{Value: 5}}, nil)
+		client.On("Query", mock.Anything, classicHistogramCountRateQuery, mock.Anything, mock.Anything).Return(model.Vector{}, nil)
+
+		test := NewClassicHistogramTest(cfg, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+		require.NoError(t, test.Run(context.Background(), now))
+
+		err := test.Run(context.Background(), now.Add(classicHistogramRateRange))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "query result check failed for query "+p50Query)
+		assert.Contains(t, err.Error(), "query result check failed for query "+classicHistogramCountRateQuery)
+		assert.NotContains(t, err.Error(), p90Query)
+	})
+
+	t.Run("should not check the query results if there's a gap in the written samples", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(400, errors.New("bad request")).Once()
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+
+		test := NewClassicHistogramTest(cfg, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+		require.NoError(t, test.Run(context.Background(), now))
+		require.NoError(t, test.Run(context.Background(), now.Add(classicHistogramRateRange-writeInterval)))
+		client.AssertNumberOfCalls(t, "Query", 0)
+	})
+
+	t.Run("should retry writing the samples on 5xx errors", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(500, errors.New("failed")).Once()
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+
+		test := NewClassicHistogramTest(cfg, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+		require.Error(t, test.Run(context.Background(), now))
+		assert.True(t, test.lastWrittenTimestamp.IsZero())
+
+		require.NoError(t, test.Run(context.Background(), now))
+		assert.Equal(t, now, test.lastWrittenTimestamp)
+	})
+}
+
+func TestGenerateClassicHistogramSeries(t *testing.T) {
+	ts := time.Unix(100*int64(writeInterval.Seconds()), 0)
+	series := generateClassicHistogramSeries(ts, 2)
+	require.Len(t, series, 2*(len(classicHistogramBucketBounds)+2))
+
+	values := map[string]float64{}
+	for _, s := range series {
+		require.Len(t, s.Samples, 1)
+		assert.Equal(t, ts.UnixMilli(), s.Samples[0].Timestamp)
+
+		if labelValue(s.Labels, "series_id") == "0" {
+			values[labelValue(s.Labels, "__name__")+"{"+labelValue(s.Labels, "le")+"}"] = s.Samples[0].Value
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		"mimir_continuous_test_classic_histogram_bucket{0.5}":  100,
+		"mimir_continuous_test_classic_histogram_bucket{1}":    300,
+		"mimir_continuous_test_classic_histogram_bucket{2.5}":  700,
+		"mimir_continuous_test_classic_histogram_bucket{5}":    900,
+		"mimir_continuous_test_classic_histogram_bucket{+Inf}": 1000,
+		"mimir_continuous_test_classic_histogram_sum{}":        2375,
+		"mimir_continuous_test_classic_histogram_count{}":      1000,
+	}, values)
+}
+
+func TestClassicHistogramQuantile(t *testing.T) {
+	assert.Equal(t, 0.25, classicHistogramQuantile(0.05))
+	assert.Equal(t, 1.75, classicHistogramQuantile(0.5))
+	assert.Equal(t, 5.0, classicHistogramQuantile(0.9))
+	assert.Equal(t, 5.0, classicHistogramQuantile(0.99))
+}
+
+func labelValue(labels []prompb.Label, name string) string {
+	for _, l := range labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
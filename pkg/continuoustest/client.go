@@ -5,28 +5,65 @@ package continuoustest
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
+	"github.com/grafana/dskit/backoff"
 	"github.com/grafana/dskit/flagext"
+	"github.com/klauspost/compress/zstd"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
 	"github.com/prometheus/prometheus/prompb"
-
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
+	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/instrumentation"
 	util_math "github.com/grafana/mimir/pkg/util/math"
 )
 
 const (
 	maxErrMsgLen = 256
+
+	blockUploadCheckInterval = time.Second
+
+	// mimirRemoteWritePath is the path of the Mimir remote write API.
+	mimirRemoteWritePath = "/api/v1/push"
+
+	// mimirOTLPWritePath is the path of the Mimir OTLP write API.
+	mimirOTLPWritePath = "/otlp/v1/metrics"
+
+	responseFormatJSON     = "json"
+	responseFormatProtobuf = "protobuf"
+
+	writeCompressionSnappy = "snappy"
+	writeCompressionZstd   = "zstd"
+	writeCompressionNone   = "none"
+)
+
+var (
+	supportedResponseFormats   = []string{responseFormatJSON, responseFormatProtobuf}
+	supportedWriteCompressions = []string{writeCompressionSnappy, writeCompressionZstd, writeCompressionNone}
 )
 
 // MimirClient is the interface implemented by a client used to interact with Mimir.
@@ -35,11 +72,29 @@ type MimirClient interface {
 	// an error. The error is always returned if request was not successful (eg. received a 4xx or 5xx error).
 	WriteSeries(ctx context.Context, series []prompb.TimeSeries) (statusCode int, err error)
 
+	// WriteOTLPMetrics writes input metrics to Mimir through the OTLP write API. Returns the response status code
+	// and optionally an error. The error is always returned if request was not successful.
+	WriteOTLPMetrics(ctx context.Context, metrics pmetric.Metrics) (statusCode int, err error)
+
 	// QueryRange performs a range query.
 	QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration, options ...RequestOption) (model.Matrix, error)
 
 	// Query performs an instant query.
 	Query(ctx context.Context, query string, ts time.Time, options ...RequestOption) (model.Vector, error)
+
+	// ListRules lists the rules evaluated by the ruler. Returns an error if the request was not successful.
+	ListRules(ctx context.Context) error
+
+	// SetRuleGroup creates or updates the input rule group in the input namespace. Returns an error if the request
+	// was not successful.
+	SetRuleGroup(ctx context.Context, namespace string, group rulefmt.RuleGroup) error
+
+	// GetAlertmanagerStatus gets the Alertmanager status. Returns an error if the request was not successful.
+	GetAlertmanagerStatus(ctx context.Context) error
+
+	// UploadBlock uploads the TSDB block in the input directory through the block upload API, and waits until
+	// the block has been validated. Returns an error if the upload or the validation failed.
+	UploadBlock(ctx context.Context, blockDir string) error
 }
 
 type ClientConfig struct {
@@ -49,11 +104,26 @@ type ClientConfig struct {
 	BearerToken       string
 
 	WriteBaseEndpoint flagext.URLValue
-	WriteBatchSize    int
-	WriteTimeout      time.Duration
+	// WritePath is the API path appended to the write base endpoint to write series.
+	// The Mimir remote write API path is used if empty.
+	WritePath        string
+	WriteBatchSize   int
+	WriteTimeout     time.Duration
+	WriteCompression string
+	WriteProtocol    string
+
+	WriteMaxAttempts     int
+	WriteMaxRetryElapsed time.Duration
+	WriteRetryMinBackoff time.Duration
+	WriteRetryMaxBackoff time.Duration
 
 	ReadBaseEndpoint flagext.URLValue
 	ReadTimeout      time.Duration
+
+	AlertmanagerBaseEndpoint flagext.URLValue
+
+	// ExtraHeaders are the HTTP headers set on each request, for example to route the requests to a specific zone.
+	ExtraHeaders map[string]string
 }
 
 func (cfg *ClientConfig) RegisterFlags(f *flag.FlagSet) {
@@ -65,34 +135,71 @@ func (cfg *ClientConfig) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&cfg.WriteBaseEndpoint, "tests.write-endpoint", "The base endpoint on the write path. The URL should have no trailing slash. The specific API path is appended by the tool to the URL, for example /api/v1/push for the remote write API endpoint, so the configured URL must not include it.")
 	f.IntVar(&cfg.WriteBatchSize, "tests.write-batch-size", 1000, "The maximum number of series to write in a single request.")
 	f.DurationVar(&cfg.WriteTimeout, "tests.write-timeout", 5*time.Second, "The timeout for a single write request.")
-
-	f.Var(&cfg.ReadBaseEndpoint, "tests.read-endpoint", "The base endpoint on the read path. The URL should have no trailing slash. The specific API path is appended by the tool to the URL, for example /api/v1/query_range for range query API, so the configured URL must not include it.")
+	f.StringVar(&cfg.WriteProtocol, "tests.write-protocol", writeProtocolV1, fmt.Sprintf("The protocol used to write series. Supported values: %s.", strings.Join(supportedWriteProtocols, ", ")))
+	f.StringVar(&cfg.WriteCompression, "tests.write-compression", writeCompressionSnappy, fmt.Sprintf("The compression of the remote write requests payload. Supported values: %s.", strings.Join(supportedWriteCompressions, ", ")))
+	f.IntVar(&cfg.WriteMaxAttempts, "tests.write-max-attempts", 3, "The maximum number of attempts to send a write request failed because of a network or 5xx error. Set to 1 to disable retries.")
+	f.DurationVar(&cfg.WriteMaxRetryElapsed, "tests.write-max-retry-elapsed-time", 30*time.Second, "The maximum time spent retrying a failed write request. No retry is attempted once this time has elapsed since the first attempt. 0 to disable the limit.")
+	f.DurationVar(&cfg.WriteRetryMinBackoff, "tests.write-retry-min-backoff", 100*time.Millisecond, "The minimum delay before retrying a failed write request. The delay grows exponentially, with jitter, at each retry.")
+	f.DurationVar(&cfg.WriteRetryMaxBackoff, "tests.write-retry-max-backoff", 5*time.Second, "The maximum delay before retrying a failed write request.")
+
+	f.Var(&cfg.ReadBaseEndpoint, "tests.read-endpoint", "The base endpoint on the read path. The URL should have no trailing slash. The specific API path is appended by the tool to the URL, for example /api/v1/query_range for range query API, so the configured URL must not include it. Optional when -tests.write-read-series-test.write-only is enabled.")
 	f.DurationVar(&cfg.ReadTimeout, "tests.read-timeout", 60*time.Second, "The timeout for a single read request.")
+
+	f.Var(&cfg.AlertmanagerBaseEndpoint, "tests.alertmanager-endpoint", "The base endpoint of the Alertmanager API. The URL should have no trailing slash. The specific API path is appended by the tool to the URL, for example /api/v2/status for the status API endpoint, so the configured URL must not include it.")
 }
 
+func (cfg *ClientConfig) Validate() error {
+	if !util.StringsContain(supportedWriteProtocols, cfg.WriteProtocol) {
+		return fmt.Errorf("unsupported write protocol %q (supported values: %s)", cfg.WriteProtocol, strings.Join(supportedWriteProtocols, ", "))
+	}
+	if !util.StringsContain(supportedWriteCompressions, cfg.WriteCompression) {
+		return fmt.Errorf("unsupported write compression %q (supported values: %s)", cfg.WriteCompression, strings.Join(supportedWriteCompressions, ", "))
+	}
+	if cfg.WriteMaxAttempts < 1 {
+		return errors.New("the write max attempts must be greater than 0")
+	}
+	if cfg.WriteMaxRetryElapsed < 0 {
+		return errors.New("the write max retry elapsed time must be greater than or equal to 0")
+	}
+	if cfg.WriteRetryMinBackoff <= 0 || cfg.WriteRetryMaxBackoff < cfg.WriteRetryMinBackoff {
+		return errors.New("the write retry min backoff must be greater than 0 and not greater than the max backoff")
+	}
+	return nil
+}
+
+var errReadEndpointNotSet = errors.New("the read endpoint has not been set")
+
 type Client struct {
-	writeClient *http.Client
-	readClient  v1.API
-	cfg         ClientConfig
-	logger      log.Logger
+	httpClient    *http.Client
+	readClient    v1.API
+	readRawClient api.Client
+	cfg           ClientConfig
+	logger        log.Logger
+
+	// zstdEncoder is used to compress the write requests when the zstd compression is configured.
+	zstdEncoder *zstd.Encoder
 }
 
-func NewClient(cfg ClientConfig, logger log.Logger) (*Client, error) {
+// NewClient returns a client for the input config. The duration of the phases of the HTTP requests, and the
+// statistics of the queries, are tracked by the input metrics, if not nil.
+func NewClient(cfg ClientConfig, logger log.Logger, metrics *ClientMetrics) (*Client, error) {
 	rt := &clientRoundTripper{
 		tenantID:          cfg.TenantID,
 		basicAuthUser:     cfg.BasicAuthUser,
 		basicAuthPassword: cfg.BasicAuthPassword,
 		bearerToken:       cfg.BearerToken,
+		extraHeaders:      cfg.ExtraHeaders,
 		rt:                instrumentation.TracerTransport{},
 	}
+	if metrics != nil {
+		rt.rt = instrumentation.TracerTransport{Next: newRequestPhasesRoundTripper(metrics, http.DefaultTransport)}
+	}
+	rt.rt = newQueryStatsRoundTripper(metrics, rt.rt)
 
 	// Ensure the required config has been set.
 	if cfg.WriteBaseEndpoint.URL == nil {
 		return nil, errors.New("the write endpoint has not been set")
 	}
-	if cfg.ReadBaseEndpoint.URL == nil {
-		return nil, errors.New("the read endpoint has not been set")
-	}
 	// Ensure not both tenant-id and basic-auth are used at the same time
 	// anonymous is the default value for TenantID.
 	if (cfg.TenantID != "anonymous" && cfg.BasicAuthUser != "" && cfg.BasicAuthPassword != "" && cfg.BearerToken != "") || // all authentication at once
@@ -102,30 +209,50 @@ func NewClient(cfg ClientConfig, logger log.Logger) (*Client, error) {
 		return nil, errors.New("either set tests.tenant-id or tests.basic-auth-user/tests.basic-auth-password or tests.bearer-token")
 	}
 
-	apiCfg := api.Config{
-		Address:      cfg.ReadBaseEndpoint.String(),
-		RoundTripper: rt,
+	c := &Client{
+		httpClient: &http.Client{Transport: rt},
+		cfg:        cfg,
+		logger:     logger,
 	}
 
-	readClient, err := api.NewClient(apiCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create read client")
+	// The read endpoint is optional, because it's not used when only writing series.
+	if cfg.ReadBaseEndpoint.URL != nil {
+		readClient, err := api.NewClient(api.Config{
+			Address:      cfg.ReadBaseEndpoint.String(),
+			RoundTripper: rt,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create read client")
+		}
+		c.readClient = v1.NewAPI(readClient)
+		c.readRawClient = readClient
 	}
 
-	return &Client{
-		writeClient: &http.Client{Transport: rt},
-		readClient:  v1.NewAPI(readClient),
-		cfg:         cfg,
-		logger:      logger,
-	}, nil
+	if cfg.WriteCompression == writeCompressionZstd {
+		var err error
+		c.zstdEncoder, err = zstd.NewWriter(nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create zstd encoder")
+		}
+	}
+
+	return c, nil
 }
 
 // QueryRange implements MimirClient.
 func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration, options ...RequestOption) (model.Matrix, error) {
+	if c.readClient == nil {
+		return nil, errReadEndpointNotSet
+	}
+
 	ctx = contextWithRequestOptions(ctx, options...)
 	ctx, cancel := context.WithTimeout(ctx, c.cfg.ReadTimeout)
 	defer cancel()
 
+	if requestOptionsFromContext(ctx).responseFormat == responseFormatProtobuf {
+		return c.queryRangeProtobuf(ctx, query, start, end, step)
+	}
+
 	value, _, err := c.readClient.QueryRange(ctx, query, v1.Range{
 		Start: start,
 		End:   end,
@@ -149,10 +276,18 @@ func (c *Client) QueryRange(ctx context.Context, query string, start, end time.T
 
 // Query implements MimirClient.
 func (c *Client) Query(ctx context.Context, query string, ts time.Time, options ...RequestOption) (model.Vector, error) {
+	if c.readClient == nil {
+		return nil, errReadEndpointNotSet
+	}
+
 	ctx = contextWithRequestOptions(ctx, options...)
 	ctx, cancel := context.WithTimeout(ctx, c.cfg.ReadTimeout)
 	defer cancel()
 
+	if requestOptionsFromContext(ctx).responseFormat == responseFormatProtobuf {
+		return c.queryProtobuf(ctx, query, ts)
+	}
+
 	value, _, err := c.readClient.Query(ctx, query, ts)
 	if err != nil {
 		return nil, err
@@ -170,6 +305,304 @@ func (c *Client) Query(ctx context.Context, query string, ts time.Time, options
 	return vector, nil
 }
 
+// ListRules implements MimirClient.
+func (c *Client) ListRules(ctx context.Context) error {
+	if c.readRawClient == nil {
+		return errReadEndpointNotSet
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ReadTimeout)
+	defer cancel()
+
+	_, err := c.doRequest(ctx, http.MethodGet, c.readRawClient.URL("/api/v1/rules", nil).String(), nil)
+	return err
+}
+
+// SetRuleGroup implements MimirClient.
+func (c *Client) SetRuleGroup(ctx context.Context, namespace string, group rulefmt.RuleGroup) error {
+	if c.readRawClient == nil {
+		return errReadEndpointNotSet
+	}
+
+	body, err := yaml.Marshal(group)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal rule group")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.WriteTimeout)
+	defer cancel()
+
+	_, err = c.doRequest(ctx, http.MethodPost, c.readRawClient.URL("/config/v1/rules/"+url.PathEscape(namespace), nil).String(), bytes.NewReader(body))
+	return err
+}
+
+// GetAlertmanagerStatus implements MimirClient.
+func (c *Client) GetAlertmanagerStatus(ctx context.Context) error {
+	if c.cfg.AlertmanagerBaseEndpoint.URL == nil {
+		return errors.New("the alertmanager endpoint has not been set")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ReadTimeout)
+	defer cancel()
+
+	_, err := c.doRequest(ctx, http.MethodGet, c.cfg.AlertmanagerBaseEndpoint.String()+"/api/v2/status", nil)
+	return err
+}
+
+// DeleteTenant implements TenantDeletionClient.
+func (c *Client) DeleteTenant(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.WriteTimeout)
+	defer cancel()
+
+	_, err := c.doRequest(ctx, http.MethodPost, c.cfg.WriteBaseEndpoint.String()+"/compactor/delete_tenant", nil)
+	return err
+}
+
+// UploadBlock implements MimirClient.
+func (c *Client) UploadBlock(ctx context.Context, blockDir string) error {
+	meta, err := metadata.ReadFromDir(blockDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to read block meta")
+	}
+
+	meta.Thanos.Files, err = block.GatherFileStats(blockDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to gather block files")
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v1/upload/block/%s", c.cfg.WriteBaseEndpoint.String(), url.PathEscape(meta.ULID.String()))
+
+	encodedMeta, err := json.Marshal(meta)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode block meta")
+	}
+	if err := c.doWriteRequest(ctx, http.MethodPost, endpoint+"/start", bytes.NewReader(encodedMeta)); err != nil {
+		return errors.Wrap(err, "failed to start block upload")
+	}
+
+	for _, f := range meta.Thanos.Files {
+		// The meta file has been uploaded when starting the block upload.
+		if f.RelPath == block.MetaFilename {
+			continue
+		}
+
+		if err := c.uploadBlockFile(ctx, endpoint, blockDir, f.RelPath); err != nil {
+			return err
+		}
+	}
+
+	if err := c.doWriteRequest(ctx, http.MethodPost, endpoint+"/finish", nil); err != nil {
+		return errors.Wrap(err, "failed to finish block upload")
+	}
+
+	// Wait until the block has been validated.
+	for {
+		body, err := c.doRequest(ctx, http.MethodGet, endpoint+"/check", nil)
+		if err != nil {
+			return errors.Wrap(err, "failed to check block upload state")
+		}
+
+		var state struct {
+			State string `json:"result"`
+			Error string `json:"error,omitempty"`
+		}
+		if err := json.Unmarshal(body, &state); err != nil {
+			return errors.Wrap(err, "failed to decode block upload state")
+		}
+
+		switch state.State {
+		case "complete":
+			return nil
+		case "failed":
+			return fmt.Errorf("block validation failed: %s", state.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "block upload state is %q", state.State)
+		case <-time.After(blockUploadCheckInterval):
+		}
+	}
+}
+
+func (c *Client) uploadBlockFile(ctx context.Context, endpoint, blockDir, relPath string) error {
+	f, err := os.Open(filepath.Join(blockDir, filepath.FromSlash(relPath)))
+	if err != nil {
+		return errors.Wrapf(err, "failed to open block file %s", relPath)
+	}
+	defer f.Close()
+
+	if err := c.doWriteRequest(ctx, http.MethodPost, endpoint+"/files?path="+url.QueryEscape(relPath), f); err != nil {
+		return errors.Wrapf(err, "failed to upload block file %s", relPath)
+	}
+	return nil
+}
+
+// doWriteRequest is like doRequest, but honors the configured write timeout.
+func (c *Client) doWriteRequest(ctx context.Context, method, u string, body io.Reader) error {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.WriteTimeout)
+	defer cancel()
+
+	_, err := c.doRequest(ctx, method, u, body)
+	return err
+}
+
+// doRequest sends a request to the input URL and returns the response body. Returns an error
+// if the request was not successful.
+func (c *Client) doRequest(ctx context.Context, method, u string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		truncatedBody, err := io.ReadAll(io.LimitReader(resp.Body, maxErrMsgLen))
+		if err != nil {
+			return nil, errors.Wrapf(err, "server returned HTTP status %s and client failed to read response body", resp.Status)
+		}
+
+		return nil, fmt.Errorf("server returned HTTP status %s and body %q (truncated to %d bytes)", resp.Status, string(truncatedBody), maxErrMsgLen)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// queryRangeProtobuf runs a range query requesting the Mimir protobuf query response format.
+func (c *Client) queryRangeProtobuf(ctx context.Context, query string, start, end time.Time, step time.Duration) (model.Matrix, error) {
+	resp, err := c.doProtobufQuery(ctx, "/api/v1/query_range", url.Values{
+		"query": []string{query},
+		"start": []string{formatTime(start)},
+		"end":   []string{formatTime(end)},
+		"step":  []string{strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := resp.Data.(*mimirpb.QueryResponse_Matrix)
+	if !ok {
+		return nil, fmt.Errorf("was expecting to get a Matrix, but got %T", resp.Data)
+	}
+
+	matrix := make(model.Matrix, 0, len(data.Matrix.Series))
+	for _, series := range data.Matrix.Series {
+		if len(series.Histograms) > 0 {
+			return nil, errors.New("native histograms are not supported in protobuf query responses")
+		}
+
+		metric, err := protobufMetricToModel(series.Metric)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]model.SamplePair, 0, len(series.Samples))
+		for _, sample := range series.Samples {
+			values = append(values, model.SamplePair{
+				Timestamp: model.Time(sample.TimestampMs),
+				Value:     model.SampleValue(sample.Value),
+			})
+		}
+
+		matrix = append(matrix, &model.SampleStream{Metric: metric, Values: values})
+	}
+
+	return matrix, nil
+}
+
+// queryProtobuf runs an instant query requesting the Mimir protobuf query response format.
+func (c *Client) queryProtobuf(ctx context.Context, query string, ts time.Time) (model.Vector, error) {
+	resp, err := c.doProtobufQuery(ctx, "/api/v1/query", url.Values{
+		"query": []string{query},
+		"time":  []string{formatTime(ts)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := resp.Data.(*mimirpb.QueryResponse_Vector)
+	if !ok {
+		return nil, fmt.Errorf("was expecting to get a Vector, but got %T", resp.Data)
+	}
+	if len(data.Vector.Histograms) > 0 {
+		return nil, errors.New("native histograms are not supported in protobuf query responses")
+	}
+
+	vector := make(model.Vector, 0, len(data.Vector.Samples))
+	for _, sample := range data.Vector.Samples {
+		metric, err := protobufMetricToModel(sample.Metric)
+		if err != nil {
+			return nil, err
+		}
+
+		vector = append(vector, &model.Sample{
+			Metric:    metric,
+			Value:     model.SampleValue(sample.Value),
+			Timestamp: model.Time(sample.TimestampMs),
+		})
+	}
+
+	return vector, nil
+}
+
+func (c *Client) doProtobufQuery(ctx context.Context, path string, params url.Values) (*mimirpb.QueryResponse, error) {
+	u := c.readRawClient.URL(path, nil)
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mimirpb.QueryResponseMimeType)
+
+	httpResp, body, err := c.readRawClient.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType := httpResp.Header.Get("Content-Type"); contentType != mimirpb.QueryResponseMimeType {
+		if len(body) > maxErrMsgLen {
+			body = body[:maxErrMsgLen]
+		}
+		return nil, fmt.Errorf("server returned HTTP status %s with unexpected content type %q and body %q (truncated to %d bytes)", httpResp.Status, contentType, string(body), maxErrMsgLen)
+	}
+
+	resp := &mimirpb.QueryResponse{}
+	if err := resp.Unmarshal(body); err != nil {
+		return nil, errors.Wrap(err, "failed to decode protobuf query response")
+	}
+
+	if resp.Status == mimirpb.QueryResponse_ERROR {
+		return nil, fmt.Errorf("server returned HTTP status %s and error %q", httpResp.Status, resp.Error)
+	}
+
+	return resp, nil
+}
+
+// protobufMetricToModel converts the metric of a protobuf query response, encoded as a flat list
+// of label name and value pairs, to a model.Metric.
+func protobufMetricToModel(metric []string) (model.Metric, error) {
+	if len(metric)%2 != 0 {
+		return nil, fmt.Errorf("metric is malformed, it contains an odd number of symbols: %d", len(metric))
+	}
+
+	out := make(model.Metric, len(metric)/2)
+	for i := 0; i < len(metric); i += 2 {
+		out[model.LabelName(metric[i])] = model.LabelValue(metric[i+1])
+	}
+
+	return out, nil
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.Unix())+float64(t.Nanosecond())/1e9, 'f', -1, 64)
+}
+
 // WriteSeries implements MimirClient.
 func (c *Client) WriteSeries(ctx context.Context, series []prompb.TimeSeries) (int, error) {
 	lastStatusCode := 0
@@ -181,7 +614,7 @@ func (c *Client) WriteSeries(ctx context.Context, series []prompb.TimeSeries) (i
 		series = series[end:]
 
 		var err error
-		lastStatusCode, err = c.sendWriteRequest(ctx, &prompb.WriteRequest{Timeseries: batch})
+		lastStatusCode, err = c.sendWriteRequestWithRetries(ctx, &prompb.WriteRequest{Timeseries: batch})
 		if err != nil {
 			return lastStatusCode, err
 		}
@@ -190,28 +623,102 @@ func (c *Client) WriteSeries(ctx context.Context, series []prompb.TimeSeries) (i
 	return lastStatusCode, nil
 }
 
+// sendWriteRequestWithRetries sends the input write request, retrying with exponential backoff if it failed because
+// of a network or 5xx error. 4xx errors are not retried, because retrying the request isn't expected to succeed.
+func (c *Client) sendWriteRequestWithRetries(ctx context.Context, req *prompb.WriteRequest) (int, error) {
+	boff := backoff.New(ctx, backoff.Config{
+		MinBackoff: c.cfg.WriteRetryMinBackoff,
+		MaxBackoff: c.cfg.WriteRetryMaxBackoff,
+		MaxRetries: c.cfg.WriteMaxAttempts - 1,
+	})
+	start := time.Now()
+
+	for {
+		statusCode, err := c.sendWriteRequest(ctx, req)
+		if err == nil || !isRetryableWriteStatusCode(statusCode) {
+			return statusCode, err
+		}
+
+		if c.cfg.WriteMaxAttempts <= 1 || !boff.Ongoing() || (c.cfg.WriteMaxRetryElapsed > 0 && time.Since(start) >= c.cfg.WriteMaxRetryElapsed) {
+			return statusCode, err
+		}
+
+		level.Warn(c.logger).Log("msg", "Write request failed, retrying", "status_code", statusCode, "attempt", boff.NumRetries()+1, "err", err)
+		boff.Wait()
+
+		// Do not retry if the context has been canceled while waiting.
+		if ctx.Err() != nil {
+			return statusCode, err
+		}
+	}
+}
+
+// isRetryableWriteStatusCode returns whether a write request failed with the input status code should be retried.
+// The status code is 0 if the request failed because of a network error.
+func isRetryableWriteStatusCode(statusCode int) bool {
+	return statusCode == 0 || statusCode/100 == 5
+}
+
+// writePath returns the API path used to write series.
+func (c *Client) writePath() string {
+	if c.cfg.WritePath != "" {
+		return c.cfg.WritePath
+	}
+	return mimirRemoteWritePath
+}
+
 func (c *Client) sendWriteRequest(ctx context.Context, req *prompb.WriteRequest) (int, error) {
-	data, err := proto.Marshal(req)
+	data, err := c.marshalWriteRequest(req)
+	if err != nil {
+		return 0, err
+	}
+
+	header := http.Header{}
+	payload, contentEncoding := c.compressWriteRequest(data)
+	if contentEncoding != "" {
+		header.Set("Content-Encoding", contentEncoding)
+	}
+	if c.cfg.WriteProtocol == writeProtocolV2 {
+		header.Set("Content-Type", remoteWriteV2ContentType)
+		header.Set("X-Prometheus-Remote-Write-Version", remoteWriteV2Version)
+	} else {
+		header.Set("Content-Type", remoteWriteV1ContentType)
+		header.Set("X-Prometheus-Remote-Write-Version", remoteWriteV1Version)
+	}
+
+	return c.postWriteRequest(ctx, c.writePath(), payload, header)
+}
+
+// WriteOTLPMetrics implements MimirClient.
+func (c *Client) WriteOTLPMetrics(ctx context.Context, metrics pmetric.Metrics) (int, error) {
+	data, err := pmetricotlp.NewExportRequestFromMetrics(metrics).MarshalProto()
 	if err != nil {
 		return 0, err
 	}
 
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-protobuf")
+
+	return c.postWriteRequest(ctx, mimirOTLPWritePath, data, header)
+}
+
+// postWriteRequest sends the input payload to the input API path of the write endpoint.
+func (c *Client) postWriteRequest(ctx context.Context, path string, payload []byte, header http.Header) (int, error) {
 	ctx, cancel := context.WithTimeout(ctx, c.cfg.WriteTimeout)
 	defer cancel()
 
-	compressed := snappy.Encode(nil, data)
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.cfg.WriteBaseEndpoint.String()+"/api/v1/push", bytes.NewReader(compressed))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.cfg.WriteBaseEndpoint.String()+path, bytes.NewReader(payload))
 	if err != nil {
 		// Errors from NewRequest are from unparseable URLs, so are not
 		// recoverable.
 		return 0, err
 	}
-	httpReq.Header.Add("Content-Encoding", "snappy")
-	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	for name, values := range header {
+		httpReq.Header[name] = values
+	}
 	httpReq.Header.Set("User-Agent", "mimir-continuous-test")
-	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
 
-	httpResp, err := c.writeClient.Do(httpReq)
+	httpResp, err := c.httpClient.Do(httpReq)
 	if err != nil {
 		return 0, err
 	}
@@ -229,6 +736,27 @@ func (c *Client) sendWriteRequest(ctx context.Context, req *prompb.WriteRequest)
 	return httpResp.StatusCode, nil
 }
 
+// marshalWriteRequest marshals the input write request in the wire format of the configured write protocol.
+func (c *Client) marshalWriteRequest(req *prompb.WriteRequest) ([]byte, error) {
+	if c.cfg.WriteProtocol == writeProtocolV2 {
+		return marshalRemoteWriteV2Request(req)
+	}
+	return proto.Marshal(req)
+}
+
+// compressWriteRequest compresses the input marshalled write request with the configured compression,
+// and returns the compressed payload along with its content encoding (empty if not compressed).
+func (c *Client) compressWriteRequest(data []byte) ([]byte, string) {
+	switch c.cfg.WriteCompression {
+	case writeCompressionZstd:
+		return c.zstdEncoder.EncodeAll(data, nil), writeCompressionZstd
+	case writeCompressionNone:
+		return data, ""
+	default:
+		return snappy.Encode(nil, data), writeCompressionSnappy
+	}
+}
+
 // RequestOption defines a functional-style request option.
 type RequestOption func(options *requestOptions)
 
@@ -240,6 +768,22 @@ func WithResultsCacheEnabled(enabled bool) RequestOption {
 	}
 }
 
+// WithQueryShardingEnabled controls whether the query-frontend query sharding should be enabled or disabled for the request.
+// This function assumes query-frontend query sharding is enabled by default.
+func WithQueryShardingEnabled(enabled bool) RequestOption {
+	return func(options *requestOptions) {
+		options.queryShardingDisabled = !enabled
+	}
+}
+
+// WithResponseFormat controls the format of the query response requested to Mimir. Supported formats are
+// "json" (default) and "protobuf".
+func WithResponseFormat(format string) RequestOption {
+	return func(options *requestOptions) {
+		options.responseFormat = format
+	}
+}
+
 // contextWithRequestOptions returns a context.Context with the request options applied.
 func contextWithRequestOptions(ctx context.Context, options ...RequestOption) context.Context {
 	actual := &requestOptions{}
@@ -250,8 +794,19 @@ func contextWithRequestOptions(ctx context.Context, options ...RequestOption) co
 	return context.WithValue(ctx, requestOptionsKey, actual)
 }
 
+// requestOptionsFromContext returns the request options stored in the context, or the default ones if none are set.
+func requestOptionsFromContext(ctx context.Context) *requestOptions {
+	if options, ok := ctx.Value(requestOptionsKey).(*requestOptions); ok {
+		return options
+	}
+	return &requestOptions{}
+}
+
 type requestOptions struct {
-	resultsCacheDisabled bool
+	resultsCacheDisabled  bool
+	queryShardingDisabled bool
+	responseFormat        string
+	queryStats            *QueryStats
 }
 
 type key int
@@ -263,6 +818,7 @@ type clientRoundTripper struct {
 	basicAuthUser     string
 	basicAuthPassword string
 	bearerToken       string
+	extraHeaders      map[string]string
 	rt                http.RoundTripper
 }
 
@@ -273,6 +829,13 @@ func (rt *clientRoundTripper) RoundTrip(req *http.Request) (*http.Response, erro
 		// Despite the name, the "no-store" directive also disables results cache lookup in Mimir.
 		req.Header.Set("Cache-Control", "no-store")
 	}
+	if options != nil && options.queryShardingDisabled {
+		// Requesting 0 shards disables query sharding in the query-frontend.
+		req.Header.Set("Sharding-Control", "0")
+	}
+	for name, value := range rt.extraHeaders {
+		req.Header.Set(name, value)
+	}
 
 	if rt.bearerToken != "" {
 		req.Header.Set("Authorization", "Bearer "+rt.bearerToken)
@@ -4,9 +4,12 @@ package continuoustest
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,20 +17,29 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
 	"github.com/grafana/dskit/flagext"
+	"github.com/klauspost/compress/zstd"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
 )
 
 func TestClient_WriteSeries(t *testing.T) {
 	var (
 		nextStatusCode   = http.StatusOK
 		receivedRequests []prompb.WriteRequest
+		receivedPaths    []string
 	)
 
 	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		receivedPaths = append(receivedPaths, request.URL.Path)
+
 		// Read the entire body.
 		body, err := io.ReadAll(request.Body)
 		require.NoError(t, err)
@@ -51,7 +63,7 @@ func TestClient_WriteSeries(t *testing.T) {
 	require.NoError(t, cfg.WriteBaseEndpoint.Set(server.URL))
 	require.NoError(t, cfg.ReadBaseEndpoint.Set(server.URL))
 
-	c, err := NewClient(cfg, log.NewNopLogger())
+	c, err := NewClient(cfg, log.NewNopLogger(), nil)
 	require.NoError(t, err)
 
 	ctx := context.Background()
@@ -59,6 +71,7 @@ func TestClient_WriteSeries(t *testing.T) {
 
 	t.Run("write series in a single batch", func(t *testing.T) {
 		receivedRequests = nil
+		receivedPaths = nil
 		nextStatusCode = http.StatusOK
 
 		series := generateSineWaveSeries("test", now, 10)
@@ -68,6 +81,40 @@ func TestClient_WriteSeries(t *testing.T) {
 
 		require.Len(t, receivedRequests, 1)
 		assert.Equal(t, series, receivedRequests[0].Timeseries)
+		assert.Equal(t, []string{"/api/v1/push"}, receivedPaths)
+	})
+
+	t.Run("write series with a custom write path", func(t *testing.T) {
+		receivedPaths = nil
+		nextStatusCode = http.StatusNoContent
+
+		cfg := cfg
+		cfg.WritePath = "/api/v1/write"
+		c, err := NewClient(cfg, log.NewNopLogger(), nil)
+		require.NoError(t, err)
+
+		statusCode, err := c.WriteSeries(ctx, generateSineWaveSeries("test", now, 1))
+		require.NoError(t, err)
+		assert.Equal(t, 204, statusCode)
+		assert.Equal(t, []string{"/api/v1/write"}, receivedPaths)
+	})
+
+	t.Run("write series without the read endpoint", func(t *testing.T) {
+		receivedPaths = nil
+		nextStatusCode = http.StatusOK
+
+		cfg := cfg
+		cfg.ReadBaseEndpoint = flagext.URLValue{}
+		c, err := NewClient(cfg, log.NewNopLogger(), nil)
+		require.NoError(t, err)
+
+		statusCode, err := c.WriteSeries(ctx, generateSineWaveSeries("test", now, 1))
+		require.NoError(t, err)
+		assert.Equal(t, 200, statusCode)
+		assert.Equal(t, []string{"/api/v1/push"}, receivedPaths)
+
+		_, err = c.Query(ctx, "test", now)
+		assert.ErrorIs(t, err, errReadEndpointNotSet)
 	})
 
 	t.Run("write series in multiple batches", func(t *testing.T) {
@@ -93,6 +140,9 @@ func TestClient_WriteSeries(t *testing.T) {
 		statusCode, err := c.WriteSeries(ctx, series)
 		require.Error(t, err)
 		assert.Equal(t, 400, statusCode)
+
+		// 4xx errors are not retried.
+		require.Len(t, receivedRequests, 1)
 	})
 
 	t.Run("request failed with 5xx error", func(t *testing.T) {
@@ -103,9 +153,200 @@ func TestClient_WriteSeries(t *testing.T) {
 		statusCode, err := c.WriteSeries(ctx, series)
 		require.Error(t, err)
 		assert.Equal(t, 500, statusCode)
+
+		// 5xx errors are retried up to the max attempts.
+		require.Len(t, receivedRequests, cfg.WriteMaxAttempts)
 	})
 }
 
+func TestClient_WriteSeries_Retries(t *testing.T) {
+	var (
+		statusCodes      []int
+		receivedRequests int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		statusCode := http.StatusOK
+		if receivedRequests < len(statusCodes) {
+			statusCode = statusCodes[receivedRequests]
+		}
+		receivedRequests++
+
+		writer.WriteHeader(statusCode)
+	}))
+	t.Cleanup(server.Close)
+
+	newClient := func(t *testing.T, maxAttempts int, maxElapsed time.Duration) *Client {
+		cfg := ClientConfig{}
+		flagext.DefaultValues(&cfg)
+		cfg.WriteMaxAttempts = maxAttempts
+		cfg.WriteMaxRetryElapsed = maxElapsed
+		cfg.WriteRetryMinBackoff = time.Millisecond
+		cfg.WriteRetryMaxBackoff = 10 * time.Millisecond
+		require.NoError(t, cfg.WriteBaseEndpoint.Set(server.URL))
+		require.NoError(t, cfg.ReadBaseEndpoint.Set(server.URL))
+
+		c, err := NewClient(cfg, log.NewNopLogger(), nil)
+		require.NoError(t, err)
+		return c
+	}
+
+	series := generateSineWaveSeries("test", time.Now(), 1)
+
+	tests := map[string]struct {
+		statusCodes        []int
+		maxAttempts        int
+		maxElapsed         time.Duration
+		expectedStatusCode int
+		expectedRequests   int
+	}{
+		"should succeed after transient 5xx errors": {
+			statusCodes:        []int{http.StatusInternalServerError, http.StatusServiceUnavailable},
+			maxAttempts:        3,
+			expectedStatusCode: http.StatusOK,
+			expectedRequests:   3,
+		},
+		"should give up after the max attempts": {
+			statusCodes:        []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			maxAttempts:        2,
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedRequests:   2,
+		},
+		"should not retry if retries are disabled": {
+			statusCodes:        []int{http.StatusInternalServerError},
+			maxAttempts:        1,
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedRequests:   1,
+		},
+		"should not retry 4xx errors": {
+			statusCodes:        []int{http.StatusTooManyRequests},
+			maxAttempts:        3,
+			expectedStatusCode: http.StatusTooManyRequests,
+			expectedRequests:   1,
+		},
+		"should not retry once the max elapsed time has passed": {
+			statusCodes:        []int{http.StatusInternalServerError, http.StatusInternalServerError},
+			maxAttempts:        3,
+			maxElapsed:         time.Nanosecond,
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedRequests:   1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			statusCodes = testData.statusCodes
+			receivedRequests = 0
+
+			statusCode, err := newClient(t, testData.maxAttempts, testData.maxElapsed).WriteSeries(context.Background(), series)
+			if testData.expectedStatusCode/100 == 2 {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+			assert.Equal(t, testData.expectedStatusCode, statusCode)
+			assert.Equal(t, testData.expectedRequests, receivedRequests)
+		})
+	}
+}
+
+func TestClientConfig_Validate(t *testing.T) {
+	cfg := ClientConfig{}
+	flagext.DefaultValues(&cfg)
+	require.NoError(t, cfg.Validate())
+
+	cfg.WriteMaxAttempts = 0
+	require.Error(t, cfg.Validate())
+
+	cfg.WriteMaxAttempts = 1
+	cfg.WriteRetryMinBackoff = 2 * cfg.WriteRetryMaxBackoff
+	require.Error(t, cfg.Validate())
+
+	flagext.DefaultValues(&cfg)
+	cfg.WriteCompression = "gzip"
+	require.Error(t, cfg.Validate())
+
+	flagext.DefaultValues(&cfg)
+	cfg.WriteProtocol = "remote-write-v3"
+	require.Error(t, cfg.Validate())
+}
+
+func TestClient_WriteSeries_Compression(t *testing.T) {
+	zstdDecoder, err := zstd.NewReader(nil)
+	require.NoError(t, err)
+	t.Cleanup(zstdDecoder.Close)
+
+	tests := map[string]struct {
+		expectedContentEncoding string
+		decode                  func(body []byte) ([]byte, error)
+	}{
+		"snappy": {
+			expectedContentEncoding: "snappy",
+			decode: func(body []byte) ([]byte, error) {
+				return snappy.Decode(nil, body)
+			},
+		},
+		"zstd": {
+			expectedContentEncoding: "zstd",
+			decode: func(body []byte) ([]byte, error) {
+				return zstdDecoder.DecodeAll(body, nil)
+			},
+		},
+		"none": {
+			expectedContentEncoding: "",
+			decode: func(body []byte) ([]byte, error) {
+				return body, nil
+			},
+		},
+	}
+
+	for compression, testData := range tests {
+		t.Run(compression, func(t *testing.T) {
+			var (
+				receivedRequests         []prompb.WriteRequest
+				receivedContentEncodings []string
+			)
+
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				receivedContentEncodings = append(receivedContentEncodings, request.Header.Get("Content-Encoding"))
+
+				body, err := io.ReadAll(request.Body)
+				require.NoError(t, err)
+				require.NoError(t, request.Body.Close())
+
+				body, err = testData.decode(body)
+				require.NoError(t, err)
+
+				var req prompb.WriteRequest
+				require.NoError(t, proto.Unmarshal(body, &req))
+				receivedRequests = append(receivedRequests, req)
+
+				writer.WriteHeader(http.StatusOK)
+			}))
+			t.Cleanup(server.Close)
+
+			cfg := ClientConfig{}
+			flagext.DefaultValues(&cfg)
+			cfg.WriteCompression = compression
+			require.NoError(t, cfg.Validate())
+			require.NoError(t, cfg.WriteBaseEndpoint.Set(server.URL))
+			require.NoError(t, cfg.ReadBaseEndpoint.Set(server.URL))
+
+			c, err := NewClient(cfg, log.NewNopLogger(), nil)
+			require.NoError(t, err)
+
+			series := generateSineWaveSeries("test", time.Now(), 10)
+			statusCode, err := c.WriteSeries(context.Background(), series)
+			require.NoError(t, err)
+			assert.Equal(t, 200, statusCode)
+
+			require.Len(t, receivedRequests, 1)
+			assert.Equal(t, series, receivedRequests[0].Timeseries)
+			assert.Equal(t, []string{testData.expectedContentEncoding}, receivedContentEncodings)
+		})
+	}
+}
+
 func TestClient_QueryRange(t *testing.T) {
 	var (
 		receivedRequests []*http.Request
@@ -125,7 +366,7 @@ func TestClient_QueryRange(t *testing.T) {
 	require.NoError(t, cfg.WriteBaseEndpoint.Set(server.URL))
 	require.NoError(t, cfg.ReadBaseEndpoint.Set(server.URL))
 
-	c, err := NewClient(cfg, log.NewNopLogger())
+	c, err := NewClient(cfg, log.NewNopLogger(), nil)
 	require.NoError(t, err)
 
 	ctx := context.Background()
@@ -149,6 +390,41 @@ func TestClient_QueryRange(t *testing.T) {
 		require.Len(t, receivedRequests, 1)
 		assert.Equal(t, "no-store", receivedRequests[0].Header.Get("Cache-Control"))
 	})
+
+	t.Run("query sharding not explicitly disabled", func(t *testing.T) {
+		receivedRequests = nil
+
+		_, err := c.QueryRange(ctx, "up", time.Unix(0, 0), time.Unix(1000, 0), 10)
+		require.NoError(t, err)
+
+		require.Len(t, receivedRequests, 1)
+		assert.Empty(t, receivedRequests[0].Header.Get("Sharding-Control"))
+	})
+
+	t.Run("query sharding disabled", func(t *testing.T) {
+		receivedRequests = nil
+
+		_, err := c.QueryRange(ctx, "up", time.Unix(0, 0), time.Unix(1000, 0), 10, WithQueryShardingEnabled(false))
+		require.NoError(t, err)
+
+		require.Len(t, receivedRequests, 1)
+		assert.Equal(t, "0", receivedRequests[0].Header.Get("Sharding-Control"))
+	})
+
+	t.Run("extra headers", func(t *testing.T) {
+		receivedRequests = nil
+
+		cfg := cfg
+		cfg.ExtraHeaders = map[string]string{"X-Zone": "zone-a"}
+		c, err := NewClient(cfg, log.NewNopLogger(), nil)
+		require.NoError(t, err)
+
+		_, err = c.QueryRange(ctx, "up", time.Unix(0, 0), time.Unix(1000, 0), 10)
+		require.NoError(t, err)
+
+		require.Len(t, receivedRequests, 1)
+		assert.Equal(t, "zone-a", receivedRequests[0].Header.Get("X-Zone"))
+	})
 }
 
 func TestClient_Query(t *testing.T) {
@@ -170,7 +446,7 @@ func TestClient_Query(t *testing.T) {
 	require.NoError(t, cfg.WriteBaseEndpoint.Set(server.URL))
 	require.NoError(t, cfg.ReadBaseEndpoint.Set(server.URL))
 
-	c, err := NewClient(cfg, log.NewNopLogger())
+	c, err := NewClient(cfg, log.NewNopLogger(), nil)
 	require.NoError(t, err)
 
 	ctx := context.Background()
@@ -196,6 +472,240 @@ func TestClient_Query(t *testing.T) {
 	})
 }
 
+func TestClient_ProtobufResponseFormat(t *testing.T) {
+	var (
+		receivedRequests []*http.Request
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		receivedRequests = append(receivedRequests, request)
+
+		resp := mimirpb.QueryResponse{Status: mimirpb.QueryResponse_SUCCESS}
+		switch request.URL.Path {
+		case "/api/v1/query_range":
+			resp.Data = &mimirpb.QueryResponse_Matrix{Matrix: &mimirpb.MatrixData{Series: []mimirpb.MatrixSeries{{
+				Metric:  []string{"__name__", "up", "job", "test"},
+				Samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 1}, {TimestampMs: 2000, Value: 2}},
+			}}}}
+		case "/api/v1/query":
+			resp.Data = &mimirpb.QueryResponse_Vector{Vector: &mimirpb.VectorData{Samples: []mimirpb.VectorSample{{
+				Metric:      []string{"__name__", "up", "job", "test"},
+				TimestampMs: 1000,
+				Value:       1,
+			}}}}
+		}
+
+		body, err := resp.Marshal()
+		require.NoError(t, err)
+
+		writer.Header().Set("Content-Type", mimirpb.QueryResponseMimeType)
+		writer.WriteHeader(http.StatusOK)
+		_, err = writer.Write(body)
+		require.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := ClientConfig{}
+	flagext.DefaultValues(&cfg)
+	require.NoError(t, cfg.WriteBaseEndpoint.Set(server.URL))
+	require.NoError(t, cfg.ReadBaseEndpoint.Set(server.URL))
+
+	c, err := NewClient(cfg, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	expectedMetric := model.Metric{"__name__": "up", "job": "test"}
+
+	t.Run("range query", func(t *testing.T) {
+		receivedRequests = nil
+
+		matrix, err := c.QueryRange(ctx, "up", time.Unix(0, 0), time.Unix(1000, 0), 10*time.Second, WithResponseFormat(responseFormatProtobuf), WithResultsCacheEnabled(false))
+		require.NoError(t, err)
+		assert.Equal(t, model.Matrix{{
+			Metric: expectedMetric,
+			Values: []model.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}},
+		}}, matrix)
+
+		require.Len(t, receivedRequests, 1)
+		assert.Equal(t, mimirpb.QueryResponseMimeType, receivedRequests[0].Header.Get("Accept"))
+		assert.Equal(t, "no-store", receivedRequests[0].Header.Get("Cache-Control"))
+		assert.Equal(t, "up", receivedRequests[0].URL.Query().Get("query"))
+		assert.Equal(t, "10", receivedRequests[0].URL.Query().Get("step"))
+	})
+
+	t.Run("instant query", func(t *testing.T) {
+		receivedRequests = nil
+
+		vector, err := c.Query(ctx, "up", time.Unix(1, 0), WithResponseFormat(responseFormatProtobuf))
+		require.NoError(t, err)
+		assert.Equal(t, model.Vector{{Metric: expectedMetric, Timestamp: 1000, Value: 1}}, vector)
+
+		require.Len(t, receivedRequests, 1)
+		assert.Equal(t, mimirpb.QueryResponseMimeType, receivedRequests[0].Header.Get("Accept"))
+		assert.Equal(t, "1", receivedRequests[0].URL.Query().Get("time"))
+	})
+}
+
+func TestClient_APIProbes(t *testing.T) {
+	var (
+		receivedRequests []*http.Request
+		nextStatusCode   = http.StatusOK
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		receivedRequests = append(receivedRequests, request)
+		writer.WriteHeader(nextStatusCode)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := ClientConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.TenantID = "tenant-1"
+	require.NoError(t, cfg.WriteBaseEndpoint.Set(server.URL))
+	require.NoError(t, cfg.ReadBaseEndpoint.Set(server.URL+"/prometheus"))
+	require.NoError(t, cfg.AlertmanagerBaseEndpoint.Set(server.URL+"/alertmanager"))
+
+	c, err := NewClient(cfg, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+
+	t.Run("list rules", func(t *testing.T) {
+		receivedRequests = nil
+		nextStatusCode = http.StatusOK
+
+		require.NoError(t, c.ListRules(context.Background()))
+		require.Len(t, receivedRequests, 1)
+		assert.Equal(t, "/prometheus/api/v1/rules", receivedRequests[0].URL.Path)
+		assert.Equal(t, "tenant-1", receivedRequests[0].Header.Get("X-Scope-OrgID"))
+
+		nextStatusCode = http.StatusInternalServerError
+		require.Error(t, c.ListRules(context.Background()))
+	})
+
+	t.Run("set rule group", func(t *testing.T) {
+		receivedRequests = nil
+		nextStatusCode = http.StatusAccepted
+
+		group := rulefmt.RuleGroup{Name: "group-1", Interval: model.Duration(time.Minute)}
+		require.NoError(t, c.SetRuleGroup(context.Background(), "namespace-1", group))
+		require.Len(t, receivedRequests, 1)
+		assert.Equal(t, http.MethodPost, receivedRequests[0].Method)
+		assert.Equal(t, "/prometheus/config/v1/rules/namespace-1", receivedRequests[0].URL.Path)
+		assert.Equal(t, "tenant-1", receivedRequests[0].Header.Get("X-Scope-OrgID"))
+
+		nextStatusCode = http.StatusBadRequest
+		require.Error(t, c.SetRuleGroup(context.Background(), "namespace-1", group))
+	})
+
+	t.Run("get alertmanager status", func(t *testing.T) {
+		receivedRequests = nil
+		nextStatusCode = http.StatusOK
+
+		require.NoError(t, c.GetAlertmanagerStatus(context.Background()))
+		require.Len(t, receivedRequests, 1)
+		assert.Equal(t, "/alertmanager/api/v2/status", receivedRequests[0].URL.Path)
+		assert.Equal(t, "tenant-1", receivedRequests[0].Header.Get("X-Scope-OrgID"))
+
+		nextStatusCode = http.StatusServiceUnavailable
+		require.Error(t, c.GetAlertmanagerStatus(context.Background()))
+	})
+
+	t.Run("delete tenant", func(t *testing.T) {
+		receivedRequests = nil
+		nextStatusCode = http.StatusOK
+
+		require.NoError(t, c.DeleteTenant(context.Background()))
+		require.Len(t, receivedRequests, 1)
+		assert.Equal(t, http.MethodPost, receivedRequests[0].Method)
+		assert.Equal(t, "/compactor/delete_tenant", receivedRequests[0].URL.Path)
+		assert.Equal(t, "tenant-1", receivedRequests[0].Header.Get("X-Scope-OrgID"))
+
+		nextStatusCode = http.StatusInternalServerError
+		require.Error(t, c.DeleteTenant(context.Background()))
+	})
+
+	t.Run("get alertmanager status without the alertmanager endpoint configured", func(t *testing.T) {
+		cfg := cfg
+		cfg.AlertmanagerBaseEndpoint = flagext.URLValue{}
+
+		c, err := NewClient(cfg, log.NewNopLogger(), nil)
+		require.NoError(t, err)
+		require.Error(t, c.GetAlertmanagerStatus(context.Background()))
+	})
+}
+
+func TestClient_UploadBlock(t *testing.T) {
+	blockDir, err := writeSineWaveBlock(context.Background(), log.NewNopLogger(), t.TempDir(), blockUploadMetricName, time.Unix(0, 0), time.Unix(3600, 0), 2)
+	require.NoError(t, err)
+	blockID := filepath.Base(blockDir)
+
+	var (
+		receivedPaths []string
+		receivedMeta  metadata.Meta
+		checkResults  []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, err := io.ReadAll(request.Body)
+		require.NoError(t, err)
+
+		path := request.Method + " " + request.URL.Path
+		if p := request.URL.Query().Get("path"); p != "" {
+			path += "?path=" + p
+		}
+		receivedPaths = append(receivedPaths, path)
+
+		switch {
+		case strings.HasSuffix(request.URL.Path, "/start"):
+			require.NoError(t, json.Unmarshal(body, &receivedMeta))
+		case strings.HasSuffix(request.URL.Path, "/files"):
+			assert.NotEmpty(t, body)
+		case strings.HasSuffix(request.URL.Path, "/check"):
+			result := checkResults[0]
+			checkResults = checkResults[1:]
+			_, _ = writer.Write([]byte(`{"result":"` + result + `"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := ClientConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.TenantID = "tenant-1"
+	require.NoError(t, cfg.WriteBaseEndpoint.Set(server.URL))
+	require.NoError(t, cfg.ReadBaseEndpoint.Set(server.URL+"/prometheus"))
+
+	c, err := NewClient(cfg, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+
+	t.Run("should upload the block files and wait until the block has been validated", func(t *testing.T) {
+		receivedPaths = nil
+		checkResults = []string{"validating", "complete"}
+
+		require.NoError(t, c.UploadBlock(context.Background(), blockDir))
+
+		endpoint := "/api/v1/upload/block/" + blockID
+		assert.Equal(t, []string{
+			"POST " + endpoint + "/start",
+			"POST " + endpoint + "/files?path=chunks/000001",
+			"POST " + endpoint + "/files?path=index",
+			"POST " + endpoint + "/finish",
+			"GET " + endpoint + "/check",
+			"GET " + endpoint + "/check",
+		}, receivedPaths)
+
+		assert.Equal(t, blockID, receivedMeta.ULID.String())
+		assert.Equal(t, int64(0), receivedMeta.MinTime)
+		assert.Equal(t, int64(3600000-20000+1), receivedMeta.MaxTime)
+		assert.Len(t, receivedMeta.Thanos.Files, 3)
+	})
+
+	t.Run("should return error if the block validation failed", func(t *testing.T) {
+		receivedPaths = nil
+		checkResults = []string{"failed"}
+
+		require.Error(t, c.UploadBlock(context.Background(), blockDir))
+	})
+}
+
 // ClientMock mocks MimirClient.
 type ClientMock struct {
 	mock.Mock
@@ -206,6 +716,11 @@ func (m *ClientMock) WriteSeries(ctx context.Context, series []prompb.TimeSeries
 	return args.Int(0), args.Error(1)
 }
 
+func (m *ClientMock) WriteOTLPMetrics(ctx context.Context, metrics pmetric.Metrics) (int, error) {
+	args := m.Called(ctx, metrics)
+	return args.Int(0), args.Error(1)
+}
+
 func (m *ClientMock) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration, options ...RequestOption) (model.Matrix, error) {
 	args := m.Called(ctx, query, start, end, step, options)
 	return args.Get(0).(model.Matrix), args.Error(1)
@@ -215,3 +730,28 @@ func (m *ClientMock) Query(ctx context.Context, query string, ts time.Time, opti
 	args := m.Called(ctx, query, ts, options)
 	return args.Get(0).(model.Vector), args.Error(1)
 }
+
+func (m *ClientMock) ListRules(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *ClientMock) SetRuleGroup(ctx context.Context, namespace string, group rulefmt.RuleGroup) error {
+	args := m.Called(ctx, namespace, group)
+	return args.Error(0)
+}
+
+func (m *ClientMock) GetAlertmanagerStatus(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *ClientMock) UploadBlock(ctx context.Context, blockDir string) error {
+	args := m.Called(ctx, blockDir)
+	return args.Error(0)
+}
+
+func (m *ClientMock) DeleteTenant(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
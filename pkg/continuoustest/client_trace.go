@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	requestPhaseDNS          = "dns"
+	requestPhaseConnect      = "connect"
+	requestPhaseTLSHandshake = "tls_handshake"
+	requestPhaseTTFB         = "ttfb"
+)
+
+// ClientMetrics holds the metrics tracked by the clients about the phases of the HTTP requests sent to Mimir,
+// and about the statistics of the queries returned by Mimir. The same metrics can be shared by multiple clients,
+// because the request phases are partitioned by endpoint.
+type ClientMetrics struct {
+	requestPhaseDuration *prometheus.HistogramVec
+
+	// queryStats holds the histograms tracking each query statistic, by name of the statistic.
+	queryStats             map[string]*prometheus.HistogramVec
+	queryStatsMissingTotal *prometheus.CounterVec
+}
+
+func NewClientMetrics(reg prometheus.Registerer) *ClientMetrics {
+	return &ClientMetrics{
+		requestPhaseDuration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name: "mimir_continuous_test_request_phase_duration_seconds",
+			Help: "Duration of each phase of the HTTP requests sent to Mimir: the DNS resolution, the connection and the TLS handshake, which only happen when a new connection is established, and the time to first byte, from when the request has been written until the first byte of the response has been received.",
+			// The network phases are typically much faster than the requests processed by Mimir.
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"endpoint", "phase"}),
+		queryStats: newQueryStatsHistograms(reg),
+		queryStatsMissingTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "mimir_continuous_test_query_stats_missing_total",
+			Help: "Total number of successful queries whose response didn't include the query statistics. The statistics are returned only if they're enabled in the query-frontend.",
+		}, []string{"type"}),
+	}
+}
+
+// requestPhasesRoundTripper tracks the duration of the phases of each HTTP request, using httptrace,
+// so that latency regressions can be attributed to the network or to Mimir.
+type requestPhasesRoundTripper struct {
+	metrics *ClientMetrics
+	next    http.RoundTripper
+}
+
+func newRequestPhasesRoundTripper(metrics *ClientMetrics, next http.RoundTripper) *requestPhasesRoundTripper {
+	return &requestPhasesRoundTripper{metrics: metrics, next: next}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *requestPhasesRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	phases := &requestPhases{metrics: rt.metrics, endpoint: req.URL.Host, start: map[string]time.Time{}}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), phases.clientTrace()))
+	return rt.next.RoundTrip(req)
+}
+
+// requestPhases tracks the phases of a single HTTP request. The httptrace hooks may be called concurrently,
+// for example when connecting to multiple addresses of a dual-stack host.
+type requestPhases struct {
+	metrics  *ClientMetrics
+	endpoint string
+
+	mtx   sync.Mutex
+	start map[string]time.Time
+}
+
+func (p *requestPhases) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { p.begin(requestPhaseDNS) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			p.end(requestPhaseDNS, info.Err)
+		},
+		ConnectStart: func(string, string) { p.begin(requestPhaseConnect) },
+		ConnectDone: func(_, _ string, err error) {
+			p.end(requestPhaseConnect, err)
+		},
+		TLSHandshakeStart: func() { p.begin(requestPhaseTLSHandshake) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			p.end(requestPhaseTLSHandshake, err)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				p.begin(requestPhaseTTFB)
+			}
+		},
+		GotFirstResponseByte: func() { p.end(requestPhaseTTFB, nil) },
+	}
+}
+
+// begin records the start of the input phase.
+func (p *requestPhases) begin(phase string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.start[phase] = time.Now()
+}
+
+// end tracks the duration of the input phase, if it has started and succeeded.
+func (p *requestPhases) end(phase string, err error) {
+	p.mtx.Lock()
+	start, ok := p.start[phase]
+	delete(p.start, phase)
+	p.mtx.Unlock()
+
+	if !ok || err != nil {
+		return
+	}
+	p.metrics.requestPhaseDuration.WithLabelValues(p.endpoint, phase).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestPhasesRoundTripper(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	reg := prometheus.NewPedanticRegistry()
+	client := &http.Client{Transport: newRequestPhasesRoundTripper(NewClientMetrics(reg), server.Client().Transport)}
+
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(server.URL)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, res.Body)
+		require.NoError(t, res.Body.Close())
+	}
+
+	// The connection is established only once, and reused by the second request. The server
+	// is reached by IP address, so there's no DNS resolution.
+	endpoint := "endpoint=" + serverURL.Host
+	assert.Equal(t, map[string]uint64{
+		endpoint + ",phase=" + requestPhaseConnect:      1,
+		endpoint + ",phase=" + requestPhaseTLSHandshake: 1,
+		endpoint + ",phase=" + requestPhaseTTFB:         2,
+	}, histogramSampleCounts(t, reg, "mimir_continuous_test_request_phase_duration_seconds"))
+}
@@ -0,0 +1,359 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/globalerror"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	conflictingWritesMetricName = "mimir_continuous_test_conflicting_writes"
+
+	// conflictingWritesValueDelta is the difference between the values written by the two writers
+	// for the same series and timestamp.
+	conflictingWritesValueDelta = 1
+
+	// Reasons why the observed behavior deviates from the expected one.
+	conflictingWritesReasonBothAccepted    = "both_accepted"
+	conflictingWritesReasonMissingSeries   = "missing_series"
+	conflictingWritesReasonUnexpectedValue = "unexpected_value"
+	conflictingWritesReasonLoserValue      = "loser_value"
+	conflictingWritesReasonRetryRejected   = "retry_rejected"
+	conflictingWritesReasonUnexpectedError = "unexpected_error"
+)
+
+var (
+	// See queryMetricSum for the reason why max_over_time() is used.
+	conflictingWritesQuery = fmt.Sprintf("max_over_time(%s[1s])", conflictingWritesMetricName)
+
+	conflictingWritesReasons = []string{
+		conflictingWritesReasonBothAccepted,
+		conflictingWritesReasonMissingSeries,
+		conflictingWritesReasonUnexpectedValue,
+		conflictingWritesReasonLoserValue,
+		conflictingWritesReasonRetryRejected,
+		conflictingWritesReasonUnexpectedError,
+	}
+)
+
+type ConflictingWritesTestConfig struct {
+	Enabled             bool
+	NumSeries           int
+	SecondWriteEndpoint flagext.URLValue
+	Sequential          bool
+}
+
+func (cfg *ConflictingWritesTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.conflicting-writes-test.enabled", false, "Enable the test which periodically writes the same series and timestamps with different values from two concurrent writers, and checks whether Mimir keeps the first written value and rejects the other one.")
+	f.IntVar(&cfg.NumSeries, "tests.conflicting-writes-test.num-series", 10, "Number of series written by each writer.")
+	f.BoolVar(&cfg.Sequential, "tests.conflicting-writes-test.sequential", false, "When enabled, the two writers write one after the other instead of concurrently, so that the outcome is deterministic: the first write request is expected to be accepted, a retry of the same request is expected to be accepted too, because samples with the same timestamp and value are deduplicated, and the second writer's request is expected to be rejected with the 400 status code and the err-mimir-sample-duplicate-timestamp error.")
+	f.Var(&cfg.SecondWriteEndpoint, "tests.conflicting-writes-test.second-write-endpoint", "The base endpoint on the write path used by the second writer. If empty, both writers use the endpoint configured by -tests.write-endpoint.")
+}
+
+func (cfg *ConflictingWritesTestConfig) Validate() error {
+	if cfg.NumSeries <= 0 {
+		return errors.New("the number of series written by the conflicting writes test must be greater than 0")
+	}
+	return nil
+}
+
+// conflictingWrite is the outcome of a write request sent by one of the two writers.
+type conflictingWrite struct {
+	statusCode int
+	err        error
+}
+
+func (w conflictingWrite) accepted() bool {
+	return w.statusCode/100 == 2
+}
+
+// rejected returns whether the write request has been rejected, because some of its samples
+// conflict with the ones written by the other writer.
+func (w conflictingWrite) rejected() bool {
+	return w.statusCode == http.StatusBadRequest
+}
+
+// ConflictingWritesTest periodically writes the same series and timestamps, with different values, from two
+// concurrent writers, simulating a split-brain between two senders. For each series, Mimir is expected to accept
+// the first written sample and reject the other one as a duplicate, and queries are expected to return the value
+// of the accepted sample.
+type ConflictingWritesTest struct {
+	name    string
+	cfg     ConflictingWritesTestConfig
+	clients [2]MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	deviationsTotal *prometheus.CounterVec
+
+	lastWrittenTimestamp time.Time
+}
+
+// NewConflictingWritesTest makes a new ConflictingWritesTest. The two writers write through the input clients,
+// which can be the same client.
+func NewConflictingWritesTest(cfg ConflictingWritesTestConfig, client, secondClient MimirClient, logger log.Logger, reg prometheus.Registerer) *ConflictingWritesTest {
+	const name = "conflicting-writes"
+
+	t := &ConflictingWritesTest{
+		name:    name,
+		cfg:     cfg,
+		clients: [2]MimirClient{client, secondClient},
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+
+		deviationsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_conflicting_writes_deviations_total",
+			Help:        "Total number of times the observed behavior of conflicting writes deviated from the expected one.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"reason"}),
+	}
+
+	// Initialise the metrics so that they're exported even if no deviation occurred.
+	for _, reason := range conflictingWritesReasons {
+		t.deviationsTotal.WithLabelValues(reason)
+	}
+
+	return t
+}
+
+// Name implements Test.
+func (t *ConflictingWritesTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *ConflictingWritesTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *ConflictingWritesTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	// Write at most once per write interval, because each timestamp can be written only once.
+	timestamp := alignTimestampToInterval(now, writeInterval)
+	if !timestamp.After(t.lastWrittenTimestamp) {
+		return nil
+	}
+	t.lastWrittenTimestamp = timestamp
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "ConflictingWritesTest.Run")
+	defer sp.Finish()
+	logger := log.With(sp, "timestamp", timestamp.UnixMilli(), "num_series", t.cfg.NumSeries)
+
+	var (
+		writes [2]conflictingWrite
+		retry  conflictingWrite
+	)
+	if t.cfg.Sequential {
+		writes, retry = t.writeSequentially(ctx, timestamp)
+	} else {
+		writes = t.writeConcurrently(ctx, timestamp)
+	}
+
+	// We can verify the behavior only if both writes have been either accepted or rejected because of conflicts.
+	errs := new(multierror.MultiError)
+	for i, w := range writes {
+		if !w.accepted() && !w.rejected() {
+			level.Warn(logger).Log("msg", "Conflicting write request failed with an unexpected error", "writer", i, "status_code", w.statusCode, "err", w.err)
+			errs.Add(errors.Errorf("conflicting write request from writer %d failed with status code %d (error: %v)", i, w.statusCode, w.err))
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	// The same sample can't be accepted twice with different values.
+	if writes[0].accepted() && writes[1].accepted() {
+		t.deviationsTotal.WithLabelValues(conflictingWritesReasonBothAccepted).Inc()
+		level.Warn(logger).Log("msg", "Both conflicting write requests have been accepted")
+		errs.Add(errors.New("both conflicting write requests have been accepted"))
+	}
+	if t.cfg.Sequential {
+		errs.Add(t.verifySequentialWrites(logger, writes, retry))
+	}
+
+	errs.Add(t.verifyWrittenValues(ctx, logger, timestamp, writes))
+	return errs.Err()
+}
+
+// writeConcurrently writes the same series and timestamp, with different values, from the two writers concurrently.
+func (t *ConflictingWritesTest) writeConcurrently(ctx context.Context, timestamp time.Time) [2]conflictingWrite {
+	var (
+		wg     sync.WaitGroup
+		writes [2]conflictingWrite
+	)
+
+	for i := range t.clients {
+		series := generateConflictingSeries(timestamp, t.cfg.NumSeries, conflictingWriterValue(timestamp, i))
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			start := time.Now()
+			writes[i].statusCode, writes[i].err = t.clients[i].WriteSeries(ctx, series)
+			t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+		}(i)
+	}
+	wg.Wait()
+
+	for _, w := range writes {
+		t.trackWrite(w)
+	}
+
+	return writes
+}
+
+// writeSequentially writes the same series and timestamp, with different values, from the first writer and then
+// from the second one. The first writer's request is retried before the second writer writes, and the outcome of
+// the retry is returned too.
+func (t *ConflictingWritesTest) writeSequentially(ctx context.Context, timestamp time.Time) (writes [2]conflictingWrite, retry conflictingWrite) {
+	write := func(writer int) conflictingWrite {
+		var w conflictingWrite
+
+		start := time.Now()
+		w.statusCode, w.err = t.clients[writer].WriteSeries(ctx, generateConflictingSeries(timestamp, t.cfg.NumSeries, conflictingWriterValue(timestamp, writer)))
+		t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+		t.trackWrite(w)
+		return w
+	}
+
+	writes[0] = write(0)
+	retry = write(0)
+	writes[1] = write(1)
+	return writes, retry
+}
+
+func (t *ConflictingWritesTest) trackWrite(w conflictingWrite) {
+	t.metrics.writesTotal.Inc()
+	if !w.accepted() {
+		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(w.statusCode)).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+	} else {
+		t.metrics.observeSuccess(outcomeTypeWrite)
+	}
+}
+
+// verifySequentialWrites checks whether the outcome of the sequential writes matches the documented behavior:
+// the first write and its retry are accepted, while the second writer's write is rejected as a duplicate sample.
+// Both writes being accepted is checked by the caller.
+func (t *ConflictingWritesTest) verifySequentialWrites(logger log.Logger, writes [2]conflictingWrite, retry conflictingWrite) error {
+	errs := multierror.New()
+
+	if !writes[0].accepted() {
+		t.deviationsTotal.WithLabelValues(conflictingWritesReasonUnexpectedError).Inc()
+		level.Warn(logger).Log("msg", "The first write request has been rejected, while no conflicting sample has been written before", "status_code", writes[0].statusCode, "err", writes[0].err)
+		errs.Add(errors.Errorf("the first write request has been rejected with status code %d, while no conflicting sample has been written before (error: %v)", writes[0].statusCode, writes[0].err))
+	}
+
+	if !retry.accepted() {
+		t.deviationsTotal.WithLabelValues(conflictingWritesReasonRetryRejected).Inc()
+		level.Warn(logger).Log("msg", "The retry of the first write request has been rejected, while samples with the same timestamp and value are expected to be deduplicated", "status_code", retry.statusCode, "err", retry.err)
+		errs.Add(errors.Errorf("the retry of the first write request has been rejected with status code %d (error: %v)", retry.statusCode, retry.err))
+	}
+
+	if writes[1].rejected() && !isWriteRejectedWithErrorID(writes[1].statusCode, writes[1].err, http.StatusBadRequest, globalerror.SampleDuplicateTimestamp) {
+		t.deviationsTotal.WithLabelValues(conflictingWritesReasonUnexpectedError).Inc()
+		level.Warn(logger).Log("msg", "The second write request has been rejected with an unexpected error", "expected_error_id", mimirErrorIDPrefix+string(globalerror.SampleDuplicateTimestamp), "err", writes[1].err)
+		errs.Add(errors.Errorf("the second write request has been rejected without the %s%s error (error: %v)", mimirErrorIDPrefix, globalerror.SampleDuplicateTimestamp, writes[1].err))
+	}
+
+	return errs.Err()
+}
+
+// verifyWrittenValues queries the written series and checks whether each series has the value written by one
+// of the two writers. If a write request has been accepted, then all series are expected to have its value.
+func (t *ConflictingWritesTest) verifyWrittenValues(ctx context.Context, logger log.Logger, timestamp time.Time, writes [2]conflictingWrite) error {
+	t.metrics.queriesTotal.Inc()
+	start := time.Now()
+	vector, err := t.clients[0].Query(ctx, conflictingWritesQuery, timestamp, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute instant query", "err", err)
+		return errors.Wrap(err, "failed to execute instant query")
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	// The accepted writer, if any. If both writes have been accepted, we can't tell which value should be returned.
+	winner := -1
+	if writes[0].accepted() != writes[1].accepted() {
+		winner = 0
+		if writes[1].accepted() {
+			winner = 1
+		}
+	}
+
+	t.metrics.queryResultChecksTotal.Inc()
+	reason, err := verifyConflictingWritesValues(vector, timestamp, t.cfg.NumSeries, winner)
+	if err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		t.deviationsTotal.WithLabelValues(reason).Inc()
+		level.Warn(logger).Log("msg", "Conflicting writes query result check failed", "reason", reason, "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: conflictingWritesQuery, Start: timestamp, End: timestamp, Error: err.Error()})
+		return errors.Wrap(err, "conflicting writes query result check failed")
+	}
+
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+	return nil
+}
+
+// verifyConflictingWritesValues checks whether the input vector contains numSeries series, and whether each series
+// has the value written by one of the two writers. If winner is not -1, then all series are expected to have the
+// value written by the winner writer. Returns the deviation reason and an error if the check failed.
+func verifyConflictingWritesValues(vector model.Vector, timestamp time.Time, numSeries, winner int) (string, error) {
+	if len(vector) != numSeries {
+		return conflictingWritesReasonMissingSeries, fmt.Errorf("expected %d series in the result but got %d", numSeries, len(vector))
+	}
+
+	for _, sample := range vector {
+		value := float64(sample.Value)
+
+		switch {
+		case winner >= 0 && compareSampleValues(value, conflictingWriterValue(timestamp, winner)):
+			continue
+		case winner >= 0 && compareSampleValues(value, conflictingWriterValue(timestamp, 1-winner)):
+			return conflictingWritesReasonLoserValue, fmt.Errorf("series %s has the value %f written by the rejected writer", sample.Metric.String(), value)
+		case winner < 0 && (compareSampleValues(value, conflictingWriterValue(timestamp, 0)) || compareSampleValues(value, conflictingWriterValue(timestamp, 1))):
+			continue
+		default:
+			return conflictingWritesReasonUnexpectedValue, fmt.Errorf("series %s has the value %f which has not been written by any writer", sample.Metric.String(), value)
+		}
+	}
+
+	return "", nil
+}
+
+// conflictingWriterValue returns the value written at the input timestamp by the input writer.
+func conflictingWriterValue(timestamp time.Time, writer int) float64 {
+	return generateSineWaveValue(timestamp) + float64(writer*conflictingWritesValueDelta)
+}
+
+func generateConflictingSeries(timestamp time.Time, numSeries int, value float64) []prompb.TimeSeries {
+	series := generateSineWaveSeries(conflictingWritesMetricName, timestamp, numSeries)
+	for i := range series {
+		series[i].Samples[0].Value = value
+	}
+	return series
+}
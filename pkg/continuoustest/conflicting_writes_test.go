@@ -0,0 +1,245 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConflictingWritesTest_Run(t *testing.T) {
+	logger := log.NewNopLogger()
+	cfg := ConflictingWritesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+
+	now := time.Unix(1000, 0)
+
+	// queryResult returns the query result where each series has the value written by the input writer.
+	queryResult := func(writers ...int) model.Vector {
+		vector := model.Vector{}
+		for i, writer := range writers {
+			vector = append(vector, &model.Sample{
+				Metric:    model.Metric{"series_id": model.LabelValue(rune('0' + i))},
+				Value:     model.SampleValue(conflictingWriterValue(now, writer)),
+				Timestamp: model.Time(now.UnixMilli()),
+			})
+		}
+		return vector
+	}
+
+	tests := map[string]struct {
+		firstStatusCode    int
+		firstErr           error
+		secondStatusCode   int
+		queryResult        model.Vector
+		expectedErr        bool
+		expectedDeviations map[string]int
+	}{
+		"first writer wins": {
+			firstStatusCode:  200,
+			secondStatusCode: 400,
+			queryResult:      queryResult(0, 0),
+		},
+		"second writer wins": {
+			firstStatusCode:  400,
+			secondStatusCode: 200,
+			queryResult:      queryResult(1, 1),
+		},
+		"both writers partially rejected": {
+			firstStatusCode:  400,
+			secondStatusCode: 400,
+			queryResult:      queryResult(0, 1),
+		},
+		"both writers accepted": {
+			firstStatusCode:    200,
+			secondStatusCode:   200,
+			queryResult:        queryResult(0, 1),
+			expectedErr:        true,
+			expectedDeviations: map[string]int{conflictingWritesReasonBothAccepted: 1},
+		},
+		"query returns the value of the rejected writer": {
+			firstStatusCode:    200,
+			secondStatusCode:   400,
+			queryResult:        queryResult(0, 1),
+			expectedErr:        true,
+			expectedDeviations: map[string]int{conflictingWritesReasonLoserValue: 1},
+		},
+		"query returns a value not written by any writer": {
+			firstStatusCode:    200,
+			secondStatusCode:   400,
+			queryResult:        queryResult(0, 5),
+			expectedErr:        true,
+			expectedDeviations: map[string]int{conflictingWritesReasonUnexpectedValue: 1},
+		},
+		"query doesn't return all series": {
+			firstStatusCode:    200,
+			secondStatusCode:   400,
+			queryResult:        queryResult(0),
+			expectedErr:        true,
+			expectedDeviations: map[string]int{conflictingWritesReasonMissingSeries: 1},
+		},
+		"a writer failed with an unexpected error": {
+			firstStatusCode:  500,
+			firstErr:         errors.New("failed"),
+			secondStatusCode: 200,
+			expectedErr:      true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			first, second := &ClientMock{}, &ClientMock{}
+			first.On("WriteSeries", mock.Anything, mock.Anything).Return(tc.firstStatusCode, tc.firstErr)
+			first.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(tc.queryResult, nil)
+			second.On("WriteSeries", mock.Anything, mock.Anything).Return(tc.secondStatusCode, nil)
+
+			reg := prometheus.NewPedanticRegistry()
+			test := NewConflictingWritesTest(cfg, first, second, logger, reg)
+
+			err := test.Run(context.Background(), now)
+			if tc.expectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			// Both writers write the same series and timestamp, with different values.
+			first.AssertCalled(t, "WriteSeries", mock.Anything, generateConflictingSeries(now, 2, conflictingWriterValue(now, 0)))
+			second.AssertCalled(t, "WriteSeries", mock.Anything, generateConflictingSeries(now, 2, conflictingWriterValue(now, 1)))
+
+			for _, reason := range conflictingWritesReasons {
+				assert.Equal(t, float64(tc.expectedDeviations[reason]), testutil.ToFloat64(test.deviationsTotal.WithLabelValues(reason)), reason)
+			}
+		})
+	}
+
+	t.Run("should write at most once per write interval", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil).Once()
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(400, nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewConflictingWritesTest(cfg, client, client, logger, reg)
+
+		// Ignore the errors. They will be non-nil because the query mock does not return any data.
+		_ = test.Run(context.Background(), now)
+		_ = test.Run(context.Background(), now.Add(writeInterval/2))
+		client.AssertNumberOfCalls(t, "WriteSeries", 2)
+
+		_ = test.Run(context.Background(), now.Add(writeInterval))
+		client.AssertNumberOfCalls(t, "WriteSeries", 4)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_writes_total Total number of attempted write requests.
+			# TYPE mimir_continuous_test_writes_total counter
+			mimir_continuous_test_writes_total{test="conflicting-writes"} 4
+
+			# HELP mimir_continuous_test_writes_failed_total Total number of failed write requests.
+			# TYPE mimir_continuous_test_writes_failed_total counter
+			mimir_continuous_test_writes_failed_total{maintenance="false",status_code="400",test="conflicting-writes"} 3
+		`), "mimir_continuous_test_writes_total", "mimir_continuous_test_writes_failed_total"))
+	})
+}
+
+func TestConflictingWritesTest_Run_Sequential(t *testing.T) {
+	logger := log.NewNopLogger()
+	cfg := ConflictingWritesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+	cfg.Sequential = true
+
+	now := time.Unix(1000, 0)
+	firstSeries := generateConflictingSeries(now, 2, conflictingWriterValue(now, 0))
+	secondSeries := generateConflictingSeries(now, 2, conflictingWriterValue(now, 1))
+
+	queryResult := model.Vector{}
+	for i := 0; i < 2; i++ {
+		queryResult = append(queryResult, &model.Sample{
+			Metric:    model.Metric{"series_id": model.LabelValue(rune('0' + i))},
+			Value:     model.SampleValue(conflictingWriterValue(now, 0)),
+			Timestamp: model.Time(now.UnixMilli()),
+		})
+	}
+
+	duplicateTimestampErr := errors.New(`server returned HTTP status 400 Bad Request: failed pushing to ingester: user=anonymous: the sample has been rejected because another sample with the same timestamp, but a different value, has already been ingested (err-mimir-sample-duplicate-timestamp)`)
+
+	tests := map[string]struct {
+		firstStatusCode    int
+		retryStatusCode    int
+		secondStatusCode   int
+		secondErr          error
+		expectedErr        bool
+		expectedDeviations map[string]int
+	}{
+		"second write rejected as duplicate sample": {
+			firstStatusCode:  200,
+			retryStatusCode:  200,
+			secondStatusCode: 400,
+			secondErr:        duplicateTimestampErr,
+		},
+		"retry of the first write rejected": {
+			firstStatusCode:    200,
+			retryStatusCode:    400,
+			secondStatusCode:   400,
+			secondErr:          duplicateTimestampErr,
+			expectedErr:        true,
+			expectedDeviations: map[string]int{conflictingWritesReasonRetryRejected: 1},
+		},
+		"second write rejected with an unexpected error": {
+			firstStatusCode:    200,
+			retryStatusCode:    200,
+			secondStatusCode:   400,
+			secondErr:          errors.New("server returned HTTP status 400 Bad Request: out of bounds (err-mimir-sample-out-of-bounds)"),
+			expectedErr:        true,
+			expectedDeviations: map[string]int{conflictingWritesReasonUnexpectedError: 1},
+		},
+		"second write accepted": {
+			firstStatusCode:    200,
+			retryStatusCode:    200,
+			secondStatusCode:   200,
+			expectedErr:        true,
+			expectedDeviations: map[string]int{conflictingWritesReasonBothAccepted: 1},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			first, second := &ClientMock{}, &ClientMock{}
+			first.On("WriteSeries", mock.Anything, firstSeries).Return(tc.firstStatusCode, nil).Once()
+			first.On("WriteSeries", mock.Anything, firstSeries).Return(tc.retryStatusCode, nil).Once()
+			first.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(queryResult, nil)
+			second.On("WriteSeries", mock.Anything, secondSeries).Return(tc.secondStatusCode, tc.secondErr)
+
+			test := NewConflictingWritesTest(cfg, first, second, logger, prometheus.NewPedanticRegistry())
+
+			err := test.Run(context.Background(), now)
+			if tc.expectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			// The first writer writes twice, then the second writer writes once.
+			first.AssertNumberOfCalls(t, "WriteSeries", 2)
+			second.AssertNumberOfCalls(t, "WriteSeries", 1)
+
+			for _, reason := range conflictingWritesReasons {
+				assert.Equal(t, float64(tc.expectedDeviations[reason]), testutil.ToFloat64(test.deviationsTotal.WithLabelValues(reason)), reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/dskit/multierror"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	// deepVerificationChunkRange is the time range of each range query run by the deep verification. The queries
+	// are run with a step equal to the write interval, so each of them returns at most 720 samples.
+	deepVerificationChunkRange = 4 * time.Hour
+
+	// deepVerificationMaxReportedTimestamps is the max number of invalid samples timestamps reported by each failed
+	// deep verification result check.
+	deepVerificationMaxReportedTimestamps = 10
+)
+
+// DeepVerificationConfig configures the scheduled audits of the whole time range of the samples written by the
+// write-read series test.
+type DeepVerificationConfig struct {
+	DeepVerificationInterval time.Duration
+}
+
+func (cfg *DeepVerificationConfig) RegisterFlags(f *flag.FlagSet) {
+	f.DurationVar(&cfg.DeepVerificationInterval, "tests.write-read-series-test.deep-verification-interval", 0, "How frequently the whole time range of the written samples, up to -tests.write-read-series-test.max-query-age, is audited sample-by-sample at the write interval resolution, with range queries over consecutive chunks of the time range. The audits run at the first test run after each multiple of the interval, for example after midnight UTC with 24h. 0 to disable.")
+}
+
+func (cfg *DeepVerificationConfig) Validate() error {
+	if cfg.DeepVerificationInterval < 0 {
+		return errors.New("the deep verification interval must be greater than or equal to 0")
+	}
+	return nil
+}
+
+// isDeepVerificationDue returns whether the deep verification is due at the input time, and if so schedules the
+// next one after the next multiple of the deep verification interval. The first deep verification after startup
+// is scheduled too, so that restarts of the tool don't cause additional deep verifications.
+func (t *WriteReadSeriesTest) isDeepVerificationDue(now time.Time) bool {
+	due := !t.nextDeepVerification.IsZero() && !now.Before(t.nextDeepVerification)
+	if due || t.nextDeepVerification.IsZero() {
+		t.nextDeepVerification = alignTimestampToInterval(now, t.cfg.DeepVerificationInterval).Add(t.cfg.DeepVerificationInterval)
+	}
+	return due
+}
+
+// runDeepVerification audits the whole time range of the written samples, honoring the max query age, at the write
+// interval resolution. The time range is queried in consecutive chunks, and every expected sample is checked. The
+// integrity score of each day is the fraction of its samples found as expected. The score is not tracked for the
+// days whose samples could not be queried.
+func (t *WriteReadSeriesTest) runDeepVerification(ctx context.Context, now time.Time, responseFormat string) error {
+	if t.queryMinTime.IsZero() || t.queryMaxTime.IsZero() {
+		level.Info(t.logger).Log("msg", "Skipped deep verification because there's no valid time range to query")
+		return nil
+	}
+	start := maxTime(t.queryMinTime, alignTimestampToInterval(now.Add(-t.cfg.MaxQueryAge), writeInterval))
+	end := t.queryMaxTime
+	if end.Before(start) {
+		level.Info(t.logger).Log("msg", "Skipped deep verification because there's no valid time range to query after honoring configured max query age")
+		return nil
+	}
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "WriteReadSeriesTest.runDeepVerification")
+	defer sp.Finish()
+	level.Info(sp).Log("msg", "Running deep verification", "start", start, "end", end)
+
+	type dayScore struct {
+		checked, valid int
+		incomplete     bool
+	}
+	days := map[int]*dayScore{}
+	dayOf := func(ts time.Time) *dayScore {
+		daysAgo := int(now.Sub(ts) / (24 * time.Hour))
+		if days[daysAgo] == nil {
+			days[daysAgo] = &dayScore{}
+		}
+		return days[daysAgo]
+	}
+
+	errs := multierror.New()
+	for chunkStart := start; !chunkStart.After(end); chunkStart = chunkStart.Add(deepVerificationChunkRange) {
+		chunkEnd := minTime(chunkStart.Add(deepVerificationChunkRange-writeInterval), end)
+
+		queried, err := t.runDeepVerificationQuery(ctx, sp, chunkStart, chunkEnd, responseFormat, func(ts time.Time, valid bool) {
+			day := dayOf(ts)
+			day.checked++
+			if valid {
+				day.valid++
+			}
+		})
+		if !queried {
+			for ts := chunkStart; !ts.After(chunkEnd); ts = ts.Add(writeInterval) {
+				dayOf(ts).incomplete = true
+			}
+		}
+		errs.Add(err)
+	}
+
+	// The scores of the previous deep verification are removed, so that no stale score is exported.
+	t.deepVerificationIntegrityScore.Reset()
+	for daysAgo, day := range days {
+		if day.incomplete || day.checked == 0 {
+			continue
+		}
+		t.deepVerificationIntegrityScore.WithLabelValues(strconv.Itoa(daysAgo)).Set(float64(day.valid) / float64(day.checked))
+	}
+	t.deepVerificationLastRun.Set(float64(now.Unix()))
+
+	level.Info(sp).Log("msg", "Deep verification completed", "failed", errs.Err() != nil)
+	return errs.Err()
+}
+
+// runDeepVerificationQuery runs a range query from start to end with a step equal to the write interval, and checks
+// every interval-aligned timestamp of the result. The input record function is called for each checked timestamp.
+// Returns whether the query succeeded, even if the result check failed.
+func (t *WriteReadSeriesTest) runDeepVerificationQuery(ctx context.Context, logger log.Logger, start, end time.Time, responseFormat string, record func(ts time.Time, valid bool)) (bool, error) {
+	logger = log.With(logger, "query", t.querySum, "start", start.UnixMilli(), "end", end.UnixMilli(), "step", writeInterval, "response_format", responseFormat)
+	level.Debug(logger).Log("msg", "Running deep verification range query")
+
+	t.metrics.queriesTotal.Inc()
+	queryStart := time.Now()
+	matrix, err := t.client.QueryRange(ctx, t.querySum, start, end, writeInterval, WithResultsCacheEnabled(false), WithResponseFormat(responseFormat))
+	t.metrics.observeQueryDuration(queryTypeRange, false, queryStart)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute deep verification range query", "err", err)
+		return false, errors.Wrap(err, "failed to execute deep verification range query")
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	t.metrics.queryResultChecksTotal.Inc()
+	err = t.verifyEverySample(matrix, start, end, record)
+	recordQueryResultCheck(ctx, end, err)
+	if err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Deep verification range query result check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: t.querySum, Start: start, End: end, Step: writeInterval.String(), Error: err.Error()})
+		return true, errors.Wrap(err, "deep verification range query result check failed")
+	}
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+	return true, nil
+}
+
+// verifyEverySample checks the sample at every interval-aligned timestamp from start to end of the input matrix,
+// which is expected to be the result of a range query with a step equal to the write interval. A sample is valid
+// if it has the expected value, or if it's missing because it has been deliberately skipped because of gap injection.
+// The input record function is called for each checked timestamp.
+func (t *WriteReadSeriesTest) verifyEverySample(matrix model.Matrix, start, end time.Time, record func(ts time.Time, valid bool)) error {
+	if len(matrix) > 1 {
+		for ts := start; !ts.After(end); ts = ts.Add(writeInterval) {
+			record(ts, false)
+		}
+		return fmt.Errorf("expected at most 1 series in the result but got %d", len(matrix))
+	}
+
+	actual := map[model.Time]float64{}
+	if len(matrix) == 1 {
+		for _, sample := range matrix[0].Values {
+			actual[sample.Timestamp] = float64(sample.Value)
+		}
+	}
+
+	var (
+		checked int
+		invalid []model.Time
+	)
+	for ts := start; !ts.After(end); ts = ts.Add(writeInterval) {
+		value, ok := actual[model.TimeFromUnixNano(ts.UnixNano())]
+
+		var valid bool
+		if t.isGap(ts) {
+			valid = !ok
+		} else {
+			valid = ok && compareSampleValues(value, t.sumWaveform(ts))
+		}
+
+		checked++
+		record(ts, valid)
+		if !valid {
+			invalid = append(invalid, model.TimeFromUnixNano(ts.UnixNano()))
+		}
+	}
+
+	if len(invalid) == 0 {
+		return nil
+	}
+	reported := invalid
+	if len(reported) > deepVerificationMaxReportedTimestamps {
+		reported = reported[:deepVerificationMaxReportedTimestamps]
+	}
+	return fmt.Errorf("%d out of %d samples are missing or have an unexpected value (first invalid samples timestamps: %s)", len(invalid), checked, formatTimestamps(reported))
+}
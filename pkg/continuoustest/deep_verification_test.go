@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeepVerificationConfig_Validate(t *testing.T) {
+	cfg := DeepVerificationConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.DeepVerificationInterval = 24 * time.Hour
+	assert.NoError(t, cfg.Validate())
+
+	cfg.DeepVerificationInterval = -time.Hour
+	assert.Error(t, cfg.Validate())
+}
+
+func TestWriteReadSeriesTest_isDeepVerificationDue(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.DeepVerificationInterval = 24 * time.Hour
+
+	test := NewWriteReadSeriesTest(cfg, &ClientMock{}, log.NewNopLogger(), nil)
+	day := time.Date(2022, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	// The first deep verification is scheduled after the next midnight.
+	assert.False(t, test.isDeepVerificationDue(day.Add(10*time.Hour)))
+	assert.False(t, test.isDeepVerificationDue(day.Add(23*time.Hour+59*time.Minute)))
+	assert.True(t, test.isDeepVerificationDue(day.Add(24*time.Hour+5*time.Minute)))
+	assert.False(t, test.isDeepVerificationDue(day.Add(24*time.Hour+10*time.Minute)))
+	assert.True(t, test.isDeepVerificationDue(day.Add(72*time.Hour)))
+	assert.Equal(t, day.Add(96*time.Hour), test.nextDeepVerification)
+}
+
+func TestWriteReadSeriesTest_runDeepVerification(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+	cfg.DeepVerificationInterval = 24 * time.Hour
+
+	now := time.Date(2022, 1, 10, 0, 0, 0, 0, time.UTC)
+	start := now.Add(-30 * time.Hour)
+
+	t.Run("should track the integrity score of each day", func(t *testing.T) {
+		// The missing sample was written 1 day ago.
+		missing := now.Add(-26 * time.Hour)
+		client := &missingSampleClient{numSeries: cfg.NumSeries, missing: missing}
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewWriteReadSeriesTest(cfg, client, log.NewNopLogger(), reg)
+		test.queryMinTime = start
+		test.queryMaxTime = now
+
+		err := test.runDeepVerification(context.Background(), now, responseFormatJSON)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "1 out of 720 samples are missing or have an unexpected value (first invalid samples timestamps: "+strconv.FormatInt(missing.UnixMilli(), 10)+")")
+
+		// The time range is queried in consecutive chunks, at the write interval resolution.
+		client.AssertNumberOfCalls(t, "QueryRange", 8)
+		client.AssertCalled(t, "QueryRange", mock.Anything, queryMetricSum, start, start.Add(deepVerificationChunkRange-writeInterval), writeInterval, mock.Anything)
+		client.AssertCalled(t, "QueryRange", mock.Anything, queryMetricSum, now.Add(-2*time.Hour), now, writeInterval, mock.Anything)
+
+		// The day 1 starts 30h ago and ends 24h ago, both included.
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.deepVerificationIntegrityScore.WithLabelValues("0")))
+		assert.Equal(t, 1080.0/1081.0, testutil.ToFloat64(test.deepVerificationIntegrityScore.WithLabelValues("1")))
+		assert.Equal(t, float64(now.Unix()), testutil.ToFloat64(test.deepVerificationLastRun))
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.metrics.queryResultChecksFailedTotal))
+	})
+
+	t.Run("should not track the integrity score of the days whose samples could not be queried", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("QueryRange", mock.Anything, mock.Anything, start, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix(nil), errors.New("failed"))
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix(nil), nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewWriteReadSeriesTest(cfg, client, log.NewNopLogger(), reg)
+		test.queryMinTime = start
+		test.queryMaxTime = now
+
+		// A stale score is removed.
+		test.deepVerificationIntegrityScore.WithLabelValues("5").Set(1)
+
+		err := test.runDeepVerification(context.Background(), now, responseFormatJSON)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to execute deep verification range query")
+		assert.Contains(t, err.Error(), "deep verification range query result check failed")
+
+		// All the samples of the queried chunks are missing, and the day 1 is only partially queried.
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_deep_verification_integrity_score Fraction of the samples checked by the last deep verification which were found as expected, by number of days since the samples have been written.
+			# TYPE mimir_continuous_test_deep_verification_integrity_score gauge
+			mimir_continuous_test_deep_verification_integrity_score{days_ago="0",test="write-read-series"} 0
+		`), "mimir_continuous_test_deep_verification_integrity_score"))
+	})
+
+	t.Run("should honor the max query age", func(t *testing.T) {
+		cfg := cfg
+		cfg.MaxQueryAge = 3 * time.Hour
+
+		client := &missingSampleClient{numSeries: cfg.NumSeries}
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+		test := NewWriteReadSeriesTest(cfg, client, log.NewNopLogger(), nil)
+		test.queryMinTime = start
+		test.queryMaxTime = now
+
+		require.NoError(t, test.runDeepVerification(context.Background(), now, responseFormatJSON))
+		client.AssertNumberOfCalls(t, "QueryRange", 1)
+		client.AssertCalled(t, "QueryRange", mock.Anything, queryMetricSum, now.Add(-3*time.Hour), now, writeInterval, mock.Anything)
+	})
+}
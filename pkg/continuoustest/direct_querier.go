@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	readPathQueryFrontend = "query-frontend"
+	readPathQuerier       = "querier"
+)
+
+type DirectQuerierConfig struct {
+	ReadBaseEndpoint flagext.URLValue
+}
+
+func (cfg *DirectQuerierConfig) RegisterFlags(f *flag.FlagSet) {
+	f.Var(&cfg.ReadBaseEndpoint, "tests.direct-querier-read-endpoint", "The base endpoint of the querier API, bypassing the query-frontend. When set, each query run by the tests is run through both the read endpoint and the querier, and the results and latencies are compared, to find out whether failures originate in the query-frontend middlewares, such as splitting, caching and sharding, or in the underlying read path. The URL should have no trailing slash.")
+}
+
+// Enabled returns whether the queries are compared with the ones run directly against the querier.
+func (cfg *DirectQuerierConfig) Enabled() bool {
+	return cfg.ReadBaseEndpoint.URL != nil
+}
+
+// DirectQuerierClient is a MimirClient running each query through both the query-frontend and the
+// querier, and comparing the results and latencies of the two read paths. The query-frontend is the
+// reference: its responses are returned to the tests, while the outcome of the direct querier queries
+// is only logged and tracked by metrics.
+type DirectQuerierClient struct {
+	MimirClient
+
+	querier MimirClient
+	logger  log.Logger
+
+	queryDuration      *prometheus.HistogramVec
+	queriesFailedTotal *prometheus.CounterVec
+	comparisonsTotal   *prometheus.CounterVec
+	mismatchesTotal    *prometheus.CounterVec
+}
+
+func NewDirectQuerierClient(frontend, querier MimirClient, logger log.Logger, reg prometheus.Registerer) *DirectQuerierClient {
+	return &DirectQuerierClient{
+		MimirClient: frontend,
+		querier:     querier,
+		logger:      log.With(logger, "component", "direct-querier-client"),
+		queryDuration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mimir_continuous_test_direct_querier_query_duration_seconds",
+			Help:    "Duration of the queries compared between the query-frontend and the querier, by read path.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+		}, []string{"read_path"}),
+		queriesFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "mimir_continuous_test_direct_querier_queries_failed_total",
+			Help: "Total number of failed queries compared between the query-frontend and the querier, by read path.",
+		}, []string{"read_path"}),
+		comparisonsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "mimir_continuous_test_direct_querier_comparisons_total",
+			Help: "Total number of query results compared between the query-frontend and the querier.",
+		}, []string{"query"}),
+		mismatchesTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "mimir_continuous_test_direct_querier_mismatches_total",
+			Help: "Total number of query results which didn't match when comparing the results of the same query run through the query-frontend and the querier.",
+		}, []string{"query"}),
+	}
+}
+
+// QueryRange implements MimirClient.
+func (c *DirectQuerierClient) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration, options ...RequestOption) (model.Matrix, error) {
+	frontendStart := time.Now()
+	matrix, err := c.MimirClient.QueryRange(ctx, query, start, end, step, options...)
+	frontendDuration := time.Since(frontendStart)
+
+	querierStart := time.Now()
+	querierMatrix, querierErr := c.querier.QueryRange(ctx, query, start, end, step, querierOptions(options)...)
+	querierDuration := time.Since(querierStart)
+
+	c.compare(query, matrix, querierMatrix, err, querierErr, frontendDuration, querierDuration, "start", start.UnixMilli(), "end", end.UnixMilli(), "step", step)
+	return matrix, err
+}
+
+// Query implements MimirClient.
+func (c *DirectQuerierClient) Query(ctx context.Context, query string, ts time.Time, options ...RequestOption) (model.Vector, error) {
+	frontendStart := time.Now()
+	vector, err := c.MimirClient.Query(ctx, query, ts, options...)
+	frontendDuration := time.Since(frontendStart)
+
+	querierStart := time.Now()
+	querierVector, querierErr := c.querier.Query(ctx, query, ts, querierOptions(options)...)
+	querierDuration := time.Since(querierStart)
+
+	c.compare(query, vectorToMatrix(vector), vectorToMatrix(querierVector), err, querierErr, frontendDuration, querierDuration, "ts", ts.UnixMilli())
+	return vector, err
+}
+
+// querierOptions returns the request options to use to query the querier. The query statistics are always the
+// ones returned by the query-frontend.
+func querierOptions(options []RequestOption) []RequestOption {
+	return append(append([]RequestOption{}, options...), WithQueryStats(nil))
+}
+
+// compare compares the outcome of the same query run through the query-frontend and the querier. When only
+// one of the read paths fails, the failure is logged along with the read path it originates from.
+func (c *DirectQuerierClient) compare(query string, frontend, querier model.Matrix, frontendErr, querierErr error, frontendDuration, querierDuration time.Duration, logKeyvals ...interface{}) {
+	c.queryDuration.WithLabelValues(readPathQueryFrontend).Observe(frontendDuration.Seconds())
+	c.queryDuration.WithLabelValues(readPathQuerier).Observe(querierDuration.Seconds())
+
+	if frontendErr != nil {
+		c.queriesFailedTotal.WithLabelValues(readPathQueryFrontend).Inc()
+	}
+	if querierErr != nil {
+		c.queriesFailedTotal.WithLabelValues(readPathQuerier).Inc()
+	}
+
+	warn := func(msg string, extraKeyvals ...interface{}) {
+		keyvals := []interface{}{"msg", msg, "query", query}
+		keyvals = append(keyvals, logKeyvals...)
+		keyvals = append(keyvals, "frontend_duration", frontendDuration, "querier_duration", querierDuration)
+		keyvals = append(keyvals, extraKeyvals...)
+		level.Warn(c.logger).Log(keyvals...)
+	}
+
+	switch {
+	case frontendErr != nil && querierErr != nil:
+		warn("Query failed through both the query-frontend and the querier", "frontend_err", frontendErr, "querier_err", querierErr)
+		return
+	case frontendErr != nil:
+		warn("Query failed through the query-frontend but succeeded through the querier", "failed_read_path", readPathQueryFrontend, "err", frontendErr)
+		return
+	case querierErr != nil:
+		warn("Query failed through the querier but succeeded through the query-frontend", "failed_read_path", readPathQuerier, "err", querierErr)
+		return
+	}
+
+	c.comparisonsTotal.WithLabelValues(query).Inc()
+
+	frontend, querier = sortedMatrix(frontend), sortedMatrix(querier)
+	if err := compareMatrices(querier, frontend); err != nil {
+		c.mismatchesTotal.WithLabelValues(query).Inc()
+
+		warn("Query result mismatch between the query-frontend and the querier",
+			"frontend_series", len(frontend),
+			"querier_series", len(querier),
+			"mismatching_timestamps", formatTimestamps(findMismatchingTimestamps(querier, frontend)),
+			"err", err)
+	}
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectQuerierClient(t *testing.T) {
+	const query = "sum(series)"
+	now := time.Unix(1000, 0)
+
+	t.Run("should compare query results between the query-frontend and the querier and track mismatches", func(t *testing.T) {
+		frontend, querier := &ClientMock{}, &ClientMock{}
+		frontend.On("QueryRange", mock.Anything, query, now, now, writeInterval, mock.Anything).Return(model.Matrix{
+			{Values: []model.SamplePair{newSamplePair(now, 1)}},
+		}, nil)
+		querier.On("QueryRange", mock.Anything, query, now, now, writeInterval, mock.Anything).Return(model.Matrix{
+			{Values: []model.SamplePair{newSamplePair(now, 2)}},
+		}, nil)
+		frontend.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{
+			{Metric: model.Metric{"series": "1"}, Timestamp: model.Time(now.UnixMilli()), Value: 1},
+			{Metric: model.Metric{"series": "2"}, Timestamp: model.Time(now.UnixMilli()), Value: 2},
+		}, nil)
+		// The series order doesn't matter.
+		querier.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{
+			{Metric: model.Metric{"series": "2"}, Timestamp: model.Time(now.UnixMilli()), Value: 2},
+			{Metric: model.Metric{"series": "1"}, Timestamp: model.Time(now.UnixMilli()), Value: 1},
+		}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		c := NewDirectQuerierClient(frontend, querier, log.NewNopLogger(), reg)
+
+		matrix, err := c.QueryRange(context.Background(), query, now, now, writeInterval)
+		require.NoError(t, err)
+		assert.Equal(t, model.SampleValue(1), matrix[0].Values[0].Value)
+
+		vector, err := c.Query(context.Background(), query, now)
+		require.NoError(t, err)
+		assert.Equal(t, model.LabelValue("1"), vector[0].Metric["series"])
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_direct_querier_comparisons_total Total number of query results compared between the query-frontend and the querier.
+			# TYPE mimir_continuous_test_direct_querier_comparisons_total counter
+			mimir_continuous_test_direct_querier_comparisons_total{query="sum(series)"} 2
+
+			# HELP mimir_continuous_test_direct_querier_mismatches_total Total number of query results which didn't match when comparing the results of the same query run through the query-frontend and the querier.
+			# TYPE mimir_continuous_test_direct_querier_mismatches_total counter
+			mimir_continuous_test_direct_querier_mismatches_total{query="sum(series)"} 1
+		`), "mimir_continuous_test_direct_querier_comparisons_total", "mimir_continuous_test_direct_querier_mismatches_total"))
+
+		assert.Equal(t, 2, testutil.CollectAndCount(c.queryDuration))
+	})
+
+	t.Run("should query the querier and track the failed read path if the query-frontend query failed", func(t *testing.T) {
+		frontend, querier := &ClientMock{}, &ClientMock{}
+		frontend.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{}, errors.New("failed"))
+		querier.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		c := NewDirectQuerierClient(frontend, querier, log.NewNopLogger(), reg)
+
+		_, err := c.Query(context.Background(), query, now)
+		require.Error(t, err)
+		querier.AssertNumberOfCalls(t, "Query", 1)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_direct_querier_queries_failed_total Total number of failed queries compared between the query-frontend and the querier, by read path.
+			# TYPE mimir_continuous_test_direct_querier_queries_failed_total counter
+			mimir_continuous_test_direct_querier_queries_failed_total{read_path="query-frontend"} 1
+		`), "mimir_continuous_test_direct_querier_queries_failed_total", "mimir_continuous_test_direct_querier_comparisons_total"))
+	})
+
+	t.Run("should return the query-frontend result if the querier query failed", func(t *testing.T) {
+		frontend, querier := &ClientMock{}, &ClientMock{}
+		frontend.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+		querier.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{}, errors.New("failed"))
+
+		reg := prometheus.NewPedanticRegistry()
+		c := NewDirectQuerierClient(frontend, querier, log.NewNopLogger(), reg)
+
+		vector, err := c.Query(context.Background(), query, now)
+		require.NoError(t, err)
+		assert.Equal(t, model.Vector{{Value: 1}}, vector)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_direct_querier_queries_failed_total Total number of failed queries compared between the query-frontend and the querier, by read path.
+			# TYPE mimir_continuous_test_direct_querier_queries_failed_total counter
+			mimir_continuous_test_direct_querier_queries_failed_total{read_path="querier"} 1
+		`), "mimir_continuous_test_direct_querier_queries_failed_total", "mimir_continuous_test_direct_querier_comparisons_total"))
+	})
+}
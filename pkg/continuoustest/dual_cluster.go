@@ -0,0 +1,264 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/flagext"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+const (
+	SecondaryBackendMimir      = "mimir"
+	SecondaryBackendPrometheus = "prometheus"
+
+	// prometheusRemoteWritePath is the path of the Prometheus remote write receiver API.
+	prometheusRemoteWritePath = "/api/v1/write"
+)
+
+var supportedSecondaryBackends = []string{SecondaryBackendMimir, SecondaryBackendPrometheus}
+
+type DualClusterConfig struct {
+	SecondaryWriteBaseEndpoint flagext.URLValue
+	SecondaryReadBaseEndpoint  flagext.URLValue
+	SecondaryBackend           string
+}
+
+func (cfg *DualClusterConfig) RegisterFlags(f *flag.FlagSet) {
+	f.Var(&cfg.SecondaryWriteBaseEndpoint, "tests.secondary-write-endpoint", "The base endpoint on the write path of a secondary Mimir cluster. When both the secondary write and read endpoints are set, the tool runs in dual-cluster mode: the same series are written to both clusters, and the result of each query run by the tests is compared between the two clusters. The URL should have no trailing slash.")
+	f.Var(&cfg.SecondaryReadBaseEndpoint, "tests.secondary-read-endpoint", "The base endpoint on the read path of a secondary Mimir cluster or Prometheus-compatible backend. When set without -tests.secondary-write-endpoint, the tool runs in shadow mode: nothing is written to the secondary backend, which is expected to receive the same remote write traffic through other means, for example a Prometheus receiving the same remote write, and the result of each query run by the tests is compared between Mimir and the secondary backend. The URL should have no trailing slash.")
+	f.StringVar(&cfg.SecondaryBackend, "tests.secondary-backend", SecondaryBackendMimir, fmt.Sprintf("The type of the secondary backend. When set to %s, the series are written to the Prometheus remote write receiver API (%s), which must be enabled in Prometheus, queries request the JSON response format, and rules and blocks are not written to the secondary backend, so that a Prometheus instance can be used as ground truth. Supported values: %s.", SecondaryBackendPrometheus, prometheusRemoteWritePath, strings.Join(supportedSecondaryBackends, ", ")))
+}
+
+func (cfg *DualClusterConfig) Validate() error {
+	if cfg.SecondaryWriteBaseEndpoint.URL != nil && cfg.SecondaryReadBaseEndpoint.URL == nil {
+		return errors.New("the secondary read endpoint must be set when the secondary write endpoint is set")
+	}
+	if !util.StringsContain(supportedSecondaryBackends, cfg.SecondaryBackend) {
+		return fmt.Errorf("unsupported secondary backend %q (supported values: %s)", cfg.SecondaryBackend, strings.Join(supportedSecondaryBackends, ", "))
+	}
+	return nil
+}
+
+// Enabled returns whether the dual-cluster mode, or the shadow mode, is enabled.
+func (cfg *DualClusterConfig) Enabled() bool {
+	return cfg.SecondaryReadBaseEndpoint.URL != nil
+}
+
+// ShadowMode returns whether the secondary backend is only queried, and not written to.
+func (cfg *DualClusterConfig) ShadowMode() bool {
+	return cfg.SecondaryReadBaseEndpoint.URL != nil && cfg.SecondaryWriteBaseEndpoint.URL == nil
+}
+
+// SecondaryWritePath returns the API path used to write series to the secondary backend.
+func (cfg *DualClusterConfig) SecondaryWritePath() string {
+	if cfg.SecondaryBackend == SecondaryBackendPrometheus {
+		return prometheusRemoteWritePath
+	}
+	return mimirRemoteWritePath
+}
+
+// DualClusterClient is a MimirClient writing the same data to a primary and a secondary Mimir cluster,
+// and comparing the results of the queries run against both clusters. The primary cluster is the
+// reference: the responses of the primary cluster are returned to the tests, while errors of the
+// secondary cluster and result mismatches are only logged and tracked by metrics.
+//
+// In shadow mode, nothing is written to the secondary backend, which may be any Prometheus-compatible
+// backend, and which is only used to compare the query results. When the secondary backend is Prometheus,
+// series are written to it, but rules and blocks are not.
+type DualClusterClient struct {
+	primary   MimirClient
+	secondary MimirClient
+	logger    log.Logger
+
+	// writeSeries is whether series are written to the secondary backend.
+	writeSeries bool
+	// mimirSecondary is whether the secondary backend supports the Mimir-specific APIs and features.
+	mimirSecondary bool
+
+	secondaryWritesFailedTotal  *prometheus.CounterVec
+	secondaryQueriesFailedTotal prometheus.Counter
+	comparisonsTotal            *prometheus.CounterVec
+	mismatchesTotal             *prometheus.CounterVec
+}
+
+func NewDualClusterClient(primary, secondary MimirClient, cfg DualClusterConfig, logger log.Logger, reg prometheus.Registerer) *DualClusterClient {
+	return &DualClusterClient{
+		primary:        primary,
+		secondary:      secondary,
+		logger:         log.With(logger, "component", "dual-cluster-client"),
+		writeSeries:    !cfg.ShadowMode(),
+		mimirSecondary: !cfg.ShadowMode() && cfg.SecondaryBackend != SecondaryBackendPrometheus,
+		secondaryWritesFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "mimir_continuous_test_dual_cluster_secondary_writes_failed_total",
+			Help: "Total number of failed write requests to the secondary cluster in dual-cluster mode.",
+		}, []string{"status_code"}),
+		secondaryQueriesFailedTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "mimir_continuous_test_dual_cluster_secondary_queries_failed_total",
+			Help: "Total number of failed queries to the secondary cluster in dual-cluster mode.",
+		}),
+		comparisonsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "mimir_continuous_test_dual_cluster_comparisons_total",
+			Help: "Total number of query results compared between the primary and secondary clusters in dual-cluster mode.",
+		}, []string{"query"}),
+		mismatchesTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "mimir_continuous_test_dual_cluster_mismatches_total",
+			Help: "Total number of query results which didn't match when comparing the results of the same query run against the primary and secondary clusters in dual-cluster mode.",
+		}, []string{"query"}),
+	}
+}
+
+// WriteSeries implements MimirClient.
+func (c *DualClusterClient) WriteSeries(ctx context.Context, series []prompb.TimeSeries) (int, error) {
+	statusCode, err := c.primary.WriteSeries(ctx, series)
+	if !c.writeSeries {
+		return statusCode, err
+	}
+
+	secondaryStatusCode, secondaryErr := c.secondary.WriteSeries(ctx, series)
+	if secondaryErr != nil || secondaryStatusCode/100 != 2 {
+		c.secondaryWritesFailedTotal.WithLabelValues(strconv.Itoa(secondaryStatusCode)).Inc()
+		level.Warn(c.logger).Log("msg", "Failed to write series to the secondary cluster", "status_code", secondaryStatusCode, "err", secondaryErr)
+	}
+
+	return statusCode, err
+}
+
+// WriteOTLPMetrics implements MimirClient. The metrics are written to the secondary backend only if it's
+// a Mimir cluster, because the OTLP write API path differs between Mimir and the other backends.
+func (c *DualClusterClient) WriteOTLPMetrics(ctx context.Context, metrics pmetric.Metrics) (int, error) {
+	statusCode, err := c.primary.WriteOTLPMetrics(ctx, metrics)
+	if !c.mimirSecondary {
+		return statusCode, err
+	}
+
+	secondaryStatusCode, secondaryErr := c.secondary.WriteOTLPMetrics(ctx, metrics)
+	if secondaryErr != nil || secondaryStatusCode/100 != 2 {
+		c.secondaryWritesFailedTotal.WithLabelValues(strconv.Itoa(secondaryStatusCode)).Inc()
+		level.Warn(c.logger).Log("msg", "Failed to write OTLP metrics to the secondary cluster", "status_code", secondaryStatusCode, "err", secondaryErr)
+	}
+
+	return statusCode, err
+}
+
+// QueryRange implements MimirClient.
+func (c *DualClusterClient) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration, options ...RequestOption) (model.Matrix, error) {
+	matrix, err := c.primary.QueryRange(ctx, query, start, end, step, options...)
+	if err != nil {
+		return matrix, err
+	}
+
+	secondaryMatrix, err := c.secondary.QueryRange(ctx, query, start, end, step, c.secondaryOptions(options)...)
+	if err != nil {
+		c.secondaryQueriesFailedTotal.Inc()
+		level.Warn(c.logger).Log("msg", "Failed to execute range query against the secondary cluster", "query", query, "start", start.UnixMilli(), "end", end.UnixMilli(), "step", step, "err", err)
+		return matrix, nil
+	}
+
+	c.compare(query, matrix, secondaryMatrix, "start", start.UnixMilli(), "end", end.UnixMilli(), "step", step)
+	return matrix, nil
+}
+
+// Query implements MimirClient.
+func (c *DualClusterClient) Query(ctx context.Context, query string, ts time.Time, options ...RequestOption) (model.Vector, error) {
+	vector, err := c.primary.Query(ctx, query, ts, options...)
+	if err != nil {
+		return vector, err
+	}
+
+	secondaryVector, err := c.secondary.Query(ctx, query, ts, c.secondaryOptions(options)...)
+	if err != nil {
+		c.secondaryQueriesFailedTotal.Inc()
+		level.Warn(c.logger).Log("msg", "Failed to execute instant query against the secondary cluster", "query", query, "ts", ts.UnixMilli(), "err", err)
+		return vector, nil
+	}
+
+	c.compare(query, vectorToMatrix(vector), vectorToMatrix(secondaryVector), "ts", ts.UnixMilli())
+	return vector, nil
+}
+
+// compare compares the results of the same query run against the primary and secondary clusters.
+// The series order is not compared, because it's not guaranteed for instant queries.
+func (c *DualClusterClient) compare(query string, primary, secondary model.Matrix, logKeyvals ...interface{}) {
+	c.comparisonsTotal.WithLabelValues(query).Inc()
+
+	primary, secondary = sortedMatrix(primary), sortedMatrix(secondary)
+	if err := compareMatrices(primary, secondary); err != nil {
+		c.mismatchesTotal.WithLabelValues(query).Inc()
+
+		// Log a structured diff, to ease the investigation of the mismatch.
+		keyvals := []interface{}{"msg", "Query result mismatch between the primary and secondary clusters", "query", query}
+		keyvals = append(keyvals, logKeyvals...)
+		keyvals = append(keyvals,
+			"primary_series", len(primary),
+			"secondary_series", len(secondary),
+			"mismatching_timestamps", formatTimestamps(findMismatchingTimestamps(primary, secondary)),
+			"err", err)
+		level.Warn(c.logger).Log(keyvals...)
+	}
+}
+
+// secondaryOptions returns the request options to use to query the secondary backend. If the secondary
+// backend is not Mimir, it may not support the Mimir protobuf query response format, so JSON is requested.
+// The query statistics are always the ones returned by the primary cluster.
+func (c *DualClusterClient) secondaryOptions(options []RequestOption) []RequestOption {
+	options = append(append([]RequestOption{}, options...), WithQueryStats(nil))
+	if c.mimirSecondary {
+		return options
+	}
+	return append(options, WithResponseFormat(responseFormatJSON))
+}
+
+// ListRules implements MimirClient. The rules are listed from the primary cluster only.
+func (c *DualClusterClient) ListRules(ctx context.Context) error {
+	return c.primary.ListRules(ctx)
+}
+
+// SetRuleGroup implements MimirClient. The rule group is set in both clusters, because rules generate
+// series which may be queried by the tests. If the secondary backend is not Mimir, it's set in the primary cluster only.
+func (c *DualClusterClient) SetRuleGroup(ctx context.Context, namespace string, group rulefmt.RuleGroup) error {
+	if err := c.primary.SetRuleGroup(ctx, namespace, group); err != nil || !c.mimirSecondary {
+		return err
+	}
+	return errors.Wrap(c.secondary.SetRuleGroup(ctx, namespace, group), "failed to set rule group in the secondary cluster")
+}
+
+// GetAlertmanagerStatus implements MimirClient. The status is got from the primary cluster only.
+func (c *DualClusterClient) GetAlertmanagerStatus(ctx context.Context) error {
+	return c.primary.GetAlertmanagerStatus(ctx)
+}
+
+// UploadBlock implements MimirClient. The block is uploaded to both clusters, because its series are
+// queried by the tests. If the secondary backend is not Mimir, it's uploaded to the primary cluster only.
+func (c *DualClusterClient) UploadBlock(ctx context.Context, blockDir string) error {
+	if err := c.primary.UploadBlock(ctx, blockDir); err != nil || !c.mimirSecondary {
+		return err
+	}
+	return errors.Wrap(c.secondary.UploadBlock(ctx, blockDir), "failed to upload block to the secondary cluster")
+}
+
+// sortedMatrix returns a copy of the input matrix with series sorted by labels. The input matrix
+// is not modified, because it's returned to the tests.
+func sortedMatrix(matrix model.Matrix) model.Matrix {
+	out := make(model.Matrix, len(matrix))
+	copy(out, matrix)
+	sort.Sort(out)
+	return out
+}
@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDualClusterConfig_Validate(t *testing.T) {
+	cfg := DualClusterConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+	assert.False(t, cfg.Enabled())
+
+	cfg.SecondaryWriteBaseEndpoint.URL = &url.URL{Scheme: "http", Host: "secondary"}
+	assert.Error(t, cfg.Validate())
+
+	cfg.SecondaryReadBaseEndpoint.URL = &url.URL{Scheme: "http", Host: "secondary"}
+	assert.NoError(t, cfg.Validate())
+	assert.True(t, cfg.Enabled())
+	assert.False(t, cfg.ShadowMode())
+
+	cfg.SecondaryWriteBaseEndpoint.URL = nil
+	assert.NoError(t, cfg.Validate())
+	assert.True(t, cfg.Enabled())
+	assert.True(t, cfg.ShadowMode())
+
+	assert.Equal(t, "/api/v1/push", cfg.SecondaryWritePath())
+	cfg.SecondaryBackend = SecondaryBackendPrometheus
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, "/api/v1/write", cfg.SecondaryWritePath())
+
+	cfg.SecondaryBackend = "unknown"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestDualClusterClient(t *testing.T) {
+	const query = "sum(series)"
+	now := time.Unix(1000, 0)
+	series := []prompb.TimeSeries{{Labels: []prompb.Label{{Name: "__name__", Value: "series"}}}}
+
+	dualClusterCfg := func(backend string, shadowMode bool) DualClusterConfig {
+		cfg := DualClusterConfig{SecondaryBackend: backend}
+		cfg.SecondaryReadBaseEndpoint.URL = &url.URL{Scheme: "http", Host: "secondary"}
+		if !shadowMode {
+			cfg.SecondaryWriteBaseEndpoint.URL = &url.URL{Scheme: "http", Host: "secondary"}
+		}
+		return cfg
+	}
+
+	t.Run("should write series to both clusters and return the primary cluster response", func(t *testing.T) {
+		primary, secondary := &ClientMock{}, &ClientMock{}
+		primary.On("WriteSeries", mock.Anything, series).Return(200, nil)
+		secondary.On("WriteSeries", mock.Anything, series).Return(500, errors.New("failed"))
+
+		reg := prometheus.NewPedanticRegistry()
+		c := NewDualClusterClient(primary, secondary, dualClusterCfg(SecondaryBackendMimir, false), log.NewNopLogger(), reg)
+
+		statusCode, err := c.WriteSeries(context.Background(), series)
+		require.NoError(t, err)
+		assert.Equal(t, 200, statusCode)
+		secondary.AssertNumberOfCalls(t, "WriteSeries", 1)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_dual_cluster_secondary_writes_failed_total Total number of failed write requests to the secondary cluster in dual-cluster mode.
+			# TYPE mimir_continuous_test_dual_cluster_secondary_writes_failed_total counter
+			mimir_continuous_test_dual_cluster_secondary_writes_failed_total{status_code="500"} 1
+		`), "mimir_continuous_test_dual_cluster_secondary_writes_failed_total"))
+	})
+
+	t.Run("should not write series to the secondary backend in shadow mode", func(t *testing.T) {
+		primary, secondary := &ClientMock{}, &ClientMock{}
+		primary.On("WriteSeries", mock.Anything, series).Return(200, nil)
+		primary.On("UploadBlock", mock.Anything, "block").Return(nil)
+
+		c := NewDualClusterClient(primary, secondary, dualClusterCfg(SecondaryBackendMimir, true), log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+		statusCode, err := c.WriteSeries(context.Background(), series)
+		require.NoError(t, err)
+		assert.Equal(t, 200, statusCode)
+		require.NoError(t, c.UploadBlock(context.Background(), "block"))
+
+		secondary.AssertNotCalled(t, "WriteSeries", mock.Anything, mock.Anything)
+		secondary.AssertNotCalled(t, "UploadBlock", mock.Anything, mock.Anything)
+	})
+
+	t.Run("should write series but not rules and blocks to a Prometheus secondary backend", func(t *testing.T) {
+		primary, secondary := &ClientMock{}, &ClientMock{}
+		primary.On("WriteSeries", mock.Anything, series).Return(200, nil)
+		secondary.On("WriteSeries", mock.Anything, series).Return(204, nil)
+		primary.On("UploadBlock", mock.Anything, "block").Return(nil)
+		primary.On("SetRuleGroup", mock.Anything, "namespace", mock.Anything).Return(nil)
+		primary.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+		secondary.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+
+		c := NewDualClusterClient(primary, secondary, dualClusterCfg(SecondaryBackendPrometheus, false), log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+		statusCode, err := c.WriteSeries(context.Background(), series)
+		require.NoError(t, err)
+		assert.Equal(t, 200, statusCode)
+		secondary.AssertNumberOfCalls(t, "WriteSeries", 1)
+
+		require.NoError(t, c.UploadBlock(context.Background(), "block"))
+		require.NoError(t, c.SetRuleGroup(context.Background(), "namespace", rulefmt.RuleGroup{}))
+		secondary.AssertNotCalled(t, "UploadBlock", mock.Anything, mock.Anything)
+		secondary.AssertNotCalled(t, "SetRuleGroup", mock.Anything, mock.Anything, mock.Anything)
+
+		_, err = c.Query(context.Background(), query, now, WithResponseFormat(responseFormatProtobuf), WithQueryStats(&QueryStats{}))
+		require.NoError(t, err)
+
+		actual := &requestOptions{}
+		for _, option := range secondary.Calls[1].Arguments.Get(3).([]RequestOption) {
+			option(actual)
+		}
+		assert.Equal(t, responseFormatJSON, actual.responseFormat)
+		assert.Nil(t, actual.queryStats)
+	})
+
+	t.Run("should query the secondary backend with the JSON response format in shadow mode", func(t *testing.T) {
+		primary, secondary := &ClientMock{}, &ClientMock{}
+		primary.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+		secondary.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		c := NewDualClusterClient(primary, secondary, dualClusterCfg(SecondaryBackendMimir, true), log.NewNopLogger(), reg)
+
+		_, err := c.Query(context.Background(), query, now, WithResponseFormat(responseFormatProtobuf))
+		require.NoError(t, err)
+
+		actual := &requestOptions{}
+		for _, option := range secondary.Calls[0].Arguments.Get(3).([]RequestOption) {
+			option(actual)
+		}
+		assert.Equal(t, responseFormatJSON, actual.responseFormat)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_dual_cluster_comparisons_total Total number of query results compared between the primary and secondary clusters in dual-cluster mode.
+			# TYPE mimir_continuous_test_dual_cluster_comparisons_total counter
+			mimir_continuous_test_dual_cluster_comparisons_total{query="sum(series)"} 1
+		`), "mimir_continuous_test_dual_cluster_comparisons_total", "mimir_continuous_test_dual_cluster_mismatches_total"))
+	})
+
+	t.Run("should compare query results between the clusters and track mismatches", func(t *testing.T) {
+		primary, secondary := &ClientMock{}, &ClientMock{}
+		primary.On("QueryRange", mock.Anything, query, now, now, writeInterval, mock.Anything).Return(model.Matrix{
+			{Values: []model.SamplePair{newSamplePair(now, 1)}},
+		}, nil)
+		secondary.On("QueryRange", mock.Anything, query, now, now, writeInterval, mock.Anything).Return(model.Matrix{
+			{Values: []model.SamplePair{newSamplePair(now, 2)}},
+		}, nil)
+		primary.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{
+			{Metric: model.Metric{"series": "1"}, Timestamp: model.Time(now.UnixMilli()), Value: 1},
+			{Metric: model.Metric{"series": "2"}, Timestamp: model.Time(now.UnixMilli()), Value: 2},
+		}, nil)
+		// The series order doesn't matter.
+		secondary.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{
+			{Metric: model.Metric{"series": "2"}, Timestamp: model.Time(now.UnixMilli()), Value: 2},
+			{Metric: model.Metric{"series": "1"}, Timestamp: model.Time(now.UnixMilli()), Value: 1},
+		}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		c := NewDualClusterClient(primary, secondary, dualClusterCfg(SecondaryBackendMimir, false), log.NewNopLogger(), reg)
+
+		matrix, err := c.QueryRange(context.Background(), query, now, now, writeInterval)
+		require.NoError(t, err)
+		assert.Equal(t, model.SampleValue(1), matrix[0].Values[0].Value)
+
+		vector, err := c.Query(context.Background(), query, now)
+		require.NoError(t, err)
+		assert.Equal(t, model.LabelValue("1"), vector[0].Metric["series"])
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_dual_cluster_comparisons_total Total number of query results compared between the primary and secondary clusters in dual-cluster mode.
+			# TYPE mimir_continuous_test_dual_cluster_comparisons_total counter
+			mimir_continuous_test_dual_cluster_comparisons_total{query="sum(series)"} 2
+
+			# HELP mimir_continuous_test_dual_cluster_mismatches_total Total number of query results which didn't match when comparing the results of the same query run against the primary and secondary clusters in dual-cluster mode.
+			# TYPE mimir_continuous_test_dual_cluster_mismatches_total counter
+			mimir_continuous_test_dual_cluster_mismatches_total{query="sum(series)"} 1
+		`), "mimir_continuous_test_dual_cluster_comparisons_total", "mimir_continuous_test_dual_cluster_mismatches_total"))
+	})
+
+	t.Run("should not query the secondary cluster if the primary cluster query failed", func(t *testing.T) {
+		primary, secondary := &ClientMock{}, &ClientMock{}
+		primary.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{}, errors.New("failed"))
+
+		c := NewDualClusterClient(primary, secondary, dualClusterCfg(SecondaryBackendMimir, false), log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+		_, err := c.Query(context.Background(), query, now)
+		require.Error(t, err)
+		secondary.AssertNotCalled(t, "Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("should return the primary cluster result if the secondary cluster query failed", func(t *testing.T) {
+		primary, secondary := &ClientMock{}, &ClientMock{}
+		primary.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+		secondary.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{}, errors.New("failed"))
+
+		reg := prometheus.NewPedanticRegistry()
+		c := NewDualClusterClient(primary, secondary, dualClusterCfg(SecondaryBackendMimir, false), log.NewNopLogger(), reg)
+
+		vector, err := c.Query(context.Background(), query, now)
+		require.NoError(t, err)
+		assert.Equal(t, model.Vector{{Value: 1}}, vector)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_dual_cluster_secondary_queries_failed_total Total number of failed queries to the secondary cluster in dual-cluster mode.
+			# TYPE mimir_continuous_test_dual_cluster_secondary_queries_failed_total counter
+			mimir_continuous_test_dual_cluster_secondary_queries_failed_total 1
+		`), "mimir_continuous_test_dual_cluster_secondary_queries_failed_total"))
+	})
+}
@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	// emptyResultsMetricName is the name of a metric which is never written.
+	emptyResultsMetricName = "mimir_continuous_test_nonexistent_metric"
+
+	// emptyResultsQueryRange is the time range of the range queries run by the empty results test.
+	emptyResultsQueryRange = 5 * time.Minute
+)
+
+// emptyResultsCase is a query of series which don't exist, along with the expected result.
+type emptyResultsCase struct {
+	query string
+
+	// expectedLabels are the labels of the single series with value 1 expected in the result.
+	// If nil, the result is expected to be empty.
+	expectedLabels model.Metric
+}
+
+var emptyResultsCases = []emptyResultsCase{
+	{query: emptyResultsMetricName},
+	{query: fmt.Sprintf(`%s{series_id=""}`, emptyResultsMetricName)},
+	{query: fmt.Sprintf(`absent(%s)`, emptyResultsMetricName), expectedLabels: model.Metric{}},
+	{query: fmt.Sprintf(`absent(%s{series_id=""})`, emptyResultsMetricName), expectedLabels: model.Metric{}},
+	{query: fmt.Sprintf(`absent(%s{job="continuous-test"})`, emptyResultsMetricName), expectedLabels: model.Metric{"job": "continuous-test"}},
+}
+
+type EmptyResultsTestConfig struct {
+	Enabled bool
+}
+
+func (cfg *EmptyResultsTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.empty-results-test.enabled", false, "Enable the test which periodically runs instant and range queries of series which don't exist, and checks whether the results are empty, or contain the single series with value 1 returned by absent().")
+}
+
+// EmptyResultsTest periodically queries series which don't exist, and checks whether the query results
+// match the Prometheus semantics: an empty (but not null) result for selectors, and a single series with
+// value 1 for absent(). Bugs in the encoding of empty results can break the downstream tooling.
+type EmptyResultsTest struct {
+	name    string
+	cfg     EmptyResultsTestConfig
+	client  MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+}
+
+func NewEmptyResultsTest(cfg EmptyResultsTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *EmptyResultsTest {
+	const name = "empty-results"
+
+	return &EmptyResultsTest{
+		name:    name,
+		cfg:     cfg,
+		client:  client,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+	}
+}
+
+// Name implements Test.
+func (t *EmptyResultsTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *EmptyResultsTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *EmptyResultsTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "EmptyResultsTest.Run")
+	defer sp.Finish()
+
+	end := alignTimestampToInterval(now, writeInterval)
+	start := end.Add(-emptyResultsQueryRange)
+
+	errs := multierror.New()
+	for _, c := range emptyResultsCases {
+		errs.Add(t.runInstantQueryAndVerifyResult(ctx, sp, c, end))
+		errs.Add(t.runRangeQueryAndVerifyResult(ctx, sp, c, start, end, true))
+		errs.Add(t.runRangeQueryAndVerifyResult(ctx, sp, c, start, end, false))
+	}
+	return errs.Err()
+}
+
+func (t *EmptyResultsTest) runInstantQueryAndVerifyResult(ctx context.Context, logger log.Logger, c emptyResultsCase, ts time.Time) error {
+	logger = log.With(logger, "query", c.query, "ts", ts.UnixMilli())
+
+	t.metrics.queriesTotal.Inc()
+	start := time.Now()
+	vector, err := t.client.Query(ctx, c.query, ts, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute instant query", "err", err)
+		return errors.Wrapf(err, "failed to execute instant query %s", c.query)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	return t.checkResult(ctx, logger, c, ts, ts, verifyEmptyResultsVector(c, vector, ts))
+}
+
+func (t *EmptyResultsTest) runRangeQueryAndVerifyResult(ctx context.Context, logger log.Logger, c emptyResultsCase, start, end time.Time, resultsCacheEnabled bool) error {
+	logger = log.With(logger, "query", c.query, "start", start.UnixMilli(), "end", end.UnixMilli(), "results_cache", resultsCacheEnabled)
+
+	t.metrics.queriesTotal.Inc()
+	queryStart := time.Now()
+	matrix, err := t.client.QueryRange(ctx, c.query, start, end, writeInterval, WithResultsCacheEnabled(resultsCacheEnabled))
+	t.metrics.observeQueryDuration(queryTypeRange, resultsCacheEnabled, queryStart)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute range query", "err", err)
+		return errors.Wrapf(err, "failed to execute range query %s", c.query)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	return t.checkResult(ctx, logger, c, start, end, verifyEmptyResultsMatrix(c, matrix, start, end, writeInterval))
+}
+
+func (t *EmptyResultsTest) checkResult(ctx context.Context, logger log.Logger, c emptyResultsCase, start, end time.Time, checkErr error) error {
+	t.metrics.queryResultChecksTotal.Inc()
+	if checkErr != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Query result check failed", "err", checkErr)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: c.query, Start: start, End: end, Error: checkErr.Error()})
+		return errors.Wrapf(checkErr, "query result check failed for query %s", c.query)
+	}
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+
+	level.Debug(logger).Log("msg", "Query result check succeeded")
+	return nil
+}
+
+// verifyEmptyResultsVector checks whether the input instant query result matches the expected one.
+// An empty result is expected to be encoded as an empty array, not as null.
+func verifyEmptyResultsVector(c emptyResultsCase, vector model.Vector, ts time.Time) error {
+	if c.expectedLabels == nil {
+		if vector == nil {
+			return errors.New("expected an empty result but got null")
+		}
+		if len(vector) != 0 {
+			return fmt.Errorf("expected an empty result but got %d series", len(vector))
+		}
+		return nil
+	}
+
+	if len(vector) != 1 {
+		return fmt.Errorf("expected 1 series in the result but got %d", len(vector))
+	}
+	if !vector[0].Metric.Equal(c.expectedLabels) {
+		return fmt.Errorf("expected series %s in the result but got %s", c.expectedLabels, vector[0].Metric)
+	}
+	if vector[0].Value != 1 {
+		return fmt.Errorf("expected value 1 but got %f", vector[0].Value)
+	}
+	if !vector[0].Timestamp.Time().Equal(ts) {
+		return fmt.Errorf("expected sample timestamp %d but got %d", ts.UnixMilli(), vector[0].Timestamp.Time().UnixMilli())
+	}
+	return nil
+}
+
+// verifyEmptyResultsMatrix checks whether the input range query result matches the expected one.
+// An empty result is expected to be encoded as an empty array, not as null.
+func verifyEmptyResultsMatrix(c emptyResultsCase, matrix model.Matrix, start, end time.Time, step time.Duration) error {
+	if c.expectedLabels == nil {
+		if matrix == nil {
+			return errors.New("expected an empty result but got null")
+		}
+		if len(matrix) != 0 {
+			return fmt.Errorf("expected an empty result but got %d series", len(matrix))
+		}
+		return nil
+	}
+
+	if len(matrix) != 1 {
+		return fmt.Errorf("expected 1 series in the result but got %d", len(matrix))
+	}
+	if !matrix[0].Metric.Equal(c.expectedLabels) {
+		return fmt.Errorf("expected series %s in the result but got %s", c.expectedLabels, matrix[0].Metric)
+	}
+
+	expectedPoints := int(end.Sub(start)/step) + 1
+	if len(matrix[0].Values) != expectedPoints {
+		return fmt.Errorf("expected %d samples in the result but got %d", expectedPoints, len(matrix[0].Values))
+	}
+	for i, sample := range matrix[0].Values {
+		expectedTs := start.Add(time.Duration(i) * step)
+		if !sample.Timestamp.Time().Equal(expectedTs) {
+			return fmt.Errorf("expected sample timestamp %d but got %d", expectedTs.UnixMilli(), sample.Timestamp.Time().UnixMilli())
+		}
+		if sample.Value != 1 {
+			return fmt.Errorf("expected value 1 at timestamp %d but got %f", expectedTs.UnixMilli(), sample.Value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmptyResultsTest_Run(t *testing.T) {
+	now := time.Unix(1000, 0)
+	end := alignTimestampToInterval(now, writeInterval)
+	start := end.Add(-emptyResultsQueryRange)
+
+	// expectedMatrix returns the expected range query result of the input case.
+	expectedMatrix := func(c emptyResultsCase) model.Matrix {
+		if c.expectedLabels == nil {
+			return model.Matrix{}
+		}
+
+		stream := &model.SampleStream{Metric: c.expectedLabels}
+		for ts := start; !ts.After(end); ts = ts.Add(writeInterval) {
+			stream.Values = append(stream.Values, model.SamplePair{Timestamp: model.TimeFromUnixNano(ts.UnixNano()), Value: 1})
+		}
+		return model.Matrix{stream}
+	}
+
+	// expectedVector returns the expected instant query result of the input case.
+	expectedVector := func(c emptyResultsCase) model.Vector {
+		if c.expectedLabels == nil {
+			return model.Vector{}
+		}
+		return model.Vector{{Metric: c.expectedLabels, Value: 1, Timestamp: model.TimeFromUnixNano(end.UnixNano())}}
+	}
+
+	t.Run("should succeed if the results match the expected ones", func(t *testing.T) {
+		client := &ClientMock{}
+		for _, c := range emptyResultsCases {
+			client.On("Query", mock.Anything, c.query, end, mock.Anything).Return(expectedVector(c), nil)
+			client.On("QueryRange", mock.Anything, c.query, start, end, writeInterval, mock.Anything).Return(expectedMatrix(c), nil)
+		}
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewEmptyResultsTest(EmptyResultsTestConfig{Enabled: true}, client, log.NewNopLogger(), reg)
+
+		require.NoError(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "Query", len(emptyResultsCases))
+		client.AssertNumberOfCalls(t, "QueryRange", 2*len(emptyResultsCases))
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_total Total number of query results checked for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_total counter
+			mimir_continuous_test_query_result_checks_total{test="empty-results"} 15
+
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="empty-results"} 0
+		`), "mimir_continuous_test_query_result_checks_total", "mimir_continuous_test_query_result_checks_failed_total"))
+	})
+
+	t.Run("should fail if an empty result is null", func(t *testing.T) {
+		client := &ClientMock{}
+		for _, c := range emptyResultsCases {
+			vector := expectedVector(c)
+			if c.expectedLabels == nil {
+				vector = nil
+			}
+			client.On("Query", mock.Anything, c.query, end, mock.Anything).Return(vector, nil)
+			client.On("QueryRange", mock.Anything, c.query, start, end, writeInterval, mock.Anything).Return(expectedMatrix(c), nil)
+		}
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewEmptyResultsTest(EmptyResultsTestConfig{Enabled: true}, client, log.NewNopLogger(), reg)
+
+		err := test.Run(context.Background(), now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "expected an empty result but got null")
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="empty-results"} 2
+		`), "mimir_continuous_test_query_result_checks_failed_total"))
+	})
+}
+
+func TestVerifyEmptyResultsVector(t *testing.T) {
+	ts := time.Unix(1000, 0)
+	empty := emptyResultsCase{query: "nonexistent"}
+	absent := emptyResultsCase{query: `absent(nonexistent{job="test"})`, expectedLabels: model.Metric{"job": "test"}}
+	sample := func(metric model.Metric, value float64) *model.Sample {
+		return &model.Sample{Metric: metric, Value: model.SampleValue(value), Timestamp: model.TimeFromUnixNano(ts.UnixNano())}
+	}
+
+	assert.NoError(t, verifyEmptyResultsVector(empty, model.Vector{}, ts))
+	assert.ErrorContains(t, verifyEmptyResultsVector(empty, nil, ts), "got null")
+	assert.ErrorContains(t, verifyEmptyResultsVector(empty, model.Vector{sample(model.Metric{}, 1)}, ts), "expected an empty result")
+
+	assert.NoError(t, verifyEmptyResultsVector(absent, model.Vector{sample(model.Metric{"job": "test"}, 1)}, ts))
+	assert.ErrorContains(t, verifyEmptyResultsVector(absent, model.Vector{}, ts), "expected 1 series")
+	assert.ErrorContains(t, verifyEmptyResultsVector(absent, model.Vector{sample(model.Metric{}, 1)}, ts), "expected series")
+	assert.ErrorContains(t, verifyEmptyResultsVector(absent, model.Vector{sample(model.Metric{"job": "test"}, 2)}, ts), "expected value 1")
+}
+
+func TestVerifyEmptyResultsMatrix(t *testing.T) {
+	start := time.Unix(1000, 0)
+	end := start.Add(2 * writeInterval)
+	empty := emptyResultsCase{query: "nonexistent"}
+	absent := emptyResultsCase{query: "absent(nonexistent)", expectedLabels: model.Metric{}}
+	stream := func(values ...float64) *model.SampleStream {
+		s := &model.SampleStream{Metric: model.Metric{}}
+		for i, v := range values {
+			ts := start.Add(time.Duration(i) * writeInterval)
+			s.Values = append(s.Values, model.SamplePair{Timestamp: model.TimeFromUnixNano(ts.UnixNano()), Value: model.SampleValue(v)})
+		}
+		return s
+	}
+
+	assert.NoError(t, verifyEmptyResultsMatrix(empty, model.Matrix{}, start, end, writeInterval))
+	assert.ErrorContains(t, verifyEmptyResultsMatrix(empty, nil, start, end, writeInterval), "got null")
+
+	assert.NoError(t, verifyEmptyResultsMatrix(absent, model.Matrix{stream(1, 1, 1)}, start, end, writeInterval))
+	assert.ErrorContains(t, verifyEmptyResultsMatrix(absent, model.Matrix{stream(1, 1)}, start, end, writeInterval), "expected 3 samples")
+	assert.ErrorContains(t, verifyEmptyResultsMatrix(absent, model.Matrix{stream(1, 0, 1)}, start, end, writeInterval), "expected value 1")
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"flag"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// GapInjectionConfig configures the write intervals deliberately skipped by the write-read series test,
+// to check that query results show exactly the expected gaps.
+type GapInjectionConfig struct {
+	GapInjectionPercentage float64
+}
+
+func (cfg *GapInjectionConfig) RegisterFlags(f *flag.FlagSet) {
+	f.Float64Var(&cfg.GapInjectionPercentage, "tests.write-read-series-test.gap-injection-percentage", 0, "Percentage of write intervals deliberately skipped, to check that query results show exactly the expected gaps. The skipped intervals are a deterministic function of the timestamp. Value must be between 0 and 100. 0 to disable.")
+}
+
+func (cfg *GapInjectionConfig) Validate() error {
+	if cfg.GapInjectionPercentage < 0 || cfg.GapInjectionPercentage >= 100 {
+		return errors.New("the gap injection percentage must be greater than or equal to 0 and lower than 100")
+	}
+	return nil
+}
+
+// isGapInjected returns whether the write at the input interval-aligned timestamp is deliberately skipped,
+// given the percentage of intervals to skip. The skipped intervals are a deterministic function of the
+// timestamp, so that they're known when verifying query results, even after a restart of the tool.
+func isGapInjected(ts time.Time, percentage float64) bool {
+	if percentage <= 0 {
+		return false
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strconv.FormatInt(ts.UnixMilli(), 10)))
+	return float64(h.Sum64()%10000) < percentage*100
+}
+
+// isGap returns whether the write at the input timestamp is deliberately skipped because of gap injection.
+func (t *WriteReadSeriesTest) isGap(timestamp time.Time) bool {
+	return isGapInjected(timestamp, t.cfg.GapInjectionPercentage)
+}
+
+// skipSamples deliberately skips writing the samples at the input timestamp, because of gap injection.
+// The query time range is not reset, because the gap is expected in the query results.
+func (t *WriteReadSeriesTest) skipSamples(timestamp time.Time) {
+	t.injectedGapsTotal.Inc()
+	level.Debug(t.logger).Log("msg", "Skipped writing series because of gap injection", "timestamp", timestamp.String())
+
+	t.lastWrittenTimestamp = timestamp
+}
+
+// onlyGapsAtSteps returns whether the samples at all the timestamps of a range query from start to end with
+// the input step have been deliberately skipped because of gap injection.
+func (t *WriteReadSeriesTest) onlyGapsAtSteps(start, end time.Time, step time.Duration) bool {
+	for ts := start; !ts.After(end); ts = ts.Add(step) {
+		if !t.isGap(ts) {
+			return false
+		}
+	}
+	return true
+}
+
+// onlyGapsInRange returns whether the samples at all the interval-aligned timestamps in the range [start, end)
+// have been deliberately skipped because of gap injection. Returns true if the range is empty.
+func (t *WriteReadSeriesTest) onlyGapsInRange(start, end time.Time) bool {
+	for ts := start; ts.Before(end); ts = ts.Add(writeInterval) {
+		if !t.isGap(ts) {
+			return false
+		}
+	}
+	return true
+}
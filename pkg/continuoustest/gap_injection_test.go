@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGapInjectionConfig_Validate(t *testing.T) {
+	cfg := GapInjectionConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.GapInjectionPercentage = 10
+	assert.NoError(t, cfg.Validate())
+
+	cfg.GapInjectionPercentage = -1
+	assert.Error(t, cfg.Validate())
+
+	cfg.GapInjectionPercentage = 100
+	assert.Error(t, cfg.Validate())
+}
+
+func TestIsGapInjected(t *testing.T) {
+	const numIntervals = 10000
+	start := time.Unix(0, 0)
+
+	for _, percentage := range []float64{0, 10, 50} {
+		gaps := 0
+		for i := 0; i < numIntervals; i++ {
+			ts := start.Add(time.Duration(i) * writeInterval)
+			if isGapInjected(ts, percentage) {
+				gaps++
+			}
+
+			// The skipped intervals are a deterministic function of the timestamp.
+			require.Equal(t, isGapInjected(ts, percentage), isGapInjected(ts, percentage))
+		}
+
+		assert.InDelta(t, percentage, 100*float64(gaps)/numIntervals, 2, "percentage: %f", percentage)
+	}
+}
+
+func TestWriteReadSeriesTest_Run_GapInjection(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+	cfg.GapInjectionPercentage = 50
+
+	client := &ClientMock{}
+	client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+	client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil)
+	client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{}, nil)
+
+	reg := prometheus.NewPedanticRegistry()
+	test := NewWriteReadSeriesTest(cfg, client, log.NewNopLogger(), reg)
+
+	test.lastWrittenTimestamp = time.Unix(0, 0)
+	now := time.Unix(0, 0).Add(6 * writeInterval)
+	// Ignore this error. It will be non-nil because the query mock does not return any data.
+	_ = test.Run(context.Background(), now)
+
+	expectedWrites, expectedGaps := 0, 0
+	for ts := time.Unix(0, 0).Add(writeInterval); !ts.After(now); ts = ts.Add(writeInterval) {
+		if isGapInjected(ts, cfg.GapInjectionPercentage) {
+			expectedGaps++
+			client.AssertNotCalled(t, "WriteSeries", mock.Anything, generateSineWaveSeries(metricName, ts, 2))
+		} else {
+			expectedWrites++
+			client.AssertCalled(t, "WriteSeries", mock.Anything, generateSineWaveSeries(metricName, ts, 2))
+		}
+	}
+	require.Greater(t, expectedGaps, 0)
+	require.Greater(t, expectedWrites, 0)
+
+	client.AssertNumberOfCalls(t, "WriteSeries", expectedWrites)
+	assert.Equal(t, now, test.lastWrittenTimestamp)
+	assert.Equal(t, float64(expectedGaps), testutil.ToFloat64(test.injectedGapsTotal))
+}
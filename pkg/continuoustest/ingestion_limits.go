@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/globalerror"
+	util_math "github.com/grafana/mimir/pkg/util/math"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	ingestionLimitsMetricName = "mimir_continuous_test_ingestion_limits"
+	ingestionLimitsProbeLabel = "probe"
+
+	ingestionLimitIngestionRate    = "ingestion_rate"
+	ingestionLimitMaxSeriesPerUser = "max_series_per_user"
+)
+
+type IngestionLimitsTestConfig struct {
+	Enabled            bool
+	IngestionBurstSize int
+	MaxSeriesPerUser   int
+	RecoveryTimeout    time.Duration
+}
+
+func (cfg *IngestionLimitsTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.ingestion-limits-test.enabled", false, "Enable the test which periodically writes above the tenant's ingestion limits, and checks whether the writes are rejected with the expected status code and error, and whether the ingestion recovers once the test backs off. The test deliberately hits the tenant's limits, so it must run against a dedicated tenant.")
+	f.IntVar(&cfg.IngestionBurstSize, "tests.ingestion-limits-test.ingestion-burst-size", 200000, "Ingestion burst size configured in Mimir for the tenant. The test doubles the number of samples of each write request until the ingestion rate limit is hit, up to a request larger than the burst size, which must be rejected.")
+	f.IntVar(&cfg.MaxSeriesPerUser, "tests.ingestion-limits-test.max-series-per-user", 0, "Maximum number of in-memory series configured in Mimir for the tenant. The test doubles the number of series written until the limit is hit, up to twice the limit. The ingestion rate limit must allow writing these series in a single burst. 0 to disable probing the series limit.")
+	f.DurationVar(&cfg.RecoveryTimeout, "tests.ingestion-limits-test.recovery-timeout", time.Minute, "Maximum time to wait, once a limit has been hit, for writes within the limit to be accepted again.")
+}
+
+func (cfg *IngestionLimitsTestConfig) Validate() error {
+	if cfg.IngestionBurstSize <= 0 {
+		return errors.New("the ingestion burst size of the ingestion limits test must be greater than 0")
+	}
+	if cfg.MaxSeriesPerUser < 0 {
+		return errors.New("the max series per user of the ingestion limits test must be greater than or equal to 0")
+	}
+	if cfg.RecoveryTimeout <= 0 {
+		return errors.New("the recovery timeout of the ingestion limits test must be greater than 0")
+	}
+	return nil
+}
+
+// IngestionLimitsTest periodically ramps up the writes above the tenant's ingestion limits, checks whether Mimir
+// rejects them with the expected status code and error ID, and then backs off and checks whether writes within
+// the limits are accepted again.
+type IngestionLimitsTest struct {
+	name    string
+	cfg     IngestionLimitsTestConfig
+	client  MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	// recoveryBackoff is the backoff used while waiting for the ingestion to recover.
+	recoveryBackoff backoff.Config
+
+	probesTotal       *prometheus.CounterVec
+	probesFailedTotal *prometheus.CounterVec
+}
+
+func NewIngestionLimitsTest(cfg IngestionLimitsTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *IngestionLimitsTest {
+	const name = "ingestion-limits"
+
+	t := &IngestionLimitsTest{
+		name:    name,
+		cfg:     cfg,
+		client:  client,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+		recoveryBackoff: backoff.Config{
+			MinBackoff: time.Second,
+			MaxBackoff: 10 * time.Second,
+		},
+		probesTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_ingestion_limits_probes_total",
+			Help:        "Total number of probes of the tenant's ingestion limits.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"limit"}),
+		probesFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_ingestion_limits_probes_failed_total",
+			Help:        "Total number of failed probes of the tenant's ingestion limits, because the limit hasn't been enforced, the writes failed with an unexpected error, or the ingestion hasn't recovered once backed off.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"limit", "reason"}),
+	}
+
+	// Initialise the metrics so that they're exported even if no failure occurred.
+	for _, limit := range t.limits() {
+		t.probesTotal.WithLabelValues(limit)
+		for _, reason := range []string{limitProbeReasonNotEnforced, limitProbeReasonUnexpectedErr, limitProbeReasonNotRecovered} {
+			t.probesFailedTotal.WithLabelValues(limit, reason)
+		}
+	}
+
+	return t
+}
+
+// limits returns the limits probed by the test.
+func (t *IngestionLimitsTest) limits() []string {
+	if t.cfg.MaxSeriesPerUser > 0 {
+		return []string{ingestionLimitMaxSeriesPerUser, ingestionLimitIngestionRate}
+	}
+	return []string{ingestionLimitIngestionRate}
+}
+
+// Name implements Test.
+func (t *IngestionLimitsTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *IngestionLimitsTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *IngestionLimitsTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "IngestionLimitsTest.Run")
+	defer sp.Finish()
+
+	// The series limit is probed first, because probing the ingestion rate limit drains the tenant's burst,
+	// which would otherwise cause the series written to be rate limited.
+	errs := multierror.New()
+	if t.cfg.MaxSeriesPerUser > 0 {
+		errs.Add(t.probeMaxSeriesPerUser(ctx, sp, now))
+	}
+	errs.Add(t.probeIngestionRate(ctx, sp, now))
+	return errs.Err()
+}
+
+// probeIngestionRate doubles the number of samples of each write request until the write is rejected because
+// of the ingestion rate limit. The last request is larger than the burst size, so it can never be accepted.
+func (t *IngestionLimitsTest) probeIngestionRate(ctx context.Context, logger log.Logger, now time.Time) error {
+	const limit = ingestionLimitIngestionRate
+	logger = log.With(logger, "limit", limit)
+	t.probesTotal.WithLabelValues(limit).Inc()
+
+	maxSize := t.cfg.IngestionBurstSize + 1
+	for size := 1; ; size = util_math.Min(size*2, maxSize) {
+		statusCode, err := t.write(ctx, generateIngestionRateSeries(now, size))
+
+		switch {
+		case statusCode/100 == 2:
+			if size < maxSize {
+				continue
+			}
+			t.probesFailedTotal.WithLabelValues(limit, limitProbeReasonNotEnforced).Inc()
+			t.metrics.observeFailure(outcomeTypeWrite)
+			level.Warn(logger).Log("msg", "Write request larger than the ingestion burst size has been unexpectedly accepted", "samples", size)
+			return errors.Errorf("write request of %d samples, larger than the ingestion burst size %d, has been unexpectedly accepted", size, t.cfg.IngestionBurstSize)
+
+		case isWriteRejectedWithErrorID(statusCode, err, http.StatusTooManyRequests, globalerror.IngestionRateLimited):
+			level.Debug(logger).Log("msg", "Write request has been rejected because of the ingestion rate limit, as expected", "samples", size, "status_code", statusCode)
+			return t.waitForRecovery(ctx, logger, limit, generateIngestionRateSeries(now, 1))
+
+		default:
+			return t.unexpectedError(logger, limit, statusCode, http.StatusTooManyRequests, globalerror.IngestionRateLimited, err)
+		}
+	}
+}
+
+// probeMaxSeriesPerUser doubles the number of series written until the write is rejected because of the
+// series limit, and then checks whether the series accepted before hitting the limit can still be written.
+func (t *IngestionLimitsTest) probeMaxSeriesPerUser(ctx context.Context, logger log.Logger, now time.Time) error {
+	const limit = ingestionLimitMaxSeriesPerUser
+	logger = log.With(logger, "limit", limit)
+	t.probesTotal.WithLabelValues(limit).Inc()
+
+	generate := func(from, to int) []prompb.TimeSeries {
+		return generateMaxSeriesPerUserSeries(now, from, to)
+	}
+	written, end, statusCode, err := rampUpSeriesUntilRejected(ctx, t.cfg.MaxSeriesPerUser, t.write, generate)
+
+	switch {
+	case statusCode/100 == 2:
+		t.probesFailedTotal.WithLabelValues(limit, limitProbeReasonNotEnforced).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Series above the series limit have been unexpectedly accepted", "series", written)
+		return errors.Errorf("%d series, above the series limit %d, have been unexpectedly accepted", written, t.cfg.MaxSeriesPerUser)
+
+	case isWriteRejectedWithErrorID(statusCode, err, http.StatusBadRequest, globalerror.MaxSeriesPerUser):
+		level.Debug(logger).Log("msg", "Write request has been rejected because of the series limit, as expected", "series", end, "status_code", statusCode)
+		if written == 0 {
+			// The tenant already reached the limit with series not written by this test, so there
+			// are no series which are expected to be accepted.
+			return nil
+		}
+		return t.waitForRecovery(ctx, logger, limit, generateMaxSeriesPerUserSeries(now, 0, written))
+
+	default:
+		return t.unexpectedError(logger, limit, statusCode, http.StatusBadRequest, globalerror.MaxSeriesPerUser, err)
+	}
+}
+
+// waitForRecovery writes the input series, which are within the limit, backing off until the write is accepted
+// or the recovery timeout expires.
+func (t *IngestionLimitsTest) waitForRecovery(ctx context.Context, logger log.Logger, limit string, series []prompb.TimeSeries) error {
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.RecoveryTimeout)
+	defer cancel()
+
+	var (
+		boff       = backoff.New(ctx, t.recoveryBackoff)
+		statusCode int
+		err        error
+	)
+
+	for boff.Ongoing() {
+		if statusCode, err = t.write(ctx, series); statusCode/100 == 2 {
+			t.metrics.observeSuccess(outcomeTypeWrite)
+			level.Debug(logger).Log("msg", "Ingestion recovered after hitting the limit", "attempts", boff.NumRetries()+1)
+			return nil
+		}
+
+		level.Debug(logger).Log("msg", "Ingestion not recovered yet after hitting the limit", "status_code", statusCode, "err", err)
+		boff.Wait()
+	}
+
+	t.probesFailedTotal.WithLabelValues(limit, limitProbeReasonNotRecovered).Inc()
+	t.metrics.observeFailure(outcomeTypeWrite)
+	level.Warn(logger).Log("msg", "Ingestion has not recovered after hitting the limit", "status_code", statusCode, "err", err)
+	return errors.Errorf("ingestion has not recovered within %s after hitting the %s limit (last status code: %d, error: %v)", t.cfg.RecoveryTimeout, limit, statusCode, err)
+}
+
+func (t *IngestionLimitsTest) unexpectedError(logger log.Logger, limit string, statusCode, expectedStatusCode int, expectedErrID globalerror.ID, err error) error {
+	t.probesFailedTotal.WithLabelValues(limit, limitProbeReasonUnexpectedErr).Inc()
+	t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+	t.metrics.observeFailure(outcomeTypeWrite)
+	level.Warn(logger).Log("msg", "Write request failed with an unexpected error", "status_code", statusCode, "expected_status_code", expectedStatusCode, "expected_error_id", mimirErrorIDPrefix+string(expectedErrID), "err", err)
+	return errors.Errorf("write request failed with status code %d while %d with error %s%s was expected while probing the %s limit (error: %v)", statusCode, expectedStatusCode, mimirErrorIDPrefix, expectedErrID, limit, err)
+}
+
+func (t *IngestionLimitsTest) write(ctx context.Context, series []prompb.TimeSeries) (int, error) {
+	t.metrics.writesTotal.Inc()
+	start := time.Now()
+	statusCode, err := t.client.WriteSeries(ctx, series)
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+	return statusCode, err
+}
+
+// generateIngestionRateSeries returns a single series with the input number of samples, all with the same
+// timestamp and value. Samples with the same timestamp and value are counted by the ingestion rate limit, but
+// are deduplicated when ingested, so they're accepted regardless of the previously written samples.
+func generateIngestionRateSeries(t time.Time, numSamples int) []prompb.TimeSeries {
+	samples := make([]prompb.Sample, numSamples)
+	for i := range samples {
+		samples[i] = prompb.Sample{Value: 1, Timestamp: t.UnixMilli()}
+	}
+
+	return []prompb.TimeSeries{{
+		Labels: []prompb.Label{
+			{Name: "__name__", Value: ingestionLimitsMetricName},
+			{Name: ingestionLimitsProbeLabel, Value: ingestionLimitIngestionRate},
+		},
+		Samples: samples,
+	}}
+}
+
+// generateMaxSeriesPerUserSeries returns the series with ID in the range [from, to), each one with a single sample.
+func generateMaxSeriesPerUserSeries(t time.Time, from, to int) []prompb.TimeSeries {
+	series := make([]prompb.TimeSeries, 0, to-from)
+	for id := from; id < to; id++ {
+		series = append(series, prompb.TimeSeries{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: ingestionLimitsMetricName},
+				{Name: ingestionLimitsProbeLabel, Value: ingestionLimitMaxSeriesPerUser},
+				{Name: "series_id", Value: strconv.Itoa(id)},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: t.UnixMilli()}},
+		})
+	}
+	return series
+}
@@ -0,0 +1,264 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errIngestionRateLimited = errors.New(`server returned HTTP status 429 Too Many Requests and body "the request has been rejected because the tenant exceeded the ingestion rate limit (err-mimir-tenant-max-ingestion-rate)"`)
+	errMaxSeriesPerUser     = errors.New(`server returned HTTP status 400 Bad Request and body "per-user series limit of 10 exceeded (err-mimir-max-series-per-user)"`)
+)
+
+func TestIngestionLimitsTestConfig_Validate(t *testing.T) {
+	cfg := IngestionLimitsTestConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.IngestionBurstSize = 0
+	assert.ErrorContains(t, cfg.Validate(), "ingestion burst size")
+
+	flagext.DefaultValues(&cfg)
+	cfg.MaxSeriesPerUser = -1
+	assert.ErrorContains(t, cfg.Validate(), "max series per user")
+
+	flagext.DefaultValues(&cfg)
+	cfg.RecoveryTimeout = 0
+	assert.ErrorContains(t, cfg.Validate(), "recovery timeout")
+}
+
+func TestIngestionLimitsTest_Run_IngestionRate(t *testing.T) {
+	const burstSize = 10
+	now := time.Unix(1000, 0)
+	cfg := IngestionLimitsTestConfig{Enabled: true, IngestionBurstSize: burstSize, RecoveryTimeout: 100 * time.Millisecond}
+
+	withinBurst := mock.MatchedBy(func(series []prompb.TimeSeries) bool { return len(series[0].Samples) <= burstSize })
+	aboveBurst := mock.MatchedBy(func(series []prompb.TimeSeries) bool { return len(series[0].Samples) > burstSize })
+
+	t.Run("should succeed if the limit is enforced and the ingestion recovers", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, withinBurst).Return(200, nil)
+		client.On("WriteSeries", mock.Anything, aboveBurst).Return(http.StatusTooManyRequests, errIngestionRateLimited)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := newIngestionLimitsTestForTesting(cfg, client, reg)
+		require.NoError(t, test.Run(context.Background(), now))
+
+		// The requests of 1, 2, 4, 8 and 11 samples, followed by the recovery write.
+		expectedSizes := []int{1, 2, 4, 8, burstSize + 1, 1}
+		require.Len(t, client.Calls, len(expectedSizes))
+		for i, call := range client.Calls {
+			series := call.Arguments.Get(1).([]prompb.TimeSeries)
+			require.Len(t, series, 1)
+			assert.Len(t, series[0].Samples, expectedSizes[i])
+			assert.Equal(t, ingestionLimitIngestionRate, series[0].Labels[1].Value)
+		}
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_ingestion_limits_probes_total Total number of probes of the tenant's ingestion limits.
+			# TYPE mimir_continuous_test_ingestion_limits_probes_total counter
+			mimir_continuous_test_ingestion_limits_probes_total{limit="ingestion_rate",test="ingestion-limits"} 1
+
+			# HELP mimir_continuous_test_ingestion_limits_probes_failed_total Total number of failed probes of the tenant's ingestion limits, because the limit hasn't been enforced, the writes failed with an unexpected error, or the ingestion hasn't recovered once backed off.
+			# TYPE mimir_continuous_test_ingestion_limits_probes_failed_total counter
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="not_enforced",test="ingestion-limits"} 0
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="not_recovered",test="ingestion-limits"} 0
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="unexpected_error",test="ingestion-limits"} 0
+		`), "mimir_continuous_test_ingestion_limits_probes_total", "mimir_continuous_test_ingestion_limits_probes_failed_total"))
+	})
+
+	t.Run("should fail if a request larger than the burst size is accepted", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := newIngestionLimitsTestForTesting(cfg, client, reg)
+		require.ErrorContains(t, test.Run(context.Background(), now), "write request of 11 samples, larger than the ingestion burst size 10, has been unexpectedly accepted")
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_ingestion_limits_probes_failed_total Total number of failed probes of the tenant's ingestion limits, because the limit hasn't been enforced, the writes failed with an unexpected error, or the ingestion hasn't recovered once backed off.
+			# TYPE mimir_continuous_test_ingestion_limits_probes_failed_total counter
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="not_enforced",test="ingestion-limits"} 1
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="not_recovered",test="ingestion-limits"} 0
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="unexpected_error",test="ingestion-limits"} 0
+		`), "mimir_continuous_test_ingestion_limits_probes_failed_total"))
+	})
+
+	t.Run("should fail if the request is rejected with an unexpected error", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, withinBurst).Return(200, nil)
+		client.On("WriteSeries", mock.Anything, aboveBurst).Return(http.StatusTooManyRequests, errors.New("the request has been rejected because the tenant exceeded the request rate limit (err-mimir-tenant-max-request-rate)"))
+
+		reg := prometheus.NewPedanticRegistry()
+		test := newIngestionLimitsTestForTesting(cfg, client, reg)
+		require.ErrorContains(t, test.Run(context.Background(), now), "write request failed with status code 429 while 429 with error err-mimir-tenant-max-ingestion-rate was expected")
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_ingestion_limits_probes_failed_total Total number of failed probes of the tenant's ingestion limits, because the limit hasn't been enforced, the writes failed with an unexpected error, or the ingestion hasn't recovered once backed off.
+			# TYPE mimir_continuous_test_ingestion_limits_probes_failed_total counter
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="not_enforced",test="ingestion-limits"} 0
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="not_recovered",test="ingestion-limits"} 0
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="unexpected_error",test="ingestion-limits"} 1
+
+			# HELP mimir_continuous_test_writes_failed_total Total number of failed write requests.
+			# TYPE mimir_continuous_test_writes_failed_total counter
+			mimir_continuous_test_writes_failed_total{maintenance="false",status_code="429",test="ingestion-limits"} 1
+		`), "mimir_continuous_test_ingestion_limits_probes_failed_total", "mimir_continuous_test_writes_failed_total"))
+	})
+
+	t.Run("should retry the recovery write until accepted", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, withinBurst).Return(200, nil).Times(4)
+		client.On("WriteSeries", mock.Anything, aboveBurst).Return(http.StatusTooManyRequests, errIngestionRateLimited)
+		client.On("WriteSeries", mock.Anything, withinBurst).Return(http.StatusTooManyRequests, errIngestionRateLimited).Twice()
+		client.On("WriteSeries", mock.Anything, withinBurst).Return(200, nil)
+
+		test := newIngestionLimitsTestForTesting(cfg, client, nil)
+		require.NoError(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "WriteSeries", 8)
+	})
+
+	t.Run("should fail if the ingestion doesn't recover", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, withinBurst).Return(200, nil).Times(4)
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(http.StatusTooManyRequests, errIngestionRateLimited)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := newIngestionLimitsTestForTesting(cfg, client, reg)
+		require.ErrorContains(t, test.Run(context.Background(), now), "ingestion has not recovered within 100ms after hitting the ingestion_rate limit")
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_ingestion_limits_probes_failed_total Total number of failed probes of the tenant's ingestion limits, because the limit hasn't been enforced, the writes failed with an unexpected error, or the ingestion hasn't recovered once backed off.
+			# TYPE mimir_continuous_test_ingestion_limits_probes_failed_total counter
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="not_enforced",test="ingestion-limits"} 0
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="not_recovered",test="ingestion-limits"} 1
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="unexpected_error",test="ingestion-limits"} 0
+		`), "mimir_continuous_test_ingestion_limits_probes_failed_total"))
+	})
+}
+
+func TestIngestionLimitsTest_Run_MaxSeriesPerUser(t *testing.T) {
+	const maxSeries = 10
+	now := time.Unix(1000, 0)
+	cfg := IngestionLimitsTestConfig{Enabled: true, IngestionBurstSize: 1, MaxSeriesPerUser: maxSeries, RecoveryTimeout: 100 * time.Millisecond}
+
+	seriesProbe := func(fn func(ids []int) bool) interface{} {
+		return mock.MatchedBy(func(series []prompb.TimeSeries) bool {
+			if series[0].Labels[1].Value != ingestionLimitMaxSeriesPerUser {
+				return false
+			}
+			ids := make([]int, 0, len(series))
+			for _, s := range series {
+				id, _ := strconv.Atoi(s.Labels[2].Value)
+				ids = append(ids, id)
+			}
+			return fn(ids)
+		})
+	}
+	rateProbe := mock.MatchedBy(func(series []prompb.TimeSeries) bool {
+		return series[0].Labels[1].Value == ingestionLimitIngestionRate
+	})
+
+	t.Run("should succeed if the limit is enforced and the series accepted before hitting it can be written", func(t *testing.T) {
+		client := &ClientMock{}
+		// Series are rejected once the tenant has 12 series, close to the configured limit.
+		client.On("WriteSeries", mock.Anything, seriesProbe(func(ids []int) bool { return ids[len(ids)-1] < 12 })).Return(200, nil)
+		client.On("WriteSeries", mock.Anything, seriesProbe(func(ids []int) bool { return ids[len(ids)-1] >= 12 })).Return(http.StatusBadRequest, errMaxSeriesPerUser)
+		client.On("WriteSeries", mock.Anything, rateProbe).Return(200, nil).Once()
+		client.On("WriteSeries", mock.Anything, rateProbe).Return(http.StatusTooManyRequests, errIngestionRateLimited).Once()
+		client.On("WriteSeries", mock.Anything, rateProbe).Return(200, nil).Once()
+
+		reg := prometheus.NewPedanticRegistry()
+		test := newIngestionLimitsTestForTesting(cfg, client, reg)
+		require.NoError(t, test.Run(context.Background(), now))
+
+		// The series are ramped up by writing 1, 2, 4 and 8 new series. The last request is rejected,
+		// so the 7 series written before are written again to check whether the ingestion recovered.
+		var writtenSeries [][]int
+		for _, call := range client.Calls {
+			series := call.Arguments.Get(1).([]prompb.TimeSeries)
+			if series[0].Labels[1].Value != ingestionLimitMaxSeriesPerUser {
+				continue
+			}
+			ids := []int{}
+			for _, s := range series {
+				id, err := strconv.Atoi(s.Labels[2].Value)
+				require.NoError(t, err)
+				ids = append(ids, id)
+			}
+			writtenSeries = append(writtenSeries, ids)
+		}
+		assert.Equal(t, [][]int{
+			{0},
+			{1, 2},
+			{3, 4, 5, 6},
+			{7, 8, 9, 10, 11, 12, 13, 14},
+			{0, 1, 2, 3, 4, 5, 6},
+		}, writtenSeries)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_ingestion_limits_probes_total Total number of probes of the tenant's ingestion limits.
+			# TYPE mimir_continuous_test_ingestion_limits_probes_total counter
+			mimir_continuous_test_ingestion_limits_probes_total{limit="ingestion_rate",test="ingestion-limits"} 1
+			mimir_continuous_test_ingestion_limits_probes_total{limit="max_series_per_user",test="ingestion-limits"} 1
+		`), "mimir_continuous_test_ingestion_limits_probes_total"))
+	})
+
+	t.Run("should fail if series above twice the limit are accepted", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, seriesProbe(func([]int) bool { return true })).Return(200, nil)
+		client.On("WriteSeries", mock.Anything, rateProbe).Return(200, nil).Once()
+		client.On("WriteSeries", mock.Anything, rateProbe).Return(http.StatusTooManyRequests, errIngestionRateLimited).Once()
+		client.On("WriteSeries", mock.Anything, rateProbe).Return(200, nil).Once()
+
+		reg := prometheus.NewPedanticRegistry()
+		test := newIngestionLimitsTestForTesting(cfg, client, reg)
+		require.ErrorContains(t, test.Run(context.Background(), now), "20 series, above the series limit 10, have been unexpectedly accepted")
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_ingestion_limits_probes_failed_total Total number of failed probes of the tenant's ingestion limits, because the limit hasn't been enforced, the writes failed with an unexpected error, or the ingestion hasn't recovered once backed off.
+			# TYPE mimir_continuous_test_ingestion_limits_probes_failed_total counter
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="not_enforced",test="ingestion-limits"} 0
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="not_recovered",test="ingestion-limits"} 0
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="ingestion_rate",reason="unexpected_error",test="ingestion-limits"} 0
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="max_series_per_user",reason="not_enforced",test="ingestion-limits"} 1
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="max_series_per_user",reason="not_recovered",test="ingestion-limits"} 0
+			mimir_continuous_test_ingestion_limits_probes_failed_total{limit="max_series_per_user",reason="unexpected_error",test="ingestion-limits"} 0
+		`), "mimir_continuous_test_ingestion_limits_probes_failed_total"))
+	})
+
+	t.Run("should fail if the series are rate limited", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, seriesProbe(func([]int) bool { return true })).Return(http.StatusTooManyRequests, errIngestionRateLimited)
+		client.On("WriteSeries", mock.Anything, rateProbe).Return(200, nil).Once()
+		client.On("WriteSeries", mock.Anything, rateProbe).Return(http.StatusTooManyRequests, errIngestionRateLimited).Once()
+		client.On("WriteSeries", mock.Anything, rateProbe).Return(200, nil).Once()
+
+		test := newIngestionLimitsTestForTesting(cfg, client, nil)
+		err := test.Run(context.Background(), now)
+		require.ErrorContains(t, err, "write request failed with status code 429 while 400 with error err-mimir-max-series-per-user was expected while probing the max_series_per_user limit")
+	})
+}
+
+func newIngestionLimitsTestForTesting(cfg IngestionLimitsTestConfig, client MimirClient, reg prometheus.Registerer) *IngestionLimitsTest {
+	test := NewIngestionLimitsTest(cfg, client, log.NewNopLogger(), reg)
+	test.recoveryBackoff = backoff.Config{MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	return test
+}
@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	invalidWritesMetricName = "mimir_continuous_test_invalid_series"
+	invalidWritesCaseLabel  = "case"
+)
+
+type InvalidWritesTestConfig struct {
+	Enabled             bool
+	TooOldSampleAge     time.Duration
+	MaxLabelValueLength int
+}
+
+func (cfg *InvalidWritesTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.invalid-writes-test.enabled", false, "Enable the test which periodically writes invalid series and samples, and checks whether they're rejected by Mimir.")
+	f.DurationVar(&cfg.TooOldSampleAge, "tests.invalid-writes-test.too-old-sample-age", 24*time.Hour, "Age of the sample written to check whether too old samples are rejected. It must be greater than the out-of-order time window configured in Mimir for the tenant, plus the TSDB head block range.")
+	f.IntVar(&cfg.MaxLabelValueLength, "tests.invalid-writes-test.max-label-value-length", 2048, "Maximum label value length configured in Mimir for the tenant. The test writes a series with a label value exceeding this length.")
+}
+
+// invalidWriteCase is a write request which is expected to be rejected by Mimir.
+type invalidWriteCase struct {
+	name               string
+	expectedStatusCode int
+	generate           func(now time.Time) []prompb.TimeSeries
+}
+
+// InvalidWritesTest periodically writes invalid series and samples, and checks whether Mimir rejects them
+// with the expected status code.
+type InvalidWritesTest struct {
+	name   string
+	cfg    InvalidWritesTestConfig
+	client MimirClient
+	logger log.Logger
+	cases  []invalidWriteCase
+
+	writesTotal         *prometheus.CounterVec
+	writesFailedTotal   *prometheus.CounterVec
+	writesAcceptedTotal *prometheus.CounterVec
+}
+
+func NewInvalidWritesTest(cfg InvalidWritesTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *InvalidWritesTest {
+	const name = "invalid-writes"
+
+	t := &InvalidWritesTest{
+		name:   name,
+		cfg:    cfg,
+		client: client,
+		logger: log.With(logger, "test", name),
+
+		writesTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_invalid_writes_total",
+			Help:        "Total number of attempted write requests containing invalid data.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{invalidWritesCaseLabel}),
+		writesFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_invalid_writes_failed_total",
+			Help:        "Total number of write requests containing invalid data which failed with an unexpected error.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{invalidWritesCaseLabel, "status_code"}),
+		writesAcceptedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_invalid_writes_accepted_total",
+			Help:        "Total number of write requests containing invalid data which have been unexpectedly accepted.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{invalidWritesCaseLabel}),
+	}
+
+	t.cases = []invalidWriteCase{
+		{
+			name:               "duplicate_labels",
+			expectedStatusCode: http.StatusBadRequest,
+			generate: func(now time.Time) []prompb.TimeSeries {
+				return generateInvalidSeries(now, "duplicate_labels", prompb.Label{Name: "label", Value: "a"}, prompb.Label{Name: "label", Value: "b"})
+			},
+		}, {
+			name:               "invalid_label_name",
+			expectedStatusCode: http.StatusBadRequest,
+			generate: func(now time.Time) []prompb.TimeSeries {
+				return generateInvalidSeries(now, "invalid_label_name", prompb.Label{Name: "invalid-label-name", Value: "a"})
+			},
+		}, {
+			name:               "too_old_sample",
+			expectedStatusCode: http.StatusBadRequest,
+			generate: func(now time.Time) []prompb.TimeSeries {
+				return generateInvalidSeries(now.Add(-cfg.TooOldSampleAge), "too_old_sample")
+			},
+		}, {
+			name:               "label_value_too_long",
+			expectedStatusCode: http.StatusBadRequest,
+			generate: func(now time.Time) []prompb.TimeSeries {
+				return generateInvalidSeries(now, "label_value_too_long", prompb.Label{Name: "label", Value: strings.Repeat("x", cfg.MaxLabelValueLength+1)})
+			},
+		},
+	}
+
+	// Initialise the metrics so that they're exported even if no failure occurred.
+	for _, c := range t.cases {
+		t.writesTotal.WithLabelValues(c.name)
+		t.writesAcceptedTotal.WithLabelValues(c.name)
+	}
+
+	return t
+}
+
+// Name implements Test.
+func (t *InvalidWritesTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *InvalidWritesTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *InvalidWritesTest) Run(ctx context.Context, now time.Time) error {
+	errs := new(multierror.MultiError)
+
+	for _, c := range t.cases {
+		errs.Add(t.runCase(ctx, c, now))
+	}
+
+	return errs.Err()
+}
+
+func (t *InvalidWritesTest) runCase(ctx context.Context, c invalidWriteCase, now time.Time) error {
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "InvalidWritesTest.runCase")
+	defer sp.Finish()
+	logger := log.With(sp, "case", c.name)
+
+	t.writesTotal.WithLabelValues(c.name).Inc()
+	statusCode, err := t.client.WriteSeries(ctx, c.generate(now))
+
+	switch {
+	case statusCode == c.expectedStatusCode:
+		level.Debug(logger).Log("msg", "Invalid write request has been rejected as expected", "status_code", statusCode)
+		return nil
+
+	case statusCode/100 == 2:
+		t.writesAcceptedTotal.WithLabelValues(c.name).Inc()
+		level.Warn(logger).Log("msg", "Invalid write request has been unexpectedly accepted", "status_code", statusCode)
+		return errors.Errorf("invalid write request %s has been unexpectedly accepted", c.name)
+
+	default:
+		t.writesFailedTotal.WithLabelValues(c.name, strconv.Itoa(statusCode)).Inc()
+		level.Warn(logger).Log("msg", "Invalid write request failed with an unexpected error", "status_code", statusCode, "expected_status_code", c.expectedStatusCode, "err", err)
+		return errors.Errorf("invalid write request %s failed with status code %d while %d was expected (error: %v)", c.name, statusCode, c.expectedStatusCode, err)
+	}
+}
+
+// generateInvalidSeries returns a single series with a sample at the input timestamp. The input labels
+// are added to the series labels as is, without any validation.
+func generateInvalidSeries(t time.Time, caseName string, extraLabels ...prompb.Label) []prompb.TimeSeries {
+	labels := append([]prompb.Label{
+		{Name: "__name__", Value: invalidWritesMetricName},
+		{Name: invalidWritesCaseLabel, Value: caseName},
+	}, extraLabels...)
+
+	return []prompb.TimeSeries{{
+		Labels: labels,
+		Samples: []prompb.Sample{{
+			Value:     1,
+			Timestamp: t.UnixMilli(),
+		}},
+	}}
+}
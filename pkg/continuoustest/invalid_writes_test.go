@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidWritesTest_Run(t *testing.T) {
+	logger := log.NewNopLogger()
+	cfg := InvalidWritesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.MaxLabelValueLength = 10
+
+	now := time.Unix(100000, 0)
+
+	// seriesWithCase matches the write request containing the invalid series for the input case.
+	seriesWithCase := func(caseName string) interface{} {
+		return mock.MatchedBy(func(series []prompb.TimeSeries) bool {
+			for _, l := range series[0].Labels {
+				if l.Name == invalidWritesCaseLabel {
+					return l.Value == caseName
+				}
+			}
+			return false
+		})
+	}
+
+	t.Run("should write invalid data and track no failure if all requests are rejected", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(400, errors.New("bad request"))
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewInvalidWritesTest(cfg, client, logger, reg)
+
+		require.NoError(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "WriteSeries", 4)
+
+		// Ensure the expected invalid data has been written.
+		client.AssertCalled(t, "WriteSeries", mock.Anything, []prompb.TimeSeries{{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: invalidWritesMetricName},
+				{Name: invalidWritesCaseLabel, Value: "duplicate_labels"},
+				{Name: "label", Value: "a"},
+				{Name: "label", Value: "b"},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: now.UnixMilli()}},
+		}})
+		client.AssertCalled(t, "WriteSeries", mock.Anything, []prompb.TimeSeries{{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: invalidWritesMetricName},
+				{Name: invalidWritesCaseLabel, Value: "too_old_sample"},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: now.Add(-cfg.TooOldSampleAge).UnixMilli()}},
+		}})
+		client.AssertCalled(t, "WriteSeries", mock.Anything, []prompb.TimeSeries{{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: invalidWritesMetricName},
+				{Name: invalidWritesCaseLabel, Value: "label_value_too_long"},
+				{Name: "label", Value: strings.Repeat("x", 11)},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: now.UnixMilli()}},
+		}})
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_invalid_writes_total Total number of attempted write requests containing invalid data.
+			# TYPE mimir_continuous_test_invalid_writes_total counter
+			mimir_continuous_test_invalid_writes_total{case="duplicate_labels",test="invalid-writes"} 1
+			mimir_continuous_test_invalid_writes_total{case="invalid_label_name",test="invalid-writes"} 1
+			mimir_continuous_test_invalid_writes_total{case="label_value_too_long",test="invalid-writes"} 1
+			mimir_continuous_test_invalid_writes_total{case="too_old_sample",test="invalid-writes"} 1
+
+			# HELP mimir_continuous_test_invalid_writes_accepted_total Total number of write requests containing invalid data which have been unexpectedly accepted.
+			# TYPE mimir_continuous_test_invalid_writes_accepted_total counter
+			mimir_continuous_test_invalid_writes_accepted_total{case="duplicate_labels",test="invalid-writes"} 0
+			mimir_continuous_test_invalid_writes_accepted_total{case="invalid_label_name",test="invalid-writes"} 0
+			mimir_continuous_test_invalid_writes_accepted_total{case="label_value_too_long",test="invalid-writes"} 0
+			mimir_continuous_test_invalid_writes_accepted_total{case="too_old_sample",test="invalid-writes"} 0
+		`), "mimir_continuous_test_invalid_writes_total", "mimir_continuous_test_invalid_writes_accepted_total", "mimir_continuous_test_invalid_writes_failed_total"))
+	})
+
+	t.Run("should track invalid data unexpectedly accepted and requests failed with unexpected errors", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, seriesWithCase("too_old_sample")).Return(200, nil)
+		client.On("WriteSeries", mock.Anything, seriesWithCase("duplicate_labels")).Return(500, errors.New("internal server error"))
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(400, errors.New("bad request"))
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewInvalidWritesTest(cfg, client, logger, reg)
+
+		require.Error(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "WriteSeries", 4)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_invalid_writes_accepted_total Total number of write requests containing invalid data which have been unexpectedly accepted.
+			# TYPE mimir_continuous_test_invalid_writes_accepted_total counter
+			mimir_continuous_test_invalid_writes_accepted_total{case="duplicate_labels",test="invalid-writes"} 0
+			mimir_continuous_test_invalid_writes_accepted_total{case="invalid_label_name",test="invalid-writes"} 0
+			mimir_continuous_test_invalid_writes_accepted_total{case="label_value_too_long",test="invalid-writes"} 0
+			mimir_continuous_test_invalid_writes_accepted_total{case="too_old_sample",test="invalid-writes"} 1
+
+			# HELP mimir_continuous_test_invalid_writes_failed_total Total number of write requests containing invalid data which failed with an unexpected error.
+			# TYPE mimir_continuous_test_invalid_writes_failed_total counter
+			mimir_continuous_test_invalid_writes_failed_total{case="duplicate_labels",status_code="500",test="invalid-writes"} 1
+		`), "mimir_continuous_test_invalid_writes_accepted_total", "mimir_continuous_test_invalid_writes_failed_total"))
+	})
+}
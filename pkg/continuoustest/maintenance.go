@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type maintenanceState int
+
+const (
+	// maintenanceNone means the test is not running within a maintenance window.
+	maintenanceNone maintenanceState = iota
+
+	// maintenanceTracked means the test is running within a maintenance window, and failures
+	// are tracked with the maintenance="true" label.
+	maintenanceTracked
+
+	// maintenanceSuppressed means the test is running within a maintenance window, and failures
+	// are not tracked at all.
+	maintenanceSuppressed
+)
+
+type maintenanceStateContextKey int
+
+const maintenanceStateKey maintenanceStateContextKey = 0
+
+// contextWithMaintenanceState returns a new context with the maintenance state attached.
+func contextWithMaintenanceState(ctx context.Context, state maintenanceState) context.Context {
+	return context.WithValue(ctx, maintenanceStateKey, state)
+}
+
+// maintenanceStateFromContext returns the maintenance state attached to the context,
+// or maintenanceNone if not set.
+func maintenanceStateFromContext(ctx context.Context) maintenanceState {
+	if state, ok := ctx.Value(maintenanceStateKey).(maintenanceState); ok {
+		return state
+	}
+	return maintenanceNone
+}
+
+// MaintenanceWindow is a daily recurring time window, in UTC. The window ends on the next day
+// if end is before start.
+type MaintenanceWindow struct {
+	// Start and end of the window, as offsets from midnight.
+	Start time.Duration
+	End   time.Duration
+}
+
+// Contains returns whether the input time is within the window.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	t = t.UTC()
+	offset := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+
+	// The window crosses midnight.
+	return offset >= w.Start || offset < w.End
+}
+
+func (w MaintenanceWindow) String() string {
+	return fmt.Sprintf("%s-%s", formatTimeOfDay(w.Start), formatTimeOfDay(w.End))
+}
+
+// MaintenanceWindows is a list of daily recurring maintenance windows, which implements flag.Value.
+// The flag value is a comma-separated list of windows in the format "HH:MM-HH:MM" (UTC).
+type MaintenanceWindows []MaintenanceWindow
+
+// String implements flag.Value.
+func (w MaintenanceWindows) String() string {
+	out := make([]string, 0, len(w))
+	for _, window := range w {
+		out = append(out, window.String())
+	}
+	return strings.Join(out, ",")
+}
+
+// Set implements flag.Value.
+func (w *MaintenanceWindows) Set(s string) error {
+	var windows MaintenanceWindows
+
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		start, end, ok := strings.Cut(value, "-")
+		if !ok {
+			return fmt.Errorf("invalid maintenance window %q: expected format is HH:MM-HH:MM", value)
+		}
+
+		startOffset, err := parseTimeOfDay(start)
+		if err != nil {
+			return fmt.Errorf("invalid maintenance window %q: %w", value, err)
+		}
+		endOffset, err := parseTimeOfDay(end)
+		if err != nil {
+			return fmt.Errorf("invalid maintenance window %q: %w", value, err)
+		}
+		if startOffset == endOffset {
+			return fmt.Errorf("invalid maintenance window %q: start and end must be different", value)
+		}
+
+		windows = append(windows, MaintenanceWindow{Start: startOffset, End: endOffset})
+	}
+
+	*w = windows
+	return nil
+}
+
+// Contains returns whether the input time is within any of the windows.
+func (w MaintenanceWindows) Contains(t time.Time) bool {
+	for _, window := range w {
+		if window.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func formatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceWindows_Set(t *testing.T) {
+	tests := map[string]struct {
+		input       string
+		expected    MaintenanceWindows
+		expectedErr string
+	}{
+		"empty": {
+			input: "",
+		},
+		"single window": {
+			input:    "10:00-11:30",
+			expected: MaintenanceWindows{{Start: 10 * time.Hour, End: 11*time.Hour + 30*time.Minute}},
+		},
+		"multiple windows": {
+			input:    "10:00-11:30, 23:00-01:00",
+			expected: MaintenanceWindows{{Start: 10 * time.Hour, End: 11*time.Hour + 30*time.Minute}, {Start: 23 * time.Hour, End: time.Hour}},
+		},
+		"missing end": {
+			input:       "10:00",
+			expectedErr: `invalid maintenance window "10:00": expected format is HH:MM-HH:MM`,
+		},
+		"invalid time of day": {
+			input:       "10:00-25:00",
+			expectedErr: `invalid maintenance window "10:00-25:00": invalid time of day "25:00"`,
+		},
+		"empty window": {
+			input:       "10:00-10:00",
+			expectedErr: `invalid maintenance window "10:00-10:00": start and end must be different`,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			var actual MaintenanceWindows
+			err := actual.Set(testData.input)
+
+			if testData.expectedErr != "" {
+				require.EqualError(t, err, testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testData.expected, actual)
+
+			// Ensure the string representation can be parsed back.
+			var parsed MaintenanceWindows
+			require.NoError(t, parsed.Set(actual.String()))
+			assert.Equal(t, actual, parsed)
+		})
+	}
+}
+
+func TestMaintenanceWindows_Contains(t *testing.T) {
+	windows := MaintenanceWindows{}
+	require.NoError(t, windows.Set("10:00-11:00,23:30-00:30"))
+
+	day := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[time.Time]bool{
+		day.Add(9*time.Hour + 59*time.Minute):  false,
+		day.Add(10 * time.Hour):                true,
+		day.Add(10*time.Hour + 59*time.Minute): true,
+		day.Add(11 * time.Hour):                false,
+		day.Add(23*time.Hour + 29*time.Minute): false,
+		day.Add(23*time.Hour + 45*time.Minute): true,
+		day.Add(24*time.Hour + 15*time.Minute): true,
+		day.Add(24*time.Hour + 30*time.Minute): false,
+
+		// Windows are in UTC.
+		day.Add(10*time.Hour + 30*time.Minute).In(time.FixedZone("UTC+2", 2*60*60)): true,
+	}
+
+	for ts, expected := range tests {
+		assert.Equal(t, expected, windows.Contains(ts), ts.String())
+	}
+}
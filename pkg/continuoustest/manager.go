@@ -4,12 +4,24 @@ package continuoustest
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
 )
 
 type Test interface {
@@ -20,73 +32,185 @@ type Test interface {
 	Init(ctx context.Context, now time.Time) error
 
 	// Run runs a single test cycle. This function is called multiple times, at periodic intervals.
-	// The returned error is ignored unless smoke-test is enabled. In that case, the error is returned to the caller.
+	// The returned error is ignored unless smoke-test is enabled or the number of runs is limited.
+	// In that case, the error is returned to the caller.
 	Run(ctx context.Context, now time.Time) error
 }
 
+// TestWithRunInterval is implemented by tests which declare how frequently they should run,
+// instead of the run interval configured for all tests.
+type TestWithRunInterval interface {
+	Test
+
+	// RunInterval returns how frequently the test should run.
+	RunInterval() time.Duration
+}
+
 type ManagerConfig struct {
-	SmokeTest   bool
-	RunInterval time.Duration
+	SmokeTest                         bool
+	RunCount                          int
+	RunInterval                       time.Duration
+	TestRunIntervals                  TestRunIntervals
+	MaintenanceWindows                MaintenanceWindows
+	SuppressFailuresDuringMaintenance bool
 }
 
 func (cfg *ManagerConfig) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.SmokeTest, "tests.smoke-test", false, "Run a smoke test, i.e. run all tests once and exit.")
+	f.IntVar(&cfg.RunCount, "tests.run-count", 0, "Run all tests the configured number of times, every run interval, and then exit. The exit code is non-zero if any test run failed. 0 to run tests forever.")
 	f.DurationVar(&cfg.RunInterval, "tests.run-interval", 5*time.Minute, "How frequently tests should run.")
+	f.Var(&cfg.TestRunIntervals, "tests.run-intervals", "Comma-separated list of per-test run intervals, in the format <test name>=<duration>, for example write-read-series=20s,alert-for-duration=1m. Tests not listed run every -tests.run-interval, unless the test declares its own run interval.")
+	f.Var(&cfg.MaintenanceWindows, "tests.maintenance-windows", "Comma-separated list of daily planned maintenance windows, in the format HH:MM-HH:MM (UTC). Tests keep running during maintenance windows, but failures are tracked with the maintenance=\"true\" label.")
+	f.BoolVar(&cfg.SuppressFailuresDuringMaintenance, "tests.maintenance-windows.suppress-failures", false, "Do not track failures at all during maintenance windows, instead of tracking them with the maintenance=\"true\" label.")
+}
+
+func (cfg *ManagerConfig) Validate() error {
+	if cfg.RunCount < 0 {
+		return errors.New("the number of test runs must be greater than or equal to 0")
+	}
+	if cfg.RunInterval <= 0 {
+		return errors.New("the run interval must be greater than 0")
+	}
+	return nil
+}
+
+// runCount returns the number of times each test should run, or 0 if tests should run forever.
+func (cfg *ManagerConfig) runCount() int {
+	if cfg.SmokeTest {
+		return 1
+	}
+	return cfg.RunCount
 }
 
 type Manager struct {
 	cfg    ManagerConfig
 	logger log.Logger
 	tests  []Test
+
+	// Ensures runs of the same test don't overlap, when a test is triggered on-demand. Keyed by test name.
+	runLocks map[string]*sync.Mutex
+
+	// Whether all tests have been initialized, and so they can be run on-demand.
+	initialized atomic.Bool
+
+	// Notifies query result check failures, if configured.
+	notifier *WebhookNotifier
+
+	// Uploads the report of each test run, if configured.
+	reportUploader *RunReportUploader
+
+	// Holds the query result check outcomes of the most recent test runs, if configured.
+	checkResults *CheckResults
+
+	// Exports the trace of each test run, if configured.
+	traceExporter *TraceExporter
 }
 
 func NewManager(cfg ManagerConfig, logger log.Logger) *Manager {
 	return &Manager{
-		cfg:    cfg,
-		logger: logger,
+		cfg:      cfg,
+		logger:   logger,
+		runLocks: map[string]*sync.Mutex{},
 	}
 }
 
+// SetNotifier sets the notifier used by tests to notify query result check failures.
+// It must be called before running the tests.
+func (m *Manager) SetNotifier(n *WebhookNotifier) {
+	m.notifier = n
+}
+
+// SetRunReportUploader sets the uploader of the report of each test run.
+// It must be called before running the tests.
+func (m *Manager) SetRunReportUploader(u *RunReportUploader) {
+	m.reportUploader = u
+}
+
+// SetCheckResults sets where the query result check outcomes of each test run are stored.
+// It must be called before running the tests.
+func (m *Manager) SetCheckResults(c *CheckResults) {
+	m.checkResults = c
+}
+
+// SetTraceExporter sets the exporter of the trace of each test run. The exporter must report the spans of the
+// global tracer, see TraceExporter.InstallTracer. It must be called before running the tests.
+func (m *Manager) SetTraceExporter(e *TraceExporter) {
+	m.traceExporter = e
+}
+
 func (m *Manager) AddTest(t Test) {
 	m.tests = append(m.tests, t)
+	m.runLocks[t.Name()] = &sync.Mutex{}
+}
+
+// runInterval returns how frequently the input test should run. The interval configured for the test takes
+// precedence over the one declared by the test, which takes precedence over the interval configured for all tests.
+func (m *Manager) runInterval(t Test) time.Duration {
+	if interval, ok := m.cfg.TestRunIntervals[t.Name()]; ok {
+		return interval
+	}
+	if withInterval, ok := t.(TestWithRunInterval); ok && withInterval.RunInterval() > 0 {
+		return withInterval.RunInterval()
+	}
+	return m.cfg.RunInterval
 }
 
 func (m *Manager) Run(ctx context.Context) error {
+	// Ensure the per-test run intervals refer to the registered tests, to catch typos in the test names.
+	for name := range m.cfg.TestRunIntervals {
+		if _, ok := m.runLocks[name]; !ok {
+			return fmt.Errorf("the run interval has been configured for the unknown test %q", name)
+		}
+	}
+
 	// Initialize all tests.
 	for _, t := range m.tests {
 		if err := t.Init(ctx, time.Now()); err != nil {
 			return err
 		}
 	}
+	m.initialized.Store(true)
 
-	// Continuously run all tests. Each test is executed in a dedicated goroutine.
+	// Continuously run all tests. Each test is executed in a dedicated goroutine, with its own ticker.
 	group, ctx := errgroup.WithContext(ctx)
 
 	for _, test := range m.tests {
 		t := test
 		group.Go(func() error {
+			runCount := m.cfg.runCount()
+			errs := multierror.New()
+
+			runInterval := m.runInterval(t)
+			level.Info(m.logger).Log("msg", "Running test periodically", "test", t.Name(), "run_interval", runInterval)
+
+			ticker := time.NewTicker(runInterval)
+			defer ticker.Stop()
 
 			// Run it immediately, and then every configured period.
-			err := t.Run(ctx, time.Now())
-			if m.cfg.SmokeTest {
-				if err != nil {
-					level.Info(m.logger).Log("msg", "Test failed", "test", t.Name(), "err", err)
-				} else {
-					level.Info(m.logger).Log("msg", "Test passed", "test", t.Name())
-				}
-				return err
-			}
+			for run := 1; ; run++ {
+				err := m.runTestExclusively(ctx, t)
+				if runCount > 0 {
+					if err != nil {
+						level.Info(m.logger).Log("msg", "Test failed", "test", t.Name(), "run", run, "err", err)
+					} else {
+						level.Info(m.logger).Log("msg", "Test passed", "test", t.Name(), "run", run)
+					}
+					errs.Add(err)
 
-			ticker := time.NewTicker(m.cfg.RunInterval)
+					if run >= runCount {
+						return errs.Err()
+					}
+				}
 
-			for {
+				// The error is intentionally ignored when the number of runs is not
+				// limited, because we want to continue running the tests forever.
 				select {
 				case <-ticker.C:
-					// This error is intentionally ignored because we want to
-					// continue running the tests forever.
-					_ = t.Run(ctx, time.Now())
 				case <-ctx.Done():
-					return nil
+					if runCount > 0 {
+						errs.Add(ctx.Err())
+					}
+					return errs.Err()
 				}
 			}
 		})
@@ -94,3 +218,173 @@ func (m *Manager) Run(ctx context.Context) error {
 
 	return group.Wait()
 }
+
+// runTestExclusively runs a single test cycle, waiting for any other in-progress run of the same test to complete.
+func (m *Manager) runTestExclusively(ctx context.Context, t Test) error {
+	lock := m.runLocks[t.Name()]
+	lock.Lock()
+	defer lock.Unlock()
+
+	return m.runTest(ctx, t, time.Now())
+}
+
+// runTest runs a single test cycle, attaching the current maintenance state and the notifier to the context.
+// If configured, the report and the trace of the test run are exported and its query result check outcomes are
+// stored once the run completes. Check outcomes are not stored while failures are suppressed because of a planned
+// maintenance.
+func (m *Manager) runTest(ctx context.Context, t Test, now time.Time) error {
+	state := m.maintenanceState(now)
+	if state != maintenanceNone {
+		level.Info(m.logger).Log("msg", "Running test within a planned maintenance window", "test", t.Name(), "failures_suppressed", state == maintenanceSuppressed)
+	}
+
+	ctx = contextWithMaintenanceState(ctx, state)
+	if m.notifier != nil {
+		ctx = contextWithNotifier(ctx, m.notifier)
+	}
+
+	var checkResults *runCheckResults
+	if m.checkResults != nil && state != maintenanceSuppressed {
+		checkResults = newRunCheckResults(t.Name(), now)
+		ctx = contextWithCheckResults(ctx, checkResults)
+	}
+
+	var report *runReport
+	runCtx := ctx
+	if m.reportUploader != nil {
+		report = newRunReport(t.Name(), now, state)
+		runCtx = contextWithRunReport(ctx, report)
+	}
+
+	// The span of the run is the root of the spans of its writes and queries, which are exported together.
+	sp, runCtx := spanlogger.NewWithLogger(runCtx, m.logger, t.Name()+".Run")
+	sp.SetTag("test", t.Name())
+	sp.SetTag("maintenance", state != maintenanceNone)
+	if m.traceExporter != nil {
+		m.traceExporter.track(sp.Span)
+	}
+
+	err := t.Run(runCtx, now)
+	_ = sp.Error(err)
+	sp.Finish()
+
+	if checkResults != nil {
+		m.checkResults.update(checkResults)
+	}
+	if report != nil {
+		report.finish(time.Now(), err)
+		m.reportUploader.upload(ctx, report)
+	}
+	return err
+}
+
+func (m *Manager) maintenanceState(now time.Time) maintenanceState {
+	if !m.cfg.MaintenanceWindows.Contains(now) {
+		return maintenanceNone
+	}
+	if m.cfg.SuppressFailuresDuringMaintenance {
+		return maintenanceSuppressed
+	}
+	return maintenanceTracked
+}
+
+// testRunResponse is the response of the on-demand test run endpoint.
+type testRunResponse struct {
+	Test   string `json:"test"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ServeHTTP runs the test specified by the "test" URL parameter immediately, out of the periodic schedule,
+// and responds with the result of the run. The response status code is 200 if the test run succeeded,
+// and 500 if it failed.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.initialized.Load() {
+		http.Error(w, "tests have not been initialized yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := r.URL.Query().Get("test")
+	var test Test
+	for _, t := range m.tests {
+		if t.Name() == name {
+			test = t
+			break
+		}
+	}
+	if test == nil {
+		http.Error(w, fmt.Sprintf("unknown test %q", name), http.StatusNotFound)
+		return
+	}
+
+	level.Info(m.logger).Log("msg", "Running test on-demand", "test", name)
+
+	res := testRunResponse{Test: name, Status: "success"}
+	statusCode := http.StatusOK
+	if err := m.runTestExclusively(r.Context(), test); err != nil {
+		level.Info(m.logger).Log("msg", "On-demand test run failed", "test", name, "err", err)
+		res.Status, res.Error = "failure", err.Error()
+		statusCode = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// TestRunIntervals holds the run interval of each test, by test name, and implements flag.Value.
+// The flag value is a comma-separated list of intervals in the format "<test name>=<duration>".
+type TestRunIntervals map[string]time.Duration
+
+// String implements flag.Value.
+func (i TestRunIntervals) String() string {
+	names := make([]string, 0, len(i))
+	for name := range i {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		out = append(out, fmt.Sprintf("%s=%s", name, model.Duration(i[name])))
+	}
+	return strings.Join(out, ",")
+}
+
+// Set implements flag.Value.
+func (i *TestRunIntervals) Set(s string) error {
+	intervals := TestRunIntervals{}
+
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		name, duration, ok := strings.Cut(value, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("invalid test run interval %q: expected format is <test name>=<duration>", value)
+		}
+		if _, exists := intervals[name]; exists {
+			return fmt.Errorf("invalid test run interval %q: the run interval of test %q has been configured more than once", value, name)
+		}
+
+		interval, err := model.ParseDuration(strings.TrimSpace(duration))
+		if err != nil {
+			return fmt.Errorf("invalid test run interval %q: %w", value, err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("invalid test run interval %q: the duration must be greater than 0", value)
+		}
+
+		intervals[name] = time.Duration(interval)
+	}
+
+	*i = intervals
+	return nil
+}
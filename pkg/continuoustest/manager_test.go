@@ -5,6 +5,8 @@ package continuoustest
 import (
 	"context"
 	"flag"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -97,3 +99,342 @@ func TestManager_SmokeTest(t *testing.T) {
 		require.Equal(t, dummyTest.runs, 1)
 	})
 }
+
+func TestManager_RunCount(t *testing.T) {
+	newManager := func(runCount int) *Manager {
+		cfg := ManagerConfig{}
+		cfg.RegisterFlags(flag.NewFlagSet("", flag.ContinueOnError))
+		cfg.RunInterval = time.Millisecond * 10
+		cfg.RunCount = runCount
+
+		return NewManager(cfg, log.NewNopLogger())
+	}
+
+	t.Run("should run tests the configured number of times and then exit", func(t *testing.T) {
+		manager := newManager(3)
+
+		dummyTest := &dummyTest{}
+		manager.AddTest(dummyTest)
+
+		require.NoError(t, manager.Run(context.Background()))
+		require.Equal(t, 3, dummyTest.runs)
+	})
+
+	t.Run("should return an error if any test run failed", func(t *testing.T) {
+		manager := newManager(3)
+
+		runs := 0
+		testErr := errors.New("test error")
+		manager.AddTest(&testFunc{run: func(context.Context, time.Time) error {
+			runs++
+			if runs == 2 {
+				return testErr
+			}
+			return nil
+		}})
+
+		require.ErrorIs(t, manager.Run(context.Background()), testErr)
+		require.Equal(t, 3, runs)
+	})
+
+	t.Run("should return an error if the context is canceled before all runs completed", func(t *testing.T) {
+		manager := newManager(1000)
+
+		dummyTest := &dummyTest{}
+		manager.AddTest(dummyTest)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		require.ErrorIs(t, manager.Run(ctx), context.DeadlineExceeded)
+		require.Less(t, dummyTest.runs, 1000)
+	})
+}
+
+func TestManagerConfig_Validate(t *testing.T) {
+	cfg := ManagerConfig{}
+	cfg.RegisterFlags(flag.NewFlagSet("", flag.ContinueOnError))
+	require.NoError(t, cfg.Validate())
+
+	cfg.RunCount = 10
+	require.NoError(t, cfg.Validate())
+
+	cfg.RunCount = -1
+	require.Error(t, cfg.Validate())
+
+	cfg.RunCount = 0
+	cfg.RunInterval = 0
+	require.Error(t, cfg.Validate())
+}
+
+func TestManager_RunIntervals(t *testing.T) {
+	newManager := func(intervals TestRunIntervals) *Manager {
+		cfg := ManagerConfig{}
+		cfg.RegisterFlags(flag.NewFlagSet("", flag.ContinueOnError))
+		cfg.RunInterval = time.Minute
+		cfg.TestRunIntervals = intervals
+
+		return NewManager(cfg, log.NewNopLogger())
+	}
+
+	t.Run("should resolve the run interval of each test", func(t *testing.T) {
+		manager := newManager(TestRunIntervals{"configured": 20 * time.Second, "declared-and-configured": 30 * time.Second})
+
+		tests := map[string]struct {
+			test     Test
+			expected time.Duration
+		}{
+			"neither declared nor configured": {
+				test:     &namedTest{name: "default"},
+				expected: time.Minute,
+			},
+			"configured": {
+				test:     &namedTest{name: "configured"},
+				expected: 20 * time.Second,
+			},
+			"declared": {
+				test:     &namedTest{name: "declared", interval: 5 * time.Minute},
+				expected: 5 * time.Minute,
+			},
+			"declared and configured": {
+				test:     &namedTest{name: "declared-and-configured", interval: 5 * time.Minute},
+				expected: 30 * time.Second,
+			},
+		}
+
+		for testName, testData := range tests {
+			t.Run(testName, func(t *testing.T) {
+				require.Equal(t, testData.expected, manager.runInterval(testData.test))
+			})
+		}
+	})
+
+	t.Run("should run each test with its own interval", func(t *testing.T) {
+		manager := newManager(TestRunIntervals{"fast": 10 * time.Millisecond})
+
+		fast := &namedTest{name: "fast"}
+		slow := &namedTest{name: "slow", interval: time.Hour}
+		manager.AddTest(fast)
+		manager.AddTest(slow)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+		require.NoError(t, manager.Run(ctx))
+
+		// Both tests run immediately, but only the fast one runs again before the context is canceled.
+		require.GreaterOrEqual(t, fast.runs, 4)
+		require.Equal(t, 1, slow.runs)
+	})
+
+	t.Run("should fail if the run interval is configured for an unknown test", func(t *testing.T) {
+		manager := newManager(TestRunIntervals{"unknown": time.Second})
+		manager.AddTest(&namedTest{name: "known"})
+
+		require.ErrorContains(t, manager.Run(context.Background()), `unknown test "unknown"`)
+	})
+}
+
+func TestTestRunIntervals_Set(t *testing.T) {
+	tests := map[string]struct {
+		input       string
+		expected    TestRunIntervals
+		expectedErr string
+	}{
+		"empty": {
+			input:    "",
+			expected: TestRunIntervals{},
+		},
+		"multiple intervals": {
+			input:    "write-read-series=20s, alert-for-duration=5m,block-upload=1h",
+			expected: TestRunIntervals{"write-read-series": 20 * time.Second, "alert-for-duration": 5 * time.Minute, "block-upload": time.Hour},
+		},
+		"missing duration": {
+			input:       "write-read-series",
+			expectedErr: "expected format is <test name>=<duration>",
+		},
+		"missing test name": {
+			input:       "=20s",
+			expectedErr: "expected format is <test name>=<duration>",
+		},
+		"invalid duration": {
+			input:       "write-read-series=abc",
+			expectedErr: "invalid test run interval",
+		},
+		"zero duration": {
+			input:       "write-read-series=0s",
+			expectedErr: "the duration must be greater than 0",
+		},
+		"duplicated test": {
+			input:       "write-read-series=20s,write-read-series=1m",
+			expectedErr: "configured more than once",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			var intervals TestRunIntervals
+			err := intervals.Set(testData.input)
+
+			if testData.expectedErr != "" {
+				require.ErrorContains(t, err, testData.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testData.expected, intervals)
+		})
+	}
+}
+
+func TestTestRunIntervals_String(t *testing.T) {
+	intervals := TestRunIntervals{"write-read-series": 20 * time.Second, "alert-for-duration": 5 * time.Minute}
+	require.Equal(t, "alert-for-duration=5m,write-read-series=20s", intervals.String())
+}
+
+func TestManager_ServeHTTP(t *testing.T) {
+	testErr := errors.New("test error")
+
+	newManager := func(err error) (*Manager, *dummyTest) {
+		cfg := ManagerConfig{}
+		cfg.RegisterFlags(flag.NewFlagSet("", flag.ContinueOnError))
+
+		manager := NewManager(cfg, log.NewNopLogger())
+		test := &dummyTest{err: err}
+		manager.AddTest(test)
+
+		return manager, test
+	}
+
+	tests := map[string]struct {
+		method             string
+		url                string
+		testErr            error
+		notInitialized     bool
+		expectedStatusCode int
+		expectedBody       string
+		expectedRuns       int
+	}{
+		"should run the test and return its successful result": {
+			method:             http.MethodPost,
+			url:                "/continuous-test/run?test=dummyTest",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"test":"dummyTest","status":"success"}`,
+			expectedRuns:       1,
+		},
+		"should run the test and return its failed result": {
+			method:             http.MethodPost,
+			url:                "/continuous-test/run?test=dummyTest",
+			testErr:            testErr,
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       `{"test":"dummyTest","status":"failure","error":"test error"}`,
+			expectedRuns:       1,
+		},
+		"should fail on unknown test": {
+			method:             http.MethodPost,
+			url:                "/continuous-test/run?test=unknown",
+			expectedStatusCode: http.StatusNotFound,
+		},
+		"should fail on non POST requests": {
+			method:             http.MethodGet,
+			url:                "/continuous-test/run?test=dummyTest",
+			expectedStatusCode: http.StatusMethodNotAllowed,
+		},
+		"should fail if tests have not been initialized yet": {
+			method:             http.MethodPost,
+			url:                "/continuous-test/run?test=dummyTest",
+			notInitialized:     true,
+			expectedStatusCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			manager, test := newManager(testData.testErr)
+			manager.initialized.Store(!testData.notInitialized)
+
+			rec := httptest.NewRecorder()
+			manager.ServeHTTP(rec, httptest.NewRequest(testData.method, testData.url, nil))
+
+			require.Equal(t, testData.expectedStatusCode, rec.Code)
+			if testData.expectedBody != "" {
+				require.JSONEq(t, testData.expectedBody, rec.Body.String())
+			}
+			require.Equal(t, testData.expectedRuns, test.runs)
+		})
+	}
+}
+
+func TestManager_MaintenanceState(t *testing.T) {
+	windows := MaintenanceWindows{}
+	require.NoError(t, windows.Set("10:00-11:00"))
+
+	inWindow := time.Date(2023, 1, 1, 10, 30, 0, 0, time.UTC)
+	outsideWindow := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		suppressFailures bool
+		now              time.Time
+		expected         maintenanceState
+	}{
+		"outside maintenance window": {
+			now:      outsideWindow,
+			expected: maintenanceNone,
+		},
+		"within maintenance window": {
+			now:      inWindow,
+			expected: maintenanceTracked,
+		},
+		"within maintenance window with failures suppressed": {
+			suppressFailures: true,
+			now:              inWindow,
+			expected:         maintenanceSuppressed,
+		},
+		"outside maintenance window with failures suppressed": {
+			suppressFailures: true,
+			now:              outsideWindow,
+			expected:         maintenanceNone,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg := ManagerConfig{MaintenanceWindows: windows, SuppressFailuresDuringMaintenance: testData.suppressFailures}
+			manager := NewManager(cfg, log.NewNopLogger())
+
+			var actual maintenanceState
+			test := &testFunc{run: func(ctx context.Context, _ time.Time) error {
+				actual = maintenanceStateFromContext(ctx)
+				return nil
+			}}
+
+			require.NoError(t, manager.runTest(context.Background(), test, testData.now))
+			require.Equal(t, testData.expected, actual)
+		})
+	}
+}
+
+type testFunc struct {
+	dummyTest
+	run func(ctx context.Context, now time.Time) error
+}
+
+// Run implements Test.
+func (f *testFunc) Run(ctx context.Context, now time.Time) error {
+	return f.run(ctx, now)
+}
+
+// namedTest is a test with a custom name, which optionally declares its own run interval.
+type namedTest struct {
+	dummyTest
+	name     string
+	interval time.Duration
+}
+
+// Name implements Test.
+func (n *namedTest) Name() string {
+	return n.name
+}
+
+// RunInterval implements TestWithRunInterval.
+func (n *namedTest) RunInterval() time.Duration {
+	return n.interval
+}
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+// metaMetricsSourcePrefix is the prefix of the metrics exported by the tool, which is replaced
+// by the configured prefix when writing the meta series.
+const metaMetricsSourcePrefix = "mimir_continuous_test_"
+
+// metaMetricsNames are the names of the metrics exported by the tool which are written as meta series,
+// without the metaMetricsSourcePrefix. Only the sum and count of histograms are written.
+var metaMetricsNames = []string{
+	"last_success_timestamp_seconds",
+	"consecutive_failures",
+	"success_ratio",
+	"writes_total",
+	"writes_failed_total",
+	"queries_total",
+	"queries_failed_total",
+	"query_result_checks_total",
+	"query_result_checks_failed_total",
+	"writes_request_duration_seconds",
+	"queries_request_duration_seconds",
+}
+
+type MetaMetricsTestConfig struct {
+	Enabled bool
+	Prefix  string
+}
+
+func (cfg *MetaMetricsTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.meta-metrics.enabled", false, "Enable periodically writing a small set of meta series about the health of the tests, such as the last success timestamp, the failures and the request latencies, to Mimir itself, so that they can be queried along with the tenant data, even where the tool's metrics endpoint isn't scraped.")
+	f.StringVar(&cfg.Prefix, "tests.meta-metrics.prefix", "mimir_continuous_test_meta_", "The prefix of the names of the meta series, which replaces the mimir_continuous_test_ prefix of the metrics exported by the tool, so that the meta series don't clash with the scraped metrics.")
+}
+
+func (cfg *MetaMetricsTestConfig) Validate() error {
+	if !model.IsValidMetricName(model.LabelValue(cfg.Prefix + "total")) {
+		return fmt.Errorf("the meta metrics prefix %q is not a valid metric name prefix", cfg.Prefix)
+	}
+	return nil
+}
+
+// MetaMetricsTest periodically writes a subset of the metrics exported by the tool to Mimir, as meta series
+// with a dedicated prefix. It doesn't verify anything, but it's run like the tests so that the meta series
+// are written at each test run.
+type MetaMetricsTest struct {
+	name     string
+	cfg      MetaMetricsTestConfig
+	client   MimirClient
+	gatherer prometheus.Gatherer
+	logger   log.Logger
+	metrics  *TestMetrics
+
+	lastWrittenTimestamp time.Time
+}
+
+func NewMetaMetricsTest(cfg MetaMetricsTestConfig, client MimirClient, gatherer prometheus.Gatherer, logger log.Logger, reg prometheus.Registerer) *MetaMetricsTest {
+	const name = "meta-metrics"
+
+	return &MetaMetricsTest{
+		name:     name,
+		cfg:      cfg,
+		client:   client,
+		gatherer: gatherer,
+		logger:   log.With(logger, "test", name),
+		metrics:  NewTestMetrics(name, reg),
+	}
+}
+
+// Name implements Test.
+func (t *MetaMetricsTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *MetaMetricsTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *MetaMetricsTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	// Write at most once per write interval.
+	timestamp := alignTimestampToInterval(now, writeInterval)
+	if !timestamp.After(t.lastWrittenTimestamp) {
+		return nil
+	}
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "MetaMetricsTest.Run")
+	defer sp.Finish()
+
+	families, err := t.gatherer.Gather()
+	if err != nil {
+		level.Warn(sp).Log("msg", "Failed to gather the metrics to write as meta series", "err", err)
+		return errors.Wrap(err, "failed to gather the metrics to write as meta series")
+	}
+
+	series := generateMetaSeries(families, t.cfg.Prefix, timestamp)
+	logger := log.With(sp, "timestamp", timestamp.UnixMilli(), "num_series", len(series))
+
+	t.metrics.writesTotal.Inc()
+	start := time.Now()
+	statusCode, err := t.client.WriteSeries(ctx, series)
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+	if statusCode/100 != 2 {
+		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Failed to remote write meta series", "status_code", statusCode, "err", err)
+		if err != nil {
+			return errors.Wrapf(err, "remote write meta series failed with status code %d", statusCode)
+		}
+		return errors.Errorf("remote write meta series failed with status code %d", statusCode)
+	}
+	t.metrics.observeSuccess(outcomeTypeWrite)
+	t.lastWrittenTimestamp = timestamp
+
+	level.Debug(logger).Log("msg", "Remote write meta series succeeded")
+	return nil
+}
+
+// generateMetaSeries returns the meta series to write at the input timestamp from the input metric families.
+// The series are sorted by labels. Samples whose value is NaN, for example the success ratio of a window
+// without outcomes, are not written.
+func generateMetaSeries(families []*dto.MetricFamily, prefix string, timestamp time.Time) []prompb.TimeSeries {
+	names := make(map[string]struct{}, len(metaMetricsNames))
+	for _, name := range metaMetricsNames {
+		names[metaMetricsSourcePrefix+name] = struct{}{}
+	}
+
+	var out []prompb.TimeSeries
+	add := func(name string, labels []*dto.LabelPair, value float64) {
+		if math.IsNaN(value) {
+			return
+		}
+
+		series := prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: model.MetricNameLabel, Value: prefix + strings.TrimPrefix(name, metaMetricsSourcePrefix)}},
+			Samples: []prompb.Sample{{Value: value, Timestamp: timestamp.UnixMilli()}},
+		}
+		for _, l := range labels {
+			series.Labels = append(series.Labels, prompb.Label{Name: l.GetName(), Value: l.GetValue()})
+		}
+
+		// Labels must be sorted by name in the write request.
+		sort.Slice(series.Labels, func(a, b int) bool {
+			return series.Labels[a].Name < series.Labels[b].Name
+		})
+		out = append(out, series)
+	}
+
+	for _, family := range families {
+		if _, ok := names[family.GetName()]; !ok {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(family.GetName(), m.GetLabel(), m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(family.GetName(), m.GetLabel(), m.GetGauge().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				add(family.GetName()+"_sum", m.GetLabel(), m.GetHistogram().GetSampleSum())
+				add(family.GetName()+"_count", m.GetLabel(), float64(m.GetHistogram().GetSampleCount()))
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return labelsString(out[i].Labels) < labelsString(out[j].Labels)
+	})
+	return out
+}
+
+// labelsString returns a string representation of the input labels, used to sort series.
+func labelsString(labels []prompb.Label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.Name)
+		b.WriteByte('=')
+		b.WriteString(l.Value)
+		b.WriteByte(',')
+	}
+	return b.String()
+}
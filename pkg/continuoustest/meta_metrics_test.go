@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetaMetricsTestConfig_Validate(t *testing.T) {
+	cfg := MetaMetricsTestConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Prefix = ""
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Prefix = "invalid-prefix_"
+	assert.ErrorContains(t, cfg.Validate(), "not a valid metric name prefix")
+}
+
+func TestGenerateMetaSeries(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	m := NewTestMetrics("test", reg)
+	m.writesTotal.Add(3)
+	m.writesFailedTotal.WithLabelValues("500").Inc()
+	m.writesDuration.Observe(2)
+
+	// Metrics not in the set of meta metrics are not written.
+	promauto.With(reg).NewCounter(prometheus.CounterOpts{Name: "mimir_continuous_test_other_total"}).Inc()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	ts := time.Unix(1000, 0)
+	series := generateMetaSeries(families, "meta_", ts)
+
+	byName := map[string][]prompb.TimeSeries{}
+	for _, s := range series {
+		assert.Equal(t, []prompb.Sample{{Value: s.Samples[0].Value, Timestamp: ts.UnixMilli()}}, s.Samples)
+		for i := 1; i < len(s.Labels); i++ {
+			assert.Less(t, s.Labels[i-1].Name, s.Labels[i].Name, "labels must be sorted by name")
+		}
+		byName[s.Labels[0].Value] = append(byName[s.Labels[0].Value], s)
+	}
+
+	assert.Equal(t, []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "meta_writes_total"}, {Name: "test", Value: "test"}},
+		Samples: []prompb.Sample{{Value: 3, Timestamp: ts.UnixMilli()}},
+	}}, byName["meta_writes_total"])
+	assert.Equal(t, []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "meta_writes_failed_total"}, {Name: "maintenance", Value: "false"}, {Name: "status_code", Value: "500"}, {Name: "test", Value: "test"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: ts.UnixMilli()}},
+	}}, byName["meta_writes_failed_total"])
+	require.Len(t, byName["meta_writes_request_duration_seconds_sum"], 1)
+	assert.Equal(t, 2.0, byName["meta_writes_request_duration_seconds_sum"][0].Samples[0].Value)
+	require.Len(t, byName["meta_writes_request_duration_seconds_count"], 1)
+	assert.Equal(t, 1.0, byName["meta_writes_request_duration_seconds_count"][0].Samples[0].Value)
+
+	// The success ratio is written only for the windows with outcomes.
+	assert.Len(t, byName["meta_success_ratio"], 0)
+	assert.NotContains(t, byName, "meta_other_total")
+	assert.NotContains(t, byName, "meta_writes_request_duration_seconds")
+}
+
+func TestMetaMetricsTest_Run(t *testing.T) {
+	cfg := MetaMetricsTestConfig{}
+	flagext.DefaultValues(&cfg)
+
+	now := time.Unix(1000, 0)
+
+	t.Run("should write the meta series once per write interval", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewMetaMetricsTest(cfg, client, reg, log.NewNopLogger(), reg)
+
+		require.NoError(t, test.Run(context.Background(), now))
+		require.NoError(t, test.Run(context.Background(), now.Add(time.Second)))
+		client.AssertNumberOfCalls(t, "WriteSeries", 1)
+
+		// The meta series include the metrics of the test itself.
+		series := client.Calls[0].Arguments.Get(1).([]prompb.TimeSeries)
+		assert.NotEmpty(t, series)
+		for _, s := range series {
+			assert.Contains(t, s.Labels[0].Value, "mimir_continuous_test_meta_")
+			assert.Equal(t, alignTimestampToInterval(now, writeInterval).UnixMilli(), s.Samples[0].Timestamp)
+		}
+
+		require.NoError(t, test.Run(context.Background(), now.Add(writeInterval)))
+		client.AssertNumberOfCalls(t, "WriteSeries", 2)
+	})
+
+	t.Run("should fail if the write fails", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(500, errors.New("failed"))
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewMetaMetricsTest(cfg, client, reg, log.NewNopLogger(), reg)
+
+		require.ErrorContains(t, test.Run(context.Background(), now), "remote write meta series failed with status code 500")
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.metrics.writesFailedTotal.WithLabelValues("500")))
+
+		// The write is retried at the next run.
+		require.Error(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "WriteSeries", 2)
+	})
+}
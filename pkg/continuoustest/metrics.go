@@ -3,8 +3,36 @@
 package continuoustest
 
 import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	maintenanceLabel = "maintenance"
+
+	queryTypeRange   = "range"
+	queryTypeInstant = "instant"
+
+	outcomeTypeWrite            = "write"
+	outcomeTypeQuery            = "query"
+	outcomeTypeQueryResultCheck = "query_result_check"
+
+	// successRatioBucketSize is the granularity of the windows over which the success ratios are computed.
+	successRatioBucketSize = 10 * time.Second
+)
+
+var (
+	outcomeTypes = []string{outcomeTypeWrite, outcomeTypeQuery, outcomeTypeQueryResultCheck}
+
+	// successRatioWindows are the windows over which the success ratio of each outcome type is computed,
+	// matching the windows commonly used by multi-window burn rate alerts.
+	successRatioWindows = []time.Duration{5 * time.Minute, time.Hour, 6 * time.Hour}
 )
 
 // TestMetrics holds generic metrics tracked by tests. The common metrics are used to enforce the same
@@ -16,39 +44,253 @@ type TestMetrics struct {
 	queriesFailedTotal           prometheus.Counter
 	queryResultChecksTotal       prometheus.Counter
 	queryResultChecksFailedTotal prometheus.Counter
+	queryShardingMismatchesTotal prometheus.Counter
+	resultsCacheMismatchesTotal  prometheus.Counter
+	readYourWritesViolations     prometheus.Counter
+	readYourWritesLatency        prometheus.Histogram
+	writesDuration               prometheus.Histogram
+	queriesDuration              *prometheus.HistogramVec
+	lastSuccessTimestamp         *prometheus.GaugeVec
+	consecutiveFailures          *prometheus.GaugeVec
+
+	// The outcomes tracked to compute the success ratio of each outcome type over the recent windows.
+	outcomes map[string]*outcomeWindow
+
+	// Whether failures are currently suppressed because of a planned maintenance.
+	failuresSuppressed bool
+
+	// Failure metrics, partitioned by the maintenance label. The failure metrics above
+	// are curried from these ones, based on the current maintenance state.
+	tracked *failureMetrics
+
+	// Failure metrics not registered to the registry, used to suppress failures during maintenance.
+	suppressed *failureMetrics
+}
+
+type failureMetrics struct {
+	writesFailedTotal            *prometheus.CounterVec
+	queriesFailedTotal           *prometheus.CounterVec
+	queryResultChecksFailedTotal *prometheus.CounterVec
+	queryShardingMismatchesTotal *prometheus.CounterVec
+	resultsCacheMismatchesTotal  *prometheus.CounterVec
+	readYourWritesViolations     *prometheus.CounterVec
 }
 
 func NewTestMetrics(testName string, reg prometheus.Registerer) *TestMetrics {
-	return &TestMetrics{
+	m := &TestMetrics{
 		writesTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Name:        "mimir_continuous_test_writes_total",
 			Help:        "Total number of attempted write requests.",
 			ConstLabels: map[string]string{"test": testName},
 		}),
-		writesFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
-			Name:        "mimir_continuous_test_writes_failed_total",
-			Help:        "Total number of failed write requests.",
-			ConstLabels: map[string]string{"test": testName},
-		}, []string{"status_code"}),
 		queriesTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Name:        "mimir_continuous_test_queries_total",
 			Help:        "Total number of attempted query requests.",
 			ConstLabels: map[string]string{"test": testName},
 		}),
-		queriesFailedTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
-			Name:        "mimir_continuous_test_queries_failed_total",
-			Help:        "Total number of failed query requests.",
-			ConstLabels: map[string]string{"test": testName},
-		}),
 		queryResultChecksTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Name:        "mimir_continuous_test_query_result_checks_total",
 			Help:        "Total number of query results checked for correctness.",
 			ConstLabels: map[string]string{"test": testName},
 		}),
-		queryResultChecksFailedTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		readYourWritesLatency: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:        "mimir_continuous_test_read_your_writes_latency_seconds",
+			Help:        "Time elapsed from the start of a write request until the written samples have been successfully queried back.",
+			ConstLabels: map[string]string{"test": testName},
+			Buckets:     prometheus.DefBuckets,
+		}),
+		writesDuration: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:                            "mimir_continuous_test_writes_request_duration_seconds",
+			Help:                            "Duration of the write requests.",
+			ConstLabels:                     map[string]string{"test": testName},
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: time.Hour,
+		}),
+		queriesDuration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:                            "mimir_continuous_test_queries_request_duration_seconds",
+			Help:                            "Duration of the query requests.",
+			ConstLabels:                     map[string]string{"test": testName},
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: time.Hour,
+		}, []string{"type", "results_cache"}),
+		lastSuccessTimestamp: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "mimir_continuous_test_last_success_timestamp_seconds",
+			Help:        "Unix timestamp of the last successful write request, query request or query result check.",
+			ConstLabels: map[string]string{"test": testName},
+		}, []string{"type"}),
+		consecutiveFailures: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "mimir_continuous_test_consecutive_failures",
+			Help:        "Number of consecutive failed write requests, query requests or query result checks since the last successful one.",
+			ConstLabels: map[string]string{"test": testName},
+		}, []string{"type"}),
+		tracked:    newFailureMetrics(testName, reg),
+		suppressed: newFailureMetrics(testName, nil),
+	}
+
+	m.outcomes = make(map[string]*outcomeWindow, len(outcomeTypes))
+	for _, outcomeType := range outcomeTypes {
+		outcomes := newOutcomeWindow(successRatioWindows[len(successRatioWindows)-1], successRatioBucketSize)
+		m.outcomes[outcomeType] = outcomes
+
+		for _, window := range successRatioWindows {
+			window := window
+			promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+				Name:        "mimir_continuous_test_success_ratio",
+				Help:        "Ratio of successful write requests, query requests or query result checks over the window, to compute SLO burn rates. NaN if there's no outcome in the window.",
+				ConstLabels: map[string]string{"test": testName, "type": outcomeType, "window": model.Duration(window).String()},
+			}, func() float64 {
+				return outcomes.successRatio(time.Now(), window)
+			})
+		}
+	}
+
+	m.setMaintenanceState(maintenanceNone)
+	return m
+}
+
+func newFailureMetrics(testName string, reg prometheus.Registerer) *failureMetrics {
+	return &failureMetrics{
+		writesFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_writes_failed_total",
+			Help:        "Total number of failed write requests.",
+			ConstLabels: map[string]string{"test": testName},
+		}, []string{"status_code", maintenanceLabel}),
+		queriesFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_queries_failed_total",
+			Help:        "Total number of failed query requests.",
+			ConstLabels: map[string]string{"test": testName},
+		}, []string{maintenanceLabel}),
+		queryResultChecksFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Name:        "mimir_continuous_test_query_result_checks_failed_total",
 			Help:        "Total number of query results failed when checking for correctness.",
 			ConstLabels: map[string]string{"test": testName},
-		}),
+		}, []string{maintenanceLabel}),
+		queryShardingMismatchesTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_query_sharding_mismatches_total",
+			Help:        "Total number of query results which didn't match when comparing the results of the same query run with and without query sharding.",
+			ConstLabels: map[string]string{"test": testName},
+		}, []string{maintenanceLabel}),
+		resultsCacheMismatchesTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_results_cache_mismatches_total",
+			Help:        "Total number of query results which didn't match when comparing the results of the same query run with and without the results cache.",
+			ConstLabels: map[string]string{"test": testName},
+		}, []string{maintenanceLabel}),
+		readYourWritesViolations: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_read_your_writes_violations_total",
+			Help:        "Total number of successfully written samples which have not been returned by a query run immediately after the write.",
+			ConstLabels: map[string]string{"test": testName},
+		}, []string{maintenanceLabel}),
+	}
+}
+
+// setMaintenanceState switches the failure metrics based on the input maintenance state.
+// Failures are tracked with the maintenance="true" label during maintenance, or not tracked
+// at all if failures are suppressed.
+func (m *TestMetrics) setMaintenanceState(state maintenanceState) {
+	source := m.tracked
+	if state == maintenanceSuppressed {
+		source = m.suppressed
+	}
+
+	value := strconv.FormatBool(state != maintenanceNone)
+	m.failuresSuppressed = state == maintenanceSuppressed
+
+	m.writesFailedTotal = source.writesFailedTotal.MustCurryWith(prometheus.Labels{maintenanceLabel: value})
+	m.queriesFailedTotal = source.queriesFailedTotal.WithLabelValues(value)
+	m.queryResultChecksFailedTotal = source.queryResultChecksFailedTotal.WithLabelValues(value)
+	m.queryShardingMismatchesTotal = source.queryShardingMismatchesTotal.WithLabelValues(value)
+	m.resultsCacheMismatchesTotal = source.resultsCacheMismatchesTotal.WithLabelValues(value)
+	m.readYourWritesViolations = source.readYourWritesViolations.WithLabelValues(value)
+}
+
+// observeQueryDuration tracks the duration of a query request of the input type, run with the results cache
+// enabled or disabled, which started at the input time.
+func (m *TestMetrics) observeQueryDuration(queryType string, resultsCacheEnabled bool, start time.Time) {
+	m.queriesDuration.WithLabelValues(queryType, strconv.FormatBool(resultsCacheEnabled)).Observe(time.Since(start).Seconds())
+}
+
+// observeSuccess tracks a successful write request, query request or query result check, based on the input type.
+func (m *TestMetrics) observeSuccess(outcomeType string) {
+	m.outcomes[outcomeType].add(time.Now(), true)
+	m.lastSuccessTimestamp.WithLabelValues(outcomeType).SetToCurrentTime()
+	m.consecutiveFailures.WithLabelValues(outcomeType).Set(0)
+}
+
+// observeFailure tracks a failed write request, query request or query result check, based on the input type.
+// Failures are not tracked while suppressed because of a planned maintenance.
+func (m *TestMetrics) observeFailure(outcomeType string) {
+	if m.failuresSuppressed {
+		return
+	}
+	m.outcomes[outcomeType].add(time.Now(), false)
+	m.consecutiveFailures.WithLabelValues(outcomeType).Inc()
+}
+
+// outcomeWindow tracks the number of successful and total outcomes over a sliding window, in fixed size
+// buckets, to compute the success ratio over the most recent part of the window. It's safe for concurrent use.
+type outcomeWindow struct {
+	mtx        sync.Mutex
+	bucketSize time.Duration
+	buckets    []outcomeBucket
+}
+
+type outcomeBucket struct {
+	// idx is the index of the bucket since the Unix epoch, used to detect stale buckets in the ring.
+	idx       int64
+	successes int
+	total     int
+}
+
+func newOutcomeWindow(size, bucketSize time.Duration) *outcomeWindow {
+	return &outcomeWindow{
+		bucketSize: bucketSize,
+		buckets:    make([]outcomeBucket, int(size/bucketSize)),
+	}
+}
+
+// add tracks an outcome at the input time.
+func (w *outcomeWindow) add(now time.Time, success bool) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	idx := now.UnixNano() / int64(w.bucketSize)
+	bucket := &w.buckets[idx%int64(len(w.buckets))]
+	if bucket.idx != idx {
+		*bucket = outcomeBucket{idx: idx}
+	}
+
+	bucket.total++
+	if success {
+		bucket.successes++
+	}
+}
+
+// successRatio returns the ratio of successful outcomes over the input window ending at the input time,
+// or NaN if there's no outcome in the window. The window is capped to the size of the tracked window.
+func (w *outcomeWindow) successRatio(now time.Time, window time.Duration) float64 {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	numBuckets := int64(window / w.bucketSize)
+	if numBuckets > int64(len(w.buckets)) {
+		numBuckets = int64(len(w.buckets))
+	}
+
+	var successes, total int
+	last := now.UnixNano() / int64(w.bucketSize)
+	for idx := last - numBuckets + 1; idx <= last; idx++ {
+		if bucket := w.buckets[idx%int64(len(w.buckets))]; bucket.idx == idx {
+			successes += bucket.successes
+			total += bucket.total
+		}
+	}
+
+	if total == 0 {
+		return math.NaN()
 	}
+	return float64(successes) / float64(total)
 }
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestMetrics_ObserveSuccessAndFailure(t *testing.T) {
+	m := NewTestMetrics("test", prometheus.NewPedanticRegistry())
+
+	m.observeFailure(outcomeTypeQuery)
+	m.observeFailure(outcomeTypeQuery)
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.consecutiveFailures.WithLabelValues(outcomeTypeQuery)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.lastSuccessTimestamp.WithLabelValues(outcomeTypeQuery)))
+
+	// A success resets the consecutive failures.
+	m.observeSuccess(outcomeTypeQuery)
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.consecutiveFailures.WithLabelValues(outcomeTypeQuery)))
+	assert.Greater(t, testutil.ToFloat64(m.lastSuccessTimestamp.WithLabelValues(outcomeTypeQuery)), float64(0))
+
+	// Each type is tracked independently.
+	m.observeFailure(outcomeTypeWrite)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.consecutiveFailures.WithLabelValues(outcomeTypeWrite)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.consecutiveFailures.WithLabelValues(outcomeTypeQuery)))
+
+	// Failures are not tracked while suppressed during maintenance.
+	m.setMaintenanceState(maintenanceSuppressed)
+	m.observeFailure(outcomeTypeWrite)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.consecutiveFailures.WithLabelValues(outcomeTypeWrite)))
+
+	m.setMaintenanceState(maintenanceTracked)
+	m.observeFailure(outcomeTypeWrite)
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.consecutiveFailures.WithLabelValues(outcomeTypeWrite)))
+}
+
+func TestTestMetrics_SuccessRatio(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	m := NewTestMetrics("test", reg)
+
+	m.observeSuccess(outcomeTypeWrite)
+	m.observeSuccess(outcomeTypeWrite)
+	m.observeSuccess(outcomeTypeWrite)
+	m.observeFailure(outcomeTypeWrite)
+
+	// Failures are not tracked while suppressed during maintenance.
+	m.setMaintenanceState(maintenanceSuppressed)
+	m.observeFailure(outcomeTypeWrite)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP mimir_continuous_test_success_ratio Ratio of successful write requests, query requests or query result checks over the window, to compute SLO burn rates. NaN if there's no outcome in the window.
+		# TYPE mimir_continuous_test_success_ratio gauge
+		mimir_continuous_test_success_ratio{test="test",type="query",window="1h"} NaN
+		mimir_continuous_test_success_ratio{test="test",type="query",window="5m"} NaN
+		mimir_continuous_test_success_ratio{test="test",type="query",window="6h"} NaN
+		mimir_continuous_test_success_ratio{test="test",type="query_result_check",window="1h"} NaN
+		mimir_continuous_test_success_ratio{test="test",type="query_result_check",window="5m"} NaN
+		mimir_continuous_test_success_ratio{test="test",type="query_result_check",window="6h"} NaN
+		mimir_continuous_test_success_ratio{test="test",type="write",window="1h"} 0.75
+		mimir_continuous_test_success_ratio{test="test",type="write",window="5m"} 0.75
+		mimir_continuous_test_success_ratio{test="test",type="write",window="6h"} 0.75
+	`), "mimir_continuous_test_success_ratio"))
+}
+
+func TestOutcomeWindow_SuccessRatio(t *testing.T) {
+	w := newOutcomeWindow(time.Hour, 10*time.Second)
+	now := time.Unix(10000, 0)
+
+	assert.True(t, math.IsNaN(w.successRatio(now, 5*time.Minute)))
+
+	// A failure 30 minutes ago, and a success and a failure now.
+	w.add(now.Add(-30*time.Minute), false)
+	w.add(now, true)
+	w.add(now, false)
+
+	assert.Equal(t, 0.5, w.successRatio(now, 5*time.Minute))
+	assert.InDelta(t, 1.0/3, w.successRatio(now, time.Hour), 0.0001)
+
+	// The window is capped to the tracked window.
+	assert.InDelta(t, 1.0/3, w.successRatio(now, 6*time.Hour), 0.0001)
+
+	// Outcomes older than the window are not counted, even once their bucket in the ring is reused.
+	later := now.Add(10 * time.Minute)
+	assert.True(t, math.IsNaN(w.successRatio(later, 5*time.Minute)))
+	assert.InDelta(t, 1.0/3, w.successRatio(later, time.Hour), 0.0001)
+
+	muchLater := now.Add(time.Hour)
+	w.add(muchLater, true)
+	assert.Equal(t, 1.0, w.successRatio(muchLater, time.Hour))
+}
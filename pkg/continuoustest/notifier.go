@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/flagext"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+const (
+	webhookNotificationTimeout = 10 * time.Second
+
+	notificationOutcomeSent        = "sent"
+	notificationOutcomeFailed      = "failed"
+	notificationOutcomeRateLimited = "rate_limited"
+)
+
+type WebhookNotifierConfig struct {
+	URL         flagext.URLValue
+	MinInterval time.Duration
+}
+
+func (cfg *WebhookNotifierConfig) RegisterFlags(f *flag.FlagSet) {
+	f.Var(&cfg.URL, "tests.failure-webhook.url", "The URL of a webhook notified with a JSON payload whenever a query result check fails. If empty, no notification is sent.")
+	f.DurationVar(&cfg.MinInterval, "tests.failure-webhook.min-interval", time.Minute, "The minimum interval between two webhook notifications. Failures occurring more frequently are not notified. 0 to disable rate limiting.")
+}
+
+func (cfg *WebhookNotifierConfig) Validate() error {
+	if cfg.MinInterval < 0 {
+		return errors.New("the minimum interval between webhook notifications must be greater than or equal to 0")
+	}
+	return nil
+}
+
+// queryResultCheckFailure is the payload notified to the webhook when a query result check fails.
+type queryResultCheckFailure struct {
+	Test  string `json:"test"`
+	Query string `json:"query"`
+
+	// Start and End are equal for instant queries, and Step is empty.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Step  string    `json:"step,omitempty"`
+
+	// Error describes the difference between the expected and the actual query result.
+	Error string `json:"error"`
+
+	// Time is when the failure occurred.
+	Time time.Time `json:"time"`
+}
+
+// WebhookNotifier notifies query result check failures to a webhook.
+type WebhookNotifier struct {
+	cfg     WebhookNotifierConfig
+	client  *http.Client
+	limiter *rate.Limiter
+	logger  log.Logger
+
+	notificationsTotal *prometheus.CounterVec
+}
+
+func NewWebhookNotifier(cfg WebhookNotifierConfig, logger log.Logger, reg prometheus.Registerer) *WebhookNotifier {
+	limit := rate.Inf
+	if cfg.MinInterval > 0 {
+		limit = rate.Every(cfg.MinInterval)
+	}
+
+	return &WebhookNotifier{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: webhookNotificationTimeout},
+		limiter: rate.NewLimiter(limit, 1),
+		logger:  logger,
+		notificationsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "mimir_continuous_test_failure_notifications_total",
+			Help: "Total number of query result check failures notified to the webhook, partitioned by outcome.",
+		}, []string{"outcome"}),
+	}
+}
+
+// notify sends the failure to the webhook, unless rate limited. The notification is sent asynchronously,
+// so that the test is not slowed down by the webhook.
+func (n *WebhookNotifier) notify(failure queryResultCheckFailure) {
+	if !n.limiter.Allow() {
+		n.notificationsTotal.WithLabelValues(notificationOutcomeRateLimited).Inc()
+		level.Debug(n.logger).Log("msg", "Query result check failure notification has been rate limited", "test", failure.Test)
+		return
+	}
+
+	go func() {
+		if err := n.send(failure); err != nil {
+			n.notificationsTotal.WithLabelValues(notificationOutcomeFailed).Inc()
+			level.Warn(n.logger).Log("msg", "Failed to notify query result check failure to the webhook", "test", failure.Test, "err", err)
+			return
+		}
+		n.notificationsTotal.WithLabelValues(notificationOutcomeSent).Inc()
+	}()
+}
+
+func (n *WebhookNotifier) send(failure queryResultCheckFailure) error {
+	payload, err := json.Marshal(failure)
+	if err != nil {
+		return err
+	}
+
+	res, err := n.client.Post(n.cfg.URL.String(), "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+type notifierContextKey int
+
+const notifierKey notifierContextKey = 0
+
+// contextWithNotifier returns a new context with the notifier attached.
+func contextWithNotifier(ctx context.Context, n *WebhookNotifier) context.Context {
+	return context.WithValue(ctx, notifierKey, n)
+}
+
+// reportQueryResultCheckFailure adds the failure to the run report attached to the context, and notifies it to
+// the notifier attached to the context, if any. Failures are not notified while suppressed because of a planned
+// maintenance, but they're still added to the run report, which tracks the maintenance state.
+func reportQueryResultCheckFailure(ctx context.Context, failure queryResultCheckFailure) {
+	failure.Start, failure.End = failure.Start.UTC(), failure.End.UTC()
+	if failure.Time.IsZero() {
+		failure.Time = time.Now().UTC()
+	}
+
+	if r := runReportFromContext(ctx); r != nil {
+		r.addQueryResultCheckFailure(failure)
+	}
+
+	n, ok := ctx.Value(notifierKey).(*WebhookNotifier)
+	if !ok || n == nil || maintenanceStateFromContext(ctx) == maintenanceSuppressed {
+		return
+	}
+	n.notify(failure)
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	start := time.Unix(1000, 0)
+	end := time.Unix(2000, 0)
+	failure := queryResultCheckFailure{
+		Test:  "test",
+		Query: "sum(metric)",
+		Start: start,
+		End:   end,
+		Step:  "20s",
+		Error: "sample at timestamp 1000000 has value 1.000000 while was expecting 2.000000",
+	}
+
+	// newNotifier returns a notifier whose webhook sends the received payloads to the returned channel.
+	newNotifier := func(t *testing.T, minInterval time.Duration, statusCode int) (*WebhookNotifier, *prometheus.Registry, chan map[string]interface{}) {
+		received := make(chan map[string]interface{}, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+			payload := map[string]interface{}{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+			w.WriteHeader(statusCode)
+			received <- payload
+		}))
+		t.Cleanup(server.Close)
+
+		cfg := WebhookNotifierConfig{MinInterval: minInterval}
+		require.NoError(t, cfg.URL.Set(server.URL))
+
+		reg := prometheus.NewPedanticRegistry()
+		return NewWebhookNotifier(cfg, log.NewNopLogger(), reg), reg, received
+	}
+
+	t.Run("should notify the failure to the webhook", func(t *testing.T) {
+		notifier, reg, received := newNotifier(t, 0, http.StatusOK)
+
+		reportQueryResultCheckFailure(contextWithNotifier(context.Background(), notifier), failure)
+
+		payload := <-received
+		assert.Equal(t, "test", payload["test"])
+		assert.Equal(t, "sum(metric)", payload["query"])
+		assert.Equal(t, start.UTC().Format(time.RFC3339), payload["start"])
+		assert.Equal(t, end.UTC().Format(time.RFC3339), payload["end"])
+		assert.Equal(t, "20s", payload["step"])
+		assert.Equal(t, failure.Error, payload["error"])
+		assert.NotEmpty(t, payload["time"])
+
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(notifier.notificationsTotal.WithLabelValues(notificationOutcomeSent)) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_failure_notifications_total Total number of query result check failures notified to the webhook, partitioned by outcome.
+			# TYPE mimir_continuous_test_failure_notifications_total counter
+			mimir_continuous_test_failure_notifications_total{outcome="sent"} 1
+		`)))
+	})
+
+	t.Run("should track failed notifications", func(t *testing.T) {
+		notifier, _, received := newNotifier(t, 0, http.StatusInternalServerError)
+
+		reportQueryResultCheckFailure(contextWithNotifier(context.Background(), notifier), failure)
+		<-received
+
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(notifier.notificationsTotal.WithLabelValues(notificationOutcomeFailed)) == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("should rate limit notifications", func(t *testing.T) {
+		notifier, _, received := newNotifier(t, time.Hour, http.StatusOK)
+		ctx := contextWithNotifier(context.Background(), notifier)
+
+		reportQueryResultCheckFailure(ctx, failure)
+		reportQueryResultCheckFailure(ctx, failure)
+		<-received
+
+		assert.Equal(t, float64(1), testutil.ToFloat64(notifier.notificationsTotal.WithLabelValues(notificationOutcomeRateLimited)))
+		select {
+		case <-received:
+			require.Fail(t, "the rate limited failure should not have been notified")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("should not notify failures suppressed because of a planned maintenance", func(t *testing.T) {
+		notifier, _, received := newNotifier(t, 0, http.StatusOK)
+		ctx := contextWithMaintenanceState(contextWithNotifier(context.Background(), notifier), maintenanceSuppressed)
+
+		reportQueryResultCheckFailure(ctx, failure)
+
+		select {
+		case <-received:
+			require.Fail(t, "the suppressed failure should not have been notified")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("should be a no-op if no notifier is attached to the context", func(t *testing.T) {
+		reportQueryResultCheckFailure(context.Background(), failure)
+	})
+}
+
+func TestManager_Notifier(t *testing.T) {
+	notifier := NewWebhookNotifier(WebhookNotifierConfig{}, log.NewNopLogger(), nil)
+
+	manager := NewManager(ManagerConfig{}, log.NewNopLogger())
+	manager.SetNotifier(notifier)
+
+	var actual *WebhookNotifier
+	test := &testFunc{run: func(ctx context.Context, _ time.Time) error {
+		actual, _ = ctx.Value(notifierKey).(*WebhookNotifier)
+		return nil
+	}}
+
+	require.NoError(t, manager.runTest(context.Background(), test, time.Now()))
+	require.Same(t, notifier, actual)
+}
@@ -0,0 +1,308 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	otlpResourceAttributesMetricName = "mimir_continuous_test_otlp_gauge"
+	otlpTargetInfoMetricName         = "target_info"
+
+	// The resource attributes which are translated to the job and instance labels, instead of target_info labels.
+	otlpServiceNameAttribute       = "service.name"
+	otlpServiceNamespaceAttribute  = "service.namespace"
+	otlpServiceInstanceIDAttribute = "service.instance.id"
+
+	otlpServiceName      = "mimir-continuous-test"
+	otlpServiceNamespace = "continuous-test"
+)
+
+type OTLPResourceAttributesTestConfig struct {
+	Enabled            bool
+	ServiceInstanceID  string
+	ResourceAttributes flagext.StringSliceCSV
+}
+
+func (cfg *OTLPResourceAttributesTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.otlp-resource-attributes-test.enabled", false, "Enable the test which periodically writes a gauge with resource attributes through the OTLP write API, and checks whether the resource attributes are translated to the expected job and instance labels of the gauge, and to the labels of the target_info series, which can be joined with the gauge.")
+	f.StringVar(&cfg.ServiceInstanceID, "tests.otlp-resource-attributes-test.service-instance-id", "mimir-continuous-test", "The value of the service.instance.id resource attribute of the written gauge, which is expected to be translated to the instance label. Set it to a different value for each instance of the testing tool writing to the same tenant.")
+	cfg.ResourceAttributes = []string{"deployment.environment=continuous-test", "host.name=mimir-continuous-test"}
+	f.Var(&cfg.ResourceAttributes, "tests.otlp-resource-attributes-test.resource-attributes", "Comma-separated list of key=value resource attributes of the written gauge, in addition to service.name, service.namespace and service.instance.id. Each attribute is expected to be translated to a label of the target_info series, whose name is the attribute key with the characters not allowed in label names replaced by underscores.")
+}
+
+func (cfg *OTLPResourceAttributesTestConfig) Validate() error {
+	if cfg.ServiceInstanceID == "" {
+		return errors.New("the service instance ID of the OTLP resource attributes test must not be empty")
+	}
+
+	_, err := cfg.resourceAttributes()
+	return err
+}
+
+// resourceAttributes parses the configured resource attributes, and returns them keyed by attribute key.
+func (cfg *OTLPResourceAttributesTestConfig) resourceAttributes() (map[string]string, error) {
+	if len(cfg.ResourceAttributes) == 0 {
+		return nil, errors.New("at least one resource attribute must be configured for the OTLP resource attributes test, otherwise no target_info series is written")
+	}
+
+	attrs := make(map[string]string, len(cfg.ResourceAttributes))
+	labels := map[model.LabelName]string{}
+	for _, attr := range cfg.ResourceAttributes {
+		key, value, ok := strings.Cut(attr, "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid resource attribute %q: the format must be key=value", attr)
+		}
+
+		for _, r := range key {
+			if r > unicode.MaxASCII {
+				return nil, fmt.Errorf("invalid resource attribute %q: the key must only contain ASCII characters", attr)
+			}
+		}
+
+		switch key {
+		case otlpServiceNameAttribute, otlpServiceNamespaceAttribute, otlpServiceInstanceIDAttribute:
+			return nil, fmt.Errorf("invalid resource attribute %q: the %s attribute is set by the test", attr, key)
+		}
+
+		name := otlpAttributeLabelName(key)
+		if name == model.JobLabel || name == model.InstanceLabel || name == model.MetricNameLabel {
+			return nil, fmt.Errorf("invalid resource attribute %q: it's translated to the reserved %s label", attr, name)
+		}
+		if other, ok := labels[name]; ok {
+			return nil, fmt.Errorf("invalid resource attributes %q and %q: they're both translated to the %s label", other, key, name)
+		}
+		labels[name] = key
+		attrs[key] = value
+	}
+	return attrs, nil
+}
+
+// OTLPResourceAttributesTest periodically writes a gauge through the OTLP write API, and checks whether its
+// resource attributes are translated as expected: service.name and service.namespace to the job label,
+// service.instance.id to the instance label, and the other resource attributes to the labels of the
+// target_info series, which is joined with the gauge on the job and instance labels.
+type OTLPResourceAttributesTest struct {
+	name    string
+	cfg     OTLPResourceAttributesTestConfig
+	client  MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	// The resource attributes in addition to the ones translated to the job and instance labels.
+	attributes map[string]string
+
+	lastWrittenTimestamp time.Time
+}
+
+func NewOTLPResourceAttributesTest(cfg OTLPResourceAttributesTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *OTLPResourceAttributesTest {
+	const name = "otlp-resource-attributes"
+
+	// The config has already been validated.
+	attributes, _ := cfg.resourceAttributes()
+
+	return &OTLPResourceAttributesTest{
+		name:       name,
+		cfg:        cfg,
+		client:     client,
+		logger:     log.With(logger, "test", name),
+		metrics:    NewTestMetrics(name, reg),
+		attributes: attributes,
+	}
+}
+
+// Name implements Test.
+func (t *OTLPResourceAttributesTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *OTLPResourceAttributesTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *OTLPResourceAttributesTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "OTLPResourceAttributesTest.Run")
+	defer sp.Finish()
+
+	// Only the most recent sample is written, because the gauge is checked with instant queries at the
+	// timestamp of the last written sample.
+	timestamp := alignTimestampToInterval(now, writeInterval)
+	if timestamp.After(t.lastWrittenTimestamp) {
+		if err := t.writeMetrics(ctx, sp, timestamp); err != nil {
+			return err
+		}
+	}
+
+	var (
+		selector    = fmt.Sprintf(`{job=%q, instance=%q}`, otlpServiceNamespace+"/"+otlpServiceName, t.cfg.ServiceInstanceID)
+		value       = otlpResourceAttributesValue(timestamp)
+		joinedNames = make([]string, 0, len(t.attributes))
+	)
+	for key := range t.attributes {
+		joinedNames = append(joinedNames, string(otlpAttributeLabelName(key)))
+	}
+	sort.Strings(joinedNames)
+
+	gaugeLabels, targetInfoLabels, joinLabels := t.expectedLabels()
+
+	errs := multierror.New()
+	errs.Add(t.runQueryAndVerifyResult(ctx, sp, otlpResourceAttributesMetricName+selector, timestamp, gaugeLabels, value))
+	errs.Add(t.runQueryAndVerifyResult(ctx, sp, otlpTargetInfoMetricName+selector, timestamp, targetInfoLabels, 1))
+
+	// The query joining the gauge with target_info, to copy the labels translated from the resource attributes.
+	joinQuery := fmt.Sprintf("%s%s * on (job, instance) group_left (%s) %s", otlpResourceAttributesMetricName, selector, strings.Join(joinedNames, ", "), otlpTargetInfoMetricName)
+	errs.Add(t.runQueryAndVerifyResult(ctx, sp, joinQuery, timestamp, joinLabels, value))
+	return errs.Err()
+}
+
+// expectedLabels returns the labels of the gauge and target_info series the written resource is expected to be
+// translated to, and the labels of the gauge joined with the target_info series.
+func (t *OTLPResourceAttributesTest) expectedLabels() (gauge, targetInfo, joined model.Metric) {
+	job := model.LabelValue(otlpServiceNamespace + "/" + otlpServiceName)
+	instance := model.LabelValue(t.cfg.ServiceInstanceID)
+
+	gauge = model.Metric{model.MetricNameLabel: otlpResourceAttributesMetricName, model.JobLabel: job, model.InstanceLabel: instance}
+	targetInfo = model.Metric{model.MetricNameLabel: otlpTargetInfoMetricName, model.JobLabel: job, model.InstanceLabel: instance}
+	joined = model.Metric{model.JobLabel: job, model.InstanceLabel: instance}
+	for key, value := range t.attributes {
+		name := otlpAttributeLabelName(key)
+		targetInfo[name] = model.LabelValue(value)
+		joined[name] = model.LabelValue(value)
+	}
+	return gauge, targetInfo, joined
+}
+
+func (t *OTLPResourceAttributesTest) writeMetrics(ctx context.Context, logger log.Logger, timestamp time.Time) error {
+	logger = log.With(logger, "timestamp", timestamp.UnixMilli())
+
+	start := time.Now()
+	statusCode, err := t.client.WriteOTLPMetrics(ctx, generateOTLPResourceAttributesMetrics(timestamp, t.cfg.ServiceInstanceID, t.attributes))
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+
+	t.metrics.writesTotal.Inc()
+	if statusCode/100 != 2 {
+		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Failed to write OTLP metrics", "status_code", statusCode, "err", err)
+		return errors.Wrapf(err, "OTLP write failed with status code %d", statusCode)
+	}
+
+	t.metrics.observeSuccess(outcomeTypeWrite)
+	t.lastWrittenTimestamp = timestamp
+	return nil
+}
+
+func (t *OTLPResourceAttributesTest) runQueryAndVerifyResult(ctx context.Context, logger log.Logger, query string, ts time.Time, expectedLabels model.Metric, expectedValue float64) error {
+	logger = log.With(logger, "query", query, "ts", ts.UnixMilli())
+
+	t.metrics.queriesTotal.Inc()
+	start := time.Now()
+	vector, err := t.client.Query(ctx, query, ts, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute instant query", "err", err)
+		return errors.Wrapf(err, "failed to execute instant query %s", query)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	t.metrics.queryResultChecksTotal.Inc()
+	if err := verifyOTLPResourceAttributesResult(vector, expectedLabels, expectedValue); err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Query result check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: query, Start: ts, End: ts, Error: err.Error()})
+		return errors.Wrapf(err, "query result check failed for query %s", query)
+	}
+
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+	level.Debug(logger).Log("msg", "Query result check succeeded")
+	return nil
+}
+
+func verifyOTLPResourceAttributesResult(vector model.Vector, expectedLabels model.Metric, expectedValue float64) error {
+	if len(vector) != 1 {
+		return fmt.Errorf("expected 1 series in the result but got %d", len(vector))
+	}
+	if !vector[0].Metric.Equal(expectedLabels) {
+		return fmt.Errorf("expected series %s in the result but got %s", expectedLabels, vector[0].Metric)
+	}
+	if actual := float64(vector[0].Value); !compareSampleValues(actual, expectedValue) {
+		return fmt.Errorf("expected value %f but got %f", expectedValue, actual)
+	}
+	return nil
+}
+
+// generateOTLPResourceAttributesMetrics returns a single resource, with the input attributes in addition to
+// the service ones, exposing the gauge with a sample at the input timestamp.
+func generateOTLPResourceAttributesMetrics(timestamp time.Time, serviceInstanceID string, attributes map[string]string) pmetric.Metrics {
+	metrics := pmetric.NewMetrics()
+
+	rm := metrics.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr(otlpServiceNameAttribute, otlpServiceName)
+	rm.Resource().Attributes().PutStr(otlpServiceNamespaceAttribute, otlpServiceNamespace)
+	rm.Resource().Attributes().PutStr(otlpServiceInstanceIDAttribute, serviceInstanceID)
+	for key, value := range attributes {
+		rm.Resource().Attributes().PutStr(key, value)
+	}
+
+	m := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName(otlpResourceAttributesMetricName)
+	dp := m.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(timestamp))
+	dp.SetDoubleValue(otlpResourceAttributesValue(timestamp))
+
+	return metrics
+}
+
+// otlpResourceAttributesValue returns the value of the gauge at the input timestamp. The value changes at
+// every write, so that a stale sample returned by the queries is detected.
+func otlpResourceAttributesValue(timestamp time.Time) float64 {
+	return float64(timestamp.Unix())
+}
+
+// otlpAttributeLabelName returns the name of the label an ASCII OTLP attribute key is expected to be translated
+// to: the characters not allowed in label names are replaced by underscores, the keys starting with a digit are
+// prefixed by "key_", and the keys starting with a single underscore are prefixed by "key".
+func otlpAttributeLabelName(key string) model.LabelName {
+	name := []byte(key)
+	for i, b := range name {
+		if !((b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')) {
+			name[i] = '_'
+		}
+	}
+
+	switch {
+	case len(name) > 0 && name[0] >= '0' && name[0] <= '9':
+		return model.LabelName("key_" + string(name))
+	case len(name) > 0 && name[0] == '_' && (len(name) == 1 || name[1] != '_'):
+		return model.LabelName("key" + string(name))
+	default:
+		return model.LabelName(name)
+	}
+}
@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/translator/prometheusremotewrite"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLPResourceAttributesTestConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		attributes  []string
+		expectedErr string
+	}{
+		"default": {},
+		"no attributes": {
+			attributes:  []string{},
+			expectedErr: "at least one resource attribute",
+		},
+		"invalid format": {
+			attributes:  []string{"deployment.environment"},
+			expectedErr: "the format must be key=value",
+		},
+		"service attribute": {
+			attributes:  []string{"service.name=foo"},
+			expectedErr: "the service.name attribute is set by the test",
+		},
+		"attribute translated to a reserved label": {
+			attributes:  []string{"instance=foo"},
+			expectedErr: "translated to the reserved instance label",
+		},
+		"attributes translated to the same label": {
+			attributes:  []string{"host.name=foo", "host_name=bar"},
+			expectedErr: "they're both translated to the host_name label",
+		},
+		"non-ASCII attribute key": {
+			attributes:  []string{"hôte=foo"},
+			expectedErr: "the key must only contain ASCII characters",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg := OTLPResourceAttributesTestConfig{}
+			flagext.DefaultValues(&cfg)
+			if testData.attributes != nil {
+				cfg.ResourceAttributes = testData.attributes
+			}
+
+			if testData.expectedErr == "" {
+				assert.NoError(t, cfg.Validate())
+			} else {
+				assert.ErrorContains(t, cfg.Validate(), testData.expectedErr)
+			}
+		})
+	}
+}
+
+func TestOTLPAttributeLabelName(t *testing.T) {
+	for key, expected := range map[string]model.LabelName{
+		"host_name":              "host_name",
+		"deployment.environment": "deployment_environment",
+		"k8s.pod-name":           "k8s_pod_name",
+		"1st.attribute":          "key_1st_attribute",
+		"_private":               "key_private",
+		"__reserved":             "__reserved",
+	} {
+		assert.Equal(t, expected, otlpAttributeLabelName(key), key)
+	}
+}
+
+func TestOTLPResourceAttributesTest_ExpectedLabelsMatchTheOTLPTranslation(t *testing.T) {
+	cfg := OTLPResourceAttributesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.ResourceAttributes = []string{"deployment.environment=production", "k8s.pod-name=pod-1", "1st.attribute=value"}
+	require.NoError(t, cfg.Validate())
+
+	test := NewOTLPResourceAttributesTest(cfg, &ClientMock{}, log.NewNopLogger(), nil)
+	gauge, targetInfo, _ := test.expectedLabels()
+
+	// Translate the written metrics like Mimir does.
+	timestamp := time.Unix(1000*int64(writeInterval.Seconds()), 0)
+	tsMap, err := prometheusremotewrite.FromMetrics(generateOTLPResourceAttributesMetrics(timestamp, cfg.ServiceInstanceID, test.attributes), prometheusremotewrite.Settings{})
+	require.NoError(t, err)
+
+	actual := map[model.Fingerprint]model.Metric{}
+	for _, series := range tsMap {
+		metric := model.Metric{}
+		for _, l := range series.Labels {
+			metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+		}
+		actual[metric.Fingerprint()] = metric
+
+		require.Len(t, series.Samples, 1)
+		assert.Equal(t, timestamp.UnixMilli(), series.Samples[0].Timestamp)
+	}
+
+	assert.Equal(t, map[model.Fingerprint]model.Metric{
+		gauge.Fingerprint():      gauge,
+		targetInfo.Fingerprint(): targetInfo,
+	}, actual)
+}
+
+func TestOTLPResourceAttributesTest_Run(t *testing.T) {
+	cfg := OTLPResourceAttributesTestConfig{}
+	flagext.DefaultValues(&cfg)
+
+	const (
+		gaugeQuery      = `mimir_continuous_test_otlp_gauge{job="continuous-test/mimir-continuous-test", instance="mimir-continuous-test"}`
+		targetInfoQuery = `target_info{job="continuous-test/mimir-continuous-test", instance="mimir-continuous-test"}`
+		joinQuery       = `mimir_continuous_test_otlp_gauge{job="continuous-test/mimir-continuous-test", instance="mimir-continuous-test"} * on (job, instance) group_left (deployment_environment, host_name) target_info`
+	)
+
+	now := time.Unix(1000*int64(writeInterval.Seconds()), 0)
+	value := model.SampleValue(otlpResourceAttributesValue(now))
+
+	gauge := model.Metric{"__name__": "mimir_continuous_test_otlp_gauge", "job": "continuous-test/mimir-continuous-test", "instance": "mimir-continuous-test"}
+	targetInfo := model.Metric{"__name__": "target_info", "job": "continuous-test/mimir-continuous-test", "instance": "mimir-continuous-test", "deployment_environment": "continuous-test", "host_name": "mimir-continuous-test"}
+	joined := model.Metric{"job": "continuous-test/mimir-continuous-test", "instance": "mimir-continuous-test", "deployment_environment": "continuous-test", "host_name": "mimir-continuous-test"}
+
+	t.Run("should write the gauge and check the translated resource attributes", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteOTLPMetrics", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("Query", mock.Anything, gaugeQuery, now, mock.Anything).Return(model.Vector{{Metric: gauge, Value: value}}, nil)
+		client.On("Query", mock.Anything, targetInfoQuery, now, mock.Anything).Return(model.Vector{{Metric: targetInfo, Value: 1}}, nil)
+		client.On("Query", mock.Anything, joinQuery, now, mock.Anything).Return(model.Vector{{Metric: joined, Value: value}}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewOTLPResourceAttributesTest(cfg, client, log.NewNopLogger(), reg)
+
+		require.NoError(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "WriteOTLPMetrics", 1)
+		client.AssertNumberOfCalls(t, "Query", 3)
+
+		// The gauge is not written again at the same timestamp, but the results are checked again.
+		require.NoError(t, test.Run(context.Background(), now.Add(writeInterval/2)))
+		client.AssertNumberOfCalls(t, "WriteOTLPMetrics", 1)
+		client.AssertNumberOfCalls(t, "Query", 6)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_total Total number of query results checked for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_total counter
+			mimir_continuous_test_query_result_checks_total{test="otlp-resource-attributes"} 6
+
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="otlp-resource-attributes"} 0
+		`), "mimir_continuous_test_query_result_checks_total", "mimir_continuous_test_query_result_checks_failed_total"))
+	})
+
+	t.Run("should fail if the resource attributes are not translated as expected", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteOTLPMetrics", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("Query", mock.Anything, gaugeQuery, now, mock.Anything).Return(model.Vector{{Metric: gauge, Value: value}}, nil)
+		client.On("Query", mock.Anything, targetInfoQuery, now, mock.Anything).Return(model.Vector{{Metric: targetInfo.Clone(), Value: 1}}, nil)
+		client.On("Query", mock.Anything, joinQuery, now, mock.Anything).Return(model.Vector{}, nil)
+
+		// The attribute with the dot is not translated to the expected label name.
+		client.ExpectedCalls[2].ReturnArguments[0].(model.Vector)[0].Metric["deployment.environment"] = "continuous-test"
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewOTLPResourceAttributesTest(cfg, client, log.NewNopLogger(), reg)
+
+		err := test.Run(context.Background(), now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), targetInfoQuery)
+		assert.Contains(t, err.Error(), joinQuery)
+		assert.NotContains(t, err.Error(), "query "+gaugeQuery+":")
+
+		assert.Equal(t, float64(2), testutil.ToFloat64(test.metrics.queryResultChecksFailedTotal))
+	})
+
+	t.Run("should not check the query results if the write fails", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteOTLPMetrics", mock.Anything, mock.Anything).Return(500, errors.New("500 error"))
+
+		test := NewOTLPResourceAttributesTest(cfg, client, log.NewNopLogger(), nil)
+
+		require.Error(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "Query", 0)
+		assert.True(t, test.lastWrittenTimestamp.IsZero())
+	})
+}
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+// PerSeriesConfig configures the per-series values of the write-read series test, which make the values of each
+// written series distinct, so that individual series can be checked exactly.
+type PerSeriesConfig struct {
+	PerSeriesValuesEnabled  bool
+	PerSeriesCheckNumSeries int
+}
+
+func (cfg *PerSeriesConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.PerSeriesValuesEnabled, "tests.write-read-series-test.per-series-values-enabled", false, "When enabled, the value of each written series is offset by the index of the series, so that each series has distinct values, and on each test run a random sample of individual series is queried and each series is checked exactly. Changing this setting on a running test causes the previously written samples to fail the checks.")
+	f.IntVar(&cfg.PerSeriesCheckNumSeries, "tests.write-read-series-test.per-series-check-num-series", 10, "Number of individual series checked on each test run when -tests.write-read-series-test.per-series-values-enabled is enabled.")
+}
+
+func (cfg *PerSeriesConfig) Validate() error {
+	if cfg.PerSeriesValuesEnabled && cfg.PerSeriesCheckNumSeries <= 0 {
+		return errors.New("the number of series checked individually must be greater than 0 when per-series values are enabled")
+	}
+	return nil
+}
+
+// runPerSeriesCheck runs the per-series range query over the most recent hour of the first input time range,
+// if per-series values are enabled.
+func (t *WriteReadSeriesTest) runPerSeriesCheck(ctx context.Context, queryRanges [][2]time.Time, responseFormat string) error {
+	start, end, ok := mostRecentHour(queryRanges)
+	if !t.cfg.PerSeriesValuesEnabled || !ok {
+		return nil
+	}
+	return t.runPerSeriesQueryAndVerifyResult(ctx, start, end, responseFormat)
+}
+
+// runPerSeriesQueryAndVerifyResult runs a range query fetching a random sample of individual series, and verifies
+// that each series has exactly its own values. Only the series which are not replaced because of churn are sampled.
+func (t *WriteReadSeriesTest) runPerSeriesQueryAndVerifyResult(ctx context.Context, start, end time.Time, responseFormat string) (err error) {
+	start = maxTime(t.queryMinTime, alignTimestampToInterval(start, writeInterval))
+	end = minTime(t.queryMaxTime, alignTimestampToInterval(end, writeInterval))
+	if end.Before(start) {
+		return nil
+	}
+
+	step := getQueryStep(start, end, writeInterval)
+	seriesIDs := t.samplePerSeriesCheckIDs()
+	query := perSeriesQuery(t.metricName, seriesIDs)
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "WriteReadSeriesTest.runPerSeriesQueryAndVerifyResult")
+	defer sp.Finish()
+
+	setQueryTraceAttributes(sp.Span, query, start, end, step, false, responseFormat)
+	defer func() { _ = sp.Error(err) }()
+
+	logger := log.With(sp, "query", query, "start", start.UnixMilli(), "end", end.UnixMilli(), "step", step, "response_format", responseFormat)
+	level.Debug(logger).Log("msg", "Running per-series range query")
+
+	t.metrics.queriesTotal.Inc()
+	queryStart := time.Now()
+	matrix, err := t.client.QueryRange(ctx, query, start, end, step, WithResultsCacheEnabled(false), WithResponseFormat(responseFormat))
+	t.metrics.observeQueryDuration(queryTypeRange, false, queryStart)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute per-series range query", "err", err)
+		return errors.Wrap(err, "failed to execute per-series range query")
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	sp.SetTag("expected_series", len(seriesIDs))
+	sp.SetTag("actual_series", len(matrix))
+	t.metrics.queryResultChecksTotal.Inc()
+	err = t.verifyPerSeriesQueryResult(matrix, seriesIDs, start, end, step)
+	recordQueryResultCheck(ctx, end, err)
+	if err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Per-series range query result check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: query, Start: start, End: end, Step: step.String(), Error: err.Error()})
+		return errors.Wrap(err, "per-series range query result check failed")
+	}
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+
+	return nil
+}
+
+// samplePerSeriesCheckIDs returns a random sample of the IDs of the series which are not replaced because of churn,
+// sorted in ascending order. The value of each of these series is offset by its ID. When the ramp schedule is configured,
+// only the series written at all the steps of the schedule are sampled.
+func (t *WriteReadSeriesTest) samplePerSeriesCheckIDs() []int {
+	numSeries := t.cfg.NumSeries
+	if len(t.cfg.RampSchedule) > 0 {
+		numSeries = t.cfg.RampSchedule.minNumSeries()
+	}
+
+	numStableSeries := numSeries
+	if t.cfg.ChurnInterval > 0 {
+		numStableSeries -= int(math.Round(float64(numSeries) * t.cfg.ChurnFraction))
+	}
+
+	ids := rand.Perm(numStableSeries)
+	if len(ids) > t.cfg.PerSeriesCheckNumSeries {
+		ids = ids[:t.cfg.PerSeriesCheckNumSeries]
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// verifyPerSeriesQueryResult checks whether the input matrix is the expected result of a per-series range query
+// for the input series IDs, from start to end with the input step.
+func (t *WriteReadSeriesTest) verifyPerSeriesQueryResult(matrix model.Matrix, seriesIDs []int, start, end time.Time, step time.Duration) error {
+	if t.onlyGapsAtSteps(start, end, step) {
+		// No sample has been written at any of the queried timestamps, so the result is expected to be empty.
+		if len(matrix) > 0 {
+			return fmt.Errorf("expected no series in the result because no sample was written in the queried time range because of gap injection, but got %d", len(matrix))
+		}
+		return nil
+	}
+
+	if len(matrix) != len(seriesIDs) {
+		return fmt.Errorf("expected %d series in the result but got %d", len(seriesIDs), len(matrix))
+	}
+
+	for _, stream := range matrix {
+		seriesID, err := strconv.Atoi(string(stream.Metric["series_id"]))
+		if idx := sort.SearchInts(seriesIDs, seriesID); err != nil || idx == len(seriesIDs) || seriesIDs[idx] != seriesID {
+			return fmt.Errorf("unexpected series %s in the result", stream.Metric.String())
+		}
+
+		offset := float64(seriesID)
+		wave := func(ts time.Time) float64 {
+			return t.waveform(ts) + offset
+		}
+		if _, err := verifyWaveSamplesSumWithGaps(model.Matrix{stream}, wave, 1, step, t.isGap); err != nil {
+			return errors.Wrapf(err, "series with series_id %d", seriesID)
+		}
+	}
+	return nil
+}
+
+// perSeriesQuery returns the query fetching the samples of the series of the input metric with the input IDs.
+func perSeriesQuery(metricName string, seriesIDs []int) string {
+	ids := make([]string, 0, len(seriesIDs))
+	for _, id := range seriesIDs {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	return fmt.Sprintf("max_over_time(%s{series_id=~\"%s\"}[1s])", metricName, strings.Join(ids, "|"))
+}
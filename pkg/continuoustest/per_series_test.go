@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerSeriesConfig_Validate(t *testing.T) {
+	cfg := PerSeriesConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.PerSeriesValuesEnabled = true
+	assert.NoError(t, cfg.Validate())
+
+	cfg.PerSeriesCheckNumSeries = 0
+	assert.Error(t, cfg.Validate())
+}
+
+func TestWriteReadSeriesTest_Run_PerSeriesValues(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 3
+	cfg.PerSeriesValuesEnabled = true
+
+	now := time.Unix(1000, 0)
+	const perSeriesQuery = `max_over_time(mimir_continuous_test_sine_wave{series_id=~"0|1|2"}[1s])`
+
+	// The sum of the series is offset by the sum of the per-series offsets: 0 + 1 + 2.
+	sum := 3*generateSineWaveValue(now) + 3
+
+	perSeriesResult := func(offsets ...float64) model.Matrix {
+		matrix := model.Matrix{}
+		for id, offset := range offsets {
+			matrix = append(matrix, &model.SampleStream{
+				Metric: model.Metric{"series_id": model.LabelValue(strconv.Itoa(id))},
+				Values: []model.SamplePair{newSamplePair(now, generateSineWaveValue(now)+offset)},
+			})
+		}
+		return matrix
+	}
+
+	for name, tc := range map[string]struct {
+		perSeriesResult  model.Matrix
+		expectedFailures int
+	}{
+		"results match": {
+			perSeriesResult:  perSeriesResult(0, 1, 2),
+			expectedFailures: 0,
+		},
+		"a series has a corrupted value": {
+			perSeriesResult:  perSeriesResult(0, 2, 1),
+			expectedFailures: 1,
+		},
+		"a series is missing": {
+			perSeriesResult:  perSeriesResult(0, 1),
+			expectedFailures: 1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := &ClientMock{}
+			client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+			client.On("QueryRange", mock.Anything, queryMetricSum, now, now, writeInterval, mock.Anything).Return(model.Matrix{{Values: []model.SamplePair{newSamplePair(now, sum)}}}, nil)
+			client.On("QueryRange", mock.Anything, perSeriesQuery, now, now, writeInterval, mock.Anything).Return(tc.perSeriesResult, nil)
+			client.On("Query", mock.Anything, queryMetricSum, now, mock.Anything).Return(model.Vector{{Timestamp: model.Time(now.UnixMilli()), Value: model.SampleValue(sum)}}, nil)
+
+			test := NewWriteReadSeriesTest(cfg, client, log.NewNopLogger(), nil)
+			err := test.Run(context.Background(), now)
+			if tc.expectedFailures == 0 {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+
+			// Each series is written with its own offset.
+			expectedSeries := generateSineWaveSeries(metricName, now, 3)
+			for i := range expectedSeries {
+				expectedSeries[i].Samples[0].Value += float64(i)
+			}
+			client.AssertCalled(t, "WriteSeries", mock.Anything, expectedSeries)
+			client.AssertNumberOfCalls(t, "QueryRange", 5)
+
+			assert.Equal(t, float64(tc.expectedFailures), testutil.ToFloat64(test.metrics.queryResultChecksFailedTotal))
+		})
+	}
+}
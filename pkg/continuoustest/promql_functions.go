@@ -0,0 +1,377 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	promqlFunctionsCounterMetricName         = "mimir_continuous_test_promql_functions_counter"
+	promqlFunctionsGaugeMetricName           = "mimir_continuous_test_promql_functions_gauge"
+	promqlFunctionsClassicHistogramName      = "mimir_continuous_test_promql_functions_classic_histogram"
+	promqlFunctionsNativeHistogramMetricName = "mimir_continuous_test_promql_functions_native_histogram"
+
+	// promqlFunctionsRange is the range of the range vector selectors in the test queries. The test queries
+	// are run only once the samples have been written without gaps for at least this range.
+	promqlFunctionsRange = 5 * time.Minute
+
+	// promqlFunctionsPeriod is the number of write intervals after which the written values restart from zero,
+	// so that they stay small enough to be compared exactly. The test queries are not run while their range
+	// spans the restart.
+	promqlFunctionsPeriod = 1000
+
+	// promqlFunctionsCounterIncrease is the increase of the counter every write interval, and
+	// promqlFunctionsGaugeIncrease is the increase of the gauge.
+	promqlFunctionsCounterIncrease = 3
+	promqlFunctionsGaugeIncrease   = 0.5
+)
+
+var (
+	// promqlFunctionsRangeSamples is the number of samples within the range of the test queries. The range
+	// selects the samples with timestamp in [ts - range, ts], which are all aligned to the write interval.
+	promqlFunctionsRangeSamples = float64(promqlFunctionsRange/writeInterval) + 1
+
+	// promqlFunctionsHistogramBucketObservations is the number of observations added every write interval to the
+	// buckets (0.5, 1], (1, 2] and (2, 4] of the native histogram, which are consecutive buckets of the schema 0.
+	// The same observations are added to the classic histogram, whose upper bounds are
+	// promqlFunctionsClassicHistogramBucketBounds and whose +Inf bucket gets no additional observations.
+	// promqlFunctionsHistogramObservationsSum is the sum of the values of the observations: 1, 1.5 twice and 3.
+	promqlFunctionsClassicHistogramBucketBounds = []float64{1, 2, 4, math.Inf(+1)}
+	promqlFunctionsHistogramBucketObservations  = []float64{1, 2, 1}
+	promqlFunctionsHistogramObservationsSum     = 1 + 2*1.5 + 3.0
+	promqlFunctionsHistogramObservationsCount   = 4.0
+
+	promqlFunctionsRangeSelector = "[" + model.Duration(promqlFunctionsRange).String() + "]"
+	promqlFunctionsCounterRange  = promqlFunctionsCounterMetricName + promqlFunctionsRangeSelector
+	promqlFunctionsGaugeRange    = promqlFunctionsGaugeMetricName + promqlFunctionsRangeSelector
+	promqlFunctionsBucketsRate   = "rate(" + promqlFunctionsClassicHistogramName + "_bucket" + promqlFunctionsRangeSelector + ")"
+	promqlFunctionsNativeRate    = "rate(" + promqlFunctionsNativeHistogramMetricName + promqlFunctionsRangeSelector + ")"
+)
+
+// promqlFunctionsQuery is a test query, whose expected result is derived from the function of the timestamp
+// which gives the values of the written series.
+type promqlFunctionsQuery struct {
+	query string
+
+	// expected returns the expected result of the query at the timestamp of the input write interval
+	// within the period.
+	expected func(interval float64) float64
+
+	// nativeHistograms is whether the query reads the native histogram.
+	nativeHistograms bool
+}
+
+// promqlFunctionsQueries are the test queries. For the range functions, the values of the counter and of the gauge
+// are linear within the range, so the expected results are derived from the arithmetic progression of the samples.
+var promqlFunctionsQueries = []promqlFunctionsQuery{
+	// Counter functions. The first and the last samples are at the boundaries of the range, so the rate is not
+	// extrapolated.
+	{query: "rate(" + promqlFunctionsCounterRange + ")", expected: promqlFunctionsConstant(promqlFunctionsCounterIncrease / writeInterval.Seconds())},
+	{query: "irate(" + promqlFunctionsCounterRange + ")", expected: promqlFunctionsConstant(promqlFunctionsCounterIncrease / writeInterval.Seconds())},
+	{query: "increase(" + promqlFunctionsCounterRange + ")", expected: promqlFunctionsConstant(promqlFunctionsCounterIncrease * (promqlFunctionsRangeSamples - 1))},
+	{query: "resets(" + promqlFunctionsCounterRange + ")", expected: promqlFunctionsConstant(0)},
+
+	// Gauge functions. The linear regression fits the samples exactly.
+	{query: "deriv(" + promqlFunctionsGaugeRange + ")", expected: promqlFunctionsConstant(promqlFunctionsGaugeIncrease / writeInterval.Seconds())},
+	{query: "delta(" + promqlFunctionsGaugeRange + ")", expected: promqlFunctionsConstant(promqlFunctionsGaugeIncrease * (promqlFunctionsRangeSamples - 1))},
+	{query: "predict_linear(" + promqlFunctionsGaugeRange + ", 60)", expected: func(interval float64) float64 {
+		return promqlFunctionsGaugeValue(interval) + 60*promqlFunctionsGaugeIncrease/writeInterval.Seconds()
+	}},
+
+	// Aggregations over time.
+	{query: "count_over_time(" + promqlFunctionsGaugeRange + ")", expected: promqlFunctionsConstant(promqlFunctionsRangeSamples)},
+	{query: "sum_over_time(" + promqlFunctionsGaugeRange + ")", expected: func(interval float64) float64 {
+		return promqlFunctionsRangeSamples * promqlFunctionsGaugeQuantileOverRange(interval, 0.5)
+	}},
+	{query: "avg_over_time(" + promqlFunctionsGaugeRange + ")", expected: func(interval float64) float64 {
+		return promqlFunctionsGaugeQuantileOverRange(interval, 0.5)
+	}},
+	{query: "min_over_time(" + promqlFunctionsGaugeRange + ")", expected: func(interval float64) float64 {
+		return promqlFunctionsGaugeQuantileOverRange(interval, 0)
+	}},
+	{query: "max_over_time(" + promqlFunctionsGaugeRange + ")", expected: promqlFunctionsGaugeValue},
+	{query: "quantile_over_time(0.5, " + promqlFunctionsGaugeRange + ")", expected: func(interval float64) float64 {
+		return promqlFunctionsGaugeQuantileOverRange(interval, 0.5)
+	}},
+	{query: "quantile_over_time(0.9, " + promqlFunctionsGaugeRange + ")", expected: func(interval float64) float64 {
+		return promqlFunctionsGaugeQuantileOverRange(interval, 0.9)
+	}},
+	{query: "stddev_over_time(" + promqlFunctionsGaugeRange + ")", expected: promqlFunctionsConstant(promqlFunctionsGaugeIncrease * math.Sqrt((promqlFunctionsRangeSamples*promqlFunctionsRangeSamples-1)/12))},
+
+	// Classic histogram functions. The quantiles are linearly interpolated within the bucket they fall into:
+	// the median falls halfway through the bucket (1, 2], and the 90th percentile at 60% of the bucket (2, 4].
+	{query: "histogram_quantile(0.5, " + promqlFunctionsBucketsRate + ")", expected: promqlFunctionsConstant(1.5)},
+	{query: "histogram_quantile(0.9, " + promqlFunctionsBucketsRate + ")", expected: promqlFunctionsConstant(3.2)},
+
+	// Native histogram functions.
+	{query: "histogram_count(" + promqlFunctionsNativeHistogramMetricName + ")", nativeHistograms: true, expected: func(interval float64) float64 {
+		return interval * promqlFunctionsHistogramObservationsCount
+	}},
+	{query: "histogram_sum(" + promqlFunctionsNativeHistogramMetricName + ")", nativeHistograms: true, expected: func(interval float64) float64 {
+		return interval * promqlFunctionsHistogramObservationsSum
+	}},
+	{query: "histogram_count(" + promqlFunctionsNativeRate + ")", nativeHistograms: true, expected: promqlFunctionsConstant(promqlFunctionsHistogramObservationsCount / writeInterval.Seconds())},
+	{query: "histogram_sum(" + promqlFunctionsNativeRate + ")", nativeHistograms: true, expected: promqlFunctionsConstant(promqlFunctionsHistogramObservationsSum / writeInterval.Seconds())},
+	{query: "histogram_fraction(0, 2, " + promqlFunctionsNativeRate + ")", nativeHistograms: true, expected: promqlFunctionsConstant(3 / promqlFunctionsHistogramObservationsCount)},
+}
+
+type PromQLFunctionsTestConfig struct {
+	Enabled                 bool
+	NativeHistogramsEnabled bool
+}
+
+func (cfg *PromQLFunctionsTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.promql-functions-test.enabled", false, "Enable the test which periodically writes a counter, a gauge and a classic histogram whose values are a linear function of the timestamp, and checks whether a curated set of PromQL functions returns the results analytically derived from the written values.")
+	f.BoolVar(&cfg.NativeHistogramsEnabled, "tests.promql-functions-test.native-histograms-enabled", false, "Also write a native histogram and check the results of the native histogram functions. It requires the ingestion of native histograms to be enabled in Mimir.")
+}
+
+// PromQLFunctionsTest periodically writes series whose values are a linear function of the timestamp, and checks
+// the results of a curated set of PromQL functions, which are derived exactly from the written values, in order to
+// detect regressions of the query engine which wouldn't be caught by the checks of the sums of the series.
+type PromQLFunctionsTest struct {
+	name    string
+	cfg     PromQLFunctionsTestConfig
+	client  MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	lastWrittenTimestamp time.Time
+
+	// The oldest timestamp since which samples have been written without gaps, or zero if none.
+	contiguousSince time.Time
+}
+
+func NewPromQLFunctionsTest(cfg PromQLFunctionsTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *PromQLFunctionsTest {
+	const name = "promql-functions"
+
+	return &PromQLFunctionsTest{
+		name:    name,
+		cfg:     cfg,
+		client:  client,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+	}
+}
+
+// Name implements Test.
+func (t *PromQLFunctionsTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *PromQLFunctionsTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *PromQLFunctionsTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	// Write samples for each expected timestamp until now.
+	for timestamp := t.nextWriteTimestamp(now); !timestamp.After(now); timestamp = t.nextWriteTimestamp(now) {
+		if err := t.writeSamples(ctx, timestamp); err != nil {
+			return err
+		}
+	}
+
+	// The functions can be checked only if there are no gaps in the samples within the range, and the values
+	// haven't restarted from zero within the range.
+	if t.contiguousSince.IsZero() || t.lastWrittenTimestamp.Sub(t.contiguousSince) < promqlFunctionsRange {
+		return nil
+	}
+	ts := t.lastWrittenTimestamp
+	interval := promqlFunctionsInterval(ts)
+	if interval < promqlFunctionsRangeSamples-1 {
+		return nil
+	}
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "PromQLFunctionsTest.Run")
+	defer sp.Finish()
+
+	errs := multierror.New()
+	for _, q := range promqlFunctionsQueries {
+		if q.nativeHistograms && !t.cfg.NativeHistogramsEnabled {
+			continue
+		}
+		errs.Add(t.runQueryAndVerifyResult(ctx, sp, q.query, ts, q.expected(interval)))
+	}
+	return errs.Err()
+}
+
+func (t *PromQLFunctionsTest) nextWriteTimestamp(now time.Time) time.Time {
+	if t.lastWrittenTimestamp.IsZero() {
+		return alignTimestampToInterval(now, writeInterval)
+	}
+
+	return t.lastWrittenTimestamp.Add(writeInterval)
+}
+
+func (t *PromQLFunctionsTest) writeSamples(ctx context.Context, timestamp time.Time) error {
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "PromQLFunctionsTest.writeSamples")
+	defer sp.Finish()
+	logger := log.With(sp, "timestamp", timestamp.UnixMilli())
+
+	start := time.Now()
+	statusCode, err := t.client.WriteSeries(ctx, generatePromQLFunctionsSeries(timestamp, t.cfg.NativeHistogramsEnabled))
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+
+	t.metrics.writesTotal.Inc()
+	if statusCode/100 != 2 {
+		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Failed to remote write series", "status_code", statusCode, "err", err)
+	} else {
+		t.metrics.observeSuccess(outcomeTypeWrite)
+	}
+
+	// If the write request failed because of a 4xx error, retrying the request isn't expected to succeed.
+	// We keep writing the next interval, but the samples are not contiguous anymore.
+	if statusCode/100 == 4 {
+		t.lastWrittenTimestamp = timestamp
+		t.contiguousSince = time.Time{}
+		return nil
+	}
+
+	// If the write request failed because of a network or 5xx error, we'll retry to write series
+	// in the next test run.
+	if statusCode/100 != 2 {
+		return errors.Wrapf(err, "remote write series failed with status code %d", statusCode)
+	}
+
+	t.lastWrittenTimestamp = timestamp
+	if t.contiguousSince.IsZero() {
+		t.contiguousSince = timestamp
+	}
+	return nil
+}
+
+func (t *PromQLFunctionsTest) runQueryAndVerifyResult(ctx context.Context, logger log.Logger, query string, ts time.Time, expected float64) error {
+	logger = log.With(logger, "query", query, "ts", ts.UnixMilli())
+
+	t.metrics.queriesTotal.Inc()
+	start := time.Now()
+	vector, err := t.client.Query(ctx, query, ts, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute instant query", "err", err)
+		return errors.Wrapf(err, "failed to execute instant query %s", query)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	t.metrics.queryResultChecksTotal.Inc()
+	if err := verifyPromQLFunctionsResult(vector, expected); err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Query result check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: query, Start: ts, End: ts, Error: err.Error()})
+		return errors.Wrapf(err, "query result check failed for query %s", query)
+	}
+
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+	level.Debug(logger).Log("msg", "Query result check succeeded")
+	return nil
+}
+
+func verifyPromQLFunctionsResult(vector model.Vector, expected float64) error {
+	if len(vector) != 1 {
+		return fmt.Errorf("expected 1 series in the result but got %d", len(vector))
+	}
+	if actual := float64(vector[0].Value); !compareSampleValues(actual, expected) {
+		return fmt.Errorf("expected value %f but got %f", expected, actual)
+	}
+	return nil
+}
+
+// generatePromQLFunctionsSeries returns the counter, the gauge and the classic histogram series at the input
+// timestamp, plus the native histogram if enabled. The values grow linearly with the number of write intervals
+// since the beginning of the period.
+func generatePromQLFunctionsSeries(t time.Time, nativeHistograms bool) []prompb.TimeSeries {
+	interval := promqlFunctionsInterval(t)
+	out := make([]prompb.TimeSeries, 0, len(promqlFunctionsClassicHistogramBucketBounds)+5)
+
+	newSeries := func(name string, value float64, extraLabels ...prompb.Label) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels:  append([]prompb.Label{{Name: "__name__", Value: name}}, extraLabels...),
+			Samples: []prompb.Sample{{Value: value, Timestamp: t.UnixMilli()}},
+		}
+	}
+
+	out = append(out, newSeries(promqlFunctionsCounterMetricName, interval*promqlFunctionsCounterIncrease))
+	out = append(out, newSeries(promqlFunctionsGaugeMetricName, promqlFunctionsGaugeValue(interval)))
+
+	cumulative := 0.0
+	for b, bound := range promqlFunctionsClassicHistogramBucketBounds {
+		if b < len(promqlFunctionsHistogramBucketObservations) {
+			cumulative += promqlFunctionsHistogramBucketObservations[b]
+		}
+		le := strconv.FormatFloat(bound, 'f', -1, 64)
+		out = append(out, newSeries(promqlFunctionsClassicHistogramName+"_bucket", interval*cumulative, prompb.Label{Name: "le", Value: le}))
+	}
+	out = append(out, newSeries(promqlFunctionsClassicHistogramName+"_sum", interval*promqlFunctionsHistogramObservationsSum))
+	out = append(out, newSeries(promqlFunctionsClassicHistogramName+"_count", interval*promqlFunctionsHistogramObservationsCount))
+
+	if nativeHistograms {
+		// The bucket counts are delta-encoded.
+		deltas := make([]int64, 0, len(promqlFunctionsHistogramBucketObservations))
+		prev := 0.0
+		for _, observations := range promqlFunctionsHistogramBucketObservations {
+			deltas = append(deltas, int64(interval*(observations-prev)))
+			prev = observations
+		}
+
+		out = append(out, prompb.TimeSeries{
+			Labels: []prompb.Label{{Name: "__name__", Value: promqlFunctionsNativeHistogramMetricName}},
+			Histograms: []prompb.Histogram{{
+				Count:          &prompb.Histogram_CountInt{CountInt: uint64(interval * promqlFunctionsHistogramObservationsCount)},
+				Sum:            interval * promqlFunctionsHistogramObservationsSum,
+				Schema:         0,
+				ZeroThreshold:  1e-128,
+				ZeroCount:      &prompb.Histogram_ZeroCountInt{ZeroCountInt: 0},
+				PositiveSpans:  []prompb.BucketSpan{{Offset: 0, Length: uint32(len(deltas))}},
+				PositiveDeltas: deltas,
+				Timestamp:      t.UnixMilli(),
+			}},
+		})
+	}
+
+	return out
+}
+
+// promqlFunctionsInterval returns the number of write intervals from the beginning of the period to the input
+// timestamp.
+func promqlFunctionsInterval(t time.Time) float64 {
+	return float64((t.UnixMilli() / writeInterval.Milliseconds()) % promqlFunctionsPeriod)
+}
+
+func promqlFunctionsGaugeValue(interval float64) float64 {
+	return interval * promqlFunctionsGaugeIncrease
+}
+
+// promqlFunctionsGaugeQuantileOverRange returns the quantile q of the gauge samples within the range ending at the
+// input write interval, computed like quantile_over_time() does: the samples are evenly spaced, so the quantile is
+// the value at the rank q*(n-1) of the samples.
+func promqlFunctionsGaugeQuantileOverRange(interval, q float64) float64 {
+	return promqlFunctionsGaugeValue(interval - (1-q)*(promqlFunctionsRangeSamples-1))
+}
+
+func promqlFunctionsConstant(value float64) func(float64) float64 {
+	return func(float64) float64 { return value }
+}
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/prometheus/prometheus/util/teststorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// promqlFunctionsPeriodStart is the timestamp of the first write interval of a period.
+var promqlFunctionsPeriodStart = time.Unix(5*promqlFunctionsPeriod*int64(writeInterval.Seconds()), 0)
+
+func TestPromQLFunctionsQueries_ShouldMatchThePrometheusEngine(t *testing.T) {
+	db := teststorage.New(t)
+	t.Cleanup(func() { _ = db.Close() })
+
+	// Write a few ranges of samples, starting from the beginning of a period.
+	const numIntervals = 3 * promqlFunctionsPeriod / 100
+	app := db.Appender(context.Background())
+	for i := 0; i < numIntervals; i++ {
+		for _, series := range generatePromQLFunctionsSeries(promqlFunctionsPeriodStart.Add(time.Duration(i)*writeInterval), true) {
+			lbls := labels.Labels{}
+			for _, l := range series.Labels {
+				lbls = append(lbls, labels.Label{Name: l.Name, Value: l.Value})
+			}
+			for _, s := range series.Samples {
+				_, err := app.Append(0, lbls, s.Timestamp, s.Value)
+				require.NoError(t, err)
+			}
+			for _, h := range series.Histograms {
+				_, err := app.AppendHistogram(0, lbls, h.Timestamp, remote.HistogramProtoToHistogram(h), nil)
+				require.NoError(t, err)
+			}
+		}
+	}
+	require.NoError(t, app.Commit())
+
+	engine := promql.NewEngine(promql.EngineOpts{
+		Logger:     log.NewNopLogger(),
+		MaxSamples: 1e6,
+		Timeout:    time.Minute,
+	})
+
+	// Check the queries at each write interval whose range doesn't span the beginning of the period.
+	for i := int(promqlFunctionsRangeSamples) - 1; i < numIntervals; i++ {
+		ts := promqlFunctionsPeriodStart.Add(time.Duration(i) * writeInterval)
+		require.Equal(t, float64(i), promqlFunctionsInterval(ts))
+
+		for _, q := range promqlFunctionsQueries {
+			query, err := engine.NewInstantQuery(db, nil, q.query, ts)
+			require.NoError(t, err)
+			res := query.Exec(context.Background())
+			require.NoError(t, res.Err, q.query)
+
+			vector, err := res.Vector()
+			require.NoError(t, err, q.query)
+			require.Len(t, vector, 1, q.query)
+			assert.InDelta(t, q.expected(float64(i)), vector[0].V, maxComparisonDelta, "query: %s interval: %d", q.query, i)
+			query.Close()
+		}
+	}
+}
+
+func TestPromQLFunctionsTest_Run(t *testing.T) {
+	// The first run writes the beginning of the period, and the next one the following range.
+	first := promqlFunctionsPeriodStart
+	second := first.Add(promqlFunctionsRange)
+
+	// mockQueries mocks the response of each test query with its expected result at the second run.
+	mockQueries := func(client *ClientMock) {
+		for _, q := range promqlFunctionsQueries {
+			client.On("Query", mock.Anything, q.query, second, mock.Anything).Return(model.Vector{{Value: model.SampleValue(q.expected(promqlFunctionsInterval(second)))}}, nil)
+		}
+	}
+
+	t.Run("should check the query results once samples have been written without gaps for the range", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		mockQueries(client)
+
+		test := NewPromQLFunctionsTest(PromQLFunctionsTestConfig{NativeHistogramsEnabled: true}, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+		require.NoError(t, test.Run(context.Background(), first))
+		client.AssertNumberOfCalls(t, "Query", 0)
+
+		require.NoError(t, test.Run(context.Background(), second))
+		client.AssertNumberOfCalls(t, "WriteSeries", int(promqlFunctionsRangeSamples))
+		client.AssertNumberOfCalls(t, "Query", len(promqlFunctionsQueries))
+	})
+
+	t.Run("should not check the native histogram functions if native histograms are disabled", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.MatchedBy(func(series []prompb.TimeSeries) bool {
+			for _, s := range series {
+				if len(s.Histograms) > 0 {
+					return false
+				}
+			}
+			return true
+		})).Return(200, nil)
+		mockQueries(client)
+
+		test := NewPromQLFunctionsTest(PromQLFunctionsTestConfig{}, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+		require.NoError(t, test.Run(context.Background(), first))
+		require.NoError(t, test.Run(context.Background(), second))
+
+		for _, call := range client.Calls {
+			if call.Method == "Query" {
+				assert.NotContains(t, call.Arguments.String(1), promqlFunctionsNativeHistogramMetricName)
+			}
+		}
+	})
+
+	t.Run("should fail if the query results don't match the expected values", func(t *testing.T) {
+		const rateQuery = "rate(mimir_continuous_test_promql_functions_counter[5m])"
+
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("Query", mock.Anything, rateQuery, mock.Anything, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+		mockQueries(client)
+
+		test := NewPromQLFunctionsTest(PromQLFunctionsTestConfig{}, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+		require.NoError(t, test.Run(context.Background(), first))
+
+		err := test.Run(context.Background(), second)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "query result check failed for query "+rateQuery)
+		assert.NotContains(t, err.Error(), "deriv")
+	})
+
+	t.Run("should not check the query results if the range spans the beginning of the period", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+
+		test := NewPromQLFunctionsTest(PromQLFunctionsTestConfig{}, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+		require.NoError(t, test.Run(context.Background(), first.Add(-promqlFunctionsRange)))
+		require.NoError(t, test.Run(context.Background(), second.Add(-writeInterval)))
+		client.AssertNumberOfCalls(t, "Query", 0)
+	})
+
+	t.Run("should not check the query results if there's a gap in the written samples", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(400, errors.New("bad request")).Once()
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+
+		test := NewPromQLFunctionsTest(PromQLFunctionsTestConfig{}, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+		require.NoError(t, test.Run(context.Background(), first))
+		require.NoError(t, test.Run(context.Background(), second))
+		client.AssertNumberOfCalls(t, "Query", 0)
+	})
+}
@@ -0,0 +1,270 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+// Functions of the query evaluation time the expected value of a query assertion can be computed with.
+const (
+	queryAssertionFunctionConstant = "constant"
+	queryAssertionFunctionTime     = "time"
+	queryAssertionFunctionSineWave = "sine_wave"
+)
+
+type QueryAssertionsTestConfig struct {
+	Enabled    bool
+	ConfigFile string
+	QueryDelay time.Duration
+}
+
+func (cfg *QueryAssertionsTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.query-assertions-test.enabled", false, "Enable the test which periodically runs the instant queries configured in the assertions file, and checks whether each query returns the expected value.")
+	f.StringVar(&cfg.ConfigFile, "tests.query-assertions-test.config-file", "", "Path to the YAML file containing the query assertions.")
+	f.DurationVar(&cfg.QueryDelay, "tests.query-assertions-test.query-delay", 5*time.Minute, "How far in the past from the test run time the queries are evaluated. It should be at least the run interval, so that the samples have already been written by the other tests.")
+}
+
+func (cfg *QueryAssertionsTestConfig) Validate() error {
+	if cfg.ConfigFile == "" {
+		return errors.New("the query assertions config file must be set")
+	}
+	if cfg.QueryDelay < 0 {
+		return errors.New("the query assertions query delay must be greater than or equal to 0")
+	}
+	return nil
+}
+
+// QueryAssertionsConfig is the content of the query assertions config file.
+type QueryAssertionsConfig struct {
+	Assertions []QueryAssertion `yaml:"assertions"`
+}
+
+// QueryAssertion is an instant query whose result is expected to be a single sample with the expected value.
+type QueryAssertion struct {
+	Name     string                 `yaml:"name"`
+	Query    string                 `yaml:"query"`
+	Expected QueryAssertionExpected `yaml:"expected"`
+
+	// Tolerance is the maximum absolute difference allowed between the actual and expected value.
+	// If 0, the values are compared with the default relative tolerance used by the other tests.
+	Tolerance float64 `yaml:"tolerance"`
+}
+
+// QueryAssertionExpected defines the expected value of a query assertion, computed as
+// value + scale * function(t), where t is the query evaluation time.
+type QueryAssertionExpected struct {
+	Function string   `yaml:"function"`
+	Value    float64  `yaml:"value"`
+	Scale    *float64 `yaml:"scale"`
+}
+
+// at returns the expected value at the input query evaluation time.
+func (e QueryAssertionExpected) at(ts time.Time) float64 {
+	scale := 1.0
+	if e.Scale != nil {
+		scale = *e.Scale
+	}
+
+	switch e.Function {
+	case queryAssertionFunctionTime:
+		return e.Value + scale*float64(ts.Unix())
+	case queryAssertionFunctionSineWave:
+		return e.Value + scale*generateSineWaveValue(ts)
+	default:
+		return e.Value
+	}
+}
+
+// matches returns whether the actual value matches the expected one at the input query evaluation time.
+func (a QueryAssertion) matches(actual float64, ts time.Time) bool {
+	expected := a.Expected.at(ts)
+	if a.Tolerance > 0 {
+		return math.Abs(actual-expected) <= a.Tolerance
+	}
+	return compareSampleValues(actual, expected)
+}
+
+func (c *QueryAssertionsConfig) Validate() error {
+	if len(c.Assertions) == 0 {
+		return errors.New("no query assertions configured")
+	}
+
+	names := make(map[string]struct{}, len(c.Assertions))
+	for i, a := range c.Assertions {
+		if a.Name == "" {
+			return fmt.Errorf("the query assertion at index %d has no name", i)
+		}
+		if _, ok := names[a.Name]; ok {
+			return fmt.Errorf("duplicate query assertion name %q", a.Name)
+		}
+		names[a.Name] = struct{}{}
+
+		if _, err := parser.ParseExpr(a.Query); err != nil {
+			return errors.Wrapf(err, "invalid query of the query assertion %q", a.Name)
+		}
+
+		switch a.Expected.Function {
+		case "", queryAssertionFunctionConstant, queryAssertionFunctionTime, queryAssertionFunctionSineWave:
+		default:
+			return fmt.Errorf("unsupported expected value function %q of the query assertion %q (supported values: %s, %s, %s)", a.Expected.Function, a.Name, queryAssertionFunctionConstant, queryAssertionFunctionTime, queryAssertionFunctionSineWave)
+		}
+
+		if a.Tolerance < 0 {
+			return fmt.Errorf("the tolerance of the query assertion %q must be greater than or equal to 0", a.Name)
+		}
+	}
+
+	return nil
+}
+
+// LoadQueryAssertionsConfig loads and validates the query assertions config file.
+func LoadQueryAssertionsConfig(path string) (*QueryAssertionsConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the query assertions config file")
+	}
+
+	cfg := &QueryAssertionsConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the query assertions config file")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid query assertions config file")
+	}
+	return cfg, nil
+}
+
+// QueryAssertionsTest periodically runs user-defined instant queries against the data written by the other tests,
+// and checks whether each query returns the expected value.
+type QueryAssertionsTest struct {
+	name    string
+	cfg     QueryAssertionsTestConfig
+	client  MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	assertionChecksFailed *prometheus.CounterVec
+
+	// The assertions are loaded from the config file when the test is initialized.
+	assertions []QueryAssertion
+}
+
+func NewQueryAssertionsTest(cfg QueryAssertionsTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *QueryAssertionsTest {
+	const name = "query-assertions"
+
+	return &QueryAssertionsTest{
+		name:    name,
+		cfg:     cfg,
+		client:  client,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+		assertionChecksFailed: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_query_assertion_checks_failed_total",
+			Help:        "Total number of query assertion checks failed, by assertion.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"assertion"}),
+	}
+}
+
+// Name implements Test.
+func (t *QueryAssertionsTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *QueryAssertionsTest) Init(_ context.Context, _ time.Time) error {
+	cfg, err := LoadQueryAssertionsConfig(t.cfg.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	t.assertions = cfg.Assertions
+	for _, a := range t.assertions {
+		t.assertionChecksFailed.WithLabelValues(a.Name)
+	}
+
+	level.Info(t.logger).Log("msg", "Query assertions loaded", "num_assertions", len(t.assertions))
+	return nil
+}
+
+// Run implements Test.
+func (t *QueryAssertionsTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	// Evaluate the queries at the timestamp of a written sample.
+	ts := alignTimestampToInterval(now.Add(-t.cfg.QueryDelay), writeInterval)
+
+	errs := multierror.New()
+	for _, a := range t.assertions {
+		errs.Add(t.runAssertion(ctx, a, ts))
+	}
+	return errs.Err()
+}
+
+func (t *QueryAssertionsTest) runAssertion(ctx context.Context, a QueryAssertion, ts time.Time) error {
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "QueryAssertionsTest.runAssertion")
+	defer sp.Finish()
+	logger := log.With(sp, "assertion", a.Name, "query", a.Query, "ts", ts.UnixMilli())
+
+	t.metrics.queriesTotal.Inc()
+	start := time.Now()
+	vector, err := t.client.Query(ctx, a.Query, ts, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute instant query", "err", err)
+		return errors.Wrapf(err, "failed to execute instant query of the query assertion %q", a.Name)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	t.metrics.queryResultChecksTotal.Inc()
+
+	if err := verifyQueryAssertion(a, vector, ts); err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		t.assertionChecksFailed.WithLabelValues(a.Name).Inc()
+		level.Warn(logger).Log("msg", "Query assertion check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: a.Query, Start: ts, End: ts, Error: err.Error()})
+		return errors.Wrapf(err, "query assertion %q check failed", a.Name)
+	}
+
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+	level.Debug(logger).Log("msg", "Query assertion check succeeded")
+	return nil
+}
+
+// verifyQueryAssertion checks whether the input vector contains a single sample with the expected value.
+func verifyQueryAssertion(a QueryAssertion, vector model.Vector, ts time.Time) error {
+	if len(vector) != 1 {
+		return fmt.Errorf("expected 1 series in the result but got %d", len(vector))
+	}
+
+	actual := float64(vector[0].Value)
+	if !a.matches(actual, ts) {
+		return fmt.Errorf("expected value %f but got %f", a.Expected.at(ts), actual)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadQueryAssertionsConfig(t *testing.T) {
+	tests := map[string]struct {
+		content     string
+		expectedErr string
+	}{
+		"valid config": {
+			content: `
+assertions:
+  - name: constant
+    query: vector(1)
+    expected:
+      value: 1
+  - name: sine-wave
+    query: sum(max_over_time(mimir_continuous_test_sine_wave[1s]))
+    expected:
+      function: sine_wave
+      scale: 10000
+    tolerance: 0.01
+`,
+		},
+		"no assertions": {
+			content:     `assertions: []`,
+			expectedErr: "no query assertions configured",
+		},
+		"unknown field": {
+			content: `
+assertions:
+  - name: constant
+    query: vector(1)
+    unknown: true
+`,
+			expectedErr: "failed to parse the query assertions config file",
+		},
+		"duplicate name": {
+			content: `
+assertions:
+  - name: constant
+    query: vector(1)
+  - name: constant
+    query: vector(2)
+`,
+			expectedErr: `duplicate query assertion name "constant"`,
+		},
+		"invalid query": {
+			content: `
+assertions:
+  - name: invalid
+    query: sum(
+`,
+			expectedErr: `invalid query of the query assertion "invalid"`,
+		},
+		"unsupported function": {
+			content: `
+assertions:
+  - name: unsupported
+    query: vector(1)
+    expected:
+      function: cosine_wave
+`,
+			expectedErr: `unsupported expected value function "cosine_wave"`,
+		},
+		"negative tolerance": {
+			content: `
+assertions:
+  - name: negative
+    query: vector(1)
+    tolerance: -1
+`,
+			expectedErr: `the tolerance of the query assertion "negative" must be greater than or equal to 0`,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "assertions.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(testData.content), 0o600))
+
+			cfg, err := LoadQueryAssertionsConfig(path)
+			if testData.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, cfg.Assertions, 2)
+			assert.Equal(t, 10000.0, *cfg.Assertions[1].Expected.Scale)
+		})
+	}
+}
+
+func TestQueryAssertionExpected_at(t *testing.T) {
+	ts := time.Unix(150, 0)
+	scale := 2.0
+
+	assert.Equal(t, 3.0, QueryAssertionExpected{Value: 3}.at(ts))
+	assert.Equal(t, 3.0, QueryAssertionExpected{Function: queryAssertionFunctionConstant, Value: 3, Scale: &scale}.at(ts))
+	assert.Equal(t, 303.0, QueryAssertionExpected{Function: queryAssertionFunctionTime, Value: 3, Scale: &scale}.at(ts))
+	assert.Equal(t, 150.0, QueryAssertionExpected{Function: queryAssertionFunctionTime}.at(ts))
+	assert.InDelta(t, 2*generateSineWaveValue(ts), QueryAssertionExpected{Function: queryAssertionFunctionSineWave, Scale: &scale}.at(ts), 1e-9)
+}
+
+func TestQueryAssertionsTest_Run(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "assertions.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+assertions:
+  - name: constant
+    query: vector(1)
+    expected:
+      value: 1
+  - name: time
+    query: vector(time())
+    expected:
+      function: time
+    tolerance: 1
+`), 0o600))
+
+	cfg := QueryAssertionsTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.Enabled = true
+	cfg.ConfigFile = path
+
+	now := time.Unix(1000, 0)
+	ts := alignTimestampToInterval(now.Add(-cfg.QueryDelay), writeInterval)
+
+	t.Run("should succeed if all assertions match", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("Query", mock.Anything, "vector(1)", ts, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+		client.On("Query", mock.Anything, "vector(time())", ts, mock.Anything).Return(model.Vector{{Value: model.SampleValue(ts.Unix())}}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewQueryAssertionsTest(cfg, client, log.NewNopLogger(), reg)
+		require.NoError(t, test.Init(context.Background(), now))
+		require.NoError(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "Query", 2)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_total Total number of query results checked for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_total counter
+			mimir_continuous_test_query_result_checks_total{test="query-assertions"} 2
+
+			# HELP mimir_continuous_test_query_assertion_checks_failed_total Total number of query assertion checks failed, by assertion.
+			# TYPE mimir_continuous_test_query_assertion_checks_failed_total counter
+			mimir_continuous_test_query_assertion_checks_failed_total{assertion="constant",test="query-assertions"} 0
+			mimir_continuous_test_query_assertion_checks_failed_total{assertion="time",test="query-assertions"} 0
+		`), "mimir_continuous_test_query_result_checks_total", "mimir_continuous_test_query_assertion_checks_failed_total"))
+	})
+
+	t.Run("should fail if an assertion doesn't match, and run the other assertions", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("Query", mock.Anything, "vector(1)", ts, mock.Anything).Return(model.Vector{{Value: 2}}, nil)
+		client.On("Query", mock.Anything, "vector(time())", ts, mock.Anything).Return(model.Vector{{Value: model.SampleValue(ts.Unix())}}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewQueryAssertionsTest(cfg, client, log.NewNopLogger(), reg)
+		require.NoError(t, test.Init(context.Background(), now))
+
+		err := test.Run(context.Background(), now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `query assertion "constant" check failed`)
+		client.AssertNumberOfCalls(t, "Query", 2)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="query-assertions"} 1
+
+			# HELP mimir_continuous_test_query_assertion_checks_failed_total Total number of query assertion checks failed, by assertion.
+			# TYPE mimir_continuous_test_query_assertion_checks_failed_total counter
+			mimir_continuous_test_query_assertion_checks_failed_total{assertion="constant",test="query-assertions"} 1
+			mimir_continuous_test_query_assertion_checks_failed_total{assertion="time",test="query-assertions"} 0
+		`), "mimir_continuous_test_query_result_checks_failed_total", "mimir_continuous_test_query_assertion_checks_failed_total"))
+	})
+
+	t.Run("should fail if the query returns an unexpected number of series", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("Query", mock.Anything, "vector(1)", ts, mock.Anything).Return(model.Vector{}, nil)
+		client.On("Query", mock.Anything, "vector(time())", ts, mock.Anything).Return(model.Vector{}, errors.New("failed"))
+
+		test := NewQueryAssertionsTest(cfg, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+		require.NoError(t, test.Init(context.Background(), now))
+
+		err := test.Run(context.Background(), now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "expected 1 series in the result but got 0")
+		assert.Contains(t, err.Error(), `failed to execute instant query of the query assertion "time"`)
+	})
+
+	t.Run("should fail to initialize if the config file doesn't exist", func(t *testing.T) {
+		cfg := cfg
+		cfg.ConfigFile = filepath.Join(t.TempDir(), "missing.yaml")
+
+		test := NewQueryAssertionsTest(cfg, &ClientMock{}, log.NewNopLogger(), nil)
+		require.Error(t, test.Init(context.Background(), now))
+	})
+}
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"flag"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+// QueryDifferentialsConfig configures the checks of the write-read series test which run the same query
+// with a query-frontend feature enabled and disabled, and compare the results sample-by-sample.
+type QueryDifferentialsConfig struct {
+	QueryShardingDifferentialEnabled bool
+	ResultsCacheDifferentialEnabled  bool
+}
+
+func (cfg *QueryDifferentialsConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.QueryShardingDifferentialEnabled, "tests.write-read-series-test.query-sharding-differential-enabled", false, "When enabled, each query run with the results cache disabled is run again with query sharding disabled, and the results of the two queries are compared sample-by-sample.")
+	f.BoolVar(&cfg.ResultsCacheDifferentialEnabled, "tests.write-read-series-test.results-cache-differential-enabled", false, "When enabled, the results of each query run with the results cache enabled and disabled are compared sample-by-sample.")
+}
+
+// verifyResultsCacheConsistency compares the results of the same query run with the results cache enabled
+// and disabled. The results are expected to match, otherwise the results cache may have returned corrupted data.
+func (t *WriteReadSeriesTest) verifyResultsCacheConsistency(logger log.Logger, cached, uncached model.Matrix) error {
+	err := compareMatrices(uncached, cached)
+	if err == nil {
+		return nil
+	}
+
+	t.metrics.resultsCacheMismatchesTotal.Inc()
+
+	timestamps := findMismatchingTimestamps(uncached, cached)
+	level.Warn(logger).Log("msg", "Query result with results cache enabled doesn't match the result with results cache disabled", "mismatching_samples", len(timestamps), "mismatching_timestamps", formatTimestamps(timestamps), "err", err)
+	return errors.Wrap(err, "query result with results cache enabled doesn't match the result with results cache disabled")
+}
+
+// verifyQueryShardingConsistency runs the query again with query sharding disabled, and compares the result
+// with the input one, which is expected to be the result of the same query run with query sharding enabled.
+func (t *WriteReadSeriesTest) verifyQueryShardingConsistency(logger log.Logger, sharded model.Matrix, runUnsharded func() (model.Matrix, error)) error {
+	level.Debug(logger).Log("msg", "Running query with query sharding disabled")
+
+	t.metrics.queriesTotal.Inc()
+	unsharded, err := runUnsharded()
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute query with query sharding disabled", "err", err)
+		return errors.Wrap(err, "failed to execute query with query sharding disabled")
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	if err := compareMatrices(unsharded, sharded); err != nil {
+		t.metrics.queryShardingMismatchesTotal.Inc()
+		level.Warn(logger).Log("msg", "Query result with query sharding enabled doesn't match the result with query sharding disabled", "err", err)
+		return errors.Wrap(err, "query result with query sharding enabled doesn't match the result with query sharding disabled")
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestWriteReadSeriesTest_Run_QueryShardingDifferential(t *testing.T) {
+	logger := log.NewNopLogger()
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+
+	t.Run("should run queries with query sharding disabled and track no mismatch if results match", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		cfg := cfg
+		cfg.QueryShardingDifferentialEnabled = true
+
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{
+			{Values: []model.SamplePair{newSamplePair(now, generateSineWaveValue(now)*float64(cfg.NumSeries))}},
+		}, nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{
+			{Timestamp: model.Time(now.UnixMilli()), Value: model.SampleValue(generateSineWaveValue(now) * float64(cfg.NumSeries))},
+		}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewWriteReadSeriesTest(cfg, client, logger, reg)
+
+		err := test.Run(context.Background(), now)
+		assert.NoError(t, err)
+
+		// Only the queries run with the results cache disabled are run again with query sharding disabled.
+		client.AssertNumberOfCalls(t, "QueryRange", 6)
+		client.AssertNumberOfCalls(t, "Query", 6)
+		assert.Equal(t, 4, countQueryCallsWithShardingDisabled(client))
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_queries_total Total number of attempted query requests.
+			# TYPE mimir_continuous_test_queries_total counter
+			mimir_continuous_test_queries_total{test="write-read-series"} 12
+
+			# HELP mimir_continuous_test_query_sharding_mismatches_total Total number of query results which didn't match when comparing the results of the same query run with and without query sharding.
+			# TYPE mimir_continuous_test_query_sharding_mismatches_total counter
+			mimir_continuous_test_query_sharding_mismatches_total{maintenance="false",test="write-read-series"} 0
+		`), "mimir_continuous_test_queries_total", "mimir_continuous_test_query_sharding_mismatches_total"))
+	})
+
+	t.Run("should run queries with query sharding disabled and track mismatch if results don't match", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		cfg := cfg
+		cfg.QueryShardingDifferentialEnabled = true
+
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.MatchedBy(queryShardingDisabled)).Return(model.Matrix{
+			{Values: []model.SamplePair{{Timestamp: model.Time(now.UnixMilli()), Value: 12345}}},
+		}, nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{
+			{Values: []model.SamplePair{newSamplePair(now, generateSineWaveValue(now)*float64(cfg.NumSeries))}},
+		}, nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.MatchedBy(queryShardingDisabled)).Return(model.Vector{
+			{Timestamp: model.Time(now.UnixMilli()), Value: 12345},
+		}, nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{
+			{Timestamp: model.Time(now.UnixMilli()), Value: model.SampleValue(generateSineWaveValue(now) * float64(cfg.NumSeries))},
+		}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewWriteReadSeriesTest(cfg, client, logger, reg)
+
+		err := test.Run(context.Background(), now)
+		assert.Error(t, err)
+		assert.Equal(t, 4, countQueryCallsWithShardingDisabled(client))
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="write-read-series"} 0
+
+			# HELP mimir_continuous_test_query_sharding_mismatches_total Total number of query results which didn't match when comparing the results of the same query run with and without query sharding.
+			# TYPE mimir_continuous_test_query_sharding_mismatches_total counter
+			mimir_continuous_test_query_sharding_mismatches_total{maintenance="false",test="write-read-series"} 4
+		`), "mimir_continuous_test_query_result_checks_failed_total", "mimir_continuous_test_query_sharding_mismatches_total"))
+	})
+}
+
+func TestWriteReadSeriesTest_Run_ResultsCacheDifferential(t *testing.T) {
+	logger := log.NewNopLogger()
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+
+	t.Run("should compare the results of queries run with and without results cache and track mismatch if results don't match", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		cfg := cfg
+		cfg.ResultsCacheDifferentialEnabled = true
+
+		// The results returned when the results cache is enabled differ from the uncached ones.
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.MatchedBy(resultsCacheDisabled)).Return(model.Matrix{
+			{Values: []model.SamplePair{newSamplePair(now, generateSineWaveValue(now)*float64(cfg.NumSeries))}},
+		}, nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{
+			{Values: []model.SamplePair{{Timestamp: model.Time(now.UnixMilli()), Value: 12345}}},
+		}, nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{
+			{Timestamp: model.Time(now.UnixMilli()), Value: model.SampleValue(generateSineWaveValue(now) * float64(cfg.NumSeries))},
+		}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewWriteReadSeriesTest(cfg, client, logger, reg)
+
+		err := test.Run(context.Background(), now)
+		assert.Error(t, err)
+
+		client.AssertNumberOfCalls(t, "QueryRange", 4)
+		client.AssertNumberOfCalls(t, "Query", 4)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="write-read-series"} 2
+
+			# HELP mimir_continuous_test_results_cache_mismatches_total Total number of query results which didn't match when comparing the results of the same query run with and without the results cache.
+			# TYPE mimir_continuous_test_results_cache_mismatches_total counter
+			mimir_continuous_test_results_cache_mismatches_total{maintenance="false",test="write-read-series"} 2
+		`), "mimir_continuous_test_query_result_checks_failed_total", "mimir_continuous_test_results_cache_mismatches_total"))
+	})
+}
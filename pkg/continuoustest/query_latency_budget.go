@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"flag"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// QueryLatencyBudgetConfig configures the max expected duration of the queries run by the write-read series
+// test, by age of the oldest queried timestamp.
+type QueryLatencyBudgetConfig struct {
+	QueryLatencyBudget1h  time.Duration
+	QueryLatencyBudget24h time.Duration
+	QueryLatencyBudget7d  time.Duration
+}
+
+func (cfg *QueryLatencyBudgetConfig) RegisterFlags(f *flag.FlagSet) {
+	f.DurationVar(&cfg.QueryLatencyBudget1h, "tests.write-read-series-test.query-latency-budget-1h", 0, "Maximum expected duration of the range and instant queries whose oldest queried timestamp is within the last 1h, which are typically served by the ingesters. Queries exceeding it are tracked as latency budget violations. 0 to disable.")
+	f.DurationVar(&cfg.QueryLatencyBudget24h, "tests.write-read-series-test.query-latency-budget-24h", 0, "Maximum expected duration of the range and instant queries whose oldest queried timestamp is between 1h and 24h ago. Queries exceeding it are tracked as latency budget violations. 0 to disable.")
+	f.DurationVar(&cfg.QueryLatencyBudget7d, "tests.write-read-series-test.query-latency-budget-7d", 0, "Maximum expected duration of the range and instant queries whose oldest queried timestamp is older than 24h, which are typically served by the store-gateways and may be slower. Queries exceeding it are tracked as latency budget violations. 0 to disable.")
+}
+
+func (cfg *QueryLatencyBudgetConfig) Validate() error {
+	if cfg.QueryLatencyBudget1h < 0 || cfg.QueryLatencyBudget24h < 0 || cfg.QueryLatencyBudget7d < 0 {
+		return errors.New("the query latency budgets must be greater than or equal to 0")
+	}
+	return nil
+}
+
+// queryLatencyAgeBucket returns the latency budget age bucket of a query, given the age of the oldest queried timestamp.
+func queryLatencyAgeBucket(age time.Duration) string {
+	switch {
+	case age <= time.Hour:
+		return "1h"
+	case age <= 24*time.Hour:
+		return "24h"
+	default:
+		return "7d"
+	}
+}
+
+// checkQueryLatencyBudget tracks a latency budget violation if the duration of a query exceeds the budget configured
+// for the age bucket of the oldest queried timestamp. Queries of older data are typically served by the store-gateways,
+// so they're expected to be slower, but they must still meet their own budget.
+func (t *WriteReadSeriesTest) checkQueryLatencyBudget(logger log.Logger, age, duration time.Duration) {
+	bucket := queryLatencyAgeBucket(age)
+
+	var budget time.Duration
+	switch bucket {
+	case "1h":
+		budget = t.cfg.QueryLatencyBudget1h
+	case "24h":
+		budget = t.cfg.QueryLatencyBudget24h
+	default:
+		budget = t.cfg.QueryLatencyBudget7d
+	}
+
+	if budget <= 0 || duration <= budget {
+		return
+	}
+
+	t.queryLatencyBudgetViolationsTotal.WithLabelValues(bucket).Inc()
+	level.Warn(logger).Log("msg", "Query duration exceeded the latency budget", "age_bucket", bucket, "duration", duration, "budget", budget)
+}
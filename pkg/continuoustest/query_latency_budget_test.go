@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryLatencyBudgetConfig_Validate(t *testing.T) {
+	cfg := QueryLatencyBudgetConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.QueryLatencyBudget1h = time.Second
+	cfg.QueryLatencyBudget7d = 10 * time.Second
+	assert.NoError(t, cfg.Validate())
+
+	cfg.QueryLatencyBudget24h = -time.Second
+	assert.Error(t, cfg.Validate())
+}
+
+func TestWriteReadSeriesTest_checkQueryLatencyBudget(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.QueryLatencyBudget1h = time.Second
+	cfg.QueryLatencyBudget7d = 5 * time.Second
+
+	test := NewWriteReadSeriesTest(cfg, &ClientMock{}, log.NewNopLogger(), nil)
+
+	// Within the budget.
+	test.checkQueryLatencyBudget(log.NewNopLogger(), 10*time.Minute, 500*time.Millisecond)
+	test.checkQueryLatencyBudget(log.NewNopLogger(), 48*time.Hour, 3*time.Second)
+
+	// Exceeding the budget.
+	test.checkQueryLatencyBudget(log.NewNopLogger(), time.Hour, 2*time.Second)
+	test.checkQueryLatencyBudget(log.NewNopLogger(), 7*24*time.Hour, 6*time.Second)
+	test.checkQueryLatencyBudget(log.NewNopLogger(), 8*24*time.Hour, 10*time.Second)
+
+	// The budget is disabled.
+	test.checkQueryLatencyBudget(log.NewNopLogger(), 2*time.Hour, time.Minute)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(test.queryLatencyBudgetViolationsTotal.WithLabelValues("1h")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(test.queryLatencyBudgetViolationsTotal.WithLabelValues("24h")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(test.queryLatencyBudgetViolationsTotal.WithLabelValues("7d")))
+}
+
+func TestQueryLatencyAgeBucket(t *testing.T) {
+	assert.Equal(t, "1h", queryLatencyAgeBucket(0))
+	assert.Equal(t, "1h", queryLatencyAgeBucket(time.Hour))
+	assert.Equal(t, "24h", queryLatencyAgeBucket(time.Hour+time.Second))
+	assert.Equal(t, "24h", queryLatencyAgeBucket(24*time.Hour))
+	assert.Equal(t, "7d", queryLatencyAgeBucket(25*time.Hour))
+}
@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// serverTimingHeaderName is the response header the query-frontend writes the query statistics to,
+	// when the query statistics are enabled.
+	serverTimingHeaderName = "Server-Timing"
+
+	queryStatWallTime          = "querier_wall_time"
+	queryStatFetchedSeries     = "fetched_series_count"
+	queryStatFetchedChunkBytes = "fetched_chunk_bytes"
+	queryStatFetchedChunks     = "fetched_chunks_count"
+	queryStatFetchedIndexBytes = "fetched_index_bytes"
+	queryStatShardedQueries    = "sharded_queries"
+	queryStatSplitQueries      = "split_queries"
+)
+
+// QueryStats holds the statistics of a query, as returned by Mimir in the Server-Timing response header.
+type QueryStats struct {
+	// Found is whether the query statistics have been returned by Mimir. The statistics are returned only if
+	// they're enabled in the query-frontend.
+	Found bool
+
+	WallTime          time.Duration
+	FetchedSeries     uint64
+	FetchedChunkBytes uint64
+	FetchedChunks     uint64
+	FetchedIndexBytes uint64
+	ShardedQueries    uint64
+	SplitQueries      uint64
+}
+
+// WithQueryStats requests the statistics of the query returned by Mimir to be stored in the input stats.
+// The stats are left untouched if the request fails before a response is received.
+func WithQueryStats(stats *QueryStats) RequestOption {
+	return func(options *requestOptions) {
+		options.queryStats = stats
+	}
+}
+
+// parseServerTimingHeader parses the query statistics from the input Server-Timing header values. Returns the
+// parsed statistics, and the names of the statistics found. Unknown or malformed entries are ignored.
+func parseServerTimingHeader(values []string) (QueryStats, map[string]bool) {
+	stats := QueryStats{}
+	found := map[string]bool{}
+
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ",") {
+			params := strings.Split(strings.TrimSpace(entry), ";")
+			if len(params) != 2 {
+				continue
+			}
+
+			name := params[0]
+			param, raw, ok := strings.Cut(params[1], "=")
+			if !ok {
+				continue
+			}
+
+			switch param {
+			case "dur":
+				ms, err := strconv.ParseFloat(raw, 64)
+				if err != nil || name != queryStatWallTime {
+					continue
+				}
+				stats.WallTime = time.Duration(ms * float64(time.Millisecond))
+			case "val":
+				count, err := strconv.ParseUint(raw, 10, 64)
+				if err != nil {
+					continue
+				}
+
+				switch name {
+				case queryStatFetchedSeries:
+					stats.FetchedSeries = count
+				case queryStatFetchedChunkBytes:
+					stats.FetchedChunkBytes = count
+				case queryStatFetchedChunks:
+					stats.FetchedChunks = count
+				case queryStatFetchedIndexBytes:
+					stats.FetchedIndexBytes = count
+				case queryStatShardedQueries:
+					stats.ShardedQueries = count
+				case queryStatSplitQueries:
+					stats.SplitQueries = count
+				default:
+					continue
+				}
+			default:
+				continue
+			}
+
+			found[name] = true
+		}
+	}
+
+	stats.Found = len(found) > 0
+	return stats, found
+}
+
+// queryStatsRoundTripper parses the statistics of the instant and range queries returned by Mimir. The statistics
+// are tracked by the client metrics, if not nil, and stored in the stats requested with WithQueryStats, if any.
+type queryStatsRoundTripper struct {
+	metrics *ClientMetrics
+	next    http.RoundTripper
+}
+
+func newQueryStatsRoundTripper(metrics *ClientMetrics, next http.RoundTripper) *queryStatsRoundTripper {
+	return &queryStatsRoundTripper{metrics: metrics, next: next}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *queryStatsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	queryType, ok := queryTypeFromPath(req.URL.Path)
+	if !ok || resp.StatusCode/100 != 2 {
+		return resp, err
+	}
+
+	stats, found := parseServerTimingHeader(resp.Header.Values(serverTimingHeaderName))
+	if options, ok := req.Context().Value(requestOptionsKey).(*requestOptions); ok && options.queryStats != nil {
+		*options.queryStats = stats
+	}
+	if rt.metrics != nil {
+		rt.metrics.observeQueryStats(queryType, stats, found)
+	}
+	return resp, err
+}
+
+// queryTypeFromPath returns the type of the query sent to the input API path, and whether it's a query at all.
+func queryTypeFromPath(path string) (string, bool) {
+	switch {
+	case strings.HasSuffix(path, "/api/v1/query"):
+		return queryTypeInstant, true
+	case strings.HasSuffix(path, "/api/v1/query_range"):
+		return queryTypeRange, true
+	default:
+		return "", false
+	}
+}
+
+// observeQueryStats tracks the input statistics of a query of the input type. Only the statistics found in the
+// response are tracked, because older Mimir versions don't return all of them.
+func (m *ClientMetrics) observeQueryStats(queryType string, stats QueryStats, found map[string]bool) {
+	if !stats.Found {
+		m.queryStatsMissingTotal.WithLabelValues(queryType).Inc()
+		return
+	}
+
+	for name, value := range map[string]float64{
+		queryStatWallTime:          stats.WallTime.Seconds(),
+		queryStatFetchedSeries:     float64(stats.FetchedSeries),
+		queryStatFetchedChunkBytes: float64(stats.FetchedChunkBytes),
+		queryStatFetchedChunks:     float64(stats.FetchedChunks),
+		queryStatFetchedIndexBytes: float64(stats.FetchedIndexBytes),
+		queryStatShardedQueries:    float64(stats.ShardedQueries),
+		queryStatSplitQueries:      float64(stats.SplitQueries),
+	} {
+		if found[name] {
+			m.queryStats[name].WithLabelValues(queryType).Observe(value)
+		}
+	}
+}
+
+// newQueryStatsHistograms returns the histograms tracking each query statistic, by name of the statistic.
+func newQueryStatsHistograms(reg prometheus.Registerer) map[string]*prometheus.HistogramVec {
+	newHistogram := func(name, help string, buckets []float64) *prometheus.HistogramVec {
+		return promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mimir_continuous_test_query_" + name,
+			Help:    help,
+			Buckets: buckets,
+		}, []string{"type"})
+	}
+
+	return map[string]*prometheus.HistogramVec{
+		queryStatWallTime:          newHistogram("wall_time_seconds", "Wall time spent by the queriers to run the queries, as returned by Mimir in the query statistics.", prometheus.ExponentialBuckets(0.001, 4, 10)),
+		queryStatFetchedSeries:     newHistogram("fetched_series", "Number of series fetched by the queries, as returned by Mimir in the query statistics.", prometheus.ExponentialBuckets(1, 4, 12)),
+		queryStatFetchedChunkBytes: newHistogram("fetched_chunk_bytes", "Size of the chunks fetched by the queries, in bytes, as returned by Mimir in the query statistics.", prometheus.ExponentialBuckets(1024, 4, 12)),
+		queryStatFetchedChunks:     newHistogram("fetched_chunks", "Number of chunks fetched by the queries, as returned by Mimir in the query statistics.", prometheus.ExponentialBuckets(1, 4, 12)),
+		queryStatFetchedIndexBytes: newHistogram("fetched_index_bytes", "Size of the index data fetched by the queries from the store-gateways, in bytes, as returned by Mimir in the query statistics.", prometheus.ExponentialBuckets(1024, 4, 12)),
+		queryStatShardedQueries:    newHistogram("sharded_queries", "Number of sharded queries the queries have been split into by the query-frontend, as returned by Mimir in the query statistics.", prometheus.ExponentialBuckets(1, 2, 10)),
+		queryStatSplitQueries:      newHistogram("split_queries", "Number of queries the queries have been split into by time interval by the query-frontend, as returned by Mimir in the query statistics.", prometheus.ExponentialBuckets(1, 2, 10)),
+	}
+}
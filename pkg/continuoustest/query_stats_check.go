@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	util_math "github.com/grafana/mimir/pkg/util/math"
+)
+
+// QueryStatsCheckConfig configures the check of the statistics returned by Mimir for the range queries run
+// by the write-read series test.
+type QueryStatsCheckConfig struct {
+	QueryStatsCheckEnabled bool
+}
+
+func (cfg *QueryStatsCheckConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.QueryStatsCheckEnabled, "tests.write-read-series-test.query-stats-check-enabled", false, "When enabled, the statistics returned by Mimir for each range query run with the results cache disabled are checked to be within sane bounds: the number of fetched series must be at least the number of written series, and at most twice the number of written series for each query the range query has been split into by time interval. The query statistics must be enabled in the query-frontend. Can't be enabled along with series churn or the ramp schedule.")
+}
+
+// verifyQueryStats checks that the input statistics of a range query over the written series are within sane
+// bounds. Each series is fetched at least once, and at most twice, from the ingesters and the store-gateways,
+// for each query the range query has been split into by time interval.
+func (t *WriteReadSeriesTest) verifyQueryStats(stats QueryStats) error {
+	if !stats.Found {
+		t.queryStatsCheckFailuresTotal.WithLabelValues("missing").Inc()
+		return errors.New("the query statistics have not been returned, check that the query statistics are enabled in the query-frontend")
+	}
+
+	minSeries := uint64(t.cfg.NumSeries)
+	maxSeries := 2 * minSeries * util_math.Max(1, stats.SplitQueries)
+	if stats.FetchedSeries < minSeries || stats.FetchedSeries > maxSeries {
+		t.queryStatsCheckFailuresTotal.WithLabelValues("fetched_series").Inc()
+		return fmt.Errorf("the query fetched %d series, while between %d and %d series were expected (split queries: %d)", stats.FetchedSeries, minSeries, maxSeries, stats.SplitQueries)
+	}
+	return nil
+}
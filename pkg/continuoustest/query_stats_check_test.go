@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteReadSeriesTest_Run_QueryStatsCheck(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+	cfg.QueryStatsCheckEnabled = true
+
+	now := time.Unix(1080, 0)
+	lastWritten := time.Unix(1020, 0)
+
+	for name, tc := range map[string]struct {
+		stats          QueryStats
+		expectedReason string
+	}{
+		"fetched series match the written series": {
+			stats: QueryStats{Found: true, FetchedSeries: 2, SplitQueries: 1},
+		},
+		"fetched series from both the ingesters and the store-gateways by each split query": {
+			stats: QueryStats{Found: true, FetchedSeries: 8, SplitQueries: 2},
+		},
+		"query statistics not returned": {
+			stats:          QueryStats{},
+			expectedReason: "missing",
+		},
+		"fewer fetched series than the written series": {
+			stats:          QueryStats{Found: true, FetchedSeries: 1, SplitQueries: 1},
+			expectedReason: "fetched_series",
+		},
+		"more fetched series than expected": {
+			stats:          QueryStats{Found: true, FetchedSeries: 5, SplitQueries: 1},
+			expectedReason: "fetched_series",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := &queryStatsClient{numSeriesClient: numSeriesClient{numSeriesAt: cfg.numSeriesAt}, stats: tc.stats}
+			client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+			client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+			test := NewWriteReadSeriesTest(cfg, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+			test.lastWrittenTimestamp = lastWritten
+			test.queryMinTime = lastWritten
+			test.queryMaxTime = lastWritten
+
+			err := test.Run(context.Background(), now)
+			assert.Zero(t, testutil.ToFloat64(test.metrics.queryResultChecksFailedTotal))
+
+			if tc.expectedReason == "" {
+				require.NoError(t, err)
+				assert.Zero(t, testutil.CollectAndCount(test.queryStatsCheckFailuresTotal))
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "range query stats check failed")
+				assert.NotZero(t, testutil.ToFloat64(test.queryStatsCheckFailuresTotal.WithLabelValues(tc.expectedReason)))
+			}
+
+			// The query statistics are requested only for the queries run with the results cache disabled.
+			assert.Zero(t, client.requestedWithResultsCache)
+			assert.NotZero(t, client.requested)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseServerTimingHeader(t *testing.T) {
+	for name, tc := range map[string]struct {
+		values        []string
+		expectedStats QueryStats
+		expectedFound map[string]bool
+	}{
+		"no header": {
+			expectedFound: map[string]bool{},
+		},
+		"all the query statistics": {
+			values: []string{"querier_wall_time;dur=1.5, response_time;dur=2, fetched_series_count;val=10, fetched_chunk_bytes;val=2048, fetched_chunks_count;val=20, fetched_index_bytes;val=512, sharded_queries;val=16, split_queries;val=4"},
+			expectedStats: QueryStats{
+				Found:             true,
+				WallTime:          1500 * time.Microsecond,
+				FetchedSeries:     10,
+				FetchedChunkBytes: 2048,
+				FetchedChunks:     20,
+				FetchedIndexBytes: 512,
+				ShardedQueries:    16,
+				SplitQueries:      4,
+			},
+			expectedFound: map[string]bool{
+				queryStatWallTime:          true,
+				queryStatFetchedSeries:     true,
+				queryStatFetchedChunkBytes: true,
+				queryStatFetchedChunks:     true,
+				queryStatFetchedIndexBytes: true,
+				queryStatShardedQueries:    true,
+				queryStatSplitQueries:      true,
+			},
+		},
+		"only the wall time, as returned by older Mimir versions": {
+			values:        []string{"querier_wall_time;dur=3, response_time;dur=4"},
+			expectedStats: QueryStats{Found: true, WallTime: 3 * time.Millisecond},
+			expectedFound: map[string]bool{queryStatWallTime: true},
+		},
+		"unknown and malformed entries": {
+			values:        []string{"cache;desc=hit, fetched_series_count;val=abc, fetched_chunks_count", "split_queries;val=2"},
+			expectedStats: QueryStats{Found: true, SplitQueries: 2},
+			expectedFound: map[string]bool{queryStatSplitQueries: true},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			stats, found := parseServerTimingHeader(tc.values)
+			assert.Equal(t, tc.expectedStats, stats)
+			assert.Equal(t, tc.expectedFound, found)
+		})
+	}
+}
+
+func TestClient_QueryStats(t *testing.T) {
+	var serverTiming string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serverTiming != "" {
+			w.Header().Set(serverTimingHeaderName, serverTiming)
+		}
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Path == "/api/v1/query" {
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		} else {
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := ClientConfig{}
+	flagext.DefaultValues(&cfg)
+	require.NoError(t, cfg.WriteBaseEndpoint.Set(server.URL))
+	require.NoError(t, cfg.ReadBaseEndpoint.Set(server.URL))
+
+	reg := prometheus.NewPedanticRegistry()
+	metrics := NewClientMetrics(reg)
+	c, err := NewClient(cfg, log.NewNopLogger(), metrics)
+	require.NoError(t, err)
+
+	// The query statistics are returned by Mimir.
+	serverTiming = "querier_wall_time;dur=10, response_time;dur=12, fetched_series_count;val=100, fetched_chunk_bytes;val=4096, fetched_chunks_count;val=200, fetched_index_bytes;val=1024, sharded_queries;val=16, split_queries;val=3"
+
+	stats := QueryStats{}
+	_, err = c.QueryRange(context.Background(), "up", time.Unix(0, 0), time.Unix(1000, 0), 10*time.Second, WithQueryStats(&stats))
+	require.NoError(t, err)
+	assert.Equal(t, QueryStats{Found: true, WallTime: 10 * time.Millisecond, FetchedSeries: 100, FetchedChunkBytes: 4096, FetchedChunks: 200, FetchedIndexBytes: 1024, ShardedQueries: 16, SplitQueries: 3}, stats)
+
+	_, err = c.Query(context.Background(), "up", time.Unix(1000, 0))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]uint64{"type=" + queryTypeInstant: 1, "type=" + queryTypeRange: 1}, histogramSampleCounts(t, reg, "mimir_continuous_test_query_fetched_series"))
+	assert.Equal(t, map[string]uint64{"type=" + queryTypeInstant: 1, "type=" + queryTypeRange: 1}, histogramSampleCounts(t, reg, "mimir_continuous_test_query_split_queries"))
+
+	// The query statistics are not returned by Mimir.
+	serverTiming = ""
+
+	stats = QueryStats{}
+	_, err = c.QueryRange(context.Background(), "up", time.Unix(0, 0), time.Unix(1000, 0), 10*time.Second, WithQueryStats(&stats))
+	require.NoError(t, err)
+	assert.False(t, stats.Found)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.queryStatsMissingTotal.WithLabelValues(queryTypeRange)))
+
+	// Requests other than queries are not tracked.
+	require.NoError(t, c.ListRules(context.Background()))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.queryStatsMissingTotal.WithLabelValues(queryTypeInstant)))
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// RampStep is a step of a ramp schedule: numSeries series are written for the duration of the step.
+type RampStep struct {
+	Duration  time.Duration
+	NumSeries int
+}
+
+// RampSchedule is a cyclic schedule of the number of written series, which implements flag.Value.
+// The flag value is a comma-separated list of steps in the format "<duration>=<number of series>".
+//
+// The schedule repeats indefinitely, and its cycles are aligned to the Unix epoch, so that the number
+// of series written at each timestamp is a deterministic function of the timestamp, and it's known
+// when verifying query results, even after a restart of the tool.
+type RampSchedule []RampStep
+
+// String implements flag.Value.
+func (r RampSchedule) String() string {
+	out := make([]string, 0, len(r))
+	for _, step := range r {
+		out = append(out, fmt.Sprintf("%s=%d", model.Duration(step.Duration), step.NumSeries))
+	}
+	return strings.Join(out, ",")
+}
+
+// Set implements flag.Value.
+func (r *RampSchedule) Set(s string) error {
+	var schedule RampSchedule
+
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		duration, numSeries, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("invalid ramp step %q: expected format is <duration>=<number of series>", value)
+		}
+
+		d, err := model.ParseDuration(strings.TrimSpace(duration))
+		if err != nil {
+			return fmt.Errorf("invalid ramp step %q: %w", value, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid ramp step %q: the duration must be greater than 0", value)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(numSeries))
+		if err != nil {
+			return fmt.Errorf("invalid ramp step %q: %w", value, err)
+		}
+		if n <= 0 {
+			return fmt.Errorf("invalid ramp step %q: the number of series must be greater than 0", value)
+		}
+
+		schedule = append(schedule, RampStep{Duration: time.Duration(d), NumSeries: n})
+	}
+
+	*r = schedule
+	return nil
+}
+
+// period returns the duration of a cycle of the schedule.
+func (r RampSchedule) period() time.Duration {
+	var period time.Duration
+	for _, step := range r {
+		period += step.Duration
+	}
+	return period
+}
+
+// numSeriesAt returns the number of series written at the input timestamp, or 0 if the schedule is empty.
+func (r RampSchedule) numSeriesAt(ts time.Time) int {
+	period := r.period().Milliseconds()
+	if period <= 0 {
+		return 0
+	}
+
+	offset := ts.UnixMilli() % period
+	if offset < 0 {
+		offset += period
+	}
+
+	for _, step := range r {
+		if offset < step.Duration.Milliseconds() {
+			return step.NumSeries
+		}
+		offset -= step.Duration.Milliseconds()
+	}
+
+	// Not reachable, because the offset is lower than the period.
+	return r[len(r)-1].NumSeries
+}
+
+// minNumSeries returns the lowest number of series of the schedule, or 0 if the schedule is empty.
+func (r RampSchedule) minNumSeries() int {
+	min := 0
+	for i, step := range r {
+		if i == 0 || step.NumSeries < min {
+			min = step.NumSeries
+		}
+	}
+	return min
+}
+
+// maxNumSeries returns the highest number of series of the schedule, or 0 if the schedule is empty.
+func (r RampSchedule) maxNumSeries() int {
+	max := 0
+	for _, step := range r {
+		if step.NumSeries > max {
+			max = step.NumSeries
+		}
+	}
+	return max
+}
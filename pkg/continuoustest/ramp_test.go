@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRampSchedule_Set(t *testing.T) {
+	for input, tc := range map[string]struct {
+		expected    RampSchedule
+		expectedErr string
+	}{
+		"": {
+			expected: nil,
+		},
+		"1h=1000, 30m=5000,1h=1000": {
+			expected: RampSchedule{{Duration: time.Hour, NumSeries: 1000}, {Duration: 30 * time.Minute, NumSeries: 5000}, {Duration: time.Hour, NumSeries: 1000}},
+		},
+		"1h": {
+			expectedErr: "expected format is <duration>=<number of series>",
+		},
+		"1x=1000": {
+			expectedErr: `invalid ramp step "1x=1000"`,
+		},
+		"0s=1000": {
+			expectedErr: "the duration must be greater than 0",
+		},
+		"1h=abc": {
+			expectedErr: `invalid ramp step "1h=abc"`,
+		},
+		"1h=0": {
+			expectedErr: "the number of series must be greater than 0",
+		},
+	} {
+		t.Run(input, func(t *testing.T) {
+			var schedule RampSchedule
+			err := schedule.Set(input)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, schedule)
+		})
+	}
+}
+
+func TestRampSchedule_String(t *testing.T) {
+	schedule := RampSchedule{{Duration: time.Hour, NumSeries: 1000}, {Duration: 90 * time.Second, NumSeries: 10}}
+	assert.Equal(t, "1h=1000,1m30s=10", schedule.String())
+
+	var parsed RampSchedule
+	require.NoError(t, parsed.Set(schedule.String()))
+	assert.Equal(t, schedule, parsed)
+}
+
+func TestRampSchedule_numSeriesAt(t *testing.T) {
+	schedule := RampSchedule{{Duration: time.Minute, NumSeries: 10}, {Duration: 2 * time.Minute, NumSeries: 30}, {Duration: time.Minute, NumSeries: 20}}
+
+	assert.Equal(t, 10, schedule.numSeriesAt(time.Unix(0, 0)))
+	assert.Equal(t, 10, schedule.numSeriesAt(time.Unix(59, 0)))
+	assert.Equal(t, 30, schedule.numSeriesAt(time.Unix(60, 0)))
+	assert.Equal(t, 30, schedule.numSeriesAt(time.Unix(179, 0)))
+	assert.Equal(t, 20, schedule.numSeriesAt(time.Unix(180, 0)))
+
+	// The schedule repeats every 4m.
+	assert.Equal(t, 10, schedule.numSeriesAt(time.Unix(240, 0)))
+	assert.Equal(t, 30, schedule.numSeriesAt(time.Unix(240+60, 0)))
+	assert.Equal(t, 20, schedule.numSeriesAt(time.Unix(-1, 0)))
+
+	assert.Equal(t, 10, schedule.minNumSeries())
+	assert.Equal(t, 30, schedule.maxNumSeries())
+
+	assert.Equal(t, 0, RampSchedule(nil).numSeriesAt(time.Unix(0, 0)))
+}
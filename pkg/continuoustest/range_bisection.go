@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// BisectionConfig configures the bisection of the time range of the failed range query result checks
+// of the write-read series test.
+type BisectionConfig struct {
+	BisectFailedRangesEnabled bool
+}
+
+func (cfg *BisectionConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.BisectFailedRangesEnabled, "tests.write-read-series-test.bisect-failed-ranges-enabled", false, "When enabled, the time range of each range query whose result check failed is bisected with follow-up queries, to localize the smallest failing time window and report it.")
+}
+
+// bisectFailedRange bisects the time range of a range query whose result check failed, running follow-up
+// queries on each half of the range, to localize the smallest failing time window. The failing time window
+// is logged and tracked by metrics, bucketed by age, and returned. The follow-up queries also check the
+// samples at the edges of each half, which are not checked by verifyRangeQueryResult.
+func (t *WriteReadSeriesTest) bisectFailedRange(ctx context.Context, logger log.Logger, now, start, end time.Time, resultsCacheEnabled bool, responseFormat string) (time.Time, time.Time) {
+	const maxBisectionQueries = 20
+
+	queries := 0
+	for end.Sub(start) > writeInterval && queries < maxBisectionQueries {
+		mid := alignTimestampToInterval(start.Add(end.Sub(start)/2), writeInterval)
+
+		leftFailed, err := t.rangeCheckFails(ctx, start, mid, resultsCacheEnabled, responseFormat)
+		queries++
+		if err != nil {
+			level.Warn(logger).Log("msg", "Failed to execute range query to bisect the failing time range", "err", err)
+			break
+		}
+		if leftFailed {
+			end = mid
+			continue
+		}
+
+		rightFailed, err := t.rangeCheckFails(ctx, mid.Add(writeInterval), end, resultsCacheEnabled, responseFormat)
+		queries++
+		if err != nil {
+			level.Warn(logger).Log("msg", "Failed to execute range query to bisect the failing time range", "err", err)
+			break
+		}
+		if rightFailed {
+			start = mid.Add(writeInterval)
+			continue
+		}
+
+		// Both halves succeeded: the failure can't be localized further, or it's not reproducible anymore.
+		break
+	}
+
+	t.localizedFailuresTotal.WithLabelValues(failingWindowAgeBucket(now.Sub(end))).Inc()
+	level.Warn(logger).Log("msg", "Localized the failing time window of the range query result check", "failing_window_start", start.UTC().Format(time.RFC3339), "failing_window_end", end.UTC().Format(time.RFC3339), "failing_window_duration", end.Sub(start), "bisection_queries", queries)
+	return start, end
+}
+
+// rangeCheckFails runs a range query from start to end, and returns whether its result check fails,
+// including the check of the samples at the edges of the time range.
+func (t *WriteReadSeriesTest) rangeCheckFails(ctx context.Context, start, end time.Time, resultsCacheEnabled bool, responseFormat string) (bool, error) {
+	step := getQueryStep(start, end, writeInterval)
+
+	t.metrics.queriesTotal.Inc()
+	queryStart := time.Now()
+	matrix, err := t.client.QueryRange(ctx, t.querySum, start, end, step, WithResultsCacheEnabled(resultsCacheEnabled), WithResponseFormat(responseFormat))
+	t.metrics.observeQueryDuration(queryTypeRange, resultsCacheEnabled, queryStart)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		return false, err
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	if err := t.verifyRangeQueryResult(matrix, start, end, step); err != nil {
+		return true, nil
+	}
+	if len(matrix) == 0 {
+		return false, nil
+	}
+
+	// Check the samples at the edges of the time range are not missing.
+	samples := matrix[0].Values
+	first, last := start, end.Add(-(end.Sub(start) % step))
+	for ; t.isGap(first); first = first.Add(step) {
+	}
+	for ; t.isGap(last); last = last.Add(-step) {
+	}
+	return len(samples) == 0 || !samples[0].Timestamp.Time().Equal(first) || !samples[len(samples)-1].Timestamp.Time().Equal(last), nil
+}
+
+// failingWindowAgeBucket returns the age bucket of a queried time window, given its age.
+func failingWindowAgeBucket(age time.Duration) string {
+	switch {
+	case age < time.Hour:
+		return "<1h"
+	case age < 24*time.Hour:
+		return "1h-24h"
+	case age < 7*24*time.Hour:
+		return "24h-7d"
+	default:
+		return ">7d"
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteReadSeriesTest_bisectFailedRange(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+	cfg.BisectFailedRangesEnabled = true
+
+	now := time.Unix(100000, 0)
+	start, end := now.Add(-64*writeInterval), now
+	missing := start.Add(37 * writeInterval)
+
+	client := &missingSampleClient{numSeries: cfg.NumSeries, missing: missing}
+	client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	reg := prometheus.NewPedanticRegistry()
+	test := NewWriteReadSeriesTest(cfg, client, log.NewNopLogger(), reg)
+	test.queryMinTime = start
+	test.queryMaxTime = end
+
+	_, err := test.runRangeQueryAndVerifyResult(context.Background(), now, start, end, false, responseFormatJSON)
+	require.Error(t, err)
+
+	// The failed query is followed by the bisection queries.
+	assert.Greater(t, len(client.Calls), 1)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP mimir_continuous_test_query_result_check_failures_localized_total Total number of failing time windows localized by bisecting the time range of failed range query result checks, by age of the failing time window.
+		# TYPE mimir_continuous_test_query_result_check_failures_localized_total counter
+		mimir_continuous_test_query_result_check_failures_localized_total{age="<1h",test="write-read-series"} 1
+	`), "mimir_continuous_test_query_result_check_failures_localized_total"))
+
+	// Result check failures of the follow-up queries are not tracked.
+	assert.Equal(t, float64(1), testutil.ToFloat64(test.metrics.queryResultChecksFailedTotal))
+
+	// The bisection localizes the missing sample.
+	windowStart, windowEnd := test.bisectFailedRange(context.Background(), log.NewNopLogger(), now, start, end, false, responseFormatJSON)
+	assert.False(t, windowStart.After(missing))
+	assert.False(t, windowEnd.Before(missing))
+	assert.LessOrEqual(t, windowEnd.Sub(windowStart), writeInterval)
+}
+
+func TestFailingWindowAgeBucket(t *testing.T) {
+	assert.Equal(t, "<1h", failingWindowAgeBucket(time.Minute))
+	assert.Equal(t, "1h-24h", failingWindowAgeBucket(2*time.Hour))
+	assert.Equal(t, "24h-7d", failingWindowAgeBucket(48*time.Hour))
+	assert.Equal(t, ">7d", failingWindowAgeBucket(30*24*time.Hour))
+}
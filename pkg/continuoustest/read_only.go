@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	readOnlyMetricName = "mimir_continuous_test_read_only"
+
+	// readOnlyQuery is the query run to check whether queries keep working. It doesn't depend on
+	// the tenant data, because no data can be written while the tenant is in read-only mode.
+	readOnlyQuery = "vector(1)"
+)
+
+type ReadOnlyTestConfig struct {
+	Enabled bool
+}
+
+func (cfg *ReadOnlyTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.read-only-test.enabled", false, "Enable the test which checks whether the tenant is in read-only mode: writes are expected to be rejected with the 423 status code, while queries keep working. The tenant must be put in read-only mode in Mimir, so the other tests must not be enabled in the same mimir-continuous-test instance.")
+}
+
+// ReadOnlyTest periodically writes a sample and runs a query for a tenant in read-only mode, and checks
+// whether Mimir rejects the write with the dedicated status code while the query keeps working.
+type ReadOnlyTest struct {
+	name    string
+	cfg     ReadOnlyTestConfig
+	client  MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	writesAcceptedTotal prometheus.Counter
+}
+
+func NewReadOnlyTest(cfg ReadOnlyTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *ReadOnlyTest {
+	const name = "read-only"
+
+	return &ReadOnlyTest{
+		name:    name,
+		cfg:     cfg,
+		client:  client,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+		writesAcceptedTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_read_only_writes_accepted_total",
+			Help:        "Total number of write requests which have been unexpectedly accepted while the tenant is expected to be in read-only mode.",
+			ConstLabels: map[string]string{"test": name},
+		}),
+	}
+}
+
+// Name implements Test.
+func (t *ReadOnlyTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *ReadOnlyTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *ReadOnlyTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "ReadOnlyTest.Run")
+	defer sp.Finish()
+
+	errs := multierror.New()
+	errs.Add(t.checkWriteRejected(ctx, sp, now))
+	errs.Add(t.checkQuery(ctx, sp, now))
+	return errs.Err()
+}
+
+func (t *ReadOnlyTest) checkWriteRejected(ctx context.Context, logger log.Logger, now time.Time) error {
+	t.metrics.writesTotal.Inc()
+	start := time.Now()
+	statusCode, err := t.client.WriteSeries(ctx, generateReadOnlySeries(now))
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+
+	switch {
+	case statusCode == http.StatusLocked:
+		t.metrics.observeSuccess(outcomeTypeWrite)
+		level.Debug(logger).Log("msg", "Write request has been rejected because the tenant is in read-only mode, as expected", "status_code", statusCode)
+		return nil
+
+	case statusCode/100 == 2:
+		t.writesAcceptedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Write request has been unexpectedly accepted while the tenant is expected to be in read-only mode", "status_code", statusCode)
+		return errors.New("write request has been unexpectedly accepted while the tenant is expected to be in read-only mode")
+
+	default:
+		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Write request failed with an unexpected error", "status_code", statusCode, "expected_status_code", http.StatusLocked, "err", err)
+		return errors.Errorf("write request failed with status code %d while %d was expected (error: %v)", statusCode, http.StatusLocked, err)
+	}
+}
+
+func (t *ReadOnlyTest) checkQuery(ctx context.Context, logger log.Logger, now time.Time) error {
+	logger = log.With(logger, "query", readOnlyQuery)
+
+	t.metrics.queriesTotal.Inc()
+	start := time.Now()
+	vector, err := t.client.Query(ctx, readOnlyQuery, now, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute instant query while the tenant is in read-only mode", "err", err)
+		return errors.Wrapf(err, "failed to execute instant query %s", readOnlyQuery)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	t.metrics.queryResultChecksTotal.Inc()
+	if err := verifyReadOnlyQueryResult(vector); err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Query result check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: readOnlyQuery, Start: now, End: now, Error: err.Error()})
+		return errors.Wrapf(err, "query result check failed for query %s", readOnlyQuery)
+	}
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+
+	level.Debug(logger).Log("msg", "Query result check succeeded")
+	return nil
+}
+
+func verifyReadOnlyQueryResult(vector model.Vector) error {
+	if len(vector) != 1 {
+		return fmt.Errorf("expected 1 series in the result but got %d", len(vector))
+	}
+	if vector[0].Value != 1 {
+		return fmt.Errorf("expected value 1 but got %f", vector[0].Value)
+	}
+	return nil
+}
+
+func generateReadOnlySeries(t time.Time) []prompb.TimeSeries {
+	return []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: readOnlyMetricName}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: t.UnixMilli()}},
+	}}
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyTest_Run(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	t.Run("should succeed if writes are rejected and queries work", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(http.StatusLocked, errors.New("read-only"))
+		client.On("Query", mock.Anything, readOnlyQuery, now, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewReadOnlyTest(ReadOnlyTestConfig{Enabled: true}, client, log.NewNopLogger(), reg)
+		require.NoError(t, test.Run(context.Background(), now))
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_read_only_writes_accepted_total Total number of write requests which have been unexpectedly accepted while the tenant is expected to be in read-only mode.
+			# TYPE mimir_continuous_test_read_only_writes_accepted_total counter
+			mimir_continuous_test_read_only_writes_accepted_total{test="read-only"} 0
+
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="read-only"} 0
+		`), "mimir_continuous_test_read_only_writes_accepted_total", "mimir_continuous_test_query_result_checks_failed_total"))
+	})
+
+	t.Run("should fail if writes are accepted", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("Query", mock.Anything, readOnlyQuery, now, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewReadOnlyTest(ReadOnlyTestConfig{Enabled: true}, client, log.NewNopLogger(), reg)
+		require.ErrorContains(t, test.Run(context.Background(), now), "unexpectedly accepted")
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_read_only_writes_accepted_total Total number of write requests which have been unexpectedly accepted while the tenant is expected to be in read-only mode.
+			# TYPE mimir_continuous_test_read_only_writes_accepted_total counter
+			mimir_continuous_test_read_only_writes_accepted_total{test="read-only"} 1
+		`), "mimir_continuous_test_read_only_writes_accepted_total"))
+	})
+
+	t.Run("should fail if writes are rejected with an unexpected status code", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(400, errors.New("bad request"))
+		client.On("Query", mock.Anything, readOnlyQuery, now, mock.Anything).Return(model.Vector{{Value: 1}}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewReadOnlyTest(ReadOnlyTestConfig{Enabled: true}, client, log.NewNopLogger(), reg)
+		require.ErrorContains(t, test.Run(context.Background(), now), "failed with status code 400 while 423 was expected")
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_writes_failed_total Total number of failed write requests.
+			# TYPE mimir_continuous_test_writes_failed_total counter
+			mimir_continuous_test_writes_failed_total{maintenance="false",status_code="400",test="read-only"} 1
+		`), "mimir_continuous_test_writes_failed_total"))
+	})
+
+	t.Run("should fail if queries fail", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(http.StatusLocked, errors.New("read-only"))
+		client.On("Query", mock.Anything, readOnlyQuery, now, mock.Anything).Return(model.Vector{}, errors.New("failed"))
+
+		test := NewReadOnlyTest(ReadOnlyTestConfig{Enabled: true}, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+		require.ErrorContains(t, test.Run(context.Background(), now), "failed to execute instant query")
+	})
+}
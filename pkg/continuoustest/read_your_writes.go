@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+// ReadYourWritesConfig configures the read-your-writes check of the write-read series test, which queries
+// the samples right after they've been written.
+type ReadYourWritesConfig struct {
+	ReadYourWritesEnabled bool
+}
+
+func (cfg *ReadYourWritesConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.ReadYourWritesEnabled, "tests.write-read-series-test.read-your-writes-enabled", false, "When enabled, an instant query is run immediately after each successful write request, and the just written samples are expected to be returned.")
+}
+
+// verifyReadYourWrites runs an instant query at the timestamp of the samples just written, and checks
+// whether they're returned. A successful write is expected to be immediately visible to queries.
+func (t *WriteReadSeriesTest) verifyReadYourWrites(ctx context.Context, timestamp, writeStart time.Time) (err error) {
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "WriteReadSeriesTest.verifyReadYourWrites")
+	defer sp.Finish()
+
+	sp.SetTag("query", t.querySum)
+	sp.SetTag("time", timestamp)
+	defer func() { _ = sp.Error(err) }()
+
+	logger := log.With(sp, "query", t.querySum, "ts", timestamp.UnixMilli())
+	level.Debug(logger).Log("msg", "Running instant query to verify read-your-writes")
+
+	t.metrics.queriesTotal.Inc()
+	start := time.Now()
+	vector, err := t.client.Query(ctx, t.querySum, timestamp, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute instant query to verify read-your-writes", "err", err)
+		return errors.Wrap(err, "failed to execute instant query to verify read-your-writes")
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	setWaveResultTraceAttributes(sp.Span, vectorToMatrix(vector), t.sumWaveform, timestamp, 1)
+	if _, err := verifyWaveSamplesSum(vectorToMatrix(vector), t.sumWaveform, 1, 0); err != nil {
+		t.metrics.readYourWritesViolations.Inc()
+		level.Warn(logger).Log("msg", "Just written samples have not been returned by the query", "err", err)
+		return errors.Wrap(err, "just written samples have not been returned by the query")
+	}
+
+	t.metrics.readYourWritesLatency.Observe(time.Since(writeStart).Seconds())
+	return nil
+}
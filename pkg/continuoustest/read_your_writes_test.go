@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteReadSeriesTest_Run_ReadYourWrites(t *testing.T) {
+	logger := log.NewNopLogger()
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+
+	t.Run("should query the written samples immediately after each write and track no violation if they're returned", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		cfg := cfg
+		cfg.ReadYourWritesEnabled = true
+
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{
+			{Values: []model.SamplePair{newSamplePair(now, generateSineWaveValue(now)*float64(cfg.NumSeries))}},
+		}, nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{
+			{Timestamp: model.Time(now.UnixMilli()), Value: model.SampleValue(generateSineWaveValue(now) * float64(cfg.NumSeries))},
+		}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewWriteReadSeriesTest(cfg, client, logger, reg)
+
+		require.NoError(t, test.Run(context.Background(), now))
+
+		client.AssertNumberOfCalls(t, "Query", 5)
+		client.AssertCalled(t, "Query", mock.Anything, queryMetricSum, now, mock.MatchedBy(resultsCacheDisabled))
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_read_your_writes_violations_total Total number of successfully written samples which have not been returned by a query run immediately after the write.
+			# TYPE mimir_continuous_test_read_your_writes_violations_total counter
+			mimir_continuous_test_read_your_writes_violations_total{maintenance="false",test="write-read-series"} 0
+		`), "mimir_continuous_test_read_your_writes_violations_total"))
+
+		metric := &dto.Metric{}
+		require.NoError(t, test.metrics.readYourWritesLatency.(prometheus.Metric).Write(metric))
+		assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+	})
+
+	t.Run("should keep writing and track violations if the written samples are not returned immediately after the write", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		cfg := cfg
+		cfg.ReadYourWritesEnabled = true
+
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewWriteReadSeriesTest(cfg, client, logger, reg)
+		test.lastWrittenTimestamp = now.Add(-2 * writeInterval)
+
+		assert.Error(t, test.Run(context.Background(), now))
+
+		client.AssertNumberOfCalls(t, "WriteSeries", 2)
+		client.AssertCalled(t, "Query", mock.Anything, queryMetricSum, now.Add(-writeInterval), mock.Anything)
+		client.AssertCalled(t, "Query", mock.Anything, queryMetricSum, now, mock.Anything)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_read_your_writes_violations_total Total number of successfully written samples which have not been returned by a query run immediately after the write.
+			# TYPE mimir_continuous_test_read_your_writes_violations_total counter
+			mimir_continuous_test_read_your_writes_violations_total{maintenance="false",test="write-read-series"} 2
+		`), "mimir_continuous_test_read_your_writes_violations_total"))
+	})
+}
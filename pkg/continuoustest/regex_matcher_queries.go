@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+// regexMatcherQueriesMaxCachedExpectations is the max number of expected aggregations cached by each regex
+// matcher query. Each distinct number of written series and churn interval requires a cached aggregation.
+const regexMatcherQueriesMaxCachedExpectations = 1024
+
+// RegexMatcherQueriesConfig configures the range queries of the write-read series test summing the series
+// whose series_id matches a regex matcher.
+type RegexMatcherQueriesConfig struct {
+	RegexMatcherQueriesEnabled bool
+}
+
+func (cfg *RegexMatcherQueriesConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.RegexMatcherQueriesEnabled, "tests.write-read-series-test.regex-matcher-queries-enabled", false, "When enabled, on each test run the range queries summing the series whose series_id label matches a set of regex matchers, such as {series_id=~\"1.*\"}, are run over each queried time range with the results cache disabled, and their results are checked to be exactly the sum of the matching series.")
+}
+
+// seriesIDRegexMatchers are the matchers on the series_id label run by the regex matcher queries. They cover
+// the shapes of regular expressions which the queriers and the store-gateways optimize differently when
+// looking up the postings: prefix, suffix, set of alternatives, character class and negated regexp.
+var seriesIDRegexMatchers = []*labels.Matcher{
+	labels.MustNewMatcher(labels.MatchRegexp, "series_id", "1.*"),
+	labels.MustNewMatcher(labels.MatchRegexp, "series_id", ".*7"),
+	labels.MustNewMatcher(labels.MatchRegexp, "series_id", "2|3|5|7|11|13"),
+	labels.MustNewMatcher(labels.MatchRegexp, "series_id", "[0-9]{1,2}"),
+	labels.MustNewMatcher(labels.MatchNotRegexp, "series_id", "1.*"),
+}
+
+// regexMatcherQuery is a query summing the written series whose series_id matches a regex matcher.
+type regexMatcherQuery struct {
+	matcher *labels.Matcher
+	query   string
+
+	// expectations caches the expected aggregation of the matching series, by number of written series
+	// and churn offset, because the series_id of all the written series must be matched to compute it.
+	expectations map[churnedSeriesIDs]regexMatcherExpectation
+}
+
+// regexMatcherExpectation is the expected aggregation of the written series matching a regex matcher.
+type regexMatcherExpectation struct {
+	// numSeries is the number of matching series.
+	numSeries int
+
+	// indexesSum is the sum of the indexes of the matching series, which the value of each series is offset by
+	// when per-series values are enabled.
+	indexesSum float64
+}
+
+func newRegexMatcherQueries(metricName string) []*regexMatcherQuery {
+	queries := make([]*regexMatcherQuery, 0, len(seriesIDRegexMatchers))
+	for _, matcher := range seriesIDRegexMatchers {
+		queries = append(queries, &regexMatcherQuery{
+			matcher:      matcher,
+			query:        fmt.Sprintf("sum(max_over_time(%s{%s}[1s]))", metricName, matcher.String()),
+			expectations: map[churnedSeriesIDs]regexMatcherExpectation{},
+		})
+	}
+	return queries
+}
+
+// expectationAt returns the expected aggregation of the series matching the regex matcher written at the input timestamp.
+func (q *regexMatcherQuery) expectationAt(cfg WriteReadSeriesTestConfig, ts time.Time) regexMatcherExpectation {
+	ids := newChurnedSeriesIDs(ts, cfg.numSeriesAt(ts), cfg.ChurnInterval, cfg.ChurnFraction)
+	if expectation, ok := q.expectations[ids]; ok {
+		return expectation
+	}
+
+	expectation := regexMatcherExpectation{}
+	for i := 0; i < ids.numSeries; i++ {
+		if q.matcher.Matches(strconv.Itoa(ids.seriesID(i))) {
+			expectation.numSeries++
+			expectation.indexesSum += float64(i)
+		}
+	}
+
+	// The churn offset grows over time, so the cache is reset instead of growing unbounded.
+	if len(q.expectations) >= regexMatcherQueriesMaxCachedExpectations {
+		q.expectations = map[churnedSeriesIDs]regexMatcherExpectation{}
+	}
+	q.expectations[ids] = expectation
+	return expectation
+}
+
+// runRegexMatcherQueries runs the regex matcher queries over each input time range, if enabled.
+func (t *WriteReadSeriesTest) runRegexMatcherQueries(ctx context.Context, queryRanges [][2]time.Time, responseFormat string) error {
+	if !t.cfg.RegexMatcherQueriesEnabled {
+		return nil
+	}
+
+	errs := multierror.New()
+	for _, timeRange := range queryRanges {
+		for _, q := range t.regexMatcherQueries {
+			errs.Add(t.runRegexMatcherQueryAndVerifyResult(ctx, q, timeRange[0], timeRange[1], responseFormat))
+		}
+	}
+	return errs.Err()
+}
+
+// runRegexMatcherQueryAndVerifyResult runs a range query summing the series matching a regex matcher on the series_id
+// label, and verifies that the result is exactly the sum of the matching series.
+func (t *WriteReadSeriesTest) runRegexMatcherQueryAndVerifyResult(ctx context.Context, q *regexMatcherQuery, start, end time.Time, responseFormat string) (err error) {
+	start = maxTime(t.queryMinTime, alignTimestampToInterval(start, writeInterval))
+	end = minTime(t.queryMaxTime, alignTimestampToInterval(end, writeInterval))
+	if end.Before(start) {
+		return nil
+	}
+
+	step := getQueryStep(start, end, writeInterval)
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "WriteReadSeriesTest.runRegexMatcherQueryAndVerifyResult")
+	defer sp.Finish()
+
+	setQueryTraceAttributes(sp.Span, q.query, start, end, step, false, responseFormat)
+	defer func() { _ = sp.Error(err) }()
+
+	logger := log.With(sp, "query", q.query, "start", start.UnixMilli(), "end", end.UnixMilli(), "step", step, "response_format", responseFormat)
+	level.Debug(logger).Log("msg", "Running regex matcher range query")
+
+	t.metrics.queriesTotal.Inc()
+	queryStart := time.Now()
+	matrix, err := t.client.QueryRange(ctx, q.query, start, end, step, WithResultsCacheEnabled(false), WithResponseFormat(responseFormat))
+	t.metrics.observeQueryDuration(queryTypeRange, false, queryStart)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute regex matcher range query", "err", err)
+		return errors.Wrap(err, "failed to execute regex matcher range query")
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	t.metrics.queryResultChecksTotal.Inc()
+	err = t.verifyRegexMatcherQueryResult(matrix, q, start, end, step)
+	recordQueryResultCheck(ctx, end, err)
+	if err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		t.regexMatcherFailuresTotal.WithLabelValues(q.matcher.String()).Inc()
+		level.Warn(logger).Log("msg", "Regex matcher range query result check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: q.query, Start: start, End: end, Step: step.String(), Error: err.Error()})
+		return errors.Wrapf(err, "regex matcher range query result check failed with matcher %s", q.matcher)
+	}
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+
+	return nil
+}
+
+// verifyRegexMatcherQueryResult checks whether the input matrix is the expected result of the input regex matcher
+// query from start to end with the input step. No sample is expected at the timestamps at which no written series
+// matches the regex matcher, like at the timestamps skipped because of gap injection.
+func (t *WriteReadSeriesTest) verifyRegexMatcherQueryResult(matrix model.Matrix, q *regexMatcherQuery, start, end time.Time, step time.Duration) error {
+	isGap := func(ts time.Time) bool {
+		return t.isGap(ts) || q.expectationAt(t.cfg, ts).numSeries == 0
+	}
+
+	onlyGaps := true
+	for ts := start; !ts.After(end) && onlyGaps; ts = ts.Add(step) {
+		onlyGaps = isGap(ts)
+	}
+	if onlyGaps {
+		if len(matrix) > 0 {
+			return fmt.Errorf("expected no series in the result because no sample matching %s was written in the queried time range, but got %d", q.matcher, len(matrix))
+		}
+		return nil
+	}
+
+	wave := func(ts time.Time) float64 {
+		expectation := q.expectationAt(t.cfg, ts)
+		sum := t.waveform(ts) * float64(expectation.numSeries)
+		if t.cfg.PerSeriesValuesEnabled {
+			sum += expectation.indexesSum
+		}
+		return sum
+	}
+	_, err := verifyWaveSamplesSumWithGaps(matrix, wave, 1, step, isGap)
+	return err
+}
@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegexMatcherQuery_expectationAt(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 25
+
+	churnCfg := cfg
+	churnCfg.NumSeries = 10
+	churnCfg.ChurnInterval = time.Minute
+	churnCfg.ChurnFraction = 0.5
+
+	// At this timestamp the last 5 series are churned with an offset of 50, so the series_id are 0-4 and 55-59.
+	ts := time.Unix(600, 0)
+
+	queries := newRegexMatcherQueries(metricName)
+	require.Len(t, queries, len(seriesIDRegexMatchers))
+
+	for _, tc := range []struct {
+		query             string
+		expected          regexMatcherExpectation
+		expectedWithChurn regexMatcherExpectation
+	}{
+		{
+			query:             `series_id=~"1.*"`,
+			expected:          regexMatcherExpectation{numSeries: 11, indexesSum: 1 + 10 + 11 + 12 + 13 + 14 + 15 + 16 + 17 + 18 + 19},
+			expectedWithChurn: regexMatcherExpectation{numSeries: 1, indexesSum: 1},
+		},
+		{
+			query:             `series_id=~".*7"`,
+			expected:          regexMatcherExpectation{numSeries: 2, indexesSum: 7 + 17},
+			expectedWithChurn: regexMatcherExpectation{numSeries: 1, indexesSum: 7},
+		},
+		{
+			query:             `series_id=~"2|3|5|7|11|13"`,
+			expected:          regexMatcherExpectation{numSeries: 6, indexesSum: 2 + 3 + 5 + 7 + 11 + 13},
+			expectedWithChurn: regexMatcherExpectation{numSeries: 2, indexesSum: 2 + 3},
+		},
+		{
+			query:             `series_id=~"[0-9]{1,2}"`,
+			expected:          regexMatcherExpectation{numSeries: 25, indexesSum: 300},
+			expectedWithChurn: regexMatcherExpectation{numSeries: 10, indexesSum: 45},
+		},
+		{
+			query:             `series_id!~"1.*"`,
+			expected:          regexMatcherExpectation{numSeries: 14, indexesSum: 300 - 146},
+			expectedWithChurn: regexMatcherExpectation{numSeries: 9, indexesSum: 44},
+		},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			var q *regexMatcherQuery
+			for _, candidate := range queries {
+				if candidate.matcher.String() == tc.query {
+					q = candidate
+				}
+			}
+			require.NotNil(t, q)
+			assert.Equal(t, "sum(max_over_time(mimir_continuous_test_sine_wave{"+tc.query+"}[1s]))", q.query)
+
+			assert.Equal(t, tc.expected, q.expectationAt(cfg, ts))
+			assert.Equal(t, tc.expectedWithChurn, q.expectationAt(churnCfg, ts))
+
+			// The expectations are cached by number of series and churn offset.
+			assert.Len(t, q.expectations, 2)
+			assert.Equal(t, tc.expected, q.expectationAt(cfg, ts.Add(time.Hour)))
+			assert.Len(t, q.expectations, 2)
+		})
+	}
+}
+
+func TestWriteReadSeriesTest_verifyRegexMatcherQueryResult(t *testing.T) {
+	now := time.Unix(1000, 0)
+	wave := generateSineWaveValue(now)
+
+	for name, tc := range map[string]struct {
+		numSeries              int
+		perSeriesValuesEnabled bool
+		matrix                 model.Matrix
+		expectedErr            string
+	}{
+		"result matches the matching series": {
+			numSeries: 20,
+			matrix:    model.Matrix{{Values: []model.SamplePair{newSamplePair(now, 2*wave)}}},
+		},
+		"result matches the matching series with per-series values": {
+			numSeries:              20,
+			perSeriesValuesEnabled: true,
+			matrix:                 model.Matrix{{Values: []model.SamplePair{newSamplePair(now, 2*wave+7+17)}}},
+		},
+		"result doesn't account for the per-series values": {
+			numSeries:              20,
+			perSeriesValuesEnabled: true,
+			matrix:                 model.Matrix{{Values: []model.SamplePair{newSamplePair(now, 2*wave)}}},
+			expectedErr:            "has value",
+		},
+		"result sums a wrong number of series": {
+			numSeries:   20,
+			matrix:      model.Matrix{{Values: []model.SamplePair{newSamplePair(now, 3*wave)}}},
+			expectedErr: "has value",
+		},
+		"no series matches and the result is empty": {
+			numSeries: 5,
+			matrix:    model.Matrix{},
+		},
+		"no series matches but the result is not empty": {
+			numSeries:   5,
+			matrix:      model.Matrix{{Values: []model.SamplePair{newSamplePair(now, wave)}}},
+			expectedErr: "expected no series in the result",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := WriteReadSeriesTestConfig{}
+			flagext.DefaultValues(&cfg)
+			cfg.NumSeries = tc.numSeries
+			cfg.PerSeriesValuesEnabled = tc.perSeriesValuesEnabled
+
+			test := NewWriteReadSeriesTest(cfg, &ClientMock{}, log.NewNopLogger(), nil)
+			q := test.regexMatcherQueries[1]
+			require.Equal(t, `series_id=~".*7"`, q.matcher.String())
+
+			err := test.verifyRegexMatcherQueryResult(tc.matrix, q, now, now, writeInterval)
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestWriteReadSeriesTest_Run_RegexMatcherQueries(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 20
+	cfg.RegexMatcherQueriesEnabled = true
+
+	now := time.Unix(1000, 0)
+	wave := generateSineWaveValue(now)
+	sumResult := func(numSeries int) model.Matrix {
+		return model.Matrix{{Values: []model.SamplePair{newSamplePair(now, wave*float64(numSeries))}}}
+	}
+
+	for name, tc := range map[string]struct {
+		suffixMatcherResult model.Matrix
+		expectedFailures    int
+	}{
+		"results match": {
+			suffixMatcherResult: sumResult(2),
+		},
+		"a regex matcher query returns a wrong sum": {
+			suffixMatcherResult: sumResult(3),
+			expectedFailures:    2, // The query is run over each of the queried time ranges.
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := &ClientMock{}
+			client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+			client.On("QueryRange", mock.Anything, queryMetricSum, now, now, writeInterval, mock.Anything).Return(sumResult(20), nil)
+			client.On("QueryRange", mock.Anything, `sum(max_over_time(mimir_continuous_test_sine_wave{series_id=~"1.*"}[1s]))`, now, now, writeInterval, mock.Anything).Return(sumResult(11), nil)
+			client.On("QueryRange", mock.Anything, `sum(max_over_time(mimir_continuous_test_sine_wave{series_id=~".*7"}[1s]))`, now, now, writeInterval, mock.Anything).Return(tc.suffixMatcherResult, nil)
+			client.On("QueryRange", mock.Anything, `sum(max_over_time(mimir_continuous_test_sine_wave{series_id=~"2|3|5|7|11|13"}[1s]))`, now, now, writeInterval, mock.Anything).Return(sumResult(6), nil)
+			client.On("QueryRange", mock.Anything, `sum(max_over_time(mimir_continuous_test_sine_wave{series_id=~"[0-9]{1,2}"}[1s]))`, now, now, writeInterval, mock.Anything).Return(sumResult(20), nil)
+			client.On("QueryRange", mock.Anything, `sum(max_over_time(mimir_continuous_test_sine_wave{series_id!~"1.*"}[1s]))`, now, now, writeInterval, mock.Anything).Return(sumResult(9), nil)
+			client.On("Query", mock.Anything, queryMetricSum, now, mock.Anything).Return(model.Vector{{Timestamp: model.Time(now.UnixMilli()), Value: model.SampleValue(wave * 20)}}, nil)
+
+			test := NewWriteReadSeriesTest(cfg, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+			err := test.Run(context.Background(), now)
+			if tc.expectedFailures == 0 {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+
+			// The regex matcher queries are run with the results cache disabled.
+			for _, call := range client.Calls {
+				if call.Method == "QueryRange" && call.Arguments.String(1) != queryMetricSum {
+					assert.True(t, resultsCacheDisabled(call.Arguments.Get(5).([]RequestOption)))
+				}
+			}
+
+			assert.Equal(t, float64(tc.expectedFailures), testutil.ToFloat64(test.metrics.queryResultChecksFailedTotal))
+			assert.Equal(t, float64(tc.expectedFailures), testutil.ToFloat64(test.regexMatcherFailuresTotal.WithLabelValues(`series_id=~".*7"`)))
+		})
+	}
+}
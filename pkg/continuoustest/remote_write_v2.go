@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"math"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	writeProtocolV1 = "remote-write-v1"
+	writeProtocolV2 = "remote-write-v2"
+
+	remoteWriteV1ContentType = "application/x-protobuf"
+	remoteWriteV1Version     = "0.1.0"
+	remoteWriteV2ContentType = "application/x-protobuf;proto=io.prometheus.write.v2.Request"
+	remoteWriteV2Version     = "2.0.0"
+)
+
+var supportedWriteProtocols = []string{writeProtocolV1, writeProtocolV2}
+
+// Field numbers of the io.prometheus.write.v2 protobuf messages.
+const (
+	rw2RequestSymbolsField    protowire.Number = 4
+	rw2RequestTimeseriesField protowire.Number = 5
+
+	rw2SeriesLabelsRefsField protowire.Number = 1
+	rw2SeriesSamplesField    protowire.Number = 2
+	rw2SeriesHistogramsField protowire.Number = 3
+	rw2SeriesExemplarsField  protowire.Number = 4
+	rw2SeriesMetadataField   protowire.Number = 5
+
+	rw2SampleValueField     protowire.Number = 1
+	rw2SampleTimestampField protowire.Number = 2
+
+	rw2ExemplarLabelsRefsField protowire.Number = 1
+	rw2ExemplarValueField      protowire.Number = 2
+	rw2ExemplarTimestampField  protowire.Number = 3
+
+	rw2MetadataTypeField    protowire.Number = 1
+	rw2MetadataHelpRefField protowire.Number = 3
+	rw2MetadataUnitRefField protowire.Number = 4
+)
+
+// rw2SymbolsTable interns the strings referenced by a Remote Write 2.0 request.
+type rw2SymbolsTable struct {
+	symbols []string
+	refs    map[string]uint32
+}
+
+func newRW2SymbolsTable() *rw2SymbolsTable {
+	// The first symbol must always be the empty string.
+	return &rw2SymbolsTable{
+		symbols: []string{""},
+		refs:    map[string]uint32{"": 0},
+	}
+}
+
+func (t *rw2SymbolsTable) ref(symbol string) uint32 {
+	if ref, ok := t.refs[symbol]; ok {
+		return ref
+	}
+
+	ref := uint32(len(t.symbols))
+	t.symbols = append(t.symbols, symbol)
+	t.refs[symbol] = ref
+	return ref
+}
+
+func (t *rw2SymbolsTable) labelsRefs(labels []prompb.Label) []uint32 {
+	refs := make([]uint32, 0, 2*len(labels))
+	for _, l := range labels {
+		refs = append(refs, t.ref(l.Name), t.ref(l.Value))
+	}
+	return refs
+}
+
+// marshalRemoteWriteV2Request marshals the input write request in the Remote Write 2.0 wire format
+// (io.prometheus.write.v2.Request). Series labels, exemplar labels and metadata strings are interned in the
+// request symbols table. The metadata of the input request is attached to each series of the same metric family.
+// The created timestamp of the series is not set, because the series written by the tests are gauges.
+func marshalRemoteWriteV2Request(req *prompb.WriteRequest) ([]byte, error) {
+	symbols := newRW2SymbolsTable()
+
+	metadataByFamily := make(map[string]prompb.MetricMetadata, len(req.Metadata))
+	for _, m := range req.Metadata {
+		metadataByFamily[m.MetricFamilyName] = m
+	}
+
+	var series []byte
+	for _, s := range req.Timeseries {
+		var metadata *prompb.MetricMetadata
+		if m, ok := metadataByFamily[seriesMetricName(s.Labels)]; ok {
+			metadata = &m
+		}
+
+		encoded, err := marshalRemoteWriteV2Series(s, metadata, symbols)
+		if err != nil {
+			return nil, err
+		}
+		series = protowire.AppendTag(series, rw2RequestTimeseriesField, protowire.BytesType)
+		series = protowire.AppendBytes(series, encoded)
+	}
+
+	// The symbols are encoded last, because they're interned while encoding the series.
+	var out []byte
+	for _, symbol := range symbols.symbols {
+		out = protowire.AppendTag(out, rw2RequestSymbolsField, protowire.BytesType)
+		out = protowire.AppendString(out, symbol)
+	}
+	return append(out, series...), nil
+}
+
+func marshalRemoteWriteV2Series(s prompb.TimeSeries, metadata *prompb.MetricMetadata, symbols *rw2SymbolsTable) ([]byte, error) {
+	var out []byte
+
+	out = appendPackedUint32(out, rw2SeriesLabelsRefsField, symbols.labelsRefs(s.Labels))
+
+	for _, sample := range s.Samples {
+		var encoded []byte
+		encoded = appendDouble(encoded, rw2SampleValueField, sample.Value)
+		encoded = appendInt64(encoded, rw2SampleTimestampField, sample.Timestamp)
+
+		out = protowire.AppendTag(out, rw2SeriesSamplesField, protowire.BytesType)
+		out = protowire.AppendBytes(out, encoded)
+	}
+
+	// The Remote Write 2.0 histogram message is wire-compatible with the Remote Write 1.0 one.
+	for _, h := range s.Histograms {
+		h := h
+		encoded, err := proto.Marshal(&h)
+		if err != nil {
+			return nil, err
+		}
+
+		out = protowire.AppendTag(out, rw2SeriesHistogramsField, protowire.BytesType)
+		out = protowire.AppendBytes(out, encoded)
+	}
+
+	for _, e := range s.Exemplars {
+		var encoded []byte
+		encoded = appendPackedUint32(encoded, rw2ExemplarLabelsRefsField, symbols.labelsRefs(e.Labels))
+		encoded = appendDouble(encoded, rw2ExemplarValueField, e.Value)
+		encoded = appendInt64(encoded, rw2ExemplarTimestampField, e.Timestamp)
+
+		out = protowire.AppendTag(out, rw2SeriesExemplarsField, protowire.BytesType)
+		out = protowire.AppendBytes(out, encoded)
+	}
+
+	if metadata != nil {
+		var encoded []byte
+		// The metric type enum values are the same in Remote Write 1.0 and 2.0.
+		if metadata.Type != 0 {
+			encoded = protowire.AppendTag(encoded, rw2MetadataTypeField, protowire.VarintType)
+			encoded = protowire.AppendVarint(encoded, uint64(metadata.Type))
+		}
+		if metadata.Help != "" {
+			encoded = protowire.AppendTag(encoded, rw2MetadataHelpRefField, protowire.VarintType)
+			encoded = protowire.AppendVarint(encoded, uint64(symbols.ref(metadata.Help)))
+		}
+		if metadata.Unit != "" {
+			encoded = protowire.AppendTag(encoded, rw2MetadataUnitRefField, protowire.VarintType)
+			encoded = protowire.AppendVarint(encoded, uint64(symbols.ref(metadata.Unit)))
+		}
+
+		out = protowire.AppendTag(out, rw2SeriesMetadataField, protowire.BytesType)
+		out = protowire.AppendBytes(out, encoded)
+	}
+
+	return out, nil
+}
+
+func seriesMetricName(labels []prompb.Label) string {
+	for _, l := range labels {
+		if l.Name == "__name__" {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+func appendPackedUint32(out []byte, field protowire.Number, values []uint32) []byte {
+	if len(values) == 0 {
+		return out
+	}
+
+	var packed []byte
+	for _, v := range values {
+		packed = protowire.AppendVarint(packed, uint64(v))
+	}
+
+	out = protowire.AppendTag(out, field, protowire.BytesType)
+	return protowire.AppendBytes(out, packed)
+}
+
+func appendDouble(out []byte, field protowire.Number, value float64) []byte {
+	// Default values are not encoded, like in proto3.
+	if value == 0 && !math.Signbit(value) {
+		return out
+	}
+
+	out = protowire.AppendTag(out, field, protowire.Fixed64Type)
+	return protowire.AppendFixed64(out, math.Float64bits(value))
+}
+
+func appendInt64(out []byte, field protowire.Number, value int64) []byte {
+	// Default values are not encoded, like in proto3.
+	if value == 0 {
+		return out
+	}
+
+	out = protowire.AppendTag(out, field, protowire.VarintType)
+	return protowire.AppendVarint(out, uint64(value))
+}
@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestMarshalRemoteWriteV2Request(t *testing.T) {
+	req := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "metric_1"}, {Name: "series_id", Value: "0"}},
+				Samples: []prompb.Sample{{Value: 1.5, Timestamp: 1000}, {Value: 0, Timestamp: 2000}},
+				Exemplars: []prompb.Exemplar{
+					{Labels: []prompb.Label{{Name: "trace_id", Value: "abc"}}, Value: 2, Timestamp: 1000},
+				},
+			}, {
+				Labels: []prompb.Label{{Name: "__name__", Value: "metric_2"}, {Name: "series_id", Value: "0"}},
+				Histograms: []prompb.Histogram{{
+					Count:          &prompb.Histogram_CountInt{CountInt: 3},
+					Sum:            4.5,
+					Schema:         1,
+					ZeroThreshold:  0.001,
+					ZeroCount:      &prompb.Histogram_ZeroCountInt{ZeroCountInt: 1},
+					PositiveSpans:  []prompb.BucketSpan{{Offset: 0, Length: 2}},
+					PositiveDeltas: []int64{1, 0},
+					Timestamp:      3000,
+				}},
+			},
+		},
+		Metadata: []prompb.MetricMetadata{
+			{MetricFamilyName: "metric_1", Type: prompb.MetricMetadata_GAUGE, Help: "Test metric.", Unit: "seconds"},
+		},
+	}
+
+	data, err := marshalRemoteWriteV2Request(req)
+	require.NoError(t, err)
+
+	actual := decodeRemoteWriteV2Request(t, data)
+	assert.Equal(t, req.Timeseries, actual.Timeseries)
+	assert.Equal(t, req.Metadata, actual.Metadata)
+}
+
+func TestClient_WriteSeries_RemoteWriteV2(t *testing.T) {
+	var (
+		receivedRequests []prompb.WriteRequest
+		receivedHeaders  []http.Header
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		receivedHeaders = append(receivedHeaders, request.Header)
+
+		body, err := io.ReadAll(request.Body)
+		require.NoError(t, err)
+		require.NoError(t, request.Body.Close())
+
+		body, err = snappy.Decode(nil, body)
+		require.NoError(t, err)
+
+		receivedRequests = append(receivedRequests, decodeRemoteWriteV2Request(t, body))
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := ClientConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.WriteProtocol = writeProtocolV2
+	require.NoError(t, cfg.Validate())
+	require.NoError(t, cfg.WriteBaseEndpoint.Set(server.URL))
+	require.NoError(t, cfg.ReadBaseEndpoint.Set(server.URL))
+
+	c, err := NewClient(cfg, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+
+	series := generateSineWaveSeries("test", time.Now(), 10)
+	statusCode, err := c.WriteSeries(context.Background(), series)
+	require.NoError(t, err)
+	assert.Equal(t, 204, statusCode)
+
+	require.Len(t, receivedRequests, 1)
+	assert.Equal(t, series, receivedRequests[0].Timeseries)
+	assert.Equal(t, "application/x-protobuf;proto=io.prometheus.write.v2.Request", receivedHeaders[0].Get("Content-Type"))
+	assert.Equal(t, "2.0.0", receivedHeaders[0].Get("X-Prometheus-Remote-Write-Version"))
+	assert.Equal(t, "snappy", receivedHeaders[0].Get("Content-Encoding"))
+}
+
+// decodeRemoteWriteV2Request decodes the input io.prometheus.write.v2.Request into a Remote Write 1.0 request,
+// resolving the symbol references.
+func decodeRemoteWriteV2Request(t *testing.T, data []byte) prompb.WriteRequest {
+	var (
+		symbols []string
+		series  [][]byte
+		req     prompb.WriteRequest
+	)
+
+	forEachField(t, data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) {
+		switch num {
+		case rw2RequestSymbolsField:
+			symbols = append(symbols, string(value))
+		case rw2RequestTimeseriesField:
+			series = append(series, value)
+		}
+	})
+	require.NotEmpty(t, symbols)
+	require.Equal(t, "", symbols[0])
+
+	resolveLabels := func(refs []uint32) []prompb.Label {
+		require.Zero(t, len(refs)%2)
+		var labels []prompb.Label
+		for i := 0; i < len(refs); i += 2 {
+			labels = append(labels, prompb.Label{Name: symbols[refs[i]], Value: symbols[refs[i+1]]})
+		}
+		return labels
+	}
+
+	for _, encoded := range series {
+		var s prompb.TimeSeries
+
+		forEachField(t, encoded, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) {
+			switch num {
+			case rw2SeriesLabelsRefsField:
+				s.Labels = resolveLabels(decodePackedUint32(t, value))
+			case rw2SeriesSamplesField:
+				var sample prompb.Sample
+				forEachField(t, value, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) {
+					switch num {
+					case rw2SampleValueField:
+						sample.Value = math.Float64frombits(scalar)
+					case rw2SampleTimestampField:
+						sample.Timestamp = int64(scalar)
+					}
+				})
+				s.Samples = append(s.Samples, sample)
+			case rw2SeriesHistogramsField:
+				var h prompb.Histogram
+				require.NoError(t, proto.Unmarshal(value, &h))
+				s.Histograms = append(s.Histograms, h)
+			case rw2SeriesExemplarsField:
+				var e prompb.Exemplar
+				forEachField(t, value, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) {
+					switch num {
+					case rw2ExemplarLabelsRefsField:
+						e.Labels = resolveLabels(decodePackedUint32(t, value))
+					case rw2ExemplarValueField:
+						e.Value = math.Float64frombits(scalar)
+					case rw2ExemplarTimestampField:
+						e.Timestamp = int64(scalar)
+					}
+				})
+				s.Exemplars = append(s.Exemplars, e)
+			case rw2SeriesMetadataField:
+				m := prompb.MetricMetadata{MetricFamilyName: seriesMetricName(s.Labels)}
+				forEachField(t, value, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) {
+					switch num {
+					case rw2MetadataTypeField:
+						m.Type = prompb.MetricMetadata_MetricType(scalar)
+					case rw2MetadataHelpRefField:
+						m.Help = symbols[scalar]
+					case rw2MetadataUnitRefField:
+						m.Unit = symbols[scalar]
+					}
+				})
+				req.Metadata = append(req.Metadata, m)
+			}
+		})
+
+		req.Timeseries = append(req.Timeseries, s)
+	}
+
+	return req
+}
+
+// forEachField calls fn for each field of the input protobuf message. Length-delimited fields are passed
+// as value, while varint and fixed64 fields are passed as scalar.
+func forEachField(t *testing.T, data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64)) {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		require.GreaterOrEqual(t, n, 0)
+		data = data[n:]
+
+		switch typ {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(data)
+			require.GreaterOrEqual(t, n, 0)
+			data = data[n:]
+			fn(num, typ, value, 0)
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(data)
+			require.GreaterOrEqual(t, n, 0)
+			data = data[n:]
+			fn(num, typ, nil, value)
+		case protowire.Fixed64Type:
+			value, n := protowire.ConsumeFixed64(data)
+			require.GreaterOrEqual(t, n, 0)
+			data = data[n:]
+			fn(num, typ, nil, value)
+		default:
+			require.Failf(t, "unexpected wire type", "field %d has wire type %d", num, typ)
+		}
+	}
+}
+
+func decodePackedUint32(t *testing.T, data []byte) []uint32 {
+	var values []uint32
+	for len(data) > 0 {
+		value, n := protowire.ConsumeVarint(data)
+		require.GreaterOrEqual(t, n, 0)
+		data = data[n:]
+		values = append(values, uint32(value))
+	}
+	return values
+}
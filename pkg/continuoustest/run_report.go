@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+const (
+	runReportUploadTimeout = time.Minute
+
+	// runReportTimestampFormat is the format of the timestamp in the object name of run reports,
+	// which sorts lexicographically.
+	runReportTimestampFormat = "20060102T150405.000Z"
+
+	runStatusSuccess = "success"
+	runStatusFailure = "failure"
+
+	uploadOutcomeSuccess = "success"
+	uploadOutcomeFailed  = "failed"
+)
+
+type RunReportsConfig struct {
+	Enabled bool
+	Bucket  bucket.Config
+}
+
+func (cfg *RunReportsConfig) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
+	f.BoolVar(&cfg.Enabled, "tests.run-reports.enabled", false, "Upload a JSON report of each test run to the object storage configured by the -tests.run-reports.* flags.")
+	cfg.Bucket.RegisterFlagsWithPrefixAndDefaultDirectory("tests.run-reports.", "./run-reports", f, logger)
+}
+
+func (cfg *RunReportsConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	return cfg.Bucket.Validate()
+}
+
+// runReport is the machine-readable report of a single test run.
+type runReport struct {
+	Test            string    `json:"test"`
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+	Maintenance     bool      `json:"maintenance"`
+
+	Queries                  []queryReport             `json:"queries"`
+	QueryResultCheckFailures []queryResultCheckFailure `json:"query_result_check_failures"`
+
+	// Protects the queries and failures, which may be added concurrently.
+	mtx sync.Mutex
+}
+
+// queryReport is the outcome of a single query run by a test.
+type queryReport struct {
+	Query string `json:"query"`
+
+	// Start and End are equal for instant queries, and Step is empty.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Step  string    `json:"step,omitempty"`
+
+	ResultsCache    bool    `json:"results_cache"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+func newRunReport(test string, start time.Time, state maintenanceState) *runReport {
+	return &runReport{
+		Test:                     test,
+		Start:                    start.UTC(),
+		Maintenance:              state != maintenanceNone,
+		Queries:                  []queryReport{},
+		QueryResultCheckFailures: []queryResultCheckFailure{},
+	}
+}
+
+func (r *runReport) addQuery(q queryReport) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.Queries = append(r.Queries, q)
+}
+
+func (r *runReport) addQueryResultCheckFailure(f queryResultCheckFailure) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.QueryResultCheckFailures = append(r.QueryResultCheckFailures, f)
+}
+
+// finish sets the outcome of the test run.
+func (r *runReport) finish(end time.Time, err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.DurationSeconds = end.Sub(r.Start).Seconds()
+	r.Status = runStatusSuccess
+	if err != nil {
+		r.Status, r.Error = runStatusFailure, err.Error()
+	}
+}
+
+// objectName returns the name of the object where the report is uploaded, keyed by test and start time.
+func (r *runReport) objectName() string {
+	return fmt.Sprintf("%s/%s.json", r.Test, r.Start.Format(runReportTimestampFormat))
+}
+
+type runReportContextKey int
+
+const runReportKey runReportContextKey = 0
+
+// contextWithRunReport returns a new context with the run report attached.
+func contextWithRunReport(ctx context.Context, r *runReport) context.Context {
+	return context.WithValue(ctx, runReportKey, r)
+}
+
+// runReportFromContext returns the run report attached to the context, or nil if not set.
+func runReportFromContext(ctx context.Context) *runReport {
+	r, _ := ctx.Value(runReportKey).(*runReport)
+	return r
+}
+
+// RunReportUploader uploads test run reports to the object storage.
+type RunReportUploader struct {
+	bkt    objstore.Bucket
+	logger log.Logger
+
+	uploadsTotal *prometheus.CounterVec
+}
+
+func NewRunReportUploader(cfg RunReportsConfig, logger log.Logger, reg prometheus.Registerer) (*RunReportUploader, error) {
+	bkt, err := bucket.NewClient(context.Background(), cfg.Bucket, "run-reports", logger, reg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRunReportUploader(bkt, logger, reg), nil
+}
+
+func newRunReportUploader(bkt objstore.Bucket, logger log.Logger, reg prometheus.Registerer) *RunReportUploader {
+	return &RunReportUploader{
+		bkt:    bkt,
+		logger: logger,
+		uploadsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "mimir_continuous_test_run_report_uploads_total",
+			Help: "Total number of test run reports uploaded to the object storage, partitioned by outcome.",
+		}, []string{"outcome"}),
+	}
+}
+
+// upload uploads the report. Failures are logged and tracked, but don't fail the test run.
+func (u *RunReportUploader) upload(ctx context.Context, r *runReport) {
+	r.mtx.Lock()
+	payload, err := json.Marshal(r)
+	r.mtx.Unlock()
+
+	if err == nil {
+		ctx, cancel := context.WithTimeout(ctx, runReportUploadTimeout)
+		err = u.bkt.Upload(ctx, r.objectName(), bytes.NewReader(payload))
+		cancel()
+	}
+
+	if err != nil {
+		u.uploadsTotal.WithLabelValues(uploadOutcomeFailed).Inc()
+		level.Warn(u.logger).Log("msg", "Failed to upload test run report", "test", r.Test, "object", r.objectName(), "err", err)
+		return
+	}
+	u.uploadsTotal.WithLabelValues(uploadOutcomeSuccess).Inc()
+}
+
+// ReportingClient is a MimirClient which records the outcome of each query in the run report
+// attached to the context, if any.
+type ReportingClient struct {
+	MimirClient
+}
+
+func NewReportingClient(client MimirClient) *ReportingClient {
+	return &ReportingClient{MimirClient: client}
+}
+
+// QueryRange implements MimirClient.
+func (c *ReportingClient) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration, options ...RequestOption) (model.Matrix, error) {
+	queryStart := time.Now()
+	matrix, err := c.MimirClient.QueryRange(ctx, query, start, end, step, options...)
+	recordQuery(ctx, queryReport{Query: query, Start: start, End: end, Step: step.String()}, queryStart, err, options)
+	return matrix, err
+}
+
+// Query implements MimirClient.
+func (c *ReportingClient) Query(ctx context.Context, query string, ts time.Time, options ...RequestOption) (model.Vector, error) {
+	queryStart := time.Now()
+	vector, err := c.MimirClient.Query(ctx, query, ts, options...)
+	recordQuery(ctx, queryReport{Query: query, Start: ts, End: ts}, queryStart, err, options)
+	return vector, err
+}
+
+// recordQuery adds the query outcome to the run report attached to the context, if any.
+func recordQuery(ctx context.Context, q queryReport, queryStart time.Time, err error, options []RequestOption) {
+	r := runReportFromContext(ctx)
+	if r == nil {
+		return
+	}
+
+	opts := &requestOptions{}
+	for _, o := range options {
+		o(opts)
+	}
+
+	q.Start, q.End = q.Start.UTC(), q.End.UTC()
+	q.ResultsCache = !opts.resultsCacheDisabled
+	q.DurationSeconds = time.Since(queryStart).Seconds()
+	if err != nil {
+		q.Error = err.Error()
+	}
+	r.addQuery(q)
+}
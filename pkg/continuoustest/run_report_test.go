@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestManager_RunReports(t *testing.T) {
+	now := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	queryStart := now.Add(-time.Hour)
+
+	client := &ClientMock{}
+	client.On("QueryRange", mock.Anything, "sum(metric)", queryStart, now, 20*time.Second, mock.Anything).Return(model.Matrix{}, nil)
+	client.On("Query", mock.Anything, "sum(metric)", now, mock.Anything).Return(model.Vector{}, errors.New("query failed"))
+	reportingClient := NewReportingClient(client)
+
+	bkt := objstore.NewInMemBucket()
+	reg := prometheus.NewPedanticRegistry()
+
+	manager := NewManager(ManagerConfig{}, log.NewNopLogger())
+	manager.SetRunReportUploader(newRunReportUploader(bkt, log.NewNopLogger(), reg))
+
+	test := &testFunc{run: func(ctx context.Context, now time.Time) error {
+		_, _ = reportingClient.QueryRange(ctx, "sum(metric)", queryStart, now, 20*time.Second, WithResultsCacheEnabled(false))
+		_, err := reportingClient.Query(ctx, "sum(metric)", now)
+
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: "dummyTest", Query: "sum(metric)", Start: queryStart, End: now, Step: "20s", Error: "sample mismatch", Time: now})
+		return err
+	}}
+
+	require.EqualError(t, manager.runTest(context.Background(), test, now), "query failed")
+
+	reader, err := bkt.Get(context.Background(), "dummyTest/20230101T100000.000Z.json")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	var report runReport
+	require.NoError(t, json.Unmarshal(data, &report))
+
+	assert.Equal(t, "dummyTest", report.Test)
+	assert.Equal(t, now, report.Start)
+	assert.Equal(t, runStatusFailure, report.Status)
+	assert.Equal(t, "query failed", report.Error)
+	assert.False(t, report.Maintenance)
+
+	require.Len(t, report.Queries, 2)
+	assert.Equal(t, "sum(metric)", report.Queries[0].Query)
+	assert.Equal(t, queryStart, report.Queries[0].Start)
+	assert.Equal(t, now, report.Queries[0].End)
+	assert.Equal(t, "20s", report.Queries[0].Step)
+	assert.False(t, report.Queries[0].ResultsCache)
+	assert.Empty(t, report.Queries[0].Error)
+	assert.Equal(t, now, report.Queries[1].Start)
+	assert.Equal(t, now, report.Queries[1].End)
+	assert.Empty(t, report.Queries[1].Step)
+	assert.True(t, report.Queries[1].ResultsCache)
+	assert.Equal(t, "query failed", report.Queries[1].Error)
+
+	assert.Equal(t, []queryResultCheckFailure{{Test: "dummyTest", Query: "sum(metric)", Start: queryStart, End: now, Step: "20s", Error: "sample mismatch", Time: now}}, report.QueryResultCheckFailures)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP mimir_continuous_test_run_report_uploads_total Total number of test run reports uploaded to the object storage, partitioned by outcome.
+		# TYPE mimir_continuous_test_run_report_uploads_total counter
+		mimir_continuous_test_run_report_uploads_total{outcome="success"} 1
+	`)))
+}
+
+func TestReportingClient_ShouldNotRecordQueriesWithoutRunReport(t *testing.T) {
+	now := time.Now()
+
+	client := &ClientMock{}
+	client.On("Query", mock.Anything, "sum(metric)", now, mock.Anything).Return(model.Vector{}, nil)
+
+	_, err := NewReportingClient(client).Query(context.Background(), "sum(metric)", now)
+	require.NoError(t, err)
+	client.AssertNumberOfCalls(t, "Query", 1)
+}
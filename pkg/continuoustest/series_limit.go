@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	util_math "github.com/grafana/mimir/pkg/util/math"
+)
+
+const (
+	// Reasons of the failed probes of the tests verifying the enforcement of the ingestion limits.
+	limitProbeReasonNotEnforced   = "not_enforced"
+	limitProbeReasonUnexpectedErr = "unexpected_error"
+	limitProbeReasonNotRecovered  = "not_recovered"
+
+	// maxSeriesPerUserOvershoot is the factor of the configured series limit up to which the series are ramped
+	// up before the limit is considered not enforced. The limit is enforced by each ingester on its share of the
+	// series, so the rejections are expected to start close to, but not exactly at, the limit.
+	maxSeriesPerUserOvershoot = 2
+)
+
+// rampUpSeriesUntilRejected doubles the number of series written until a write request isn't accepted, or
+// maxSeriesPerUserOvershoot times the series limit have been accepted. The series with ID in the range [from, to)
+// are generated by the input function. It returns the number of series accepted, the end of the range of the
+// last write request, and the status code and error of the last write request.
+func rampUpSeriesUntilRejected(ctx context.Context, maxSeriesPerUser int, write func(context.Context, []prompb.TimeSeries) (int, error), generate func(from, to int) []prompb.TimeSeries) (written, end, statusCode int, err error) {
+	maxSeries := maxSeriesPerUser * maxSeriesPerUserOvershoot
+	for size := 1; ; size *= 2 {
+		end = util_math.Min(written+size, maxSeries)
+		statusCode, err = write(ctx, generate(written, end))
+		if statusCode/100 != 2 {
+			return written, end, statusCode, err
+		}
+
+		written = end
+		if written >= maxSeries {
+			return written, end, statusCode, err
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRampUpSeriesUntilRejected(t *testing.T) {
+	errLimited := errors.New("limited")
+
+	// newWrite returns a write function accepting up to the input number of series in total, and the ranges written.
+	newWrite := func(accepted int) (func(context.Context, []prompb.TimeSeries) (int, error), *[][2]int) {
+		var ranges [][2]int
+		total := 0
+		return func(_ context.Context, series []prompb.TimeSeries) (int, error) {
+			from := int(series[0].Samples[0].Timestamp)
+			ranges = append(ranges, [2]int{from, from + len(series)})
+			if total+len(series) > accepted {
+				return http.StatusBadRequest, errLimited
+			}
+			total += len(series)
+			return http.StatusOK, nil
+		}, &ranges
+	}
+	generate := func(from, to int) []prompb.TimeSeries {
+		series := make([]prompb.TimeSeries, 0, to-from)
+		for id := from; id < to; id++ {
+			series = append(series, prompb.TimeSeries{Samples: []prompb.Sample{{Timestamp: int64(id)}}})
+		}
+		return series
+	}
+
+	t.Run("should stop at the first rejected write request", func(t *testing.T) {
+		write, ranges := newWrite(5)
+		written, end, statusCode, err := rampUpSeriesUntilRejected(context.Background(), 10, write, generate)
+		assert.Equal(t, 3, written)
+		assert.Equal(t, 7, end)
+		assert.Equal(t, http.StatusBadRequest, statusCode)
+		assert.ErrorIs(t, err, errLimited)
+		assert.Equal(t, [][2]int{{0, 1}, {1, 3}, {3, 7}}, *ranges)
+	})
+
+	t.Run("should stop once the series limit has been overshot", func(t *testing.T) {
+		write, ranges := newWrite(100)
+		written, end, statusCode, err := rampUpSeriesUntilRejected(context.Background(), 5, write, generate)
+		assert.Equal(t, 10, written)
+		assert.Equal(t, 10, end)
+		assert.Equal(t, http.StatusOK, statusCode)
+		assert.NoError(t, err)
+		assert.Equal(t, [][2]int{{0, 1}, {1, 3}, {3, 7}, {7, 10}}, *ranges)
+	})
+}
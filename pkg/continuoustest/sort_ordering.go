@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	sortOrderingMetricName = "mimir_continuous_test_phase_shifted_sine_wave"
+
+	// sortOrderingTopK is the k parameter of the topk() query.
+	sortOrderingTopK = 5
+)
+
+var (
+	// See queryMetricSum for the reason why max_over_time() is used.
+	sortOrderingSeriesQuery = fmt.Sprintf("sum by (series_id) (max_over_time(%s[1s]))", sortOrderingMetricName)
+	sortOrderingSortQuery   = fmt.Sprintf("sort(%s)", sortOrderingSeriesQuery)
+	sortOrderingTopKQuery   = fmt.Sprintf("topk(%d, %s)", sortOrderingTopK, sortOrderingSeriesQuery)
+)
+
+type SortOrderingTestConfig struct {
+	Enabled   bool
+	NumSeries int
+}
+
+func (cfg *SortOrderingTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.sort-ordering-test.enabled", false, "Enable the test which periodically writes sine wave series, each one shifted by a different phase, and checks whether the results of sort() and topk() queries have the expected ordering and membership.")
+	f.IntVar(&cfg.NumSeries, "tests.sort-ordering-test.num-series", 10, fmt.Sprintf("Number of phase shifted series written by the test. Must be greater than %d.", sortOrderingTopK))
+}
+
+func (cfg *SortOrderingTestConfig) Validate() error {
+	if cfg.NumSeries <= sortOrderingTopK {
+		return fmt.Errorf("the number of series written by the sort ordering test must be greater than %d", sortOrderingTopK)
+	}
+	return nil
+}
+
+// SortOrderingTest periodically writes sine wave series, each one shifted by a different phase so that the
+// ordering of the series by value changes over time and can be computed from the timestamp, and checks
+// whether sort() returns all series ordered by value and topk() returns the series with the highest values.
+type SortOrderingTest struct {
+	name    string
+	cfg     SortOrderingTestConfig
+	client  MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	lastWrittenTimestamp time.Time
+}
+
+func NewSortOrderingTest(cfg SortOrderingTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *SortOrderingTest {
+	const name = "sort-ordering"
+
+	return &SortOrderingTest{
+		name:    name,
+		cfg:     cfg,
+		client:  client,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+	}
+}
+
+// Name implements Test.
+func (t *SortOrderingTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *SortOrderingTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *SortOrderingTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	// Write at most once per write interval, and verify the timestamp just written.
+	timestamp := alignTimestampToInterval(now, writeInterval)
+	if !timestamp.After(t.lastWrittenTimestamp) {
+		return nil
+	}
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "SortOrderingTest.Run")
+	defer sp.Finish()
+	logger := log.With(sp, "timestamp", timestamp.UnixMilli(), "num_series", t.cfg.NumSeries)
+
+	t.metrics.writesTotal.Inc()
+	start := time.Now()
+	statusCode, err := t.client.WriteSeries(ctx, generatePhaseShiftedSineWaveSeries(sortOrderingMetricName, timestamp, t.cfg.NumSeries))
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+	if statusCode/100 != 2 {
+		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Failed to remote write series", "status_code", statusCode, "err", err)
+		return errors.Wrapf(err, "remote write series failed with status code %d", statusCode)
+	}
+	t.metrics.observeSuccess(outcomeTypeWrite)
+	t.lastWrittenTimestamp = timestamp
+
+	errs := multierror.New()
+	errs.Add(t.runQueryAndVerifyResult(ctx, logger, sortOrderingSortQuery, timestamp, verifySortResult))
+	errs.Add(t.runQueryAndVerifyResult(ctx, logger, sortOrderingTopKQuery, timestamp, verifyTopKResult))
+	return errs.Err()
+}
+
+func (t *SortOrderingTest) runQueryAndVerifyResult(ctx context.Context, logger log.Logger, query string, timestamp time.Time, verify func(model.Vector, time.Time, int) error) error {
+	logger = log.With(logger, "query", query)
+
+	t.metrics.queriesTotal.Inc()
+	start := time.Now()
+	vector, err := t.client.Query(ctx, query, timestamp, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute instant query", "err", err)
+		return errors.Wrapf(err, "failed to execute instant query %s", query)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	t.metrics.queryResultChecksTotal.Inc()
+	if err := verify(vector, timestamp, t.cfg.NumSeries); err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Query result check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: query, Start: timestamp, End: timestamp, Error: err.Error()})
+		return errors.Wrapf(err, "query result check failed for query %s", query)
+	}
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+
+	level.Debug(logger).Log("msg", "Query result check succeeded")
+	return nil
+}
+
+// verifySortResult checks whether the input vector contains all the phase shifted series, each one with
+// its expected value, ordered by ascending value.
+func verifySortResult(vector model.Vector, timestamp time.Time, numSeries int) error {
+	if len(vector) != numSeries {
+		return fmt.Errorf("expected %d series in the result but got %d", numSeries, len(vector))
+	}
+	if err := verifyPhaseShiftedSineWaveValues(vector, timestamp, numSeries); err != nil {
+		return err
+	}
+
+	for i := 1; i < len(vector); i++ {
+		if vector[i].Value < vector[i-1].Value {
+			return fmt.Errorf("series %s with value %f is returned after series %s with the higher value %f", vector[i].Metric, vector[i].Value, vector[i-1].Metric, vector[i-1].Value)
+		}
+	}
+	return nil
+}
+
+// verifyTopKResult checks whether the input vector contains the sortOrderingTopK phase shifted series with
+// the highest values, each one with its expected value. The ordering of the topk() result is not checked,
+// because it's not guaranteed by PromQL.
+func verifyTopKResult(vector model.Vector, timestamp time.Time, numSeries int) error {
+	if len(vector) != sortOrderingTopK {
+		return fmt.Errorf("expected %d series in the result but got %d", sortOrderingTopK, len(vector))
+	}
+	if err := verifyPhaseShiftedSineWaveValues(vector, timestamp, numSeries); err != nil {
+		return err
+	}
+
+	// Any series whose value is at least the k-th highest one is a valid member of the result,
+	// so that series with equal values don't cause false positives.
+	expected := make([]float64, 0, numSeries)
+	for i := 0; i < numSeries; i++ {
+		expected = append(expected, generatePhaseShiftedSineWaveValue(timestamp, i, numSeries))
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(expected)))
+	minValue := expected[sortOrderingTopK-1]
+
+	for _, sample := range vector {
+		if float64(sample.Value) < minValue {
+			return fmt.Errorf("series %s with value %f is not among the %d series with the highest values (lowest expected value: %f)", sample.Metric, sample.Value, sortOrderingTopK, minValue)
+		}
+	}
+	return nil
+}
+
+// verifyPhaseShiftedSineWaveValues checks whether each series in the input vector is a distinct phase shifted series
+// with the expected value at the input timestamp.
+func verifyPhaseShiftedSineWaveValues(vector model.Vector, timestamp time.Time, numSeries int) error {
+	seen := make(map[int]struct{}, len(vector))
+
+	for _, sample := range vector {
+		seriesID, err := strconv.Atoi(string(sample.Metric["series_id"]))
+		if err != nil || seriesID < 0 || seriesID >= numSeries {
+			return fmt.Errorf("unexpected series %s in the result", sample.Metric)
+		}
+		if _, ok := seen[seriesID]; ok {
+			return fmt.Errorf("series %s is returned more than once", sample.Metric)
+		}
+		seen[seriesID] = struct{}{}
+
+		if expected := generatePhaseShiftedSineWaveValue(timestamp, seriesID, numSeries); !compareSampleValues(float64(sample.Value), expected) {
+			return fmt.Errorf("series %s has value %f but %f was expected", sample.Metric, sample.Value, expected)
+		}
+	}
+	return nil
+}
+
+// generatePhaseShiftedSineWaveValue returns the value of the input series at the input timestamp. The phases
+// of the numSeries series are evenly spread over the sine wave period.
+func generatePhaseShiftedSineWaveValue(t time.Time, seriesID, numSeries int) float64 {
+	period := 10 * time.Minute
+	radians := 2*math.Pi*float64(t.UnixNano())/float64(period.Nanoseconds()) + 2*math.Pi*float64(seriesID)/float64(numSeries)
+	return math.Sin(radians)
+}
+
+func generatePhaseShiftedSineWaveSeries(name string, t time.Time, numSeries int) []prompb.TimeSeries {
+	series := generateSineWaveSeries(name, t, numSeries)
+	for i := range series {
+		series[i].Samples[0].Value = generatePhaseShiftedSineWaveValue(t, i, numSeries)
+	}
+	return series
+}
@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortOrderingTestConfig_Validate(t *testing.T) {
+	cfg := SortOrderingTestConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.NumSeries = sortOrderingTopK
+	assert.Error(t, cfg.Validate())
+}
+
+func TestSortOrderingTest_Run(t *testing.T) {
+	cfg := SortOrderingTestConfig{}
+	flagext.DefaultValues(&cfg)
+
+	now := time.Unix(1000, 0)
+	ts := alignTimestampToInterval(now, writeInterval)
+
+	// sortedVector returns the expected sort() result at the test timestamp.
+	sortedVector := func() model.Vector {
+		vector := model.Vector{}
+		for i := 0; i < cfg.NumSeries; i++ {
+			vector = append(vector, &model.Sample{
+				Metric: model.Metric{"series_id": model.LabelValue(strconv.Itoa(i))},
+				Value:  model.SampleValue(generatePhaseShiftedSineWaveValue(ts, i, cfg.NumSeries)),
+			})
+		}
+		sort.SliceStable(vector, func(i, j int) bool { return vector[i].Value < vector[j].Value })
+		return vector
+	}
+
+	// topKVector returns the expected topk() result at the test timestamp, in ascending order.
+	topKVector := func() model.Vector {
+		vector := sortedVector()
+		return vector[len(vector)-sortOrderingTopK:]
+	}
+
+	t.Run("should write phase shifted series and check the sort() and topk() results", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("Query", mock.Anything, sortOrderingSortQuery, ts, mock.Anything).Return(sortedVector(), nil)
+		client.On("Query", mock.Anything, sortOrderingTopKQuery, ts, mock.Anything).Return(topKVector(), nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewSortOrderingTest(cfg, client, log.NewNopLogger(), reg)
+
+		require.NoError(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "WriteSeries", 1)
+		client.AssertNumberOfCalls(t, "Query", 2)
+
+		series := client.Calls[0].Arguments.Get(1).([]prompb.TimeSeries)
+		require.Len(t, series, cfg.NumSeries)
+		for i, s := range series {
+			assert.Equal(t, generatePhaseShiftedSineWaveValue(ts, i, cfg.NumSeries), s.Samples[0].Value)
+		}
+
+		// The same timestamp is not written twice.
+		require.NoError(t, test.Run(context.Background(), now.Add(time.Second)))
+		client.AssertNumberOfCalls(t, "WriteSeries", 1)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_total Total number of query results checked for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_total counter
+			mimir_continuous_test_query_result_checks_total{test="sort-ordering"} 2
+
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="sort-ordering"} 0
+		`), "mimir_continuous_test_query_result_checks_total", "mimir_continuous_test_query_result_checks_failed_total"))
+	})
+
+	t.Run("should fail if the write request failed", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(500, errors.New("failed"))
+
+		test := NewSortOrderingTest(cfg, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+		require.Error(t, test.Run(context.Background(), now))
+		client.AssertNumberOfCalls(t, "Query", 0)
+	})
+
+	t.Run("should fail if the results have unexpected ordering or membership", func(t *testing.T) {
+		unsorted := sortedVector()
+		unsorted[0], unsorted[1] = unsorted[1], unsorted[0]
+
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("Query", mock.Anything, sortOrderingSortQuery, ts, mock.Anything).Return(unsorted, nil)
+		client.On("Query", mock.Anything, sortOrderingTopKQuery, ts, mock.Anything).Return(sortedVector()[:sortOrderingTopK], nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewSortOrderingTest(cfg, client, log.NewNopLogger(), reg)
+
+		err := test.Run(context.Background(), now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "query result check failed for query "+sortOrderingSortQuery)
+		assert.Contains(t, err.Error(), "query result check failed for query "+sortOrderingTopKQuery)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
+			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="sort-ordering"} 2
+		`), "mimir_continuous_test_query_result_checks_failed_total"))
+	})
+}
+
+func TestVerifyPhaseShiftedSineWaveValues(t *testing.T) {
+	ts := time.Unix(1000, 0)
+	sample := func(seriesID string, value float64) *model.Sample {
+		return &model.Sample{Metric: model.Metric{"series_id": model.LabelValue(seriesID)}, Value: model.SampleValue(value)}
+	}
+
+	assert.NoError(t, verifyPhaseShiftedSineWaveValues(model.Vector{
+		sample("0", generatePhaseShiftedSineWaveValue(ts, 0, 2)),
+		sample("1", generatePhaseShiftedSineWaveValue(ts, 1, 2)),
+	}, ts, 2))
+
+	assert.ErrorContains(t, verifyPhaseShiftedSineWaveValues(model.Vector{
+		sample("0", generatePhaseShiftedSineWaveValue(ts, 0, 2)),
+		sample("0", generatePhaseShiftedSineWaveValue(ts, 0, 2)),
+	}, ts, 2), "returned more than once")
+
+	assert.ErrorContains(t, verifyPhaseShiftedSineWaveValues(model.Vector{
+		sample("2", generatePhaseShiftedSineWaveValue(ts, 0, 2)),
+	}, ts, 2), "unexpected series")
+
+	assert.ErrorContains(t, verifyPhaseShiftedSineWaveValues(model.Vector{
+		sample("1", generatePhaseShiftedSineWaveValue(ts, 0, 2)),
+	}, ts, 2), "was expected")
+}
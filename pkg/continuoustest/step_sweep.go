@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+// StepSweepConfig configures the step sweep of the write-read series test, which runs the same range query
+// with different steps.
+type StepSweepConfig struct {
+	StepSweepSteps DurationSliceCSV
+}
+
+func (cfg *StepSweepConfig) RegisterFlags(f *flag.FlagSet) {
+	f.Var(&cfg.StepSweepSteps, "tests.write-read-series-test.step-sweep-steps", "Comma-separated list of query steps, for example 20s,40s,100s,30s,70s. When set, on each test run the range query over the most recent hour of the first queried time range is run once for each configured step, with the results cache enabled and disabled, and each result is verified independently. Steps which are not a multiple of the write interval are supported: the samples are expected only at the steps aligned to the write interval.")
+}
+
+func (cfg *StepSweepConfig) Validate() error {
+	for _, step := range cfg.StepSweepSteps {
+		if step < time.Millisecond || step%time.Millisecond != 0 {
+			return fmt.Errorf("invalid step sweep step %s: the step must be a positive multiple of 1ms", step)
+		}
+	}
+	return nil
+}
+
+// runStepSweep runs the range query over the most recent hour of the first input time range once for each
+// configured step, with the results cache enabled and disabled.
+func (t *WriteReadSeriesTest) runStepSweep(ctx context.Context, queryRanges [][2]time.Time, responseFormat string) error {
+	start, end, ok := mostRecentHour(queryRanges)
+	if !ok {
+		return nil
+	}
+
+	errs := multierror.New()
+	for _, step := range t.cfg.StepSweepSteps {
+		errs.Add(t.runStepSweepQueryAndVerifyResult(ctx, start, end, step, true, responseFormat))
+		errs.Add(t.runStepSweepQueryAndVerifyResult(ctx, start, end, step, false, responseFormat))
+	}
+	return errs.Err()
+}
+
+// runStepSweepQueryAndVerifyResult runs a range query with the input step, which may not be a multiple of the
+// write interval, and verifies its result.
+func (t *WriteReadSeriesTest) runStepSweepQueryAndVerifyResult(ctx context.Context, start, end time.Time, step time.Duration, resultsCacheEnabled bool, responseFormat string) (err error) {
+	// We align start and end to the step, within the min/max query time, so that the query result
+	// is the same whether the query-frontend aligns the queries to the step or not.
+	start = alignTimestampToStep(maxTime(t.queryMinTime, start), step)
+	if start.Before(t.queryMinTime) {
+		start = start.Add(step)
+	}
+	end = alignTimestampToStep(minTime(t.queryMaxTime, end), step)
+	if end.Before(start) {
+		return nil
+	}
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "WriteReadSeriesTest.runStepSweepQueryAndVerifyResult")
+	defer sp.Finish()
+
+	setQueryTraceAttributes(sp.Span, t.querySum, start, end, step, resultsCacheEnabled, responseFormat)
+	defer func() { _ = sp.Error(err) }()
+
+	logger := log.With(sp, "query", t.querySum, "start", start.UnixMilli(), "end", end.UnixMilli(), "step", step, "results_cache", strconv.FormatBool(resultsCacheEnabled), "response_format", responseFormat)
+	level.Debug(logger).Log("msg", "Running step sweep range query")
+
+	t.metrics.queriesTotal.Inc()
+	queryStart := time.Now()
+	matrix, err := t.client.QueryRange(ctx, t.querySum, start, end, step, WithResultsCacheEnabled(resultsCacheEnabled), WithResponseFormat(responseFormat))
+	t.metrics.observeQueryDuration(queryTypeRange, resultsCacheEnabled, queryStart)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute step sweep range query", "err", err)
+		return errors.Wrap(err, "failed to execute step sweep range query")
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	setWaveResultTraceAttributes(sp.Span, matrix, t.sumWaveform, end, 1)
+	t.metrics.queryResultChecksTotal.Inc()
+	err = verifyWaveSamplesSumAtSteps(matrix, t.sumWaveform, 1, start, end, step, t.isGap)
+	recordQueryResultCheck(ctx, end, err)
+	if err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		t.stepSweepFailuresTotal.WithLabelValues(step.String()).Inc()
+		level.Warn(logger).Log("msg", "Step sweep range query result check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: t.querySum, Start: start, End: end, Step: step.String(), Error: err.Error()})
+		return errors.Wrapf(err, "step sweep range query result check failed with step %s", step)
+	}
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+
+	return nil
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStepSweepConfig_Validate(t *testing.T) {
+	cfg := StepSweepConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.StepSweepSteps = DurationSliceCSV{20 * time.Second, 30 * time.Second}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.StepSweepSteps = DurationSliceCSV{0}
+	assert.Error(t, cfg.Validate())
+
+	cfg.StepSweepSteps = DurationSliceCSV{1500 * time.Microsecond}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestWriteReadSeriesTest_Run_StepSweep(t *testing.T) {
+	logger := log.NewNopLogger()
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+	cfg.MaxQueryAge = 2 * time.Hour
+	cfg.StepSweepSteps = DurationSliceCSV{40 * time.Second, 30 * time.Second}
+
+	now := time.Unix(10000, 0)
+	withStep := func(expected time.Duration) interface{} {
+		return mock.MatchedBy(func(step time.Duration) bool { return step == expected })
+	}
+
+	for name, tc := range map[string]struct {
+		unevenStepResult model.Matrix
+		expectedFailures int
+	}{
+		"results match": {
+			// With a 30s step, samples are expected only every 60s, at the steps aligned to the write interval.
+			unevenStepResult: model.Matrix{{Values: generateSineWaveSamplesSum(time.Unix(9600, 0), time.Unix(9960, 0), cfg.NumSeries, time.Minute)}},
+			expectedFailures: 0,
+		},
+		"results don't match": {
+			unevenStepResult: model.Matrix{{Values: generateSineWaveSamplesSum(time.Unix(9600, 0), time.Unix(9990, 0), cfg.NumSeries, 30*time.Second)}},
+			expectedFailures: 2,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := &ClientMock{}
+			client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+			client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{}, nil)
+			client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, withStep(40*time.Second), mock.Anything).Return(model.Matrix{
+				{Values: generateSineWaveSamplesSum(time.Unix(9600, 0), time.Unix(10000, 0), cfg.NumSeries, 40*time.Second)},
+			}, nil)
+			client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, withStep(30*time.Second), mock.Anything).Return(tc.unevenStepResult, nil)
+			client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil)
+
+			reg := prometheus.NewPedanticRegistry()
+			test := NewWriteReadSeriesTest(cfg, client, logger, reg)
+			test.lastWrittenTimestamp = now
+			test.queryMinTime = time.Unix(9590, 0)
+			test.queryMaxTime = now
+
+			_ = test.Run(context.Background(), now)
+
+			// The start and end of each step sweep query are aligned to the step, within the written time range.
+			client.AssertCalled(t, "QueryRange", mock.Anything, queryMetricSum, time.UnixMilli(9600000), time.UnixMilli(10000000), 40*time.Second, mock.Anything)
+			client.AssertCalled(t, "QueryRange", mock.Anything, queryMetricSum, time.UnixMilli(9600000), time.UnixMilli(9990000), 30*time.Second, mock.Anything)
+
+			assert.Equal(t, float64(0), testutil.ToFloat64(test.stepSweepFailuresTotal.WithLabelValues("40s")))
+			assert.Equal(t, float64(tc.expectedFailures), testutil.ToFloat64(test.stepSweepFailuresTotal.WithLabelValues("30s")))
+		})
+	}
+}
@@ -0,0 +1,267 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	// tenantDeletionMetricName is the name of the marker metric written to each disposable tenant.
+	tenantDeletionMetricName = "mimir_continuous_test_tenant_deletion_marker"
+)
+
+type TenantDeletionTestConfig struct {
+	Enabled        bool
+	TenantPrefix   string
+	DeletionWindow time.Duration
+}
+
+func (cfg *TenantDeletionTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.tenant-deletion-test.enabled", false, "Enable the test which writes a marker series to a disposable tenant, requests the deletion of the tenant through the tenant deletion API, and checks over the following test runs that the marker series becomes unqueryable within the deletion window. Once it does, the test starts over with a new disposable tenant. The tenants are selected with the X-Scope-OrgID header, so the test can't be used with basic or bearer token authentication.")
+	f.StringVar(&cfg.TenantPrefix, "tests.tenant-deletion-test.tenant-prefix", "mimir-continuous-test-deletion", "The prefix of the disposable tenant IDs. The ID of each disposable tenant is the prefix followed by the Unix timestamp of its creation.")
+	f.DurationVar(&cfg.DeletionWindow, "tests.tenant-deletion-test.deletion-window", 24*time.Hour, "The maximum time from the tenant deletion request until the data of the tenant is expected to be unqueryable. It should account for the compactor cleanup interval and the time after which the ingesters close the idle TSDBs.")
+}
+
+func (cfg *TenantDeletionTestConfig) Validate() error {
+	if cfg.TenantPrefix == "" {
+		return errors.New("the tenant prefix of the tenant deletion test must not be empty")
+	}
+	if cfg.DeletionWindow <= 0 {
+		return errors.New("the deletion window of the tenant deletion test must be greater than 0")
+	}
+	return nil
+}
+
+// TenantDeletionClient is a MimirClient which can delete its tenant.
+type TenantDeletionClient interface {
+	MimirClient
+
+	// DeleteTenant requests the deletion of all the data of the tenant through the tenant deletion API. Returns an
+	// error if the request was not successful.
+	DeleteTenant(ctx context.Context) error
+}
+
+// TenantClientFactory returns a client writing, reading and deleting the input tenant.
+type TenantClientFactory func(tenantID string) (TenantDeletionClient, error)
+
+// tenantDeletionCycle holds the state of a disposable tenant, from the creation until the verification of its deletion.
+type tenantDeletionCycle struct {
+	tenantID string
+	client   TenantDeletionClient
+
+	// writtenAt is the timestamp of the marker series sample. It's zero until the tenant deletion has been requested.
+	writtenAt           time.Time
+	deletionRequestedAt time.Time
+
+	// violated is whether the deletion window has been exceeded, so that the violation is tracked once.
+	violated bool
+}
+
+// TenantDeletionTest continuously verifies that the data of a deleted tenant becomes unqueryable within the deletion
+// window. Each cycle writes a marker series to a new disposable tenant, requests the deletion of the tenant, and then
+// queries the marker series on each test run until it's not returned anymore.
+//
+// The state of the current cycle is kept in memory, so a cycle interrupted by a restart of the tool is not verified.
+type TenantDeletionTest struct {
+	name          string
+	cfg           TenantDeletionTestConfig
+	clientFactory TenantClientFactory
+	logger        log.Logger
+	metrics       *TestMetrics
+
+	cycle *tenantDeletionCycle
+
+	sloViolationsTotal prometheus.Counter
+	deletionDuration   prometheus.Histogram
+}
+
+func NewTenantDeletionTest(cfg TenantDeletionTestConfig, clientFactory TenantClientFactory, logger log.Logger, reg prometheus.Registerer) *TenantDeletionTest {
+	const name = "tenant-deletion"
+
+	return &TenantDeletionTest{
+		name:          name,
+		cfg:           cfg,
+		clientFactory: clientFactory,
+		logger:        log.With(logger, "test", name),
+		metrics:       NewTestMetrics(name, reg),
+		sloViolationsTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_tenant_deletion_slo_violations_total",
+			Help:        "Total number of deleted tenants whose data was still queryable after the deletion window.",
+			ConstLabels: map[string]string{"test": name},
+		}),
+		deletionDuration: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:        "mimir_continuous_test_tenant_deletion_duration_seconds",
+			Help:        "Time elapsed from the tenant deletion request until the data of the tenant was found to be unqueryable.",
+			ConstLabels: map[string]string{"test": name},
+			Buckets:     prometheus.ExponentialBuckets(15*60, 2, 8),
+		}),
+	}
+}
+
+// Name implements Test.
+func (t *TenantDeletionTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *TenantDeletionTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *TenantDeletionTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "TenantDeletionTest.Run")
+	defer sp.Finish()
+
+	if t.cycle == nil {
+		tenantID := fmt.Sprintf("%s-%d", t.cfg.TenantPrefix, now.Unix())
+		client, err := t.clientFactory(tenantID)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create the client of the disposable tenant %s", tenantID)
+		}
+		t.cycle = &tenantDeletionCycle{tenantID: tenantID, client: client}
+	}
+
+	logger := log.With(sp, "tenant", t.cycle.tenantID)
+	if t.cycle.deletionRequestedAt.IsZero() {
+		return t.writeAndDelete(ctx, logger, now)
+	}
+	return t.verifyDeleted(ctx, logger, now)
+}
+
+// writeAndDelete writes the marker series to the disposable tenant, checks that it can be queried back, so that
+// its disappearance is meaningful, and then requests the deletion of the tenant. If any step fails, it's retried
+// at the next test run.
+func (t *TenantDeletionTest) writeAndDelete(ctx context.Context, logger log.Logger, now time.Time) error {
+	ts := alignTimestampToInterval(now, writeInterval)
+	logger = log.With(logger, "timestamp", ts.UnixMilli())
+
+	start := time.Now()
+	statusCode, err := t.cycle.client.WriteSeries(ctx, generateTenantDeletionSeries(ts))
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+
+	t.metrics.writesTotal.Inc()
+	if statusCode/100 != 2 {
+		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Failed to write the tenant deletion marker series", "status_code", statusCode, "err", err)
+		return errors.Wrapf(err, "failed to write the marker series of tenant %s with status code %d", t.cycle.tenantID, statusCode)
+	}
+	t.metrics.observeSuccess(outcomeTypeWrite)
+
+	vector, err := t.queryMarker(ctx, logger, ts)
+	if err != nil {
+		return err
+	}
+	if err := t.checkResult(ctx, logger, ts, verifyTenantDeletionMarkerWritten(vector)); err != nil {
+		return err
+	}
+
+	if err := t.cycle.client.DeleteTenant(ctx); err != nil {
+		level.Warn(logger).Log("msg", "Failed to request the tenant deletion", "err", err)
+		return errors.Wrapf(err, "failed to request the deletion of tenant %s", t.cycle.tenantID)
+	}
+
+	t.cycle.writtenAt = ts
+	t.cycle.deletionRequestedAt = now
+	level.Info(logger).Log("msg", "Requested the deletion of the disposable tenant")
+	return nil
+}
+
+// verifyDeleted checks whether the marker series of the deleted tenant is still queryable. The check fails only
+// once the deletion window has elapsed since the deletion request.
+func (t *TenantDeletionTest) verifyDeleted(ctx context.Context, logger log.Logger, now time.Time) error {
+	elapsed := now.Sub(t.cycle.deletionRequestedAt)
+	logger = log.With(logger, "timestamp", t.cycle.writtenAt.UnixMilli(), "elapsed_since_deletion", elapsed)
+
+	vector, err := t.queryMarker(ctx, logger, t.cycle.writtenAt)
+	if err != nil {
+		return err
+	}
+
+	if len(vector) == 0 {
+		t.deletionDuration.Observe(elapsed.Seconds())
+		level.Info(logger).Log("msg", "The data of the deleted tenant is not queryable anymore")
+
+		// The check succeeds even if the deletion window was exceeded, because the violation has already been tracked.
+		err := t.checkResult(ctx, logger, t.cycle.writtenAt, nil)
+		t.cycle = nil
+		return err
+	}
+
+	if elapsed <= t.cfg.DeletionWindow {
+		level.Debug(logger).Log("msg", "The data of the deleted tenant is still queryable, within the deletion window")
+		return nil
+	}
+
+	if !t.cycle.violated {
+		t.cycle.violated = true
+		t.sloViolationsTotal.Inc()
+	}
+	return t.checkResult(ctx, logger, t.cycle.writtenAt, fmt.Errorf("the data of tenant %s is still queryable %s after the deletion request, exceeding the deletion window of %s", t.cycle.tenantID, elapsed, t.cfg.DeletionWindow))
+}
+
+func (t *TenantDeletionTest) queryMarker(ctx context.Context, logger log.Logger, ts time.Time) (model.Vector, error) {
+	t.metrics.queriesTotal.Inc()
+	start := time.Now()
+	vector, err := t.cycle.client.Query(ctx, tenantDeletionMetricName, ts, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute instant query", "query", tenantDeletionMetricName, "err", err)
+		return nil, errors.Wrapf(err, "failed to execute instant query %s in tenant %s", tenantDeletionMetricName, t.cycle.tenantID)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+	return vector, nil
+}
+
+func (t *TenantDeletionTest) checkResult(ctx context.Context, logger log.Logger, ts time.Time, checkErr error) error {
+	t.metrics.queryResultChecksTotal.Inc()
+	if checkErr != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Query result check failed", "query", tenantDeletionMetricName, "err", checkErr)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: tenantDeletionMetricName, Start: ts, End: ts, Error: checkErr.Error()})
+		return errors.Wrapf(checkErr, "query result check failed for query %s in tenant %s", tenantDeletionMetricName, t.cycle.tenantID)
+	}
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+
+	level.Debug(logger).Log("msg", "Query result check succeeded")
+	return nil
+}
+
+// verifyTenantDeletionMarkerWritten returns an error if the input vector doesn't contain the marker series.
+func verifyTenantDeletionMarkerWritten(vector model.Vector) error {
+	if len(vector) != 1 {
+		return fmt.Errorf("expected the marker series to be returned before the tenant deletion, got %d series", len(vector))
+	}
+	if vector[0].Value != 1 {
+		return fmt.Errorf("expected the marker series value 1, got %s", vector[0].Value)
+	}
+	return nil
+}
+
+func generateTenantDeletionSeries(ts time.Time) []prompb.TimeSeries {
+	return []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: model.MetricNameLabel, Value: tenantDeletionMetricName}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: ts.UnixMilli()}},
+	}}
+}
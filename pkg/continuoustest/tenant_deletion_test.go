@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantDeletionTestConfig_Validate(t *testing.T) {
+	cfg := TenantDeletionTestConfig{TenantPrefix: "deletion", DeletionWindow: time.Hour}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TenantPrefix = ""
+	assert.ErrorContains(t, cfg.Validate(), "tenant prefix")
+
+	cfg.TenantPrefix = "deletion"
+	cfg.DeletionWindow = 0
+	assert.ErrorContains(t, cfg.Validate(), "deletion window")
+}
+
+func TestTenantDeletionTest_Run(t *testing.T) {
+	const deletionWindow = time.Hour
+	cfg := TenantDeletionTestConfig{Enabled: true, TenantPrefix: "deletion", DeletionWindow: deletionWindow}
+	start := time.Unix(1000, 0)
+	writtenAt := alignTimestampToInterval(start, writeInterval)
+
+	marker := model.Vector{{Metric: model.Metric{model.MetricNameLabel: tenantDeletionMetricName}, Value: 1, Timestamp: model.TimeFromUnixNano(writtenAt.UnixNano())}}
+
+	// newTest returns the test, and the clients it created by tenant ID.
+	newTest := func(reg prometheus.Registerer, clients map[string]*ClientMock) *TenantDeletionTest {
+		return NewTenantDeletionTest(cfg, func(tenantID string) (TenantDeletionClient, error) {
+			client, ok := clients[tenantID]
+			if !ok {
+				return nil, errors.New("unexpected tenant")
+			}
+			return client, nil
+		}, log.NewNopLogger(), reg)
+	}
+
+	t.Run("should delete the tenant and start a new cycle once the data is not queryable anymore", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, generateTenantDeletionSeries(writtenAt)).Return(200, nil)
+		client.On("DeleteTenant", mock.Anything).Return(nil)
+		client.On("Query", mock.Anything, tenantDeletionMetricName, writtenAt, mock.Anything).Return(marker, nil).Times(2)
+		client.On("Query", mock.Anything, tenantDeletionMetricName, writtenAt, mock.Anything).Return(model.Vector{}, nil).Once()
+
+		reg := prometheus.NewPedanticRegistry()
+		test := newTest(reg, map[string]*ClientMock{"deletion-1000": client})
+
+		// The marker series is written and queried back, and then the tenant deletion is requested.
+		require.NoError(t, test.Run(context.Background(), start))
+		client.AssertNumberOfCalls(t, "WriteSeries", 1)
+		client.AssertNumberOfCalls(t, "DeleteTenant", 1)
+
+		// The data is still queryable, within the deletion window.
+		require.NoError(t, test.Run(context.Background(), start.Add(deletionWindow/2)))
+		require.NotNil(t, test.cycle)
+
+		// The data is not queryable anymore.
+		require.NoError(t, test.Run(context.Background(), start.Add(deletionWindow)))
+		assert.Nil(t, test.cycle)
+		client.AssertNumberOfCalls(t, "WriteSeries", 1)
+		client.AssertNumberOfCalls(t, "DeleteTenant", 1)
+
+		assert.Equal(t, 0.0, testutil.ToFloat64(test.sloViolationsTotal))
+		assert.Equal(t, 1, testutil.CollectAndCount(test.deletionDuration))
+	})
+
+	t.Run("should track a violation once if the data is still queryable after the deletion window", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("DeleteTenant", mock.Anything).Return(nil)
+		client.On("Query", mock.Anything, tenantDeletionMetricName, writtenAt, mock.Anything).Return(marker, nil).Times(3)
+		client.On("Query", mock.Anything, tenantDeletionMetricName, writtenAt, mock.Anything).Return(model.Vector{}, nil).Once()
+
+		test := newTest(prometheus.NewPedanticRegistry(), map[string]*ClientMock{"deletion-1000": client})
+
+		require.NoError(t, test.Run(context.Background(), start))
+
+		err := test.Run(context.Background(), start.Add(deletionWindow+time.Minute))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the data of tenant deletion-1000 is still queryable 1h1m0s after the deletion request")
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.sloViolationsTotal))
+
+		require.Error(t, test.Run(context.Background(), start.Add(deletionWindow+2*time.Minute)))
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.sloViolationsTotal))
+
+		// Once the data is not queryable anymore, the cycle completes.
+		require.NoError(t, test.Run(context.Background(), start.Add(deletionWindow+3*time.Minute)))
+		assert.Nil(t, test.cycle)
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.sloViolationsTotal))
+	})
+
+	t.Run("should not request the tenant deletion if the marker series can't be queried back", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("Query", mock.Anything, tenantDeletionMetricName, writtenAt, mock.Anything).Return(model.Vector{}, nil)
+
+		test := newTest(prometheus.NewPedanticRegistry(), map[string]*ClientMock{"deletion-1000": client})
+
+		err := test.Run(context.Background(), start)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "expected the marker series to be returned before the tenant deletion, got 0 series")
+		client.AssertNotCalled(t, "DeleteTenant", mock.Anything)
+
+		// The same tenant is used at the next test run.
+		require.NotNil(t, test.cycle)
+		assert.Equal(t, "deletion-1000", test.cycle.tenantID)
+		assert.True(t, test.cycle.deletionRequestedAt.IsZero())
+	})
+
+	t.Run("should retry the tenant deletion request at the next test run if it failed", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("Query", mock.Anything, tenantDeletionMetricName, mock.Anything, mock.Anything).Return(marker, nil)
+		client.On("DeleteTenant", mock.Anything).Return(errors.New("failed")).Once()
+		client.On("DeleteTenant", mock.Anything).Return(nil).Once()
+
+		test := newTest(prometheus.NewPedanticRegistry(), map[string]*ClientMock{"deletion-1000": client})
+
+		err := test.Run(context.Background(), start)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to request the deletion of tenant deletion-1000")
+
+		require.NoError(t, test.Run(context.Background(), start.Add(writeInterval)))
+		client.AssertNumberOfCalls(t, "DeleteTenant", 2)
+		assert.Equal(t, start.Add(writeInterval), test.cycle.deletionRequestedAt)
+	})
+}
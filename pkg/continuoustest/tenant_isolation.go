@@ -0,0 +1,293 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	// tenantIsolationMetricPrefix is the prefix of the marker metric written to each tenant. The
+	// marker metric name is suffixed by the tenant ID, so that each tenant has a different metric.
+	tenantIsolationMetricPrefix = "mimir_continuous_test_tenant_marker_"
+	tenantIsolationTenantLabel  = "tenant"
+
+	// tenantIsolationQueryRange is the time range of the range queries run by the tenant isolation test.
+	tenantIsolationQueryRange = 5 * time.Minute
+)
+
+// tenantIsolationQuery selects the marker metrics of all tenants.
+var tenantIsolationQuery = fmt.Sprintf(`{__name__=~"%s.+"}`, tenantIsolationMetricPrefix)
+
+type TenantIsolationTestConfig struct {
+	Enabled bool
+	Tenants flagext.StringSliceCSV
+}
+
+func (cfg *TenantIsolationTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.tenant-isolation-test.enabled", false, "Enable the test which periodically writes a marker series to each of the configured tenants, and checks whether querying each tenant returns only its own marker series, and never the marker series of the other tenants. The tenants are selected with the X-Scope-OrgID header, so the test can't be used with basic or bearer token authentication.")
+	f.Var(&cfg.Tenants, "tests.tenant-isolation-test.tenants", "Comma-separated list of the tenant IDs the marker series are written to. At least two tenants are required.")
+}
+
+func (cfg *TenantIsolationTestConfig) Validate() error {
+	if len(cfg.Tenants) < 2 {
+		return errors.New("at least two tenants must be configured for the tenant isolation test")
+	}
+
+	metrics := map[string]string{}
+	for _, tenantID := range cfg.Tenants {
+		if tenantID == "" {
+			return errors.New("the tenants of the tenant isolation test must not be empty")
+		}
+
+		name := tenantIsolationMetricName(tenantID)
+		if other, ok := metrics[name]; ok {
+			return fmt.Errorf("the tenants %q and %q of the tenant isolation test have the same marker metric name %s", other, tenantID, name)
+		}
+		metrics[name] = tenantID
+	}
+	return nil
+}
+
+// tenantIsolationMetricName returns the name of the marker metric of the input tenant. The characters not
+// allowed in metric names are replaced by underscores.
+func tenantIsolationMetricName(tenantID string) string {
+	return tenantIsolationMetricPrefix + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, tenantID)
+}
+
+// TenantIsolationTest periodically writes a marker series to each of the configured tenants, and queries each
+// tenant for the marker series of all the tenants. A tenant is expected to see only its own marker series, so
+// any other marker series returned is a leakage of data across tenants.
+type TenantIsolationTest struct {
+	name    string
+	cfg     TenantIsolationTestConfig
+	clients map[string]MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	violationsTotal *prometheus.CounterVec
+}
+
+// NewTenantIsolationTest returns the tenant isolation test. The input clients are keyed by the tenant ID
+// they write and read to and from.
+func NewTenantIsolationTest(cfg TenantIsolationTestConfig, clients map[string]MimirClient, logger log.Logger, reg prometheus.Registerer) *TenantIsolationTest {
+	const name = "tenant-isolation"
+
+	t := &TenantIsolationTest{
+		name:    name,
+		cfg:     cfg,
+		clients: clients,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+		violationsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_tenant_isolation_violations_total",
+			Help:        "Total number of queries which returned the marker series of another tenant, by querying tenant.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"tenant"}),
+	}
+
+	// Initialise the metrics so that they're exported even if no violation occurred.
+	for _, tenantID := range cfg.Tenants {
+		t.violationsTotal.WithLabelValues(tenantID)
+	}
+
+	return t
+}
+
+// Name implements Test.
+func (t *TenantIsolationTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *TenantIsolationTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *TenantIsolationTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "TenantIsolationTest.Run")
+	defer sp.Finish()
+
+	ts := alignTimestampToInterval(now, writeInterval)
+
+	// The queries are run only once all the marker series have been written, otherwise a
+	// missing marker series couldn't be told apart from a failed write.
+	errs := multierror.New()
+	for _, tenantID := range t.cfg.Tenants {
+		errs.Add(t.writeMarker(ctx, sp, tenantID, ts))
+	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	for _, tenantID := range t.cfg.Tenants {
+		errs.Add(t.runInstantQueryAndVerifyResult(ctx, sp, tenantID, ts))
+		errs.Add(t.runRangeQueryAndVerifyResult(ctx, sp, tenantID, ts.Add(-tenantIsolationQueryRange), ts))
+	}
+	return errs.Err()
+}
+
+func (t *TenantIsolationTest) writeMarker(ctx context.Context, logger log.Logger, tenantID string, ts time.Time) error {
+	logger = log.With(logger, "tenant", tenantID, "timestamp", ts.UnixMilli())
+
+	start := time.Now()
+	statusCode, err := t.clients[tenantID].WriteSeries(ctx, generateTenantIsolationSeries(tenantID, ts))
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+
+	t.metrics.writesTotal.Inc()
+	if statusCode/100 != 2 {
+		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Failed to write the tenant marker series", "status_code", statusCode, "err", err)
+		return errors.Wrapf(err, "failed to write the marker series of tenant %s with status code %d", tenantID, statusCode)
+	}
+
+	t.metrics.observeSuccess(outcomeTypeWrite)
+	return nil
+}
+
+// runInstantQueryAndVerifyResult checks whether the instant query of the marker series, run in the input tenant,
+// returns only the tenant's own marker series.
+func (t *TenantIsolationTest) runInstantQueryAndVerifyResult(ctx context.Context, logger log.Logger, tenantID string, ts time.Time) error {
+	logger = log.With(logger, "tenant", tenantID, "query", tenantIsolationQuery, "ts", ts.UnixMilli())
+
+	t.metrics.queriesTotal.Inc()
+	start := time.Now()
+	vector, err := t.clients[tenantID].Query(ctx, tenantIsolationQuery, ts, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute instant query", "err", err)
+		return errors.Wrapf(err, "failed to execute instant query %s in tenant %s", tenantIsolationQuery, tenantID)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	metrics := make([]model.Metric, 0, len(vector))
+	for _, s := range vector {
+		metrics = append(metrics, s.Metric)
+	}
+	if err := t.checkLeakage(ctx, logger, tenantID, metrics, ts, ts); err != nil {
+		return err
+	}
+
+	// The tenant's own marker series has just been written, so it's expected to be returned.
+	return t.checkResult(ctx, logger, tenantID, ts, ts, verifyTenantIsolationOwnMarker(tenantID, metrics))
+}
+
+// runRangeQueryAndVerifyResult checks whether the range query of the marker series, run in the input tenant with
+// the results cache enabled, doesn't return the marker series of the other tenants. The tenant's own marker series
+// isn't required, because the samples in the queried time range may have not been written yet.
+func (t *TenantIsolationTest) runRangeQueryAndVerifyResult(ctx context.Context, logger log.Logger, tenantID string, start, end time.Time) error {
+	logger = log.With(logger, "tenant", tenantID, "query", tenantIsolationQuery, "start", start.UnixMilli(), "end", end.UnixMilli())
+
+	t.metrics.queriesTotal.Inc()
+	queryStart := time.Now()
+	matrix, err := t.clients[tenantID].QueryRange(ctx, tenantIsolationQuery, start, end, writeInterval, WithResultsCacheEnabled(true))
+	t.metrics.observeQueryDuration(queryTypeRange, true, queryStart)
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		level.Warn(logger).Log("msg", "Failed to execute range query", "err", err)
+		return errors.Wrapf(err, "failed to execute range query %s in tenant %s", tenantIsolationQuery, tenantID)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	metrics := make([]model.Metric, 0, len(matrix))
+	for _, s := range matrix {
+		metrics = append(metrics, s.Metric)
+	}
+	return t.checkLeakage(ctx, logger, tenantID, metrics, start, end)
+}
+
+// checkLeakage checks whether the input series, returned by a query run in the input tenant, include the
+// marker series of other tenants.
+func (t *TenantIsolationTest) checkLeakage(ctx context.Context, logger log.Logger, tenantID string, metrics []model.Metric, start, end time.Time) error {
+	err := verifyTenantIsolationNoLeakage(tenantID, metrics)
+	if err == nil {
+		return nil
+	}
+
+	t.violationsTotal.WithLabelValues(tenantID).Inc()
+	return t.checkResult(ctx, logger, tenantID, start, end, err)
+}
+
+func (t *TenantIsolationTest) checkResult(ctx context.Context, logger log.Logger, tenantID string, start, end time.Time, checkErr error) error {
+	t.metrics.queryResultChecksTotal.Inc()
+	if checkErr != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		level.Warn(logger).Log("msg", "Query result check failed", "err", checkErr)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: tenantIsolationQuery, Start: start, End: end, Error: checkErr.Error()})
+		return errors.Wrapf(checkErr, "query result check failed for query %s in tenant %s", tenantIsolationQuery, tenantID)
+	}
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+
+	level.Debug(logger).Log("msg", "Query result check succeeded")
+	return nil
+}
+
+// verifyTenantIsolationNoLeakage returns an error if any of the input series is not a marker series of the
+// input tenant.
+func verifyTenantIsolationNoLeakage(tenantID string, metrics []model.Metric) error {
+	ownName := tenantIsolationMetricName(tenantID)
+
+	var leaked []string
+	for _, m := range metrics {
+		if string(m[model.MetricNameLabel]) != ownName || string(m[tenantIsolationTenantLabel]) != tenantID {
+			leaked = append(leaked, m.String())
+		}
+	}
+	if len(leaked) > 0 {
+		return fmt.Errorf("cross-tenant leakage: the query in tenant %s returned the marker series of other tenants: %s", tenantID, strings.Join(leaked, ", "))
+	}
+	return nil
+}
+
+// verifyTenantIsolationOwnMarker returns an error if the marker series of the input tenant is not in the
+// input series.
+func verifyTenantIsolationOwnMarker(tenantID string, metrics []model.Metric) error {
+	ownName := tenantIsolationMetricName(tenantID)
+
+	for _, m := range metrics {
+		if string(m[model.MetricNameLabel]) == ownName {
+			return nil
+		}
+	}
+	return fmt.Errorf("the marker series %s of tenant %s has not been returned", ownName, tenantID)
+}
+
+func generateTenantIsolationSeries(tenantID string, ts time.Time) []prompb.TimeSeries {
+	return []prompb.TimeSeries{{
+		Labels: []prompb.Label{
+			{Name: model.MetricNameLabel, Value: tenantIsolationMetricName(tenantID)},
+			{Name: tenantIsolationTenantLabel, Value: tenantID},
+		},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: ts.UnixMilli()}},
+	}}
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantIsolationTestConfig_Validate(t *testing.T) {
+	cfg := TenantIsolationTestConfig{Tenants: []string{"tenant-a", "tenant-b"}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tenants = []string{"tenant-a"}
+	assert.ErrorContains(t, cfg.Validate(), "at least two tenants")
+
+	cfg.Tenants = []string{"tenant-a", ""}
+	assert.ErrorContains(t, cfg.Validate(), "must not be empty")
+
+	cfg.Tenants = []string{"tenant-a", "tenant_a"}
+	assert.ErrorContains(t, cfg.Validate(), "same marker metric name")
+}
+
+func TestTenantIsolationMetricName(t *testing.T) {
+	assert.Equal(t, "mimir_continuous_test_tenant_marker_tenant_1", tenantIsolationMetricName("tenant-1"))
+	assert.Equal(t, "mimir_continuous_test_tenant_marker_team_a_prod", tenantIsolationMetricName("team.a|prod"))
+}
+
+func TestTenantIsolationTest_Run(t *testing.T) {
+	tenants := []string{"tenant-a", "tenant-b"}
+	now := time.Unix(1000, 0)
+	end := alignTimestampToInterval(now, writeInterval)
+	start := end.Add(-tenantIsolationQueryRange)
+
+	marker := func(tenantID string) model.Metric {
+		return model.Metric{model.MetricNameLabel: model.LabelValue(tenantIsolationMetricName(tenantID)), tenantIsolationTenantLabel: model.LabelValue(tenantID)}
+	}
+
+	// newClients returns a client for each tenant, whose queries return the input marker series.
+	newClients := func(returned map[string][]model.Metric) map[string]*ClientMock {
+		clients := map[string]*ClientMock{}
+		for _, tenantID := range tenants {
+			var (
+				vector = model.Vector{}
+				matrix = model.Matrix{}
+			)
+			for _, m := range returned[tenantID] {
+				vector = append(vector, &model.Sample{Metric: m, Value: 1, Timestamp: model.TimeFromUnixNano(end.UnixNano())})
+				matrix = append(matrix, &model.SampleStream{Metric: m, Values: []model.SamplePair{{Timestamp: model.TimeFromUnixNano(end.UnixNano()), Value: 1}}})
+			}
+
+			client := &ClientMock{}
+			client.On("WriteSeries", mock.Anything, generateTenantIsolationSeries(tenantID, end)).Return(200, nil)
+			client.On("Query", mock.Anything, tenantIsolationQuery, end, mock.Anything).Return(vector, nil)
+			client.On("QueryRange", mock.Anything, tenantIsolationQuery, start, end, writeInterval, mock.Anything).Return(matrix, nil)
+			clients[tenantID] = client
+		}
+		return clients
+	}
+
+	newTest := func(clients map[string]*ClientMock, reg prometheus.Registerer) *TenantIsolationTest {
+		mimirClients := map[string]MimirClient{}
+		for tenantID, client := range clients {
+			mimirClients[tenantID] = client
+		}
+		return NewTenantIsolationTest(TenantIsolationTestConfig{Enabled: true, Tenants: tenants}, mimirClients, log.NewNopLogger(), reg)
+	}
+
+	t.Run("should succeed if each tenant sees only its own marker series", func(t *testing.T) {
+		clients := newClients(map[string][]model.Metric{
+			"tenant-a": {marker("tenant-a")},
+			"tenant-b": {marker("tenant-b")},
+		})
+		test := newTest(clients, prometheus.NewPedanticRegistry())
+
+		require.NoError(t, test.Run(context.Background(), now))
+		for _, client := range clients {
+			client.AssertNumberOfCalls(t, "WriteSeries", 1)
+			client.AssertNumberOfCalls(t, "Query", 1)
+			client.AssertNumberOfCalls(t, "QueryRange", 1)
+		}
+		for _, tenantID := range tenants {
+			assert.Equal(t, 0.0, testutil.ToFloat64(test.violationsTotal.WithLabelValues(tenantID)))
+		}
+	})
+
+	t.Run("should fail if a tenant sees the marker series of another tenant", func(t *testing.T) {
+		clients := newClients(map[string][]model.Metric{
+			"tenant-a": {marker("tenant-a")},
+			"tenant-b": {marker("tenant-a"), marker("tenant-b")},
+		})
+		test := newTest(clients, prometheus.NewPedanticRegistry())
+
+		err := test.Run(context.Background(), now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "cross-tenant leakage: the query in tenant tenant-b returned the marker series of other tenants")
+
+		// The leakage is detected by both the instant and range queries.
+		assert.Equal(t, 0.0, testutil.ToFloat64(test.violationsTotal.WithLabelValues("tenant-a")))
+		assert.Equal(t, 2.0, testutil.ToFloat64(test.violationsTotal.WithLabelValues("tenant-b")))
+	})
+
+	t.Run("should fail if a tenant doesn't see its own marker series", func(t *testing.T) {
+		clients := newClients(map[string][]model.Metric{
+			"tenant-a": {marker("tenant-a")},
+		})
+		test := newTest(clients, prometheus.NewPedanticRegistry())
+
+		err := test.Run(context.Background(), now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the marker series mimir_continuous_test_tenant_marker_tenant_b of tenant tenant-b has not been returned")
+		assert.Equal(t, 0.0, testutil.ToFloat64(test.violationsTotal.WithLabelValues("tenant-b")))
+	})
+
+	t.Run("should not run the queries if a write failed", func(t *testing.T) {
+		clients := map[string]*ClientMock{"tenant-a": {}, "tenant-b": {}}
+		clients["tenant-a"].On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		clients["tenant-b"].On("WriteSeries", mock.Anything, mock.Anything).Return(500, errors.New("failed"))
+		test := newTest(clients, prometheus.NewPedanticRegistry())
+
+		err := test.Run(context.Background(), now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to write the marker series of tenant tenant-b")
+		for _, client := range clients {
+			client.AssertNumberOfCalls(t, "Query", 0)
+			client.AssertNumberOfCalls(t, "QueryRange", 0)
+		}
+	})
+}
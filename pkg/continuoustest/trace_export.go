@@ -0,0 +1,279 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/flagext"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/uber/jaeger-client-go"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+)
+
+const (
+	// traceExportPath is the path of the OTLP/HTTP traces receiver, relative to the configured endpoint.
+	traceExportPath = "/v1/traces"
+
+	traceServiceName = "mimir-continuous-test"
+	traceScopeName   = "github.com/grafana/mimir/pkg/continuoustest"
+)
+
+type TraceExportConfig struct {
+	Endpoint flagext.URLValue
+	Timeout  time.Duration
+}
+
+func (cfg *TraceExportConfig) RegisterFlags(f *flag.FlagSet) {
+	f.Var(&cfg.Endpoint, "tests.trace-export.endpoint", "The base endpoint of an OTLP/HTTP traces receiver, such as Grafana Tempo or the OpenTelemetry Collector. When set, one trace is exported for each test run, with a child span for each write request and each verification query. The traces are sent to the "+traceExportPath+" path of the endpoint.")
+	f.DurationVar(&cfg.Timeout, "tests.trace-export.timeout", 10*time.Second, "The timeout for exporting the trace of a test run.")
+}
+
+func (cfg *TraceExportConfig) Validate() error {
+	if cfg.Endpoint.URL == nil {
+		return nil
+	}
+	if cfg.Endpoint.Scheme == "" || cfg.Endpoint.Host == "" {
+		return errors.New("the trace export endpoint must be an absolute URL")
+	}
+	if cfg.Timeout <= 0 {
+		return errors.New("the trace export timeout must be greater than 0")
+	}
+	return nil
+}
+
+// TraceExporter exports the traces of test runs to an OTLP/HTTP traces receiver. It's a jaeger.Reporter
+// collecting the spans of the tracked test runs, which are exported together as one trace once the root
+// span of the run is finished. The spans of the traces which are not tracked are ignored.
+type TraceExporter struct {
+	cfg    TraceExportConfig
+	client *http.Client
+	logger log.Logger
+
+	// Protects the runs, whose spans may be finished concurrently.
+	mtx  sync.Mutex
+	runs map[jaeger.TraceID]*trackedRun
+
+	exportsTotal *prometheus.CounterVec
+}
+
+// trackedRun collects the finished spans of a test run trace.
+type trackedRun struct {
+	rootSpanID jaeger.SpanID
+	traces     ptrace.Traces
+	spans      ptrace.SpanSlice
+}
+
+func NewTraceExporter(cfg TraceExportConfig, logger log.Logger, reg prometheus.Registerer) *TraceExporter {
+	return &TraceExporter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		logger: logger,
+		runs:   map[jaeger.TraceID]*trackedRun{},
+		exportsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "mimir_continuous_test_trace_exports_total",
+			Help: "Total number of test run traces exported to the OTLP traces receiver, partitioned by outcome.",
+		}, []string{"outcome"}),
+	}
+}
+
+// InstallTracer installs the global tracer, configured from the JAEGER_* environment variables like the
+// tracer of the other Mimir components, with the exporter reporting the spans along with the configured
+// Jaeger agent or collector, if any. All test runs are sampled, unless a sampler is configured.
+func (e *TraceExporter) InstallTracer(serviceName string) (io.Closer, error) {
+	cfg, err := jaegercfg.FromEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load jaeger tracer configuration")
+	}
+	if cfg.Sampler.Type == "" {
+		cfg.Sampler.Type = jaeger.SamplerTypeConst
+		cfg.Sampler.Param = 1
+	}
+
+	var reporter jaeger.Reporter = e
+	if cfg.Reporter.LocalAgentHostPort != "" || cfg.Reporter.CollectorEndpoint != "" {
+		remote, err := cfg.Reporter.NewReporter(serviceName, jaeger.NewNullMetrics(), jaeger.NullLogger)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create jaeger reporter")
+		}
+		reporter = jaeger.NewCompositeReporter(remote, e)
+	}
+
+	return cfg.InitGlobalTracer(serviceName, jaegercfg.Reporter(reporter))
+}
+
+// track starts collecting the spans of the trace whose root span is the input span, which is expected to be
+// the span of a test run. The trace is exported once the root span is finished.
+func (e *TraceExporter) track(span opentracing.Span) {
+	sctx, ok := span.Context().(jaeger.SpanContext)
+	if !ok || !sctx.IsSampled() {
+		return
+	}
+
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", traceServiceName)
+	ss := rs.ScopeSpans().AppendEmpty()
+	ss.Scope().SetName(traceScopeName)
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.runs[sctx.TraceID()] = &trackedRun{rootSpanID: sctx.SpanID(), traces: traces, spans: ss.Spans()}
+}
+
+// Report implements jaeger.Reporter.
+func (e *TraceExporter) Report(span *jaeger.Span) {
+	sctx := span.SpanContext()
+
+	e.mtx.Lock()
+	run, ok := e.runs[sctx.TraceID()]
+	if !ok {
+		e.mtx.Unlock()
+		return
+	}
+	convertSpan(span, run.spans.AppendEmpty())
+
+	finished := sctx.SpanID() == run.rootSpanID
+	if finished {
+		delete(e.runs, sctx.TraceID())
+	}
+	e.mtx.Unlock()
+
+	if finished {
+		e.export(context.Background(), sctx.TraceID(), run)
+	}
+}
+
+// Close implements jaeger.Reporter.
+func (e *TraceExporter) Close() {}
+
+// export exports the spans of a finished test run. Failures are logged and tracked, but don't fail the test run.
+func (e *TraceExporter) export(ctx context.Context, traceID jaeger.TraceID, run *trackedRun) {
+	payload, err := ptraceotlp.NewExportRequestFromTraces(run.traces).MarshalProto()
+	if err == nil {
+		err = e.post(ctx, payload)
+	}
+
+	if err != nil {
+		e.exportsTotal.WithLabelValues(uploadOutcomeFailed).Inc()
+		level.Warn(e.logger).Log("msg", "Failed to export test run trace", "trace_id", traceID.String(), "err", err)
+		return
+	}
+	e.exportsTotal.WithLabelValues(uploadOutcomeSuccess).Inc()
+	level.Debug(e.logger).Log("msg", "Exported test run trace", "trace_id", traceID.String())
+}
+
+func (e *TraceExporter) post(ctx context.Context, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(e.cfg.Endpoint.String(), "/")+traceExportPath, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrMsgLen))
+		return fmt.Errorf("the traces receiver responded with status code %d: %s", res.StatusCode, body)
+	}
+	return nil
+}
+
+// convertSpan copies the input finished span to the OTLP span. The span status is set from the error tag,
+// and the span logs are copied as events.
+func convertSpan(span *jaeger.Span, dst ptrace.Span) {
+	sctx := span.SpanContext()
+	dst.SetTraceID(convertTraceID(sctx.TraceID()))
+	dst.SetSpanID(convertSpanID(sctx.SpanID()))
+	if sctx.ParentID() != 0 {
+		dst.SetParentSpanID(convertSpanID(sctx.ParentID()))
+	}
+	dst.SetName(span.OperationName())
+	dst.SetKind(ptrace.SpanKindInternal)
+	dst.SetStartTimestamp(pcommon.NewTimestampFromTime(span.StartTime()))
+	dst.SetEndTimestamp(pcommon.NewTimestampFromTime(span.StartTime().Add(span.Duration())))
+
+	failed := false
+	for key, value := range span.Tags() {
+		if key == string(ext.Error) {
+			failed, _ = value.(bool)
+			continue
+		}
+		putAttribute(dst.Attributes(), key, value)
+	}
+
+	dst.Status().SetCode(ptrace.StatusCodeOk)
+	for _, record := range span.Logs() {
+		event := dst.Events().AppendEmpty()
+		event.SetName("log")
+		event.SetTimestamp(pcommon.NewTimestampFromTime(record.Timestamp))
+
+		for _, field := range record.Fields {
+			putAttribute(event.Attributes(), field.Key(), field.Value())
+			if failed && field.Key() == "error.object" {
+				dst.Status().SetMessage(fmt.Sprint(field.Value()))
+			}
+		}
+	}
+	if failed {
+		dst.Status().SetCode(ptrace.StatusCodeError)
+	}
+}
+
+// putAttribute sets an attribute of an OTLP span or event. Values of unsupported types are formatted as strings.
+func putAttribute(attrs pcommon.Map, key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		attrs.PutStr(key, v)
+	case bool:
+		attrs.PutBool(key, v)
+	case int:
+		attrs.PutInt(key, int64(v))
+	case int64:
+		attrs.PutInt(key, v)
+	case float64:
+		attrs.PutDouble(key, v)
+	case time.Time:
+		attrs.PutStr(key, v.UTC().Format(time.RFC3339Nano))
+	default:
+		attrs.PutStr(key, fmt.Sprint(v))
+	}
+}
+
+func convertTraceID(id jaeger.TraceID) pcommon.TraceID {
+	var converted pcommon.TraceID
+	binary.BigEndian.PutUint64(converted[:8], id.High)
+	binary.BigEndian.PutUint64(converted[8:], id.Low)
+	return converted
+}
+
+func convertSpanID(id jaeger.SpanID) pcommon.SpanID {
+	var converted pcommon.SpanID
+	binary.BigEndian.PutUint64(converted[:], uint64(id))
+	return converted
+}
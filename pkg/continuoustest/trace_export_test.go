@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+func TestTraceExportConfig_Validate(t *testing.T) {
+	cfg := TraceExportConfig{Timeout: time.Second}
+	assert.NoError(t, cfg.Validate())
+
+	require.NoError(t, cfg.Endpoint.Set("tempo:4318"))
+	assert.ErrorContains(t, cfg.Validate(), "must be an absolute URL")
+
+	require.NoError(t, cfg.Endpoint.Set("http://tempo:4318"))
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Timeout = 0
+	assert.ErrorContains(t, cfg.Validate(), "timeout must be greater than 0")
+}
+
+// installTestTracer sets the global tracer to a tracer sampling all the spans and reporting them to the input reporter.
+func installTestTracer(t *testing.T, reporter jaeger.Reporter) {
+	tracer, closer := jaeger.NewTracer(traceServiceName, jaeger.NewConstSampler(true), reporter)
+	previous := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+
+	t.Cleanup(func() {
+		opentracing.SetGlobalTracer(previous)
+		_ = closer.Close()
+	})
+}
+
+func TestManager_TraceExport(t *testing.T) {
+	now := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	var (
+		requestPath string
+		received    ptraceotlp.ExportRequest
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestPath = r.URL.Path
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		received = ptraceotlp.NewExportRequest()
+		require.NoError(t, received.UnmarshalProto(body))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := TraceExportConfig{Timeout: time.Second}
+	require.NoError(t, cfg.Endpoint.Set(server.URL+"/"))
+	reg := prometheus.NewPedanticRegistry()
+
+	exporter := NewTraceExporter(cfg, log.NewNopLogger(), reg)
+	installTestTracer(t, exporter)
+
+	manager := NewManager(ManagerConfig{}, log.NewNopLogger())
+	manager.SetTraceExporter(exporter)
+
+	test := &testFunc{run: func(ctx context.Context, now time.Time) error {
+		write, _ := spanlogger.NewWithLogger(ctx, log.NewNopLogger(), "write")
+		write.SetTag("batch_series", 10)
+		write.Finish()
+
+		query, _ := spanlogger.NewWithLogger(ctx, log.NewNopLogger(), "query")
+		query.SetTag("query", "sum(metric)")
+		query.SetTag("expected_value", 1.0)
+		query.SetTag("actual_value", 2.0)
+		_ = query.Error(errors.New("sample mismatch"))
+		query.Finish()
+
+		return errors.New("sample mismatch")
+	}}
+
+	require.EqualError(t, manager.runTest(context.Background(), test, now), "sample mismatch")
+	assert.Equal(t, traceExportPath, requestPath)
+
+	traces := received.Traces()
+	require.Equal(t, 1, traces.ResourceSpans().Len())
+	serviceName, ok := traces.ResourceSpans().At(0).Resource().Attributes().Get("service.name")
+	require.True(t, ok)
+	assert.Equal(t, traceServiceName, serviceName.Str())
+
+	// The spans are exported in the order they're finished, and the root span is the last one.
+	spans := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans()
+	require.Equal(t, 3, spans.Len())
+	write, query, root := spans.At(0), spans.At(1), spans.At(2)
+
+	// All spans belong to the same trace, and are children of the root span.
+	assert.Equal(t, "dummyTest.Run", root.Name())
+	assert.True(t, root.ParentSpanID().IsEmpty())
+	assert.Equal(t, ptrace.StatusCodeError, root.Status().Code())
+	assert.Equal(t, "sample mismatch", root.Status().Message())
+	assert.Subset(t, root.Attributes().AsRaw(), map[string]interface{}{"test": "dummyTest", "maintenance": false})
+
+	for _, span := range []ptrace.Span{write, query} {
+		assert.Equal(t, root.TraceID(), span.TraceID())
+		assert.Equal(t, root.SpanID(), span.ParentSpanID())
+	}
+
+	assert.Equal(t, "write", write.Name())
+	assert.Equal(t, ptrace.StatusCodeOk, write.Status().Code())
+	assert.Equal(t, map[string]interface{}{"batch_series": int64(10)}, write.Attributes().AsRaw())
+
+	assert.Equal(t, "query", query.Name())
+	assert.Equal(t, ptrace.StatusCodeError, query.Status().Code())
+	assert.Equal(t, "sample mismatch", query.Status().Message())
+	assert.Equal(t, map[string]interface{}{"query": "sum(metric)", "expected_value": 1.0, "actual_value": 2.0}, query.Attributes().AsRaw())
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP mimir_continuous_test_trace_exports_total Total number of test run traces exported to the OTLP traces receiver, partitioned by outcome.
+		# TYPE mimir_continuous_test_trace_exports_total counter
+		mimir_continuous_test_trace_exports_total{outcome="success"} 1
+	`), "mimir_continuous_test_trace_exports_total"))
+}
+
+func TestManager_TraceExport_ShouldNotFailTestRunIfExportFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := TraceExportConfig{Timeout: time.Second}
+	require.NoError(t, cfg.Endpoint.Set(server.URL))
+	reg := prometheus.NewPedanticRegistry()
+
+	exporter := NewTraceExporter(cfg, log.NewNopLogger(), reg)
+	installTestTracer(t, exporter)
+
+	manager := NewManager(ManagerConfig{}, log.NewNopLogger())
+	manager.SetTraceExporter(exporter)
+
+	test := &testFunc{run: func(context.Context, time.Time) error { return nil }}
+	require.NoError(t, manager.runTest(context.Background(), test, time.Now()))
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP mimir_continuous_test_trace_exports_total Total number of test run traces exported to the OTLP traces receiver, partitioned by outcome.
+		# TYPE mimir_continuous_test_trace_exports_total counter
+		mimir_continuous_test_trace_exports_total{outcome="failed"} 1
+	`), "mimir_continuous_test_trace_exports_total"))
+}
+
+func TestTraceExporter_ShouldIgnoreUntrackedTraces(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	exporter := NewTraceExporter(TraceExportConfig{Timeout: time.Second}, log.NewNopLogger(), reg)
+	installTestTracer(t, exporter)
+
+	sp, ctx := spanlogger.NewWithLogger(context.Background(), log.NewNopLogger(), "untracked")
+	child, _ := spanlogger.NewWithLogger(ctx, log.NewNopLogger(), "child")
+	child.Finish()
+	sp.Finish()
+
+	assert.Empty(t, exporter.runs)
+	assert.Equal(t, 0, testutil.CollectAndCount(reg, "mimir_continuous_test_trace_exports_total"))
+}
@@ -6,21 +6,41 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/globalerror"
 )
 
 const (
 	maxComparisonDelta = 0.001
+
+	// mimirErrorIDPrefix is the prefix of the error IDs returned by Mimir.
+	mimirErrorIDPrefix = "err-mimir-"
 )
 
+// isWriteRejectedWithErrorID returns whether the write request has been rejected with the input status code
+// and the error message contains the input error ID.
+func isWriteRejectedWithErrorID(statusCode int, err error, expectedStatusCode int, expectedErrID globalerror.ID) bool {
+	return statusCode == expectedStatusCode && err != nil && strings.Contains(err.Error(), mimirErrorIDPrefix+string(expectedErrID))
+}
+
 func alignTimestampToInterval(ts time.Time, interval time.Duration) time.Time {
 	return ts.Truncate(interval)
 }
 
+// alignTimestampToStep returns the last timestamp at or before the input one which is a multiple of the step
+// since the Unix epoch, which is how the query-frontend aligns the start and end of range queries to the step.
+func alignTimestampToStep(ts time.Time, step time.Duration) time.Time {
+	stepMillis := step.Milliseconds()
+	return time.UnixMilli((ts.UnixMilli() / stepMillis) * stepMillis)
+}
+
 // getQueryStep returns the query step to use to run a test query. The returned step
 // is a guaranteed to be a multiple of alignInterval.
 func getQueryStep(start, end time.Time, alignInterval time.Duration) time.Duration {
@@ -41,8 +61,18 @@ func getQueryStep(start, end time.Time, alignInterval time.Duration) time.Durati
 }
 
 func generateSineWaveSeries(name string, t time.Time, numSeries int) []prompb.TimeSeries {
+	return generateWaveSeriesWithChurn(name, t, numSeries, generateSineWaveValue, 0, 0)
+}
+
+// generateWaveSeriesWithChurn returns numSeries series whose value at the input timestamp is given by the input
+// waveform. The series_id of a fraction of the series is rotated every churnInterval, so that old series stop
+// receiving samples and new series are created in their place. The series_id values are a function of the
+// timestamp, so the number of series written at each timestamp is always numSeries. Churn is disabled if
+// churnInterval is 0.
+func generateWaveSeriesWithChurn(name string, t time.Time, numSeries int, wave waveform, churnInterval time.Duration, churnFraction float64) []prompb.TimeSeries {
 	out := make([]prompb.TimeSeries, 0, numSeries)
-	value := generateSineWaveValue(t)
+	value := wave(t)
+	seriesIDs := newChurnedSeriesIDs(t, numSeries, churnInterval, churnFraction)
 
 	for i := 0; i < numSeries; i++ {
 		out = append(out, prompb.TimeSeries{
@@ -51,7 +81,7 @@ func generateSineWaveSeries(name string, t time.Time, numSeries int) []prompb.Ti
 				Value: name,
 			}, {
 				Name:  "series_id",
-				Value: strconv.Itoa(i),
+				Value: strconv.Itoa(seriesIDs.seriesID(i)),
 			}},
 			Samples: []prompb.Sample{{
 				Value:     value,
@@ -63,6 +93,86 @@ func generateSineWaveSeries(name string, t time.Time, numSeries int) []prompb.Ti
 	return out
 }
 
+// churnedSeriesIDs maps the index of each series written at a timestamp to its series_id label value.
+// The last numChurningSeries series get a new series_id every churn interval.
+type churnedSeriesIDs struct {
+	numSeries         int
+	numChurningSeries int
+	churnOffset       int
+}
+
+func newChurnedSeriesIDs(t time.Time, numSeries int, churnInterval time.Duration, churnFraction float64) churnedSeriesIDs {
+	ids := churnedSeriesIDs{numSeries: numSeries}
+	if churnInterval > 0 {
+		ids.numChurningSeries = int(math.Round(float64(numSeries) * churnFraction))
+		ids.churnOffset = int(t.UnixMilli()/churnInterval.Milliseconds()) * ids.numChurningSeries
+	}
+	return ids
+}
+
+// seriesID returns the series_id of the series with the input index.
+func (ids churnedSeriesIDs) seriesID(i int) int {
+	if i >= ids.numSeries-ids.numChurningSeries {
+		return i + ids.churnOffset
+	}
+	return i
+}
+
+// splitSeriesIntoBatches splits the input series into batches of at most batchSize series each.
+// All the series are returned in a single batch if batchSize is 0.
+func splitSeriesIntoBatches(series []prompb.TimeSeries, batchSize int) [][]prompb.TimeSeries {
+	if batchSize <= 0 || len(series) <= batchSize {
+		return [][]prompb.TimeSeries{series}
+	}
+
+	batches := make([][]prompb.TimeSeries, 0, (len(series)+batchSize-1)/batchSize)
+	for len(series) > batchSize {
+		batches = append(batches, series[:batchSize])
+		series = series[batchSize:]
+	}
+	return append(batches, series)
+}
+
+// addExtraLabels adds numLabels labels to each input series, with values of approximately valueSize bytes.
+// Label values are a function of the series_id label value, so that each series keeps the same labels
+// across writes.
+func addExtraLabels(series []prompb.TimeSeries, numLabels, valueSize int) {
+	if numLabels <= 0 {
+		return
+	}
+
+	for i := range series {
+		seriesID := ""
+		for _, l := range series[i].Labels {
+			if l.Name == "series_id" {
+				seriesID = l.Value
+				break
+			}
+		}
+
+		for n := 0; n < numLabels; n++ {
+			series[i].Labels = append(series[i].Labels, prompb.Label{
+				Name:  fmt.Sprintf("label_%02d", n),
+				Value: generateLabelValue(fmt.Sprintf("%s_%d_", seriesID, n), valueSize),
+			})
+		}
+
+		// Labels must be sorted by name in the write request.
+		sort.Slice(series[i].Labels, func(a, b int) bool {
+			return series[i].Labels[a].Name < series[i].Labels[b].Name
+		})
+	}
+}
+
+// generateLabelValue returns the input prefix, padded to size bytes. The prefix is returned as is
+// if it's already longer than size.
+func generateLabelValue(prefix string, size int) string {
+	if len(prefix) >= size {
+		return prefix
+	}
+	return prefix + strings.Repeat("x", size-len(prefix))
+}
+
 func generateSineWaveValue(t time.Time) float64 {
 	period := 10 * time.Minute
 	radians := 2 * math.Pi * float64(t.UnixNano()) / float64(period.Nanoseconds())
@@ -74,6 +184,17 @@ func generateSineWaveValue(t time.Time) float64 {
 // Samples are checked in backward order, from newest to oldest. Returns error if values don't match,
 // and the index of the last sample that matched the expectation or -1 if no sample matches.
 func verifySineWaveSamplesSum(matrix model.Matrix, expectedSeries int, expectedStep time.Duration) (lastMatchingIdx int, err error) {
+	return verifyWaveSamplesSum(matrix, generateSineWaveValue, expectedSeries, expectedStep)
+}
+
+// verifyWaveSamplesSum is like verifySineWaveSamplesSum, but the summed series follow the input waveform.
+func verifyWaveSamplesSum(matrix model.Matrix, wave waveform, expectedSeries int, expectedStep time.Duration) (lastMatchingIdx int, err error) {
+	return verifyWaveSamplesSumWithGaps(matrix, wave, expectedSeries, expectedStep, nil)
+}
+
+// verifyWaveSamplesSumWithGaps is like verifyWaveSamplesSum, but samples are expected to be missing
+// at the timestamps for which isGap returns true, and only there. If isGap is nil, no gaps are expected.
+func verifyWaveSamplesSumWithGaps(matrix model.Matrix, wave waveform, expectedSeries int, expectedStep time.Duration, isGap func(time.Time) bool) (lastMatchingIdx int, err error) {
 	lastMatchingIdx = -1
 	if len(matrix) != 1 {
 		return lastMatchingIdx, fmt.Errorf("expected 1 series in the result but got %d", len(matrix))
@@ -85,16 +206,24 @@ func verifySineWaveSamplesSum(matrix model.Matrix, expectedSeries int, expectedS
 		sample := samples[idx]
 		ts := time.UnixMilli(int64(sample.Timestamp)).UTC()
 
+		// Assert on gaps. No sample is expected where the write has been deliberately skipped.
+		if isGap != nil && isGap(ts) {
+			return lastMatchingIdx, fmt.Errorf("sample at timestamp %d (%s) has been returned while no sample was written at that timestamp because of gap injection", sample.Timestamp, ts.String())
+		}
+
 		// Assert on value.
-		expectedValue := generateSineWaveValue(ts) * float64(expectedSeries)
+		expectedValue := wave(ts) * float64(expectedSeries)
 		if !compareSampleValues(float64(sample.Value), expectedValue) {
 			return lastMatchingIdx, fmt.Errorf("sample at timestamp %d (%s) has value %f while was expecting %f", sample.Timestamp, ts.String(), sample.Value, expectedValue)
 		}
 
-		// Assert on sample timestamp. We expect no gaps.
+		// Assert on sample timestamp. We expect no gaps, except the injected ones.
 		if idx < len(samples)-1 {
 			nextTs := time.UnixMilli(int64(samples[idx+1].Timestamp)).UTC()
 			expectedTs := nextTs.Add(-expectedStep)
+			for isGap != nil && expectedStep > 0 && expectedTs.After(ts) && isGap(expectedTs) {
+				expectedTs = expectedTs.Add(-expectedStep)
+			}
 
 			if ts.UnixMilli() != expectedTs.UnixMilli() {
 				return lastMatchingIdx, fmt.Errorf("sample at timestamp %d (%s) was expected to have timestamp %d (%s) because next sample has timestamp %d (%s)",
@@ -108,6 +237,132 @@ func verifySineWaveSamplesSum(matrix model.Matrix, expectedSeries int, expectedS
 	return lastMatchingIdx, nil
 }
 
+// verifyWaveSamplesSumAtSteps checks whether the input matrix is the expected result of a range query from
+// start to end with the input step, for which the samples of the input waveform written every writeInterval have
+// been queried. Unlike verifyWaveSamplesSumWithGaps, the step may not be a multiple of writeInterval: a sample is
+// expected at each step aligned to writeInterval, except where the write has been deliberately skipped because of
+// gap injection.
+func verifyWaveSamplesSumAtSteps(matrix model.Matrix, wave waveform, expectedSeries int, start, end time.Time, step time.Duration, isGap func(time.Time) bool) error {
+	var expectedTimestamps []time.Time
+	for ts := start; !ts.After(end); ts = ts.Add(step) {
+		if ts.Equal(alignTimestampToInterval(ts, writeInterval)) && (isGap == nil || !isGap(ts)) {
+			expectedTimestamps = append(expectedTimestamps, ts)
+		}
+	}
+
+	if len(expectedTimestamps) == 0 {
+		if len(matrix) > 0 {
+			return fmt.Errorf("expected no series in the result because no written sample is at any of the queried steps, but got %d", len(matrix))
+		}
+		return nil
+	}
+	if len(matrix) != 1 {
+		return fmt.Errorf("expected 1 series in the result but got %d", len(matrix))
+	}
+
+	samples := matrix[0].Values
+	if len(samples) != len(expectedTimestamps) {
+		return fmt.Errorf("expected %d samples in the result but got %d", len(expectedTimestamps), len(samples))
+	}
+
+	for idx, sample := range samples {
+		ts := time.UnixMilli(int64(sample.Timestamp)).UTC()
+		if ts.UnixMilli() != expectedTimestamps[idx].UnixMilli() {
+			return fmt.Errorf("sample at index %d has timestamp %d (%s) while was expecting %d (%s)", idx, sample.Timestamp, ts.String(), expectedTimestamps[idx].UnixMilli(), expectedTimestamps[idx].UTC().String())
+		}
+
+		expectedValue := wave(ts) * float64(expectedSeries)
+		if !compareSampleValues(float64(sample.Value), expectedValue) {
+			return fmt.Errorf("sample at timestamp %d (%s) has value %f while was expecting %f", sample.Timestamp, ts.String(), sample.Value, expectedValue)
+		}
+	}
+
+	return nil
+}
+
+// compareMatrices compares the input matrices sample-by-sample and returns an error describing the
+// first difference found, if any. Sample values are compared using compareSampleValues().
+func compareMatrices(expected, actual model.Matrix) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("expected %d series but got %d", len(expected), len(actual))
+	}
+
+	for i := range expected {
+		expectedSeries, actualSeries := expected[i], actual[i]
+
+		if !expectedSeries.Metric.Equal(actualSeries.Metric) {
+			return fmt.Errorf("expected series %s but got %s", expectedSeries.Metric.String(), actualSeries.Metric.String())
+		}
+
+		if len(expectedSeries.Values) != len(actualSeries.Values) {
+			return fmt.Errorf("expected %d samples for series %s but got %d", len(expectedSeries.Values), expectedSeries.Metric.String(), len(actualSeries.Values))
+		}
+
+		for j := range expectedSeries.Values {
+			expectedSample, actualSample := expectedSeries.Values[j], actualSeries.Values[j]
+
+			if expectedSample.Timestamp != actualSample.Timestamp {
+				return fmt.Errorf("expected sample at timestamp %d for series %s but got timestamp %d", expectedSample.Timestamp, expectedSeries.Metric.String(), actualSample.Timestamp)
+			}
+			if !compareSampleValues(float64(actualSample.Value), float64(expectedSample.Value)) {
+				return fmt.Errorf("sample at timestamp %d for series %s has value %f while was expecting %f", actualSample.Timestamp, expectedSeries.Metric.String(), actualSample.Value, expectedSample.Value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// findMismatchingTimestamps returns the sorted timestamps at which the input matrices have different samples,
+// including the samples which are missing in one of the two matrices. Series are matched by their labels.
+func findMismatchingTimestamps(expected, actual model.Matrix) []model.Time {
+	samplesByTimestamp := func(matrix model.Matrix) map[model.Fingerprint]map[model.Time]model.SampleValue {
+		out := make(map[model.Fingerprint]map[model.Time]model.SampleValue, len(matrix))
+		for _, series := range matrix {
+			samples := make(map[model.Time]model.SampleValue, len(series.Values))
+			for _, sample := range series.Values {
+				samples[sample.Timestamp] = sample.Value
+			}
+			out[series.Metric.Fingerprint()] = samples
+		}
+		return out
+	}
+
+	expectedSamples := samplesByTimestamp(expected)
+	actualSamples := samplesByTimestamp(actual)
+	mismatching := map[model.Time]struct{}{}
+
+	compare := func(first, second map[model.Fingerprint]map[model.Time]model.SampleValue) {
+		for fp, firstSeries := range first {
+			secondSeries := second[fp]
+			for ts, firstValue := range firstSeries {
+				secondValue, ok := secondSeries[ts]
+				if !ok || !compareSampleValues(float64(secondValue), float64(firstValue)) {
+					mismatching[ts] = struct{}{}
+				}
+			}
+		}
+	}
+	compare(expectedSamples, actualSamples)
+	compare(actualSamples, expectedSamples)
+
+	out := make([]model.Time, 0, len(mismatching))
+	for ts := range mismatching {
+		out = append(out, ts)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// formatTimestamps returns the input timestamps formatted as a comma-separated list of Unix milliseconds.
+func formatTimestamps(timestamps []model.Time) string {
+	formatted := make([]string, 0, len(timestamps))
+	for _, ts := range timestamps {
+		formatted = append(formatted, strconv.FormatInt(int64(ts), 10))
+	}
+	return strings.Join(formatted, ",")
+}
+
 func compareSampleValues(actual, expected float64) bool {
 	delta := math.Abs((actual - expected) / maxComparisonDelta)
 	return delta < maxComparisonDelta
@@ -136,3 +391,37 @@ func randTime(min, max time.Time) time.Time {
 	sec := rand.Int63n(delta) + min.Unix()
 	return time.Unix(sec, 0)
 }
+
+// DurationSliceCSV is a list of durations which implements flag.Value.
+// The flag value is a comma-separated list of durations, e.g. "20s,1m".
+type DurationSliceCSV []time.Duration
+
+// String implements flag.Value.
+func (d DurationSliceCSV) String() string {
+	out := make([]string, 0, len(d))
+	for _, value := range d {
+		out = append(out, value.String())
+	}
+	return strings.Join(out, ",")
+}
+
+// Set implements flag.Value.
+func (d *DurationSliceCSV) Set(s string) error {
+	var durations DurationSliceCSV
+
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+		durations = append(durations, duration)
+	}
+
+	*d = durations
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -18,6 +19,12 @@ func TestAlignTimestampToInterval(t *testing.T) {
 	assert.Equal(t, time.Unix(40, 0), alignTimestampToInterval(time.Unix(40, 0), 10*time.Second))
 }
 
+func TestAlignTimestampToStep(t *testing.T) {
+	assert.Equal(t, time.Unix(60, 0).UnixMilli(), alignTimestampToStep(time.Unix(60, 0), 30*time.Second).UnixMilli())
+	assert.Equal(t, time.Unix(60, 0).UnixMilli(), alignTimestampToStep(time.Unix(89, 0), 30*time.Second).UnixMilli())
+	assert.Equal(t, time.Unix(70, 0).UnixMilli(), alignTimestampToStep(time.Unix(80, 0), 70*time.Second).UnixMilli())
+}
+
 func TestGetQueryStep(t *testing.T) {
 	tests := map[string]struct {
 		start         time.Time
@@ -47,6 +54,84 @@ func TestGetQueryStep(t *testing.T) {
 	}
 }
 
+func TestGenerateWaveSeriesWithChurn(t *testing.T) {
+	getSeriesIDs := func(ts time.Time, churnInterval time.Duration, churnFraction float64) []string {
+		var ids []string
+		for _, series := range generateWaveSeriesWithChurn("test", ts, 4, generateSineWaveValue, churnInterval, churnFraction) {
+			require.Len(t, series.Samples, 1)
+			assert.Equal(t, ts.UnixMilli(), series.Samples[0].Timestamp)
+			ids = append(ids, series.Labels[1].Value)
+		}
+		return ids
+	}
+
+	// Without churn, the series are the same at any timestamp.
+	assert.Equal(t, []string{"0", "1", "2", "3"}, getSeriesIDs(time.Unix(0, 0), 0, 0.5))
+	assert.Equal(t, []string{"0", "1", "2", "3"}, getSeriesIDs(time.Unix(3600, 0), 0, 0.5))
+	assert.Equal(t, generateSineWaveSeries("test", time.Unix(3600, 0), 4), generateWaveSeriesWithChurn("test", time.Unix(3600, 0), 4, generateSineWaveValue, 0, 0.5))
+
+	// With churn, a fraction of the series is rotated every churn interval.
+	assert.Equal(t, []string{"0", "1", "2", "3"}, getSeriesIDs(time.Unix(0, 0), time.Minute, 0.5))
+	assert.Equal(t, []string{"0", "1", "2", "3"}, getSeriesIDs(time.Unix(59, 0), time.Minute, 0.5))
+	assert.Equal(t, []string{"0", "1", "4", "5"}, getSeriesIDs(time.Unix(60, 0), time.Minute, 0.5))
+	assert.Equal(t, []string{"0", "1", "6", "7"}, getSeriesIDs(time.Unix(120, 0), time.Minute, 0.5))
+	assert.Equal(t, []string{"0", "1", "2", "5"}, getSeriesIDs(time.Unix(120, 0), time.Minute, 0.25))
+	assert.Equal(t, []string{"8", "9", "10", "11"}, getSeriesIDs(time.Unix(120, 0), time.Minute, 1))
+}
+
+func TestSplitSeriesIntoBatches(t *testing.T) {
+	series := generateSineWaveSeries("test", time.Unix(1000, 0), 5)
+
+	assert.Equal(t, [][]prompb.TimeSeries{series}, splitSeriesIntoBatches(series, 0))
+	assert.Equal(t, [][]prompb.TimeSeries{series}, splitSeriesIntoBatches(series, 5))
+	assert.Equal(t, [][]prompb.TimeSeries{series[0:2], series[2:4], series[4:5]}, splitSeriesIntoBatches(series, 2))
+	assert.Equal(t, [][]prompb.TimeSeries{series[0:1], series[1:2], series[2:3], series[3:4], series[4:5]}, splitSeriesIntoBatches(series, 1))
+}
+
+func TestAddExtraLabels(t *testing.T) {
+	t.Run("should not add any label if the number of extra labels is 0", func(t *testing.T) {
+		series := generateSineWaveSeries("test", time.Unix(0, 0), 2)
+		addExtraLabels(series, 0, 16)
+		assert.Equal(t, generateSineWaveSeries("test", time.Unix(0, 0), 2), series)
+	})
+
+	t.Run("should add sorted labels with values of the configured size", func(t *testing.T) {
+		series := generateSineWaveSeries("test", time.Unix(0, 0), 2)
+		addExtraLabels(series, 2, 8)
+
+		assert.Equal(t, []prompb.Label{
+			{Name: "__name__", Value: "test"},
+			{Name: "label_00", Value: "0_0_xxxx"},
+			{Name: "label_01", Value: "0_1_xxxx"},
+			{Name: "series_id", Value: "0"},
+		}, series[0].Labels)
+		assert.Equal(t, []prompb.Label{
+			{Name: "__name__", Value: "test"},
+			{Name: "label_00", Value: "1_0_xxxx"},
+			{Name: "label_01", Value: "1_1_xxxx"},
+			{Name: "series_id", Value: "1"},
+		}, series[1].Labels)
+	})
+
+	t.Run("should keep the same labels for the same series across writes", func(t *testing.T) {
+		first := generateSineWaveSeries("test", time.Unix(0, 0), 2)
+		addExtraLabels(first, 3, 32)
+
+		second := generateSineWaveSeries("test", time.Unix(3600, 0), 2)
+		addExtraLabels(second, 3, 32)
+
+		for i := range first {
+			assert.Equal(t, first[i].Labels, second[i].Labels)
+		}
+	})
+
+	t.Run("should not truncate label values longer than the configured size", func(t *testing.T) {
+		series := generateSineWaveSeries("test", time.Unix(0, 0), 1)
+		addExtraLabels(series, 1, 2)
+		assert.Equal(t, "0_0_", series[0].Labels[1].Value)
+	})
+}
+
 func TestVerifySineWaveSamplesSum(t *testing.T) {
 	// Round to millis since that's the precision of Prometheus timestamps.
 	now := time.UnixMilli(time.Now().UnixMilli()).UTC()
@@ -129,6 +214,230 @@ func TestVerifySineWaveSamplesSum(t *testing.T) {
 	}
 }
 
+func TestVerifyWaveSamplesSumWithGaps(t *testing.T) {
+	now := time.UnixMilli(time.Now().UnixMilli()).UTC()
+	gap := now.Add(20 * time.Second)
+	isGap := func(ts time.Time) bool { return ts.Equal(gap) }
+
+	tests := map[string]struct {
+		samples                 []model.SamplePair
+		expectedLastMatchingIdx int
+		expectedErr             string
+	}{
+		"should return no error if samples are missing only at the injected gaps": {
+			samples: []model.SamplePair{
+				newSamplePair(now.Add(10*time.Second), generateSineWaveValue(now.Add(10*time.Second))),
+				newSamplePair(now.Add(30*time.Second), generateSineWaveValue(now.Add(30*time.Second))),
+			},
+			expectedLastMatchingIdx: 0,
+		},
+		"should return error if a sample is returned at an injected gap": {
+			samples: []model.SamplePair{
+				newSamplePair(now.Add(10*time.Second), generateSineWaveValue(now.Add(10*time.Second))),
+				newSamplePair(gap, generateSineWaveValue(gap)),
+				newSamplePair(now.Add(30*time.Second), generateSineWaveValue(now.Add(30*time.Second))),
+			},
+			expectedLastMatchingIdx: 2,
+			expectedErr:             "sample at timestamp .* has been returned while no sample was written at that timestamp because of gap injection",
+		},
+		"should return error if a sample is missing outside the injected gaps": {
+			samples: []model.SamplePair{
+				newSamplePair(now, generateSineWaveValue(now)),
+				newSamplePair(now.Add(30*time.Second), generateSineWaveValue(now.Add(30*time.Second))),
+			},
+			expectedLastMatchingIdx: 1,
+			expectedErr:             "sample at timestamp .* was expected to have timestamp .*",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			actualLastMatchingIdx, actualErr := verifyWaveSamplesSumWithGaps(model.Matrix{{Values: testData.samples}}, generateSineWaveValue, 1, 10*time.Second, isGap)
+			if testData.expectedErr == "" {
+				assert.NoError(t, actualErr)
+			} else {
+				assert.Error(t, actualErr)
+				assert.Regexp(t, testData.expectedErr, actualErr.Error())
+			}
+			assert.Equal(t, testData.expectedLastMatchingIdx, actualLastMatchingIdx)
+		})
+	}
+}
+
+func TestVerifyWaveSamplesSumAtSteps(t *testing.T) {
+	start, end := time.Unix(1200, 0), time.Unix(1380, 0)
+
+	tests := map[string]struct {
+		step        time.Duration
+		isGap       func(time.Time) bool
+		matrix      model.Matrix
+		expectedErr string
+	}{
+		"step multiple of the write interval": {
+			step:   40 * time.Second,
+			matrix: model.Matrix{{Values: generateSineWaveSamplesSum(start, time.Unix(1360, 0), 1, 40*time.Second)}},
+		},
+		"uneven step should expect samples only at the steps aligned to the write interval": {
+			step:   30 * time.Second,
+			matrix: model.Matrix{{Values: generateSineWaveSamplesSum(start, end, 1, time.Minute)}},
+		},
+		"uneven step with a sample at a step not aligned to the write interval": {
+			step:        30 * time.Second,
+			matrix:      model.Matrix{{Values: generateSineWaveSamplesSum(start, end, 1, 30*time.Second)}},
+			expectedErr: "expected 4 samples in the result but got 7",
+		},
+		"uneven step with a missing sample": {
+			step:        30 * time.Second,
+			matrix:      model.Matrix{{Values: append(generateSineWaveSamplesSum(start, start, 1, time.Minute), generateSineWaveSamplesSum(time.Unix(1320, 0), end, 1, time.Minute)...)}},
+			expectedErr: "expected 4 samples in the result but got 3",
+		},
+		"uneven step with a sample at an unexpected timestamp": {
+			step:        30 * time.Second,
+			matrix:      model.Matrix{{Values: append(generateSineWaveSamplesSum(start, time.Unix(1320, 0), 1, time.Minute), newSamplePair(time.Unix(1370, 0), generateSineWaveValue(time.Unix(1370, 0))))}},
+			expectedErr: "sample at index 3 has timestamp 1370000",
+		},
+		"uneven step with a wrong value": {
+			step:        30 * time.Second,
+			matrix:      model.Matrix{{Values: append(generateSineWaveSamplesSum(start, time.Unix(1320, 0), 1, time.Minute), newSamplePair(end, 1000))}},
+			expectedErr: "sample at timestamp 1380000 .* has value 1000",
+		},
+		"uneven step with injected gaps": {
+			step:   30 * time.Second,
+			isGap:  func(ts time.Time) bool { return ts.Equal(time.Unix(1260, 0)) },
+			matrix: model.Matrix{{Values: append(generateSineWaveSamplesSum(start, start, 1, time.Minute), generateSineWaveSamplesSum(time.Unix(1320, 0), end, 1, time.Minute)...)}},
+		},
+		"no sample expected at any step": {
+			step:   70 * time.Second,
+			isGap:  func(ts time.Time) bool { return true },
+			matrix: model.Matrix{},
+		},
+		"unexpected series when no sample is expected at any step": {
+			step:        70 * time.Second,
+			isGap:       func(ts time.Time) bool { return true },
+			matrix:      model.Matrix{{Values: generateSineWaveSamplesSum(start, start, 1, time.Minute)}},
+			expectedErr: "expected no series in the result",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			err := verifyWaveSamplesSumAtSteps(testData.matrix, generateSineWaveValue, 1, start, end, testData.step, testData.isGap)
+			if testData.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Regexp(t, testData.expectedErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestDurationSliceCSV(t *testing.T) {
+	var d DurationSliceCSV
+	require.NoError(t, d.Set("20s, 1m,,90s"))
+	assert.Equal(t, DurationSliceCSV{20 * time.Second, time.Minute, 90 * time.Second}, d)
+	assert.Equal(t, "20s,1m0s,1m30s", d.String())
+
+	assert.Error(t, d.Set("20s,invalid"))
+}
+
+func TestCompareMatrices(t *testing.T) {
+	now := time.Unix(1000, 0)
+	series := func(name string, values ...float64) *model.SampleStream {
+		stream := &model.SampleStream{Metric: model.Metric{"series_id": model.LabelValue(name)}}
+		for i, value := range values {
+			stream.Values = append(stream.Values, newSamplePair(now.Add(time.Duration(i)*writeInterval), value))
+		}
+		return stream
+	}
+
+	tests := map[string]struct {
+		expected    model.Matrix
+		actual      model.Matrix
+		expectedErr string
+	}{
+		"empty matrices": {},
+		"matching matrices": {
+			expected: model.Matrix{series("1", 1, 2), series("2", 3)},
+			actual:   model.Matrix{series("1", 1, 2), series("2", 3)},
+		},
+		"values within the comparison delta": {
+			expected: model.Matrix{series("1", 1)},
+			actual:   model.Matrix{series("1", 1+1e-9)},
+		},
+		"different number of series": {
+			expected:    model.Matrix{series("1", 1)},
+			actual:      model.Matrix{series("1", 1), series("2", 1)},
+			expectedErr: "expected 1 series but got 2",
+		},
+		"different series": {
+			expected:    model.Matrix{series("1", 1)},
+			actual:      model.Matrix{series("2", 1)},
+			expectedErr: `expected series {series_id="1"} but got {series_id="2"}`,
+		},
+		"different number of samples": {
+			expected:    model.Matrix{series("1", 1, 2)},
+			actual:      model.Matrix{series("1", 1)},
+			expectedErr: `expected 2 samples for series {series_id="1"} but got 1`,
+		},
+		"different sample values": {
+			expected:    model.Matrix{series("1", 1, 2)},
+			actual:      model.Matrix{series("1", 1, 3)},
+			expectedErr: `sample at timestamp 1020000 for series {series_id="1"} has value 3.000000 while was expecting 2.000000`,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			err := compareMatrices(testData.expected, testData.actual)
+			if testData.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, testData.expectedErr)
+			}
+		})
+	}
+}
+
+func TestFindMismatchingTimestamps(t *testing.T) {
+	series := func(name string, samples ...model.SamplePair) *model.SampleStream {
+		return &model.SampleStream{Metric: model.Metric{"series_id": model.LabelValue(name)}, Values: samples}
+	}
+
+	tests := map[string]struct {
+		expected model.Matrix
+		actual   model.Matrix
+		want     []model.Time
+	}{
+		"matching matrices": {
+			expected: model.Matrix{series("1", model.SamplePair{Timestamp: 1, Value: 1}, model.SamplePair{Timestamp: 2, Value: 2})},
+			actual:   model.Matrix{series("1", model.SamplePair{Timestamp: 1, Value: 1}, model.SamplePair{Timestamp: 2, Value: 2})},
+			want:     []model.Time{},
+		},
+		"different values": {
+			expected: model.Matrix{series("1", model.SamplePair{Timestamp: 1, Value: 1}, model.SamplePair{Timestamp: 2, Value: 2}, model.SamplePair{Timestamp: 3, Value: 3})},
+			actual:   model.Matrix{series("1", model.SamplePair{Timestamp: 1, Value: 1}, model.SamplePair{Timestamp: 2, Value: 5}, model.SamplePair{Timestamp: 3, Value: 6})},
+			want:     []model.Time{2, 3},
+		},
+		"missing and extra samples": {
+			expected: model.Matrix{series("1", model.SamplePair{Timestamp: 1, Value: 1}, model.SamplePair{Timestamp: 2, Value: 2})},
+			actual:   model.Matrix{series("1", model.SamplePair{Timestamp: 2, Value: 2}, model.SamplePair{Timestamp: 3, Value: 3})},
+			want:     []model.Time{1, 3},
+		},
+		"different series": {
+			expected: model.Matrix{series("1", model.SamplePair{Timestamp: 1, Value: 1})},
+			actual:   model.Matrix{series("2", model.SamplePair{Timestamp: 2, Value: 1})},
+			want:     []model.Time{1, 2},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.want, findMismatchingTimestamps(testData.expected, testData.actual))
+		})
+	}
+}
+
 func TestMinTime(t *testing.T) {
 	first := time.Now()
 	second := first.Add(time.Second)
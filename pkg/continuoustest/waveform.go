@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	waveformSine       = "sine"
+	waveformSawtooth   = "sawtooth"
+	waveformLinearRamp = "linear-ramp"
+	waveformSquare     = "square"
+	waveformRandom     = "random"
+
+	// waveformPeriod is the period of the periodic waveforms.
+	waveformPeriod = 10 * time.Minute
+
+	// randomWaveformResolution is the resolution of the values of the random waveform, which are
+	// multiples of it, to keep the sum of the values of many series exactly verifiable.
+	randomWaveformResolution = 0.001
+)
+
+var supportedWaveforms = []string{waveformSine, waveformSawtooth, waveformLinearRamp, waveformSquare, waveformRandom}
+
+// waveform returns the value of a series at the input timestamp. Waveforms are a deterministic function
+// of the timestamp, so that the query results can be verified analytically.
+type waveform func(t time.Time) float64
+
+// newWaveform returns the waveform with the input name. The seed is used by the random waveform only.
+func newWaveform(name string, seed int64) (waveform, error) {
+	switch name {
+	case waveformSine:
+		return generateSineWaveValue, nil
+	case waveformSawtooth:
+		return generateSawtoothWaveValue, nil
+	case waveformLinearRamp:
+		return generateLinearRampValue, nil
+	case waveformSquare:
+		return generateSquareWaveValue, nil
+	case waveformRandom:
+		return func(t time.Time) float64 {
+			return generateRandomWaveValue(t, seed)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported waveform %q (supported values: %s)", name, strings.Join(supportedWaveforms, ", "))
+	}
+}
+
+// waveformMetricName returns the name of the metric written for the input waveform. Each waveform is written
+// to a different metric, so that samples previously written with a different waveform don't fail the checks.
+func waveformMetricName(name string) string {
+	if name == waveformSine {
+		return metricName
+	}
+	return fmt.Sprintf("mimir_continuous_test_%s_wave", strings.ReplaceAll(name, "-", "_"))
+}
+
+// generateSawtoothWaveValue returns a value increasing linearly from -1 to 1 over each period.
+func generateSawtoothWaveValue(t time.Time) float64 {
+	offset := t.UnixMilli() % waveformPeriod.Milliseconds()
+	return 2*float64(offset)/float64(waveformPeriod.Milliseconds()) - 1
+}
+
+// generateLinearRampValue returns a value increasing linearly with time, like a counter: the number
+// of seconds since the Unix epoch.
+func generateLinearRampValue(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+// generateSquareWaveValue returns 1 in the first half of each period, and -1 in the second half.
+func generateSquareWaveValue(t time.Time) float64 {
+	if t.UnixMilli()%waveformPeriod.Milliseconds() < waveformPeriod.Milliseconds()/2 {
+		return 1
+	}
+	return -1
+}
+
+// generateRandomWaveValue returns a pseudo-random value between -1 and 1, which is a function of the
+// timestamp and the seed.
+func generateRandomWaveValue(t time.Time, seed int64) float64 {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(seed))
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(t.UnixMilli()))
+
+	h := fnv.New64a()
+	_, _ = h.Write(buf[:])
+
+	steps := uint64(math.Round(2 / randomWaveformResolution))
+	return float64(h.Sum64()%(steps+1))*randomWaveformResolution - 1
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWaveform(t *testing.T) {
+	for _, name := range supportedWaveforms {
+		t.Run(name, func(t *testing.T) {
+			wave, err := newWaveform(name, 1)
+			require.NoError(t, err)
+
+			// Waveforms must be a deterministic function of the timestamp.
+			for ts := time.Unix(0, 0); ts.Before(time.Unix(3600, 0)); ts = ts.Add(writeInterval) {
+				assert.Equal(t, wave(ts), wave(ts))
+			}
+		})
+	}
+
+	_, err := newWaveform("triangle", 0)
+	require.EqualError(t, err, "unsupported waveform \"triangle\" (supported values: sine, sawtooth, linear-ramp, square, random)")
+}
+
+func TestWaveformMetricName(t *testing.T) {
+	assert.Equal(t, "mimir_continuous_test_sine_wave", waveformMetricName(waveformSine))
+	assert.Equal(t, "mimir_continuous_test_sawtooth_wave", waveformMetricName(waveformSawtooth))
+	assert.Equal(t, "mimir_continuous_test_linear_ramp_wave", waveformMetricName(waveformLinearRamp))
+}
+
+func TestGenerateSawtoothWaveValue(t *testing.T) {
+	assert.Equal(t, -1.0, generateSawtoothWaveValue(time.Unix(0, 0)))
+	assert.Equal(t, 0.0, generateSawtoothWaveValue(time.Unix(300, 0)))
+	assert.Equal(t, -1.0, generateSawtoothWaveValue(time.Unix(600, 0)))
+	assert.InDelta(t, 1.0, generateSawtoothWaveValue(time.Unix(599, 999000000)), 0.0001)
+}
+
+func TestGenerateLinearRampValue(t *testing.T) {
+	assert.Equal(t, 1000.0, generateLinearRampValue(time.Unix(1000, 0)))
+	assert.Equal(t, 1020.5, generateLinearRampValue(time.UnixMilli(1020500)))
+}
+
+func TestGenerateSquareWaveValue(t *testing.T) {
+	assert.Equal(t, 1.0, generateSquareWaveValue(time.Unix(0, 0)))
+	assert.Equal(t, 1.0, generateSquareWaveValue(time.Unix(299, 0)))
+	assert.Equal(t, -1.0, generateSquareWaveValue(time.Unix(300, 0)))
+	assert.Equal(t, 1.0, generateSquareWaveValue(time.Unix(600, 0)))
+}
+
+func TestGenerateRandomWaveValue(t *testing.T) {
+	distinct := map[float64]struct{}{}
+	for ts := time.Unix(0, 0); ts.Before(time.Unix(3600, 0)); ts = ts.Add(writeInterval) {
+		value := generateRandomWaveValue(ts, 1)
+		assert.GreaterOrEqual(t, value, -1.0)
+		assert.LessOrEqual(t, value, 1.0)
+		distinct[value] = struct{}{}
+	}
+	assert.Greater(t, len(distinct), 100)
+
+	// The values depend on the seed.
+	assert.NotEqual(t, generateRandomWaveValue(time.Unix(1000, 0), 1), generateRandomWaveValue(time.Unix(1000, 0), 2))
+}
@@ -6,18 +6,26 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
 	"golang.org/x/time/rate"
 
+	"github.com/grafana/dskit/concurrency"
+	"github.com/grafana/dskit/flagext"
 	"github.com/grafana/dskit/multierror"
 
+	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
 )
 
@@ -32,17 +40,155 @@ var (
 	// wrote and ensure the PromQL lookback period doesn't influence query results. This help to avoid
 	// false positives when finding the last written sample, or when restarting the testing tool with
 	// a different number of configured series to write and read.
-	queryMetricSum = fmt.Sprintf("sum(max_over_time(%s[1s]))", metricName)
+	queryMetricSum = sumQuery(metricName)
 )
 
+// sumQuery returns the query summing the samples of all the series of the input metric.
+func sumQuery(metricName string) string {
+	return fmt.Sprintf("sum(max_over_time(%s[1s]))", metricName)
+}
+
 type WriteReadSeriesTestConfig struct {
-	NumSeries   int
-	MaxQueryAge time.Duration
+	NumSeries               int
+	RampSchedule            RampSchedule
+	MaxQueryAge             time.Duration
+	QueryResponseFormats    flagext.StringSliceCSV
+	ChurnInterval           time.Duration
+	ChurnFraction           float64
+	NumExtraLabels          int
+	ExtraLabelValueSize     int
+	BackfillPeriod          time.Duration
+	BackfillUploadTimeout   time.Duration
+	OldBlocksWindowStartAge time.Duration
+	OldBlocksWindowEndAge   time.Duration
+	Waveform                string
+	WaveformSeed            int64
+	WriteBatchSize          int
+	WriteConcurrency        int
+	WriteOnly               bool
+
+	GapInjectionConfig
+	BisectionConfig
+	ReadYourWritesConfig
+	QueryDifferentialsConfig
+	StepSweepConfig
+	PerSeriesConfig
+	QueryLatencyBudgetConfig
+	QueryStatsCheckConfig
+	RegexMatcherQueriesConfig
+	DeepVerificationConfig
 }
 
 func (cfg *WriteReadSeriesTestConfig) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.NumSeries, "tests.write-read-series-test.num-series", 10000, "Number of series used for the test.")
+	f.Var(&cfg.RampSchedule, "tests.write-read-series-test.ramp-schedule", "Comma-separated list of steps in the format <duration>=<number of series>, for example 1h=1000,1h=10000,30m=5000. When set, the number of written series follows the schedule instead of -tests.write-read-series-test.num-series, so that the test can be used as a load generator whose writes are verified. The schedule repeats indefinitely and its cycles are aligned to the Unix epoch, so the number of series written at each timestamp is known when verifying the query results. Use decreasing steps to shrink the number of series.")
 	f.DurationVar(&cfg.MaxQueryAge, "tests.write-read-series-test.max-query-age", 7*24*time.Hour, "How back in the past metrics can be queried at most.")
+
+	cfg.QueryResponseFormats = []string{responseFormatJSON}
+	f.Var(&cfg.QueryResponseFormats, "tests.write-read-series-test.query-response-formats", fmt.Sprintf("Comma-separated list of query response formats to request. When more than one format is configured, formats are alternated across test runs. Supported values: %s.", strings.Join(supportedResponseFormats, ", ")))
+	f.DurationVar(&cfg.ChurnInterval, "tests.write-read-series-test.churn-interval", 0, "How frequently a fraction of the written series is replaced by new series, to simulate series churn. 0 to disable.")
+	f.Float64Var(&cfg.ChurnFraction, "tests.write-read-series-test.churn-fraction", 0.1, "Fraction of the written series replaced by new series every churn interval. Value must be between 0 and 1.")
+	f.IntVar(&cfg.NumExtraLabels, "tests.write-read-series-test.num-extra-labels", 0, "Number of labels added to each written series, in addition to the metric name and the series_id label. Use it along with -tests.write-read-series-test.extra-label-value-size to mimic the labels footprint of real series.")
+	f.IntVar(&cfg.ExtraLabelValueSize, "tests.write-read-series-test.extra-label-value-size", 16, "Approximate size, in bytes, of the value of each label added by -tests.write-read-series-test.num-extra-labels.")
+	f.DurationVar(&cfg.OldBlocksWindowStartAge, "tests.write-read-series-test.old-blocks-window-start-age", 0, "When set, on each test run the range query over a dedicated time window older than the ingesters retention is run, to explicitly verify the reads served exclusively by the store-gateways from compacted blocks. The window starts this long ago, and it should be older than the -querier.query-store-after configured in Mimir. 0 to disable.")
+	f.DurationVar(&cfg.OldBlocksWindowEndAge, "tests.write-read-series-test.old-blocks-window-end-age", 25*time.Hour, "How long ago the time window configured by -tests.write-read-series-test.old-blocks-window-start-age ends.")
+	f.DurationVar(&cfg.BackfillPeriod, "tests.write-read-series-test.backfill-period", 0, "When set, at startup the test backfills the series for this period in the past through the block upload API, so that long-range queries can be verified right after the deployment of the testing tool. Only the time range older than the previously written samples, if any, is backfilled. Block upload must be enabled in Mimir for the tenant. 0 to disable.")
+	f.DurationVar(&cfg.BackfillUploadTimeout, "tests.write-read-series-test.backfill-upload-timeout", 5*time.Minute, "How long to wait for each backfilled block to be uploaded and validated by Mimir.")
+	f.StringVar(&cfg.Waveform, "tests.write-read-series-test.waveform", waveformSine, fmt.Sprintf("The waveform followed by the values of the written series. All waveforms are a deterministic function of the timestamp, so that the query results can be verified analytically, while exercising different compression and chunk encoding characteristics. Each waveform is written to a different metric. Supported values: %s.", strings.Join(supportedWaveforms, ", ")))
+	f.Int64Var(&cfg.WaveformSeed, "tests.write-read-series-test.waveform-seed", 0, "The seed of the values generated by the random waveform. Changing the seed of a running test causes the previously written samples to fail the checks.")
+	f.IntVar(&cfg.WriteBatchSize, "tests.write-read-series-test.write-batch-size", 0, "Maximum number of series sent in each remote write request. When the number of series is greater, the series written at each timestamp are split into multiple requests, to not hit the request size limits. 0 to send all the series in a single request.")
+	f.IntVar(&cfg.WriteConcurrency, "tests.write-read-series-test.write-concurrency", 4, "Maximum number of remote write requests sent concurrently when the series written at each timestamp are split into multiple requests by -tests.write-read-series-test.write-batch-size.")
+	f.BoolVar(&cfg.WriteOnly, "tests.write-read-series-test.write-only", false, "When enabled, the test only writes the series and doesn't run any query, for deployments where the written series are verified by a separate instance of the testing tool, or where the read path can't be reached. The previously written samples time range isn't recovered at startup, because it requires queries, so the writes restart from the current timestamp.")
+
+	cfg.GapInjectionConfig.RegisterFlags(f)
+	cfg.BisectionConfig.RegisterFlags(f)
+	cfg.ReadYourWritesConfig.RegisterFlags(f)
+	cfg.QueryDifferentialsConfig.RegisterFlags(f)
+	cfg.StepSweepConfig.RegisterFlags(f)
+	cfg.PerSeriesConfig.RegisterFlags(f)
+	cfg.QueryLatencyBudgetConfig.RegisterFlags(f)
+	cfg.QueryStatsCheckConfig.RegisterFlags(f)
+	cfg.RegexMatcherQueriesConfig.RegisterFlags(f)
+	cfg.DeepVerificationConfig.RegisterFlags(f)
+}
+
+// numSeriesAt returns the number of series written at the input timestamp, according to the ramp schedule if configured.
+func (cfg *WriteReadSeriesTestConfig) numSeriesAt(ts time.Time) int {
+	if len(cfg.RampSchedule) > 0 {
+		return cfg.RampSchedule.numSeriesAt(ts)
+	}
+	return cfg.NumSeries
+}
+
+// maxNumSeries returns the highest number of series written at any timestamp.
+func (cfg *WriteReadSeriesTestConfig) maxNumSeries() int {
+	if len(cfg.RampSchedule) > 0 {
+		return cfg.RampSchedule.maxNumSeries()
+	}
+	return cfg.NumSeries
+}
+
+func (cfg *WriteReadSeriesTestConfig) Validate() error {
+	if len(cfg.QueryResponseFormats) == 0 {
+		return errors.New("at least one query response format must be configured")
+	}
+	for _, format := range cfg.QueryResponseFormats {
+		if !util.StringsContain(supportedResponseFormats, format) {
+			return fmt.Errorf("unsupported query response format %q (supported values: %s)", format, strings.Join(supportedResponseFormats, ", "))
+		}
+	}
+	if cfg.ChurnInterval < 0 {
+		return errors.New("the churn interval must be greater than or equal to 0")
+	}
+	if cfg.ChurnFraction < 0 || cfg.ChurnFraction > 1 {
+		return errors.New("the churn fraction must be between 0 and 1")
+	}
+	if cfg.NumExtraLabels < 0 {
+		return errors.New("the number of extra labels must be greater than or equal to 0")
+	}
+	if cfg.ExtraLabelValueSize < 0 {
+		return errors.New("the extra label value size must be greater than or equal to 0")
+	}
+	if err := cfg.GapInjectionConfig.Validate(); err != nil {
+		return err
+	}
+	if cfg.BackfillPeriod < 0 {
+		return errors.New("the backfill period must be greater than or equal to 0")
+	}
+	if cfg.OldBlocksWindowStartAge < 0 {
+		return errors.New("the old blocks window start age must be greater than or equal to 0")
+	}
+	if cfg.OldBlocksWindowStartAge > 0 && cfg.OldBlocksWindowStartAge <= cfg.OldBlocksWindowEndAge {
+		return errors.New("the old blocks window start age must be greater than the old blocks window end age")
+	}
+	if _, err := newWaveform(cfg.Waveform, cfg.WaveformSeed); err != nil {
+		return err
+	}
+	if cfg.WriteBatchSize < 0 {
+		return errors.New("the write batch size must be greater than or equal to 0")
+	}
+	if cfg.WriteConcurrency <= 0 {
+		return errors.New("the write concurrency must be greater than 0")
+	}
+	if err := cfg.DeepVerificationConfig.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.QueryLatencyBudgetConfig.Validate(); err != nil {
+		return err
+	}
+	if cfg.QueryStatsCheckEnabled && (cfg.ChurnInterval > 0 || len(cfg.RampSchedule) > 0) {
+		return errors.New("the query stats check can't be enabled along with series churn or the ramp schedule")
+	}
+	if cfg.WriteOnly && cfg.ReadYourWritesEnabled {
+		return errors.New("the read-your-writes check can't be enabled in write-only mode")
+	}
+	if err := cfg.PerSeriesConfig.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.StepSweepConfig.Validate(); err != nil {
+		return err
+	}
+	return nil
 }
 
 type WriteReadSeriesTest struct {
@@ -52,20 +198,125 @@ type WriteReadSeriesTest struct {
 	logger  log.Logger
 	metrics *TestMetrics
 
+	// The waveform followed by the written series, the metric they're written to and the query summing them.
+	waveform   waveform
+	metricName string
+	querySum   string
+
+	// sumWaveform is the waveform followed by the sum of the written series. It accounts for the number of
+	// series written at each timestamp, which changes over time when the ramp schedule is configured, and
+	// for the per-series offset, when per-series values are enabled. The sum is checked as a single series.
+	sumWaveform waveform
+
+	injectedGapsTotal      prometheus.Counter
+	partialWritesTotal     prometheus.Counter
+	localizedFailuresTotal *prometheus.CounterVec
+	stepSweepFailuresTotal *prometheus.CounterVec
+
+	queryLatencyBudgetViolationsTotal *prometheus.CounterVec
+	writtenSeries                     prometheus.Gauge
+
+	deepVerificationIntegrityScore *prometheus.GaugeVec
+	deepVerificationLastRun        prometheus.Gauge
+
+	queryStatsCheckFailuresTotal *prometheus.CounterVec
+
+	// regexMatcherQueries are the queries run when the regex matcher queries are enabled.
+	regexMatcherQueries       []*regexMatcherQuery
+	regexMatcherFailuresTotal *prometheus.CounterVec
+
 	lastWrittenTimestamp time.Time
 	queryMinTime         time.Time
 	queryMaxTime         time.Time
+
+	// nextDeepVerification is the time since when the next deep verification is due, or zero if not scheduled yet.
+	nextDeepVerification time.Time
+
+	// runs counts the number of test runs, and it's used to alternate the query response format.
+	runs int
 }
 
 func NewWriteReadSeriesTest(cfg WriteReadSeriesTestConfig, client MimirClient, logger log.Logger, reg prometheus.Registerer) *WriteReadSeriesTest {
 	const name = "write-read-series"
 
+	// The waveform is validated by the config, so the sine wave is just a fallback.
+	wave, err := newWaveform(cfg.Waveform, cfg.WaveformSeed)
+	if err != nil {
+		cfg.Waveform, wave = waveformSine, generateSineWaveValue
+	}
+
+	// When per-series values are enabled, the series with index i has an offset of i, so the sum
+	// of the series is offset by the sum of the indexes: numSeries * (numSeries - 1) / 2.
+	sumWave := func(t time.Time) float64 {
+		numSeries := cfg.numSeriesAt(t)
+		sum := wave(t) * float64(numSeries)
+		if cfg.PerSeriesValuesEnabled {
+			sum += float64(numSeries) * float64(numSeries-1) / 2
+		}
+		return sum
+	}
+
 	return &WriteReadSeriesTest{
-		name:    name,
-		cfg:     cfg,
-		client:  client,
-		logger:  log.With(logger, "test", name),
-		metrics: NewTestMetrics(name, reg),
+		name:        name,
+		cfg:         cfg,
+		client:      client,
+		logger:      log.With(logger, "test", name),
+		metrics:     NewTestMetrics(name, reg),
+		waveform:    wave,
+		metricName:  waveformMetricName(cfg.Waveform),
+		querySum:    sumQuery(waveformMetricName(cfg.Waveform)),
+		sumWaveform: sumWave,
+		injectedGapsTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_injected_gaps_total",
+			Help:        "Total number of write intervals deliberately skipped because of gap injection.",
+			ConstLabels: map[string]string{"test": name},
+		}),
+		partialWritesTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_partial_writes_total",
+			Help:        "Total number of timestamps whose series have been split into multiple write requests, and only some of them succeeded.",
+			ConstLabels: map[string]string{"test": name},
+		}),
+		localizedFailuresTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_query_result_check_failures_localized_total",
+			Help:        "Total number of failing time windows localized by bisecting the time range of failed range query result checks, by age of the failing time window.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"age"}),
+		stepSweepFailuresTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_step_sweep_failures_total",
+			Help:        "Total number of failed result checks of the range queries run with the steps configured for the step sweep, by step.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"step"}),
+		queryLatencyBudgetViolationsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_query_latency_budget_violations_total",
+			Help:        "Total number of range and instant queries whose duration exceeded the latency budget configured for the age bucket of the oldest queried timestamp.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"age_bucket"}),
+		writtenSeries: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "mimir_continuous_test_written_series",
+			Help:        "Number of series written at the last successfully written timestamp.",
+			ConstLabels: map[string]string{"test": name},
+		}),
+		deepVerificationIntegrityScore: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "mimir_continuous_test_deep_verification_integrity_score",
+			Help:        "Fraction of the samples checked by the last deep verification which were found as expected, by number of days since the samples have been written.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"days_ago"}),
+		deepVerificationLastRun: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "mimir_continuous_test_deep_verification_last_run_timestamp_seconds",
+			Help:        "Unix timestamp of the last deep verification.",
+			ConstLabels: map[string]string{"test": name},
+		}),
+		queryStatsCheckFailuresTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_query_stats_check_failures_total",
+			Help:        "Total number of range queries whose statistics returned by Mimir were missing or out of the expected bounds, by reason.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"reason"}),
+		regexMatcherQueries: newRegexMatcherQueries(waveformMetricName(cfg.Waveform)),
+		regexMatcherFailuresTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_regex_matcher_query_result_check_failures_total",
+			Help:        "Total number of failed result checks of the range queries summing the series matching a regex matcher, by matcher.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"matcher"}),
 	}
 }
 
@@ -76,103 +327,273 @@ func (t *WriteReadSeriesTest) Name() string {
 
 // Init implements Test.
 func (t *WriteReadSeriesTest) Init(ctx context.Context, now time.Time) error {
+	if t.cfg.WriteOnly {
+		level.Info(t.logger).Log("msg", "Skipped finding previously written samples time range because the test runs in write-only mode")
+	} else {
+		t.recoverPreviouslyWrittenTimeRange(ctx, now)
+	}
+
+	if t.cfg.BackfillPeriod > 0 {
+		return t.backfill(ctx, now)
+	}
+	return nil
+}
+
+func (t *WriteReadSeriesTest) recoverPreviouslyWrittenTimeRange(ctx context.Context, now time.Time) {
 	level.Info(t.logger).Log("msg", "Finding previously written samples time range to recover writes and reads from previous run")
 
 	from, to := t.findPreviouslyWrittenTimeRange(ctx, now)
 	if from.IsZero() || to.IsZero() {
 		level.Info(t.logger).Log("msg", "No valid previously written samples time range found, will continue writing from the nearest interval-aligned timestamp")
-		return nil
+		return
 	}
 	if to.Before(now.Add(-writeMaxAge)) {
 		level.Info(t.logger).Log("msg", "Previously written samples time range found but latest written sample is too old to recover", "last_sample_timestamp", to)
-		return nil
+		return
 	}
 
 	t.lastWrittenTimestamp = to
 	t.queryMinTime = from
 	t.queryMaxTime = to
 	level.Info(t.logger).Log("msg", "Successfully found previously written samples time range and recovered writes and reads from there", "last_written_timestamp", t.lastWrittenTimestamp, "query_min_time", t.queryMinTime, "query_max_time", t.queryMaxTime)
+}
+
+// backfill uploads blocks containing the series for the configured backfill period, up until the oldest
+// previously written sample or, if there's no previously written sample, the first timestamp to write.
+func (t *WriteReadSeriesTest) backfill(ctx context.Context, now time.Time) error {
+	end := t.queryMinTime
+	if end.IsZero() {
+		end = t.nextWriteTimestamp(now)
+	}
+	start := alignTimestampToInterval(now.Add(-t.cfg.BackfillPeriod), writeInterval)
+	if !start.Before(end) {
+		level.Info(t.logger).Log("msg", "Skipped backfilling because the backfill period is already covered by previously written samples", "backfill_period", t.cfg.BackfillPeriod, "query_min_time", t.queryMinTime)
+		return nil
+	}
+
+	level.Info(t.logger).Log("msg", "Backfilling series through the block upload API", "start", start, "end", end)
+
+	// Blocks are aligned to the block range, like the blocks uploaded by the block upload test.
+	for blockStart := start; blockStart.Before(end); {
+		blockEnd := minTime(alignTimestampToInterval(blockStart, blockUploadBlockRange).Add(blockUploadBlockRange), end)
+		if err := t.backfillBlock(ctx, blockStart, blockEnd); err != nil {
+			level.Error(t.logger).Log("msg", "Failed to backfill series", "start", blockStart, "end", blockEnd, "err", err)
+			return errors.Wrap(err, "failed to backfill series")
+		}
+		blockStart = blockEnd
+	}
+
+	// The backfilled samples are queried like the previously written ones. If there's no previously
+	// written sample, the test will continue writing right after the last backfilled sample.
+	t.queryMinTime = start
+	if t.queryMaxTime.IsZero() {
+		t.lastWrittenTimestamp = end.Add(-writeInterval)
+		t.queryMaxTime = t.lastWrittenTimestamp
+	}
+	level.Info(t.logger).Log("msg", "Successfully backfilled series", "query_min_time", t.queryMinTime, "query_max_time", t.queryMaxTime)
 
 	return nil
 }
 
+// backfillBlock builds and uploads a block containing the series for the [start, end) time range.
+func (t *WriteReadSeriesTest) backfillBlock(ctx context.Context, start, end time.Time) error {
+	dir, err := os.MkdirTemp("", "mimir-continuous-test-backfill")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+
+	blockDir, err := writeSeriesBlock(ctx, t.logger, dir, start, end, func(ts time.Time) []prompb.TimeSeries {
+		// Samples deliberately skipped because of gap injection are not backfilled either.
+		if t.isGap(ts) {
+			return nil
+		}
+		return t.generateSeries(ts)
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to write block")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.BackfillUploadTimeout)
+	defer cancel()
+
+	return t.client.UploadBlock(ctx, blockDir)
+}
+
 // Run implements Test.
 func (t *WriteReadSeriesTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
 	// Configure the rate limiter to send a sample for each series per second. At startup, this test may catch up
 	// with previous missing writes: this rate limit reduces the chances to hit the ingestion limit on Mimir side.
-	writeLimiter := rate.NewLimiter(rate.Limit(t.cfg.NumSeries), t.cfg.NumSeries)
+	maxNumSeries := t.cfg.maxNumSeries()
+	writeLimiter := rate.NewLimiter(rate.Limit(maxNumSeries), maxNumSeries)
 
 	// Collect all errors on this test run
 	errs := new(multierror.MultiError)
 
 	// Write series for each expected timestamp until now.
 	for timestamp := t.nextWriteTimestamp(now); !timestamp.After(now); timestamp = t.nextWriteTimestamp(now) {
-		if err := writeLimiter.WaitN(ctx, t.cfg.NumSeries); err != nil {
+		if t.isGap(timestamp) {
+			t.skipSamples(timestamp)
+			continue
+		}
+
+		if err := writeLimiter.WaitN(ctx, t.cfg.numSeriesAt(timestamp)); err != nil {
 			// Context has been canceled, so we should interrupt.
 			return err
 		}
 
+		writeStart := time.Now()
 		if err := t.writeSamples(ctx, timestamp); err != nil {
 			errs.Add(err)
 			break
 		}
+
+		// The query max time is updated only if the write request succeeded.
+		if t.cfg.ReadYourWritesEnabled && t.queryMaxTime.Equal(timestamp) {
+			errs.Add(t.verifyReadYourWrites(ctx, timestamp, writeStart))
+		}
 	}
 
-	queryRanges, queryInstants, err := t.getQueryTimeRanges(now)
-	if err != nil {
-		errs.Add(err)
+	// In write-only mode, the written series are verified elsewhere, if at all.
+	if t.cfg.WriteOnly {
+		return errs.Err()
 	}
+
+	errs.Add(t.runQueryChecks(ctx, now))
+	return errs.Err()
+}
+
+// runQueryChecks runs the queries checking the written samples, using the query response format of the current test run.
+func (t *WriteReadSeriesTest) runQueryChecks(ctx context.Context, now time.Time) error {
+	responseFormat := t.nextQueryResponseFormat()
+	errs := multierror.New()
+
+	queryRanges, queryInstants, err := t.getQueryTimeRanges(now)
+	errs.Add(err)
 	for _, timeRange := range queryRanges {
-		err := t.runRangeQueryAndVerifyResult(ctx, timeRange[0], timeRange[1], true)
-		errs.Add(err)
-		err = t.runRangeQueryAndVerifyResult(ctx, timeRange[0], timeRange[1], false)
-		errs.Add(err)
+		errs.Add(t.runRangeQueriesAndVerifyResults(ctx, now, timeRange[0], timeRange[1], responseFormat))
 	}
+	errs.Add(t.runStepSweep(ctx, queryRanges, responseFormat))
+	errs.Add(t.runRegexMatcherQueries(ctx, queryRanges, responseFormat))
+	errs.Add(t.runPerSeriesCheck(ctx, queryRanges, responseFormat))
 	for _, ts := range queryInstants {
-		err := t.runInstantQueryAndVerifyResult(ctx, ts, true)
-		errs.Add(err)
-		err = t.runInstantQueryAndVerifyResult(ctx, ts, false)
-		errs.Add(err)
+		errs.Add(t.runInstantQueriesAndVerifyResults(ctx, now, ts, responseFormat))
+	}
+	if t.cfg.DeepVerificationInterval > 0 && t.isDeepVerificationDue(now) {
+		errs.Add(t.runDeepVerification(ctx, now, responseFormat))
+	}
+	return errs.Err()
+}
+
+// runRangeQueriesAndVerifyResults runs the range query from start to end with the results cache enabled and
+// disabled, and verifies their results.
+func (t *WriteReadSeriesTest) runRangeQueriesAndVerifyResults(ctx context.Context, now, start, end time.Time, responseFormat string) error {
+	errs := multierror.New()
+	cached, err := t.runRangeQueryAndVerifyResult(ctx, now, start, end, true, responseFormat)
+	errs.Add(err)
+	uncached, err := t.runRangeQueryAndVerifyResult(ctx, now, start, end, false, responseFormat)
+	errs.Add(err)
+
+	if t.cfg.ResultsCacheDifferentialEnabled && cached != nil && uncached != nil {
+		errs.Add(t.verifyResultsCacheConsistency(log.With(t.logger, "query", t.querySum, "start", start.UnixMilli(), "end", end.UnixMilli(), "response_format", responseFormat), cached, uncached))
 	}
 	return errs.Err()
 }
 
+// runInstantQueriesAndVerifyResults runs the instant query at the input timestamp with the results cache enabled
+// and disabled, and verifies their results.
+func (t *WriteReadSeriesTest) runInstantQueriesAndVerifyResults(ctx context.Context, now, ts time.Time, responseFormat string) error {
+	errs := multierror.New()
+	cached, err := t.runInstantQueryAndVerifyResult(ctx, now, ts, true, responseFormat)
+	errs.Add(err)
+	uncached, err := t.runInstantQueryAndVerifyResult(ctx, now, ts, false, responseFormat)
+	errs.Add(err)
+
+	if t.cfg.ResultsCacheDifferentialEnabled && cached != nil && uncached != nil {
+		errs.Add(t.verifyResultsCacheConsistency(log.With(t.logger, "query", t.querySum, "ts", ts.UnixMilli(), "response_format", responseFormat), cached, uncached))
+	}
+	return errs.Err()
+}
+
+// nextQueryResponseFormat returns the query response format to use for the current test run,
+// cycling through the configured formats.
+func (t *WriteReadSeriesTest) nextQueryResponseFormat() string {
+	formats := t.cfg.QueryResponseFormats
+	if len(formats) == 0 {
+		return responseFormatJSON
+	}
+
+	format := formats[t.runs%len(formats)]
+	t.runs++
+	return format
+}
+
 func (t *WriteReadSeriesTest) writeSamples(ctx context.Context, timestamp time.Time) error {
 	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "WriteReadSeriesTest.writeSamples")
 	defer sp.Finish()
-	logger := log.With(sp, "timestamp", timestamp.String(), "num_series", t.cfg.NumSeries)
 
-	statusCode, err := t.client.WriteSeries(ctx, generateSineWaveSeries(metricName, timestamp, t.cfg.NumSeries))
+	numSeries := t.cfg.numSeriesAt(timestamp)
+	batches := splitSeriesIntoBatches(t.generateSeries(timestamp), t.cfg.WriteBatchSize)
+	logger := log.With(sp, "timestamp", timestamp.String(), "num_series", numSeries, "num_batches", len(batches))
 
-	t.metrics.writesTotal.Inc()
-	if statusCode/100 != 2 {
-		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
-		level.Warn(logger).Log("msg", "Failed to remote write series", "status_code", statusCode, "err", err)
-	} else {
-		level.Debug(logger).Log("msg", "Remote write series succeeded")
+	statusCodes := make([]int, len(batches))
+	errs := make([]error, len(batches))
+	err := concurrency.ForEachJob(ctx, len(batches), t.cfg.WriteConcurrency, func(ctx context.Context, idx int) error {
+		statusCodes[idx], errs[idx] = t.writeBatch(ctx, logger, batches[idx])
+		return nil
+	})
+	if err != nil {
+		// Context has been canceled, so some batches may have not been written at all.
+		return errors.Wrap(err, "failed to remote write series")
+	}
+
+	var (
+		failedBatches int
+		clientError   bool
+		firstErr      error
+	)
+	for idx, statusCode := range statusCodes {
+		if statusCode/100 == 2 && errs[idx] == nil {
+			continue
+		}
+
+		failedBatches++
+		if statusCode/100 == 4 {
+			clientError = true
+		} else if firstErr == nil && errs[idx] != nil {
+			firstErr = errors.Wrap(errs[idx], "failed to remote write series")
+		} else if firstErr == nil {
+			firstErr = errors.Errorf("remote write series failed with status code %d", statusCode)
+		}
+	}
+
+	if failedBatches > 0 && failedBatches < len(batches) {
+		t.partialWritesTotal.Inc()
+		level.Warn(logger).Log("msg", "Series have been partially written", "failed_batches", failedBatches)
 	}
 
-	// If the write request failed because of a 4xx error, retrying the request isn't expected to succeed.
+	// If a write request failed because of a 4xx error, retrying the request isn't expected to succeed.
 	// The series may have been not written at all or partially written (eg. we hit some limit).
 	// We keep writing the next interval, but we reset the query timestamp because we can't reliably
 	// assert on query results due to possible gaps.
-	if statusCode/100 == 4 {
+	if clientError {
 		t.lastWrittenTimestamp = timestamp
 		t.queryMinTime = time.Time{}
 		t.queryMaxTime = time.Time{}
 		return nil
 	}
 
-	// If the write request failed because of a network or 5xx error, we'll retry to write series
-	// in the next test run.
-	if err != nil {
-		return errors.Wrap(err, "failed to remote write series")
-	}
-	if statusCode/100 != 2 {
-		return errors.Wrapf(err, "remote write series failed with status code %d", statusCode)
+	// If a write request failed because of a network or 5xx error, even after the retries
+	// done by the client, we'll retry to write series in the next test run. The batches
+	// successfully written are written again, which is accepted because the samples are the same.
+	if firstErr != nil {
+		return firstErr
 	}
 
-	// The write request succeeded.
+	// All the write requests succeeded.
+	t.writtenSeries.Set(float64(numSeries))
 	t.lastWrittenTimestamp = timestamp
 	t.queryMaxTime = timestamp
 	if t.queryMinTime.IsZero() {
@@ -182,6 +603,48 @@ func (t *WriteReadSeriesTest) writeSamples(ctx context.Context, timestamp time.T
 	return nil
 }
 
+// writeBatch sends a single remote write request with the input series, and tracks its outcome.
+func (t *WriteReadSeriesTest) writeBatch(ctx context.Context, logger log.Logger, series []prompb.TimeSeries) (int, error) {
+	sp, ctx := spanlogger.NewWithLogger(ctx, logger, "WriteReadSeriesTest.writeBatch")
+	defer sp.Finish()
+	sp.SetTag("batch_series", len(series))
+
+	start := time.Now()
+	statusCode, err := t.client.WriteSeries(ctx, series)
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+
+	sp.SetTag("status_code", statusCode)
+	if err == nil && statusCode/100 != 2 {
+		_ = sp.Error(errors.Errorf("remote write series failed with status code %d", statusCode))
+	} else {
+		_ = sp.Error(err)
+	}
+
+	t.metrics.writesTotal.Inc()
+	if statusCode/100 != 2 {
+		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		level.Warn(logger).Log("msg", "Failed to remote write series", "batch_series", len(series), "status_code", statusCode, "err", err)
+	} else {
+		t.metrics.observeSuccess(outcomeTypeWrite)
+		level.Debug(logger).Log("msg", "Remote write series succeeded", "batch_series", len(series))
+	}
+
+	return statusCode, err
+}
+
+// generateSeries returns the series to write at the input timestamp.
+func (t *WriteReadSeriesTest) generateSeries(timestamp time.Time) []prompb.TimeSeries {
+	series := generateWaveSeriesWithChurn(t.metricName, timestamp, t.cfg.numSeriesAt(timestamp), t.waveform, t.cfg.ChurnInterval, t.cfg.ChurnFraction)
+	if t.cfg.PerSeriesValuesEnabled {
+		for i := range series {
+			series[i].Samples[0].Value += float64(i)
+		}
+	}
+	addExtraLabels(series, t.cfg.NumExtraLabels, t.cfg.ExtraLabelValueSize)
+	return series
+}
+
 // getQueryTimeRanges returns the start/end time ranges to use to run test range queries,
 // and the timestamps to use to run test instant queries.
 func (t *WriteReadSeriesTest) getQueryTimeRanges(now time.Time) (ranges [][2]time.Time, instants []time.Time, err error) {
@@ -224,6 +687,16 @@ func (t *WriteReadSeriesTest) getQueryTimeRanges(now time.Time) (ranges [][2]tim
 		})
 	}
 
+	// The old blocks window, only if the actual time range fully covers it (otherwise the queried data may
+	// be served by the ingesters too).
+	if t.cfg.OldBlocksWindowStartAge > 0 {
+		windowStart, windowEnd := now.Add(-t.cfg.OldBlocksWindowStartAge), now.Add(-t.cfg.OldBlocksWindowEndAge)
+		if !adjustedQueryMinTime.After(windowStart) && !t.queryMaxTime.Before(windowEnd) {
+			ranges = append(ranges, [2]time.Time{windowStart, windowEnd})
+			instants = append(instants, windowEnd)
+		}
+	}
+
 	// A random time range.
 	randMinTime := randTime(adjustedQueryMinTime, t.queryMaxTime)
 	ranges = append(ranges, [2]time.Time{randMinTime, randTime(randMinTime, t.queryMaxTime)})
@@ -232,13 +705,24 @@ func (t *WriteReadSeriesTest) getQueryTimeRanges(now time.Time) (ranges [][2]tim
 	return ranges, instants, nil
 }
 
-func (t *WriteReadSeriesTest) runRangeQueryAndVerifyResult(ctx context.Context, start, end time.Time, resultsCacheEnabled bool) error {
+// mostRecentHour returns the most recent hour of the first input time range. The checks running many queries
+// are limited to it, to keep the number of points per query bounded.
+func mostRecentHour(ranges [][2]time.Time) (start, end time.Time, ok bool) {
+	if len(ranges) == 0 {
+		return time.Time{}, time.Time{}, false
+	}
+	return maxTime(ranges[0][0], ranges[0][1].Add(-time.Hour)), ranges[0][1], true
+}
+
+// runRangeQueryAndVerifyResult runs a range query and verifies its result. The query result is returned
+// if the query succeeded, even if the result check failed. Returns a nil result if the query was skipped.
+func (t *WriteReadSeriesTest) runRangeQueryAndVerifyResult(ctx context.Context, now, start, end time.Time, resultsCacheEnabled bool, responseFormat string) (_ model.Matrix, err error) {
 	// We align start, end and step to write interval in order to avoid any false positives
 	// when checking results correctness. The min/max query time is always aligned.
 	start = maxTime(t.queryMinTime, alignTimestampToInterval(start, writeInterval))
 	end = minTime(t.queryMaxTime, alignTimestampToInterval(end, writeInterval))
 	if end.Before(start) {
-		return nil
+		return nil, nil
 	}
 
 	step := getQueryStep(start, end, writeInterval)
@@ -246,69 +730,145 @@ func (t *WriteReadSeriesTest) runRangeQueryAndVerifyResult(ctx context.Context,
 	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "WriteReadSeriesTest.runRangeQueryAndVerifyResult")
 	defer sp.Finish()
 
-	logger := log.With(sp, "query", queryMetricSum, "start", start.UnixMilli(), "end", end.UnixMilli(), "step", step, "results_cache", strconv.FormatBool(resultsCacheEnabled))
+	setQueryTraceAttributes(sp.Span, t.querySum, start, end, step, resultsCacheEnabled, responseFormat)
+	defer func() { _ = sp.Error(err) }()
+
+	logger := log.With(sp, "query", t.querySum, "start", start.UnixMilli(), "end", end.UnixMilli(), "step", step, "results_cache", strconv.FormatBool(resultsCacheEnabled), "response_format", responseFormat)
 	level.Debug(logger).Log("msg", "Running range query")
 
+	// The statistics of the queries served by the results cache don't account for the cached extents.
+	options := []RequestOption{WithResultsCacheEnabled(resultsCacheEnabled), WithResponseFormat(responseFormat)}
+	var stats *QueryStats
+	if t.cfg.QueryStatsCheckEnabled && !resultsCacheEnabled {
+		stats = &QueryStats{}
+		options = append(options, WithQueryStats(stats))
+	}
+
 	t.metrics.queriesTotal.Inc()
-	matrix, err := t.client.QueryRange(ctx, queryMetricSum, start, end, step, WithResultsCacheEnabled(resultsCacheEnabled))
+	queryStart := time.Now()
+	matrix, err := t.client.QueryRange(ctx, t.querySum, start, end, step, options...)
+	t.metrics.observeQueryDuration(queryTypeRange, resultsCacheEnabled, queryStart)
 	if err != nil {
 		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
 		level.Warn(logger).Log("msg", "Failed to execute range query", "err", err)
-		return errors.Wrap(err, "failed to execute range query")
+		return nil, errors.Wrap(err, "failed to execute range query")
 	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+	t.checkQueryLatencyBudget(logger, now.Sub(start), time.Since(queryStart))
 
+	setWaveResultTraceAttributes(sp.Span, matrix, t.sumWaveform, end, 1)
 	t.metrics.queryResultChecksTotal.Inc()
-	_, err = verifySineWaveSamplesSum(matrix, t.cfg.NumSeries, step)
+	err = t.verifyRangeQueryResult(matrix, start, end, step)
+	recordQueryResultCheck(ctx, end, err)
 	if err != nil {
 		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
 		level.Warn(logger).Log("msg", "Range query result check failed", "err", err)
-		return errors.Wrap(err, "range query result check failed")
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: t.querySum, Start: start, End: end, Step: step.String(), Error: err.Error()})
+
+		if t.cfg.BisectFailedRangesEnabled {
+			t.bisectFailedRange(ctx, logger, now, start, end, resultsCacheEnabled, responseFormat)
+		}
+		return matrix, errors.Wrap(err, "range query result check failed")
 	}
-	return nil
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+
+	// The fetched series are checked only when the query returned some series, because no series may have
+	// been written in the queried time range.
+	if stats != nil && len(matrix) > 0 {
+		if err := t.verifyQueryStats(*stats); err != nil {
+			level.Warn(logger).Log("msg", "Range query stats check failed", "err", err)
+			return matrix, errors.Wrap(err, "range query stats check failed")
+		}
+	}
+
+	if t.cfg.QueryShardingDifferentialEnabled && !resultsCacheEnabled {
+		return matrix, t.verifyQueryShardingConsistency(logger, matrix, func() (model.Matrix, error) {
+			return t.client.QueryRange(ctx, t.querySum, start, end, step, WithResultsCacheEnabled(false), WithQueryShardingEnabled(false), WithResponseFormat(responseFormat))
+		})
+	}
+	return matrix, nil
 }
 
-func (t *WriteReadSeriesTest) runInstantQueryAndVerifyResult(ctx context.Context, ts time.Time, resultsCacheEnabled bool) error {
+// verifyRangeQueryResult checks whether the input matrix is the expected result of a range query
+// from start to end with the input step.
+func (t *WriteReadSeriesTest) verifyRangeQueryResult(matrix model.Matrix, start, end time.Time, step time.Duration) error {
+	if t.onlyGapsAtSteps(start, end, step) {
+		// No sample has been written at any of the queried timestamps, so the result is expected to be empty.
+		if len(matrix) > 0 {
+			return fmt.Errorf("expected no series in the result because no sample was written in the queried time range because of gap injection, but got %d", len(matrix))
+		}
+		return nil
+	}
+
+	_, err := verifyWaveSamplesSumWithGaps(matrix, t.sumWaveform, 1, step, t.isGap)
+	return err
+}
+
+// runInstantQueryAndVerifyResult runs an instant query and verifies its result. The query result is returned
+// as a matrix if the query succeeded, even if the result check failed. Returns a nil result if the query was skipped.
+func (t *WriteReadSeriesTest) runInstantQueryAndVerifyResult(ctx context.Context, now, ts time.Time, resultsCacheEnabled bool, responseFormat string) (_ model.Matrix, err error) {
 	// We align the query timestamp to write interval in order to avoid any false positives
 	// when checking results correctness. The min/max query time is always aligned.
 	ts = maxTime(t.queryMinTime, alignTimestampToInterval(ts, writeInterval))
 	if t.queryMaxTime.Before(ts) {
-		return nil
+		return nil, nil
 	}
 
 	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "WriteReadSeriesTest.runInstantQueryAndVerifyResult")
 	defer sp.Finish()
 
-	logger := log.With(sp, "query", queryMetricSum, "ts", ts.UnixMilli(), "results_cache", strconv.FormatBool(resultsCacheEnabled))
+	setQueryTraceAttributes(sp.Span, t.querySum, ts, ts, 0, resultsCacheEnabled, responseFormat)
+	defer func() { _ = sp.Error(err) }()
+
+	logger := log.With(sp, "query", t.querySum, "ts", ts.UnixMilli(), "results_cache", strconv.FormatBool(resultsCacheEnabled), "response_format", responseFormat)
 	level.Debug(logger).Log("msg", "Running instant query")
 
 	t.metrics.queriesTotal.Inc()
-	vector, err := t.client.Query(ctx, queryMetricSum, ts, WithResultsCacheEnabled(resultsCacheEnabled))
+	start := time.Now()
+	vector, err := t.client.Query(ctx, t.querySum, ts, WithResultsCacheEnabled(resultsCacheEnabled), WithResponseFormat(responseFormat))
+	t.metrics.observeQueryDuration(queryTypeInstant, resultsCacheEnabled, start)
 	if err != nil {
 		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
 		level.Warn(logger).Log("msg", "Failed to execute instant query", "err", err)
-		return errors.Wrap(err, "failed to execute instant query")
+		return nil, errors.Wrap(err, "failed to execute instant query")
 	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+	t.checkQueryLatencyBudget(logger, now.Sub(ts), time.Since(start))
 
 	// Convert the vector to matrix to reuse the same results comparison utility.
-	matrix := make(model.Matrix, 0, len(vector))
-	for _, entry := range vector {
-		matrix = append(matrix, &model.SampleStream{
-			Metric: entry.Metric,
-			Values: []model.SamplePair{{
-				Timestamp: entry.Timestamp,
-				Value:     entry.Value,
-			}},
-		})
-	}
+	matrix := vectorToMatrix(vector)
 
 	t.metrics.queryResultChecksTotal.Inc()
-	_, err = verifySineWaveSamplesSum(matrix, t.cfg.NumSeries, 0)
+	if t.isGap(ts) {
+		// No sample has been written at the queried timestamp, so the result is expected to be empty.
+		setWaveResultTraceAttributes(sp.Span, matrix, t.sumWaveform, ts, 0)
+		if len(matrix) > 0 {
+			err = fmt.Errorf("expected no series in the result because no sample was written at the queried timestamp because of gap injection, but got %d", len(matrix))
+		}
+	} else {
+		setWaveResultTraceAttributes(sp.Span, matrix, t.sumWaveform, ts, 1)
+		_, err = verifyWaveSamplesSum(matrix, t.sumWaveform, 1, 0)
+	}
+	recordQueryResultCheck(ctx, ts, err)
 	if err != nil {
 		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
 		level.Warn(logger).Log("msg", "Instant query result check failed", "err", err)
-		return errors.Wrap(err, "instant query result check failed")
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: t.querySum, Start: ts, End: ts, Error: err.Error()})
+		return matrix, errors.Wrap(err, "instant query result check failed")
 	}
-	return nil
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+
+	if t.cfg.QueryShardingDifferentialEnabled && !resultsCacheEnabled {
+		return matrix, t.verifyQueryShardingConsistency(logger, matrix, func() (model.Matrix, error) {
+			vector, err := t.client.Query(ctx, t.querySum, ts, WithResultsCacheEnabled(false), WithQueryShardingEnabled(false), WithResponseFormat(responseFormat))
+			return vectorToMatrix(vector), err
+		})
+	}
+	return matrix, nil
 }
 
 func (t *WriteReadSeriesTest) nextWriteTimestamp(now time.Time) time.Time {
@@ -332,10 +892,10 @@ func (t *WriteReadSeriesTest) findPreviouslyWrittenTimeRange(ctx context.Context
 			return
 		}
 
-		logger := log.With(t.logger, "query", queryMetricSum, "start", start, "end", end, "step", step)
+		logger := log.With(t.logger, "query", t.querySum, "start", start, "end", end, "step", step)
 		level.Debug(logger).Log("msg", "Executing query to find previously written samples")
 
-		matrix, err := t.client.QueryRange(ctx, queryMetricSum, start, end, step, WithResultsCacheEnabled(false))
+		matrix, err := t.client.QueryRange(ctx, t.querySum, start, end, step, WithResultsCacheEnabled(false))
 		if err != nil {
 			level.Warn(logger).Log("msg", "Failed to execute range query used to find previously written samples", "err", err)
 			return
@@ -354,7 +914,7 @@ func (t *WriteReadSeriesTest) findPreviouslyWrittenTimeRange(ctx context.Context
 		samples = append(matrix[0].Values, samples...)
 		end = start.Add(-step)
 
-		lastMatchingIdx, _ := verifySineWaveSamplesSum(model.Matrix{{Values: samples}}, t.cfg.NumSeries, step)
+		lastMatchingIdx, _ := verifyWaveSamplesSumWithGaps(model.Matrix{{Values: samples}}, t.sumWaveform, 1, step, t.isGap)
 		if lastMatchingIdx == -1 {
 			return
 		}
@@ -365,8 +925,53 @@ func (t *WriteReadSeriesTest) findPreviouslyWrittenTimeRange(ctx context.Context
 
 		// If the last matching sample is not the one at the beginning of the queried time range
 		// then it means we've found the oldest previously written sample and we can stop searching it.
-		if lastMatchingIdx != 0 || !samples[0].Timestamp.Time().Equal(start) {
+		// Samples deliberately skipped because of gap injection at the beginning of the range are not missing.
+		if lastMatchingIdx != 0 || !t.onlyGapsInRange(start, samples[0].Timestamp.Time()) {
 			return
 		}
 	}
 }
+
+// setQueryTraceAttributes sets the tags describing a query to the span. The step is 0 for instant queries.
+func setQueryTraceAttributes(sp opentracing.Span, query string, start, end time.Time, step time.Duration, resultsCacheEnabled bool, responseFormat string) {
+	sp.SetTag("query", query)
+	sp.SetTag("start", start)
+	sp.SetTag("end", end)
+	if step > 0 {
+		sp.SetTag("step", step.String())
+	}
+	sp.SetTag("results_cache", resultsCacheEnabled)
+	sp.SetTag("response_format", responseFormat)
+}
+
+// setWaveResultTraceAttributes sets the tags comparing the expected and actual result of a query returning
+// the sum of the written series to the span. The values are compared at the input timestamp, which is
+// the end of range queries.
+func setWaveResultTraceAttributes(sp opentracing.Span, matrix model.Matrix, wave waveform, ts time.Time, expectedSeries int) {
+	sp.SetTag("expected_series", expectedSeries)
+	sp.SetTag("actual_series", len(matrix))
+	if expectedSeries > 0 {
+		sp.SetTag("expected_value", wave(ts)*float64(expectedSeries))
+	}
+	if len(matrix) == 1 {
+		for _, sample := range matrix[0].Values {
+			if sample.Timestamp.Time().Equal(ts) {
+				sp.SetTag("actual_value", float64(sample.Value))
+			}
+		}
+	}
+}
+
+func vectorToMatrix(vector model.Vector) model.Matrix {
+	matrix := make(model.Matrix, 0, len(vector))
+	for _, entry := range vector {
+		matrix = append(matrix, &model.SampleStream{
+			Metric: entry.Metric,
+			Values: []model.SamplePair{{
+				Timestamp: entry.Timestamp,
+				Value:     entry.Value,
+			}},
+		})
+	}
+	return matrix
+}
@@ -11,12 +11,18 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/grafana/dskit/flagext"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/tsdb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
 )
 
 func TestWriteReadSeriesTest_Run(t *testing.T) {
@@ -59,7 +65,7 @@ func TestWriteReadSeriesTest_Run(t *testing.T) {
 
 			# HELP mimir_continuous_test_queries_failed_total Total number of failed query requests.
 			# TYPE mimir_continuous_test_queries_failed_total counter
-			mimir_continuous_test_queries_failed_total{test="write-read-series"} 0
+			mimir_continuous_test_queries_failed_total{maintenance="false",test="write-read-series"} 0
 		`),
 			"mimir_continuous_test_writes_total", "mimir_continuous_test_writes_failed_total",
 			"mimir_continuous_test_queries_total", "mimir_continuous_test_queries_failed_total"))
@@ -99,7 +105,7 @@ func TestWriteReadSeriesTest_Run(t *testing.T) {
 
 			# HELP mimir_continuous_test_queries_failed_total Total number of failed query requests.
 			# TYPE mimir_continuous_test_queries_failed_total counter
-			mimir_continuous_test_queries_failed_total{test="write-read-series"} 0
+			mimir_continuous_test_queries_failed_total{maintenance="false",test="write-read-series"} 0
 		`),
 			"mimir_continuous_test_writes_total", "mimir_continuous_test_writes_failed_total",
 			"mimir_continuous_test_queries_total", "mimir_continuous_test_queries_failed_total"))
@@ -142,7 +148,7 @@ func TestWriteReadSeriesTest_Run(t *testing.T) {
 
 			# HELP mimir_continuous_test_queries_failed_total Total number of failed query requests.
 			# TYPE mimir_continuous_test_queries_failed_total counter
-			mimir_continuous_test_queries_failed_total{test="write-read-series"} 0
+			mimir_continuous_test_queries_failed_total{maintenance="false",test="write-read-series"} 0
 		`),
 			"mimir_continuous_test_writes_total", "mimir_continuous_test_writes_failed_total",
 			"mimir_continuous_test_queries_total", "mimir_continuous_test_queries_failed_total"))
@@ -171,7 +177,7 @@ func TestWriteReadSeriesTest_Run(t *testing.T) {
 
 			# HELP mimir_continuous_test_writes_failed_total Total number of failed write requests.
 			# TYPE mimir_continuous_test_writes_failed_total counter
-			mimir_continuous_test_writes_failed_total{status_code="0",test="write-read-series"} 1
+			mimir_continuous_test_writes_failed_total{maintenance="false",status_code="0",test="write-read-series"} 1
 
 			# HELP mimir_continuous_test_queries_total Total number of attempted query requests.
 			# TYPE mimir_continuous_test_queries_total counter
@@ -202,7 +208,7 @@ func TestWriteReadSeriesTest_Run(t *testing.T) {
 
 			# HELP mimir_continuous_test_writes_failed_total Total number of failed write requests.
 			# TYPE mimir_continuous_test_writes_failed_total counter
-			mimir_continuous_test_writes_failed_total{status_code="500",test="write-read-series"} 1
+			mimir_continuous_test_writes_failed_total{maintenance="false",status_code="500",test="write-read-series"} 1
 
 			# HELP mimir_continuous_test_queries_total Total number of attempted query requests.
 			# TYPE mimir_continuous_test_queries_total counter
@@ -236,7 +242,7 @@ func TestWriteReadSeriesTest_Run(t *testing.T) {
 
 			# HELP mimir_continuous_test_writes_failed_total Total number of failed write requests.
 			# TYPE mimir_continuous_test_writes_failed_total counter
-			mimir_continuous_test_writes_failed_total{status_code="400",test="write-read-series"} 3
+			mimir_continuous_test_writes_failed_total{maintenance="false",status_code="400",test="write-read-series"} 3
 
 			# HELP mimir_continuous_test_queries_total Total number of attempted query requests.
 			# TYPE mimir_continuous_test_queries_total counter
@@ -244,6 +250,25 @@ func TestWriteReadSeriesTest_Run(t *testing.T) {
 		`), "mimir_continuous_test_writes_total", "mimir_continuous_test_writes_failed_total", "mimir_continuous_test_queries_total"))
 	})
 
+	t.Run("should only write series and run no query in write-only mode", func(t *testing.T) {
+		cfg := cfg
+		cfg.WriteOnly = true
+
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+
+		test := NewWriteReadSeriesTest(cfg, client, logger, prometheus.NewPedanticRegistry())
+
+		test.lastWrittenTimestamp = time.Unix(0, 0)
+		now := time.Unix(0, 0).Add(3 * writeInterval)
+		require.NoError(t, test.Run(context.Background(), now))
+
+		client.AssertNumberOfCalls(t, "WriteSeries", 3)
+		client.AssertNotCalled(t, "QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		client.AssertNotCalled(t, "Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		assert.Equal(t, now, test.lastWrittenTimestamp)
+	})
+
 	t.Run("should query written series, compare results and track no failure if results match", func(t *testing.T) {
 		now := time.Unix(1000, 0)
 
@@ -283,7 +308,7 @@ func TestWriteReadSeriesTest_Run(t *testing.T) {
 
 			# HELP mimir_continuous_test_queries_failed_total Total number of failed query requests.
 			# TYPE mimir_continuous_test_queries_failed_total counter
-			mimir_continuous_test_queries_failed_total{test="write-read-series"} 0
+			mimir_continuous_test_queries_failed_total{maintenance="false",test="write-read-series"} 0
 
 			# HELP mimir_continuous_test_query_result_checks_total Total number of query results checked for correctness.
 			# TYPE mimir_continuous_test_query_result_checks_total counter
@@ -291,7 +316,7 @@ func TestWriteReadSeriesTest_Run(t *testing.T) {
 
 			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
 			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
-			mimir_continuous_test_query_result_checks_failed_total{test="write-read-series"} 0
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="write-read-series"} 0
 		`),
 			"mimir_continuous_test_writes_total", "mimir_continuous_test_writes_failed_total",
 			"mimir_continuous_test_queries_total", "mimir_continuous_test_queries_failed_total",
@@ -338,7 +363,7 @@ func TestWriteReadSeriesTest_Run(t *testing.T) {
 
 			# HELP mimir_continuous_test_queries_failed_total Total number of failed query requests.
 			# TYPE mimir_continuous_test_queries_failed_total counter
-			mimir_continuous_test_queries_failed_total{test="write-read-series"} 0
+			mimir_continuous_test_queries_failed_total{maintenance="false",test="write-read-series"} 0
 
 			# HELP mimir_continuous_test_query_result_checks_total Total number of query results checked for correctness.
 			# TYPE mimir_continuous_test_query_result_checks_total counter
@@ -346,12 +371,536 @@ func TestWriteReadSeriesTest_Run(t *testing.T) {
 
 			# HELP mimir_continuous_test_query_result_checks_failed_total Total number of query results failed when checking for correctness.
 			# TYPE mimir_continuous_test_query_result_checks_failed_total counter
-			mimir_continuous_test_query_result_checks_failed_total{test="write-read-series"} 8
+			mimir_continuous_test_query_result_checks_failed_total{maintenance="false",test="write-read-series"} 8
 		`),
 			"mimir_continuous_test_writes_total", "mimir_continuous_test_writes_failed_total",
 			"mimir_continuous_test_queries_total", "mimir_continuous_test_queries_failed_total",
 			"mimir_continuous_test_query_result_checks_total", "mimir_continuous_test_query_result_checks_failed_total"))
 	})
+
+	t.Run("should track failures with the maintenance label during maintenance windows", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(500, errors.New("failed"))
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewWriteReadSeriesTest(cfg, client, logger, reg)
+
+		_ = test.Run(contextWithMaintenanceState(context.Background(), maintenanceTracked), now)
+		_ = test.Run(context.Background(), now)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_writes_failed_total Total number of failed write requests.
+			# TYPE mimir_continuous_test_writes_failed_total counter
+			mimir_continuous_test_writes_failed_total{maintenance="false",status_code="500",test="write-read-series"} 1
+			mimir_continuous_test_writes_failed_total{maintenance="true",status_code="500",test="write-read-series"} 1
+		`), "mimir_continuous_test_writes_failed_total"))
+	})
+
+	t.Run("should not track failures during maintenance windows if failures are suppressed", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(500, errors.New("failed"))
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewWriteReadSeriesTest(cfg, client, logger, reg)
+
+		_ = test.Run(contextWithMaintenanceState(context.Background(), maintenanceSuppressed), now)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP mimir_continuous_test_writes_total Total number of attempted write requests.
+			# TYPE mimir_continuous_test_writes_total counter
+			mimir_continuous_test_writes_total{test="write-read-series"} 1
+		`), "mimir_continuous_test_writes_total", "mimir_continuous_test_writes_failed_total"))
+	})
+
+	t.Run("should alternate the configured query response formats across runs", func(t *testing.T) {
+		cfg := cfg
+		cfg.QueryResponseFormats = []string{responseFormatJSON, responseFormatProtobuf}
+
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{}, nil)
+
+		test := NewWriteReadSeriesTest(cfg, client, logger, prometheus.NewPedanticRegistry())
+
+		var actualFormats []string
+		for _, now := range []time.Time{time.Unix(1000, 0), time.Unix(1020, 0), time.Unix(1040, 0)} {
+			client.Calls = nil
+
+			// Ignore this error. It will be non-nil because the query mock does not return any data.
+			_ = test.Run(context.Background(), now)
+
+			for _, call := range client.Calls {
+				if call.Method != "QueryRange" && call.Method != "Query" {
+					continue
+				}
+
+				options := &requestOptions{}
+				for _, option := range call.Arguments.Get(len(call.Arguments) - 1).([]RequestOption) {
+					option(options)
+				}
+				actualFormats = append(actualFormats, options.responseFormat)
+			}
+			actualFormats = append(actualFormats, "--")
+		}
+
+		assert.Equal(t, []string{
+			"json", "json", "json", "json", "json", "json", "json", "json", "--",
+			"protobuf", "protobuf", "protobuf", "protobuf", "protobuf", "protobuf", "protobuf", "protobuf", "--",
+			"json", "json", "json", "json", "json", "json", "json", "json", "--",
+		}, actualFormats)
+	})
+
+	t.Run("should rotate a fraction of the series every churn interval", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{}, nil)
+
+		churnCfg := cfg
+		churnCfg.ChurnInterval = time.Minute
+		churnCfg.ChurnFraction = 0.5
+
+		test := NewWriteReadSeriesTest(churnCfg, client, logger, prometheus.NewPedanticRegistry())
+
+		// Ignore the errors. They will be non-nil because the query mock does not return any data.
+		_ = test.Run(context.Background(), time.Unix(1000, 0))
+		_ = test.Run(context.Background(), time.Unix(1020, 0))
+
+		client.AssertNumberOfCalls(t, "WriteSeries", 2)
+		client.AssertCalled(t, "WriteSeries", mock.Anything, generateWaveSeriesWithChurn(metricName, time.Unix(1000, 0), 2, generateSineWaveValue, time.Minute, 0.5))
+		client.AssertCalled(t, "WriteSeries", mock.Anything, generateWaveSeriesWithChurn(metricName, time.Unix(1020, 0), 2, generateSineWaveValue, time.Minute, 0.5))
+
+		// The second series has been rotated, because the two writes are in different churn intervals.
+		var actualSeriesIDs [][]string
+		for _, call := range client.Calls {
+			if call.Method != "WriteSeries" {
+				continue
+			}
+
+			var ids []string
+			for _, series := range call.Arguments.Get(1).([]prompb.TimeSeries) {
+				ids = append(ids, series.Labels[1].Value)
+			}
+			actualSeriesIDs = append(actualSeriesIDs, ids)
+		}
+		assert.Equal(t, [][]string{{"0", "17"}, {"0", "18"}}, actualSeriesIDs)
+	})
+
+	t.Run("should track the duration of write and query requests", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{}, nil)
+
+		reg := prometheus.NewPedanticRegistry()
+		test := NewWriteReadSeriesTest(cfg, client, logger, reg)
+
+		// Ignore this error. It will be non-nil because the query mock does not return any data.
+		_ = test.Run(context.Background(), time.Unix(1000, 0))
+
+		assert.Equal(t, map[string]uint64{
+			"test=write-read-series": 1,
+		}, histogramSampleCounts(t, reg, "mimir_continuous_test_writes_request_duration_seconds"))
+		assert.Equal(t, map[string]uint64{
+			"results_cache=false,test=write-read-series,type=instant": 2,
+			"results_cache=false,test=write-read-series,type=range":   2,
+			"results_cache=true,test=write-read-series,type=instant":  2,
+			"results_cache=true,test=write-read-series,type=range":    2,
+		}, histogramSampleCounts(t, reg, "mimir_continuous_test_queries_request_duration_seconds"))
+	})
+
+	t.Run("should trace each write batch and verification query with the expected and actual results", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+
+		client := &ClientMock{}
+		client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil)
+		client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{{Value: 1, Timestamp: model.TimeFromUnix(now.Unix())}}, nil)
+
+		reporter := jaeger.NewInMemoryReporter()
+		installTestTracer(t, reporter)
+
+		test := NewWriteReadSeriesTest(cfg, client, logger, prometheus.NewPedanticRegistry())
+		root, ctx := spanlogger.NewWithLogger(context.Background(), logger, "run")
+
+		// Ignore this error. It will be non-nil because the query mock does not return the expected data.
+		_ = test.Run(ctx, now)
+		root.Finish()
+
+		spansByName := map[string][]*jaeger.Span{}
+		for _, span := range reporter.GetSpans() {
+			span := span.(*jaeger.Span)
+			spansByName[span.OperationName()] = append(spansByName[span.OperationName()], span)
+		}
+
+		// The write batch is a child of the span writing the samples.
+		require.Len(t, spansByName["WriteReadSeriesTest.writeSamples"], 1)
+		require.Len(t, spansByName["WriteReadSeriesTest.writeBatch"], 1)
+		write := spansByName["WriteReadSeriesTest.writeBatch"][0]
+		assert.Equal(t, root.Span.Context().(jaeger.SpanContext).TraceID(), write.SpanContext().TraceID())
+		assert.Equal(t, spansByName["WriteReadSeriesTest.writeSamples"][0].SpanContext().SpanID(), write.SpanContext().ParentID())
+		assert.NotContains(t, write.Tags(), string(ext.Error))
+		assert.Equal(t, 2, write.Tags()["batch_series"])
+		assert.Equal(t, 200, write.Tags()["status_code"])
+
+		require.Len(t, spansByName["WriteReadSeriesTest.runRangeQueryAndVerifyResult"], 4)
+		for _, span := range spansByName["WriteReadSeriesTest.runRangeQueryAndVerifyResult"] {
+			tags := span.Tags()
+			assert.Equal(t, true, tags[string(ext.Error)])
+			assert.Equal(t, "sum(max_over_time(mimir_continuous_test_sine_wave[1s]))", tags["query"])
+			assert.Equal(t, 1, tags["expected_series"])
+			assert.Equal(t, 0, tags["actual_series"])
+			assert.NotContains(t, tags, "actual_value")
+		}
+
+		require.Len(t, spansByName["WriteReadSeriesTest.runInstantQueryAndVerifyResult"], 4)
+		for _, span := range spansByName["WriteReadSeriesTest.runInstantQueryAndVerifyResult"] {
+			tags := span.Tags()
+			assert.Equal(t, true, tags[string(ext.Error)])
+			assert.Equal(t, 1, tags["actual_series"])
+			assert.Equal(t, 2*generateSineWaveValue(now), tags["expected_value"])
+			assert.Equal(t, 1.0, tags["actual_value"])
+		}
+	})
+}
+
+func queryShardingDisabled(options []RequestOption) bool {
+	actual := &requestOptions{}
+	for _, option := range options {
+		option(actual)
+	}
+	return actual.queryShardingDisabled
+}
+
+func resultsCacheDisabled(options []RequestOption) bool {
+	actual := &requestOptions{}
+	for _, option := range options {
+		option(actual)
+	}
+	return actual.resultsCacheDisabled
+}
+
+func countQueryCallsWithShardingDisabled(client *ClientMock) int {
+	count := 0
+	for _, call := range client.Calls {
+		if call.Method != "QueryRange" && call.Method != "Query" {
+			continue
+		}
+		if queryShardingDisabled(call.Arguments.Get(len(call.Arguments) - 1).([]RequestOption)) {
+			count++
+		}
+	}
+	return count
+}
+
+// missingSampleClient is a ClientMock whose range queries return the sum of the sine wave series,
+// except for the sample at the missing timestamp.
+type missingSampleClient struct {
+	ClientMock
+
+	numSeries int
+	missing   time.Time
+}
+
+func (c *missingSampleClient) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration, options ...RequestOption) (model.Matrix, error) {
+	c.Called(ctx, query, start, end, step, options)
+
+	var values []model.SamplePair
+	for ts := start; !ts.After(end); ts = ts.Add(step) {
+		if !ts.Equal(c.missing) {
+			values = append(values, newSamplePair(ts, generateSineWaveValue(ts)*float64(c.numSeries)))
+		}
+	}
+	return model.Matrix{{Values: values}}, nil
+}
+
+func TestWriteReadSeriesTest_Run_Waveform(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+	cfg.Waveform = waveformSquare
+
+	now := time.Unix(1000, 0)
+	const query = "sum(max_over_time(mimir_continuous_test_square_wave[1s]))"
+
+	client := &ClientMock{}
+	client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+	client.On("QueryRange", mock.Anything, query, now, now, writeInterval, mock.Anything).Return(model.Matrix{{Values: []model.SamplePair{newSamplePair(now, 2*generateSquareWaveValue(now))}}}, nil)
+	client.On("Query", mock.Anything, query, now, mock.Anything).Return(model.Vector{{Timestamp: model.Time(now.UnixMilli()), Value: model.SampleValue(2 * generateSquareWaveValue(now))}}, nil)
+
+	test := NewWriteReadSeriesTest(cfg, client, log.NewNopLogger(), nil)
+	require.NoError(t, test.Run(context.Background(), now))
+
+	client.AssertCalled(t, "WriteSeries", mock.Anything, generateWaveSeriesWithChurn("mimir_continuous_test_square_wave", now, 2, generateSquareWaveValue, 0, 0))
+	client.AssertNumberOfCalls(t, "QueryRange", 4)
+	client.AssertNumberOfCalls(t, "Query", 4)
+}
+
+func TestWriteReadSeriesTest_Run_WriteBatches(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 5
+	cfg.WriteBatchSize = 2
+
+	now := time.Unix(1000, 0)
+	series := generateSineWaveSeries(metricName, now, 5)
+
+	// withFirstSeriesID matches the write request whose first series has the input series_id.
+	withFirstSeriesID := func(id string) interface{} {
+		return mock.MatchedBy(func(series []prompb.TimeSeries) bool { return series[0].Labels[1].Value == id })
+	}
+
+	for name, tc := range map[string]struct {
+		secondBatchStatusCode int
+		secondBatchErr        error
+		expectedErr           bool
+		expectedQueryMaxTime  time.Time
+		expectedLastWritten   time.Time
+		expectedPartialWrites int
+	}{
+		"all batches succeed": {
+			secondBatchStatusCode: 200,
+			expectedQueryMaxTime:  now,
+			expectedLastWritten:   now,
+		},
+		"a batch fails with 5xx error": {
+			secondBatchStatusCode: 500,
+			secondBatchErr:        errors.New("500 error"),
+			expectedErr:           true,
+			expectedPartialWrites: 1,
+		},
+		"a batch fails with 4xx error": {
+			secondBatchStatusCode: 400,
+			secondBatchErr:        errors.New("400 error"),
+			expectedLastWritten:   now,
+			expectedPartialWrites: 1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := &ClientMock{}
+			client.On("WriteSeries", mock.Anything, withFirstSeriesID("2")).Return(tc.secondBatchStatusCode, tc.secondBatchErr)
+			client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+			client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil)
+			client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Vector{}, nil)
+
+			reg := prometheus.NewPedanticRegistry()
+			test := NewWriteReadSeriesTest(cfg, client, log.NewNopLogger(), reg)
+
+			err := test.Run(context.Background(), now)
+			if tc.expectedErr {
+				require.Error(t, err)
+			}
+
+			client.AssertNumberOfCalls(t, "WriteSeries", 3)
+			client.AssertCalled(t, "WriteSeries", mock.Anything, series[0:2])
+			client.AssertCalled(t, "WriteSeries", mock.Anything, series[2:4])
+			client.AssertCalled(t, "WriteSeries", mock.Anything, series[4:5])
+
+			assert.Equal(t, tc.expectedLastWritten, test.lastWrittenTimestamp)
+			assert.Equal(t, tc.expectedQueryMaxTime, test.queryMaxTime)
+			assert.Equal(t, float64(3), testutil.ToFloat64(test.metrics.writesTotal))
+			assert.Equal(t, float64(tc.expectedPartialWrites), testutil.ToFloat64(test.partialWritesTotal))
+		})
+	}
+}
+
+// numSeriesClient is a ClientMock whose queries return the sum of the sine wave series, where the number
+// of summed series at each timestamp is given by numSeriesAt.
+type numSeriesClient struct {
+	ClientMock
+
+	numSeriesAt func(time.Time) int
+}
+
+func (c *numSeriesClient) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration, options ...RequestOption) (model.Matrix, error) {
+	c.Called(ctx, query, start, end, step, options)
+
+	var values []model.SamplePair
+	for ts := start; !ts.After(end); ts = ts.Add(step) {
+		values = append(values, newSamplePair(ts, generateSineWaveValue(ts)*float64(c.numSeriesAt(ts))))
+	}
+	return model.Matrix{{Values: values}}, nil
+}
+
+func (c *numSeriesClient) Query(ctx context.Context, query string, ts time.Time, options ...RequestOption) (model.Vector, error) {
+	c.Called(ctx, query, ts, options)
+
+	return model.Vector{{Timestamp: model.Time(ts.UnixMilli()), Value: model.SampleValue(generateSineWaveValue(ts) * float64(c.numSeriesAt(ts)))}}, nil
+}
+
+func TestWriteReadSeriesTest_Run_RampSchedule(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	require.NoError(t, cfg.RampSchedule.Set("1m=2,1m=5"))
+
+	// The ramp schedule has a period of 2m: 5 series are written at 1040 and 1060, and 2 series at 1080.
+	now := time.Unix(1080, 0)
+	lastWritten := time.Unix(1020, 0)
+
+	for name, tc := range map[string]struct {
+		numSeriesAt         func(time.Time) int
+		expectedCheckFailed bool
+	}{
+		"query results follow the ramp schedule": {
+			numSeriesAt: cfg.RampSchedule.numSeriesAt,
+		},
+		"query results don't follow the ramp schedule": {
+			numSeriesAt:         func(time.Time) int { return 2 },
+			expectedCheckFailed: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := &numSeriesClient{numSeriesAt: tc.numSeriesAt}
+			client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+			client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			client.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+			test := NewWriteReadSeriesTest(cfg, client, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+			test.lastWrittenTimestamp = lastWritten
+			test.queryMinTime = lastWritten
+			test.queryMaxTime = lastWritten
+
+			err := test.Run(context.Background(), now)
+			if tc.expectedCheckFailed {
+				require.Error(t, err)
+				assert.NotZero(t, testutil.ToFloat64(test.metrics.queryResultChecksFailedTotal))
+			} else {
+				require.NoError(t, err)
+				assert.Zero(t, testutil.ToFloat64(test.metrics.queryResultChecksFailedTotal))
+			}
+
+			client.AssertNumberOfCalls(t, "WriteSeries", 3)
+			client.AssertCalled(t, "WriteSeries", mock.Anything, generateSineWaveSeries(metricName, time.Unix(1040, 0), 5))
+			client.AssertCalled(t, "WriteSeries", mock.Anything, generateSineWaveSeries(metricName, time.Unix(1060, 0), 5))
+			client.AssertCalled(t, "WriteSeries", mock.Anything, generateSineWaveSeries(metricName, time.Unix(1080, 0), 2))
+			assert.Equal(t, float64(2), testutil.ToFloat64(test.writtenSeries))
+		})
+	}
+}
+
+// queryStatsClient is a numSeriesClient whose range queries return the input query statistics.
+type queryStatsClient struct {
+	numSeriesClient
+
+	stats QueryStats
+
+	// requested and requestedWithResultsCache count the range queries the statistics have been requested for.
+	requested                 int
+	requestedWithResultsCache int
+}
+
+func (c *queryStatsClient) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration, options ...RequestOption) (model.Matrix, error) {
+	opts := &requestOptions{}
+	for _, o := range options {
+		o(opts)
+	}
+	if opts.queryStats != nil {
+		*opts.queryStats = c.stats
+		c.requested++
+		if !opts.resultsCacheDisabled {
+			c.requestedWithResultsCache++
+		}
+	}
+
+	return c.numSeriesClient.QueryRange(ctx, query, start, end, step, options...)
+}
+
+func TestWriteReadSeriesTestConfig_Validate(t *testing.T) {
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.QueryResponseFormats = []string{responseFormatJSON, responseFormatProtobuf}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.QueryResponseFormats = []string{"xml"}
+	assert.Error(t, cfg.Validate())
+
+	cfg.QueryResponseFormats = nil
+	assert.Error(t, cfg.Validate())
+
+	cfg.QueryResponseFormats = []string{responseFormatJSON}
+	cfg.ChurnInterval = time.Hour
+	cfg.ChurnFraction = 0.5
+	assert.NoError(t, cfg.Validate())
+
+	cfg.ChurnFraction = 1.5
+	assert.Error(t, cfg.Validate())
+
+	cfg.ChurnFraction = 0.5
+	cfg.ChurnInterval = -time.Hour
+	assert.Error(t, cfg.Validate())
+
+	cfg.ChurnInterval = time.Hour
+	cfg.NumExtraLabels = 10
+	cfg.ExtraLabelValueSize = 64
+	assert.NoError(t, cfg.Validate())
+
+	cfg.NumExtraLabels = -1
+	assert.Error(t, cfg.Validate())
+
+	cfg.NumExtraLabels = 10
+	cfg.ExtraLabelValueSize = -1
+	assert.Error(t, cfg.Validate())
+
+	cfg.ExtraLabelValueSize = 64
+	cfg.BackfillPeriod = 7 * 24 * time.Hour
+	assert.NoError(t, cfg.Validate())
+
+	cfg.BackfillPeriod = -time.Hour
+	assert.Error(t, cfg.Validate())
+
+	cfg.BackfillPeriod = 0
+	cfg.OldBlocksWindowStartAge = 26 * time.Hour
+	assert.NoError(t, cfg.Validate())
+
+	cfg.OldBlocksWindowStartAge = 25 * time.Hour
+	assert.Error(t, cfg.Validate())
+
+	cfg.OldBlocksWindowStartAge = -time.Hour
+	assert.Error(t, cfg.Validate())
+
+	cfg.OldBlocksWindowStartAge = 0
+	cfg.Waveform = waveformSawtooth
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Waveform = "triangle"
+	assert.Error(t, cfg.Validate())
+
+	cfg.Waveform = waveformSine
+	cfg.WriteBatchSize = 1000
+	assert.NoError(t, cfg.Validate())
+
+	cfg.WriteBatchSize = -1
+	assert.Error(t, cfg.Validate())
+
+	cfg.WriteBatchSize = 1000
+	cfg.WriteConcurrency = 0
+	assert.Error(t, cfg.Validate())
+
+	cfg.WriteConcurrency = 4
+	cfg.WriteOnly = true
+	assert.NoError(t, cfg.Validate())
+
+	cfg.ReadYourWritesEnabled = true
+	assert.Error(t, cfg.Validate())
+
+	cfg.ReadYourWritesEnabled = false
+	cfg.ChurnInterval = 0
+	cfg.QueryStatsCheckEnabled = true
+	assert.NoError(t, cfg.Validate())
+
+	cfg.ChurnInterval = time.Hour
+	assert.Error(t, cfg.Validate())
+
+	cfg.ChurnInterval = 0
+	require.NoError(t, cfg.RampSchedule.Set("1h=10"))
+	assert.Error(t, cfg.Validate())
 }
 
 func TestWriteReadSeriesTest_Init(t *testing.T) {
@@ -378,6 +927,19 @@ func TestWriteReadSeriesTest_Init(t *testing.T) {
 		require.Zero(t, test.queryMaxTime)
 	})
 
+	t.Run("should not look for previously written samples in write-only mode", func(t *testing.T) {
+		cfg := cfg
+		cfg.WriteOnly = true
+
+		client := &ClientMock{}
+		test := NewWriteReadSeriesTest(cfg, client, logger, nil)
+
+		require.NoError(t, test.Init(context.Background(), now))
+
+		client.AssertNotCalled(t, "QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		require.Zero(t, test.lastWrittenTimestamp)
+	})
+
 	t.Run("previously written data points are in the range [-2h, -1m]", func(t *testing.T) {
 		client := &ClientMock{}
 		client.On("QueryRange", mock.Anything, "sum(max_over_time(mimir_continuous_test_sine_wave[1s]))", now.Add(-24*time.Hour).Add(writeInterval), now, writeInterval, mock.Anything).Return(model.Matrix{{
@@ -610,6 +1172,104 @@ func TestWriteReadSeriesTest_Init(t *testing.T) {
 	})
 }
 
+func TestWriteReadSeriesTest_Init_Backfill(t *testing.T) {
+	logger := log.NewNopLogger()
+	cfg := WriteReadSeriesTestConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.NumSeries = 2
+	cfg.MaxQueryAge = 3 * 24 * time.Hour
+	cfg.BackfillPeriod = 150 * time.Minute
+
+	now := time.Unix(10*86400, 0).Add(10 * time.Second)
+
+	newClient := func(uploadedBlocks *[]tsdb.BlockMeta) *ClientMock {
+		client := &ClientMock{}
+		client.On("UploadBlock", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			// Read the block meta while the block directory still exists.
+			b, err := tsdb.OpenBlock(logger, args.String(1), nil)
+			require.NoError(t, err)
+			*uploadedBlocks = append(*uploadedBlocks, b.Meta())
+			require.NoError(t, b.Close())
+		}).Return(nil)
+		return client
+	}
+
+	t.Run("should backfill the series up until the first timestamp to write if no previously written samples found", func(t *testing.T) {
+		var uploadedBlocks []tsdb.BlockMeta
+		client := newClient(&uploadedBlocks)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil)
+
+		test := NewWriteReadSeriesTest(cfg, client, logger, nil)
+		require.NoError(t, test.Init(context.Background(), now))
+
+		// The backfilled time range is split into blocks aligned to the block range.
+		expectedStart := now.Add(-cfg.BackfillPeriod).Add(-10 * time.Second)
+		expectedEnd := now.Add(-10 * time.Second)
+		require.Len(t, uploadedBlocks, 3)
+		assert.Equal(t, expectedStart.UnixMilli(), uploadedBlocks[0].MinTime)
+		assert.Equal(t, expectedStart.Add(30*time.Minute).Add(-writeInterval).UnixMilli()+1, uploadedBlocks[0].MaxTime)
+		assert.Equal(t, expectedStart.Add(30*time.Minute).UnixMilli(), uploadedBlocks[1].MinTime)
+		assert.Equal(t, expectedStart.Add(90*time.Minute).UnixMilli(), uploadedBlocks[2].MinTime)
+		assert.Equal(t, expectedEnd.Add(-writeInterval).UnixMilli()+1, uploadedBlocks[2].MaxTime)
+
+		var numSamples uint64
+		for _, meta := range uploadedBlocks {
+			numSamples += meta.Stats.NumSamples
+		}
+		assert.Equal(t, uint64(cfg.NumSeries)*uint64(cfg.BackfillPeriod/writeInterval), numSamples)
+
+		// The test continues writing right after the last backfilled sample.
+		assert.Equal(t, expectedEnd.Add(-writeInterval), test.lastWrittenTimestamp)
+		assert.Equal(t, expectedStart, test.queryMinTime)
+		assert.Equal(t, expectedEnd.Add(-writeInterval), test.queryMaxTime)
+		assert.Equal(t, expectedEnd, test.nextWriteTimestamp(now))
+	})
+
+	t.Run("should backfill the series up until the oldest previously written sample", func(t *testing.T) {
+		var uploadedBlocks []tsdb.BlockMeta
+		client := newClient(&uploadedBlocks)
+		aligned := alignTimestampToInterval(now, writeInterval)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{{
+			Values: generateSineWaveSamplesSum(aligned.Add(-time.Hour), aligned.Add(-time.Minute), cfg.NumSeries, writeInterval),
+		}}, nil)
+
+		test := NewWriteReadSeriesTest(cfg, client, logger, nil)
+		require.NoError(t, test.Init(context.Background(), now))
+
+		require.Len(t, uploadedBlocks, 2)
+		assert.Equal(t, aligned.Add(-time.Hour).Add(-writeInterval).UnixMilli()+1, uploadedBlocks[1].MaxTime)
+
+		assert.Equal(t, aligned.Add(-time.Minute), test.lastWrittenTimestamp)
+		assert.Equal(t, now.Add(-cfg.BackfillPeriod).Add(-10*time.Second), test.queryMinTime)
+		assert.Equal(t, aligned.Add(-time.Minute), test.queryMaxTime)
+	})
+
+	t.Run("should not backfill if the backfill period is covered by previously written samples", func(t *testing.T) {
+		var uploadedBlocks []tsdb.BlockMeta
+		client := newClient(&uploadedBlocks)
+		aligned := alignTimestampToInterval(now, writeInterval)
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{{
+			Values: generateSineWaveSamplesSum(aligned.Add(-3*time.Hour), aligned.Add(-time.Minute), cfg.NumSeries, writeInterval),
+		}}, nil)
+
+		test := NewWriteReadSeriesTest(cfg, client, logger, nil)
+		require.NoError(t, test.Init(context.Background(), now))
+
+		client.AssertNotCalled(t, "UploadBlock", mock.Anything, mock.Anything)
+		assert.Equal(t, aligned.Add(-3*time.Hour), test.queryMinTime)
+	})
+
+	t.Run("should fail if a block upload fails", func(t *testing.T) {
+		client := &ClientMock{}
+		client.On("QueryRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(model.Matrix{}, nil)
+		client.On("UploadBlock", mock.Anything, mock.Anything).Return(errors.New("block upload is disabled"))
+
+		test := NewWriteReadSeriesTest(cfg, client, logger, nil)
+		require.Error(t, test.Init(context.Background(), now))
+		client.AssertNumberOfCalls(t, "UploadBlock", 1)
+	})
+}
+
 func TestWriteReadSeriesTest_getRangeQueryTimeRanges(t *testing.T) {
 	cfg := WriteReadSeriesTestConfig{}
 	flagext.DefaultValues(&cfg)
@@ -761,4 +1421,60 @@ func TestWriteReadSeriesTest_getRangeQueryTimeRanges(t *testing.T) {
 		require.GreaterOrEqual(t, actualInstants[len(actualInstants)-1].Unix(), test.queryMinTime.Unix())
 		require.LessOrEqual(t, actualInstants[len(actualInstants)-1].Unix(), test.queryMaxTime.Unix())
 	})
+
+	t.Run("old blocks window is enabled and covered by the min and max query time", func(t *testing.T) {
+		cfg := cfg
+		cfg.OldBlocksWindowStartAge = 26 * time.Hour
+		cfg.OldBlocksWindowEndAge = 25 * time.Hour
+
+		test := NewWriteReadSeriesTest(cfg, &ClientMock{}, log.NewNopLogger(), nil)
+		test.queryMinTime = now.Add(-30 * time.Hour)
+		test.queryMaxTime = now.Add(-time.Minute)
+
+		actualRanges, actualInstants, err := test.getQueryTimeRanges(now)
+		require.NoError(t, err)
+		require.Len(t, actualRanges, 5)
+		require.Equal(t, [2]time.Time{now.Add(-26 * time.Hour), now.Add(-25 * time.Hour)}, actualRanges[3]) // Old blocks window.
+
+		require.Len(t, actualInstants, 4)
+		require.Equal(t, now.Add(-25*time.Hour), actualInstants[2]) // Old blocks window.
+	})
+
+	t.Run("old blocks window is enabled but not covered by the min query time", func(t *testing.T) {
+		cfg := cfg
+		cfg.OldBlocksWindowStartAge = 26 * time.Hour
+		cfg.OldBlocksWindowEndAge = 25 * time.Hour
+
+		test := NewWriteReadSeriesTest(cfg, &ClientMock{}, log.NewNopLogger(), nil)
+		test.queryMinTime = now.Add(-25*time.Hour - 30*time.Minute)
+		test.queryMaxTime = now.Add(-time.Minute)
+
+		actualRanges, actualInstants, err := test.getQueryTimeRanges(now)
+		require.NoError(t, err)
+		require.Len(t, actualRanges, 4)
+		require.Len(t, actualInstants, 3)
+	})
+}
+
+// histogramSampleCounts returns the number of observations of the histogram with the input name, by labels
+// formatted as comma-separated name=value pairs.
+func histogramSampleCounts(t *testing.T, reg prometheus.Gatherer, name string) map[string]uint64 {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	counts := map[string]uint64{}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			var pairs []string
+			for _, label := range metric.GetLabel() {
+				pairs = append(pairs, label.GetName()+"="+label.GetValue())
+			}
+			counts[strings.Join(pairs, ",")] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	return counts
 }
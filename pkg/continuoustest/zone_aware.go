@@ -0,0 +1,325 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	// zoneAwareMetricName is the name of the marker metric written through each zone. The value of each
+	// sample is its timestamp in seconds, so that a stale sample can't be mistaken for the written one.
+	zoneAwareMetricName = "mimir_continuous_test_zone_marker"
+	zoneAwareZoneLabel  = "zone"
+)
+
+type ZoneAwareTestConfig struct {
+	Enabled        bool
+	Zones          flagext.StringSliceCSV
+	ZoneHeader     string
+	WriteEndpoints ZoneEndpoints
+	ReadEndpoints  ZoneEndpoints
+}
+
+func (cfg *ZoneAwareTestConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tests.zone-aware-test.enabled", false, "Enable the test which periodically writes a marker series through each of the configured zones, and queries it back through the same zone, to detect the degradation of a single zone. The requests are pinned to a zone by the header configured by -tests.zone-aware-test.zone-header, by the per-zone endpoints, or both.")
+	f.Var(&cfg.Zones, "tests.zone-aware-test.zones", "Comma-separated list of the zones to probe.")
+	f.StringVar(&cfg.ZoneHeader, "tests.zone-aware-test.zone-header", "", "The name of the HTTP header set to the zone name on each request, to route the requests to the zone. No header is set if empty.")
+	f.Var(&cfg.WriteEndpoints, "tests.zone-aware-test.write-endpoints", "Comma-separated list of per-zone base endpoints on the write path, in the format <zone>=<endpoint>. The zones not listed are written through -tests.write-endpoint.")
+	f.Var(&cfg.ReadEndpoints, "tests.zone-aware-test.read-endpoints", "Comma-separated list of per-zone base endpoints on the read path, in the format <zone>=<endpoint>. The zones not listed are queried through -tests.read-endpoint.")
+}
+
+func (cfg *ZoneAwareTestConfig) Validate() error {
+	if len(cfg.Zones) == 0 {
+		return errors.New("at least one zone must be configured for the zone-aware test")
+	}
+
+	zones := map[string]struct{}{}
+	for _, zone := range cfg.Zones {
+		if zone == "" {
+			return errors.New("the zones of the zone-aware test must not be empty")
+		}
+		if _, ok := zones[zone]; ok {
+			return fmt.Errorf("the zone %q of the zone-aware test has been configured more than once", zone)
+		}
+		zones[zone] = struct{}{}
+
+		// A zone whose requests can't be routed to it would be probed through any zone.
+		if cfg.ZoneHeader == "" && cfg.WriteEndpoints[zone] == nil && cfg.ReadEndpoints[zone] == nil {
+			return fmt.Errorf("the zone %q of the zone-aware test has no endpoint configured, and the zone header is not set", zone)
+		}
+	}
+
+	for _, endpoints := range []ZoneEndpoints{cfg.WriteEndpoints, cfg.ReadEndpoints} {
+		for zone := range endpoints {
+			if _, ok := zones[zone]; !ok {
+				return fmt.Errorf("an endpoint has been configured for the zone %q, which is not a zone of the zone-aware test", zone)
+			}
+		}
+	}
+	return nil
+}
+
+// ClientConfig returns the config of the client pinned to the input zone, based on the input client config.
+func (cfg *ZoneAwareTestConfig) ClientConfig(base ClientConfig, zone string) ClientConfig {
+	out := base
+	if endpoint := cfg.WriteEndpoints[zone]; endpoint != nil {
+		out.WriteBaseEndpoint = flagext.URLValue{URL: endpoint}
+	}
+	if endpoint := cfg.ReadEndpoints[zone]; endpoint != nil {
+		out.ReadBaseEndpoint = flagext.URLValue{URL: endpoint}
+	}
+	if cfg.ZoneHeader != "" {
+		out.ExtraHeaders = make(map[string]string, len(base.ExtraHeaders)+1)
+		for name, value := range base.ExtraHeaders {
+			out.ExtraHeaders[name] = value
+		}
+		out.ExtraHeaders[cfg.ZoneHeader] = zone
+	}
+	return out
+}
+
+// ZoneEndpoints holds the base endpoint of each zone, by zone name, and implements flag.Value.
+// The flag value is a comma-separated list of endpoints in the format "<zone>=<endpoint>".
+type ZoneEndpoints map[string]*url.URL
+
+// String implements flag.Value.
+func (e ZoneEndpoints) String() string {
+	zones := make([]string, 0, len(e))
+	for zone := range e {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	out := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		out = append(out, fmt.Sprintf("%s=%s", zone, e[zone]))
+	}
+	return strings.Join(out, ",")
+}
+
+// Set implements flag.Value.
+func (e *ZoneEndpoints) Set(s string) error {
+	endpoints := ZoneEndpoints{}
+
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		zone, endpoint, ok := strings.Cut(value, "=")
+		zone = strings.TrimSpace(zone)
+		if !ok || zone == "" {
+			return fmt.Errorf("invalid zone endpoint %q: expected format is <zone>=<endpoint>", value)
+		}
+		if _, exists := endpoints[zone]; exists {
+			return fmt.Errorf("invalid zone endpoint %q: the endpoint of zone %q has been configured more than once", value, zone)
+		}
+
+		u, err := url.Parse(strings.TrimSpace(endpoint))
+		if err != nil {
+			return fmt.Errorf("invalid zone endpoint %q: %w", value, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid zone endpoint %q: the endpoint must be an absolute URL", value)
+		}
+
+		endpoints[zone] = u
+	}
+
+	*e = endpoints
+	return nil
+}
+
+// ZoneAwareTest periodically writes a marker series through each of the configured zones, and queries it back
+// through the same zone. Zones are probed independently, and the outcome of each probe is tracked by zone, so
+// that the degradation of a single zone can be told apart from the degradation of the whole cluster.
+type ZoneAwareTest struct {
+	name    string
+	cfg     ZoneAwareTestConfig
+	clients map[string]MimirClient
+	logger  log.Logger
+	metrics *TestMetrics
+
+	probesTotal       *prometheus.CounterVec
+	probesFailedTotal *prometheus.CounterVec
+	probesDuration    *prometheus.HistogramVec
+}
+
+// NewZoneAwareTest returns the zone-aware test. The input clients are keyed by the zone they're pinned to.
+func NewZoneAwareTest(cfg ZoneAwareTestConfig, clients map[string]MimirClient, logger log.Logger, reg prometheus.Registerer) *ZoneAwareTest {
+	const name = "zone-aware"
+
+	t := &ZoneAwareTest{
+		name:    name,
+		cfg:     cfg,
+		clients: clients,
+		logger:  log.With(logger, "test", name),
+		metrics: NewTestMetrics(name, reg),
+		probesTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_zone_probes_total",
+			Help:        "Total number of write requests, query requests and query result checks run through each zone.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"zone", "type"}),
+		probesFailedTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "mimir_continuous_test_zone_probes_failed_total",
+			Help:        "Total number of failed write requests, query requests and query result checks run through each zone.",
+			ConstLabels: map[string]string{"test": name},
+		}, []string{"zone", "type"}),
+		probesDuration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "mimir_continuous_test_zone_probe_duration_seconds",
+			Help:        "Duration of the write and query requests run through each zone.",
+			ConstLabels: map[string]string{"test": name},
+			Buckets:     prometheus.DefBuckets,
+		}, []string{"zone", "type"}),
+	}
+
+	// Initialise the metrics so that they're exported even if no probe failed.
+	for _, zone := range cfg.Zones {
+		for _, outcomeType := range outcomeTypes {
+			t.probesTotal.WithLabelValues(zone, outcomeType)
+			t.probesFailedTotal.WithLabelValues(zone, outcomeType)
+		}
+	}
+
+	return t
+}
+
+// Name implements Test.
+func (t *ZoneAwareTest) Name() string {
+	return t.name
+}
+
+// Init implements Test.
+func (t *ZoneAwareTest) Init(context.Context, time.Time) error {
+	return nil
+}
+
+// Run implements Test.
+func (t *ZoneAwareTest) Run(ctx context.Context, now time.Time) error {
+	t.metrics.setMaintenanceState(maintenanceStateFromContext(ctx))
+
+	sp, ctx := spanlogger.NewWithLogger(ctx, t.logger, "ZoneAwareTest.Run")
+	defer sp.Finish()
+
+	ts := alignTimestampToInterval(now, writeInterval)
+
+	// A failure of a zone doesn't prevent the other zones from being probed.
+	errs := multierror.New()
+	for _, zone := range t.cfg.Zones {
+		errs.Add(t.probeZone(ctx, log.With(sp, "zone", zone), zone, ts))
+	}
+	return errs.Err()
+}
+
+// probeZone writes the marker series of the input zone through the zone, and queries it back through the same zone.
+func (t *ZoneAwareTest) probeZone(ctx context.Context, logger log.Logger, zone string, ts time.Time) error {
+	client := t.clients[zone]
+
+	// Write the marker series.
+	t.metrics.writesTotal.Inc()
+	t.probesTotal.WithLabelValues(zone, outcomeTypeWrite).Inc()
+
+	start := time.Now()
+	statusCode, err := client.WriteSeries(ctx, generateZoneAwareSeries(zone, ts))
+	t.metrics.writesDuration.Observe(time.Since(start).Seconds())
+	t.probesDuration.WithLabelValues(zone, outcomeTypeWrite).Observe(time.Since(start).Seconds())
+
+	if statusCode/100 != 2 {
+		t.metrics.writesFailedTotal.WithLabelValues(strconv.Itoa(statusCode)).Inc()
+		t.metrics.observeFailure(outcomeTypeWrite)
+		t.probesFailedTotal.WithLabelValues(zone, outcomeTypeWrite).Inc()
+		level.Warn(logger).Log("msg", "Failed to write the zone marker series", "timestamp", ts.UnixMilli(), "status_code", statusCode, "err", err)
+		return errors.Wrapf(err, "failed to write the marker series through zone %s with status code %d", zone, statusCode)
+	}
+	t.metrics.observeSuccess(outcomeTypeWrite)
+
+	// Query it back, bypassing the results cache, otherwise a stale result could be returned.
+	query := zoneAwareQuery(zone)
+	logger = log.With(logger, "query", query, "ts", ts.UnixMilli())
+
+	t.metrics.queriesTotal.Inc()
+	t.probesTotal.WithLabelValues(zone, outcomeTypeQuery).Inc()
+
+	start = time.Now()
+	vector, err := client.Query(ctx, query, ts, WithResultsCacheEnabled(false))
+	t.metrics.observeQueryDuration(queryTypeInstant, false, start)
+	t.probesDuration.WithLabelValues(zone, outcomeTypeQuery).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		t.metrics.queriesFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQuery)
+		t.probesFailedTotal.WithLabelValues(zone, outcomeTypeQuery).Inc()
+		level.Warn(logger).Log("msg", "Failed to execute instant query", "err", err)
+		return errors.Wrapf(err, "failed to execute instant query %s through zone %s", query, zone)
+	}
+	t.metrics.observeSuccess(outcomeTypeQuery)
+
+	// Check the result.
+	t.metrics.queryResultChecksTotal.Inc()
+	t.probesTotal.WithLabelValues(zone, outcomeTypeQueryResultCheck).Inc()
+
+	if err := verifyZoneAwareResult(zone, ts, vector); err != nil {
+		t.metrics.queryResultChecksFailedTotal.Inc()
+		t.metrics.observeFailure(outcomeTypeQueryResultCheck)
+		t.probesFailedTotal.WithLabelValues(zone, outcomeTypeQueryResultCheck).Inc()
+		level.Warn(logger).Log("msg", "Query result check failed", "err", err)
+		reportQueryResultCheckFailure(ctx, queryResultCheckFailure{Test: t.Name(), Query: query, Start: ts, End: ts, Error: err.Error()})
+		return errors.Wrapf(err, "query result check failed for query %s through zone %s", query, zone)
+	}
+	t.metrics.observeSuccess(outcomeTypeQueryResultCheck)
+
+	level.Debug(logger).Log("msg", "Query result check succeeded")
+	return nil
+}
+
+func zoneAwareQuery(zone string) string {
+	return fmt.Sprintf("%s{%s=%q}", zoneAwareMetricName, zoneAwareZoneLabel, zone)
+}
+
+// verifyZoneAwareResult returns an error if the input vector doesn't contain exactly the marker series of the
+// input zone, with the sample written at the input timestamp.
+func verifyZoneAwareResult(zone string, ts time.Time, vector model.Vector) error {
+	if len(vector) != 1 {
+		return fmt.Errorf("expected 1 series, got %d", len(vector))
+	}
+
+	sample := vector[0]
+	if actual := string(sample.Metric[zoneAwareZoneLabel]); actual != zone {
+		return fmt.Errorf("expected the marker series of zone %s, got the one of zone %s", zone, actual)
+	}
+	if expected := model.SampleValue(ts.Unix()); sample.Value != expected {
+		return fmt.Errorf("expected value %s, got %s", expected, sample.Value)
+	}
+	return nil
+}
+
+func generateZoneAwareSeries(zone string, ts time.Time) []prompb.TimeSeries {
+	return []prompb.TimeSeries{{
+		Labels: []prompb.Label{
+			{Name: model.MetricNameLabel, Value: zoneAwareMetricName},
+			{Name: zoneAwareZoneLabel, Value: zone},
+		},
+		Samples: []prompb.Sample{{Value: float64(ts.Unix()), Timestamp: ts.UnixMilli()}},
+	}}
+}
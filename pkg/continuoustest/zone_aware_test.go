@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package continuoustest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZoneAwareTestConfig_Validate(t *testing.T) {
+	cfg := ZoneAwareTestConfig{Zones: []string{"zone-a", "zone-b"}, ZoneHeader: "X-Zone"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Zones = nil
+	assert.ErrorContains(t, cfg.Validate(), "at least one zone")
+
+	cfg.Zones = []string{"zone-a", ""}
+	assert.ErrorContains(t, cfg.Validate(), "must not be empty")
+
+	cfg.Zones = []string{"zone-a", "zone-a"}
+	assert.ErrorContains(t, cfg.Validate(), "configured more than once")
+
+	cfg.Zones = []string{"zone-a", "zone-b"}
+	cfg.ZoneHeader = ""
+	require.NoError(t, cfg.WriteEndpoints.Set("zone-a=http://zone-a"))
+	assert.ErrorContains(t, cfg.Validate(), `the zone "zone-b" of the zone-aware test has no endpoint configured`)
+
+	require.NoError(t, cfg.ReadEndpoints.Set("zone-b=http://zone-b"))
+	assert.NoError(t, cfg.Validate())
+
+	require.NoError(t, cfg.ReadEndpoints.Set("zone-b=http://zone-b,zone-c=http://zone-c"))
+	assert.ErrorContains(t, cfg.Validate(), `the zone "zone-c", which is not a zone`)
+}
+
+func TestZoneEndpoints_Set(t *testing.T) {
+	var endpoints ZoneEndpoints
+	require.NoError(t, endpoints.Set(" zone-b = http://zone-b:8080 ,zone-a=https://zone-a/prometheus"))
+	assert.Equal(t, "zone-a=https://zone-a/prometheus,zone-b=http://zone-b:8080", endpoints.String())
+
+	assert.ErrorContains(t, endpoints.Set("zone-a"), "expected format is <zone>=<endpoint>")
+	assert.ErrorContains(t, endpoints.Set("zone-a=http://a,zone-a=http://b"), "configured more than once")
+	assert.ErrorContains(t, endpoints.Set("zone-a=zone-a"), "must be an absolute URL")
+}
+
+func TestZoneAwareTestConfig_ClientConfig(t *testing.T) {
+	base := ClientConfig{}
+	flagext.DefaultValues(&base)
+	require.NoError(t, base.WriteBaseEndpoint.Set("http://write"))
+	require.NoError(t, base.ReadBaseEndpoint.Set("http://read"))
+
+	cfg := ZoneAwareTestConfig{Zones: []string{"zone-a", "zone-b"}, ZoneHeader: "X-Zone"}
+	require.NoError(t, cfg.WriteEndpoints.Set("zone-a=http://write-zone-a"))
+	require.NoError(t, cfg.ReadEndpoints.Set("zone-a=http://read-zone-a"))
+
+	zoneA := cfg.ClientConfig(base, "zone-a")
+	assert.Equal(t, "http://write-zone-a", zoneA.WriteBaseEndpoint.String())
+	assert.Equal(t, "http://read-zone-a", zoneA.ReadBaseEndpoint.String())
+	assert.Equal(t, map[string]string{"X-Zone": "zone-a"}, zoneA.ExtraHeaders)
+
+	zoneB := cfg.ClientConfig(base, "zone-b")
+	assert.Equal(t, "http://write", zoneB.WriteBaseEndpoint.String())
+	assert.Equal(t, "http://read", zoneB.ReadBaseEndpoint.String())
+	assert.Equal(t, map[string]string{"X-Zone": "zone-b"}, zoneB.ExtraHeaders)
+
+	// The base config is not modified.
+	assert.Nil(t, base.ExtraHeaders)
+}
+
+func TestZoneAwareTest_Run(t *testing.T) {
+	zones := []string{"zone-a", "zone-b"}
+	now := time.Unix(1000, 0)
+	ts := alignTimestampToInterval(now, writeInterval)
+
+	marker := func(zone string, value float64) model.Vector {
+		return model.Vector{{
+			Metric:    model.Metric{model.MetricNameLabel: zoneAwareMetricName, zoneAwareZoneLabel: model.LabelValue(zone)},
+			Value:     model.SampleValue(value),
+			Timestamp: model.TimeFromUnixNano(ts.UnixNano()),
+		}}
+	}
+
+	newTest := func(clients map[string]*ClientMock, reg prometheus.Registerer) *ZoneAwareTest {
+		mimirClients := map[string]MimirClient{}
+		for zone, client := range clients {
+			mimirClients[zone] = client
+		}
+		return NewZoneAwareTest(ZoneAwareTestConfig{Enabled: true, Zones: zones, ZoneHeader: "X-Zone"}, mimirClients, log.NewNopLogger(), reg)
+	}
+
+	t.Run("should succeed if the marker series are written and queried back through each zone", func(t *testing.T) {
+		clients := map[string]*ClientMock{}
+		for _, zone := range zones {
+			clients[zone] = &ClientMock{}
+			clients[zone].On("WriteSeries", mock.Anything, generateZoneAwareSeries(zone, ts)).Return(200, nil)
+			clients[zone].On("Query", mock.Anything, zoneAwareQuery(zone), ts, mock.Anything).Return(marker(zone, float64(ts.Unix())), nil)
+		}
+		test := newTest(clients, prometheus.NewPedanticRegistry())
+
+		require.NoError(t, test.Run(context.Background(), now))
+		for _, zone := range zones {
+			clients[zone].AssertNumberOfCalls(t, "WriteSeries", 1)
+			clients[zone].AssertNumberOfCalls(t, "Query", 1)
+
+			for _, outcomeType := range outcomeTypes {
+				assert.Equal(t, 1.0, testutil.ToFloat64(test.probesTotal.WithLabelValues(zone, outcomeType)))
+				assert.Equal(t, 0.0, testutil.ToFloat64(test.probesFailedTotal.WithLabelValues(zone, outcomeType)))
+			}
+		}
+	})
+
+	t.Run("should probe the other zones and track the failures by zone if a zone is degraded", func(t *testing.T) {
+		clients := map[string]*ClientMock{"zone-a": {}, "zone-b": {}}
+		clients["zone-a"].On("WriteSeries", mock.Anything, mock.Anything).Return(500, errors.New("failed"))
+		clients["zone-b"].On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		clients["zone-b"].On("Query", mock.Anything, mock.Anything, ts, mock.Anything).Return(marker("zone-b", float64(ts.Unix())), nil)
+		test := newTest(clients, prometheus.NewPedanticRegistry())
+
+		err := test.Run(context.Background(), now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to write the marker series through zone zone-a")
+		clients["zone-a"].AssertNumberOfCalls(t, "Query", 0)
+		clients["zone-b"].AssertNumberOfCalls(t, "Query", 1)
+
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.probesFailedTotal.WithLabelValues("zone-a", outcomeTypeWrite)))
+		assert.Equal(t, 0.0, testutil.ToFloat64(test.probesFailedTotal.WithLabelValues("zone-b", outcomeTypeWrite)))
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.probesTotal.WithLabelValues("zone-b", outcomeTypeQueryResultCheck)))
+	})
+
+	t.Run("should fail if the queried value is not the written one", func(t *testing.T) {
+		// The query through zone-b returns the sample written at the previous run.
+		clients := map[string]*ClientMock{"zone-a": {}, "zone-b": {}}
+		for _, client := range clients {
+			client.On("WriteSeries", mock.Anything, mock.Anything).Return(200, nil)
+		}
+		clients["zone-a"].On("Query", mock.Anything, mock.Anything, ts, mock.Anything).Return(marker("zone-a", float64(ts.Unix())), nil)
+		clients["zone-b"].On("Query", mock.Anything, mock.Anything, ts, mock.Anything).Return(marker("zone-b", float64(ts.Add(-writeInterval).Unix())), nil)
+		test := newTest(clients, prometheus.NewPedanticRegistry())
+
+		err := test.Run(context.Background(), now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "query result check failed for query mimir_continuous_test_zone_marker{zone=\"zone-b\"} through zone zone-b")
+		assert.Equal(t, 0.0, testutil.ToFloat64(test.probesFailedTotal.WithLabelValues("zone-a", outcomeTypeQueryResultCheck)))
+		assert.Equal(t, 1.0, testutil.ToFloat64(test.probesFailedTotal.WithLabelValues("zone-b", outcomeTypeQueryResultCheck)))
+	})
+}
+
+func TestVerifyZoneAwareResult(t *testing.T) {
+	ts := time.Unix(1000, 0)
+	sample := func(zone string, value float64) *model.Sample {
+		return &model.Sample{Metric: model.Metric{zoneAwareZoneLabel: model.LabelValue(zone)}, Value: model.SampleValue(value)}
+	}
+
+	assert.NoError(t, verifyZoneAwareResult("zone-a", ts, model.Vector{sample("zone-a", 1000)}))
+	assert.ErrorContains(t, verifyZoneAwareResult("zone-a", ts, model.Vector{}), "expected 1 series, got 0")
+	assert.ErrorContains(t, verifyZoneAwareResult("zone-a", ts, model.Vector{sample("zone-b", 1000)}), "got the one of zone zone-b")
+	assert.ErrorContains(t, verifyZoneAwareResult("zone-a", ts, model.Vector{sample("zone-a", 980)}), "expected value 1000, got 980")
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"math"
+
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/prometheus/model/value"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/extract"
+	"github.com/grafana/mimir/pkg/util/push"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// prePushAggregationMiddleware drops the labels configured in the tenant aggregation rules, and sum-aggregates
+// the series colliding once the labels have been dropped. The aggregation is done within a single write request:
+// each aggregated series gets a single sample, whose value is the sum of the latest sample of each input series
+// and whose timestamp is the latest one of the input series.
+//
+// No state is kept across write requests, neither by a single distributor nor across distributors, so the series
+// aggregated together are expected to be sent in the same write request, like the series scraped by the same
+// Prometheus server. If they're split across requests, each request writes a partial sum to the aggregated series.
+func (d *Distributor) prePushAggregationMiddleware(next push.Func) push.Func {
+	return func(ctx context.Context, pushReq *push.Request) (*mimirpb.WriteResponse, error) {
+		cleanupInDefer := true
+		defer func() {
+			if cleanupInDefer {
+				pushReq.CleanUp()
+			}
+		}()
+
+		req, err := pushReq.WriteRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		userID, err := tenant.TenantID(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		rules := d.limits.AggregationRules(userID)
+		if len(rules) == 0 || len(req.Timeseries) == 0 {
+			cleanupInDefer = false
+			return next(ctx, pushReq)
+		}
+
+		var inputSeries, outputSeries int
+		req.Timeseries, inputSeries, outputSeries = aggregateTimeseries(req.Timeseries, rules)
+		if inputSeries > 0 {
+			d.aggregationInputSeries.WithLabelValues(userID).Add(float64(inputSeries))
+			d.aggregationOutputSeries.WithLabelValues(userID).Add(float64(outputSeries))
+		}
+
+		cleanupInDefer = false
+		return next(ctx, pushReq)
+	}
+}
+
+// aggregationGroup holds the state of a series resulting from the aggregation of one or more input series.
+type aggregationGroup struct {
+	// tsIdx is the index of the first input series, which is reused as the aggregated series.
+	tsIdx int
+
+	sum       float64
+	timestamp int64
+	hasValue  bool
+}
+
+// aggregateTimeseries applies the aggregation rules to the input series, which must have sorted labels, and returns
+// the resulting series along with the number of series matched by a rule and the number of series they've been
+// aggregated to. Series with native histograms are left unchanged.
+func aggregateTimeseries(series []mimirpb.PreallocTimeseries, rules validation.AggregationRules) (_ []mimirpb.PreallocTimeseries, inputSeries, outputSeries int) {
+	var (
+		groups          map[string]*aggregationGroup
+		removeTsIndexes []int
+	)
+
+	for tsIdx := range series {
+		ts := series[tsIdx]
+		if len(ts.Samples) == 0 || len(ts.Histograms) > 0 {
+			continue
+		}
+
+		metricName, err := extract.UnsafeMetricNameFromLabelAdapters(ts.Labels)
+		if err != nil {
+			continue
+		}
+
+		rule, ok := rules[metricName]
+		if !ok || len(rule.DropLabels) == 0 {
+			continue
+		}
+
+		for _, labelName := range rule.DropLabels {
+			removeLabel(labelName, &ts.Labels)
+		}
+
+		if groups == nil {
+			groups = map[string]*aggregationGroup{}
+		}
+
+		inputSeries++
+		key := mimirpb.FromLabelAdaptersToLabels(ts.Labels).String()
+		group, ok := groups[key]
+		if !ok {
+			group = &aggregationGroup{tsIdx: tsIdx, timestamp: math.MinInt64}
+			groups[key] = group
+		} else {
+			// The series is released once aggregated, so its exemplars, which may reference its
+			// buffers, are dropped. Only the exemplars of the first input series are kept.
+			removeTsIndexes = append(removeTsIndexes, tsIdx)
+		}
+
+		group.add(ts.Samples)
+	}
+
+	for _, group := range groups {
+		ts := series[group.tsIdx]
+		ts.Samples = ts.Samples[:1]
+		ts.Samples[0] = mimirpb.Sample{TimestampMs: group.timestamp, Value: group.sum}
+		if !group.hasValue {
+			ts.Samples[0].Value = math.Float64frombits(value.StaleNaN)
+		}
+	}
+	outputSeries = len(groups)
+
+	if len(removeTsIndexes) > 0 {
+		for _, removeTsIndex := range removeTsIndexes {
+			mimirpb.ReusePreallocTimeseries(&series[removeTsIndex])
+		}
+		series = util.RemoveSliceIndexes(series, removeTsIndexes)
+	}
+
+	return series, inputSeries, outputSeries
+}
+
+// add adds the latest non-stale sample of an input series to the aggregated series.
+func (g *aggregationGroup) add(samples []mimirpb.Sample) {
+	var latest *mimirpb.Sample
+	for i := range samples {
+		s := &samples[i]
+		if s.TimestampMs > g.timestamp {
+			g.timestamp = s.TimestampMs
+		}
+		if value.IsStaleNaN(s.Value) {
+			continue
+		}
+		if latest == nil || s.TimestampMs >= latest.TimestampMs {
+			latest = s
+		}
+	}
+
+	if latest != nil {
+		g.sum += latest.Value
+		g.hasValue = true
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/push"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestAggregateTimeseries(t *testing.T) {
+	rules := validation.AggregationRules{
+		"http_requests_total": {DropLabels: []string{"instance", "pod"}},
+	}
+
+	series := func(lbls []string, samples ...mimirpb.Sample) mimirpb.PreallocTimeseries {
+		ts := mimirpb.PreallocTimeseries{TimeSeries: &mimirpb.TimeSeries{Samples: samples}}
+		for i := 0; i < len(lbls); i += 2 {
+			ts.Labels = append(ts.Labels, mimirpb.LabelAdapter{Name: lbls[i], Value: lbls[i+1]})
+		}
+		return ts
+	}
+	staleNaN := math.Float64frombits(value.StaleNaN)
+
+	t.Run("should aggregate the colliding series matching a rule", func(t *testing.T) {
+		in := []mimirpb.PreallocTimeseries{
+			series([]string{"__name__", "http_requests_total", "job", "api", "pod", "api-1"}, mimirpb.Sample{TimestampMs: 1000, Value: 1}, mimirpb.Sample{TimestampMs: 2000, Value: 2}),
+			series([]string{"__name__", "other_metric", "job", "api", "pod", "api-1"}, mimirpb.Sample{TimestampMs: 2000, Value: 10}),
+			series([]string{"__name__", "http_requests_total", "job", "api", "pod", "api-2"}, mimirpb.Sample{TimestampMs: 2500, Value: 3}),
+			series([]string{"__name__", "http_requests_total", "instance", "host-1", "job", "db", "pod", "db-1"}, mimirpb.Sample{TimestampMs: 1500, Value: 5}),
+		}
+
+		out, inputSeries, outputSeries := aggregateTimeseries(in, rules)
+		assert.Equal(t, 3, inputSeries)
+		assert.Equal(t, 2, outputSeries)
+		assert.Equal(t, []mimirpb.PreallocTimeseries{
+			series([]string{"__name__", "http_requests_total", "job", "api"}, mimirpb.Sample{TimestampMs: 2500, Value: 5}),
+			series([]string{"__name__", "other_metric", "job", "api", "pod", "api-1"}, mimirpb.Sample{TimestampMs: 2000, Value: 10}),
+			series([]string{"__name__", "http_requests_total", "job", "db"}, mimirpb.Sample{TimestampMs: 1500, Value: 5}),
+		}, out)
+	})
+
+	t.Run("should ignore stale markers unless all the input series are stale", func(t *testing.T) {
+		in := []mimirpb.PreallocTimeseries{
+			series([]string{"__name__", "http_requests_total", "job", "api", "pod", "api-1"}, mimirpb.Sample{TimestampMs: 1000, Value: 1}),
+			series([]string{"__name__", "http_requests_total", "job", "api", "pod", "api-2"}, mimirpb.Sample{TimestampMs: 2000, Value: staleNaN}),
+			series([]string{"__name__", "http_requests_total", "job", "db", "pod", "db-1"}, mimirpb.Sample{TimestampMs: 2000, Value: staleNaN}),
+		}
+
+		out, _, _ := aggregateTimeseries(in, rules)
+		require.Len(t, out, 2)
+		assert.Equal(t, []mimirpb.Sample{{TimestampMs: 2000, Value: 1}}, out[0].Samples)
+		require.Len(t, out[1].Samples, 1)
+		assert.True(t, value.IsStaleNaN(out[1].Samples[0].Value))
+	})
+
+	t.Run("should not aggregate series with native histograms", func(t *testing.T) {
+		histogram := series([]string{"__name__", "http_requests_total", "job", "api", "pod", "api-1"})
+		histogram.Histograms = []mimirpb.Histogram{{Timestamp: 1000}}
+
+		out, inputSeries, outputSeries := aggregateTimeseries([]mimirpb.PreallocTimeseries{histogram}, rules)
+		assert.Equal(t, 0, inputSeries)
+		assert.Equal(t, 0, outputSeries)
+		assert.Equal(t, []mimirpb.PreallocTimeseries{histogram}, out)
+	})
+}
+
+func TestDistributor_PrePushAggregationMiddleware(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	limits := &validation.Limits{}
+	flagext.DefaultValues(limits)
+	limits.AggregationRules = validation.AggregationRules{"metric": {DropLabels: []string{"pod"}}}
+
+	ds, _, regs := prepare(t, prepConfig{
+		numDistributors: 1,
+		limits:          limits,
+	})
+
+	var gotReq *mimirpb.WriteRequest
+	middleware := ds[0].prePushAggregationMiddleware(func(ctx context.Context, pushReq *push.Request) (*mimirpb.WriteResponse, error) {
+		req, err := pushReq.WriteRequest()
+		require.NoError(t, err)
+		gotReq = req
+		pushReq.CleanUp()
+		return nil, nil
+	})
+
+	req := &mimirpb.WriteRequest{}
+	for _, pod := range []string{"pod-1", "pod-2", "pod-3"} {
+		req.Timeseries = append(req.Timeseries, mimirpb.PreallocTimeseries{TimeSeries: &mimirpb.TimeSeries{
+			Labels:  []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "pod", Value: pod}},
+			Samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 1}},
+		}})
+	}
+
+	_, err := middleware(ctx, push.NewParsedRequest(req))
+	require.NoError(t, err)
+
+	require.Len(t, gotReq.Timeseries, 1)
+	assert.Equal(t, []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}}, gotReq.Timeseries[0].Labels)
+	assert.Equal(t, []mimirpb.Sample{{TimestampMs: 1000, Value: 3}}, gotReq.Timeseries[0].Samples)
+
+	assert.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(`
+		# HELP cortex_distributor_aggregation_input_series_total The total number of received series matching an aggregation rule, whose labels have been dropped before the resulting colliding series have been aggregated.
+		# TYPE cortex_distributor_aggregation_input_series_total counter
+		cortex_distributor_aggregation_input_series_total{user="user"} 3
+		# HELP cortex_distributor_aggregation_output_series_total The total number of series resulting from the aggregation of the series matching an aggregation rule.
+		# TYPE cortex_distributor_aggregation_output_series_total counter
+		cortex_distributor_aggregation_output_series_total{user="user"} 1
+	`), "cortex_distributor_aggregation_input_series_total", "cortex_distributor_aggregation_output_series_total"))
+}
@@ -117,7 +117,10 @@ type Distributor struct {
 	incomingExemplars                *prometheus.CounterVec
 	incomingMetadata                 *prometheus.CounterVec
 	nonHASamples                     *prometheus.CounterVec
+	zoneWriteRequests                *prometheus.CounterVec
 	dedupedSamples                   *prometheus.CounterVec
+	aggregationInputSeries           *prometheus.CounterVec
+	aggregationOutputSeries          *prometheus.CounterVec
 	labelsHistogram                  prometheus.Histogram
 	sampleDelayHistogram             prometheus.Histogram
 	replicationFactor                prometheus.Gauge
@@ -126,6 +129,7 @@ type Distributor struct {
 	discardedSamplesTooManyHaClusters *prometheus.CounterVec
 	discardedSamplesRateLimited       *prometheus.CounterVec
 	discardedRequestsRateLimited      *prometheus.CounterVec
+	discardedRequestsReadOnly         *prometheus.CounterVec
 	discardedExemplarsRateLimited     *prometheus.CounterVec
 	discardedMetadataRateLimited      *prometheus.CounterVec
 
@@ -133,6 +137,9 @@ type Distributor struct {
 	exemplarValidationMetrics *validation.ExemplarValidationMetrics
 	metadataValidationMetrics *validation.MetadataValidationMetrics
 
+	// Tenants put in read-only mode via the admin API. Nil if the admin API is disabled.
+	readOnlyTenants *readOnlyTenantsTracker
+
 	PushWithMiddlewares push.Func
 }
 
@@ -143,8 +150,13 @@ type Config struct {
 
 	HATrackerConfig HATrackerConfig `yaml:"ha_tracker"`
 
-	MaxRecvMsgSize int           `yaml:"max_recv_msg_size" category:"advanced"`
-	RemoteTimeout  time.Duration `yaml:"remote_timeout" category:"advanced"`
+	ReadOnlyTenants ReadOnlyTenantsConfig `yaml:"read_only_tenants"`
+
+	MaxRecvMsgSize       int           `yaml:"max_recv_msg_size" category:"advanced"`
+	MaxRequestLabelBytes int           `yaml:"max_request_label_bytes" category:"experimental"`
+	RemoteTimeout        time.Duration `yaml:"remote_timeout" category:"advanced"`
+
+	ZoneWriteReportEnabled bool `yaml:"zone_write_report_enabled" category:"experimental"`
 
 	// Distributors ring
 	DistributorRing RingConfig `yaml:"ring"`
@@ -181,11 +193,14 @@ type PushWrapper func(next push.Func) push.Func
 func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	cfg.PoolConfig.RegisterFlags(f)
 	cfg.HATrackerConfig.RegisterFlags(f)
+	cfg.ReadOnlyTenants.RegisterFlags(f)
 	cfg.DistributorRing.RegisterFlags(f, logger)
 	cfg.Forwarding.RegisterFlags(f)
 
 	f.IntVar(&cfg.MaxRecvMsgSize, "distributor.max-recv-msg-size", 100<<20, "Max message size in bytes that the distributors will accept for incoming push requests to the remote write API. If exceeded, the request will be rejected.")
+	f.IntVar(&cfg.MaxRequestLabelBytes, "distributor.max-request-label-bytes", 0, "Max total size in bytes of the series label names and values that the distributors will accept in a single push request to the remote write API. The limit is checked on the decompressed request before it's unmarshalled. If exceeded, the request will be rejected. 0 to disable.")
 	f.DurationVar(&cfg.RemoteTimeout, "distributor.remote-timeout", 2*time.Second, "Timeout for downstream ingesters.")
+	f.BoolVar(&cfg.ZoneWriteReportEnabled, "distributor.zone-write-report-enabled", false, fmt.Sprintf("True to report which ingester zones acknowledged a write request when the request has not been acknowledged by all zones. The report is returned in the %s response header and in the error message of failed requests. Requires zone-awareness to be enabled.", ZoneWriteReportHeader))
 
 	cfg.DefaultLimits.RegisterFlags(f)
 }
@@ -201,6 +216,10 @@ func (cfg *Config) Validate(limits validation.Limits) error {
 		return err
 	}
 
+	if err := cfg.ReadOnlyTenants.Validate(); err != nil {
+		return err
+	}
+
 	return cfg.Forwarding.Validate()
 }
 
@@ -299,11 +318,24 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 			Name:      "distributor_non_ha_samples_received_total",
 			Help:      "The total number of received samples for a user that has HA tracking turned on, but the sample didn't contain both HA labels.",
 		}, []string{"user"}),
+		zoneWriteRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_zone_write_requests_total",
+			Help:      "The total number of write requests sent to ingesters, partitioned by zone and status. Tracked only when zone-awareness and the zone write report are enabled.",
+		}, []string{"user", "zone", "status"}),
 		dedupedSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Namespace: "cortex",
 			Name:      "distributor_deduped_samples_total",
 			Help:      "The total number of deduplicated samples.",
 		}, []string{"user", "cluster"}),
+		aggregationInputSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_aggregation_input_series_total",
+			Help: "The total number of received series matching an aggregation rule, whose labels have been dropped before the resulting colliding series have been aggregated.",
+		}, []string{"user"}),
+		aggregationOutputSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_aggregation_output_series_total",
+			Help: "The total number of series resulting from the aggregation of the series matching an aggregation rule.",
+		}, []string{"user"}),
 		labelsHistogram: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
 			Namespace: "cortex",
 			Name:      "labels_per_sample",
@@ -342,6 +374,7 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 		discardedSamplesTooManyHaClusters: validation.DiscardedSamplesCounter(reg, validation.ReasonTooManyHAClusters),
 		discardedSamplesRateLimited:       validation.DiscardedSamplesCounter(reg, validation.ReasonRateLimited),
 		discardedRequestsRateLimited:      validation.DiscardedRequestsCounter(reg, validation.ReasonRateLimited),
+		discardedRequestsReadOnly:         validation.DiscardedRequestsCounter(reg, validation.ReasonTenantReadOnly),
 		discardedExemplarsRateLimited:     validation.DiscardedExemplarsCounter(reg, validation.ReasonRateLimited),
 		discardedMetadataRateLimited:      validation.DiscardedMetadataCounter(reg, validation.ReasonRateLimited),
 
@@ -430,6 +463,14 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 		subservices = append(subservices, d.forwarder)
 	}
 
+	if cfg.ReadOnlyTenants.Enabled {
+		d.readOnlyTenants, err = newReadOnlyTenantsTracker(cfg.ReadOnlyTenants, reg, log)
+		if err != nil {
+			return nil, err
+		}
+		subservices = append(subservices, d.readOnlyTenants)
+	}
+
 	d.PushWithMiddlewares = d.wrapPushWithMiddlewares(d.push)
 
 	subservices = append(subservices, d.ingesterPool, d.activeUsers)
@@ -526,13 +567,17 @@ func (d *Distributor) cleanupInactiveUser(userID string) {
 	d.incomingExemplars.DeleteLabelValues(userID)
 	d.incomingMetadata.DeleteLabelValues(userID)
 	d.nonHASamples.DeleteLabelValues(userID)
+	d.aggregationInputSeries.DeleteLabelValues(userID)
+	d.aggregationOutputSeries.DeleteLabelValues(userID)
 	d.latestSeenSampleTimestampPerUser.DeleteLabelValues(userID)
 
 	filter := prometheus.Labels{"user": userID}
 	d.dedupedSamples.DeletePartialMatch(filter)
+	d.zoneWriteRequests.DeletePartialMatch(filter)
 	d.discardedSamplesTooManyHaClusters.DeletePartialMatch(filter)
 	d.discardedSamplesRateLimited.DeletePartialMatch(filter)
 	d.discardedRequestsRateLimited.DeleteLabelValues(userID)
+	d.discardedRequestsReadOnly.DeleteLabelValues(userID)
 	d.discardedExemplarsRateLimited.DeleteLabelValues(userID)
 	d.discardedMetadataRateLimited.DeleteLabelValues(userID)
 
@@ -709,6 +754,7 @@ func (d *Distributor) wrapPushWithMiddlewares(next push.Func) push.Func {
 	middlewares = append(middlewares, d.metricsMiddleware)
 	middlewares = append(middlewares, d.prePushHaDedupeMiddleware)
 	middlewares = append(middlewares, d.prePushRelabelMiddleware)
+	middlewares = append(middlewares, d.prePushAggregationMiddleware)
 	middlewares = append(middlewares, d.prePushValidationMiddleware)
 	middlewares = append(middlewares, d.prePushForwardingMiddleware)
 	middlewares = append(middlewares, d.cfg.PushWrappers...)
@@ -1112,6 +1158,14 @@ func (d *Distributor) limitsMiddleware(next push.Func) push.Func {
 			return nil, err
 		}
 
+		if d.isTenantReadOnly(userID) {
+			d.discardedRequestsReadOnly.WithLabelValues(userID).Add(1)
+
+			// Return a dedicated 4xx status code, so that clients don't retry the request and
+			// can tell the tenant is in read-only mode apart from other client errors.
+			return nil, httpgrpc.Errorf(http.StatusLocked, validation.NewTenantReadOnlyError().Error())
+		}
+
 		now := mtime.Now()
 		if !d.requestRateLimiter.AllowN(now, userID, 1) {
 			d.discardedRequestsRateLimited.WithLabelValues(userID).Add(1)
@@ -1216,6 +1270,8 @@ func (d *Distributor) push(ctx context.Context, pushReq *push.Request) (*mimirpb
 
 	// Get a subring if tenant has shuffle shard size configured.
 	subRing := d.ingestersRing.ShuffleShard(userID, d.limits.IngestionTenantShardSize(userID))
+	ackLevel := d.limits.WriteAckLevel(userID)
+	writeRing := newWriteAckLevelRing(subRing, ackLevel)
 
 	// Use a background context to make sure all ingesters get samples even if we return early
 	localCtx, cancel := context.WithTimeout(context.Background(), d.cfg.RemoteTimeout)
@@ -1237,7 +1293,20 @@ func (d *Distributor) push(ctx context.Context, pushReq *push.Request) (*mimirpb
 	// so set this flag false and pass cleanup() to DoBatch.
 	cleanupInDefer = false
 
-	err = ring.DoBatch(ctx, ring.WriteNoExtend, subRing, keys, func(ingester ring.InstanceDesc, indexes []int) error {
+	// The zone writes are always tracked to compute the achieved write ack level, while the
+	// per-zone metrics are tracked only when the zone write report is enabled.
+	var zoneMetrics *prometheus.CounterVec
+	if d.cfg.ZoneWriteReportEnabled {
+		zoneMetrics = d.zoneWriteRequests
+	}
+	zones := newZoneWriteTracker(userID, zoneMetrics)
+
+	err = ring.DoBatch(ctx, ring.WriteNoExtend, writeRing, keys, func(ingester ring.InstanceDesc, indexes []int) (err error) {
+		if ingester.Zone != "" {
+			zones.started(ingester.Zone)
+			defer func() { zones.done(ingester.Zone, err) }()
+		}
+
 		var timeseriesCount, metadataCount int
 		for _, i := range indexes {
 			if i >= initialMetadataIndex {
@@ -1258,19 +1327,45 @@ func (d *Distributor) push(ctx context.Context, pushReq *push.Request) (*mimirpb
 			}
 		}
 
-		err := d.send(localCtx, ingester, timeseries, metadata, req.Source)
+		err = d.send(localCtx, ingester, timeseries, metadata, req.Source)
 		if errors.Is(err, context.DeadlineExceeded) {
 			return httpgrpc.Errorf(500, "exceeded configured distributor remote timeout: %s", err.Error())
 		}
 		return err
 	}, func() { pushReq.CleanUp(); cancel() })
 
+	report := zones.report()
+	if d.cfg.ZoneWriteReportEnabled {
+		err = reportZoneWrites(ctx, report, err)
+	}
+
 	if err != nil {
 		return nil, err
 	}
+
+	push.SetResponseHeader(ctx, WriteAckLevelHeader, achievedWriteAckLevel(ackLevel, report, subRing.ReplicationFactor()))
 	return &mimirpb.WriteResponse{}, nil
 }
 
+// reportZoneWrites returns the input zone write report to the client, if not all zones
+// acknowledged the write. The report is set in the response header and, if the write failed,
+// added to the returned error.
+func reportZoneWrites(ctx context.Context, report zoneWriteReport, err error) error {
+	if report.complete() {
+		return err
+	}
+
+	push.SetResponseHeader(ctx, ZoneWriteReportHeader, report.String())
+
+	if err == nil {
+		return nil
+	}
+	if resp, ok := httpgrpc.HTTPResponseFromError(err); ok {
+		return httpgrpc.Errorf(int(resp.Code), "%s (zones: %s)", resp.Body, report.String())
+	}
+	return errors.Wrapf(err, "zones: %s", report.String())
+}
+
 func preallocSliceIfNeeded[T any](size int) []T {
 	if size > 0 {
 		return make([]T, 0, size)
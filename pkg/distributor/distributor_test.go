@@ -12,6 +12,7 @@ import (
 	"io"
 	"math"
 	"net/http"
+	"net/http/httptest"
 	"sort"
 	"strconv"
 	"strings"
@@ -20,6 +21,7 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/golang/snappy"
 	"github.com/grafana/dskit/flagext"
 	"github.com/grafana/dskit/kv"
 	"github.com/grafana/dskit/kv/consul"
@@ -331,6 +333,140 @@ func TestDistributor_Push(t *testing.T) {
 	}
 }
 
+func TestDistributor_Push_ZoneWriteReport(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	for name, tc := range map[string]struct {
+		zoneWriteReportEnabled bool
+		expectedReport         bool
+	}{
+		"should not report nor track zones if zone write report is disabled": {
+			zoneWriteReportEnabled: false,
+			expectedReport:         false,
+		},
+		"should report and track zones if zone write report is enabled": {
+			zoneWriteReportEnabled: true,
+			expectedReport:         true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ds, _, regs := prepare(t, prepConfig{
+				numIngesters:           3,
+				happyIngesters:         1,
+				numDistributors:        1,
+				ingesterZones:          []string{"ZONE-A", "ZONE-B", "ZONE-C"},
+				zoneWriteReportEnabled: tc.zoneWriteReportEnabled,
+			})
+
+			// The ingester in ZONE-A succeeds, while ingesters in ZONE-B and ZONE-C fail. The request
+			// to ZONE-A may still be in-flight when the push fails, so it's not checked in the report.
+			_, err := ds[0].Push(ctx, makeWriteRequest(0, 1, 0, false, false))
+			require.Error(t, err)
+
+			resp, ok := httpgrpc.HTTPResponseFromError(err)
+			require.True(t, ok)
+			assert.Equal(t, int32(http.StatusInternalServerError), resp.Code)
+
+			if !tc.expectedReport {
+				assert.Equal(t, "failed pushing to ingester: Fail", string(resp.Body))
+				require.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(""), "cortex_distributor_zone_write_requests_total"))
+				return
+			}
+
+			assert.Contains(t, string(resp.Body), "failed=ZONE-B,ZONE-C;")
+
+			test.Poll(t, time.Second, nil, func() interface{} {
+				return testutil.GatherAndCompare(regs[0], strings.NewReader(`
+					# HELP cortex_distributor_zone_write_requests_total The total number of write requests sent to ingesters, partitioned by zone and status. Tracked only when zone-awareness and the zone write report are enabled.
+					# TYPE cortex_distributor_zone_write_requests_total counter
+					cortex_distributor_zone_write_requests_total{status="success",user="user",zone="ZONE-A"} 1
+					cortex_distributor_zone_write_requests_total{status="failure",user="user",zone="ZONE-B"} 1
+					cortex_distributor_zone_write_requests_total{status="failure",user="user",zone="ZONE-C"} 1
+				`), "cortex_distributor_zone_write_requests_total")
+			})
+
+			// Remove the inactive user metrics.
+			ds[0].cleanupInactiveUser("user")
+			require.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(""), "cortex_distributor_zone_write_requests_total"))
+		})
+	}
+}
+
+func TestDistributor_Push_WriteAckLevel(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	for name, tc := range map[string]struct {
+		ackLevel         string
+		happyIngesters   int
+		expectedErr      bool
+		expectedAchieved string
+	}{
+		"quorum should succeed if a quorum of zones succeeded": {
+			ackLevel:         validation.WriteAckLevelQuorum,
+			happyIngesters:   2,
+			expectedAchieved: validation.WriteAckLevelQuorum,
+		},
+		"quorum should fail if a single zone succeeded": {
+			ackLevel:       validation.WriteAckLevelQuorum,
+			happyIngesters: 1,
+			expectedErr:    true,
+		},
+		"all-zones should succeed if all zones succeeded": {
+			ackLevel:         validation.WriteAckLevelAllZones,
+			happyIngesters:   3,
+			expectedAchieved: validation.WriteAckLevelAllZones,
+		},
+		"all-zones should fail if a single zone failed": {
+			ackLevel:       validation.WriteAckLevelAllZones,
+			happyIngesters: 2,
+			expectedErr:    true,
+		},
+		"any should succeed if a single zone succeeded": {
+			ackLevel:         validation.WriteAckLevelAny,
+			happyIngesters:   1,
+			expectedAchieved: validation.WriteAckLevelAny,
+		},
+		"any should fail if no zone succeeded": {
+			ackLevel:       validation.WriteAckLevelAny,
+			happyIngesters: 0,
+			expectedErr:    true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			limits := &validation.Limits{}
+			flagext.DefaultValues(limits)
+			limits.WriteAckLevel = tc.ackLevel
+
+			// The zone write report is disabled, to check the achieved level doesn't depend on it.
+			ds, _, _ := prepare(t, prepConfig{
+				numIngesters:    3,
+				happyIngesters:  tc.happyIngesters,
+				numDistributors: 1,
+				ingesterZones:   []string{"ZONE-A", "ZONE-B", "ZONE-C"},
+				limits:          limits,
+			})
+			require.False(t, ds[0].cfg.ZoneWriteReportEnabled)
+
+			body, err := makeWriteRequest(0, 1, 0, false, false).Marshal()
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/push", bytes.NewReader(snappy.Encode(nil, body))).WithContext(ctx)
+			req.Header.Set("Content-Encoding", "snappy")
+			req.Header.Set("Content-Type", "application/x-protobuf")
+
+			rec := httptest.NewRecorder()
+			push.Handler(100000, 0, nil, false, nil, ds[0].PushWithMiddlewares).ServeHTTP(rec, req)
+
+			if tc.expectedErr {
+				assert.NotEqual(t, http.StatusOK, rec.Code)
+				assert.Empty(t, rec.Header().Get(WriteAckLevelHeader))
+			} else {
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, tc.expectedAchieved, rec.Header().Get(WriteAckLevelHeader))
+			}
+		})
+	}
+}
+
 func TestDistributor_ContextCanceledRequest(t *testing.T) {
 	now := time.Now()
 	mtime.NowForce(now)
@@ -3509,6 +3645,8 @@ type prepConfig struct {
 	labelNamesStreamZonesResponseDelay map[string]time.Duration
 	forwarding                         bool
 	getForwarder                       func() forwarding.Forwarder
+	zoneWriteReportEnabled             bool
+	readOnlyTenantsEnabled             bool
 
 	timeOut bool
 }
@@ -3535,10 +3673,15 @@ func prepare(t *testing.T, cfg prepConfig) ([]*Distributor, []mockIngester, []*p
 		})
 	}
 	for i := cfg.happyIngesters; i < cfg.numIngesters; i++ {
+		zone := ""
+		if len(cfg.ingesterZones) > 0 {
+			zone = cfg.ingesterZones[i%len(cfg.ingesterZones)]
+		}
 		ingesters = append(ingesters, mockIngester{
 			queryDelay:       cfg.queryDelay,
 			pushDelay:        cfg.pushDelay,
 			seriesCountTotal: cfg.ingestersSeriesCountTotal,
+			zone:             zone,
 		})
 	}
 
@@ -3597,6 +3740,14 @@ func prepare(t *testing.T, cfg prepConfig) ([]*Distributor, []mockIngester, []*p
 		return ingestersByAddr[addr], nil
 	}
 
+	// The distributors share the KV store of the read-only tenants.
+	var readOnlyTenantsStore kv.Client
+	if cfg.readOnlyTenantsEnabled {
+		var closer io.Closer
+		readOnlyTenantsStore, closer = consul.NewInMemoryClient(readOnlyTenantsCodec{}, log.NewNopLogger(), nil)
+		t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+	}
+
 	distributors := make([]*Distributor, 0, cfg.numDistributors)
 	registries := make([]*prometheus.Registry, 0, cfg.numDistributors)
 	for i := 0; i < cfg.numDistributors; i++ {
@@ -3619,6 +3770,9 @@ func prepare(t *testing.T, cfg prepConfig) ([]*Distributor, []mockIngester, []*p
 		distributorCfg.DefaultLimits.MaxInflightPushRequestsBytes = cfg.maxInflightRequestsBytes
 		distributorCfg.DefaultLimits.MaxIngestionRate = cfg.maxIngestionRate
 		distributorCfg.ShuffleShardingLookbackPeriod = time.Hour
+		distributorCfg.ZoneWriteReportEnabled = cfg.zoneWriteReportEnabled
+		distributorCfg.ReadOnlyTenants.Enabled = cfg.readOnlyTenantsEnabled
+		distributorCfg.ReadOnlyTenants.KVStore.Mock = readOnlyTenantsStore
 
 		if cfg.forwarding {
 			distributorCfg.Forwarding.Enabled = true
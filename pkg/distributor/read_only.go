@@ -0,0 +1,241 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/kv"
+	"github.com/grafana/dskit/services"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+// readOnlyTenantsKey is the key under which the tenants put in read-only mode via the admin API are stored
+// in the KV store.
+const readOnlyTenantsKey = "tenants"
+
+var errReadOnlyTenantsMemberlistUnsupported = errors.New("memberlist is not supported by the read-only tenants KV store")
+
+// ReadOnlyTenantsConfig configures the admin API to put tenants in read-only mode.
+type ReadOnlyTenantsConfig struct {
+	Enabled bool      `yaml:"enabled" category:"experimental"`
+	KVStore kv.Config `yaml:"kvstore" doc:"description=Backend storage to use for the tenants put in read-only mode via the admin API. Memberlist is not supported."`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *ReadOnlyTenantsConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "distributor.read-only-tenants.enabled", false, "Enable the admin API to put tenants in read-only mode. The tenants are stored in the KV store, so that all distributors reject their write requests.")
+
+	// We customize the default keys prefix, in order to not clash with the ring
+	// and HA tracker keys if they share the same KV store backend.
+	cfg.KVStore.RegisterFlagsWithPrefix("distributor.read-only-tenants.", "read-only-tenants/", f)
+}
+
+// Validate config and returns error on failure
+func (cfg *ReadOnlyTenantsConfig) Validate() error {
+	if cfg.Enabled && cfg.KVStore.Store == "memberlist" {
+		return errReadOnlyTenantsMemberlistUnsupported
+	}
+	return nil
+}
+
+// readOnlyTenantsDesc is the list of tenants put in read-only mode via the admin API, as stored in the KV
+// store and returned by ReadOnlyTenantsHandler.
+type readOnlyTenantsDesc struct {
+	Tenants []string `json:"tenants"`
+}
+
+// readOnlyTenantsCodec encodes readOnlyTenantsDesc as JSON in the KV store.
+type readOnlyTenantsCodec struct{}
+
+func (readOnlyTenantsCodec) CodecID() string {
+	return "readOnlyTenants"
+}
+
+func (readOnlyTenantsCodec) Decode(data []byte) (interface{}, error) {
+	desc := &readOnlyTenantsDesc{}
+	if err := json.Unmarshal(data, desc); err != nil {
+		return nil, err
+	}
+	return desc, nil
+}
+
+func (readOnlyTenantsCodec) Encode(msg interface{}) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+// readOnlyTenantsTracker keeps track of the tenants put in read-only mode via the admin API. The tenants are
+// stored in the KV store, and each distributor watches them, so that all distributors enforce the same state.
+type readOnlyTenantsTracker struct {
+	services.Service
+
+	client kv.Client
+	logger log.Logger
+
+	tenantsMtx sync.RWMutex
+	tenants    map[string]struct{}
+}
+
+func newReadOnlyTenantsTracker(cfg ReadOnlyTenantsConfig, reg prometheus.Registerer, logger log.Logger) (*readOnlyTenantsTracker, error) {
+	client, err := kv.NewClient(
+		cfg.KVStore,
+		readOnlyTenantsCodec{},
+		kv.RegistererWithKVName(prometheus.WrapRegistererWithPrefix("cortex_", reg), "distributor-read-only-tenants"),
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &readOnlyTenantsTracker{
+		client:  client,
+		logger:  logger,
+		tenants: map[string]struct{}{},
+	}
+	t.Service = services.NewBasicService(t.starting, t.running, nil)
+	return t, nil
+}
+
+// starting loads the tenants from the KV store, so that the distributor enforces the read-only mode as soon
+// as it's running.
+func (t *readOnlyTenantsTracker) starting(ctx context.Context) error {
+	value, err := t.client.Get(ctx, readOnlyTenantsKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to load the read-only tenants from the KV store")
+	}
+	t.update(value)
+	return nil
+}
+
+func (t *readOnlyTenantsTracker) running(ctx context.Context) error {
+	t.client.WatchKey(ctx, readOnlyTenantsKey, func(value interface{}) bool {
+		t.update(value)
+		return true
+	})
+	return nil
+}
+
+// update replaces the tenants with the ones of the input value read from the KV store.
+func (t *readOnlyTenantsTracker) update(value interface{}) {
+	tenants := map[string]struct{}{}
+	if desc, ok := value.(*readOnlyTenantsDesc); ok && desc != nil {
+		for _, tenantID := range desc.Tenants {
+			tenants[tenantID] = struct{}{}
+		}
+	}
+
+	t.tenantsMtx.Lock()
+	t.tenants = tenants
+	t.tenantsMtx.Unlock()
+}
+
+func (t *readOnlyTenantsTracker) isReadOnly(userID string) bool {
+	t.tenantsMtx.RLock()
+	defer t.tenantsMtx.RUnlock()
+	_, ok := t.tenants[userID]
+	return ok
+}
+
+// setReadOnly puts the tenant in read-only mode, or takes it out of read-only mode, in the KV store.
+func (t *readOnlyTenantsTracker) setReadOnly(ctx context.Context, userID string, readOnly bool) error {
+	var updated *readOnlyTenantsDesc
+	err := t.client.CAS(ctx, readOnlyTenantsKey, func(in interface{}) (out interface{}, retry bool, err error) {
+		tenants := map[string]struct{}{}
+		if desc, ok := in.(*readOnlyTenantsDesc); ok && desc != nil {
+			for _, tenantID := range desc.Tenants {
+				tenants[tenantID] = struct{}{}
+			}
+		}
+
+		if _, ok := tenants[userID]; ok == readOnly {
+			// Nothing to update.
+			return nil, false, nil
+		}
+		if readOnly {
+			tenants[userID] = struct{}{}
+		} else {
+			delete(tenants, userID)
+		}
+
+		updated = &readOnlyTenantsDesc{Tenants: make([]string, 0, len(tenants))}
+		for tenantID := range tenants {
+			updated.Tenants = append(updated.Tenants, tenantID)
+		}
+		sort.Strings(updated.Tenants)
+		return updated, true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Don't wait for the KV store watch, so that this distributor immediately enforces the new state.
+	if updated != nil {
+		t.update(updated)
+	}
+	return nil
+}
+
+func (t *readOnlyTenantsTracker) list() []string {
+	t.tenantsMtx.RLock()
+	tenants := make([]string, 0, len(t.tenants))
+	for tenantID := range t.tenants {
+		tenants = append(tenants, tenantID)
+	}
+	t.tenantsMtx.RUnlock()
+
+	sort.Strings(tenants)
+	return tenants
+}
+
+// isTenantReadOnly returns whether the tenant is in read-only mode, either because of its
+// runtime configuration or because it has been put in read-only mode via the admin API.
+func (d *Distributor) isTenantReadOnly(userID string) bool {
+	if d.limits.ReadOnly(userID) {
+		return true
+	}
+	return d.readOnlyTenants != nil && d.readOnlyTenants.isReadOnly(userID)
+}
+
+// ReadOnlyTenantsHandler lists the tenants put in read-only mode via the admin API (GET), or puts a tenant
+// in read-only mode, or takes it out of read-only mode (POST with the "tenant" and "read_only" parameters).
+// The tenants are stored in the KV store, so that all distributors reject their write requests.
+func (d *Distributor) ReadOnlyTenantsHandler(w http.ResponseWriter, r *http.Request) {
+	if d.readOnlyTenants == nil {
+		http.Error(w, "the read-only tenants admin API is disabled", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		tenantID := r.FormValue("tenant")
+		if tenantID == "" {
+			http.Error(w, "the tenant parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		readOnly, err := strconv.ParseBool(r.FormValue("read_only"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid read_only parameter: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := d.readOnlyTenants.setReadOnly(r.Context(), tenantID, readOnly); err != nil {
+			level.Error(d.log).Log("msg", "failed to update the read-only tenants in the KV store", "tenant", tenantID, "read_only", readOnly, "err", err)
+			http.Error(w, fmt.Sprintf("failed to update the read-only tenants: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	util.WriteJSONResponse(w, readOnlyTenantsDesc{Tenants: d.readOnlyTenants.list()})
+}
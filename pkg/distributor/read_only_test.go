@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestDistributor_PushTenantReadOnly(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+	expectedErr := httpgrpc.Errorf(http.StatusLocked, validation.NewTenantReadOnlyError().Error())
+
+	t.Run("should reject writes of a tenant in read-only mode via runtime override", func(t *testing.T) {
+		limits := &validation.Limits{}
+		flagext.DefaultValues(limits)
+		limits.ReadOnly = true
+
+		distributors, _, _ := prepare(t, prepConfig{
+			numIngesters:    3,
+			happyIngesters:  3,
+			numDistributors: 1,
+			limits:          limits,
+		})
+
+		response, err := distributors[0].Push(ctx, makeWriteRequest(0, 1, 1, false, true))
+		assert.Nil(t, response)
+		assert.EqualError(t, err, expectedErr.Error())
+	})
+
+	t.Run("should reject writes of a tenant in read-only mode via admin API on all distributors until it's taken out of read-only mode", func(t *testing.T) {
+		distributors, _, _ := prepare(t, prepConfig{
+			numIngesters:           3,
+			happyIngesters:         3,
+			numDistributors:        2,
+			readOnlyTenantsEnabled: true,
+		})
+		d := distributors[0]
+
+		setReadOnly := func(tenant, readOnly string) *httptest.ResponseRecorder {
+			form := url.Values{"tenant": {tenant}, "read_only": {readOnly}}
+			req := httptest.NewRequest(http.MethodPost, "/distributor/read_only_tenants", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			d.ReadOnlyTenantsHandler(rec, req)
+			return rec
+		}
+
+		rec := setReadOnly("user", "true")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"tenants":["user"]}`, rec.Body.String())
+
+		response, err := d.Push(ctx, makeWriteRequest(0, 1, 1, false, true))
+		assert.Nil(t, response)
+		assert.EqualError(t, err, expectedErr.Error())
+
+		// The other distributors get the read-only tenants from the KV store.
+		test.Poll(t, time.Second, true, func() interface{} {
+			return distributors[1].isTenantReadOnly("user")
+		})
+		response, err = distributors[1].Push(ctx, makeWriteRequest(0, 1, 1, false, true))
+		assert.Nil(t, response)
+		assert.EqualError(t, err, expectedErr.Error())
+
+		// Writes of other tenants are accepted.
+		response, err = d.Push(user.InjectOrgID(context.Background(), "another-user"), makeWriteRequest(0, 1, 1, false, true))
+		assert.NoError(t, err)
+		assert.Equal(t, emptyResponse, response)
+
+		rec = setReadOnly("user", "false")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"tenants":[]}`, rec.Body.String())
+
+		response, err = d.Push(ctx, makeWriteRequest(0, 1, 1, false, true))
+		assert.NoError(t, err)
+		assert.Equal(t, emptyResponse, response)
+
+		test.Poll(t, time.Second, false, func() interface{} {
+			return distributors[1].isTenantReadOnly("user")
+		})
+	})
+
+	t.Run("should return 404 if the admin API is disabled", func(t *testing.T) {
+		distributors, _, _ := prepare(t, prepConfig{
+			numIngesters:    3,
+			happyIngesters:  3,
+			numDistributors: 1,
+		})
+
+		rec := httptest.NewRecorder()
+		distributors[0].ReadOnlyTenantsHandler(rec, httptest.NewRequest(http.MethodGet, "/distributor/read_only_tenants", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("should reject invalid admin API requests", func(t *testing.T) {
+		distributors, _, _ := prepare(t, prepConfig{
+			numIngesters:           3,
+			happyIngesters:         3,
+			numDistributors:        1,
+			readOnlyTenantsEnabled: true,
+		})
+
+		for _, query := range []string{"read_only=true", "tenant=user", "tenant=user&read_only=maybe"} {
+			rec := httptest.NewRecorder()
+			distributors[0].ReadOnlyTenantsHandler(rec, httptest.NewRequest(http.MethodPost, "/distributor/read_only_tenants?"+query, nil))
+			assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		}
+	})
+}
+
+func TestReadOnlyTenantsConfig_Validate(t *testing.T) {
+	cfg := ReadOnlyTenantsConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.KVStore.Store = "memberlist"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Enabled = true
+	assert.ErrorIs(t, cfg.Validate(), errReadOnlyTenantsMemberlistUnsupported)
+}
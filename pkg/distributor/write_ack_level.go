@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"fmt"
+
+	"github.com/grafana/dskit/ring"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// WriteAckLevelHeader is the HTTP response header containing the write acknowledgment level
+// achieved by a successful write request.
+const WriteAckLevelHeader = "X-Mimir-Write-Ack-Level"
+
+// writeAckLevelRing wraps a ring to change the number of replicas of each key which must
+// succeed for a write to succeed, according to the write acknowledgment level.
+type writeAckLevelRing struct {
+	ring.ReadRing
+	level string
+}
+
+// newWriteAckLevelRing returns a ring honoring the input write acknowledgment level. The quorum
+// level is the ring's default, so the input ring is returned as is.
+func newWriteAckLevelRing(r ring.ReadRing, level string) ring.ReadRing {
+	if level == validation.WriteAckLevelQuorum {
+		return r
+	}
+	return &writeAckLevelRing{ReadRing: r, level: level}
+}
+
+// Get implements ring.ReadRing.
+func (r *writeAckLevelRing) Get(key uint32, op ring.Operation, bufDescs []ring.InstanceDesc, bufHosts, bufZones []string) (ring.ReplicationSet, error) {
+	set, err := r.ReadRing.Get(key, op, bufDescs, bufHosts, bufZones)
+	if err != nil {
+		return set, err
+	}
+
+	switch r.level {
+	case validation.WriteAckLevelAllZones:
+		// The unhealthy replicas are filtered out by the ring, so they're checked here
+		// to not acknowledge a write which hasn't been sent to all the replicas.
+		if replicationFactor := r.ReadRing.ReplicationFactor(); len(set.Instances) < replicationFactor {
+			return ring.ReplicationSet{}, fmt.Errorf("write acknowledgment level %s requires %d live replicas, could only find %d", r.level, replicationFactor, len(set.Instances))
+		}
+		set.MaxErrors = 0
+		set.MaxUnavailableZones = 0
+	case validation.WriteAckLevelAny:
+		set.MaxErrors = len(set.Instances) - 1
+	}
+	return set, nil
+}
+
+// writeAckLevelRank returns the strength of the input write acknowledgment level.
+func writeAckLevelRank(level string) int {
+	switch level {
+	case validation.WriteAckLevelAny:
+		return 0
+	case validation.WriteAckLevelQuorum:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// achievedWriteAckLevel returns the write acknowledgment level achieved by a successful write request,
+// based on the zones which acknowledged the write when it returned. The achieved level is never weaker
+// than the requested one, and it can't be stronger if zone-awareness is disabled, because the
+// acknowledgments aren't tracked by zone.
+func achievedWriteAckLevel(requested string, report zoneWriteReport, replicationFactor int) string {
+	var achieved string
+	zones := len(report.acknowledged) + len(report.failed) + len(report.pending)
+
+	// The requests to some zones may not have been started yet when the write returned,
+	// so the quorum is computed on at least the replication factor.
+	quorum := zones/2 + 1
+	if replicationFactor > zones {
+		quorum = replicationFactor/2 + 1
+	}
+
+	switch {
+	case zones == 0:
+		return requested
+	case len(report.acknowledged) == zones && zones >= replicationFactor:
+		achieved = validation.WriteAckLevelAllZones
+	case len(report.acknowledged) >= quorum:
+		achieved = validation.WriteAckLevelQuorum
+	default:
+		achieved = validation.WriteAckLevelAny
+	}
+
+	if writeAckLevelRank(achieved) < writeAckLevelRank(requested) {
+		return requested
+	}
+	return achieved
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"testing"
+
+	"github.com/grafana/dskit/ring"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// mockWriteRing is a ring returning the same replication set for any key.
+type mockWriteRing struct {
+	ring.ReadRing
+	set               ring.ReplicationSet
+	replicationFactor int
+}
+
+func (r mockWriteRing) Get(uint32, ring.Operation, []ring.InstanceDesc, []string, []string) (ring.ReplicationSet, error) {
+	return r.set, nil
+}
+
+func (r mockWriteRing) ReplicationFactor() int {
+	return r.replicationFactor
+}
+
+func TestWriteAckLevelRing_Get(t *testing.T) {
+	instances := []ring.InstanceDesc{{Addr: "a", Zone: "zone-a"}, {Addr: "b", Zone: "zone-b"}, {Addr: "c", Zone: "zone-c"}}
+
+	for name, tc := range map[string]struct {
+		level               string
+		instances           []ring.InstanceDesc
+		expectedMaxErrors   int
+		expectedErrContains string
+	}{
+		"quorum should keep the ring's max errors": {
+			level:             validation.WriteAckLevelQuorum,
+			instances:         instances,
+			expectedMaxErrors: 1,
+		},
+		"all-zones should not tolerate any error": {
+			level:             validation.WriteAckLevelAllZones,
+			instances:         instances,
+			expectedMaxErrors: 0,
+		},
+		"all-zones should fail if a replica is unhealthy": {
+			level:               validation.WriteAckLevelAllZones,
+			instances:           instances[:2],
+			expectedErrContains: "requires 3 live replicas, could only find 2",
+		},
+		"any should require a single replica": {
+			level:             validation.WriteAckLevelAny,
+			instances:         instances,
+			expectedMaxErrors: 2,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := newWriteAckLevelRing(mockWriteRing{set: ring.ReplicationSet{Instances: tc.instances, MaxErrors: 1}, replicationFactor: 3}, tc.level)
+
+			set, err := r.Get(0, ring.WriteNoExtend, nil, nil, nil)
+			if tc.expectedErrContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErrContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedMaxErrors, set.MaxErrors)
+		})
+	}
+}
+
+func TestAchievedWriteAckLevel(t *testing.T) {
+	for name, tc := range map[string]struct {
+		requested string
+		report    zoneWriteReport
+		expected  string
+	}{
+		"should return the requested level if zone-awareness is disabled": {
+			requested: validation.WriteAckLevelAny,
+			report:    zoneWriteReport{},
+			expected:  validation.WriteAckLevelAny,
+		},
+		"should return all-zones if all zones acknowledged the write": {
+			requested: validation.WriteAckLevelQuorum,
+			report:    zoneWriteReport{acknowledged: []string{"zone-a", "zone-b", "zone-c"}},
+			expected:  validation.WriteAckLevelAllZones,
+		},
+		"should not return all-zones if less zones than the replication factor have been written": {
+			requested: validation.WriteAckLevelQuorum,
+			report:    zoneWriteReport{acknowledged: []string{"zone-a", "zone-b"}},
+			expected:  validation.WriteAckLevelQuorum,
+		},
+		"should return quorum if a quorum of zones acknowledged the write": {
+			requested: validation.WriteAckLevelAny,
+			report:    zoneWriteReport{acknowledged: []string{"zone-a", "zone-b"}, pending: []string{"zone-c"}},
+			expected:  validation.WriteAckLevelQuorum,
+		},
+		"should not return quorum if less zones than the quorum have been written": {
+			requested: validation.WriteAckLevelAny,
+			report:    zoneWriteReport{acknowledged: []string{"zone-a"}},
+			expected:  validation.WriteAckLevelAny,
+		},
+		"should return any if a single zone acknowledged the write": {
+			requested: validation.WriteAckLevelAny,
+			report:    zoneWriteReport{acknowledged: []string{"zone-a"}, failed: []string{"zone-b"}, pending: []string{"zone-c"}},
+			expected:  validation.WriteAckLevelAny,
+		},
+		"should never return a level weaker than the requested one": {
+			requested: validation.WriteAckLevelQuorum,
+			report:    zoneWriteReport{acknowledged: []string{"zone-a"}, pending: []string{"zone-b", "zone-c"}},
+			expected:  validation.WriteAckLevelQuorum,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, achievedWriteAckLevel(tc.requested, tc.report, 3))
+		})
+	}
+}
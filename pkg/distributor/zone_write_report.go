@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ZoneWriteReportHeader is the HTTP response header containing the zone write report, returned
+// when a write request hasn't been acknowledged by all zones.
+const ZoneWriteReportHeader = "X-Mimir-Zone-Write-Report"
+
+type zoneWriteState struct {
+	inflight int
+	failed   int
+}
+
+// zoneWriteTracker tracks the outcome of the requests sent to ingesters, partitioned by zone,
+// for a single write request. The per-zone metrics are tracked only if metrics is not nil.
+type zoneWriteTracker struct {
+	userID  string
+	metrics *prometheus.CounterVec
+
+	mtx   sync.Mutex
+	zones map[string]*zoneWriteState
+}
+
+func newZoneWriteTracker(userID string, metrics *prometheus.CounterVec) *zoneWriteTracker {
+	return &zoneWriteTracker{
+		userID:  userID,
+		metrics: metrics,
+		zones:   map[string]*zoneWriteState{},
+	}
+}
+
+// started tracks a request sent to an ingester in the input zone.
+func (t *zoneWriteTracker) started(zone string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	state, ok := t.zones[zone]
+	if !ok {
+		state = &zoneWriteState{}
+		t.zones[zone] = state
+	}
+	state.inflight++
+}
+
+// done tracks the outcome of a request sent to an ingester in the input zone.
+func (t *zoneWriteTracker) done(zone string, err error) {
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+	if t.metrics != nil {
+		t.metrics.WithLabelValues(t.userID, zone, status).Inc()
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	state := t.zones[zone]
+	state.inflight--
+	if err != nil {
+		state.failed++
+	}
+}
+
+// report returns a snapshot of which zones acknowledged the write so far.
+func (t *zoneWriteTracker) report() zoneWriteReport {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	r := zoneWriteReport{}
+	for zone, state := range t.zones {
+		switch {
+		case state.failed > 0:
+			r.failed = append(r.failed, zone)
+		case state.inflight > 0:
+			r.pending = append(r.pending, zone)
+		default:
+			r.acknowledged = append(r.acknowledged, zone)
+		}
+	}
+
+	sort.Strings(r.acknowledged)
+	sort.Strings(r.failed)
+	sort.Strings(r.pending)
+	return r
+}
+
+// zoneWriteReport summarizes which zones acknowledged a write request. A zone has acknowledged
+// the write if all ingesters in the zone succeeded, while it has failed if any ingester in the
+// zone failed. Pending zones have requests still in-flight at the time the report is taken.
+type zoneWriteReport struct {
+	acknowledged []string
+	failed       []string
+	pending      []string
+}
+
+// complete returns whether all zones acknowledged the write.
+func (r zoneWriteReport) complete() bool {
+	return len(r.failed) == 0 && len(r.pending) == 0
+}
+
+func (r zoneWriteReport) String() string {
+	return fmt.Sprintf("acknowledged=%s; failed=%s; pending=%s", strings.Join(r.acknowledged, ","), strings.Join(r.failed, ","), strings.Join(r.pending, ","))
+}
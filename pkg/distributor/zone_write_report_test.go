@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+)
+
+func TestZoneWriteTracker(t *testing.T) {
+	metrics := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"user", "zone", "status"})
+	tracker := newZoneWriteTracker("user", metrics)
+
+	tracker.started("zone-a")
+	tracker.started("zone-a")
+	tracker.started("zone-b")
+	tracker.started("zone-c")
+	tracker.started("zone-c")
+
+	tracker.done("zone-a", nil)
+	tracker.done("zone-b", nil)
+	tracker.done("zone-c", nil)
+
+	report := tracker.report()
+	assert.False(t, report.complete())
+	assert.Equal(t, "acknowledged=zone-b; failed=; pending=zone-a,zone-c", report.String())
+
+	tracker.done("zone-a", nil)
+	tracker.done("zone-c", errors.New("failed"))
+
+	report = tracker.report()
+	assert.False(t, report.complete())
+	assert.Equal(t, "acknowledged=zone-a,zone-b; failed=zone-c; pending=", report.String())
+}
+
+func TestReportZoneWrites(t *testing.T) {
+	complete := zoneWriteReport{acknowledged: []string{"zone-a", "zone-b"}}
+	partial := zoneWriteReport{acknowledged: []string{"zone-a"}, failed: []string{"zone-b"}}
+
+	t.Run("should return the input error if all zones acknowledged the write", func(t *testing.T) {
+		assert.NoError(t, reportZoneWrites(context.Background(), complete, nil))
+	})
+
+	t.Run("should not return an error if the write succeeded without all zones", func(t *testing.T) {
+		assert.NoError(t, reportZoneWrites(context.Background(), partial, nil))
+	})
+
+	t.Run("should add the report to an httpgrpc error", func(t *testing.T) {
+		err := reportZoneWrites(context.Background(), partial, httpgrpc.Errorf(http.StatusInternalServerError, "failed pushing to ingester"))
+
+		resp, ok := httpgrpc.HTTPResponseFromError(err)
+		require.True(t, ok)
+		assert.Equal(t, int32(http.StatusInternalServerError), resp.Code)
+		assert.Equal(t, "failed pushing to ingester (zones: acknowledged=zone-a; failed=zone-b; pending=)", string(resp.Body))
+	})
+
+	t.Run("should add the report to a generic error", func(t *testing.T) {
+		err := reportZoneWrites(context.Background(), partial, errors.New("failed pushing to ingester"))
+		assert.EqualError(t, err, "zones: acknowledged=zone-a; failed=zone-b; pending=: failed pushing to ingester")
+	})
+}
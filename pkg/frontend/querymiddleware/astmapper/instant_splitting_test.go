@@ -116,6 +116,16 @@ func TestInstantSplitter(t *testing.T) {
 			out:                  `label_replace(sum without() (` + concatOffsets(splitInterval, 3, false, `sum_over_time({app="foo"}[x]y)`) + `), "foo", "bar$1", "group_2", "(.*)")`,
 			expectedSplitQueries: 3,
 		},
+		{
+			in:                   `sum by (foo) (label_replace(sum_over_time({app="foo"}[3m]), "foo", "bar$1", "group_2", "(.*)"))`,
+			out:                  `sum by (foo) (label_replace(sum without() (` + concatOffsets(splitInterval, 3, false, `sum_over_time({app="foo"}[x]y)`) + `), "foo", "bar$1", "group_2", "(.*)"))`,
+			expectedSplitQueries: 3,
+		},
+		{
+			in:                   `label_replace(label_join(sum_over_time({app="foo"}[3m]), "foo", ",", "group_1", "group_2"), "bar", "$1", "foo", "(.*),.*")`,
+			out:                  `label_replace(label_join(sum without() (` + concatOffsets(splitInterval, 3, false, `sum_over_time({app="foo"}[x]y)`) + `), "foo", ",", "group_1", "group_2"), "bar", "$1", "foo", "(.*),.*")`,
+			expectedSplitQueries: 3,
+		},
 		{
 			in:                   `ln(sum_over_time({app="foo"}[3m]))`,
 			out:                  `ln(sum without() (` + concatOffsets(splitInterval, 3, false, `sum_over_time({app="foo"}[x]y)`) + `))`,
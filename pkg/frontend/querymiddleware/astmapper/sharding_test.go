@@ -346,6 +346,16 @@ func TestShardSummer(t *testing.T) {
 			)`,
 			3,
 		},
+		{
+			`sum by (foo) (label_replace(rate(up{job="api-server"}[1m]), "foo", "$1", "service", "(.*):.*"))`,
+			`sum by (foo) (` + concatShards(3, `sum by (foo) (label_replace(rate(up{__query_shard__="x_of_y",job="api-server"}[1m]), "foo", "$1", "service", "(.*):.*"))`) + `)`,
+			3,
+		},
+		{
+			`label_join(sum by (cluster, namespace) (up), "foo", "/", "cluster", "namespace") / 2`,
+			`label_join(sum by (cluster, namespace) (` + concatShards(3, `sum by (cluster, namespace) (up{__query_shard__="x_of_y"})`) + `), "foo", "/", "cluster", "namespace") / 2`,
+			3,
+		},
 		{
 			`sum by (job)(rate(http_requests_total[1h] @ end()))`,
 			`sum by (job)(` + concatShards(3, `sum by (job)(rate(http_requests_total{__query_shard__="x_of_y"}[1h] @ end()))`) + `)`,
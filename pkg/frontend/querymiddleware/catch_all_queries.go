@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// isNarrowingMatcher returns whether the matcher selects a subset of the series having the label. Negative
+// matchers, and matchers selecting any value, any non-empty value, or the series without the label, are not
+// narrowing.
+func isNarrowingMatcher(m *labels.Matcher) bool {
+	switch m.Type {
+	case labels.MatchEqual:
+		return m.Value != ""
+	case labels.MatchRegexp:
+		return !m.Matches("") && m.Value != ".+"
+	default:
+		return false
+	}
+}
+
+// isCatchAllSelector returns whether the input selector doesn't narrow the selected series by metric name.
+// If requireNarrowingMatcher is true, the selector is also required to not narrow the selected series
+// by any other label.
+func isCatchAllSelector(selector *parser.VectorSelector, requireNarrowingMatcher bool) bool {
+	for _, m := range selector.LabelMatchers {
+		if !isNarrowingMatcher(m) {
+			continue
+		}
+		if requireNarrowingMatcher || m.Name == model.MetricNameLabel {
+			return false
+		}
+	}
+	return true
+}
+
+// findCatchAllSelector returns the first catch-all selector of the input query, as defined by isCatchAllSelector,
+// or nil if the query contains none.
+func findCatchAllSelector(expr parser.Expr, requireNarrowingMatcher bool) *parser.VectorSelector {
+	var found *parser.VectorSelector
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if selector, ok := node.(*parser.VectorSelector); ok && found == nil && isCatchAllSelector(selector, requireNarrowingMatcher) {
+			found = selector
+		}
+		return nil
+	})
+	return found
+}
+
+type catchAllQueriesMiddleware struct {
+	next   Handler
+	limits Limits
+	logger log.Logger
+
+	catchAllQueries *prometheus.CounterVec
+}
+
+// newCatchAllQueriesMiddleware creates a new Middleware that detects the queries containing catch-all selectors,
+// such as {__name__=~".+"}, which are almost always accidental and very expensive, and rejects them or caps their
+// time range according to the per-tenant catch-all query policy.
+func newCatchAllQueriesMiddleware(limits Limits, logger log.Logger, registerer prometheus.Registerer) Middleware {
+	catchAllQueries := promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_catch_all_queries_total",
+		Help: "Total number of queries containing a catch-all selector which have been rejected or capped by the per-tenant catch-all query policy, by policy.",
+	}, []string{"policy"})
+
+	return MiddlewareFunc(func(next Handler) Handler {
+		return catchAllQueriesMiddleware{
+			next:            next,
+			limits:          limits,
+			logger:          logger,
+			catchAllQueries: catchAllQueries,
+		}
+	})
+}
+
+func (m catchAllQueriesMiddleware) Do(ctx context.Context, r Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	policy := validation.StrictestCatchAllQueryPolicyPerTenant(tenantIDs, m.limits.CatchAllQueryPolicy)
+	if policy == validation.CatchAllQueryPolicyAllow {
+		return m.next.Do(ctx, r)
+	}
+
+	// An invalid query is executed as it is: the error is returned by the downstream.
+	expr, err := parser.ParseExpr(r.GetQuery())
+	if err != nil {
+		return m.next.Do(ctx, r)
+	}
+
+	selector := findCatchAllSelector(expr, policy == validation.CatchAllQueryPolicyRequireNarrowingMatcher)
+	if selector == nil {
+		return m.next.Do(ctx, r)
+	}
+
+	if policy != validation.CatchAllQueryPolicyCapRange {
+		m.catchAllQueries.WithLabelValues(policy).Inc()
+		return nil, apierror.New(apierror.TypeBadData, validation.NewCatchAllQueryError(selector.String(), policy).Error())
+	}
+
+	maxRange := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, m.limits.CatchAllQueryMaxRange)
+	if maxRange <= 0 || r.GetEnd()-r.GetStart() <= maxRange.Milliseconds() {
+		return m.next.Do(ctx, r)
+	}
+
+	// Keep the capped start aligned to the steps of the original query.
+	start := r.GetEnd() - maxRange.Milliseconds()
+	if step := r.GetStep(); step > 0 {
+		if offset := (start - r.GetStart()) % step; offset != 0 {
+			start += step - offset
+		}
+	}
+
+	level.Debug(loggerWithQueryAttributes(ctx, m.logger)).Log(
+		"msg", "the start time of the query has been manipulated because the query contains a catch-all selector",
+		"selector", selector.String(),
+		"original", util.FormatTimeMillis(r.GetStart()),
+		"updated", util.FormatTimeMillis(start),
+		"catchAllQueryMaxRange", maxRange)
+
+	m.catchAllQueries.WithLabelValues(policy).Inc()
+	return m.next.Do(ctx, r.WithStartEnd(start, r.GetEnd()))
+}
@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestFindCatchAllSelector(t *testing.T) {
+	for query, expected := range map[string]struct {
+		catchAll                string
+		catchAllWithoutMatchers string
+	}{
+		`up`:                           {},
+		`{__name__="up"}`:              {},
+		`{__name__=~"up|down"}`:        {},
+		`{__name__=~".+"}`:             {catchAll: `{__name__=~".+"}`, catchAllWithoutMatchers: `{__name__=~".+"}`},
+		`{__name__!=""}`:               {catchAll: `{__name__!=""}`, catchAllWithoutMatchers: `{__name__!=""}`},
+		`{job!=""}`:                    {catchAll: `{job!=""}`, catchAllWithoutMatchers: `{job!=""}`},
+		`{job=~".+", instance!~"a.*"}`: {catchAll: `{instance!~"a.*",job=~".+"}`, catchAllWithoutMatchers: `{instance!~"a.*",job=~".+"}`},
+		`{job="api"}`:                  {catchAll: `{job="api"}`},
+		`{__name__=~".+", job="api"}`:  {catchAll: `{__name__=~".+",job="api"}`},
+		`{__name__=~".*", job="api"}`:  {catchAll: `{__name__=~".*",job="api"}`},
+		`sum(rate(up[5m])) / count({__name__=~".+"})`: {catchAll: `{__name__=~".+"}`, catchAllWithoutMatchers: `{__name__=~".+"}`},
+		`max_over_time(count({job!=""})[1h:5m]) > 1`:  {catchAll: `{job!=""}`, catchAllWithoutMatchers: `{job!=""}`},
+	} {
+		t.Run(query, func(t *testing.T) {
+			expr, err := parser.ParseExpr(query)
+			require.NoError(t, err)
+
+			for requireNarrowingMatcher, expectedSelector := range map[bool]string{false: expected.catchAll, true: expected.catchAllWithoutMatchers} {
+				selector := findCatchAllSelector(expr, requireNarrowingMatcher)
+				if expectedSelector == "" {
+					assert.Nil(t, selector, "require narrowing matcher: %t", requireNarrowingMatcher)
+				} else if assert.NotNil(t, selector, "require narrowing matcher: %t", requireNarrowingMatcher) {
+					assert.Equal(t, expectedSelector, selector.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCatchAllQueriesMiddleware(t *testing.T) {
+	const hour = int64(time.Hour / time.Millisecond)
+
+	rangeQuery := func(query string, start, end int64) *PrometheusRangeQueryRequest {
+		return &PrometheusRangeQueryRequest{Query: query, Start: start, End: end, Step: 60000}
+	}
+
+	for name, tc := range map[string]struct {
+		policy           string
+		request          Request
+		expectedErr      string
+		expectedStart    int64
+		expectedCounters string
+	}{
+		"should allow catch-all queries by default": {
+			request:       rangeQuery(`count({__name__=~".+"})`, 0, 24*hour),
+			expectedStart: 0,
+		},
+		"should reject catch-all queries with the reject policy": {
+			policy:      validation.CatchAllQueryPolicyReject,
+			request:     rangeQuery(`count({__name__=~".+", job="api"})`, 0, 24*hour),
+			expectedErr: `the query contains the catch-all selector {__name__=~".+",job="api"}`,
+			expectedCounters: `
+				cortex_query_frontend_catch_all_queries_total{policy="reject"} 1
+			`,
+		},
+		"should allow queries narrowing the metric name with the reject policy": {
+			policy:        validation.CatchAllQueryPolicyReject,
+			request:       rangeQuery(`sum(rate(http_requests_total{job!=""}[5m]))`, 0, 24*hour),
+			expectedStart: 0,
+		},
+		"should allow catch-all selectors narrowed by another label with the require-narrowing-matcher policy": {
+			policy:        validation.CatchAllQueryPolicyRequireNarrowingMatcher,
+			request:       rangeQuery(`count({__name__=~".+", job="api"})`, 0, 24*hour),
+			expectedStart: 0,
+		},
+		"should reject catch-all selectors not narrowed by any label with the require-narrowing-matcher policy": {
+			policy:      validation.CatchAllQueryPolicyRequireNarrowingMatcher,
+			request:     &PrometheusInstantQueryRequest{Query: `count({job!=""})`, Time: 24 * hour},
+			expectedErr: `the query contains the catch-all selector {job!=""}`,
+			expectedCounters: `
+				cortex_query_frontend_catch_all_queries_total{policy="require-narrowing-matcher"} 1
+			`,
+		},
+		"should cap the time range of catch-all queries with the cap-range policy": {
+			policy:        validation.CatchAllQueryPolicyCapRange,
+			request:       rangeQuery(`count({__name__=~".+"})`, 0, 24*hour),
+			expectedStart: 22 * hour,
+			expectedCounters: `
+				cortex_query_frontend_catch_all_queries_total{policy="cap-range"} 1
+			`,
+		},
+		"should keep the capped start time aligned to the query steps with the cap-range policy": {
+			policy:        validation.CatchAllQueryPolicyCapRange,
+			request:       rangeQuery(`count({__name__=~".+"})`, 30000, 24*hour),
+			expectedStart: 22*hour + 30000,
+			expectedCounters: `
+				cortex_query_frontend_catch_all_queries_total{policy="cap-range"} 1
+			`,
+		},
+		"should not cap the time range of catch-all queries shorter than the max range with the cap-range policy": {
+			policy:        validation.CatchAllQueryPolicyCapRange,
+			request:       rangeQuery(`count({__name__=~".+"})`, 23*hour, 24*hour),
+			expectedStart: 23 * hour,
+		},
+		"should not cap the time range of queries without catch-all selectors with the cap-range policy": {
+			policy:        validation.CatchAllQueryPolicyCapRange,
+			request:       rangeQuery(`count(up)`, 0, 24*hour),
+			expectedStart: 0,
+		},
+		"should execute invalid queries as they are": {
+			policy:        validation.CatchAllQueryPolicyReject,
+			request:       rangeQuery(`count({__name__=~".+"`, 0, 24*hour),
+			expectedStart: 0,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			limits := mockLimits{catchAllQueryPolicy: tc.policy, catchAllQueryMaxRange: 2 * time.Hour}
+			middleware := newCatchAllQueriesMiddleware(limits, log.NewNopLogger(), reg)
+
+			var executed Request
+			handler := HandlerFunc(func(_ context.Context, r Request) (Response, error) {
+				executed = r
+				return newEmptyPrometheusResponse(), nil
+			})
+
+			_, err := middleware.Wrap(handler).Do(user.InjectOrgID(context.Background(), "test"), tc.request)
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				assert.Nil(t, executed)
+			} else {
+				require.NoError(t, err)
+				require.NotNil(t, executed)
+				assert.Equal(t, tc.expectedStart, executed.GetStart())
+				assert.Equal(t, tc.request.GetEnd(), executed.GetEnd())
+			}
+
+			expectedMetrics := ""
+			if tc.expectedCounters != "" {
+				expectedMetrics = `
+					# HELP cortex_query_frontend_catch_all_queries_total Total number of queries containing a catch-all selector which have been rejected or capped by the per-tenant catch-all query policy, by policy.
+					# TYPE cortex_query_frontend_catch_all_queries_total counter
+				` + tc.expectedCounters
+			}
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expectedMetrics), "cortex_query_frontend_catch_all_queries_total"))
+		})
+	}
+}
+
+func TestCatchAllQueriesMiddleware_ShouldApplyTheStrictestPolicyOfMultipleTenants(t *testing.T) {
+	tenant.WithDefaultResolver(tenant.NewMultiResolver())
+	limits := multiTenantMockLimits{byTenant: map[string]mockLimits{
+		"tenant-a": {catchAllQueryPolicy: validation.CatchAllQueryPolicyCapRange, catchAllQueryMaxRange: time.Hour},
+		"tenant-b": {catchAllQueryPolicy: validation.CatchAllQueryPolicyReject},
+	}}
+	middleware := newCatchAllQueriesMiddleware(limits, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+	_, err := middleware.Wrap(mockHandlerWith(nil, nil)).Do(user.InjectOrgID(context.Background(), "tenant-a|tenant-b"), &PrometheusInstantQueryRequest{Query: `{__name__=~".+"}`})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "policy: reject")
+	assert.Contains(t, err.Error(), "err-mimir-catch-all-query")
+}
@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"golang.org/x/exp/slices"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+)
+
+const (
+	// chaosHeaderName is the header carrying the faults to inject into a request, as a comma-separated
+	// list of <key>=<value> entries. Supported keys are "latency", "error" and "probability".
+	chaosHeaderName = "X-Mimir-Chaos"
+
+	// chaosExpiresHeaderName is the header carrying the Unix timestamp, in seconds, after which the chaos header
+	// is rejected, so that a leaked signed header can't be replayed indefinitely.
+	chaosExpiresHeaderName = "X-Mimir-Chaos-Expires"
+
+	// chaosSignatureHeaderName is the header carrying the hex-encoded HMAC-SHA256 of
+	// "<tenant>:<chaos expires header>:<chaos header>", computed with the signing key configured in the query-frontend.
+	chaosSignatureHeaderName = "X-Mimir-Chaos-Signature"
+
+	chaosFaultLatency = "latency"
+	chaosFaultError   = "error"
+)
+
+// chaosErrorTypes are the types of the errors which can be injected.
+var chaosErrorTypes = []apierror.Type{
+	apierror.TypeTimeout,
+	apierror.TypeExec,
+	apierror.TypeBadData,
+	apierror.TypeInternal,
+	apierror.TypeUnavailable,
+	apierror.TypeTooManyRequests,
+	apierror.TypeTooLargeEntry,
+}
+
+// chaosSpec describes the faults to inject into a request.
+type chaosSpec struct {
+	latency     time.Duration
+	errorType   apierror.Type
+	probability float64
+}
+
+// parseChaosHeader parses the value of the chaos header.
+func parseChaosHeader(value string) (chaosSpec, error) {
+	spec := chaosSpec{probability: 1}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, val, ok := strings.Cut(entry, "=")
+		if !ok {
+			return chaosSpec{}, fmt.Errorf("invalid entry %q: expected format is <key>=<value>", entry)
+		}
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+
+		switch key {
+		case chaosFaultLatency:
+			d, err := model.ParseDuration(val)
+			if err != nil {
+				return chaosSpec{}, fmt.Errorf("invalid latency %q: %w", val, err)
+			}
+			spec.latency = time.Duration(d)
+		case chaosFaultError:
+			typ := apierror.Type(val)
+			if !slices.Contains(chaosErrorTypes, typ) {
+				return chaosSpec{}, fmt.Errorf("unsupported error type %q", val)
+			}
+			spec.errorType = typ
+		case "probability":
+			p, err := strconv.ParseFloat(val, 64)
+			if err != nil || p < 0 || p > 1 {
+				return chaosSpec{}, fmt.Errorf("invalid probability %q: must be a number between 0 and 1", val)
+			}
+			spec.probability = p
+		default:
+			return chaosSpec{}, fmt.Errorf("unsupported key %q", key)
+		}
+	}
+
+	if spec.latency == 0 && spec.errorType == "" {
+		return chaosSpec{}, fmt.Errorf("no fault to inject: at least one of %s and %s must be set", chaosFaultLatency, chaosFaultError)
+	}
+	return spec, nil
+}
+
+// chaosSignature returns the hex-encoded signature of the input chaos header value for the input tenant, expiring
+// at the input Unix timestamp. The tenant and the expiration are signed along with the header value, so that a signed
+// header can't be reused by other tenants nor after it expired.
+func chaosSignature(key []byte, tenantID string, expires int64, value string) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(tenantID + ":" + strconv.FormatInt(expires, 10) + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newChaosTripperware returns a Tripperware injecting the faults requested by the chaos header, for the tenants
+// which chaos injection is enabled for, so that clients can test how their dashboards and alerts behave when
+// Mimir is degraded. The chaos header must be signed with the input key, otherwise the request is rejected.
+func newChaosTripperware(signingKey string, limits Limits, logger log.Logger, registerer prometheus.Registerer) Tripperware {
+	injectedFaults := promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_chaos_injected_faults_total",
+		Help: "Total number of faults injected into the requests carrying a signed chaos header.",
+	}, []string{"user", "fault"})
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			value := r.Header.Get(chaosHeaderName)
+			if value == "" {
+				return next.RoundTrip(r)
+			}
+			signature := r.Header.Get(chaosSignatureHeaderName)
+			expiresValue := r.Header.Get(chaosExpiresHeaderName)
+
+			// Never forward the chaos headers downstream.
+			r = r.Clone(r.Context())
+			r.Header.Del(chaosHeaderName)
+			r.Header.Del(chaosExpiresHeaderName)
+			r.Header.Del(chaosSignatureHeaderName)
+
+			tenantIDs, err := tenant.TenantIDs(r.Context())
+			if err != nil {
+				return nil, err
+			}
+			userID := tenant.JoinTenantIDs(tenantIDs)
+
+			for _, tenantID := range tenantIDs {
+				if !limits.ChaosInjectionEnabled(tenantID) {
+					return nil, apierror.Newf(apierror.TypeBadData, "the %s header is not allowed: chaos injection is not enabled for tenant %s", chaosHeaderName, tenantID)
+				}
+			}
+
+			expires, err := strconv.ParseInt(expiresValue, 10, 64)
+			if err != nil {
+				return nil, apierror.Newf(apierror.TypeBadData, "the %s header is not allowed: invalid or missing %s header", chaosHeaderName, chaosExpiresHeaderName)
+			}
+
+			expected := chaosSignature([]byte(signingKey), userID, expires, value)
+			if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+				return nil, apierror.Newf(apierror.TypeBadData, "the %s header is not allowed: invalid or missing %s header", chaosHeaderName, chaosSignatureHeaderName)
+			}
+			if time.Now().Unix() > expires {
+				return nil, apierror.Newf(apierror.TypeBadData, "the %s header is not allowed: it expired at %s", chaosHeaderName, time.Unix(expires, 0).UTC().Format(time.RFC3339))
+			}
+
+			spec, err := parseChaosHeader(value)
+			if err != nil {
+				return nil, apierror.Newf(apierror.TypeBadData, "invalid %s header: %s", chaosHeaderName, err.Error())
+			}
+
+			if spec.probability < 1 && rand.Float64() >= spec.probability {
+				return next.RoundTrip(r)
+			}
+
+			level.Debug(logger).Log("msg", "injecting faults requested by the chaos header", "user", userID, "chaos", value)
+
+			if spec.latency > 0 {
+				injectedFaults.WithLabelValues(userID, chaosFaultLatency).Inc()
+
+				select {
+				case <-time.After(spec.latency):
+				case <-r.Context().Done():
+					return nil, r.Context().Err()
+				}
+			}
+
+			if spec.errorType != "" {
+				injectedFaults.WithLabelValues(userID, chaosFaultError).Inc()
+				return nil, apierror.Newf(spec.errorType, "fault injected by the %s header", chaosHeaderName)
+			}
+
+			return next.RoundTrip(r)
+		})
+	}
+}
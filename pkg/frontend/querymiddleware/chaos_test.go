@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+)
+
+func TestParseChaosHeader(t *testing.T) {
+	for value, testData := range map[string]struct {
+		expected    chaosSpec
+		expectedErr string
+	}{
+		"latency=2s": {
+			expected: chaosSpec{latency: 2 * time.Second, probability: 1},
+		},
+		"error=unavailable": {
+			expected: chaosSpec{errorType: apierror.TypeUnavailable, probability: 1},
+		},
+		" latency = 500ms , error=timeout, probability=0.25 ": {
+			expected: chaosSpec{latency: 500 * time.Millisecond, errorType: apierror.TypeTimeout, probability: 0.25},
+		},
+		"probability=0.5": {
+			expectedErr: "no fault to inject",
+		},
+		"latency": {
+			expectedErr: "expected format is <key>=<value>",
+		},
+		"latency=fast": {
+			expectedErr: "invalid latency",
+		},
+		"error=canceled": {
+			expectedErr: "unsupported error type",
+		},
+		"error=internal,probability=2": {
+			expectedErr: "invalid probability",
+		},
+		"status=503": {
+			expectedErr: "unsupported key",
+		},
+	} {
+		t.Run(value, func(t *testing.T) {
+			actual, err := parseChaosHeader(value)
+			if testData.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), testData.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testData.expected, actual)
+		})
+	}
+}
+
+func TestChaosTripperware(t *testing.T) {
+	const signingKey = "secret"
+
+	tenant.WithDefaultResolver(tenant.NewMultiResolver())
+	limits := multiTenantMockLimits{byTenant: map[string]mockLimits{
+		"enabled-1": {chaosInjectionEnabled: true},
+		"enabled-2": {chaosInjectionEnabled: true},
+		"disabled":  {},
+	}}
+
+	expires := time.Now().Add(time.Hour).Unix()
+	expired := time.Now().Add(-time.Minute).Unix()
+
+	tests := map[string]struct {
+		tenantID      string
+		chaos         string
+		expires       string
+		signature     string
+		expectedErr   string
+		expectedCode  int
+		expectedFault string
+		minDuration   time.Duration
+	}{
+		"should forward requests without the chaos header": {
+			tenantID:     "disabled",
+			expectedCode: http.StatusOK,
+		},
+		"should inject an error": {
+			tenantID:      "enabled-1",
+			chaos:         "error=too_many_requests",
+			signature:     chaosSignature([]byte(signingKey), "enabled-1", expires, "error=too_many_requests"),
+			expectedErr:   "fault injected by the X-Mimir-Chaos header",
+			expectedCode:  http.StatusTooManyRequests,
+			expectedFault: chaosFaultError,
+		},
+		"should inject latency": {
+			tenantID:      "enabled-1",
+			chaos:         "latency=50ms",
+			signature:     chaosSignature([]byte(signingKey), "enabled-1", expires, "latency=50ms"),
+			expectedCode:  http.StatusOK,
+			expectedFault: chaosFaultLatency,
+			minDuration:   50 * time.Millisecond,
+		},
+		"should accept an upper case signature": {
+			tenantID:      "enabled-1",
+			chaos:         "latency=1ms",
+			signature:     strings.ToUpper(chaosSignature([]byte(signingKey), "enabled-1", expires, "latency=1ms")),
+			expectedCode:  http.StatusOK,
+			expectedFault: chaosFaultLatency,
+		},
+		"should inject faults for multiple tenants, if enabled for all of them": {
+			tenantID:      "enabled-1|enabled-2",
+			chaos:         "error=internal",
+			signature:     chaosSignature([]byte(signingKey), "enabled-1|enabled-2", expires, "error=internal"),
+			expectedErr:   "fault injected by the X-Mimir-Chaos header",
+			expectedCode:  http.StatusInternalServerError,
+			expectedFault: chaosFaultError,
+		},
+		"should not inject faults if the probability is 0": {
+			tenantID:     "enabled-1",
+			chaos:        "error=internal,probability=0",
+			signature:    chaosSignature([]byte(signingKey), "enabled-1", expires, "error=internal,probability=0"),
+			expectedCode: http.StatusOK,
+		},
+		"should reject the chaos header if chaos injection is not enabled for the tenant": {
+			tenantID:     "disabled",
+			chaos:        "error=internal",
+			signature:    chaosSignature([]byte(signingKey), "disabled", expires, "error=internal"),
+			expectedErr:  "chaos injection is not enabled for tenant disabled",
+			expectedCode: http.StatusBadRequest,
+		},
+		"should reject the chaos header if chaos injection is not enabled for any of the tenants": {
+			tenantID:     "enabled-1|disabled",
+			chaos:        "error=internal",
+			signature:    chaosSignature([]byte(signingKey), "disabled|enabled-1", expires, "error=internal"),
+			expectedErr:  "chaos injection is not enabled for tenant disabled",
+			expectedCode: http.StatusBadRequest,
+		},
+		"should reject the chaos header if the signature is missing": {
+			tenantID:     "enabled-1",
+			chaos:        "error=internal",
+			expectedErr:  "invalid or missing X-Mimir-Chaos-Signature header",
+			expectedCode: http.StatusBadRequest,
+		},
+		"should reject the chaos header if it's signed with another key": {
+			tenantID:     "enabled-1",
+			chaos:        "error=internal",
+			signature:    chaosSignature([]byte("other"), "enabled-1", expires, "error=internal"),
+			expectedErr:  "invalid or missing X-Mimir-Chaos-Signature header",
+			expectedCode: http.StatusBadRequest,
+		},
+		"should reject the chaos header if it's signed for another tenant": {
+			tenantID:     "enabled-1",
+			chaos:        "error=internal",
+			signature:    chaosSignature([]byte(signingKey), "enabled-2", expires, "error=internal"),
+			expectedErr:  "invalid or missing X-Mimir-Chaos-Signature header",
+			expectedCode: http.StatusBadRequest,
+		},
+		"should reject the chaos header if the expiration is missing": {
+			tenantID:     "enabled-1",
+			chaos:        "error=internal",
+			expires:      "-",
+			signature:    chaosSignature([]byte(signingKey), "enabled-1", expires, "error=internal"),
+			expectedErr:  "invalid or missing X-Mimir-Chaos-Expires header",
+			expectedCode: http.StatusBadRequest,
+		},
+		"should reject the chaos header if the expiration has been changed after signing": {
+			tenantID:     "enabled-1",
+			chaos:        "error=internal",
+			expires:      strconv.FormatInt(expires+3600, 10),
+			signature:    chaosSignature([]byte(signingKey), "enabled-1", expires, "error=internal"),
+			expectedErr:  "invalid or missing X-Mimir-Chaos-Signature header",
+			expectedCode: http.StatusBadRequest,
+		},
+		"should reject the chaos header if it expired": {
+			tenantID:     "enabled-1",
+			chaos:        "error=internal",
+			expires:      strconv.FormatInt(expired, 10),
+			signature:    chaosSignature([]byte(signingKey), "enabled-1", expired, "error=internal"),
+			expectedErr:  "the X-Mimir-Chaos header is not allowed: it expired at",
+			expectedCode: http.StatusBadRequest,
+		},
+		"should reject an invalid chaos header": {
+			tenantID:     "enabled-1",
+			chaos:        "error=unknown",
+			signature:    chaosSignature([]byte(signingKey), "enabled-1", expires, "error=unknown"),
+			expectedErr:  "invalid X-Mimir-Chaos header: unsupported error type",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+
+			var downstreamReq *http.Request
+			roundTripper := newChaosTripperware(signingKey, limits, log.NewNopLogger(), reg)(RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+				downstreamReq = r
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			}))
+
+			req := httptest.NewRequest("GET", "/api/v1/query?query=up", nil)
+			if testData.chaos != "" {
+				req.Header.Set(chaosHeaderName, testData.chaos)
+
+				// The header expires in the future, unless specified otherwise.
+				switch testData.expires {
+				case "":
+					req.Header.Set(chaosExpiresHeaderName, strconv.FormatInt(expires, 10))
+				case "-":
+				default:
+					req.Header.Set(chaosExpiresHeaderName, testData.expires)
+				}
+			}
+			if testData.signature != "" {
+				req.Header.Set(chaosSignatureHeaderName, testData.signature)
+			}
+			req = req.WithContext(user.InjectOrgID(req.Context(), testData.tenantID))
+
+			start := time.Now()
+			res, err := roundTripper.RoundTrip(req)
+			assert.GreaterOrEqual(t, time.Since(start), testData.minDuration)
+
+			if testData.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), testData.expectedErr)
+
+				errRes, ok := apierror.HTTPResponseFromError(err)
+				require.True(t, ok)
+				assert.Equal(t, int32(testData.expectedCode), errRes.Code)
+				assert.Nil(t, downstreamReq)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, testData.expectedCode, res.StatusCode)
+
+				// The chaos headers must not be forwarded downstream.
+				require.NotNil(t, downstreamReq)
+				assert.Empty(t, downstreamReq.Header.Get(chaosHeaderName))
+				assert.Empty(t, downstreamReq.Header.Get(chaosExpiresHeaderName))
+				assert.Empty(t, downstreamReq.Header.Get(chaosSignatureHeaderName))
+			}
+
+			expectedFaults := map[string]float64{}
+			if testData.expectedFault != "" {
+				expectedFaults[testData.expectedFault] = 1
+			}
+
+			families, err := reg.Gather()
+			require.NoError(t, err)
+
+			actualFaults := map[string]float64{}
+			for _, family := range families {
+				for _, m := range family.GetMetric() {
+					for _, l := range m.GetLabel() {
+						if l.GetName() == "fault" {
+							actualFaults[l.GetValue()] = m.GetCounter().GetValue()
+						}
+					}
+				}
+			}
+			assert.Equal(t, expectedFaults, actualFaults)
+		})
+	}
+
+	t.Run("should stop waiting for the injected latency if the request is canceled", func(t *testing.T) {
+		roundTripper := newChaosTripperware(signingKey, limits, log.NewNopLogger(), prometheus.NewPedanticRegistry())(RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}))
+
+		ctx, cancel := context.WithTimeout(user.InjectOrgID(context.Background(), "enabled-1"), 10*time.Millisecond)
+		defer cancel()
+
+		req := httptest.NewRequest("GET", "/api/v1/query?query=up", nil).WithContext(ctx)
+		req.Header.Set(chaosHeaderName, "latency=1m")
+		req.Header.Set(chaosExpiresHeaderName, strconv.FormatInt(expires, 10))
+		req.Header.Set(chaosSignatureHeaderName, chaosSignature([]byte(signingKey), "enabled-1", expires, "latency=1m"))
+
+		_, err := roundTripper.RoundTrip(req)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -40,11 +40,13 @@ import (
 var (
 	errEndBeforeStart = apierror.New(apierror.TypeBadData, `invalid parameter "end": end timestamp must not be before start time`)
 	errNegativeStep   = apierror.New(apierror.TypeBadData, `invalid parameter "step": zero or negative query resolution step widths are not accepted. Try a positive integer`)
-	errStepTooSmall   = apierror.New(apierror.TypeBadData, "exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)")
 	allFormats        = []string{formatJSON, formatProtobuf}
 )
 
 const (
+	// maxPointsPerSeries is the maximum number of points per series a range query can return.
+	maxPointsPerSeries = 11000
+
 	// statusSuccess Prometheus success result.
 	statusSuccess = "success"
 	// statusSuccess Prometheus error result.
@@ -246,8 +248,8 @@ func (prometheusCodec) decodeRangeQueryRequest(r *http.Request) (Request, error)
 
 	// For safety, limit the number of returned points per timeseries.
 	// This is sufficient for 60s resolution for a week or 1h resolution for a year.
-	if (result.End-result.Start)/result.Step > 11000 {
-		return nil, errStepTooSmall
+	if (result.End-result.Start)/result.Step > maxPointsPerSeries {
+		return nil, newStepTooSmallError(result.Start, result.End, result.Step)
 	}
 
 	result.Query = r.FormValue("query")
@@ -370,6 +372,11 @@ func (c prometheusCodec) DecodeResponse(ctx context.Context, r *http.Response, _
 	}
 	log.LogFields(otlog.Int("bytes", len(buf)))
 
+	// Account the response body, which is retained in memory until the query has been merged.
+	if err := queryMemoryTrackerFromContext(ctx).add(len(buf)); err != nil {
+		return nil, err
+	}
+
 	contentType := r.Header.Get("Content-Type")
 	formatter := findFormatter(contentType)
 	if formatter == nil {
@@ -599,6 +606,17 @@ func encodeDurationMs(d int64) string {
 	return strconv.FormatFloat(float64(d)/float64(time.Second/time.Millisecond), 'f', -1, 64)
 }
 
+// newStepTooSmallError returns the error for a range query exceeding maxPointsPerSeries, suggesting the
+// smallest step (rounded up to the second) and the largest time range the query would be accepted with.
+func newStepTooSmallError(start, end, step int64) error {
+	minStep := (end-start)/(maxPointsPerSeries+1) + 1
+	minStep = ((minStep + 999) / 1000) * 1000
+	maxRange := step * maxPointsPerSeries
+
+	return apierror.Newf(apierror.TypeBadData, "exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX): retry with step >= %s or range <= %s",
+		model.Duration(time.Duration(minStep)*time.Millisecond), model.Duration(time.Duration(maxRange)*time.Millisecond))
+}
+
 func decorateWithParamName(err error, field string) error {
 	errTmpl := "invalid parameter %q: %v"
 	if status, ok := status.FromError(err); ok {
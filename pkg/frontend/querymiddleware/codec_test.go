@@ -84,7 +84,11 @@ func TestRequest(t *testing.T) {
 		},
 		{
 			url:         "api/v1/query_range?start=0&end=11001&step=1",
-			expectedErr: errStepTooSmall,
+			expectedErr: apierror.New(apierror.TypeBadData, "exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX): retry with step >= 2s or range <= 3h3m20s"),
+		},
+		{
+			url:         "api/v1/query_range?start=0&end=1209600&step=15",
+			expectedErr: apierror.New(apierror.TypeBadData, "exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX): retry with step >= 1m50s or range <= 1d21h50m"),
 		},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
@@ -0,0 +1,352 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+// Provenance-includes-location: https://github.com/prometheus/prometheus/web/federate.go
+// Provenance-includes-license: Apache-2.0
+// Provenance-includes-copyright: The Prometheus Authors.
+
+package querymiddleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/grafana/dskit/cache"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	federationPathSuffix = "/federate"
+	federationMatchParam = "match[]"
+
+	// federationDefaultLookbackDelta is the time range in which the latest sample of each series is looked up,
+	// if the lookback delta of the PromQL engine is not set. It's the default of the PromQL engine.
+	federationDefaultLookbackDelta = 5 * time.Minute
+
+	federationCacheHit      = "hit"
+	federationCacheMiss     = "miss"
+	federationCacheDisabled = "disabled"
+)
+
+type federationMetrics struct {
+	requestsTotal  *prometheus.CounterVec
+	seriesReturned prometheus.Histogram
+}
+
+func newFederationMetrics(registerer prometheus.Registerer) *federationMetrics {
+	return &federationMetrics{
+		requestsTotal: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_federation_requests_total",
+			Help: "Total number of /federate requests received by the query-frontend, by results cache outcome.",
+		}, []string{"cache"}),
+		seriesReturned: promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
+			Name:    "cortex_query_frontend_federation_series_returned",
+			Help:    "Number of series returned by the /federate requests served by the query-frontend.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+		}),
+	}
+}
+
+// federationRoundTripper serves the Prometheus /federate endpoint. Each selector of the match[] parameters is run
+// as an instant query through the next round tripper, which is expected to be the instant queries middleware chain,
+// so that the federation requests are subject to the same limits and instrumentation of the instant queries.
+// Like Prometheus, the latest raw sample of each series within the lookback delta is federated, along with its own
+// timestamp. The merged series are cached for a short TTL, and encoded in the exposition format negotiated with the
+// client.
+type federationRoundTripper struct {
+	next          http.RoundTripper
+	codec         Codec
+	limits        Limits
+	cache         cache.Cache
+	lookbackDelta time.Duration
+	logger        log.Logger
+	metrics       *federationMetrics
+}
+
+func newFederationRoundTripper(next http.RoundTripper, codec Codec, limits Limits, c cache.Cache, lookbackDelta time.Duration, logger log.Logger, metrics *federationMetrics) http.RoundTripper {
+	if lookbackDelta == 0 {
+		lookbackDelta = federationDefaultLookbackDelta
+	}
+
+	return &federationRoundTripper{
+		next:          next,
+		codec:         codec,
+		limits:        limits,
+		cache:         c,
+		lookbackDelta: lookbackDelta,
+		logger:        logger,
+		metrics:       metrics,
+	}
+}
+
+func (f *federationRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	spanLog, ctx := spanlogger.NewWithLogger(r.Context(), f.logger, "federationRoundTripper.RoundTrip")
+	defer spanLog.Finish()
+
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, apierror.Newf(apierror.TypeBadData, "error parsing form values: %v", err)
+	}
+	selectors, err := parseFederationSelectors(r.Form[federationMatchParam])
+	if err != nil {
+		return nil, err
+	}
+
+	cacheKey := generateFederationCacheKey(tenant.JoinTenantIDs(tenantIDs), selectors)
+	cacheTTL := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, f.limits.FederationResultsCacheTTL)
+	cacheEnabled := f.cache != nil && cacheTTL > 0 && !federationCacheDisabledByRequest(r)
+
+	var series []SampleStream
+	switch {
+	case !cacheEnabled:
+		f.metrics.requestsTotal.WithLabelValues(federationCacheDisabled).Inc()
+		if series, err = f.runSelectors(ctx, r, selectors); err != nil {
+			return nil, err
+		}
+
+	default:
+		var cached bool
+		if series, cached = f.fetchCachedSeries(ctx, cacheKey); cached {
+			f.metrics.requestsTotal.WithLabelValues(federationCacheHit).Inc()
+			break
+		}
+
+		f.metrics.requestsTotal.WithLabelValues(federationCacheMiss).Inc()
+		if series, err = f.runSelectors(ctx, r, selectors); err != nil {
+			return nil, err
+		}
+		f.storeCachedSeries(cacheKey, series, cacheTTL)
+	}
+
+	f.metrics.seriesReturned.Observe(float64(len(series)))
+	level.Debug(spanLog).Log("msg", "federation request completed", "selectors", len(selectors), "series", len(series), "cache_enabled", cacheEnabled)
+
+	format := expfmt.Negotiate(r.Header)
+	body, err := encodeFederationSeries(series, format)
+	if err != nil {
+		return nil, apierror.Newf(apierror.TypeInternal, "error encoding federation response: %v", err)
+	}
+
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": []string{string(format)}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+// runSelectors runs each selector as a range vector selector over the lookback delta, with an instant query at
+// the current time, and returns the union of the series returned with their latest sample, sorted by metric name
+// and labels. The range vector selector returns the raw samples, so that the latest sample of each series is
+// federated with its own timestamp instead of the query time. Series matched by multiple selectors are returned once.
+func (f *federationRoundTripper) runSelectors(ctx context.Context, r *http.Request, selectors []string) ([]SampleStream, error) {
+	var (
+		ts      = strconv.FormatFloat(float64(time.Now().UnixMilli())/1000, 'f', -1, 64)
+		path    = strings.TrimSuffix(r.URL.Path, federationPathSuffix) + "/api/v1" + instantQueryPathSuffix
+		window  = "[" + model.Duration(f.lookbackDelta).String() + "]"
+		seen    = map[string]struct{}{}
+		results []SampleStream
+	)
+
+	for _, selector := range selectors {
+		// The selectors have been validated, so they're plain vector selectors, without offset or @ modifiers.
+		query := url.Values{"query": []string{selector + window}, "time": []string{ts}}
+		subreq, err := http.NewRequestWithContext(ctx, http.MethodGet, (&url.URL{Path: path, RawQuery: query.Encode()}).String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		subreq.Header = r.Header.Clone()
+		subreq.Header.Set("Accept", jsonMimeType)
+
+		res, err := f.next.RoundTrip(subreq)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded, err := f.decodeInstantQueryResponse(ctx, res)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range decoded.Data.Result {
+			// Native histograms can't be represented in every exposition format, so only float samples are federated.
+			if len(s.Samples) == 0 {
+				continue
+			}
+
+			key := mimirpb.FromLabelAdaptersToLabels(s.Labels).String()
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			results = append(results, SampleStream{Labels: s.Labels, Samples: s.Samples[len(s.Samples)-1:]})
+		}
+	}
+
+	// Sort by metric name first, so that the series of the same metric family are contiguous.
+	sort.Slice(results, func(i, j int) bool {
+		li, lj := mimirpb.FromLabelAdaptersToLabels(results[i].Labels), mimirpb.FromLabelAdaptersToLabels(results[j].Labels)
+		if ni, nj := li.Get(labels.MetricName), lj.Get(labels.MetricName); ni != nj {
+			return ni < nj
+		}
+		return labels.Compare(li, lj) < 0
+	})
+	return results, nil
+}
+
+// decodeInstantQueryResponse decodes the response of a selector query. Errors, for example because of
+// the limits, are propagated as returned by the instant query.
+func (f *federationRoundTripper) decodeInstantQueryResponse(ctx context.Context, res *http.Response) (*PrometheusResponse, error) {
+	defer func() { _ = res.Body.Close() }()
+
+	decoded, err := f.codec.DecodeResponse(ctx, res, nil, f.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	promRes, ok := decoded.(*PrometheusResponse)
+	if !ok || promRes.Data == nil {
+		return nil, apierror.New(apierror.TypeInternal, "unexpected response to a federation selector query")
+	}
+	return promRes, nil
+}
+
+func (f *federationRoundTripper) fetchCachedSeries(ctx context.Context, key string) ([]SampleStream, bool) {
+	found := f.cache.Fetch(ctx, []string{key})
+	buf, ok := found[key]
+	if !ok {
+		return nil, false
+	}
+
+	cached := &PrometheusData{}
+	if err := proto.Unmarshal(buf, cached); err != nil {
+		level.Warn(f.logger).Log("msg", "failed to unmarshal cached federation response", "err", err)
+		return nil, false
+	}
+	return cached.Result, true
+}
+
+func (f *federationRoundTripper) storeCachedSeries(key string, series []SampleStream, ttl time.Duration) {
+	buf, err := proto.Marshal(&PrometheusData{ResultType: "vector", Result: series})
+	if err != nil {
+		level.Warn(f.logger).Log("msg", "failed to marshal federation response to cache", "err", err)
+		return
+	}
+
+	// The store is executed asynchronously, potential errors are logged and not
+	// propagated back up the stack.
+	f.cache.StoreAsync(map[string][]byte{key: buf}, ttl)
+}
+
+// parseFederationSelectors validates the input match[] selectors, and returns them sorted and deduplicated.
+func parseFederationSelectors(values []string) ([]string, error) {
+	if len(values) == 0 {
+		return nil, apierror.New(apierror.TypeBadData, "no match[] parameter provided")
+	}
+
+	selectors := make([]string, 0, len(values))
+	for _, s := range values {
+		if _, err := parser.ParseMetricSelector(s); err != nil {
+			return nil, apierror.Newf(apierror.TypeBadData, "invalid match[] parameter %q: %v", s, err)
+		}
+		selectors = append(selectors, s)
+	}
+
+	sort.Strings(selectors)
+	return uniqueStrings(selectors), nil
+}
+
+func uniqueStrings(sorted []string) []string {
+	out := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// federationCacheDisabledByRequest returns whether the client asked to not use cached results.
+func federationCacheDisabledByRequest(r *http.Request) bool {
+	for _, value := range r.Header.Values(cacheControlHeader) {
+		if strings.Contains(value, noStoreValue) {
+			return true
+		}
+	}
+	return false
+}
+
+func generateFederationCacheKey(userID string, selectors []string) string {
+	// Prefix key with `FD` (short for "federation").
+	return fmt.Sprintf("FD:%s:%s", userID, cacheHashKey(strings.Join(selectors, "\n")))
+}
+
+// encodeFederationSeries encodes the input series, sorted by metric name, in the input exposition format.
+// Like Prometheus, the series are exposed as untyped metrics, because the metric type is not known.
+func encodeFederationSeries(series []SampleStream, format expfmt.Format) ([]byte, error) {
+	var (
+		buf    bytes.Buffer
+		enc    = expfmt.NewEncoder(&buf, format)
+		family *dto.MetricFamily
+	)
+
+	for _, s := range series {
+		var (
+			name   string
+			metric = &dto.Metric{}
+		)
+		for _, l := range s.Labels {
+			if l.Name == labels.MetricName {
+				name = l.Value
+				continue
+			}
+			metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(l.Name), Value: proto.String(l.Value)})
+		}
+
+		sample := s.Samples[len(s.Samples)-1]
+		metric.Untyped = &dto.Untyped{Value: proto.Float64(sample.Value)}
+		metric.TimestampMs = proto.Int64(sample.TimestampMs)
+
+		if family == nil || family.GetName() != name {
+			if family != nil {
+				if err := enc.Encode(family); err != nil {
+					return nil, err
+				}
+			}
+			family = &dto.MetricFamily{Name: proto.String(name), Type: dto.MetricType_UNTYPED.Enum()}
+		}
+		family.Metric = append(family.Metric, metric)
+	}
+
+	if family != nil {
+		if err := enc.Encode(family); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,321 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+// federationDownstream is a fake instant query round tripper, returning the configured JSON matrix by query.
+type federationDownstream struct {
+	mx       sync.Mutex
+	results  map[string]string
+	requests []*http.Request
+}
+
+func (d *federationDownstream) RoundTrip(r *http.Request) (*http.Response, error) {
+	d.mx.Lock()
+	d.requests = append(d.requests, r)
+	d.mx.Unlock()
+
+	result, ok := d.results[r.URL.Query().Get("query")]
+	if !ok {
+		result = "[]"
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{jsonMimeType}},
+		Body:       io.NopCloser(strings.NewReader(`{"status":"success","data":{"resultType":"matrix","result":` + result + `}}`)),
+	}, nil
+}
+
+func (d *federationDownstream) queries() []string {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	queries := make([]string, 0, len(d.requests))
+	for _, r := range d.requests {
+		queries = append(queries, r.URL.Query().Get("query"))
+	}
+	return queries
+}
+
+func newFederationRequest(t *testing.T, accept string, headers http.Header, selectors ...string) *http.Request {
+	query := url.Values{federationMatchParam: selectors}
+	r, err := http.NewRequest(http.MethodGet, "/prometheus/federate?"+query.Encode(), nil)
+	require.NoError(t, err)
+
+	for name, values := range headers {
+		r.Header[name] = values
+	}
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	return r.WithContext(user.InjectOrgID(context.Background(), "user-1"))
+}
+
+func TestFederationRoundTripper(t *testing.T) {
+	downstream := &federationDownstream{results: map[string]string{
+		`{job="a"}[5m]`: `[
+			{"metric":{"__name__":"up","job":"a","instance":"1"},"values":[[985,"0"],[1000,"1"]]},
+			{"metric":{"__name__":"go_goroutines","job":"a","instance":"1"},"values":[[1000,"25"]]}
+		]`,
+		`up[5m]`: `[
+			{"metric":{"__name__":"up","job":"b","instance":"1"},"values":[[1001,"0"]]},
+			{"metric":{"__name__":"up","job":"a","instance":"1"},"values":[[985,"0"],[1000,"1"]]}
+		]`,
+	}}
+
+	reg := prometheus.NewPedanticRegistry()
+	rt := newFederationRoundTripper(downstream, newTestPrometheusCodec(), mockLimits{}, nil, 0, log.NewNopLogger(), newFederationMetrics(reg))
+
+	res, err := rt.RoundTrip(newFederationRequest(t, "", nil, `up`, `{job="a"}`, `up`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, string(expfmt.FmtText), res.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	// The series matched by both selectors are returned once, grouped by metric name, with the latest sample
+	// and its own timestamp.
+	assert.Equal(t, `# TYPE go_goroutines untyped
+go_goroutines{instance="1",job="a"} 25 1000000
+# TYPE up untyped
+up{instance="1",job="a"} 1 1000000
+up{instance="1",job="b"} 0 1001000
+`, string(body))
+
+	// Each unique selector runs as a range vector selector over the default lookback delta, with an instant query
+	// at the same time, through the instant queries path.
+	assert.ElementsMatch(t, []string{`up[5m]`, `{job="a"}[5m]`}, downstream.queries())
+	for _, r := range downstream.requests {
+		assert.Equal(t, "/prometheus/api/v1/query", r.URL.Path)
+		assert.Equal(t, downstream.requests[0].URL.Query().Get("time"), r.URL.Query().Get("time"))
+		assert.Equal(t, jsonMimeType, r.Header.Get("Accept"))
+	}
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_frontend_federation_requests_total Total number of /federate requests received by the query-frontend, by results cache outcome.
+		# TYPE cortex_query_frontend_federation_requests_total counter
+		cortex_query_frontend_federation_requests_total{cache="disabled"} 1
+	`), "cortex_query_frontend_federation_requests_total"))
+}
+
+func TestFederationRoundTripper_ShouldLookUpTheLatestSampleWithinTheLookbackDelta(t *testing.T) {
+	downstream := &federationDownstream{results: map[string]string{
+		`up[1m]`: `[{"metric":{"__name__":"up","job":"a"},"values":[[970,"0"],[985,"1"]]}]`,
+	}}
+	rt := newFederationRoundTripper(downstream, newTestPrometheusCodec(), mockLimits{}, nil, time.Minute, log.NewNopLogger(), newFederationMetrics(nil))
+
+	res, err := rt.RoundTrip(newFederationRequest(t, "", nil, `up`))
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "# TYPE up untyped\nup{job=\"a\"} 1 985000\n", string(body))
+	assert.Equal(t, []string{`up[1m]`}, downstream.queries())
+}
+
+func TestFederationRoundTripper_ShouldNegotiateTheExpositionFormat(t *testing.T) {
+	downstream := &federationDownstream{results: map[string]string{
+		`up[5m]`: `[{"metric":{"__name__":"up","job":"a"},"values":[[1000,"1"]]}]`,
+	}}
+	rt := newFederationRoundTripper(downstream, newTestPrometheusCodec(), mockLimits{}, nil, 0, log.NewNopLogger(), newFederationMetrics(nil))
+
+	res, err := rt.RoundTrip(newFederationRequest(t, `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited`, nil, `up`))
+	require.NoError(t, err)
+	assert.Equal(t, string(expfmt.FmtProtoDelim), res.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	family, err := expfmt.ExtractSamples(&expfmt.DecodeOptions{}, mustDecodeFederationFamilies(t, body, expfmt.FmtProtoDelim)...)
+	require.NoError(t, err)
+	require.Len(t, family, 1)
+	assert.Equal(t, `up{job="a"} => 1 @[1000]`, family[0].String())
+}
+
+func TestFederationRoundTripper_ShouldCacheTheResults(t *testing.T) {
+	downstream := &federationDownstream{results: map[string]string{
+		`up[5m]`: `[{"metric":{"__name__":"up","job":"a"},"values":[[1000,"1"]]}]`,
+	}}
+
+	reg := prometheus.NewPedanticRegistry()
+	c := cache.NewMockCache()
+	rt := newFederationRoundTripper(downstream, newTestPrometheusCodec(), mockLimits{federationResultsCacheTTL: time.Minute}, c, 0, log.NewNopLogger(), newFederationMetrics(reg))
+
+	var bodies []string
+	for _, headers := range []http.Header{nil, nil, {cacheControlHeader: []string{noStoreValue}}} {
+		res, err := rt.RoundTrip(newFederationRequest(t, "", headers, `up`))
+		require.NoError(t, err)
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+	}
+
+	// The second request is served from the cache, while the third one skips it.
+	assert.Equal(t, []string{`up[5m]`, `up[5m]`}, downstream.queries())
+	assert.Equal(t, bodies[0], bodies[1])
+	assert.Equal(t, bodies[0], bodies[2])
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_frontend_federation_requests_total Total number of /federate requests received by the query-frontend, by results cache outcome.
+		# TYPE cortex_query_frontend_federation_requests_total counter
+		cortex_query_frontend_federation_requests_total{cache="disabled"} 1
+		cortex_query_frontend_federation_requests_total{cache="hit"} 1
+		cortex_query_frontend_federation_requests_total{cache="miss"} 1
+	`), "cortex_query_frontend_federation_requests_total"))
+}
+
+func TestFederationRoundTripper_ShouldNotCacheIfDisabledForTheTenant(t *testing.T) {
+	downstream := &federationDownstream{}
+	rt := newFederationRoundTripper(downstream, newTestPrometheusCodec(), mockLimits{}, cache.NewMockCache(), 0, log.NewNopLogger(), newFederationMetrics(nil))
+
+	for i := 0; i < 2; i++ {
+		_, err := rt.RoundTrip(newFederationRequest(t, "", nil, `up`))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{`up[5m]`, `up[5m]`}, downstream.queries())
+}
+
+func TestFederationRoundTripper_ShouldReturnErrors(t *testing.T) {
+	tests := map[string]struct {
+		selectors          []string
+		downstreamErr      error
+		expectedStatusCode int32
+		expectedErr        string
+	}{
+		"no selectors": {
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErr:        "no match[] parameter provided",
+		},
+		"invalid selector": {
+			selectors:          []string{`up`, `sum(up)`},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErr:        `invalid match[] parameter`,
+		},
+		"selector query failed": {
+			selectors:          []string{`up`},
+			downstreamErr:      apierror.New(apierror.TypeTooManyRequests, "too many requests"),
+			expectedStatusCode: http.StatusTooManyRequests,
+			expectedErr:        "too many requests",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			var downstream http.RoundTripper = &federationDownstream{}
+			if testData.downstreamErr != nil {
+				downstream = RoundTripFunc(func(*http.Request) (*http.Response, error) {
+					return nil, testData.downstreamErr
+				})
+			}
+			rt := newFederationRoundTripper(downstream, newTestPrometheusCodec(), mockLimits{}, nil, 0, log.NewNopLogger(), newFederationMetrics(nil))
+
+			_, err := rt.RoundTrip(newFederationRequest(t, "", nil, testData.selectors...))
+			require.Error(t, err)
+
+			res, ok := apierror.HTTPResponseFromError(err)
+			require.True(t, ok)
+			assert.Equal(t, testData.expectedStatusCode, res.Code)
+			assert.Contains(t, string(res.Body), testData.expectedErr)
+		})
+	}
+}
+
+func mustDecodeFederationFamilies(t *testing.T, body []byte, format expfmt.Format) []*dto.MetricFamily {
+	dec := expfmt.NewDecoder(bytes.NewReader(body), format)
+
+	var families []*dto.MetricFamily
+	for {
+		family := &dto.MetricFamily{}
+		if err := dec.Decode(family); err == io.EOF {
+			return families
+		} else if err != nil {
+			require.NoError(t, err)
+		}
+		families = append(families, family)
+	}
+}
+
+func TestTripperware_ShouldRunFederationSelectorsThroughTheInstantQueryMiddlewares(t *testing.T) {
+	codec := newTestPrometheusCodec()
+
+	tw, _, err := NewTripperware(
+		Config{},
+		log.NewNopLogger(),
+		mockLimits{maxQueryExpressionSizeBytes: 10},
+		codec,
+		nil,
+		promql.EngineOpts{
+			Logger:     log.NewNopLogger(),
+			Reg:        nil,
+			MaxSamples: 1000,
+			Timeout:    time.Minute,
+		},
+		nil,
+	)
+	require.NoError(t, err)
+
+	var downstreamPaths []string
+	tripper := tw(RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		downstreamPaths = append(downstreamPaths, r.URL.Path)
+
+		return codec.EncodeResponse(r.Context(), r, &PrometheusResponse{
+			Status: "success",
+			Data: &PrometheusData{
+				ResultType: "matrix",
+				Result: []SampleStream{{
+					Labels:  []mimirpb.LabelAdapter{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}},
+					Samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 1}},
+				}},
+			},
+		})
+	}))
+
+	t.Run("selectors within the limits", func(t *testing.T) {
+		downstreamPaths = nil
+
+		res, err := tripper.RoundTrip(newFederationRequest(t, "", nil, `up`))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "# TYPE up untyped\nup{job=\"a\"} 1 1000\n", string(body))
+		assert.Equal(t, []string{"/prometheus/api/v1/query"}, downstreamPaths)
+	})
+
+	t.Run("selectors exceeding the limits", func(t *testing.T) {
+		downstreamPaths = nil
+
+		_, err := tripper.RoundTrip(newFederationRequest(t, "", nil, `up`, `{job="very-long-job-name"}`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "err-mimir-max-query-expression-size-bytes")
+	})
+}
@@ -0,0 +1,250 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	// heavyQueryQueuePositionHeader is the response header containing the position of a heavy query
+	// in the tenant queue when it was enqueued, because the concurrency limit was reached.
+	heavyQueryQueuePositionHeader = "Heavy-Query-Queue-Position"
+
+	// heavyQueryQueueDurationHeader is the response header containing the time, in seconds, a heavy
+	// query waited in the tenant queue before being executed.
+	heavyQueryQueueDurationHeader = "Heavy-Query-Queue-Duration-Seconds"
+
+	// heavyQueryLookbackDelta is the time range queried by an instant vector selector, used to estimate
+	// the cost of a query. It matches the PromQL default lookback delta.
+	heavyQueryLookbackDelta = 5 * time.Minute
+)
+
+// estimateQueryCost returns the estimated cost of the input query, computed as the sum of the time
+// range queried by each selector of the query, including ranges and subqueries.
+func estimateQueryCost(r Request) (time.Duration, error) {
+	expr, err := parser.ParseExpr(r.GetQuery())
+	if err != nil {
+		return 0, err
+	}
+	return estimateExprCost(expr, r), nil
+}
+
+// estimateExprCost is like estimateQueryCost, but takes the already parsed query of the request.
+func estimateExprCost(expr parser.Expr, r Request) time.Duration {
+	queryRange := time.Duration(r.GetEnd()-r.GetStart()) * time.Millisecond
+
+	var cost time.Duration
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		var selectorRange time.Duration
+
+		switch n := node.(type) {
+		case *parser.MatrixSelector:
+			selectorRange = n.Range
+		case *parser.VectorSelector:
+			// The vector selector of a range selector is accounted by the range selector.
+			if len(path) > 0 {
+				if _, ok := path[len(path)-1].(*parser.MatrixSelector); ok {
+					return nil
+				}
+			}
+			selectorRange = heavyQueryLookbackDelta
+		default:
+			return nil
+		}
+
+		// Selectors within subqueries query the additional time range of each subquery.
+		for _, parent := range path {
+			if subquery, ok := parent.(*parser.SubqueryExpr); ok {
+				selectorRange += subquery.Range
+			}
+		}
+
+		cost += queryRange + selectorRange
+		return nil
+	})
+
+	return cost
+}
+
+// heavyQueriesLimiter limits the number of heavy queries executed concurrently, per tenant.
+// Heavy queries exceeding the limit wait in a per-tenant FIFO queue.
+type heavyQueriesLimiter struct {
+	mtx     sync.Mutex
+	tenants map[string]*heavyQueriesQueue
+}
+
+type heavyQueriesQueue struct {
+	running int
+
+	// waiting holds a channel for each waiting query, closed when the query can be executed.
+	waiting []chan struct{}
+}
+
+func newHeavyQueriesLimiter() *heavyQueriesLimiter {
+	return &heavyQueriesLimiter{
+		tenants: map[string]*heavyQueriesQueue{},
+	}
+}
+
+// acquire waits until a heavy query of the input tenant can be executed, honoring the input limit, and
+// returns the function to call once the query has completed. The returned position is the position of
+// the query in the tenant queue when it was enqueued, or 0 if the query didn't wait.
+func (l *heavyQueriesLimiter) acquire(ctx context.Context, tenantID string, limit int) (release func(), position int, err error) {
+	release = func() {
+		l.mtx.Lock()
+		defer l.mtx.Unlock()
+		l.releaseLocked(tenantID)
+	}
+
+	l.mtx.Lock()
+	q := l.tenants[tenantID]
+	if q == nil {
+		q = &heavyQueriesQueue{}
+		l.tenants[tenantID] = q
+	}
+
+	if q.running < limit && len(q.waiting) == 0 {
+		q.running++
+		l.mtx.Unlock()
+		return release, 0, nil
+	}
+
+	ready := make(chan struct{})
+	q.waiting = append(q.waiting, ready)
+	position = len(q.waiting)
+	l.mtx.Unlock()
+
+	select {
+	case <-ready:
+		return release, position, nil
+	case <-ctx.Done():
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	for i, w := range q.waiting {
+		if w == ready {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			l.cleanupLocked(tenantID, q)
+			return nil, position, ctx.Err()
+		}
+	}
+
+	// The query has been concurrently allowed to run, so the slot must be released.
+	l.releaseLocked(tenantID)
+	return nil, position, ctx.Err()
+}
+
+// releaseLocked hands over the slot of a completed query to the first waiting query, if any.
+// It must be called with the lock held.
+func (l *heavyQueriesLimiter) releaseLocked(tenantID string) {
+	q := l.tenants[tenantID]
+	if q == nil {
+		return
+	}
+
+	if len(q.waiting) > 0 {
+		close(q.waiting[0])
+		q.waiting = q.waiting[1:]
+		return
+	}
+
+	q.running--
+	l.cleanupLocked(tenantID, q)
+}
+
+func (l *heavyQueriesLimiter) cleanupLocked(tenantID string, q *heavyQueriesQueue) {
+	if q.running <= 0 && len(q.waiting) == 0 {
+		delete(l.tenants, tenantID)
+	}
+}
+
+type heavyQueriesMiddleware struct {
+	next    Handler
+	limits  Limits
+	limiter *heavyQueriesLimiter
+	logger  log.Logger
+
+	heavyQueries  prometheus.Counter
+	queueDuration prometheus.Histogram
+}
+
+// newHeavyQueriesMiddleware creates a new Middleware that classifies queries as heavy based on their estimated
+// cost, and enforces a per-tenant limit on the number of heavy queries executed concurrently, so that light
+// queries stay responsive under the load of heavy ones.
+func newHeavyQueriesMiddleware(limits Limits, logger log.Logger, registerer prometheus.Registerer) Middleware {
+	limiter := newHeavyQueriesLimiter()
+	heavyQueries := promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_heavy_queries_total",
+		Help: "Total number of queries classified as heavy, and subject to the max concurrent heavy queries limit.",
+	})
+	queueDuration := promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
+		Name:    "cortex_query_frontend_heavy_queries_queue_duration_seconds",
+		Help:    "Time spent by heavy queries waiting in the queue before being executed.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	return MiddlewareFunc(func(next Handler) Handler {
+		return heavyQueriesMiddleware{
+			next:          next,
+			limits:        limits,
+			limiter:       limiter,
+			logger:        logger,
+			heavyQueries:  heavyQueries,
+			queueDuration: queueDuration,
+		}
+	})
+}
+
+func (m heavyQueriesMiddleware) Do(ctx context.Context, r Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	limit := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, m.limits.MaxConcurrentHeavyQueries)
+	minCost := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, m.limits.HeavyQueryMinEstimatedCost)
+	if limit <= 0 || minCost <= 0 {
+		return m.next.Do(ctx, r)
+	}
+
+	// An invalid query is not classified as heavy: the error is returned by the downstream.
+	cost, err := estimateQueryCost(r)
+	if err != nil || cost < minCost {
+		return m.next.Do(ctx, r)
+	}
+
+	m.heavyQueries.Inc()
+
+	start := time.Now()
+	release, position, err := m.limiter.acquire(ctx, tenant.JoinTenantIDs(tenantIDs), limit)
+	waited := time.Since(start)
+	m.queueDuration.Observe(waited.Seconds())
+
+	if position > 0 {
+		setResponseHeader(ctx, heavyQueryQueuePositionHeader, strconv.Itoa(position))
+		setResponseHeader(ctx, heavyQueryQueueDurationHeader, strconv.FormatFloat(waited.Seconds(), 'f', 3, 64))
+		level.Debug(loggerWithQueryAttributes(ctx, m.logger)).Log("msg", "heavy query waited in the queue", "estimated_cost", cost, "queue_position", position, "queue_duration", waited)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return m.next.Do(ctx, r)
+}
@@ -0,0 +1,252 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+)
+
+func TestEstimateQueryCost(t *testing.T) {
+	const hour = int64(time.Hour / time.Millisecond)
+
+	for name, tc := range map[string]struct {
+		query        string
+		start, end   int64
+		expectedCost time.Duration
+	}{
+		"instant vector selector in an instant query": {
+			query:        `up`,
+			expectedCost: 5 * time.Minute,
+		},
+		"instant vector selector in a range query": {
+			query:        `up`,
+			end:          2 * hour,
+			expectedCost: 2*time.Hour + 5*time.Minute,
+		},
+		"range vector selector": {
+			query:        `rate(metric[1h])`,
+			end:          2 * hour,
+			expectedCost: 3 * time.Hour,
+		},
+		"multiple selectors": {
+			query:        `sum(rate(metric[1h])) / sum(up)`,
+			end:          2 * hour,
+			expectedCost: 3*time.Hour + 2*time.Hour + 5*time.Minute,
+		},
+		"subquery": {
+			query:        `max_over_time(rate(metric[1h])[1d:5m])`,
+			end:          2 * hour,
+			expectedCost: 3*time.Hour + 24*time.Hour,
+		},
+		"nested subqueries": {
+			query:        `max_over_time(max_over_time(up[1h:1m])[1d:5m])`,
+			expectedCost: 5*time.Minute + time.Hour + 24*time.Hour,
+		},
+		"number literal": {
+			query:        `1`,
+			end:          2 * hour,
+			expectedCost: 0,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cost, err := estimateQueryCost(&PrometheusRangeQueryRequest{Query: tc.query, Start: tc.start, End: tc.end})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCost, cost)
+		})
+	}
+
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := estimateQueryCost(&PrometheusRangeQueryRequest{Query: `up{`})
+		require.Error(t, err)
+	})
+}
+
+func TestHeavyQueriesLimiter(t *testing.T) {
+	t.Run("should allow queries up to the limit and queue the others in FIFO order", func(t *testing.T) {
+		limiter := newHeavyQueriesLimiter()
+		ctx := context.Background()
+
+		release1, position, err := limiter.acquire(ctx, "user-1", 1)
+		require.NoError(t, err)
+		assert.Equal(t, 0, position)
+
+		// Other tenants are not affected.
+		releaseOther, position, err := limiter.acquire(ctx, "user-2", 1)
+		require.NoError(t, err)
+		assert.Equal(t, 0, position)
+		releaseOther()
+
+		acquired := make(chan int, 2)
+		for i := 1; i <= 2; i++ {
+			i := i
+			go func() {
+				release, _, err := limiter.acquire(ctx, "user-1", 1)
+				require.NoError(t, err)
+				acquired <- i
+				release()
+			}()
+
+			// Wait until the query has been enqueued, to guarantee the ordering.
+			require.Eventually(t, func() bool {
+				limiter.mtx.Lock()
+				defer limiter.mtx.Unlock()
+				return len(limiter.tenants["user-1"].waiting) == i
+			}, time.Second, time.Millisecond)
+		}
+
+		select {
+		case <-acquired:
+			require.Fail(t, "queued query should not run before a slot is released")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		release1()
+		assert.Equal(t, 1, <-acquired)
+		assert.Equal(t, 2, <-acquired)
+
+		require.Eventually(t, func() bool {
+			limiter.mtx.Lock()
+			defer limiter.mtx.Unlock()
+			return len(limiter.tenants) == 0
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("should remove a queued query from the queue when its context is canceled", func(t *testing.T) {
+		limiter := newHeavyQueriesLimiter()
+
+		release, _, err := limiter.acquire(context.Background(), "user-1", 1)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, position, err := limiter.acquire(ctx, "user-1", 1)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 1, position)
+
+		limiter.mtx.Lock()
+		assert.Empty(t, limiter.tenants["user-1"].waiting)
+		assert.Equal(t, 1, limiter.tenants["user-1"].running)
+		limiter.mtx.Unlock()
+
+		release()
+
+		limiter.mtx.Lock()
+		assert.Empty(t, limiter.tenants)
+		limiter.mtx.Unlock()
+	})
+}
+
+func TestHeavyQueriesMiddleware(t *testing.T) {
+	const (
+		heavyQuery = `rate(metric[7d])`
+		lightQuery = `rate(metric[1m])`
+	)
+
+	limits := mockLimits{maxConcurrentHeavyQueries: 1, heavyQueryMinEstimatedCost: 24 * time.Hour}
+
+	t.Run("should not limit queries if the limit is disabled", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		middleware := newHeavyQueriesMiddleware(mockLimits{heavyQueryMinEstimatedCost: 24 * time.Hour}, log.NewNopLogger(), reg)
+
+		_, err := middleware.Wrap(mockHandlerWith(nil, nil)).Do(user.InjectOrgID(context.Background(), "test"), &PrometheusRangeQueryRequest{Query: heavyQuery})
+		require.NoError(t, err)
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_query_frontend_heavy_queries_total Total number of queries classified as heavy, and subject to the max concurrent heavy queries limit.
+			# TYPE cortex_query_frontend_heavy_queries_total counter
+			cortex_query_frontend_heavy_queries_total 0
+		`), "cortex_query_frontend_heavy_queries_total"))
+	})
+
+	t.Run("should not limit light queries while the heavy queries limit is reached", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		middleware := newHeavyQueriesMiddleware(limits, log.NewNopLogger(), reg)
+		ctx := user.InjectOrgID(context.Background(), "test")
+
+		running := make(chan struct{})
+		unblock := make(chan struct{})
+		go func() {
+			_, _ = middleware.Wrap(HandlerFunc(func(context.Context, Request) (Response, error) {
+				close(running)
+				<-unblock
+				return newEmptyPrometheusResponse(), nil
+			})).Do(ctx, &PrometheusRangeQueryRequest{Query: heavyQuery})
+		}()
+		<-running
+		defer close(unblock)
+
+		headers := http.Header{}
+		_, err := middleware.Wrap(mockHandlerWith(nil, nil)).Do(contextWithResponseHeaders(ctx, headers), &PrometheusRangeQueryRequest{Query: lightQuery})
+		require.NoError(t, err)
+		assert.Empty(t, headers)
+	})
+
+	t.Run("should queue heavy queries and report the queue position in the response headers", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		middleware := newHeavyQueriesMiddleware(limits, log.NewNopLogger(), reg)
+		ctx := user.InjectOrgID(context.Background(), "test")
+
+		running := make(chan struct{})
+		unblock := make(chan struct{})
+		go func() {
+			_, _ = middleware.Wrap(HandlerFunc(func(context.Context, Request) (Response, error) {
+				close(running)
+				<-unblock
+				return newEmptyPrometheusResponse(), nil
+			})).Do(ctx, &PrometheusRangeQueryRequest{Query: heavyQuery})
+		}()
+		<-running
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(unblock)
+		}()
+
+		headers := http.Header{}
+		_, err := middleware.Wrap(mockHandlerWith(nil, nil)).Do(contextWithResponseHeaders(ctx, headers), &PrometheusRangeQueryRequest{Query: heavyQuery})
+		require.NoError(t, err)
+		assert.Equal(t, "1", headers.Get(heavyQueryQueuePositionHeader))
+		assert.NotEmpty(t, headers.Get(heavyQueryQueueDurationHeader))
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_query_frontend_heavy_queries_total Total number of queries classified as heavy, and subject to the max concurrent heavy queries limit.
+			# TYPE cortex_query_frontend_heavy_queries_total counter
+			cortex_query_frontend_heavy_queries_total 2
+		`), "cortex_query_frontend_heavy_queries_total"))
+	})
+
+	t.Run("should return error if the context is canceled while the query is queued", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		middleware := newHeavyQueriesMiddleware(limits, log.NewNopLogger(), reg)
+		ctx := user.InjectOrgID(context.Background(), "test")
+
+		running := make(chan struct{})
+		unblock := make(chan struct{})
+		go func() {
+			_, _ = middleware.Wrap(HandlerFunc(func(context.Context, Request) (Response, error) {
+				close(running)
+				<-unblock
+				return newEmptyPrometheusResponse(), nil
+			})).Do(ctx, &PrometheusRangeQueryRequest{Query: heavyQuery})
+		}()
+		<-running
+		defer close(unblock)
+
+		queuedCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		_, err := middleware.Wrap(mockHandlerWith(nil, nil)).Do(queuedCtx, &PrometheusRangeQueryRequest{Query: heavyQuery})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -23,7 +23,7 @@ func newInstrumentMiddleware(name string, metrics *instrumentMiddlewareMetrics,
 
 	// Support the case metrics shouldn't be tracked (ie. unit tests).
 	if metrics != nil {
-		durationCol = instrument.NewHistogramCollector(metrics.duration)
+		durationCol = &queryAttributesHistogramCollector{metric: metrics.duration}
 	} else {
 		durationCol = &noopCollector{}
 	}
@@ -34,6 +34,9 @@ func newInstrumentMiddleware(name string, metrics *instrumentMiddlewareMetrics,
 			err := instrument.CollectedRequest(ctx, name, durationCol, instrument.ErrorCode, func(ctx context.Context) error {
 				sp := spanlogger.FromContext(ctx, logger)
 				req.LogToSpan(sp.Span)
+				if attrs, ok := queryAttributesFromContext(ctx); ok {
+					attrs.setSpanTags(sp.Span)
+				}
 
 				var err error
 				resp, err = next.Do(ctx, req)
@@ -61,6 +64,38 @@ func newInstrumentMiddlewareMetrics(registerer prometheus.Registerer) *instrumen
 	}
 }
 
+// queryAttributesHistogramCollector is an instrument.Collector tracking the request duration in a histogram.
+// Differently from instrument.HistogramCollector, the exemplars carry the queryAttributes too, and not just the trace ID.
+type queryAttributesHistogramCollector struct {
+	metric *prometheus.HistogramVec
+}
+
+// Register implements instrument.Collector. The metric is expected to be already registered.
+func (c *queryAttributesHistogramCollector) Register() {}
+
+// Before implements instrument.Collector.
+func (c *queryAttributesHistogramCollector) Before(ctx context.Context, method string, start time.Time) {
+}
+
+// After implements instrument.Collector.
+func (c *queryAttributesHistogramCollector) After(ctx context.Context, method, statusCode string, start time.Time) {
+	observer := c.metric.WithLabelValues(method, statusCode)
+
+	attrs, ok := queryAttributesFromContext(ctx)
+	if !ok {
+		instrument.ObserveWithExemplar(ctx, observer, time.Since(start).Seconds())
+		return
+	}
+
+	// The trace ID in the attributes refers to the parent span, which is fine to correlate the exemplar to the query.
+	if lbls := attrs.exemplarLabels(); len(lbls) > 0 {
+		observer.(prometheus.ExemplarObserver).ObserveWithExemplar(time.Since(start).Seconds(), lbls)
+		return
+	}
+
+	observer.Observe(time.Since(start).Seconds())
+}
+
 // noopCollector is a noop collector that can be used as placeholder when no metric
 // should tracked by the instrumentation.
 type noopCollector struct{}
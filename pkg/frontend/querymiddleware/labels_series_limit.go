@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/exp/slices"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	limitParam = "limit"
+
+	// labelsAndSeriesTruncatedWarning is the warning returned along with the results truncated to the limit.
+	// It's the same warning returned by Prometheus.
+	labelsAndSeriesTruncatedWarning = "results truncated due to limit"
+
+	formURLEncodedMimeType = "application/x-www-form-urlencoded"
+)
+
+type labelsAndSeriesLimitMetrics struct {
+	truncatedResponsesTotal *prometheus.CounterVec
+}
+
+func newLabelsAndSeriesLimitMetrics(registerer prometheus.Registerer) *labelsAndSeriesLimitMetrics {
+	return &labelsAndSeriesLimitMetrics{
+		truncatedResponsesTotal: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_labels_and_series_truncated_responses_total",
+			Help: "Total number of label names, label values and series responses truncated to the limit by the query-frontend, by route.",
+		}, []string{"route"}),
+	}
+}
+
+// labelsAndSeriesLimitRoundTripper enforces the per-tenant max and default values of the limit parameter of the
+// label names, label values and series requests. The results exceeding the effective limit are truncated, with a
+// warning returned both in the response body and in the Warning header, so that clients know the results are
+// incomplete. The limit only truncates the responses: the queriers ignore the limit parameter, so they still fetch
+// all the results from the ingesters and store-gateways.
+type labelsAndSeriesLimitRoundTripper struct {
+	next    http.RoundTripper
+	limits  Limits
+	logger  log.Logger
+	metrics *labelsAndSeriesLimitMetrics
+}
+
+func newLabelsAndSeriesLimitRoundTripper(next http.RoundTripper, limits Limits, logger log.Logger, metrics *labelsAndSeriesLimitMetrics) http.RoundTripper {
+	return &labelsAndSeriesLimitRoundTripper{
+		next:    next,
+		limits:  limits,
+		logger:  logger,
+		metrics: metrics,
+	}
+}
+
+func (l *labelsAndSeriesLimitRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	spanLog, ctx := spanlogger.NewWithLogger(r.Context(), l.logger, "labelsAndSeriesLimitRoundTripper.RoundTrip")
+	defer spanLog.Finish()
+
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	query, body, err := parseLabelsAndSeriesRequestParams(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like the Go form parsing, the body parameters take precedence over the URL query ones.
+	rawLimit := query.Get(limitParam)
+	if body.Has(limitParam) {
+		rawLimit = body.Get(limitParam)
+	}
+	requestedLimit, err := parseLimitParam(rawLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := effectiveLabelsAndSeriesLimit(
+		requestedLimit,
+		validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, l.limits.LabelsAndSeriesDefaultLimit),
+		validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, l.limits.LabelsAndSeriesMaxLimit),
+	)
+	if limit == 0 {
+		return l.next.RoundTrip(r)
+	}
+
+	// The limit parameter is replaced with one more result than the limit, so that the truncation can still be
+	// detected if the downstream honors it. The queriers currently ignore it, and return all the results.
+	res, err := l.next.RoundTrip(withLabelsAndSeriesLimitParam(r.WithContext(ctx), query, body, limit+1))
+	if err != nil || res.StatusCode != http.StatusOK || res.Header.Get("Content-Encoding") != "" {
+		return res, err
+	}
+
+	route := routeFromPath(r.URL.Path)
+	res, truncated, err := truncateLabelsAndSeriesResponse(res, limit)
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		l.metrics.truncatedResponsesTotal.WithLabelValues(route).Inc()
+		level.Debug(spanLog).Log("msg", "labels and series response truncated to the limit", "route", route, "limit", limit, "requested_limit", requestedLimit)
+	}
+	return res, nil
+}
+
+// effectiveLabelsAndSeriesLimit returns the limit applied to a request, given the limit requested by the client
+// and the default and max limits of the tenant. 0 means no limit.
+func effectiveLabelsAndSeriesLimit(requested, defaultLimit, maxLimit int) int {
+	limit := requested
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if maxLimit > 0 && (limit == 0 || limit > maxLimit) {
+		limit = maxLimit
+	}
+	return limit
+}
+
+// parseLimitParam parses the input limit parameter value. Returns 0 if the value is empty.
+func parseLimitParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0, apierror.Newf(apierror.TypeBadData, "invalid parameter %q: limit must be a non-negative integer", limitParam)
+	}
+	return limit, nil
+}
+
+// parseLabelsAndSeriesRequestParams returns the parameters of the input request, from the URL query and from
+// the form-encoded body, if any. The body can still be read after this function returns.
+func parseLabelsAndSeriesRequestParams(r *http.Request) (query, body url.Values, err error) {
+	query = r.URL.Query()
+	body = url.Values{}
+	if !hasFormURLEncodedBody(r) {
+		return query, body, nil
+	}
+
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, apierror.Newf(apierror.TypeBadData, "error reading request body: %v", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+
+	if body, err = url.ParseQuery(string(raw)); err != nil {
+		return nil, nil, apierror.Newf(apierror.TypeBadData, "error parsing form values: %v", err)
+	}
+	return query, body, nil
+}
+
+func hasFormURLEncodedBody(r *http.Request) bool {
+	if r.Body == nil || r.Method != http.MethodPost {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == formURLEncodedMimeType
+}
+
+// withLabelsAndSeriesLimitParam returns a copy of the input request whose limit parameter is set to the input limit,
+// in the URL query, and removed from the form-encoded body, if any. The input query and body are modified. The
+// returned request doesn't accept compressed responses, so that the results can be truncated.
+func withLabelsAndSeriesLimitParam(r *http.Request, query, body url.Values, limit int) *http.Request {
+	req := r.Clone(r.Context())
+	req.Header.Del("Accept-Encoding")
+	req.Form, req.PostForm = nil, nil
+
+	query.Set(limitParam, strconv.Itoa(limit))
+	req.URL.RawQuery = query.Encode()
+	req.RequestURI = req.URL.RequestURI() // This is what the httpgrpc code looks at.
+
+	if hasFormURLEncodedBody(r) {
+		body.Del(limitParam)
+		encoded := body.Encode()
+		req.Body = io.NopCloser(strings.NewReader(encoded))
+		req.ContentLength = int64(len(encoded))
+		req.Header.Set("Content-Length", strconv.Itoa(len(encoded)))
+	}
+	return req
+}
+
+// labelsAndSeriesResponse is the successful response of the label names, label values and series requests.
+// The results are not decoded, because they only need to be counted.
+type labelsAndSeriesResponse struct {
+	Status   string               `json:"status"`
+	Data     []stdjson.RawMessage `json:"data"`
+	Warnings []string             `json:"warnings,omitempty"`
+}
+
+// truncateLabelsAndSeriesResponse truncates the results of the input successful response to the input limit.
+// Returns the response, and whether it has been truncated.
+func truncateLabelsAndSeriesResponse(res *http.Response, limit int) (*http.Response, bool, error) {
+	buf, err := bodyBuffer(res)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, false, err
+	}
+
+	decoded := labelsAndSeriesResponse{}
+	if err := json.Unmarshal(buf, &decoded); err != nil {
+		return nil, false, apierror.Newf(apierror.TypeInternal, "error decoding response: %v", err)
+	}
+
+	if len(decoded.Data) <= limit {
+		res.Body = io.NopCloser(bytes.NewReader(buf))
+		return res, false, nil
+	}
+
+	decoded.Data = decoded.Data[:limit]
+	if !slices.Contains(decoded.Warnings, labelsAndSeriesTruncatedWarning) {
+		decoded.Warnings = append(decoded.Warnings, labelsAndSeriesTruncatedWarning)
+	}
+
+	body, err := json.Marshal(decoded)
+	if err != nil {
+		return nil, false, apierror.Newf(apierror.TypeInternal, "error encoding response: %v", err)
+	}
+
+	header := res.Header.Clone()
+	header.Del("Content-Length")
+	header.Add("Warning", fmt.Sprintf("299 - %q", fmt.Sprintf("%s of %d", labelsAndSeriesTruncatedWarning, limit)))
+
+	return &http.Response{
+		StatusCode:    res.StatusCode,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, true, nil
+}
@@ -0,0 +1,265 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+)
+
+// labelsAndSeriesDownstream is a fake downstream returning the configured label names. If honorLimit is true,
+// the results are truncated to the limit parameter, like a downstream supporting it would do.
+type labelsAndSeriesDownstream struct {
+	results    []string
+	honorLimit bool
+	requests   []*http.Request
+	bodies     []string
+}
+
+func (d *labelsAndSeriesDownstream) RoundTrip(r *http.Request) (*http.Response, error) {
+	d.requests = append(d.requests, r)
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		d.bodies = append(d.bodies, string(body))
+	}
+
+	results := d.results
+	if limit, err := strconv.Atoi(r.URL.Query().Get(limitParam)); err == nil && d.honorLimit && limit < len(results) {
+		results = results[:limit]
+	}
+
+	quoted := make([]string, 0, len(results))
+	for _, result := range results {
+		quoted = append(quoted, strconv.Quote(result))
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{jsonMimeType}},
+		Body:       io.NopCloser(strings.NewReader(`{"status":"success","data":[` + strings.Join(quoted, ",") + `]}`)),
+	}, nil
+}
+
+func newLabelsAndSeriesRequest(t *testing.T, path string, params url.Values) *http.Request {
+	r, err := http.NewRequest(http.MethodGet, path+"?"+params.Encode(), nil)
+	require.NoError(t, err)
+	r.RequestURI = r.URL.RequestURI()
+	return r.WithContext(user.InjectOrgID(context.Background(), "user-1"))
+}
+
+func TestLabelsAndSeriesLimitRoundTripper(t *testing.T) {
+	labelNames := []string{"__name__", "cluster", "instance", "job", "namespace"}
+
+	for name, tc := range map[string]struct {
+		requestedLimit   string
+		defaultLimit     int
+		maxLimit         int
+		honorLimit       bool
+		expectedLimit    string
+		expectedData     []string
+		expectedWarnings []string
+	}{
+		"no limit": {
+			expectedData: labelNames,
+		},
+		"requested limit without tenant limits": {
+			requestedLimit:   "2",
+			expectedLimit:    "3",
+			expectedData:     labelNames[:2],
+			expectedWarnings: []string{labelsAndSeriesTruncatedWarning},
+		},
+		"requested limit greater than the results": {
+			requestedLimit: "10",
+			expectedLimit:  "11",
+			expectedData:   labelNames,
+		},
+		"requested limit equal to the results": {
+			requestedLimit: "5",
+			expectedLimit:  "6",
+			expectedData:   labelNames,
+		},
+		"default limit applied to requests without limit": {
+			defaultLimit:     3,
+			maxLimit:         4,
+			expectedLimit:    "4",
+			expectedData:     labelNames[:3],
+			expectedWarnings: []string{labelsAndSeriesTruncatedWarning},
+		},
+		"requested limit lower than the default limit": {
+			requestedLimit:   "1",
+			defaultLimit:     3,
+			expectedLimit:    "2",
+			expectedData:     labelNames[:1],
+			expectedWarnings: []string{labelsAndSeriesTruncatedWarning},
+		},
+		"requested limit greater than the max limit": {
+			requestedLimit:   "10",
+			maxLimit:         4,
+			expectedLimit:    "5",
+			expectedData:     labelNames[:4],
+			expectedWarnings: []string{labelsAndSeriesTruncatedWarning},
+		},
+		"max limit applied to requests without limit": {
+			maxLimit:         2,
+			expectedLimit:    "3",
+			expectedData:     labelNames[:2],
+			expectedWarnings: []string{labelsAndSeriesTruncatedWarning},
+		},
+		"results truncated by a downstream honoring the limit": {
+			requestedLimit:   "2",
+			honorLimit:       true,
+			expectedLimit:    "3",
+			expectedData:     labelNames[:2],
+			expectedWarnings: []string{labelsAndSeriesTruncatedWarning},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			downstream := &labelsAndSeriesDownstream{results: labelNames, honorLimit: tc.honorLimit}
+			reg := prometheus.NewPedanticRegistry()
+			limits := mockLimits{labelsAndSeriesDefaultLimit: tc.defaultLimit, labelsAndSeriesMaxLimit: tc.maxLimit}
+			rt := newLabelsAndSeriesLimitRoundTripper(downstream, limits, log.NewNopLogger(), newLabelsAndSeriesLimitMetrics(reg))
+
+			params := url.Values{"match[]": []string{`{job="a"}`}}
+			if tc.requestedLimit != "" {
+				params.Set(limitParam, tc.requestedLimit)
+			}
+			req := newLabelsAndSeriesRequest(t, "/prometheus/api/v1/labels", params)
+			req.Header.Set("Accept-Encoding", "gzip")
+
+			res, err := rt.RoundTrip(req)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			decoded := labelsAndSeriesResponse{}
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(body, &decoded))
+
+			data := make([]string, 0, len(decoded.Data))
+			for _, raw := range decoded.Data {
+				value := ""
+				require.NoError(t, json.Unmarshal(raw, &value))
+				data = append(data, value)
+			}
+			assert.Equal(t, tc.expectedData, data)
+			assert.Equal(t, tc.expectedWarnings, decoded.Warnings)
+
+			// The limit parameter is forwarded, along with the other parameters, even if the queriers ignore it.
+			require.Len(t, downstream.requests, 1)
+			downstreamReq := downstream.requests[0]
+			assert.Equal(t, tc.expectedLimit, downstreamReq.URL.Query().Get(limitParam))
+			assert.Equal(t, `{job="a"}`, downstreamReq.URL.Query().Get("match[]"))
+			assert.Equal(t, downstreamReq.URL.RequestURI(), downstreamReq.RequestURI)
+
+			expectedTruncated := 0
+			if len(tc.expectedWarnings) > 0 {
+				expectedTruncated = 1
+				assert.Equal(t, fmt.Sprintf(`299 - "%s of %d"`, labelsAndSeriesTruncatedWarning, len(tc.expectedData)), res.Header.Get("Warning"))
+				assert.Empty(t, downstreamReq.Header.Get("Accept-Encoding"))
+			} else {
+				assert.Empty(t, res.Header.Get("Warning"))
+			}
+			assert.Equal(t, float64(expectedTruncated), testutil.ToFloat64(rt.(*labelsAndSeriesLimitRoundTripper).metrics.truncatedResponsesTotal.WithLabelValues(routeLabels)))
+		})
+	}
+}
+
+func TestLabelsAndSeriesLimitRoundTripper_FormEncodedBody(t *testing.T) {
+	downstream := &labelsAndSeriesDownstream{results: []string{"a", "b", "c"}}
+	rt := newLabelsAndSeriesLimitRoundTripper(downstream, mockLimits{labelsAndSeriesMaxLimit: 2}, log.NewNopLogger(), newLabelsAndSeriesLimitMetrics(nil))
+
+	body := url.Values{"match[]": []string{"up"}, limitParam: []string{"10"}}.Encode()
+	req, err := http.NewRequest(http.MethodPost, "/prometheus/api/v1/series?limit=1", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", formURLEncodedMimeType)
+	req = req.WithContext(user.InjectOrgID(context.Background(), "user-1"))
+
+	res, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// The limit in the body takes precedence, and it's capped to the max limit.
+	require.Len(t, downstream.requests, 1)
+	assert.Equal(t, "3", downstream.requests[0].URL.Query().Get(limitParam))
+	assert.Equal(t, "match%5B%5D=up", downstream.bodies[0])
+	assert.Equal(t, int64(len(downstream.bodies[0])), downstream.requests[0].ContentLength)
+
+	resBody, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":"success","data":["a","b"],"warnings":["results truncated due to limit"]}`, string(resBody))
+}
+
+func TestLabelsAndSeriesLimitRoundTripper_ShouldRejectInvalidLimit(t *testing.T) {
+	for _, limit := range []string{"-1", "abc", "1.5"} {
+		t.Run(limit, func(t *testing.T) {
+			downstream := &labelsAndSeriesDownstream{}
+			rt := newLabelsAndSeriesLimitRoundTripper(downstream, mockLimits{}, log.NewNopLogger(), newLabelsAndSeriesLimitMetrics(nil))
+
+			_, err := rt.RoundTrip(newLabelsAndSeriesRequest(t, "/prometheus/api/v1/label/job/values", url.Values{limitParam: []string{limit}}))
+			require.Error(t, err)
+
+			apiErr, ok := apierror.HTTPResponseFromError(err)
+			require.True(t, ok)
+			assert.Equal(t, int32(http.StatusBadRequest), apiErr.Code)
+			assert.Contains(t, string(apiErr.Body), "limit must be a non-negative integer")
+			assert.Empty(t, downstream.requests)
+		})
+	}
+}
+
+func TestLabelsAndSeriesLimitRoundTripper_MultiTenant(t *testing.T) {
+	tenant.WithDefaultResolver(tenant.NewMultiResolver())
+	downstream := &labelsAndSeriesDownstream{results: []string{"a", "b", "c", "d"}}
+	limits := multiTenantMockLimits{byTenant: map[string]mockLimits{
+		"tenant-1": {labelsAndSeriesMaxLimit: 3},
+		"tenant-2": {labelsAndSeriesMaxLimit: 2},
+		"tenant-3": {},
+	}}
+	rt := newLabelsAndSeriesLimitRoundTripper(downstream, limits, log.NewNopLogger(), newLabelsAndSeriesLimitMetrics(nil))
+
+	req := newLabelsAndSeriesRequest(t, "/prometheus/api/v1/series", url.Values{"match[]": []string{"up"}})
+	req = req.WithContext(user.InjectOrgID(context.Background(), "tenant-1|tenant-2|tenant-3"))
+
+	res, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+
+	// The smallest limit of the tenants is applied.
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":"success","data":["a","b"],"warnings":["results truncated due to limit"]}`, string(body))
+}
+
+func TestEffectiveLabelsAndSeriesLimit(t *testing.T) {
+	for _, tc := range []struct {
+		requested, defaultLimit, maxLimit, expected int
+	}{
+		{requested: 0, defaultLimit: 0, maxLimit: 0, expected: 0},
+		{requested: 10, defaultLimit: 0, maxLimit: 0, expected: 10},
+		{requested: 0, defaultLimit: 5, maxLimit: 0, expected: 5},
+		{requested: 10, defaultLimit: 5, maxLimit: 0, expected: 10},
+		{requested: 0, defaultLimit: 0, maxLimit: 20, expected: 20},
+		{requested: 30, defaultLimit: 5, maxLimit: 20, expected: 20},
+		{requested: 0, defaultLimit: 5, maxLimit: 20, expected: 5},
+	} {
+		assert.Equal(t, tc.expected, effectiveLabelsAndSeriesLimit(tc.requested, tc.defaultLimit, tc.maxLimit), "requested: %d default: %d max: %d", tc.requested, tc.defaultLimit, tc.maxLimit)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/weaveworks/common/user"
 
@@ -43,6 +44,21 @@ type Limits interface {
 	// query may be. 0 means "unlimited".
 	MaxQueryExpressionSizeBytes(userID string) int
 
+	// MaxQueryMemoryBytes returns the limit of the memory, in bytes, allocated to decode and merge
+	// the responses of the partial queries of a single query. 0 means "unlimited".
+	MaxQueryMemoryBytes(userID string) int
+
+	// MaxQueryResponseSizeBytes returns the limit of the size, in bytes, of the encoded response
+	// of a single query. 0 means "unlimited".
+	MaxQueryResponseSizeBytes(userID string) int
+
+	// MaxConcurrentHeavyQueries returns the max number of heavy queries executed concurrently
+	// by the query-frontend. 0 means "unlimited".
+	MaxConcurrentHeavyQueries(userID string) int
+
+	// HeavyQueryMinEstimatedCost returns the min estimated cost of a query to be classified as heavy.
+	HeavyQueryMinEstimatedCost(userID string) time.Duration
+
 	// MaxCacheFreshness returns the period after which results are cacheable,
 	// to prevent caching of very recent results.
 	MaxCacheFreshness(userID string) time.Duration
@@ -85,6 +101,26 @@ type Limits interface {
 
 	// ResultsCacheForOutOfOrderWindowTTL returns TTL for cached results for query that falls into out-of-order ingestion window.
 	ResultsCacheTTLForOutOfOrderTimeWindow(userID string) time.Duration
+
+	// FederationResultsCacheTTL returns TTL for cached results of /federate requests. 0 means caching is disabled.
+	FederationResultsCacheTTL(userID string) time.Duration
+
+	// ChaosInjectionEnabled returns whether the query-frontend injects the faults requested by a signed chaos header.
+	ChaosInjectionEnabled(userID string) bool
+
+	// CatchAllQueryPolicy returns how the query-frontend treats the queries containing a catch-all selector.
+	CatchAllQueryPolicy(userID string) string
+
+	// CatchAllQueryMaxRange returns the max time range of the range queries containing a catch-all selector,
+	// when their range is capped.
+	CatchAllQueryMaxRange(userID string) time.Duration
+
+	// LabelsAndSeriesMaxLimit returns the max limit of the label names, label values and series requests.
+	LabelsAndSeriesMaxLimit(userID string) int
+
+	// LabelsAndSeriesDefaultLimit returns the limit of the label names, label values and series requests
+	// which don't set the limit parameter.
+	LabelsAndSeriesDefaultLimit(userID string) int
 }
 
 type limitsMiddleware struct {
@@ -105,7 +141,7 @@ func newLimitsMiddleware(l Limits, logger log.Logger) Middleware {
 }
 
 func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
-	log, ctx := spanlogger.NewWithLogger(ctx, l.logger, "limits")
+	log, ctx := spanlogger.NewWithLogger(ctx, loggerWithQueryAttributes(ctx, l.logger), "limits")
 	defer log.Finish()
 
 	tenantIDs, err := tenant.TenantIDs(ctx)
@@ -174,7 +210,8 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 	if maxQueryLength := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, l.MaxTotalQueryLength); maxQueryLength > 0 {
 		queryLen := timestamp.Time(r.GetEnd()).Sub(timestamp.Time(r.GetStart()))
 		if queryLen > maxQueryLength {
-			return nil, apierror.New(apierror.TypeBadData, validation.NewMaxTotalQueryLengthError(queryLen, maxQueryLength).Error())
+			// Suggest the largest time range conforming to the limit, so that clients can adjust the query.
+			return nil, apierror.Newf(apierror.TypeBadData, "%s Retry with range <= %s.", validation.NewMaxTotalQueryLengthError(queryLen, maxQueryLength), model.Duration(maxQueryLength))
 		}
 	}
 
@@ -187,18 +224,21 @@ type limitedParallelismRoundTripper struct {
 
 	codec      Codec
 	middleware Middleware
+
+	encodingMetrics *responseEncodingMetrics
 }
 
 // newLimitedParallelismRoundTripper creates a new roundtripper that enforces MaxQueryParallelism to the `next` roundtripper across `middlewares`.
-func newLimitedParallelismRoundTripper(next http.RoundTripper, codec Codec, limits Limits, middlewares ...Middleware) http.RoundTripper {
+func newLimitedParallelismRoundTripper(next http.RoundTripper, codec Codec, limits Limits, encodingMetrics *responseEncodingMetrics, middlewares ...Middleware) http.RoundTripper {
 	return limitedParallelismRoundTripper{
 		downstream: roundTripperHandler{
 			next:  next,
 			codec: codec,
 		},
-		codec:      codec,
-		limits:     limits,
-		middleware: MergeMiddlewares(middlewares...),
+		codec:           codec,
+		limits:          limits,
+		middleware:      MergeMiddlewares(middlewares...),
+		encodingMetrics: encodingMetrics,
 	}
 }
 
@@ -223,9 +263,10 @@ func newSubRequest(ctx context.Context, req Request) subRequest {
 
 func (rt limitedParallelismRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 	var (
-		wg           sync.WaitGroup
-		intermediate = make(chan subRequest)
-		ctx, cancel  = context.WithCancel(r.Context())
+		wg              sync.WaitGroup
+		intermediate    = make(chan subRequest)
+		responseHeaders = http.Header{}
+		ctx, cancel     = context.WithCancel(contextWithResponseHeaders(r.Context(), responseHeaders))
 	)
 	defer func() {
 		cancel()
@@ -289,7 +330,35 @@ func (rt limitedParallelismRoundTripper) RoundTrip(r *http.Request) (*http.Respo
 		return nil, err
 	}
 
-	return rt.codec.EncodeResponse(ctx, r, response)
+	encoded, err := rt.encodeResponse(ctx, r, tenantIDs, response)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the response headers set by the middlewares.
+	for name, values := range responseHeaders {
+		encoded.Header[name] = values
+	}
+	return encoded, nil
+}
+
+type responseHeadersContextKey int
+
+const responseHeadersKey responseHeadersContextKey = 0
+
+// contextWithResponseHeaders returns a new context with the input headers attached. The attached headers
+// are added to the HTTP response of the query.
+func contextWithResponseHeaders(ctx context.Context, headers http.Header) context.Context {
+	return context.WithValue(ctx, responseHeadersKey, headers)
+}
+
+// setResponseHeader sets a header in the HTTP response of the query. It's a no-op if the query has not
+// been received through the limitedParallelismRoundTripper. It must be called before the middlewares
+// return, and it's not safe to call it concurrently.
+func setResponseHeader(ctx context.Context, key, value string) {
+	if headers, ok := ctx.Value(responseHeadersKey).(http.Header); ok {
+		headers.Set(key, value)
+	}
 }
 
 // roundTripperHandler is an adapter that implements the Handler interface using a http.RoundTripper to perform
@@ -23,6 +23,7 @@ import (
 	"go.uber.org/atomic"
 
 	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 func TestLimitsMiddleware_MaxQueryLookback(t *testing.T) {
@@ -244,7 +245,13 @@ func TestLimitsMiddleware_MaxQueryLength(t *testing.T) {
 			maxQueryLength: thirtyDays,
 			reqStartTime:   now.Add(-4 * thirtyDays),
 			reqEndTime:     now.Add(-2 * thirtyDays),
-			expectedErr:    "the total query time range exceeds the limit",
+			expectedErr:    "the total query time range exceeds the limit (query length: 1440h0m0s, limit: 720h0m0s)",
+		},
+		"should suggest the largest time range conforming to the limit": {
+			maxQueryLength: thirtyDays,
+			reqStartTime:   now.Add(-4 * thirtyDays),
+			reqEndTime:     now.Add(-2 * thirtyDays),
+			expectedErr:    "Retry with range <= 30d.",
 		},
 		"should succeed if total query length is higher than query length limit": {
 			maxQueryLength:      thirtyDays,
@@ -371,6 +378,22 @@ func (m multiTenantMockLimits) MaxQueryExpressionSizeBytes(userID string) int {
 	return m.byTenant[userID].maxQueryExpressionSizeBytes
 }
 
+func (m multiTenantMockLimits) MaxQueryMemoryBytes(userID string) int {
+	return m.byTenant[userID].maxQueryMemoryBytes
+}
+
+func (m multiTenantMockLimits) MaxQueryResponseSizeBytes(userID string) int {
+	return m.byTenant[userID].maxQueryResponseSizeBytes
+}
+
+func (m multiTenantMockLimits) MaxConcurrentHeavyQueries(userID string) int {
+	return m.byTenant[userID].maxConcurrentHeavyQueries
+}
+
+func (m multiTenantMockLimits) HeavyQueryMinEstimatedCost(userID string) time.Duration {
+	return m.byTenant[userID].heavyQueryMinEstimatedCost
+}
+
 func (m multiTenantMockLimits) MaxQueryParallelism(userID string) int {
 	return m.byTenant[userID].maxQueryParallelism
 }
@@ -415,6 +438,10 @@ func (m multiTenantMockLimits) ResultsCacheTTLForOutOfOrderTimeWindow(userID str
 	return m.byTenant[userID].resultsCacheOutOfOrderWindowTTL
 }
 
+func (m multiTenantMockLimits) FederationResultsCacheTTL(userID string) time.Duration {
+	return m.byTenant[userID].federationResultsCacheTTL
+}
+
 func (m multiTenantMockLimits) CreationGracePeriod(userID string) time.Duration {
 	return m.byTenant[userID].creationGracePeriod
 }
@@ -423,11 +450,35 @@ func (m multiTenantMockLimits) NativeHistogramsIngestionEnabled(userID string) b
 	return m.byTenant[userID].nativeHistogramsIngestionEnabled
 }
 
+func (m multiTenantMockLimits) ChaosInjectionEnabled(userID string) bool {
+	return m.byTenant[userID].chaosInjectionEnabled
+}
+
+func (m multiTenantMockLimits) CatchAllQueryPolicy(userID string) string {
+	return m.byTenant[userID].CatchAllQueryPolicy("")
+}
+
+func (m multiTenantMockLimits) CatchAllQueryMaxRange(userID string) time.Duration {
+	return m.byTenant[userID].catchAllQueryMaxRange
+}
+
+func (m multiTenantMockLimits) LabelsAndSeriesMaxLimit(userID string) int {
+	return m.byTenant[userID].labelsAndSeriesMaxLimit
+}
+
+func (m multiTenantMockLimits) LabelsAndSeriesDefaultLimit(userID string) int {
+	return m.byTenant[userID].labelsAndSeriesDefaultLimit
+}
+
 type mockLimits struct {
 	maxQueryLookback                 time.Duration
 	maxQueryLength                   time.Duration
 	maxTotalQueryLength              time.Duration
 	maxQueryExpressionSizeBytes      int
+	maxQueryMemoryBytes              int
+	maxQueryResponseSizeBytes        int
+	maxConcurrentHeavyQueries        int
+	heavyQueryMinEstimatedCost       time.Duration
 	maxCacheFreshness                time.Duration
 	maxQueryParallelism              int
 	maxShardedQueries                int
@@ -441,6 +492,12 @@ type mockLimits struct {
 	nativeHistogramsIngestionEnabled bool
 	resultsCacheTTL                  time.Duration
 	resultsCacheOutOfOrderWindowTTL  time.Duration
+	federationResultsCacheTTL        time.Duration
+	chaosInjectionEnabled            bool
+	catchAllQueryPolicy              string
+	catchAllQueryMaxRange            time.Duration
+	labelsAndSeriesMaxLimit          int
+	labelsAndSeriesDefaultLimit      int
 }
 
 func (m mockLimits) MaxQueryLookback(string) time.Duration {
@@ -462,6 +519,22 @@ func (m mockLimits) MaxQueryExpressionSizeBytes(string) int {
 	return m.maxQueryExpressionSizeBytes
 }
 
+func (m mockLimits) MaxQueryMemoryBytes(string) int {
+	return m.maxQueryMemoryBytes
+}
+
+func (m mockLimits) MaxQueryResponseSizeBytes(string) int {
+	return m.maxQueryResponseSizeBytes
+}
+
+func (m mockLimits) MaxConcurrentHeavyQueries(string) int {
+	return m.maxConcurrentHeavyQueries
+}
+
+func (m mockLimits) HeavyQueryMinEstimatedCost(string) time.Duration {
+	return m.heavyQueryMinEstimatedCost
+}
+
 func (m mockLimits) MaxQueryParallelism(string) int {
 	if m.maxQueryParallelism == 0 {
 		return 14 // Flag default.
@@ -509,6 +582,10 @@ func (m mockLimits) ResultsCacheTTLForOutOfOrderTimeWindow(userID string) time.D
 	return m.resultsCacheOutOfOrderWindowTTL
 }
 
+func (m mockLimits) FederationResultsCacheTTL(string) time.Duration {
+	return m.federationResultsCacheTTL
+}
+
 func (m mockLimits) CreationGracePeriod(userID string) time.Duration {
 	return m.creationGracePeriod
 }
@@ -517,6 +594,29 @@ func (m mockLimits) NativeHistogramsIngestionEnabled(userID string) bool {
 	return m.nativeHistogramsIngestionEnabled
 }
 
+func (m mockLimits) ChaosInjectionEnabled(string) bool {
+	return m.chaosInjectionEnabled
+}
+
+func (m mockLimits) CatchAllQueryPolicy(string) string {
+	if m.catchAllQueryPolicy == "" {
+		return validation.CatchAllQueryPolicyAllow
+	}
+	return m.catchAllQueryPolicy
+}
+
+func (m mockLimits) CatchAllQueryMaxRange(string) time.Duration {
+	return m.catchAllQueryMaxRange
+}
+
+func (m mockLimits) LabelsAndSeriesMaxLimit(string) int {
+	return m.labelsAndSeriesMaxLimit
+}
+
+func (m mockLimits) LabelsAndSeriesDefaultLimit(string) int {
+	return m.labelsAndSeriesDefaultLimit
+}
+
 type mockHandler struct {
 	mock.Mock
 }
@@ -556,7 +656,7 @@ func TestLimitedRoundTripper_MaxQueryParallelism(t *testing.T) {
 	})
 	require.Nil(t, err)
 
-	_, err = newLimitedParallelismRoundTripper(downstream, codec, mockLimits{maxQueryParallelism: maxQueryParallelism},
+	_, err = newLimitedParallelismRoundTripper(downstream, codec, mockLimits{maxQueryParallelism: maxQueryParallelism}, newResponseEncodingMetrics(nil),
 		MiddlewareFunc(func(next Handler) Handler {
 			return HandlerFunc(func(c context.Context, _ Request) (Response, error) {
 				var wg sync.WaitGroup
@@ -577,6 +677,31 @@ func TestLimitedRoundTripper_MaxQueryParallelism(t *testing.T) {
 	require.LessOrEqual(t, maxFound, maxQueryParallelism, "max query parallelism: ", maxFound, " went over the configured one:", maxQueryParallelism)
 }
 
+func TestLimitedRoundTripper_ShouldAddResponseHeadersSetByMiddlewares(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "foo")
+	codec := newTestPrometheusCodec()
+	r, err := codec.EncodeRequest(ctx, &PrometheusRangeQueryRequest{
+		Path:  "/query_range",
+		Start: util.TimeToMillis(time.Now().Add(-time.Hour)),
+		End:   util.TimeToMillis(time.Now()),
+		Step:  int64(1 * time.Second * time.Millisecond),
+		Query: `foo`,
+	})
+	require.NoError(t, err)
+
+	res, err := newLimitedParallelismRoundTripper(nil, codec, mockLimits{maxQueryParallelism: 1}, newResponseEncodingMetrics(nil),
+		MiddlewareFunc(func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, _ Request) (Response, error) {
+				setResponseHeader(ctx, "Test-Header", "value")
+				return newEmptyPrometheusResponse(), nil
+			})
+		}),
+	).RoundTrip(r)
+	require.NoError(t, err)
+	assert.Equal(t, "value", res.Header.Get("Test-Header"))
+	assert.Equal(t, jsonMimeType, res.Header.Get("Content-Type"))
+}
+
 func TestLimitedRoundTripper_MaxQueryParallelismLateScheduling(t *testing.T) {
 	var (
 		maxQueryParallelism = 2
@@ -600,7 +725,7 @@ func TestLimitedRoundTripper_MaxQueryParallelismLateScheduling(t *testing.T) {
 	})
 	require.Nil(t, err)
 
-	_, err = newLimitedParallelismRoundTripper(downstream, codec, mockLimits{maxQueryParallelism: maxQueryParallelism},
+	_, err = newLimitedParallelismRoundTripper(downstream, codec, mockLimits{maxQueryParallelism: maxQueryParallelism}, newResponseEncodingMetrics(nil),
 		MiddlewareFunc(func(next Handler) Handler {
 			return HandlerFunc(func(c context.Context, _ Request) (Response, error) {
 				// fire up work and we don't wait.
@@ -641,7 +766,7 @@ func TestLimitedRoundTripper_OriginalRequestContextCancellation(t *testing.T) {
 	})
 	require.Nil(t, err)
 
-	_, err = newLimitedParallelismRoundTripper(downstream, codec, mockLimits{maxQueryParallelism: maxQueryParallelism},
+	_, err = newLimitedParallelismRoundTripper(downstream, codec, mockLimits{maxQueryParallelism: maxQueryParallelism}, newResponseEncodingMetrics(nil),
 		MiddlewareFunc(func(next Handler) Handler {
 			return HandlerFunc(func(c context.Context, _ Request) (Response, error) {
 				var wg sync.WaitGroup
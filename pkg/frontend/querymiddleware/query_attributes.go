@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/tenant"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaveworks/common/tracing"
+)
+
+const (
+	// Span tag names, following the OpenTelemetry semantic conventions for database client spans.
+	// The tenant is the namespace of the query, while the query fingerprint has no semantic convention
+	// and can be computed from the query text.
+	queryTextSpanTag      = "db.query.text"
+	queryOperationSpanTag = "db.operation.name"
+	tenantIDSpanTag       = "db.namespace"
+
+	// Label names used in logs and exemplars. They match the ones used elsewhere in Mimir
+	// so that logs and exemplars can be correlated with the rest of the read path.
+	queryFingerprintLabel = "query_fingerprint"
+	tenantIDLabel         = "user"
+	traceIDLabel          = "traceID"
+)
+
+type queryAttributesContextKey int
+
+const queryAttributesKey queryAttributesContextKey = 0
+
+// queryAttributes holds the attributes identifying a single query received by the query-frontend.
+// They're attached to frontend metrics (as exemplars), logs and traces so that it's possible to
+// pivot between the three signals while debugging a query.
+type queryAttributes struct {
+	// fingerprint is a hash of the original query, computed before any rewriting done by middlewares.
+	fingerprint string
+	// query and operation are the original query and the name of the Prometheus API
+	// endpoint it has been received through.
+	query     string
+	operation string
+	tenantID  string
+	traceID   string
+	sampled   bool
+}
+
+// newQueryAttributes builds the queryAttributes of the input request.
+func newQueryAttributes(ctx context.Context, req Request) queryAttributes {
+	attrs := queryAttributes{
+		fingerprint: queryFingerprint(req.GetQuery()),
+		query:       req.GetQuery(),
+		operation:   queryOperation(req),
+	}
+
+	if tenantIDs, err := tenant.TenantIDs(ctx); err == nil {
+		attrs.tenantID = tenant.JoinTenantIDs(tenantIDs)
+	}
+
+	if traceID, ok := tracing.ExtractSampledTraceID(ctx); ok {
+		attrs.traceID = traceID
+		attrs.sampled = true
+	} else if traceID, ok := tracing.ExtractTraceID(ctx); ok {
+		attrs.traceID = traceID
+	}
+
+	return attrs
+}
+
+// queryFingerprint returns a stable, short identifier of the input query.
+func queryFingerprint(query string) string {
+	return fmt.Sprintf("%016x", xxhash.Sum64String(query))
+}
+
+// queryOperation returns the name of the Prometheus API endpoint of the input request.
+func queryOperation(req Request) string {
+	if _, ok := req.(*PrometheusInstantQueryRequest); ok {
+		return "query"
+	}
+	return "query_range"
+}
+
+// contextWithQueryAttributes returns a new context with the input queryAttributes attached.
+func contextWithQueryAttributes(ctx context.Context, attrs queryAttributes) context.Context {
+	return context.WithValue(ctx, queryAttributesKey, attrs)
+}
+
+// queryAttributesFromContext returns the queryAttributes attached to the context, if any.
+func queryAttributesFromContext(ctx context.Context) (queryAttributes, bool) {
+	attrs, ok := ctx.Value(queryAttributesKey).(queryAttributes)
+	return attrs, ok
+}
+
+// loggerWithQueryAttributes returns a logger with the query fingerprint attached, if the
+// queryAttributes are available in the context. The tenant and trace IDs are not added,
+// because they're already added by util_log.WithContext() and spanlogger.
+func loggerWithQueryAttributes(ctx context.Context, logger log.Logger) log.Logger {
+	attrs, ok := queryAttributesFromContext(ctx)
+	if !ok {
+		return logger
+	}
+
+	return log.With(logger, queryFingerprintLabel, attrs.fingerprint)
+}
+
+// setSpanTags sets the query attributes as tags of the input span.
+func (a queryAttributes) setSpanTags(sp opentracing.Span) {
+	sp.SetTag(queryTextSpanTag, a.query)
+	sp.SetTag(queryOperationSpanTag, a.operation)
+	if a.tenantID != "" {
+		sp.SetTag(tenantIDSpanTag, a.tenantID)
+	}
+}
+
+// exemplarLabels returns the labels to attach to exemplars. Exemplars are only useful to
+// pivot to a trace, so no labels are returned if the trace is not sampled. Labels are added
+// in order of importance, skipping the ones that would exceed prometheus.ExemplarMaxRunes.
+func (a queryAttributes) exemplarLabels() prometheus.Labels {
+	if !a.sampled {
+		return nil
+	}
+
+	lbls := prometheus.Labels{}
+	runes := 0
+
+	for _, pair := range [][2]string{
+		{traceIDLabel, a.traceID},
+		{queryFingerprintLabel, a.fingerprint},
+		{tenantIDLabel, a.tenantID},
+	} {
+		if pair[1] == "" {
+			continue
+		}
+
+		size := utf8.RuneCountInString(pair[0]) + utf8.RuneCountInString(pair[1])
+		if runes+size > prometheus.ExemplarMaxRunes {
+			continue
+		}
+
+		lbls[pair[0]] = pair[1]
+		runes += size
+	}
+
+	return lbls
+}
+
+// newQueryAttributesMiddleware makes a new middleware which attaches the queryAttributes to the
+// request context and the current span. It's expected to be the first middleware in the chain,
+// so that the attributes are computed on the original query.
+func newQueryAttributesMiddleware() Middleware {
+	return MiddlewareFunc(func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req Request) (Response, error) {
+			// Do not override the attributes if they've already been computed upstream.
+			if _, ok := queryAttributesFromContext(ctx); ok {
+				return next.Do(ctx, req)
+			}
+
+			attrs := newQueryAttributes(ctx, req)
+			if sp := opentracing.SpanFromContext(ctx); sp != nil {
+				attrs.setSpanTags(sp)
+			}
+
+			return next.Do(contextWithQueryAttributes(ctx, attrs), req)
+		})
+	})
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+	"github.com/weaveworks/common/user"
+)
+
+func TestQueryAttributesMiddleware(t *testing.T) {
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	t.Cleanup(func() { _ = closer.Close() })
+
+	sp := tracer.StartSpan("test")
+	t.Cleanup(sp.Finish)
+
+	ctx := user.InjectOrgID(context.Background(), "tenant-1")
+	ctx = opentracing.ContextWithSpan(ctx, sp)
+
+	req := &PrometheusRangeQueryRequest{Query: "sum(up)"}
+
+	var actual queryAttributes
+	handler := newQueryAttributesMiddleware().Wrap(HandlerFunc(func(ctx context.Context, req Request) (Response, error) {
+		var ok bool
+		actual, ok = queryAttributesFromContext(ctx)
+		require.True(t, ok)
+
+		// Rewrite the query downstream, and make sure the fingerprint of the original query is preserved.
+		return newQueryAttributesMiddleware().Wrap(HandlerFunc(func(ctx context.Context, _ Request) (Response, error) {
+			nested, _ := queryAttributesFromContext(ctx)
+			assert.Equal(t, actual, nested)
+			return &PrometheusResponse{}, nil
+		})).Do(ctx, req.WithQuery("sum(rate(up[1m]))"))
+	}))
+
+	_, err := handler.Do(ctx, req)
+	require.NoError(t, err)
+
+	assert.Equal(t, queryFingerprint("sum(up)"), actual.fingerprint)
+	assert.Equal(t, "tenant-1", actual.tenantID)
+	assert.Equal(t, sp.Context().(jaeger.SpanContext).TraceID().String(), actual.traceID)
+	assert.True(t, actual.sampled)
+
+	assert.Equal(t, "sum(up)", sp.(*jaeger.Span).Tags()[queryTextSpanTag])
+	assert.Equal(t, "query_range", sp.(*jaeger.Span).Tags()[queryOperationSpanTag])
+	assert.Equal(t, "tenant-1", sp.(*jaeger.Span).Tags()[tenantIDSpanTag])
+}
+
+func TestQueryOperation(t *testing.T) {
+	assert.Equal(t, "query_range", queryOperation(&PrometheusRangeQueryRequest{}))
+	assert.Equal(t, "query", queryOperation(&PrometheusInstantQueryRequest{}))
+}
+
+func TestQueryAttributes_ExemplarLabels(t *testing.T) {
+	t.Run("should return no labels if the trace is not sampled", func(t *testing.T) {
+		attrs := queryAttributes{fingerprint: queryFingerprint("up"), tenantID: "tenant-1", traceID: "1234"}
+		assert.Empty(t, attrs.exemplarLabels())
+	})
+
+	t.Run("should return all labels if they fit the exemplar size limit", func(t *testing.T) {
+		attrs := queryAttributes{fingerprint: queryFingerprint("up"), tenantID: "tenant-1", traceID: "1234", sampled: true}
+		assert.Equal(t, prometheus.Labels{
+			traceIDLabel:          "1234",
+			queryFingerprintLabel: attrs.fingerprint,
+			tenantIDLabel:         "tenant-1",
+		}, attrs.exemplarLabels())
+	})
+
+	t.Run("should skip labels exceeding the exemplar size limit", func(t *testing.T) {
+		attrs := queryAttributes{fingerprint: queryFingerprint("up"), tenantID: strings.Repeat("x", prometheus.ExemplarMaxRunes), traceID: "1234", sampled: true}
+		assert.Equal(t, prometheus.Labels{
+			traceIDLabel:          "1234",
+			queryFingerprintLabel: attrs.fingerprint,
+		}, attrs.exemplarLabels())
+	})
+}
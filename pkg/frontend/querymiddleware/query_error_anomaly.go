@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/httpgrpc"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+const (
+	// queryErrorAnomalyInterval is the interval over which the per-tenant query error rate is computed.
+	queryErrorAnomalyInterval = time.Minute
+
+	// queryErrorAnomalySmoothing is the smoothing factor of the exponentially weighted moving average
+	// and variance used as baseline. A lower value makes the baseline more stable.
+	queryErrorAnomalySmoothing = 0.05
+
+	// queryErrorAnomalyWarmupIntervals is the number of intervals a tenant must have been observed for
+	// before the anomaly score is computed, so that the baseline is meaningful.
+	queryErrorAnomalyWarmupIntervals = 10
+
+	// queryErrorAnomalyMinQueries is the min number of queries received in an interval for the
+	// error rate to be considered. Intervals with fewer queries are too noisy and are skipped.
+	queryErrorAnomalyMinQueries = 10
+
+	// queryErrorAnomalyMinStdDev is the min standard deviation used to compute the anomaly score,
+	// to avoid a division by zero (or by a tiny number) when the baseline error rate is constant.
+	queryErrorAnomalyMinStdDev = 0.01
+)
+
+// queryErrorStats holds the query error rate statistics of a single tenant.
+type queryErrorStats struct {
+	// Queries and failures received in the current interval.
+	queries  int
+	failures int
+
+	// Baseline error rate, as exponentially weighted moving average and variance.
+	mean      float64
+	variance  float64
+	intervals int
+}
+
+// queryErrorAnomalyDetector tracks the per-tenant query error rate and compares it with the tenant baseline
+// (the moving average of the error rate), exporting an anomaly score which measures how much the current
+// error rate deviates from the baseline, in number of standard deviations.
+type queryErrorAnomalyDetector struct {
+	services.Service
+
+	mtx     sync.Mutex
+	tenants map[string]*queryErrorStats
+
+	activeUsers  *util.ActiveUsersCleanupService
+	anomalyScore *prometheus.GaugeVec
+}
+
+func newQueryErrorAnomalyDetector(reg prometheus.Registerer) *queryErrorAnomalyDetector {
+	d := &queryErrorAnomalyDetector{
+		tenants: map[string]*queryErrorStats{},
+		anomalyScore: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_query_frontend_query_error_rate_anomaly_score",
+			Help: "How much the tenant query error rate in the last interval deviates from the tenant baseline, in number of standard deviations.",
+		}, []string{"user"}),
+	}
+
+	d.activeUsers = util.NewActiveUsersCleanupWithDefaultValues(d.cleanupTenant)
+	d.Service = services.NewTimerService(queryErrorAnomalyInterval, d.starting, d.iteration, d.stopping)
+	return d
+}
+
+func (d *queryErrorAnomalyDetector) starting(ctx context.Context) error {
+	return services.StartAndAwaitRunning(ctx, d.activeUsers)
+}
+
+func (d *queryErrorAnomalyDetector) iteration(context.Context) error {
+	d.update()
+	return nil
+}
+
+func (d *queryErrorAnomalyDetector) stopping(_ error) error {
+	return services.StopAndAwaitTerminated(context.Background(), d.activeUsers)
+}
+
+// observe tracks the outcome of a query received by the input tenant.
+func (d *queryErrorAnomalyDetector) observe(tenantID string, failed bool, now time.Time) {
+	d.activeUsers.UpdateUserTimestamp(tenantID, now)
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	stats, ok := d.tenants[tenantID]
+	if !ok {
+		stats = &queryErrorStats{}
+		d.tenants[tenantID] = stats
+	}
+
+	stats.queries++
+	if failed {
+		stats.failures++
+	}
+}
+
+// update computes the anomaly score of each tenant based on the queries received in the last interval,
+// and then updates the tenant baseline.
+func (d *queryErrorAnomalyDetector) update() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for tenantID, stats := range d.tenants {
+		queries, failures := stats.queries, stats.failures
+		stats.queries, stats.failures = 0, 0
+
+		if queries < queryErrorAnomalyMinQueries {
+			continue
+		}
+
+		rate := float64(failures) / float64(queries)
+
+		if stats.intervals >= queryErrorAnomalyWarmupIntervals {
+			stdDev := math.Max(math.Sqrt(stats.variance), queryErrorAnomalyMinStdDev)
+			d.anomalyScore.WithLabelValues(tenantID).Set((rate - stats.mean) / stdDev)
+		}
+
+		// Update the exponentially weighted moving average and variance. The first interval
+		// initializes the baseline.
+		if stats.intervals == 0 {
+			stats.mean = rate
+		} else {
+			delta := rate - stats.mean
+			stats.mean += queryErrorAnomalySmoothing * delta
+			stats.variance = (1 - queryErrorAnomalySmoothing) * (stats.variance + queryErrorAnomalySmoothing*delta*delta)
+		}
+		stats.intervals++
+	}
+}
+
+func (d *queryErrorAnomalyDetector) cleanupTenant(tenantID string) {
+	d.mtx.Lock()
+	delete(d.tenants, tenantID)
+	d.mtx.Unlock()
+
+	d.anomalyScore.DeleteLabelValues(tenantID)
+}
+
+// newQueryErrorAnomalyMiddleware makes a new middleware which tracks the outcome of each query
+// in the input queryErrorAnomalyDetector.
+func newQueryErrorAnomalyMiddleware(detector *queryErrorAnomalyDetector) Middleware {
+	return MiddlewareFunc(func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req Request) (Response, error) {
+			res, err := next.Do(ctx, req)
+
+			if tenantIDs, tenantErr := tenant.TenantIDs(ctx); tenantErr == nil {
+				detector.observe(tenant.JoinTenantIDs(tenantIDs), isQueryServerError(err), time.Now())
+			}
+
+			return res, err
+		})
+	})
+}
+
+// isQueryServerError returns whether the input error is a server-side query failure. Client errors
+// (e.g. invalid queries or limits hit) and queries canceled by the client are not server-side failures.
+func isQueryServerError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if res, ok := apierror.HTTPResponseFromError(err); ok {
+		return res.Code/100 == 5
+	}
+	if res, ok := httpgrpc.HTTPResponseFromError(err); ok {
+		return res.Code/100 == 5
+	}
+
+	return true
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+)
+
+func TestQueryErrorAnomalyDetector(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	detector := newQueryErrorAnomalyDetector(reg)
+	now := time.Now()
+
+	observeInterval := func(tenantID string, queries, failures int) {
+		for i := 0; i < queries; i++ {
+			detector.observe(tenantID, i < failures, now)
+		}
+	}
+
+	// Build the baseline of a 10% error rate.
+	for i := 0; i < queryErrorAnomalyWarmupIntervals; i++ {
+		observeInterval("user-1", 100, 10)
+		observeInterval("user-2", 100, 10)
+		detector.update()
+	}
+
+	// The anomaly score is not exported until the warmup completes.
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(""), "cortex_query_frontend_query_error_rate_anomaly_score"))
+
+	// The error rate of user-1 spikes, while user-2 keeps the same error rate.
+	// Tenants with too few queries are skipped.
+	observeInterval("user-1", 100, 50)
+	observeInterval("user-2", 100, 10)
+	observeInterval("user-3", queryErrorAnomalyMinQueries-1, queryErrorAnomalyMinQueries-1)
+	detector.update()
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_frontend_query_error_rate_anomaly_score How much the tenant query error rate in the last interval deviates from the tenant baseline, in number of standard deviations.
+		# TYPE cortex_query_frontend_query_error_rate_anomaly_score gauge
+		cortex_query_frontend_query_error_rate_anomaly_score{user="user-1"} 40
+		cortex_query_frontend_query_error_rate_anomaly_score{user="user-2"} 0
+	`), "cortex_query_frontend_query_error_rate_anomaly_score"))
+
+	// The spike has been included in the baseline, so its variance increased.
+	detector.mtx.Lock()
+	assert.Greater(t, detector.tenants["user-1"].mean, 0.1)
+	assert.Greater(t, detector.tenants["user-1"].variance, 0.0)
+	detector.mtx.Unlock()
+
+	// Inactive tenants are cleaned up.
+	detector.cleanupTenant("user-1")
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_frontend_query_error_rate_anomaly_score How much the tenant query error rate in the last interval deviates from the tenant baseline, in number of standard deviations.
+		# TYPE cortex_query_frontend_query_error_rate_anomaly_score gauge
+		cortex_query_frontend_query_error_rate_anomaly_score{user="user-2"} 0
+	`), "cortex_query_frontend_query_error_rate_anomaly_score"))
+}
+
+func TestQueryErrorAnomalyMiddleware(t *testing.T) {
+	detector := newQueryErrorAnomalyDetector(nil)
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+
+	for _, err := range []error{nil, apierror.New(apierror.TypeBadData, "bad data"), apierror.New(apierror.TypeInternal, "internal")} {
+		_, _ = newQueryErrorAnomalyMiddleware(detector).Wrap(HandlerFunc(func(context.Context, Request) (Response, error) {
+			return &PrometheusResponse{}, err
+		})).Do(ctx, &PrometheusRangeQueryRequest{Query: "up"})
+	}
+
+	detector.mtx.Lock()
+	defer detector.mtx.Unlock()
+	require.Contains(t, detector.tenants, "user-1")
+	assert.Equal(t, 3, detector.tenants["user-1"].queries)
+	assert.Equal(t, 1, detector.tenants["user-1"].failures)
+}
+
+func TestIsQueryServerError(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"no error":              {err: nil, expected: false},
+		"context canceled":      {err: fmt.Errorf("wrapped: %w", context.Canceled), expected: false},
+		"API bad data error":    {err: apierror.New(apierror.TypeBadData, "bad data"), expected: false},
+		"API canceled error":    {err: apierror.New(apierror.TypeCanceled, "canceled"), expected: false},
+		"API timeout error":     {err: apierror.New(apierror.TypeTimeout, "timeout"), expected: true},
+		"API internal error":    {err: apierror.New(apierror.TypeInternal, "internal"), expected: true},
+		"HTTP 4xx error":        {err: httpgrpc.Errorf(http.StatusTooManyRequests, "too many requests"), expected: false},
+		"HTTP 5xx error":        {err: httpgrpc.Errorf(http.StatusInternalServerError, "internal"), expected: true},
+		"generic error":         {err: errors.New("generic"), expected: true},
+		"deadline exceeded":     {err: context.DeadlineExceeded, expected: true},
+		"wrapped API 4xx error": {err: fmt.Errorf("wrapped: %w", apierror.New(apierror.TypeBadData, "bad data")), expected: false},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, isQueryServerError(testData.err))
+		})
+	}
+}
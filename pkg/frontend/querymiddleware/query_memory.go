@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+type queryMemoryTrackerContextKey int
+
+const queryMemoryTrackerKey queryMemoryTrackerContextKey = 0
+
+// queryMemoryTracker accounts the memory allocated by the query-frontend to decode and merge
+// the responses of the partial queries of a single query, and enforces a limit on it. The
+// accounted memory is never released while the query is running, because the partial responses
+// are retained until they're merged, so the accounted memory is the high watermark of the query.
+type queryMemoryTracker struct {
+	limit int64
+	bytes atomic.Int64
+}
+
+func newQueryMemoryTracker(limit int) *queryMemoryTracker {
+	return &queryMemoryTracker{limit: int64(limit)}
+}
+
+// add accounts the input number of bytes, and returns an error if the limit has been exceeded.
+// It's safe to call it on a nil tracker, in which case it's a no-op.
+func (t *queryMemoryTracker) add(bytes int) error {
+	if t == nil {
+		return nil
+	}
+
+	if total := t.bytes.Add(int64(bytes)); t.limit > 0 && total > t.limit {
+		return apierror.New(apierror.TypeBadData, validation.NewMaxQueryMemoryBytesError(int(t.limit)).Error())
+	}
+	return nil
+}
+
+// addResponses accounts the size of the input responses, and returns an error as soon as the limit has been
+// exceeded. It's safe to call it on a nil tracker, in which case it's a no-op.
+func (t *queryMemoryTracker) addResponses(responses ...Response) error {
+	if t == nil {
+		return nil
+	}
+
+	for _, res := range responses {
+		promRes, ok := res.(*PrometheusResponse)
+		if !ok {
+			continue
+		}
+		if err := t.add(promRes.Size()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// highWatermark returns the memory accounted so far, in bytes.
+func (t *queryMemoryTracker) highWatermark() int64 {
+	return t.bytes.Load()
+}
+
+// contextWithQueryMemoryTracker returns a new context with the input queryMemoryTracker attached.
+func contextWithQueryMemoryTracker(ctx context.Context, tracker *queryMemoryTracker) context.Context {
+	return context.WithValue(ctx, queryMemoryTrackerKey, tracker)
+}
+
+// queryMemoryTrackerFromContext returns the queryMemoryTracker attached to the context, or nil if none.
+func queryMemoryTrackerFromContext(ctx context.Context) *queryMemoryTracker {
+	tracker, _ := ctx.Value(queryMemoryTrackerKey).(*queryMemoryTracker)
+	return tracker
+}
+
+type queryMemoryMiddleware struct {
+	next          Handler
+	limits        Limits
+	highWatermark prometheus.Histogram
+}
+
+// newQueryMemoryMiddleware creates a new Middleware that attaches a queryMemoryTracker to each query of the
+// tenants with a memory limit, and tracks the high watermark of the memory accounted by each of these queries.
+func newQueryMemoryMiddleware(limits Limits, registerer prometheus.Registerer) Middleware {
+	highWatermark := promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
+		Name: "cortex_query_frontend_query_memory_high_watermark_bytes",
+		Help: "High watermark of the memory allocated by the query-frontend to decode and merge the responses of the partial queries of each query.",
+		// 1KB to 4GB.
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 12),
+	})
+
+	return MiddlewareFunc(func(next Handler) Handler {
+		return queryMemoryMiddleware{
+			next:          next,
+			limits:        limits,
+			highWatermark: highWatermark,
+		}
+	})
+}
+
+func (m queryMemoryMiddleware) Do(ctx context.Context, r Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	// The memory isn't accounted when the limit is disabled, to not pay the cost of computing the responses size.
+	limit := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, m.limits.MaxQueryMemoryBytes)
+	if limit <= 0 {
+		return m.next.Do(ctx, r)
+	}
+
+	tracker := newQueryMemoryTracker(limit)
+	defer func() {
+		m.highWatermark.Observe(float64(tracker.highWatermark()))
+	}()
+
+	return m.next.Do(contextWithQueryMemoryTracker(ctx, tracker), r)
+}
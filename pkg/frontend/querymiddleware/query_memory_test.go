@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestQueryMemoryTracker(t *testing.T) {
+	t.Run("should be a no-op on a nil tracker", func(t *testing.T) {
+		var tracker *queryMemoryTracker
+		assert.NoError(t, tracker.add(1000))
+	})
+
+	t.Run("should not enforce the limit if disabled", func(t *testing.T) {
+		tracker := newQueryMemoryTracker(0)
+		assert.NoError(t, tracker.add(1000))
+		assert.NoError(t, tracker.add(1000))
+		assert.Equal(t, int64(2000), tracker.highWatermark())
+	})
+
+	t.Run("should return an error once the limit has been exceeded", func(t *testing.T) {
+		tracker := newQueryMemoryTracker(1500)
+		assert.NoError(t, tracker.add(1000))
+		assert.NoError(t, tracker.add(500))
+
+		err := tracker.add(1)
+		require.Error(t, err)
+		assert.Equal(t, apierror.New(apierror.TypeBadData, validation.NewMaxQueryMemoryBytesError(1500).Error()), err)
+		assert.Equal(t, int64(1501), tracker.highWatermark())
+	})
+}
+
+func TestQueryMemoryMiddleware(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "test")
+	req := &PrometheusRangeQueryRequest{Query: "up"}
+
+	for name, tc := range map[string]struct {
+		limit           int
+		expectedErr     bool
+		expectedTracked bool
+	}{
+		"limit disabled":     {limit: 0},
+		"limit not exceeded": {limit: 100, expectedTracked: true},
+		"limit exceeded":     {limit: 99, expectedErr: true, expectedTracked: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			middleware := newQueryMemoryMiddleware(mockLimits{maxQueryMemoryBytes: tc.limit}, reg)
+
+			// The downstream decodes two partial responses.
+			handler := middleware.Wrap(HandlerFunc(func(ctx context.Context, _ Request) (Response, error) {
+				// The memory isn't tracked if the limit is disabled.
+				tracker := queryMemoryTrackerFromContext(ctx)
+				require.Equal(t, tc.expectedTracked, tracker != nil)
+
+				for i := 0; i < 2; i++ {
+					if err := tracker.add(50); err != nil {
+						return nil, err
+					}
+				}
+				return newEmptyPrometheusResponse(), nil
+			}))
+
+			_, err := handler.Do(ctx, req)
+			if tc.expectedErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "err-mimir-max-query-memory-bytes")
+			} else {
+				require.NoError(t, err)
+			}
+
+			families, err := reg.Gather()
+			require.NoError(t, err)
+			require.Len(t, families, 1)
+			assert.Equal(t, "cortex_query_frontend_query_memory_high_watermark_bytes", families[0].GetName())
+			if tc.expectedTracked {
+				assert.Equal(t, uint64(1), families[0].GetMetric()[0].GetHistogram().GetSampleCount())
+				assert.Equal(t, float64(100), families[0].GetMetric()[0].GetHistogram().GetSampleSum())
+			} else {
+				assert.Equal(t, uint64(0), families[0].GetMetric()[0].GetHistogram().GetSampleCount())
+			}
+		})
+	}
+}
+
+func TestPrometheusCodec_DecodeResponse_QueryMemoryLimit(t *testing.T) {
+	codec := newTestPrometheusCodec()
+	body := `{"status":"success","data":{"resultType":"matrix","result":[]}}`
+
+	decode := func(tracker *queryMemoryTracker) error {
+		_, err := codec.DecodeResponse(contextWithQueryMemoryTracker(context.Background(), tracker), &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{jsonMimeType}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil, log.NewNopLogger())
+		return err
+	}
+
+	tracker := newQueryMemoryTracker(len(body) * 2)
+	require.NoError(t, decode(tracker))
+	require.NoError(t, decode(tracker))
+	assert.Equal(t, int64(len(body)*2), tracker.highWatermark())
+
+	err := decode(tracker)
+	require.Error(t, err)
+	require.True(t, apierror.IsAPIError(err))
+	resp, ok := apierror.HTTPResponseFromError(err)
+	require.True(t, ok)
+	assert.Equal(t, int32(http.StatusBadRequest), resp.Code)
+}
+
+func TestSplitAndCacheMiddleware_MergeResponses_QueryMemoryLimit(t *testing.T) {
+	responses := []Response{
+		&PrometheusResponse{Status: statusSuccess, Data: &PrometheusData{ResultType: model.ValMatrix.String(), Result: []SampleStream{
+			{Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "up"}}, Samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 1}}},
+		}}},
+		&PrometheusResponse{Status: statusSuccess, Data: &PrometheusData{ResultType: model.ValMatrix.String(), Result: []SampleStream{
+			{Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "up"}}, Samples: []mimirpb.Sample{{TimestampMs: 2000, Value: 2}}},
+		}}},
+	}
+	responsesSize := responses[0].(*PrometheusResponse).Size() + responses[1].(*PrometheusResponse).Size()
+
+	for name, tc := range map[string]struct {
+		limit          int
+		expectedErr    bool
+		expectedMerged bool
+	}{
+		"limit not exceeded": {limit: responsesSize, expectedMerged: true},
+		"limit exceeded":     {limit: responsesSize - 1, expectedErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			merger := &countingMerger{Merger: newTestPrometheusCodec()}
+			s := &splitAndCacheMiddleware{merger: merger}
+			tracker := newQueryMemoryTracker(tc.limit)
+
+			_, err := s.mergeResponses(contextWithQueryMemoryTracker(context.Background(), tracker), responses)
+			if tc.expectedErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "err-mimir-max-query-memory-bytes")
+			} else {
+				require.NoError(t, err)
+			}
+
+			// The merge is aborted before merging the responses if the limit would be exceeded.
+			assert.Equal(t, tc.expectedMerged, merger.calls > 0)
+			assert.Equal(t, int64(responsesSize), tracker.highWatermark())
+		})
+	}
+}
+
+func TestQuerySharding_QueryMemoryLimit(t *testing.T) {
+	req := &PrometheusRangeQueryRequest{
+		Path:  "/query_range",
+		Start: util.TimeToMillis(start),
+		End:   util.TimeToMillis(end),
+		Step:  step.Milliseconds(),
+		Query: "sum(metric)",
+	}
+
+	// Each sharded query returns the same series.
+	downstream := mockHandlerWith(&PrometheusResponse{
+		Status: statusSuccess,
+		Data: &PrometheusData{
+			ResultType: model.ValMatrix.String(),
+			Result:     []SampleStream{{Samples: []mimirpb.Sample{{TimestampMs: util.TimeToMillis(start), Value: 1}}}},
+		},
+	}, nil)
+	shardingware := newQueryShardingMiddleware(log.NewNopLogger(), newEngine(), mockLimits{totalShards: 2}, 0, nil)
+	ctx := user.InjectOrgID(context.Background(), "test")
+
+	// The merged response is accounted.
+	tracker := newQueryMemoryTracker(0)
+	res, err := shardingware.Wrap(downstream).Do(contextWithQueryMemoryTracker(ctx, tracker), req)
+	require.NoError(t, err)
+	mergedSize := res.(*PrometheusResponse).Size()
+	assert.Equal(t, int64(mergedSize), tracker.highWatermark())
+
+	// The query fails if the merged response exceeds the limit.
+	tracker = newQueryMemoryTracker(mergedSize - 1)
+	_, err = shardingware.Wrap(downstream).Do(contextWithQueryMemoryTracker(ctx, tracker), req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "err-mimir-max-query-memory-bytes")
+}
+
+// countingMerger is a Merger which counts the number of merges.
+type countingMerger struct {
+	Merger
+	calls int
+}
+
+func (m *countingMerger) MergeResponse(responses ...Response) (Response, error) {
+	m.calls++
+	return m.Merger.MergeResponse(responses...)
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+)
+
+// QueryPolicyAction is the action to take on a query, decided by a QueryPolicyHook.
+type QueryPolicyAction int
+
+const (
+	// QueryPolicyAllow executes the query as is.
+	QueryPolicyAllow QueryPolicyAction = iota
+
+	// QueryPolicyDeny rejects the query.
+	QueryPolicyDeny
+
+	// QueryPolicyRewrite executes the query returned by the hook in place of the original one.
+	QueryPolicyRewrite
+)
+
+func (a QueryPolicyAction) String() string {
+	switch a {
+	case QueryPolicyAllow:
+		return "allow"
+	case QueryPolicyDeny:
+		return "deny"
+	case QueryPolicyRewrite:
+		return "rewrite"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(a))
+	}
+}
+
+// QueryPolicyDecision is the decision taken by a QueryPolicyHook on a query.
+type QueryPolicyDecision struct {
+	Action QueryPolicyAction
+
+	// Reason is returned to the client when the query is denied.
+	Reason string
+
+	// Query replaces the original query when the action is QueryPolicyRewrite.
+	Query parser.Expr
+}
+
+// QueryPolicyHook allows downstream consumers to enforce custom governance policies on queries, such as
+// data residency or access to selectors containing personal data, without forking the middleware chain.
+type QueryPolicyHook interface {
+	// Evaluate is invoked for each range and instant query, with the tenants of the request, the parsed query
+	// and its estimated cost. Returning an error rejects the query.
+	Evaluate(ctx context.Context, tenantIDs []string, query parser.Expr, estimatedCost time.Duration) (QueryPolicyDecision, error)
+}
+
+type queryPolicyMiddleware struct {
+	next   Handler
+	hook   QueryPolicyHook
+	logger log.Logger
+
+	decisions *prometheus.CounterVec
+}
+
+// newQueryPolicyMiddleware creates a new Middleware which allows, denies or rewrites queries
+// according to the decision of the input hook.
+func newQueryPolicyMiddleware(hook QueryPolicyHook, logger log.Logger, registerer prometheus.Registerer) Middleware {
+	decisions := promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_query_policy_decisions_total",
+		Help: "Total number of queries evaluated by the query policy hook, partitioned by decision.",
+	}, []string{"decision"})
+
+	return MiddlewareFunc(func(next Handler) Handler {
+		return queryPolicyMiddleware{
+			next:      next,
+			hook:      hook,
+			logger:    logger,
+			decisions: decisions,
+		}
+	})
+}
+
+func (m queryPolicyMiddleware) Do(ctx context.Context, r Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	expr, err := parser.ParseExpr(r.GetQuery())
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, decorateWithParamName(err, "query").Error())
+	}
+	cost := estimateExprCost(expr, r)
+
+	logger := loggerWithQueryAttributes(ctx, m.logger)
+
+	decision, err := m.hook.Evaluate(ctx, tenantIDs, expr, cost)
+	if err != nil {
+		m.decisions.WithLabelValues("error").Inc()
+		level.Warn(logger).Log("msg", "query policy hook failed to evaluate the query", "err", err)
+		return nil, apierror.Newf(apierror.TypeInternal, "failed to evaluate the query policy: %s", err)
+	}
+
+	switch decision.Action {
+	case QueryPolicyAllow:
+		m.decisions.WithLabelValues(decision.Action.String()).Inc()
+		return m.next.Do(ctx, r)
+
+	case QueryPolicyDeny:
+		m.decisions.WithLabelValues(decision.Action.String()).Inc()
+		level.Debug(logger).Log("msg", "query denied by the query policy", "reason", decision.Reason)
+		return nil, apierror.Newf(apierror.TypeBadData, "the query has been denied by the query policy: %s", decision.Reason)
+
+	case QueryPolicyRewrite:
+		if decision.Query == nil {
+			break
+		}
+		m.decisions.WithLabelValues(decision.Action.String()).Inc()
+		rewritten := decision.Query.String()
+		level.Debug(logger).Log("msg", "query rewritten by the query policy", "rewritten_query", rewritten)
+		return m.next.Do(ctx, r.WithQuery(rewritten))
+	}
+
+	m.decisions.WithLabelValues("error").Inc()
+	return nil, apierror.Newf(apierror.TypeInternal, "invalid query policy decision: %s", decision.Action)
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+)
+
+type queryPolicyHookFunc func(ctx context.Context, tenantIDs []string, query parser.Expr, estimatedCost time.Duration) (QueryPolicyDecision, error)
+
+func (f queryPolicyHookFunc) Evaluate(ctx context.Context, tenantIDs []string, query parser.Expr, estimatedCost time.Duration) (QueryPolicyDecision, error) {
+	return f(ctx, tenantIDs, query, estimatedCost)
+}
+
+func TestQueryPolicyMiddleware(t *testing.T) {
+	const hour = int64(time.Hour / time.Millisecond)
+
+	rewritten, err := parser.ParseExpr(`up{region="eu"}`)
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		decision         QueryPolicyDecision
+		hookErr          error
+		expectedQuery    string
+		expectedErr      string
+		expectedErrType  apierror.Type
+		expectedDecision string
+	}{
+		"allow": {
+			decision:         QueryPolicyDecision{Action: QueryPolicyAllow},
+			expectedQuery:    `up`,
+			expectedDecision: "allow",
+		},
+		"deny": {
+			decision:         QueryPolicyDecision{Action: QueryPolicyDeny, Reason: "querying EU data is not allowed"},
+			expectedErr:      "the query has been denied by the query policy: querying EU data is not allowed",
+			expectedErrType:  apierror.TypeBadData,
+			expectedDecision: "deny",
+		},
+		"rewrite": {
+			decision:         QueryPolicyDecision{Action: QueryPolicyRewrite, Query: rewritten},
+			expectedQuery:    `up{region="eu"}`,
+			expectedDecision: "rewrite",
+		},
+		"rewrite without query": {
+			decision:         QueryPolicyDecision{Action: QueryPolicyRewrite},
+			expectedErr:      "invalid query policy decision: rewrite",
+			expectedErrType:  apierror.TypeInternal,
+			expectedDecision: "error",
+		},
+		"hook error": {
+			hookErr:          errors.New("policy engine unavailable"),
+			expectedErr:      "failed to evaluate the query policy: policy engine unavailable",
+			expectedErrType:  apierror.TypeInternal,
+			expectedDecision: "error",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var (
+				actualTenantIDs []string
+				actualQuery     string
+				actualCost      time.Duration
+				executedQuery   string
+			)
+
+			hook := queryPolicyHookFunc(func(_ context.Context, tenantIDs []string, query parser.Expr, estimatedCost time.Duration) (QueryPolicyDecision, error) {
+				actualTenantIDs, actualQuery, actualCost = tenantIDs, query.String(), estimatedCost
+				return tc.decision, tc.hookErr
+			})
+
+			reg := prometheus.NewPedanticRegistry()
+			handler := newQueryPolicyMiddleware(hook, log.NewNopLogger(), reg).Wrap(HandlerFunc(func(_ context.Context, r Request) (Response, error) {
+				executedQuery = r.GetQuery()
+				return &PrometheusResponse{Status: statusSuccess}, nil
+			}))
+
+			ctx := user.InjectOrgID(context.Background(), "user-1")
+			_, err := handler.Do(ctx, &PrometheusRangeQueryRequest{Query: `up`, Start: 0, End: 2 * hour, Step: 60000})
+
+			assert.Equal(t, []string{"user-1"}, actualTenantIDs)
+			assert.Equal(t, `up`, actualQuery)
+			assert.Equal(t, 2*time.Hour+5*time.Minute, actualCost)
+			assert.Equal(t, tc.expectedQuery, executedQuery)
+
+			if tc.expectedErr != "" {
+				assert.Equal(t, apierror.New(tc.expectedErrType, tc.expectedErr), err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_query_frontend_query_policy_decisions_total Total number of queries evaluated by the query policy hook, partitioned by decision.
+				# TYPE cortex_query_frontend_query_policy_decisions_total counter
+				cortex_query_frontend_query_policy_decisions_total{decision="`+tc.expectedDecision+`"} 1
+			`)))
+		})
+	}
+
+	t.Run("should reject an invalid query without invoking the hook", func(t *testing.T) {
+		hook := queryPolicyHookFunc(func(context.Context, []string, parser.Expr, time.Duration) (QueryPolicyDecision, error) {
+			require.Fail(t, "the hook should not be invoked")
+			return QueryPolicyDecision{}, nil
+		})
+
+		handler := newQueryPolicyMiddleware(hook, log.NewNopLogger(), nil).Wrap(HandlerFunc(func(context.Context, Request) (Response, error) {
+			return &PrometheusResponse{Status: statusSuccess}, nil
+		}))
+
+		_, err := handler.Do(user.InjectOrgID(context.Background(), "user-1"), &PrometheusRangeQueryRequest{Query: `up{`})
+		require.Error(t, err)
+		assert.True(t, apierror.IsAPIError(err))
+	})
+}
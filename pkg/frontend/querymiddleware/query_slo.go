@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+const (
+	// querySLOBucketSize is the time range covered by each bucket of queries tracked per tenant.
+	querySLOBucketSize = time.Minute
+
+	// querySLOUpdateInterval is how frequently the SLI, burn rate and error budget metrics are updated.
+	querySLOUpdateInterval = time.Minute
+
+	querySLIAvailability = "availability"
+	querySLILatency      = "latency"
+)
+
+var (
+	// querySLOWindows are the rolling windows over which the SLIs are computed. The shortest windows
+	// react quickly to a fast burn of the error budget, while the longest ones catch a slow burn.
+	querySLOWindows = []time.Duration{5 * time.Minute, time.Hour, 6 * time.Hour}
+
+	// querySLOBuckets is the number of buckets required to cover the longest window.
+	querySLOBuckets = int(querySLOWindows[len(querySLOWindows)-1] / querySLOBucketSize)
+)
+
+// querySLOBucket holds the number of queries received by a tenant in a time range of querySLOBucketSize.
+type querySLOBucket struct {
+	// The index of the time range covered by the bucket, in units of querySLOBucketSize since the epoch.
+	index int64
+
+	queries  int
+	failures int
+	slow     int
+}
+
+// querySLOTracker tracks the per-tenant query availability and latency over rolling windows, and exports
+// the SLIs along with the burn rate and the remaining error budget for the configured objective.
+type querySLOTracker struct {
+	services.Service
+
+	objective        float64
+	latencyThreshold time.Duration
+
+	mtx     sync.Mutex
+	tenants map[string][]querySLOBucket
+
+	activeUsers          *util.ActiveUsersCleanupService
+	sli                  *prometheus.GaugeVec
+	burnRate             *prometheus.GaugeVec
+	errorBudgetRemaining *prometheus.GaugeVec
+}
+
+func newQuerySLOTracker(objective float64, latencyThreshold time.Duration, reg prometheus.Registerer) *querySLOTracker {
+	t := &querySLOTracker{
+		objective:        objective,
+		latencyThreshold: latencyThreshold,
+		tenants:          map[string][]querySLOBucket{},
+		sli: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_query_frontend_query_sli",
+			Help: "Fraction of the tenant queries meeting the availability or latency objective, over the rolling window.",
+		}, []string{"user", "sli", "window"}),
+		burnRate: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_query_frontend_query_slo_burn_rate",
+			Help: "How fast the tenant is consuming its query error budget over the rolling window. A value of 1 means the error budget would be fully consumed at the end of the window.",
+		}, []string{"user", "sli", "window"}),
+		errorBudgetRemaining: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_query_frontend_query_slo_error_budget_remaining",
+			Help: "Fraction of the tenant query error budget which has not been consumed over the longest rolling window.",
+		}, []string{"user", "sli"}),
+	}
+
+	t.activeUsers = util.NewActiveUsersCleanupWithDefaultValues(t.cleanupTenant)
+	t.Service = services.NewTimerService(querySLOUpdateInterval, t.starting, t.iteration, t.stopping)
+	return t
+}
+
+func (t *querySLOTracker) starting(ctx context.Context) error {
+	return services.StartAndAwaitRunning(ctx, t.activeUsers)
+}
+
+func (t *querySLOTracker) iteration(context.Context) error {
+	t.update(time.Now())
+	return nil
+}
+
+func (t *querySLOTracker) stopping(_ error) error {
+	return services.StopAndAwaitTerminated(context.Background(), t.activeUsers)
+}
+
+// observe tracks the outcome and duration of a query received by the input tenant.
+func (t *querySLOTracker) observe(tenantID string, failed bool, duration time.Duration, now time.Time) {
+	t.activeUsers.UpdateUserTimestamp(tenantID, now)
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	buckets, ok := t.tenants[tenantID]
+	if !ok {
+		buckets = make([]querySLOBucket, querySLOBuckets)
+		t.tenants[tenantID] = buckets
+	}
+
+	index := querySLOBucketIndex(now)
+	bucket := &buckets[index%int64(querySLOBuckets)]
+	if bucket.index != index {
+		*bucket = querySLOBucket{index: index}
+	}
+
+	bucket.queries++
+	if failed {
+		bucket.failures++
+	}
+	if duration > t.latencyThreshold {
+		bucket.slow++
+	}
+}
+
+// update computes the SLIs of each tenant over each window, and updates the exported metrics.
+// Only the buckets of the time ranges completed before now are taken into account.
+func (t *querySLOTracker) update(now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	current := querySLOBucketIndex(now)
+
+	for tenantID, buckets := range t.tenants {
+		for _, window := range querySLOWindows {
+			var queries, failures, slow int
+
+			for index := current - int64(window/querySLOBucketSize); index < current; index++ {
+				bucket := buckets[index%int64(querySLOBuckets)]
+				if bucket.index != index {
+					continue
+				}
+
+				queries += bucket.queries
+				failures += bucket.failures
+				slow += bucket.slow
+			}
+
+			windowLabel := model.Duration(window).String()
+			isLongestWindow := window == querySLOWindows[len(querySLOWindows)-1]
+
+			// Do not export any metric for windows without queries.
+			if queries == 0 {
+				for _, sli := range []string{querySLIAvailability, querySLILatency} {
+					t.sli.DeleteLabelValues(tenantID, sli, windowLabel)
+					t.burnRate.DeleteLabelValues(tenantID, sli, windowLabel)
+					if isLongestWindow {
+						t.errorBudgetRemaining.DeleteLabelValues(tenantID, sli)
+					}
+				}
+				continue
+			}
+
+			for sli, bad := range map[string]int{querySLIAvailability: failures, querySLILatency: slow} {
+				badRatio := float64(bad) / float64(queries)
+				burnRate := badRatio / (1 - t.objective)
+
+				t.sli.WithLabelValues(tenantID, sli, windowLabel).Set(1 - badRatio)
+				t.burnRate.WithLabelValues(tenantID, sli, windowLabel).Set(burnRate)
+				if isLongestWindow {
+					t.errorBudgetRemaining.WithLabelValues(tenantID, sli).Set(1 - burnRate)
+				}
+			}
+		}
+	}
+}
+
+func (t *querySLOTracker) cleanupTenant(tenantID string) {
+	t.mtx.Lock()
+	delete(t.tenants, tenantID)
+	t.mtx.Unlock()
+
+	t.sli.DeletePartialMatch(prometheus.Labels{"user": tenantID})
+	t.burnRate.DeletePartialMatch(prometheus.Labels{"user": tenantID})
+	t.errorBudgetRemaining.DeletePartialMatch(prometheus.Labels{"user": tenantID})
+}
+
+func querySLOBucketIndex(ts time.Time) int64 {
+	return ts.UnixNano() / int64(querySLOBucketSize)
+}
+
+// newQuerySLOMiddleware makes a new middleware which tracks the outcome and duration of each query
+// in the input querySLOTracker. Queries canceled by the client are not tracked, because they don't
+// tell anything about the quality of the service.
+func newQuerySLOMiddleware(tracker *querySLOTracker) Middleware {
+	return MiddlewareFunc(func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req Request) (Response, error) {
+			start := time.Now()
+			res, err := next.Do(ctx, req)
+
+			if errors.Is(err, context.Canceled) {
+				return res, err
+			}
+
+			if tenantIDs, tenantErr := tenant.TenantIDs(ctx); tenantErr == nil {
+				now := time.Now()
+				tracker.observe(tenant.JoinTenantIDs(tenantIDs), isQueryServerError(err), now.Sub(start), now)
+			}
+
+			return res, err
+		})
+	})
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+)
+
+func TestQuerySLOTracker(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	tracker := newQuerySLOTracker(0.75, 10*time.Second, reg)
+	now := time.Unix(1000*60, 0)
+
+	observe := func(tenantID string, ts time.Time, queries, failures, slow int) {
+		for i := 0; i < queries; i++ {
+			duration := time.Second
+			if i < slow {
+				duration = time.Minute
+			}
+			tracker.observe(tenantID, i < failures, duration, ts)
+		}
+	}
+
+	// user-1 received queries in the last 5 minutes and 30 minutes ago.
+	observe("user-1", now.Add(-2*time.Minute), 100, 25, 50)
+	observe("user-1", now.Add(-30*time.Minute), 100, 0, 0)
+
+	// user-2 received queries only 2 hours ago.
+	observe("user-2", now.Add(-2*time.Hour), 10, 0, 10)
+
+	// Queries received in the current bucket are not taken into account until the bucket is completed.
+	observe("user-1", now, 100, 100, 100)
+
+	tracker.update(now)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_frontend_query_sli Fraction of the tenant queries meeting the availability or latency objective, over the rolling window.
+		# TYPE cortex_query_frontend_query_sli gauge
+		cortex_query_frontend_query_sli{sli="availability",user="user-1",window="5m"} 0.75
+		cortex_query_frontend_query_sli{sli="availability",user="user-1",window="1h"} 0.875
+		cortex_query_frontend_query_sli{sli="availability",user="user-1",window="6h"} 0.875
+		cortex_query_frontend_query_sli{sli="latency",user="user-1",window="5m"} 0.5
+		cortex_query_frontend_query_sli{sli="latency",user="user-1",window="1h"} 0.75
+		cortex_query_frontend_query_sli{sli="latency",user="user-1",window="6h"} 0.75
+		cortex_query_frontend_query_sli{sli="availability",user="user-2",window="6h"} 1
+		cortex_query_frontend_query_sli{sli="latency",user="user-2",window="6h"} 0
+
+		# HELP cortex_query_frontend_query_slo_burn_rate How fast the tenant is consuming its query error budget over the rolling window. A value of 1 means the error budget would be fully consumed at the end of the window.
+		# TYPE cortex_query_frontend_query_slo_burn_rate gauge
+		cortex_query_frontend_query_slo_burn_rate{sli="availability",user="user-1",window="5m"} 1
+		cortex_query_frontend_query_slo_burn_rate{sli="availability",user="user-1",window="1h"} 0.5
+		cortex_query_frontend_query_slo_burn_rate{sli="availability",user="user-1",window="6h"} 0.5
+		cortex_query_frontend_query_slo_burn_rate{sli="latency",user="user-1",window="5m"} 2
+		cortex_query_frontend_query_slo_burn_rate{sli="latency",user="user-1",window="1h"} 1
+		cortex_query_frontend_query_slo_burn_rate{sli="latency",user="user-1",window="6h"} 1
+		cortex_query_frontend_query_slo_burn_rate{sli="availability",user="user-2",window="6h"} 0
+		cortex_query_frontend_query_slo_burn_rate{sli="latency",user="user-2",window="6h"} 4
+
+		# HELP cortex_query_frontend_query_slo_error_budget_remaining Fraction of the tenant query error budget which has not been consumed over the longest rolling window.
+		# TYPE cortex_query_frontend_query_slo_error_budget_remaining gauge
+		cortex_query_frontend_query_slo_error_budget_remaining{sli="availability",user="user-1"} 0.5
+		cortex_query_frontend_query_slo_error_budget_remaining{sli="latency",user="user-1"} 0
+		cortex_query_frontend_query_slo_error_budget_remaining{sli="availability",user="user-2"} 1
+		cortex_query_frontend_query_slo_error_budget_remaining{sli="latency",user="user-2"} -3
+	`), "cortex_query_frontend_query_sli", "cortex_query_frontend_query_slo_burn_rate", "cortex_query_frontend_query_slo_error_budget_remaining"))
+
+	// Once the queries fall out of all windows, the metrics are removed. Inactive tenants are cleaned up.
+	tracker.update(now.Add(7 * time.Hour))
+	tracker.cleanupTenant("user-1")
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(""),
+		"cortex_query_frontend_query_sli", "cortex_query_frontend_query_slo_burn_rate", "cortex_query_frontend_query_slo_error_budget_remaining"))
+
+	tracker.mtx.Lock()
+	assert.NotContains(t, tracker.tenants, "user-1")
+	assert.Contains(t, tracker.tenants, "user-2")
+	tracker.mtx.Unlock()
+}
+
+func TestQuerySLOMiddleware(t *testing.T) {
+	tracker := newQuerySLOTracker(0.99, time.Hour, nil)
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+
+	for _, err := range []error{
+		nil,
+		apierror.New(apierror.TypeBadData, "bad data"),
+		apierror.New(apierror.TypeInternal, "internal"),
+		fmt.Errorf("wrapped: %w", context.Canceled),
+	} {
+		_, _ = newQuerySLOMiddleware(tracker).Wrap(HandlerFunc(func(context.Context, Request) (Response, error) {
+			return &PrometheusResponse{}, err
+		})).Do(ctx, &PrometheusRangeQueryRequest{Query: "up"})
+	}
+
+	tracker.mtx.Lock()
+	defer tracker.mtx.Unlock()
+	require.Contains(t, tracker.tenants, "user-1")
+
+	var queries, failures, slow int
+	for _, bucket := range tracker.tenants["user-1"] {
+		queries += bucket.queries
+		failures += bucket.failures
+		slow += bucket.slow
+	}
+
+	// Queries canceled by the client are not tracked.
+	assert.Equal(t, 3, queries)
+	assert.Equal(t, 1, failures)
+	assert.Equal(t, 0, slow)
+}
@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package querymiddlewaretest provides utilities to test the query middlewares, and the applications
+// embedding them, against a downstream whose responses are scripted.
+package querymiddlewaretest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"github.com/grafana/mimir/pkg/frontend/querymiddleware"
+)
+
+// Outcome describes how the fake downstream responds to a request.
+type Outcome struct {
+	// Latency is how long the downstream waits before responding. The wait is interrupted,
+	// and the request fails, if the request context is canceled in the meanwhile.
+	Latency time.Duration
+
+	// Err is returned as the error of the round trip, if set, simulating a network error.
+	Err error
+
+	// StatusCode is the status code of the response. Defaults to 200.
+	StatusCode int
+
+	// Header contains the headers of the response. The Content-Type defaults to application/json.
+	Header http.Header
+
+	// Body is the body of the response.
+	Body []byte
+}
+
+// WithLatency returns a copy of the outcome, which waits for the input latency before responding.
+func (o Outcome) WithLatency(latency time.Duration) Outcome {
+	o.Latency = latency
+	return o
+}
+
+// Success returns an outcome responding with the input Prometheus response, encoded as JSON.
+func Success(res *querymiddleware.PrometheusResponse) Outcome {
+	body, err := json.Marshal(res)
+	if err != nil {
+		// The response is built by the caller, so it's a programming error.
+		panic(err)
+	}
+	return Outcome{StatusCode: http.StatusOK, Body: body}
+}
+
+// EmptyMatrix returns an outcome responding with an empty successful range query result.
+func EmptyMatrix() Outcome {
+	return Success(&querymiddleware.PrometheusResponse{
+		Status: "success",
+		Data:   &querymiddleware.PrometheusData{ResultType: "matrix", Result: []querymiddleware.SampleStream{}},
+	})
+}
+
+// Error returns an outcome responding with the input status code and a Prometheus API error,
+// of the input type and message.
+func Error(statusCode int, errorType, message string) Outcome {
+	body, err := json.Marshal(&querymiddleware.PrometheusResponse{Status: "error", ErrorType: errorType, Error: message})
+	if err != nil {
+		panic(err)
+	}
+	return Outcome{StatusCode: statusCode, Body: body}
+}
+
+// NetworkError returns an outcome failing the round trip with the input error.
+func NetworkError(err error) Outcome {
+	return Outcome{Err: err}
+}
+
+// Malformed returns an outcome responding with the 200 status code and a body which can't be decoded,
+// like a response truncated by the downstream.
+func Malformed() Outcome {
+	return Outcome{StatusCode: http.StatusOK, Body: []byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":`)}
+}
+
+// RequestMatcher returns whether a rule applies to the input request.
+type RequestMatcher func(r *http.Request) bool
+
+// MatchAll matches all requests.
+func MatchAll() RequestMatcher {
+	return func(*http.Request) bool { return true }
+}
+
+// MatchPath matches requests whose URL path ends with the input suffix, for example "/query_range".
+func MatchPath(suffix string) RequestMatcher {
+	return func(r *http.Request) bool { return strings.HasSuffix(r.URL.Path, suffix) }
+}
+
+// MatchQueryContains matches requests whose PromQL query contains the input string. For example,
+// it can match the requests of a single shard with `__query_shard__="1_of_16"`.
+func MatchQueryContains(s string) RequestMatcher {
+	return func(r *http.Request) bool { return strings.Contains(requestParam(r, "query"), s) }
+}
+
+// Rule scripts the outcome of the requests matching the rule.
+type Rule struct {
+	// Match selects the requests the rule applies to. All requests are matched if nil.
+	Match RequestMatcher
+
+	// Outcome is the outcome of the matching requests.
+	Outcome Outcome
+
+	// Times is the number of requests the rule applies to, after which it's ignored. 0 for no limit.
+	Times int
+}
+
+// FakeDownstream is a downstream of the query middlewares whose responses are scripted by rules.
+// For each request, the first rule matching the request, and not applied the configured number of
+// times yet, determines the outcome. Requests not matching any rule get the default outcome.
+// It's safe for concurrent use.
+type FakeDownstream struct {
+	mtx            sync.Mutex
+	rules          []*Rule
+	applied        []int
+	defaultOutcome Outcome
+	requests       []*http.Request
+}
+
+// NewFakeDownstream returns a fake downstream with the input default outcome.
+func NewFakeDownstream(defaultOutcome Outcome) *FakeDownstream {
+	return &FakeDownstream{defaultOutcome: defaultOutcome}
+}
+
+// AddRule adds a rule, evaluated after the rules already added. It returns the downstream, to chain calls.
+func (d *FakeDownstream) AddRule(rule Rule) *FakeDownstream {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.rules = append(d.rules, &rule)
+	d.applied = append(d.applied, 0)
+	return d
+}
+
+// On adds a rule applying the input outcome to all the matching requests.
+func (d *FakeDownstream) On(match RequestMatcher, outcome Outcome) *FakeDownstream {
+	return d.AddRule(Rule{Match: match, Outcome: outcome})
+}
+
+// Times adds a rule applying the input outcome to the first n matching requests.
+func (d *FakeDownstream) Times(n int, match RequestMatcher, outcome Outcome) *FakeDownstream {
+	return d.AddRule(Rule{Match: match, Outcome: outcome, Times: n})
+}
+
+// Requests returns the requests received so far, in the order they've been received.
+func (d *FakeDownstream) Requests() []*http.Request {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return append([]*http.Request(nil), d.requests...)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (d *FakeDownstream) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Parse the form before recording the request, so that its parameters can be inspected later,
+	// even if the request body has been consumed.
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	outcome := d.outcomeFor(r)
+
+	if outcome.Latency > 0 {
+		select {
+		case <-time.After(outcome.Latency):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
+
+	if outcome.Err != nil {
+		return nil, outcome.Err
+	}
+
+	res := &http.Response{
+		StatusCode:    outcome.StatusCode,
+		Header:        outcome.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(outcome.Body)),
+		ContentLength: int64(len(outcome.Body)),
+		Request:       r,
+	}
+	if res.StatusCode == 0 {
+		res.StatusCode = http.StatusOK
+	}
+	if res.Header == nil {
+		res.Header = http.Header{}
+	}
+	if res.Header.Get("Content-Type") == "" {
+		res.Header.Set("Content-Type", "application/json")
+	}
+	return res, nil
+}
+
+// Handler returns the downstream as a querymiddleware.Handler, to test the middlewares directly.
+// Requests are encoded, and responses decoded, with the input codec, like the query-frontend does.
+func (d *FakeDownstream) Handler(codec querymiddleware.Codec) querymiddleware.Handler {
+	return querymiddleware.HandlerFunc(func(ctx context.Context, req querymiddleware.Request) (querymiddleware.Response, error) {
+		r, err := codec.EncodeRequest(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := d.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = res.Body.Close() }()
+
+		return codec.DecodeResponse(ctx, res, req, log.NewNopLogger())
+	})
+}
+
+// outcomeFor records the input request, and returns its outcome.
+func (d *FakeDownstream) outcomeFor(r *http.Request) Outcome {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.requests = append(d.requests, r)
+
+	for i, rule := range d.rules {
+		if rule.Times > 0 && d.applied[i] >= rule.Times {
+			continue
+		}
+		if rule.Match != nil && !rule.Match(r) {
+			continue
+		}
+
+		d.applied[i]++
+		return rule.Outcome
+	}
+	return d.defaultOutcome
+}
+
+func requestParam(r *http.Request, name string) string {
+	if r.Form != nil {
+		return r.Form.Get(name)
+	}
+	return r.URL.Query().Get(name)
+}
@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddlewaretest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/grafana/mimir/pkg/frontend/querymiddleware"
+)
+
+func newRangeQueryRequest(query string) *querymiddleware.PrometheusRangeQueryRequest {
+	return &querymiddleware.PrometheusRangeQueryRequest{
+		Path:  "/api/v1/query_range",
+		Start: 0,
+		End:   time.Hour.Milliseconds(),
+		Step:  time.Minute.Milliseconds(),
+		Query: query,
+	}
+}
+
+func TestFakeDownstream_Handler(t *testing.T) {
+	codec := querymiddleware.NewPrometheusCodec(prometheus.NewPedanticRegistry(), "json")
+
+	t.Run("should respond with the default outcome if no rule matches", func(t *testing.T) {
+		downstream := NewFakeDownstream(EmptyMatrix()).
+			On(MatchQueryContains("other"), Error(http.StatusBadRequest, "bad_data", "unexpected"))
+
+		res, err := downstream.Handler(codec).Do(context.Background(), newRangeQueryRequest("up"))
+		require.NoError(t, err)
+		assert.Equal(t, "success", res.(*querymiddleware.PrometheusResponse).Status)
+
+		require.Len(t, downstream.Requests(), 1)
+		assert.Equal(t, "up", downstream.Requests()[0].Form.Get("query"))
+	})
+
+	t.Run("should apply a rule the configured number of times", func(t *testing.T) {
+		downstream := NewFakeDownstream(EmptyMatrix()).
+			Times(2, MatchAll(), Error(http.StatusInternalServerError, "internal", "transient failure"))
+		handler := downstream.Handler(codec)
+
+		for i := 0; i < 2; i++ {
+			_, err := handler.Do(context.Background(), newRangeQueryRequest("up"))
+			require.Error(t, err)
+
+			res, ok := httpgrpc.HTTPResponseFromError(err)
+			require.True(t, ok)
+			assert.Equal(t, int32(http.StatusInternalServerError), res.Code)
+		}
+
+		_, err := handler.Do(context.Background(), newRangeQueryRequest("up"))
+		require.NoError(t, err)
+		assert.Len(t, downstream.Requests(), 3)
+	})
+
+	t.Run("should fail only the matching requests", func(t *testing.T) {
+		downstream := NewFakeDownstream(EmptyMatrix()).
+			On(MatchQueryContains(`__query_shard__="2_of_4"`), Error(http.StatusInternalServerError, "internal", "shard failure"))
+		handler := downstream.Handler(codec)
+
+		var (
+			wg     sync.WaitGroup
+			mtx    sync.Mutex
+			failed []string
+		)
+		for _, shard := range []string{"1_of_4", "2_of_4", "3_of_4", "4_of_4"} {
+			shard := shard
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := handler.Do(context.Background(), newRangeQueryRequest(`up{__query_shard__="`+shard+`"}`)); err != nil {
+					mtx.Lock()
+					failed = append(failed, shard)
+					mtx.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, []string{"2_of_4"}, failed)
+		assert.Len(t, downstream.Requests(), 4)
+	})
+
+	t.Run("should fail to decode a malformed response", func(t *testing.T) {
+		downstream := NewFakeDownstream(Malformed())
+
+		_, err := downstream.Handler(codec).Do(context.Background(), newRangeQueryRequest("up"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "error decoding response")
+	})
+
+	t.Run("should return the network error", func(t *testing.T) {
+		networkErr := errors.New("connection reset by peer")
+		downstream := NewFakeDownstream(NetworkError(networkErr))
+
+		_, err := downstream.Handler(codec).Do(context.Background(), newRangeQueryRequest("up"))
+		require.ErrorIs(t, err, networkErr)
+	})
+
+	t.Run("should wait for the latency before responding", func(t *testing.T) {
+		downstream := NewFakeDownstream(EmptyMatrix().WithLatency(50 * time.Millisecond))
+
+		start := time.Now()
+		_, err := downstream.Handler(codec).Do(context.Background(), newRangeQueryRequest("up"))
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("should stop waiting for the latency if the context is canceled", func(t *testing.T) {
+		downstream := NewFakeDownstream(EmptyMatrix().WithLatency(time.Minute))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := downstream.Handler(codec).Do(ctx, newRangeQueryRequest("up"))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestFakeDownstream_RoundTrip(t *testing.T) {
+	downstream := NewFakeDownstream(EmptyMatrix()).
+		On(MatchPath("/query"), Outcome{StatusCode: http.StatusTeapot, Header: http.Header{"Content-Type": []string{"text/plain"}}, Body: []byte("teapot")})
+
+	req, err := http.NewRequest(http.MethodGet, "http://frontend/prometheus/api/v1/query?query=up", nil)
+	require.NoError(t, err)
+
+	res, err := downstream.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTeapot, res.StatusCode)
+	assert.Equal(t, "text/plain", res.Header.Get("Content-Type"))
+
+	req, err = http.NewRequest(http.MethodGet, "http://frontend/prometheus/api/v1/query_range?query=up", nil)
+	require.NoError(t, err)
+
+	res, err = downstream.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+}
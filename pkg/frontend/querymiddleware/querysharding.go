@@ -98,7 +98,7 @@ func newQueryShardingMiddleware(
 }
 
 func (s *querySharding) Do(ctx context.Context, r Request) (Response, error) {
-	log, ctx := spanlogger.NewWithLogger(ctx, s.logger, "querySharding.Do")
+	log, ctx := spanlogger.NewWithLogger(ctx, loggerWithQueryAttributes(ctx, s.logger), "querySharding.Do")
 	defer log.Span.Finish()
 
 	tenantIDs, err := tenant.TenantIDs(ctx)
@@ -159,14 +159,20 @@ func (s *querySharding) Do(ctx context.Context, r Request) (Response, error) {
 	if err != nil {
 		return nil, mapEngineError(err)
 	}
-	return &PrometheusResponse{
+	merged := &PrometheusResponse{
 		Status: statusSuccess,
 		Data: &PrometheusData{
 			ResultType: string(res.Value.Type()),
 			Result:     extracted,
 		},
 		Headers: shardedQueryable.getResponseHeaders(),
-	}, nil
+	}
+
+	// The responses of the sharded queries are accounted when decoded, and the merged response is accounted here.
+	if err := queryMemoryTrackerFromContext(ctx).addResponses(merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
 }
 
 func newQuery(r Request, engine *promql.Engine, queryable storage.Queryable) (promql.Query, error) {
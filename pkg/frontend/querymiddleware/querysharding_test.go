@@ -362,6 +362,45 @@ func TestQueryShardingCorrectness(t *testing.T) {
 							)`,
 			expectedShardedQueries: 1,
 		},
+		"label_replace wrapping an aggregation": {
+			query: `label_replace(
+							sum by (group_2)(rate(metric_counter[1m])),
+							"foo", "bar$1", "group_2", "(.*)"
+						)`,
+			expectedShardedQueries: 1,
+		},
+		"label_join wrapping an aggregation": {
+			query: `label_join(
+							sum by (group_1, group_2)(rate(metric_counter[1m])),
+							"foo", ",", "group_1", "group_2"
+						)`,
+			expectedShardedQueries: 1,
+		},
+		"nested label_replace and label_join": {
+			query: `sum by (bar)(
+							label_replace(
+								label_join(
+									rate(metric_counter{group_1="0"}[1m]),
+									"foo", ",", "group_1", "group_2", "const"
+								),
+								"bar", "$1", "foo", "(.*),.*"
+							)
+						)`,
+			expectedShardedQueries: 1,
+		},
+		"aggregation by label_replace destination label in binary operation": {
+			query: `sum by (foo)(label_replace(rate(metric_counter[1m]), "foo", "bar$1", "group_2", "(.*)"))
+					/ on (foo)
+					sum by (foo)(label_replace(rate(metric_counter[5m]), "foo", "bar$1", "group_2", "(.*)"))`,
+			expectedShardedQueries: 2,
+		},
+		"label_replace wrapping an aggregation of label_replace": {
+			query: `label_replace(
+							max by (foo)(label_replace(rate(metric_counter[1m]), "foo", "bar$1", "group_2", "(.*)")),
+							"foo", "$1", "foo", "bar(.*)"
+						)`,
+			expectedShardedQueries: 1,
+		},
 		`query with sort() expects specific order`: {
 			query:                  `sort(sum(metric_histogram_bucket) by (le))`,
 			expectedShardedQueries: 1,
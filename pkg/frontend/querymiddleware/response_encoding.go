@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+type responseEncodingMetrics struct {
+	encodingSeconds  *prometheus.CounterVec
+	encodedBytes     *prometheus.CounterVec
+	rejectedTooLarge *prometheus.CounterVec
+}
+
+func newResponseEncodingMetrics(registerer prometheus.Registerer) *responseEncodingMetrics {
+	return &responseEncodingMetrics{
+		encodingSeconds: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_response_encoding_seconds_total",
+			Help: "Total time spent encoding the query responses sent to the clients, in seconds.",
+		}, []string{"user"}),
+		encodedBytes: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_response_encoded_bytes_total",
+			Help: "Total size of the encoded query responses sent to the clients, in bytes.",
+		}, []string{"user"}),
+		rejectedTooLarge: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_response_size_limit_rejected_queries_total",
+			Help: "Total number of queries failed because the size of the encoded response exceeded the limit.",
+		}, []string{"user"}),
+	}
+}
+
+// sizedResponse is implemented by the responses whose protobuf size can be computed.
+type sizedResponse interface {
+	Size() int
+}
+
+// encodeResponse encodes the input response, tracking the encoding time and the size of the encoded
+// response by tenant, and enforcing the tenant limit on the size of the encoded response.
+//
+// The encoded response size is estimated from the protobuf size of the response before encoding it,
+// so that the encoding of responses clearly exceeding the limit, which could exhaust the query-frontend
+// memory, is not even attempted. The limit is enforced on the actual size once the response is encoded.
+func (rt limitedParallelismRoundTripper) encodeResponse(ctx context.Context, r *http.Request, tenantIDs []string, response Response) (*http.Response, error) {
+	userID := tenant.JoinTenantIDs(tenantIDs)
+	maxSize := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, rt.limits.MaxQueryResponseSizeBytes)
+
+	if sized, ok := response.(sizedResponse); ok && maxSize > 0 {
+		if estimatedSize := sized.Size(); estimatedSize > maxSize {
+			rt.encodingMetrics.rejectedTooLarge.WithLabelValues(userID).Inc()
+			return nil, apierror.New(apierror.TypeBadData, validation.NewMaxQueryResponseSizeBytesError(estimatedSize, maxSize).Error())
+		}
+	}
+
+	start := time.Now()
+	encoded, err := rt.codec.EncodeResponse(ctx, r, response)
+	if err != nil {
+		return nil, err
+	}
+
+	rt.encodingMetrics.encodingSeconds.WithLabelValues(userID).Add(time.Since(start).Seconds())
+	rt.encodingMetrics.encodedBytes.WithLabelValues(userID).Add(float64(encoded.ContentLength))
+
+	if maxSize > 0 && encoded.ContentLength > int64(maxSize) {
+		rt.encodingMetrics.rejectedTooLarge.WithLabelValues(userID).Inc()
+		return nil, apierror.New(apierror.TypeBadData, validation.NewMaxQueryResponseSizeBytesError(int(encoded.ContentLength), maxSize).Error())
+	}
+
+	return encoded, nil
+}
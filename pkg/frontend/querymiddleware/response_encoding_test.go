@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+func TestLimitedRoundTripper_MaxQueryResponseSizeBytes(t *testing.T) {
+	response := &PrometheusResponse{
+		Status: statusSuccess,
+		Data: &PrometheusData{
+			ResultType: matrix,
+			Result: []SampleStream{{
+				Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "foo"}},
+				Samples: []mimirpb.Sample{
+					{TimestampMs: 1000, Value: 1},
+					{TimestampMs: 2000, Value: 2},
+					{TimestampMs: 3000, Value: 3},
+				},
+			}},
+		},
+	}
+
+	codec := newTestPrometheusCodec()
+	encodedSize := func() int {
+		encoded, err := jsonFormatter{}.EncodeResponse(response)
+		require.NoError(t, err)
+		return len(encoded)
+	}()
+	estimatedSize := response.Size()
+
+	// The test case with the limit between the estimated and the encoded size relies on this.
+	require.Greater(t, encodedSize, estimatedSize)
+
+	tests := map[string]struct {
+		limit            int
+		expectedErr      bool
+		expectedRejected int
+	}{
+		"no limit": {
+			limit: 0,
+		},
+		"response size within the limit": {
+			limit: encodedSize,
+		},
+		"estimated response size exceeding the limit": {
+			limit:            estimatedSize - 1,
+			expectedErr:      true,
+			expectedRejected: 1,
+		},
+		"encoded response size exceeding the limit": {
+			limit:            estimatedSize,
+			expectedErr:      true,
+			expectedRejected: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ctx := user.InjectOrgID(context.Background(), "user-1")
+			r, err := codec.EncodeRequest(ctx, &PrometheusRangeQueryRequest{
+				Path:  "/query_range",
+				Start: util.TimeToMillis(time.Now().Add(-time.Hour)),
+				End:   util.TimeToMillis(time.Now()),
+				Step:  int64(1 * time.Second * time.Millisecond),
+				Query: `foo`,
+			})
+			require.NoError(t, err)
+
+			reg := prometheus.NewPedanticRegistry()
+			limits := mockLimits{maxQueryParallelism: 1, maxQueryResponseSizeBytes: testData.limit}
+
+			res, err := newLimitedParallelismRoundTripper(nil, codec, limits, newResponseEncodingMetrics(reg),
+				MiddlewareFunc(func(next Handler) Handler {
+					return HandlerFunc(func(context.Context, Request) (Response, error) {
+						return response, nil
+					})
+				}),
+			).RoundTrip(r)
+
+			if testData.expectedErr {
+				require.Error(t, err)
+				assert.True(t, apierror.IsAPIError(err))
+				assert.Contains(t, err.Error(), "err-mimir-max-query-response-size-bytes")
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, int64(encodedSize), res.ContentLength)
+			}
+
+			if testData.expectedRejected > 0 {
+				assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+					# HELP cortex_query_frontend_response_size_limit_rejected_queries_total Total number of queries failed because the size of the encoded response exceeded the limit.
+					# TYPE cortex_query_frontend_response_size_limit_rejected_queries_total counter
+					cortex_query_frontend_response_size_limit_rejected_queries_total{user="user-1"} `+strconv.Itoa(testData.expectedRejected)+`
+				`), "cortex_query_frontend_response_size_limit_rejected_queries_total"))
+			} else {
+				assert.Equal(t, 0, testutil.CollectAndCount(reg, "cortex_query_frontend_response_size_limit_rejected_queries_total"))
+			}
+		})
+	}
+}
+
+func TestLimitedRoundTripper_ResponseEncodingMetrics(t *testing.T) {
+	codec := newTestPrometheusCodec()
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+	r, err := codec.EncodeRequest(ctx, &PrometheusRangeQueryRequest{
+		Path:  "/query_range",
+		Start: util.TimeToMillis(time.Now().Add(-time.Hour)),
+		End:   util.TimeToMillis(time.Now()),
+		Step:  int64(1 * time.Second * time.Millisecond),
+		Query: `foo`,
+	})
+	require.NoError(t, err)
+
+	reg := prometheus.NewPedanticRegistry()
+	res, err := newLimitedParallelismRoundTripper(nil, codec, mockLimits{maxQueryParallelism: 1}, newResponseEncodingMetrics(reg),
+		MiddlewareFunc(func(next Handler) Handler {
+			return HandlerFunc(func(context.Context, Request) (Response, error) {
+				return newEmptyPrometheusResponse(), nil
+			})
+		}),
+	).RoundTrip(r)
+	require.NoError(t, err)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_frontend_response_encoded_bytes_total Total size of the encoded query responses sent to the clients, in bytes.
+		# TYPE cortex_query_frontend_response_encoded_bytes_total counter
+		cortex_query_frontend_response_encoded_bytes_total{user="user-1"} `+strconv.FormatInt(res.ContentLength, 10)+`
+	`), "cortex_query_frontend_response_encoded_bytes_total"))
+	assert.Equal(t, 1, testutil.CollectAndCount(reg, "cortex_query_frontend_response_encoding_seconds_total"))
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	rolloutByTenant = "tenant"
+	rolloutByQuery  = "query"
+
+	rolloutGroupTreated = "treated"
+	rolloutGroupControl = "control"
+
+	// rolloutBuckets is the number of buckets each tenant or query is hashed to, which
+	// allows to configure the rollout percentage with a 0.01 precision.
+	rolloutBuckets = 10000
+)
+
+var (
+	rolloutByOptions = []string{rolloutByTenant, rolloutByQuery}
+
+	// rolloutMiddlewareNames are the names of the middlewares which support a gradual rollout.
+	rolloutMiddlewareNames = []string{"query_error_anomaly_detection", "query_slo", "query_policy", "step_align"}
+)
+
+// parseMiddlewareRollouts parses the input list of <middleware>:<percentage> entries, and returns
+// the rollout percentage by middleware name.
+func parseMiddlewareRollouts(entries []string) (map[string]float64, error) {
+	percentages := make(map[string]float64, len(entries))
+
+	for _, entry := range entries {
+		name, value, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid middleware rollout %q: expected format is <middleware>:<percentage>", entry)
+		}
+		name = strings.TrimSpace(name)
+		if !slices.Contains(rolloutMiddlewareNames, name) {
+			return nil, fmt.Errorf("invalid middleware rollout %q: unsupported middleware %q (supported values: %s)", entry, name, strings.Join(rolloutMiddlewareNames, ", "))
+		}
+		if _, exists := percentages[name]; exists {
+			return nil, fmt.Errorf("invalid middleware rollout %q: the rollout of the middleware %q is configured more than once", entry, name)
+		}
+
+		percentage, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || percentage < 0 || percentage > 100 {
+			return nil, fmt.Errorf("invalid middleware rollout %q: the percentage must be a number between 0 and 100", entry)
+		}
+		percentages[name] = percentage
+	}
+
+	return percentages, nil
+}
+
+// middlewareRollout enables middlewares for a percentage of the tenants or queries only, so that new
+// middlewares can be rolled out gradually, comparing the treated traffic with the control one.
+type middlewareRollout struct {
+	percentages map[string]float64
+	by          string
+
+	queriesTotal   *prometheus.CounterVec
+	failuresTotal  *prometheus.CounterVec
+	queryDurations *prometheus.HistogramVec
+}
+
+func newMiddlewareRollout(percentages map[string]float64, by string, registerer prometheus.Registerer) *middlewareRollout {
+	return &middlewareRollout{
+		percentages: percentages,
+		by:          by,
+		queriesTotal: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_middleware_rollout_queries_total",
+			Help: "Total number of queries received by a middleware under rollout, partitioned by group: treated if the middleware has been applied to the query, control otherwise.",
+		}, []string{"middleware", "group"}),
+		failuresTotal: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_middleware_rollout_failed_queries_total",
+			Help: "Total number of failed queries received by a middleware under rollout, partitioned by group: treated if the middleware has been applied to the query, control otherwise.",
+		}, []string{"middleware", "group"}),
+		queryDurations: promauto.With(registerer).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "cortex_query_frontend_middleware_rollout_query_duration_seconds",
+			Help:    "Duration of the queries received by a middleware under rollout, partitioned by group: treated if the middleware has been applied to the query, control otherwise.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"middleware", "group"}),
+	}
+}
+
+// wrap returns a Middleware which applies the input middleware only to the tenants or queries selected
+// by the rollout. The input middleware is returned as is if its rollout is not configured.
+func (r *middlewareRollout) wrap(name string, middleware Middleware) Middleware {
+	percentage, ok := r.percentages[name]
+	if !ok {
+		return middleware
+	}
+
+	return MiddlewareFunc(func(next Handler) Handler {
+		return rolloutMiddleware{
+			name:       name,
+			percentage: percentage,
+			rollout:    r,
+			treated:    middleware.Wrap(next),
+			control:    next,
+		}
+	})
+}
+
+type rolloutMiddleware struct {
+	name       string
+	percentage float64
+	rollout    *middlewareRollout
+
+	// treated is the handler with the middleware under rollout applied, control is the one without.
+	treated Handler
+	control Handler
+}
+
+func (m rolloutMiddleware) Do(ctx context.Context, req Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	group, handler := rolloutGroupControl, m.control
+	if m.selected(tenant.JoinTenantIDs(tenantIDs), req.GetQuery()) {
+		group, handler = rolloutGroupTreated, m.treated
+	}
+
+	start := time.Now()
+	res, err := handler.Do(ctx, req)
+
+	m.rollout.queriesTotal.WithLabelValues(m.name, group).Inc()
+	m.rollout.queryDurations.WithLabelValues(m.name, group).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.rollout.failuresTotal.WithLabelValues(m.name, group).Inc()
+	}
+
+	return res, err
+}
+
+// selected returns whether the middleware should be applied to the input tenant and query. The selection is
+// deterministic, so that a tenant or query is always treated the same way, and it's computed independently for
+// each middleware, so that different middlewares under rollout are applied to different tenants or queries.
+func (m rolloutMiddleware) selected(tenantID, query string) bool {
+	fingerprint := m.name + "/" + tenantID
+	if m.rollout.by == rolloutByQuery {
+		fingerprint += "/" + query
+	}
+
+	return float64(xxhash.Sum64String(fingerprint)%rolloutBuckets) < m.percentage*rolloutBuckets/100
+}
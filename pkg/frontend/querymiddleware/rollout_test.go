@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+)
+
+func TestParseMiddlewareRollouts(t *testing.T) {
+	percentages, err := parseMiddlewareRollouts([]string{"query_slo:10", " step_align : 0.5"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"query_slo": 10, "step_align": 0.5}, percentages)
+
+	for _, entries := range [][]string{
+		{"query_slo"},
+		{"query_slo:ten"},
+		{"query_slo:-1"},
+		{"query_slo:100.1"},
+		{"unknown:10"},
+		{"query_slo:10", "query_slo:20"},
+	} {
+		_, err := parseMiddlewareRollouts(entries)
+		assert.Error(t, err, entries)
+	}
+}
+
+func TestMiddlewareRollout(t *testing.T) {
+	// markerMiddleware is the middleware under rollout, which tracks the queries it has been applied to.
+	newMarkerMiddleware := func(treated map[string]bool) Middleware {
+		return MiddlewareFunc(func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, r Request) (Response, error) {
+				treated[r.GetQuery()] = true
+				return next.Do(ctx, r)
+			})
+		})
+	}
+
+	success := HandlerFunc(func(context.Context, Request) (Response, error) {
+		return &PrometheusResponse{Status: statusSuccess}, nil
+	})
+
+	t.Run("should return the middleware as is if its rollout is not configured", func(t *testing.T) {
+		treated := map[string]bool{}
+		rollout := newMiddlewareRollout(map[string]float64{"query_slo": 10}, rolloutByTenant, nil)
+		handler := rollout.wrap("step_align", newMarkerMiddleware(treated)).Wrap(success)
+
+		_, err := handler.Do(user.InjectOrgID(context.Background(), "user-1"), &PrometheusRangeQueryRequest{Query: "up"})
+		require.NoError(t, err)
+		assert.True(t, treated["up"])
+	})
+
+	for _, percentage := range []float64{0, 100} {
+		t.Run(fmt.Sprintf("should apply the middleware to %v%% of the queries", percentage), func(t *testing.T) {
+			treated := map[string]bool{}
+			rollout := newMiddlewareRollout(map[string]float64{"query_slo": percentage}, rolloutByQuery, nil)
+			handler := rollout.wrap("query_slo", newMarkerMiddleware(treated)).Wrap(success)
+
+			for i := 0; i < 100; i++ {
+				_, err := handler.Do(user.InjectOrgID(context.Background(), "user-1"), &PrometheusRangeQueryRequest{Query: fmt.Sprintf("up{id=\"%d\"}", i)})
+				require.NoError(t, err)
+			}
+			assert.Len(t, treated, int(percentage))
+		})
+	}
+
+	t.Run("should consistently select the same tenants, and track treated and control queries separately", func(t *testing.T) {
+		treated := map[string]bool{}
+		reg := prometheus.NewPedanticRegistry()
+		rollout := newMiddlewareRollout(map[string]float64{"query_slo": 50}, rolloutByTenant, reg)
+		handler := rollout.wrap("query_slo", newMarkerMiddleware(treated)).Wrap(HandlerFunc(func(_ context.Context, r Request) (Response, error) {
+			if r.GetQuery() == "fail" {
+				return nil, errors.New("query failed")
+			}
+			return &PrometheusResponse{Status: statusSuccess}, nil
+		}))
+
+		treatedTenants, controlTenants := 0, 0
+		for i := 0; i < 200; i++ {
+			tenantID := fmt.Sprintf("user-%d", i)
+			query := fmt.Sprintf("up{tenant=%q}", tenantID)
+			ctx := user.InjectOrgID(context.Background(), tenantID)
+
+			// Each tenant runs the same query twice, and a failing query once.
+			for j := 0; j < 2; j++ {
+				_, err := handler.Do(ctx, &PrometheusRangeQueryRequest{Query: query})
+				require.NoError(t, err)
+			}
+			_, err := handler.Do(ctx, &PrometheusRangeQueryRequest{Query: "fail"})
+			require.Error(t, err)
+
+			// The middleware is applied to either all the queries of the tenant or none.
+			if treated[query] {
+				treatedTenants++
+			} else {
+				controlTenants++
+			}
+		}
+
+		// The tenants are roughly split in half.
+		assert.InDelta(t, 100, treatedTenants, 30)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+			# HELP cortex_query_frontend_middleware_rollout_queries_total Total number of queries received by a middleware under rollout, partitioned by group: treated if the middleware has been applied to the query, control otherwise.
+			# TYPE cortex_query_frontend_middleware_rollout_queries_total counter
+			cortex_query_frontend_middleware_rollout_queries_total{group="control",middleware="query_slo"} %d
+			cortex_query_frontend_middleware_rollout_queries_total{group="treated",middleware="query_slo"} %d
+
+			# HELP cortex_query_frontend_middleware_rollout_failed_queries_total Total number of failed queries received by a middleware under rollout, partitioned by group: treated if the middleware has been applied to the query, control otherwise.
+			# TYPE cortex_query_frontend_middleware_rollout_failed_queries_total counter
+			cortex_query_frontend_middleware_rollout_failed_queries_total{group="control",middleware="query_slo"} %d
+			cortex_query_frontend_middleware_rollout_failed_queries_total{group="treated",middleware="query_slo"} %d
+		`, 3*controlTenants, 3*treatedTenants, controlTenants, treatedTenants)),
+			"cortex_query_frontend_middleware_rollout_queries_total",
+			"cortex_query_frontend_middleware_rollout_failed_queries_total",
+		))
+	})
+}
@@ -16,6 +16,8 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/grafana/dskit/cache"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/services"
 	"github.com/grafana/dskit/tenant"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -47,7 +49,26 @@ type Config struct {
 	// If nil, the querymiddleware package uses a ConstSplitter with SplitQueriesByInterval.
 	CacheSplitter CacheSplitter `yaml:"-"`
 
+	// QueryPolicyHook allows to inject a QueryPolicyHook invoked for each range and instant query.
+	// If nil, no query policy is enforced.
+	QueryPolicyHook QueryPolicyHook `yaml:"-"`
+
 	QueryResultResponseFormat string `yaml:"query_result_response_format"`
+
+	QueryErrorAnomalyDetectionEnabled bool `yaml:"query_error_anomaly_detection_enabled" category:"experimental"`
+
+	HeavyQueriesLimitEnabled   bool `yaml:"heavy_queries_limit_enabled" category:"experimental"`
+	QueryMemoryLimitEnabled    bool `yaml:"query_memory_limit_enabled" category:"experimental"`
+	CatchAllQueryPolicyEnabled bool `yaml:"catch_all_query_policy_enabled" category:"experimental"`
+
+	QuerySLOEnabled          bool          `yaml:"query_slo_enabled" category:"experimental"`
+	QuerySLOObjective        float64       `yaml:"query_slo_objective" category:"experimental"`
+	QuerySLOLatencyThreshold time.Duration `yaml:"query_slo_latency_threshold" category:"experimental"`
+
+	MiddlewareRollouts  flagext.StringSliceCSV `yaml:"middleware_rollouts" category:"experimental"`
+	MiddlewareRolloutBy string                 `yaml:"middleware_rollout_by" category:"experimental"`
+
+	ChaosHeaderSigningKey flagext.Secret `yaml:"chaos_header_signing_key" category:"experimental"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet.
@@ -60,6 +81,16 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.CacheUnalignedRequests, "query-frontend.cache-unaligned-requests", false, "Cache requests that are not step-aligned.")
 	f.Uint64Var(&cfg.TargetSeriesPerShard, "query-frontend.query-sharding-target-series-per-shard", 0, "How many series a single sharded partial query should load at most. This is not a strict requirement guaranteed to be honoured by query sharding, but a hint given to the query sharding when the query execution is initially planned. 0 to disable cardinality-based hints.")
 	f.StringVar(&cfg.QueryResultResponseFormat, "query-frontend.query-result-response-format", formatProtobuf, fmt.Sprintf("Format to use when retrieving query results from queriers. Supported values: %s", strings.Join(allFormats, ", ")))
+	f.BoolVar(&cfg.QueryErrorAnomalyDetectionEnabled, "query-frontend.query-error-anomaly-detection-enabled", false, "True to track the per-tenant query error rate baseline, and export an anomaly score measuring how much the current error rate deviates from the baseline.")
+	f.BoolVar(&cfg.HeavyQueriesLimitEnabled, "query-frontend.heavy-queries-limit-enabled", false, "True to enforce the per-tenant limit on the number of heavy queries executed concurrently, configured via -query-frontend.max-concurrent-heavy-queries.")
+	f.BoolVar(&cfg.QueryMemoryLimitEnabled, "query-frontend.query-memory-limit-enabled", false, "True to account the memory allocated to decode and merge the responses of the partial queries of each query, and enforce the per-tenant limit configured via -query-frontend.max-query-memory-bytes.")
+	f.BoolVar(&cfg.CatchAllQueryPolicyEnabled, "query-frontend.catch-all-query-policy-enabled", false, "True to enforce the per-tenant policy on the queries containing a catch-all selector, configured via -query-frontend.catch-all-query-policy.")
+	f.BoolVar(&cfg.QuerySLOEnabled, "query-frontend.query-slo-enabled", false, "True to track the per-tenant query availability and latency over rolling windows, and export the SLIs along with the burn rate and the remaining error budget of the query SLO.")
+	f.Float64Var(&cfg.QuerySLOObjective, "query-frontend.query-slo-objective", 0.99, "Target fraction of queries meeting the availability and latency objectives, used to compute the burn rate and the remaining error budget of the query SLO. Value must be greater than 0 and lower than 1.")
+	f.DurationVar(&cfg.QuerySLOLatencyThreshold, "query-frontend.query-slo-latency-threshold", 10*time.Second, "Queries taking longer than this threshold don't meet the latency objective of the query SLO.")
+	f.Var(&cfg.MiddlewareRollouts, "query-frontend.middleware-rollouts", fmt.Sprintf("Comma-separated list of <middleware>:<percentage> entries, to apply each enabled middleware only to the configured percentage of tenants or queries, for example query_slo:10. The queries which the middleware is not applied to are tracked as control traffic, to compare them with the treated ones. Supported middlewares: %s.", strings.Join(rolloutMiddlewareNames, ", ")))
+	f.StringVar(&cfg.MiddlewareRolloutBy, "query-frontend.middleware-rollout-by", rolloutByTenant, fmt.Sprintf("How tenants or queries are selected for the middleware rollouts. The selection is deterministic, based on the fingerprint of the tenant, or of the tenant and query. Supported values: %s.", strings.Join(rolloutByOptions, ", ")))
+	f.Var(&cfg.ChaosHeaderSigningKey, "query-frontend.chaos-header-signing-key", fmt.Sprintf("Key used to verify the signature of the %s header, which requests the query-frontend to inject latency or errors into the request, for the tenants which chaos injection is enabled for. The header must be signed with the hex-encoded HMAC-SHA256 of \"<tenant>:<expiration>:<header value>\", in the %s header, where the expiration is the Unix timestamp in seconds set in the %s header, after which the header is rejected. Empty to disable chaos injection.", chaosHeaderName, chaosSignatureHeaderName, chaosExpiresHeaderName))
 	cfg.ResultsCacheConfig.RegisterFlags(f)
 }
 
@@ -77,6 +108,17 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	if cfg.QuerySLOEnabled && (cfg.QuerySLOObjective <= 0 || cfg.QuerySLOObjective >= 1) {
+		return errors.New("-query-frontend.query-slo-objective must be greater than 0 and lower than 1")
+	}
+
+	if _, err := parseMiddlewareRollouts(cfg.MiddlewareRollouts); err != nil {
+		return errors.Wrap(err, "invalid -query-frontend.middleware-rollouts")
+	}
+	if len(cfg.MiddlewareRollouts) > 0 && !slices.Contains(rolloutByOptions, cfg.MiddlewareRolloutBy) {
+		return fmt.Errorf("unknown middleware rollout selection '%s'. Supported values: %s", cfg.MiddlewareRolloutBy, strings.Join(rolloutByOptions, ", "))
+	}
+
 	if !slices.Contains(allFormats, cfg.QueryResultResponseFormat) {
 		return fmt.Errorf("unknown query result response format '%s'. Supported values: %s", cfg.QueryResultResponseFormat, strings.Join(allFormats, ", "))
 	}
@@ -148,6 +190,7 @@ func (f RoundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
 }
 
 // NewTripperware returns a Tripperware configured with middlewares to limit, align, split, retry and cache requests.
+// The returned service runs the background tasks of the middlewares, and is nil if there are none.
 func NewTripperware(
 	cfg Config,
 	log log.Logger,
@@ -156,15 +199,56 @@ func NewTripperware(
 	cacheExtractor Extractor,
 	engineOpts promql.EngineOpts,
 	registerer prometheus.Registerer,
-) (Tripperware, error) {
-	queryRangeTripperware, err := newQueryTripperware(cfg, log, limits, codec, cacheExtractor, engineOpts, registerer)
+) (Tripperware, services.Service, error) {
+	queryRangeTripperware, subservices, err := newQueryTripperware(cfg, log, limits, codec, cacheExtractor, engineOpts, registerer)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return MergeTripperwares(
+	tripperwares := []Tripperware{
+		// Track the requests by route. Added first, so that the whole request processing is tracked.
+		newRouteMetricsTripperware(registerer),
 		newActiveUsersTripperware(registerer),
-		queryRangeTripperware,
-	), err
+	}
+	if cfg.ChaosHeaderSigningKey.String() != "" {
+		tripperwares = append(tripperwares, newChaosTripperware(cfg.ChaosHeaderSigningKey.String(), limits, log, registerer))
+	}
+	tripperwares = append(tripperwares, queryRangeTripperware)
+
+	if len(subservices) == 0 {
+		return MergeTripperwares(tripperwares...), nil, nil
+	}
+
+	svc, err := newTripperwareService(subservices)
+	if err != nil {
+		return nil, nil, err
+	}
+	return MergeTripperwares(tripperwares...), svc, nil
+}
+
+// newTripperwareService returns a service running the input subservices, which fails if any of them fails.
+func newTripperwareService(subservices []services.Service) (services.Service, error) {
+	manager, err := services.NewManager(subservices...)
+	if err != nil {
+		return nil, errors.Wrap(err, "register query-frontend tripperware subservices")
+	}
+	watcher := services.NewFailureWatcher()
+	watcher.WatchManager(manager)
+
+	starting := func(ctx context.Context) error {
+		return errors.Wrap(services.StartManagerAndAwaitHealthy(ctx, manager), "unable to start query-frontend tripperware subservices")
+	}
+	running := func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Chan():
+			return errors.Wrap(err, "query-frontend tripperware subservice failed")
+		}
+	}
+	stopping := func(_ error) error {
+		return services.StopManagerAndAwaitStopped(context.Background(), manager)
+	}
+	return services.NewBasicService(starting, running, stopping), nil
 }
 
 func newQueryTripperware(
@@ -175,7 +259,7 @@ func newQueryTripperware(
 	cacheExtractor Extractor,
 	engineOpts promql.EngineOpts,
 	registerer prometheus.Registerer,
-) (Tripperware, error) {
+) (Tripperware, []services.Service, error) {
 	// Disable concurrency limits for sharded queries.
 	engineOpts.ActiveQueryTracker = nil
 	engine := promql.NewEngine(engineOpts)
@@ -183,22 +267,82 @@ func newQueryTripperware(
 	// Metric used to keep track of each middleware execution duration.
 	metrics := newInstrumentMiddlewareMetrics(registerer)
 
+	// The config is validated, so parsing the middleware rollouts can't fail.
+	rolloutPercentages, err := parseMiddlewareRollouts(cfg.MiddlewareRollouts)
+	if err != nil {
+		return nil, nil, err
+	}
+	rollout := newMiddlewareRollout(rolloutPercentages, cfg.MiddlewareRolloutBy, registerer)
+
 	queryRangeMiddleware := []Middleware{
-		// Track query range statistics. Added first before any subsequent middleware modifies the request.
+		// Attach the query attributes used to correlate metrics, logs and traces. Added first
+		// because attributes must be computed before any subsequent middleware modifies the request.
+		newQueryAttributesMiddleware(),
+	}
+	queryInstantMiddleware := []Middleware{newQueryAttributesMiddleware()}
+
+	// The services running the background tasks of the middlewares.
+	var subservices []services.Service
+
+	if cfg.QueryErrorAnomalyDetectionEnabled {
+		detector := newQueryErrorAnomalyDetector(registerer)
+		subservices = append(subservices, detector)
+
+		// Added before any other middleware which may fail, so that all failures are tracked.
+		queryRangeMiddleware = append(queryRangeMiddleware, rollout.wrap("query_error_anomaly_detection", newQueryErrorAnomalyMiddleware(detector)))
+		queryInstantMiddleware = append(queryInstantMiddleware, rollout.wrap("query_error_anomaly_detection", newQueryErrorAnomalyMiddleware(detector)))
+	}
+
+	if cfg.QuerySLOEnabled {
+		tracker := newQuerySLOTracker(cfg.QuerySLOObjective, cfg.QuerySLOLatencyThreshold, registerer)
+		subservices = append(subservices, tracker)
+
+		// Added before any other middleware which may fail or take time, so that the whole query is tracked.
+		queryRangeMiddleware = append(queryRangeMiddleware, rollout.wrap("query_slo", newQuerySLOMiddleware(tracker)))
+		queryInstantMiddleware = append(queryInstantMiddleware, rollout.wrap("query_slo", newQuerySLOMiddleware(tracker)))
+	}
+
+	// Enforce the query policy after the limits, and before any middleware which depends on the query,
+	// so that a rewritten query is what gets executed.
+	queryPolicyMiddleware := []Middleware{newLimitsMiddleware(limits, log)}
+	if cfg.CatchAllQueryPolicyEnabled {
+		queryPolicyMiddleware = append(queryPolicyMiddleware, newCatchAllQueriesMiddleware(limits, log, registerer))
+	}
+	if cfg.QueryPolicyHook != nil {
+		queryPolicyMiddleware = append(queryPolicyMiddleware, rollout.wrap("query_policy", newQueryPolicyMiddleware(cfg.QueryPolicyHook, log, registerer)))
+	}
+
+	queryRangeMiddleware = append(
+		queryRangeMiddleware,
+		// Track query range statistics. Added before any subsequent middleware modifies the request.
 		newQueryStatsMiddleware(registerer),
-		newLimitsMiddleware(limits, log),
+	)
+	queryRangeMiddleware = append(queryRangeMiddleware, queryPolicyMiddleware...)
+	queryInstantMiddleware = append(queryInstantMiddleware, queryPolicyMiddleware...)
+
+	if cfg.HeavyQueriesLimitEnabled {
+		// Shared by range and instant queries, so that the concurrency limit applies to both.
+		heavyQueriesMiddleware := newHeavyQueriesMiddleware(limits, log, registerer)
+		queryRangeMiddleware = append(queryRangeMiddleware, heavyQueriesMiddleware)
+		queryInstantMiddleware = append(queryInstantMiddleware, heavyQueriesMiddleware)
 	}
+
+	if cfg.QueryMemoryLimitEnabled {
+		// Shared by range and instant queries, so that their metrics are registered once.
+		queryMemoryMiddleware := newQueryMemoryMiddleware(limits, registerer)
+		queryRangeMiddleware = append(queryRangeMiddleware, queryMemoryMiddleware)
+		queryInstantMiddleware = append(queryInstantMiddleware, queryMemoryMiddleware)
+	}
+
 	if cfg.AlignQueriesWithStep {
-		queryRangeMiddleware = append(queryRangeMiddleware, newInstrumentMiddleware("step_align", metrics, log), newStepAlignMiddleware())
+		queryRangeMiddleware = append(queryRangeMiddleware, newInstrumentMiddleware("step_align", metrics, log), rollout.wrap("step_align", newStepAlignMiddleware()))
 	}
 
 	var c cache.Cache
 	if cfg.CacheResults || cfg.cardinalityBasedShardingEnabled() {
-		var err error
-
 		c, err = newResultsCache(cfg.ResultsCacheConfig, log, registerer)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		c = cache.NewCompression(cfg.ResultsCacheConfig.Compression, c, log)
 	}
@@ -231,12 +375,7 @@ func newQueryTripperware(
 		))
 	}
 
-	queryInstantMiddleware := []Middleware{newLimitsMiddleware(limits, log)}
-
-	queryInstantMiddleware = append(
-		queryInstantMiddleware,
-		newSplitInstantQueryByIntervalMiddleware(limits, log, engine, registerer),
-	)
+	queryInstantMiddleware = append(queryInstantMiddleware, newSplitInstantQueryByIntervalMiddleware(limits, log, engine, registerer))
 
 	if cfg.ShardedQueries {
 		// Inject the cardinality estimation middleware after time-based splitting and
@@ -281,29 +420,47 @@ func newQueryTripperware(
 		queryInstantMiddleware = append(queryInstantMiddleware, newInstrumentMiddleware("retry", metrics, log), newRetryMiddleware(log, cfg.MaxRetries, retryMiddlewareMetrics))
 	}
 
+	encodingMetrics := newResponseEncodingMetrics(registerer)
+
+	// The /federate results are cached for a short TTL in the results cache, if enabled.
+	var federationCache cache.Cache
+	if cfg.CacheResults {
+		federationCache = c
+	}
+	federationMetrics := newFederationMetrics(registerer)
+	labelsAndSeriesMetrics := newLabelsAndSeriesLimitMetrics(registerer)
+
 	return func(next http.RoundTripper) http.RoundTripper {
-		queryrange := newLimitedParallelismRoundTripper(next, codec, limits, queryRangeMiddleware...)
+		queryrange := newLimitedParallelismRoundTripper(next, codec, limits, encodingMetrics, queryRangeMiddleware...)
 		instant := defaultInstantQueryParamsRoundTripper(
-			newLimitedParallelismRoundTripper(next, codec, limits, queryInstantMiddleware...),
+			newLimitedParallelismRoundTripper(next, codec, limits, encodingMetrics, queryInstantMiddleware...),
 		)
+		// Each selector of a /federate request runs as an instant query, through the instant queries middlewares.
+		federation := newFederationRoundTripper(instant, codec, limits, federationCache, engineOpts.LookbackDelta, log, federationMetrics)
+		labelsAndSeries := newLabelsAndSeriesLimitRoundTripper(next, limits, log, labelsAndSeriesMetrics)
 		return RoundTripFunc(func(r *http.Request) (*http.Response, error) {
 			switch {
 			case isRangeQuery(r.URL.Path):
 				return queryrange.RoundTrip(r)
 			case isInstantQuery(r.URL.Path):
 				return instant.RoundTrip(r)
+			case isFederationQuery(r.URL.Path):
+				return federation.RoundTrip(r)
+			case isLabelsOrSeriesQuery(r.URL.Path):
+				return labelsAndSeries.RoundTrip(r)
 			default:
 				return next.RoundTrip(r)
 			}
 		})
-	}, nil
+	}, subservices, nil
 }
 
 func newActiveUsersTripperware(registerer prometheus.Registerer) Tripperware {
-	// Per tenant query metrics.
+	// Per tenant query metrics. The op label is deprecated in favour of the route label of the per-route
+	// metrics, which are tracked consistently for all the routes, and it will be removed in Mimir 2.10.
 	queriesPerTenant := promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
 		Name: "cortex_query_frontend_queries_total",
-		Help: "Total queries sent per tenant.",
+		Help: "Total queries sent per tenant. The op label is deprecated, use the route label of cortex_query_frontend_route_request_duration_seconds instead.",
 	}, []string{"op", "user"})
 
 	activeUsers := util.NewActiveUsersCleanupWithDefaultValues(func(user string) {
@@ -334,11 +491,20 @@ func newActiveUsersTripperware(registerer prometheus.Registerer) Tripperware {
 }
 
 func isRangeQuery(path string) bool {
-	return strings.HasSuffix(path, queryRangePathSuffix)
+	return routeFromPath(path) == routeRangeQuery
 }
 
 func isInstantQuery(path string) bool {
-	return strings.HasSuffix(path, instantQueryPathSuffix)
+	return routeFromPath(path) == routeInstantQuery
+}
+
+func isFederationQuery(path string) bool {
+	return routeFromPath(path) == routeFederation
+}
+
+func isLabelsOrSeriesQuery(path string) bool {
+	route := routeFromPath(path)
+	return route == routeLabels || route == routeSeries
 }
 
 func defaultInstantQueryParamsRoundTripper(next http.RoundTripper) http.RoundTripper {
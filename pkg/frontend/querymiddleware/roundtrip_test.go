@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/grafana/dskit/services"
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/client_golang/prometheus"
@@ -65,7 +66,7 @@ func TestRangeTripperware(t *testing.T) {
 		next: http.DefaultTransport,
 	}
 
-	tw, err := NewTripperware(Config{},
+	tw, _, err := NewTripperware(Config{},
 		log.NewNopLogger(),
 		mockLimits{},
 		newTestPrometheusCodec(),
@@ -113,7 +114,7 @@ func TestInstantTripperware(t *testing.T) {
 	ctx := user.InjectOrgID(context.Background(), "user-1")
 	codec := newTestPrometheusCodec()
 
-	tw, err := NewTripperware(
+	tw, _, err := NewTripperware(
 		Config{
 			ShardedQueries: true,
 		},
@@ -289,7 +290,7 @@ func TestTripperware_Metrics(t *testing.T) {
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
 			reg := prometheus.NewPedanticRegistry()
-			tw, err := NewTripperware(Config{AlignQueriesWithStep: testData.stepAlignEnabled},
+			tw, _, err := NewTripperware(Config{AlignQueriesWithStep: testData.stepAlignEnabled},
 				log.NewNopLogger(),
 				mockLimits{},
 				newTestPrometheusCodec(),
@@ -330,6 +331,84 @@ func TestTripperware_Metrics(t *testing.T) {
 	}
 }
 
+func TestTripperware_Service(t *testing.T) {
+	newTripperware := func(cfg Config) (Tripperware, services.Service) {
+		tw, svc, err := NewTripperware(cfg, log.NewNopLogger(), mockLimits{}, newTestPrometheusCodec(), nil, promql.EngineOpts{
+			Logger:     log.NewNopLogger(),
+			MaxSamples: 1000,
+			Timeout:    time.Minute,
+		}, prometheus.NewPedanticRegistry())
+		require.NoError(t, err)
+		require.NotNil(t, tw)
+		return tw, svc
+	}
+
+	t.Run("no service without middlewares running background tasks", func(t *testing.T) {
+		_, svc := newTripperware(Config{})
+		assert.Nil(t, svc)
+	})
+
+	t.Run("the query error anomaly detector is run by the service", func(t *testing.T) {
+		_, svc := newTripperware(Config{QueryErrorAnomalyDetectionEnabled: true})
+		require.NotNil(t, svc)
+
+		require.NoError(t, services.StartAndAwaitRunning(context.Background(), svc))
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), svc))
+	})
+
+	t.Run("the query SLO tracker is run by the service", func(t *testing.T) {
+		_, svc := newTripperware(Config{QuerySLOEnabled: true, QuerySLOObjective: 0.99, QuerySLOLatencyThreshold: time.Second})
+		require.NotNil(t, svc)
+
+		require.NoError(t, services.StartAndAwaitRunning(context.Background(), svc))
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), svc))
+	})
+}
+
+func TestTripperware_ShouldAddOptionalMiddlewaresOnlyWhenEnabled(t *testing.T) {
+	tests := map[string]struct {
+		enable     func(cfg *Config)
+		metricName string
+	}{
+		"heavy queries limit": {
+			enable:     func(cfg *Config) { cfg.HeavyQueriesLimitEnabled = true },
+			metricName: "cortex_query_frontend_heavy_queries_total",
+		},
+		"query memory limit": {
+			enable:     func(cfg *Config) { cfg.QueryMemoryLimitEnabled = true },
+			metricName: "cortex_query_frontend_query_memory_high_watermark_bytes",
+		},
+		"catch-all query policy": {
+			enable:     func(cfg *Config) { cfg.CatchAllQueryPolicyEnabled = true },
+			metricName: "cortex_query_frontend_catch_all_queries_total",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			for _, enabled := range []bool{false, true} {
+				cfg := Config{}
+				if enabled {
+					testData.enable(&cfg)
+				}
+
+				reg := prometheus.NewPedanticRegistry()
+				_, _, err := NewTripperware(cfg, log.NewNopLogger(), mockLimits{}, newTestPrometheusCodec(), nil, promql.EngineOpts{
+					Logger:     log.NewNopLogger(),
+					MaxSamples: 1000,
+					Timeout:    time.Minute,
+				}, reg)
+				require.NoError(t, err)
+
+				// The metrics of a middleware are registered only if the middleware has been added, in which case
+				// registering another metric with the same name fails.
+				registerErr := reg.Register(prometheus.NewGauge(prometheus.GaugeOpts{Name: testData.metricName, Help: "test"}))
+				assert.Equal(t, enabled, registerErr != nil, "enabled: %t", enabled)
+			}
+		})
+	}
+}
+
 func TestConfig_Validate(t *testing.T) {
 	tests := map[string]struct {
 		config        Config
@@ -343,12 +422,44 @@ func TestConfig_Validate(t *testing.T) {
 			config:        Config{QueryResultResponseFormat: "something-else"},
 			expectedError: errors.New("unknown query result response format 'something-else'. Supported values: json, protobuf"),
 		},
+		"query SLO enabled with a valid objective": {
+			config:        Config{QueryResultResponseFormat: formatJSON, QuerySLOEnabled: true, QuerySLOObjective: 0.999},
+			expectedError: nil,
+		},
+		"query SLO enabled with an invalid objective": {
+			config:        Config{QueryResultResponseFormat: formatJSON, QuerySLOEnabled: true, QuerySLOObjective: 1},
+			expectedError: errors.New("-query-frontend.query-slo-objective must be greater than 0 and lower than 1"),
+		},
+		"query SLO disabled with an invalid objective": {
+			config:        Config{QueryResultResponseFormat: formatJSON, QuerySLOObjective: 1},
+			expectedError: nil,
+		},
+		"middleware rollouts with valid percentages": {
+			config:        Config{QueryResultResponseFormat: formatJSON, MiddlewareRollouts: []string{"query_slo:10", "step_align:0.5"}, MiddlewareRolloutBy: rolloutByQuery},
+			expectedError: nil,
+		},
+		"middleware rollouts with an unsupported middleware": {
+			config:        Config{QueryResultResponseFormat: formatJSON, MiddlewareRollouts: []string{"sharding:10"}, MiddlewareRolloutBy: rolloutByTenant},
+			expectedError: errors.New(`invalid -query-frontend.middleware-rollouts: invalid middleware rollout "sharding:10": unsupported middleware "sharding" (supported values: query_error_anomaly_detection, query_slo, query_policy, step_align)`),
+		},
+		"middleware rollouts with an invalid percentage": {
+			config:        Config{QueryResultResponseFormat: formatJSON, MiddlewareRollouts: []string{"query_slo:110"}, MiddlewareRolloutBy: rolloutByTenant},
+			expectedError: errors.New(`invalid -query-frontend.middleware-rollouts: invalid middleware rollout "query_slo:110": the percentage must be a number between 0 and 100`),
+		},
+		"middleware rollouts with an unknown selection": {
+			config:        Config{QueryResultResponseFormat: formatJSON, MiddlewareRollouts: []string{"query_slo:10"}, MiddlewareRolloutBy: "user"},
+			expectedError: errors.New("unknown middleware rollout selection 'user'. Supported values: tenant, query"),
+		},
 	}
 
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
 			err := test.config.Validate()
-			require.Equal(t, test.expectedError, err)
+			if test.expectedError == nil {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, test.expectedError.Error())
+			}
 		})
 	}
 }
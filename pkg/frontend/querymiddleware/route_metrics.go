@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/httpgrpc"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+)
+
+// Logical routes of the requests received by the query-frontend.
+const (
+	routeRangeQuery   = "range"
+	routeInstantQuery = "instant"
+	routeLabels       = "labels"
+	routeSeries       = "series"
+	routeCardinality  = "cardinality"
+	routeFederation   = "federation"
+	routeOther        = "other"
+)
+
+const (
+	labelNamesPathSuffix  = "/labels"
+	labelValuesPathSuffix = "/values"
+	labelValuesPathPart   = "/label/"
+	seriesPathSuffix      = "/series"
+	cardinalityPathPart   = "/cardinality/"
+)
+
+// routeFromPath returns the logical route of a request, given its URL path. All the route detection
+// done by the query-frontend middlewares is expected to go through this function.
+func routeFromPath(path string) string {
+	switch {
+	case strings.HasSuffix(path, queryRangePathSuffix):
+		return routeRangeQuery
+	case strings.HasSuffix(path, instantQueryPathSuffix):
+		return routeInstantQuery
+	case strings.HasSuffix(path, labelNamesPathSuffix),
+		strings.Contains(path, labelValuesPathPart) && strings.HasSuffix(path, labelValuesPathSuffix):
+		return routeLabels
+	case strings.HasSuffix(path, seriesPathSuffix):
+		return routeSeries
+	case strings.Contains(path, cardinalityPathPart):
+		return routeCardinality
+	case strings.HasSuffix(path, federationPathSuffix):
+		return routeFederation
+	default:
+		return routeOther
+	}
+}
+
+// newRouteMetricsTripperware returns a Tripperware tracking the rate, errors and duration of the requests
+// by logical route, in a single metric family, so that per-route SLOs can be defined.
+func newRouteMetricsTripperware(registerer prometheus.Registerer) Tripperware {
+	duration := promauto.With(registerer).NewHistogramVec(prometheus.HistogramOpts{
+		Name:                            "cortex_query_frontend_route_request_duration_seconds",
+		Help:                            "Time spent in seconds serving requests received by the query-frontend, by logical route and status code.",
+		Buckets:                         prometheus.DefBuckets,
+		NativeHistogramBucketFactor:     1.1,
+		NativeHistogramMaxBucketNumber:  100,
+		NativeHistogramMinResetDuration: time.Hour,
+	}, []string{"route", "status_code"})
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(r)
+			duration.WithLabelValues(routeFromPath(r.URL.Path), routeStatusCode(res, err)).Observe(time.Since(start).Seconds())
+			return res, err
+		})
+	}
+}
+
+// routeStatusCode returns the status code label value of a request, given its response and error.
+func routeStatusCode(res *http.Response, err error) string {
+	if err == nil {
+		return strconv.Itoa(res.StatusCode)
+	}
+	if errors.Is(err, context.Canceled) {
+		return "cancel"
+	}
+	if errRes, ok := apierror.HTTPResponseFromError(err); ok {
+		return strconv.Itoa(int(errRes.Code))
+	}
+	if errRes, ok := httpgrpc.HTTPResponseFromError(err); ok {
+		return strconv.Itoa(int(errRes.Code))
+	}
+	return "500"
+}
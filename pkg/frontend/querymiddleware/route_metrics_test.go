@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+)
+
+func TestRouteFromPath(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/prometheus/api/v1/query_range":                 routeRangeQuery,
+		"/prometheus/api/v1/query":                       routeInstantQuery,
+		"/prometheus/api/v1/labels":                      routeLabels,
+		"/prometheus/api/v1/label/job/values":            routeLabels,
+		"/prometheus/api/v1/series":                      routeSeries,
+		"/prometheus/api/v1/cardinality/label_names":     routeCardinality,
+		"/prometheus/api/v1/cardinality/label_values":    routeCardinality,
+		"/prometheus/federate":                           routeFederation,
+		"/prometheus/api/v1/query_exemplars":             routeOther,
+		"/prometheus/api/v1/metadata":                    routeOther,
+		"/prometheus/api/v1/read":                        routeOther,
+		"/prometheus/api/v1/label/job/unexpected_suffix": routeOther,
+	} {
+		t.Run(path, func(t *testing.T) {
+			assert.Equal(t, expected, routeFromPath(path))
+		})
+	}
+}
+
+func TestRouteMetricsTripperware(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	tripperware := newRouteMetricsTripperware(reg)
+
+	roundTripper := tripperware(RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		switch r.URL.Query().Get("outcome") {
+		case "canceled":
+			return nil, context.Canceled
+		case "apierror":
+			return nil, apierror.New(apierror.TypeBadData, "bad data")
+		case "httpgrpc":
+			return nil, httpgrpc.Errorf(http.StatusTooManyRequests, "too many requests")
+		case "unknown":
+			return nil, errors.New("unknown error")
+		default:
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}
+	}))
+
+	for _, req := range []struct{ path, outcome string }{
+		{path: "/api/v1/query_range"},
+		{path: "/api/v1/query_range"},
+		{path: "/api/v1/query", outcome: "canceled"},
+		{path: "/api/v1/labels", outcome: "apierror"},
+		{path: "/api/v1/series", outcome: "httpgrpc"},
+		{path: "/api/v1/cardinality/label_names", outcome: "unknown"},
+		{path: "/api/v1/metadata"},
+	} {
+		_, _ = roundTripper.RoundTrip(httptest.NewRequest("GET", fmt.Sprintf("%s?outcome=%s", req.path, req.outcome), nil))
+	}
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	assert.Equal(t, "cortex_query_frontend_route_request_duration_seconds", families[0].GetName())
+
+	actual := map[string]uint64{}
+	for _, m := range families[0].GetMetric() {
+		labels := map[string]string{}
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		actual[labels["route"]+" "+labels["status_code"]] = m.GetHistogram().GetSampleCount()
+	}
+
+	assert.Equal(t, map[string]uint64{
+		"range 200":       2,
+		"instant cancel":  1,
+		"labels 400":      1,
+		"series 429":      1,
+		"cardinality 500": 1,
+		"other 200":       1,
+	}, actual)
+}
@@ -8,6 +8,8 @@ package querymiddleware
 
 import (
 	"context"
+	"math"
+	"strconv"
 	"sync"
 	"time"
 
@@ -27,11 +29,20 @@ import (
 
 	apierror "github.com/grafana/mimir/pkg/api/error"
 	"github.com/grafana/mimir/pkg/querier/stats"
+	util_math "github.com/grafana/mimir/pkg/util/math"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
 	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 const (
+	// resultsCacheHitRatioHeader is the response header containing the fraction of the requested
+	// time range served from the results cache, between 0 and 1.
+	resultsCacheHitRatioHeader = "Results-Cache-Hit-Ratio"
+
+	// resultsCacheOldestExtentAgeHeader is the response header containing the age, in seconds, of the
+	// oldest cached extent used to serve the response. It's not set if no cached extent has been used.
+	resultsCacheOldestExtentAgeHeader = "Results-Cache-Oldest-Extent-Age"
+
 	notCachableReasonUnalignedTimeRange   = "unaligned-time-range"
 	notCachableReasonTooNew               = "too-new"
 	notCachableReasonModifiersNotCachable = "has-modifiers"
@@ -159,8 +170,11 @@ func (s *splitAndCacheMiddleware) Do(ctx context.Context, req Request) (Response
 		// Build the cache keys for all requests to try to fetch from cache.
 		lookupReqs := make([]*splitRequest, 0, len(splitReqs))
 		lookupKeys := make([]string, 0, len(splitReqs))
+		usage := resultsCacheUsage{}
 
 		for _, splitReq := range splitReqs {
+			usage.requestedMillis += requestTimeRangeMillis(splitReq.orig)
+
 			// Do not try to pick response from cache at all if the request is not cachable.
 			if cachable, reason := isRequestCachable(splitReq.orig, maxCacheTime, s.cacheUnalignedRequests, s.logger); !cachable {
 				splitReq.downstreamRequests = []Request{splitReq.orig}
@@ -190,9 +204,11 @@ func (s *splitAndCacheMiddleware) Do(ctx context.Context, req Request) (Response
 				return nil, err
 			}
 
+			usage.addCachedExtents(lookupReqs[lookupIdx].orig, requests, extents)
+
 			if len(requests) == 0 {
 				// The full response has been picked up from the cache so we can merge it and store it.
-				response, err := s.merger.MergeResponse(responses...)
+				response, err := s.mergeResponses(ctx, responses)
 				if err != nil {
 					return nil, err
 				}
@@ -205,6 +221,8 @@ func (s *splitAndCacheMiddleware) Do(ctx context.Context, req Request) (Response
 			lookupReqs[lookupIdx].cachedResponses = responses
 			lookupReqs[lookupIdx].cachedExtents = extents
 		}
+
+		usage.setResponseHeaders(ctx, s.currentTime())
 	} else {
 		// Cache is disabled. We've just to execute the original request.
 		for _, splitReq := range splitReqs {
@@ -295,9 +313,72 @@ func (s *splitAndCacheMiddleware) Do(ctx context.Context, req Request) (Response
 		responses = append(responses, splitReq.downstreamResponses...)
 	}
 
+	return s.mergeResponses(ctx, responses)
+}
+
+// mergeResponses merges the input responses, accounting the memory allocated by the merged response
+// in the query memory tracker. Returns an error if the query memory limit has been exceeded.
+func (s *splitAndCacheMiddleware) mergeResponses(ctx context.Context, responses []Response) (Response, error) {
+	// The merged response is not bigger than the input responses, so their size is accounted before merging
+	// them, and the merge is aborted before being allocated if the limit would be exceeded.
+	if err := queryMemoryTrackerFromContext(ctx).addResponses(responses...); err != nil {
+		return nil, err
+	}
+
 	return s.merger.MergeResponse(responses...)
 }
 
+// resultsCacheUsage tracks how much of the time range requested by a query has been served from the results
+// cache, and how fresh the used cached extents are, as seen by the client.
+type resultsCacheUsage struct {
+	requestedMillis int64
+	cachedMillis    int64
+
+	// oldestExtentQueryTimestampMs is the query timestamp of the oldest cached extent used, or 0 if unknown.
+	oldestExtentQueryTimestampMs int64
+}
+
+// addCachedExtents accounts the part of the input request which has been served from the input cached
+// extents, given the downstream requests needed to fetch the missing parts.
+func (u *resultsCacheUsage) addCachedExtents(req Request, downstreamReqs []Request, extents []Extent) {
+	cachedMillis := requestTimeRangeMillis(req)
+	for _, downstreamReq := range downstreamReqs {
+		// The downstream requests may be extended beyond the request time range, to honor the min cache extent.
+		start, end := util_math.Max(downstreamReq.GetStart(), req.GetStart()), util_math.Min(downstreamReq.GetEnd(), req.GetEnd())
+		if end >= start {
+			cachedMillis -= end - start + req.GetStep()
+		}
+	}
+	u.cachedMillis += util_math.Max(cachedMillis, 0)
+
+	for _, extent := range extents {
+		// Skip the extents not overlapping the request and the extents with an unknown query timestamp.
+		if extent.GetStart() > req.GetEnd() || extent.GetEnd() < req.GetStart() || extent.QueryTimestampMs <= 0 {
+			continue
+		}
+		if u.oldestExtentQueryTimestampMs == 0 || extent.QueryTimestampMs < u.oldestExtentQueryTimestampMs {
+			u.oldestExtentQueryTimestampMs = extent.QueryTimestampMs
+		}
+	}
+}
+
+// setResponseHeaders sets the results cache hit ratio and oldest cached extent age headers in the query response.
+func (u *resultsCacheUsage) setResponseHeaders(ctx context.Context, now time.Time) {
+	if u.requestedMillis > 0 {
+		ratio := math.Min(float64(u.cachedMillis)/float64(u.requestedMillis), 1)
+		setResponseHeader(ctx, resultsCacheHitRatioHeader, strconv.FormatFloat(ratio, 'f', 3, 64))
+	}
+	if u.oldestExtentQueryTimestampMs > 0 {
+		age := util_math.Max(now.UnixMilli()-u.oldestExtentQueryTimestampMs, 0) / 1000
+		setResponseHeader(ctx, resultsCacheOldestExtentAgeHeader, strconv.FormatInt(age, 10))
+	}
+}
+
+// requestTimeRangeMillis returns the time range covered by the steps of the input request, in milliseconds.
+func requestTimeRangeMillis(req Request) int64 {
+	return req.GetEnd() - req.GetStart() + req.GetStep()
+}
+
 // splitRequestByInterval splits the given Request by configured interval. Returns the input request if splitting is disabled.
 func (s *splitAndCacheMiddleware) splitRequestByInterval(req Request) (splitRequests, error) {
 	if !s.splitEnabled {
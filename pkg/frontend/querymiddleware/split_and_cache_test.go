@@ -335,6 +335,97 @@ func TestSplitAndCacheMiddleware_ResultsCache(t *testing.T) {
 	assert.Equal(t, uint32(2), queryStats.LoadSplitQueries())
 }
 
+func TestSplitAndCacheMiddleware_ResultsCache_ResponseHeaders(t *testing.T) {
+	mw := newSplitAndCacheMiddleware(
+		true,
+		true,
+		24*time.Hour,
+		false,
+		mockLimits{maxCacheFreshness: 10 * time.Minute, resultsCacheTTL: resultsCacheTTL, resultsCacheOutOfOrderWindowTTL: resultsCacheLowerTTL},
+		newTestPrometheusCodec(),
+		cache.NewMockCache(),
+		ConstSplitter(day),
+		PrometheusResponseExtractor{},
+		resultsCacheAlwaysEnabled,
+		log.NewNopLogger(),
+		prometheus.NewPedanticRegistry(),
+	)
+
+	now := time.Now()
+	rc := mw.Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+		return &PrometheusResponse{
+			Status: "success",
+			Data: &PrometheusData{
+				ResultType: model.ValMatrix.String(),
+				Result: []SampleStream{{
+					Labels:  []mimirpb.LabelAdapter{{Name: "foo", Value: "bar"}},
+					Samples: []mimirpb.Sample{{Value: 1, TimestampMs: req.GetStart()}, {Value: 1, TimestampMs: req.GetEnd()}},
+				}},
+			},
+		}, nil
+	}))
+	rc.(*splitAndCacheMiddleware).currentTime = func() time.Time { return now }
+
+	step := int64(120 * 1000)
+	req := Request(&PrometheusRangeQueryRequest{
+		Path:  "/api/v1/query_range",
+		Start: parseTimeRFC3339(t, "2021-10-15T10:00:00Z").Unix() * 1000,
+		End:   parseTimeRFC3339(t, "2021-10-15T12:00:00Z").Unix() * 1000,
+		Step:  step,
+		Query: `{__name__=~".+"}`,
+	})
+
+	do := func(req Request) http.Header {
+		headers := http.Header{}
+		ctx := contextWithResponseHeaders(user.InjectOrgID(context.Background(), "1"), headers)
+		_, err := rc.Do(ctx, req)
+		require.NoError(t, err)
+		return headers
+	}
+
+	// Nothing is served from the cache on the first request.
+	headers := do(req)
+	assert.Equal(t, "0.000", headers.Get(resultsCacheHitRatioHeader))
+	assert.Empty(t, headers.Get(resultsCacheOldestExtentAgeHeader))
+
+	// The same request is fully served from the cache.
+	now = now.Add(90 * time.Second)
+	headers = do(req)
+	assert.Equal(t, "1.000", headers.Get(resultsCacheHitRatioHeader))
+	assert.Equal(t, "90", headers.Get(resultsCacheOldestExtentAgeHeader))
+
+	// A request with a longer time range is partially served from the cache.
+	headers = do(req.WithStartEnd(req.GetStart(), req.GetEnd()+60*step))
+	ratio, err := strconv.ParseFloat(headers.Get(resultsCacheHitRatioHeader), 64)
+	require.NoError(t, err)
+	assert.Greater(t, ratio, 0.0)
+	assert.Less(t, ratio, 1.0)
+	assert.Equal(t, "90", headers.Get(resultsCacheOldestExtentAgeHeader))
+}
+
+func TestResultsCacheUsage(t *testing.T) {
+	req := &PrometheusRangeQueryRequest{Start: 0, End: 90, Step: 10}
+
+	u := resultsCacheUsage{requestedMillis: requestTimeRangeMillis(req)}
+	u.addCachedExtents(req, []Request{
+		// The downstream request is extended beyond the request time range.
+		&PrometheusRangeQueryRequest{Start: 50, End: 150, Step: 10},
+	}, []Extent{
+		{Start: 0, End: 40, QueryTimestampMs: 2000},
+		// The extent doesn't overlap the request, so it's not accounted.
+		{Start: 200, End: 300, QueryTimestampMs: 1000},
+	})
+
+	assert.Equal(t, int64(100), u.requestedMillis)
+	assert.Equal(t, int64(50), u.cachedMillis)
+	assert.Equal(t, int64(2000), u.oldestExtentQueryTimestampMs)
+
+	headers := http.Header{}
+	u.setResponseHeaders(contextWithResponseHeaders(context.Background(), headers), time.UnixMilli(62000))
+	assert.Equal(t, "0.500", headers.Get(resultsCacheHitRatioHeader))
+	assert.Equal(t, "60", headers.Get(resultsCacheOldestExtentAgeHeader))
+}
+
 func TestSplitAndCacheMiddleware_ResultsCache_ShouldNotLookupCacheIfStepIsNotAligned(t *testing.T) {
 	cacheBackend := cache.NewInstrumentedMockCache()
 	reg := prometheus.NewPedanticRegistry()
@@ -102,7 +102,7 @@ func newSplitInstantQueryByIntervalMiddleware(
 
 func (s *splitInstantQueryByIntervalMiddleware) Do(ctx context.Context, req Request) (Response, error) {
 	// Log the instant query and its timestamp in every error log, so that we have more information for debugging failures.
-	logger := log.With(s.logger, "query", req.GetQuery(), "query_timestamp", req.GetStart())
+	logger := log.With(loggerWithQueryAttributes(ctx, s.logger), "query", req.GetQuery(), "query_timestamp", req.GetStart())
 
 	spanLog, ctx := spanlogger.NewWithLogger(ctx, logger, "splitInstantQueryByIntervalMiddleware.Do")
 	defer spanLog.Span.Finish()
@@ -136,6 +136,22 @@ func TestInstantQuerySplittingCorrectness(t *testing.T) {
 					query:                `label_replace(sum_over_time(metric_counter{group_1="0"}[3m]), "foo", "bar$1", "group_2", "(.*)")`,
 					expectedSplitQueries: 3,
 				},
+				"label_replace wrapped in aggregation": {
+					query:                `sum by (foo) (label_replace(rate(metric_counter{group_1="0"}[3m]), "foo", "bar$1", "group_2", "(.*)"))`,
+					expectedSplitQueries: 3,
+				},
+				"label_join wrapped in aggregation": {
+					query:                `avg by (foo) (label_join(increase(metric_counter{group_1="0"}[3m]), "foo", ",", "group_1", "group_2", "const"))`,
+					expectedSplitQueries: 3,
+				},
+				"nested label_replace and label_join": {
+					query:                `label_replace(label_join(max_over_time(metric_counter{group_1="0"}[3m]), "foo", ",", "group_1", "group_2"), "bar", "$1", "foo", "(.*),.*")`,
+					expectedSplitQueries: 3,
+				},
+				"label_replace wrapping an aggregation": {
+					query:                `label_replace(sum by (group_2) (count_over_time(metric_counter[3m])), "foo", "bar$1", "group_2", "(.*)")`,
+					expectedSplitQueries: 3,
+				},
 				"ln": {
 					query:                `ln(sum_over_time(metric_counter[3m]))`,
 					expectedSplitQueries: 3,
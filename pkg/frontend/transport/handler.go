@@ -331,11 +331,19 @@ func writeError(w http.ResponseWriter, err error) {
 	server.WriteError(w, err)
 }
 
+// writeServiceTimingHeader writes the query durations, and the query statistics which are not durations, to the
+// Server-Timing header. The statistics are written with the "val" parameter, so that clients can track them.
 func writeServiceTimingHeader(queryResponseTime time.Duration, headers http.Header, stats *querier_stats.Stats) {
 	if stats != nil {
 		parts := make([]string, 0)
 		parts = append(parts, statsValue("querier_wall_time", stats.LoadWallTime()))
 		parts = append(parts, statsValue("response_time", queryResponseTime))
+		parts = append(parts, statsCount("fetched_series_count", stats.LoadFetchedSeries()))
+		parts = append(parts, statsCount("fetched_chunk_bytes", stats.LoadFetchedChunkBytes()))
+		parts = append(parts, statsCount("fetched_chunks_count", stats.LoadFetchedChunks()))
+		parts = append(parts, statsCount("fetched_index_bytes", stats.LoadFetchedIndexBytes()))
+		parts = append(parts, statsCount("sharded_queries", uint64(stats.LoadShardedQueries())))
+		parts = append(parts, statsCount("split_queries", uint64(stats.LoadSplitQueries())))
 		headers.Set(ServiceTimingHeaderName, strings.Join(parts, ", "))
 	}
 }
@@ -345,6 +353,10 @@ func statsValue(name string, d time.Duration) string {
 	return name + ";dur=" + durationInMs
 }
 
+func statsCount(name string, count uint64) string {
+	return name + ";val=" + strconv.FormatUint(count, 10)
+}
+
 func httpRequestActivity(request *http.Request, requestParams url.Values) string {
 	tenantID := "(unknown)"
 	if tenantIDs, err := tenant.TenantIDs(request.Context()); err == nil {
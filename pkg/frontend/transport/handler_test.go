@@ -31,6 +31,7 @@ import (
 	"github.com/weaveworks/common/user"
 	"go.uber.org/atomic"
 
+	querier_stats "github.com/grafana/mimir/pkg/querier/stats"
 	"github.com/grafana/mimir/pkg/util/activitytracker"
 )
 
@@ -58,6 +59,26 @@ func TestWriteError(t *testing.T) {
 	}
 }
 
+func TestWriteServiceTimingHeader(t *testing.T) {
+	stats := &querier_stats.Stats{}
+	stats.AddWallTime(1500 * time.Microsecond)
+	stats.AddFetchedSeries(10)
+	stats.AddFetchedChunkBytes(2048)
+	stats.AddFetchedChunks(20)
+	stats.AddFetchedIndexBytes(512)
+	stats.AddShardedQueries(16)
+	stats.AddSplitQueries(4)
+
+	headers := http.Header{}
+	writeServiceTimingHeader(2*time.Millisecond, headers, stats)
+	assert.Equal(t, "querier_wall_time;dur=1.5, response_time;dur=2, fetched_series_count;val=10, fetched_chunk_bytes;val=2048, fetched_chunks_count;val=20, fetched_index_bytes;val=512, sharded_queries;val=16, split_queries;val=4", headers.Get(ServiceTimingHeaderName))
+
+	// The header is not written without stats.
+	headers = http.Header{}
+	writeServiceTimingHeader(2*time.Millisecond, headers, nil)
+	assert.Empty(t, headers.Get(ServiceTimingHeaderName))
+}
+
 func TestHandler_ServeHTTP(t *testing.T) {
 	for _, tt := range []struct {
 		name             string
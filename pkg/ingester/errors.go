@@ -6,10 +6,14 @@
 package ingester
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/grafana/mimir/pkg/util/globalerror"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 type validationError struct {
@@ -40,6 +44,13 @@ func (e *validationError) Error() string {
 	return fmt.Sprintf("%s This is for series %s", e.err.Error(), e.labels.String())
 }
 
+func makeWALDiskUsageLimitError(limit int) error {
+	return errors.New(globalerror.MaxWALDiskUsagePerUser.MessageWithPerTenantLimitConfig(
+		fmt.Sprintf("the write request has been rejected because the tenant exceeded the WAL disk usage limit of %d bytes on this ingester", limit),
+		validation.MaxWALDiskUsagePerUserFlag,
+	))
+}
+
 // wrapWithUser prepends the user to the error. It does not retain a reference to err.
 func wrapWithUser(err error, userID string) error {
 	return fmt.Errorf("user=%s: %s", userID, err)
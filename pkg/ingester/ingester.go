@@ -81,6 +81,9 @@ const (
 	// How frequently update the usage statistics.
 	usageStatsUpdateInterval = usagestats.DefaultReportSendInterval / 10
 
+	// How frequently update the WAL disk usage of each tenant.
+	walDiskUsageUpdateInterval = 15 * time.Second
+
 	// IngesterRingKey is the key under which we store the ingesters ring in the KVStore.
 	IngesterRingKey = "ring"
 
@@ -466,6 +469,9 @@ func (i *Ingester) updateLoop(ctx context.Context) error {
 	usageStatsUpdateTicker := time.NewTicker(usageStatsUpdateInterval)
 	defer usageStatsUpdateTicker.Stop()
 
+	walDiskUsageUpdateTicker := time.NewTicker(walDiskUsageUpdateInterval)
+	defer walDiskUsageUpdateTicker.Stop()
+
 	for {
 		select {
 		case <-metadataPurgeTicker.C:
@@ -489,6 +495,9 @@ func (i *Ingester) updateLoop(ctx context.Context) error {
 		case <-usageStatsUpdateTicker.C:
 			i.updateUsageStats()
 
+		case <-walDiskUsageUpdateTicker.C:
+			i.updateWALDiskUsage()
+
 		case <-ctx.Done():
 			return nil
 		case err := <-i.subservicesWatcher.Chan():
@@ -582,6 +591,33 @@ func (i *Ingester) updateUsageStats() {
 	i.maxOutOfOrderTimeWindowSecondsStat.Set(int64(maxOutOfOrderTimeWindow.Seconds()))
 }
 
+// updateWALDiskUsage updates the disk space used by the WAL, the WBL and the head chunks of each tenant,
+// which is used to enforce the per-tenant WAL disk usage limit. The TSDB directories of the tenants without
+// the limit are not walked, so that there's no cost when the limit is disabled.
+func (i *Ingester) updateWALDiskUsage() {
+	for _, userID := range i.getTSDBUsers() {
+		userDB := i.getTSDB(userID)
+		if userDB == nil {
+			continue
+		}
+
+		if i.limits.MaxWALDiskUsageBytesPerUser(userID) <= 0 {
+			// Reset the disk usage of the tenants whose limit has been disabled, so that a stale value
+			// isn't enforced if the limit is enabled again.
+			userDB.walDiskUsageBytes.Store(0)
+			i.metrics.walDiskUsageBytes.DeleteLabelValues(userID)
+			continue
+		}
+
+		size, err := userDB.updateWALDiskUsage()
+		if err != nil {
+			level.Warn(i.logger).Log("msg", "failed to compute the WAL disk usage", "user", userID, "err", err)
+			continue
+		}
+		i.metrics.walDiskUsageBytes.WithLabelValues(userID).Set(float64(size))
+	}
+}
+
 // applyTSDBSettings goes through all tenants and applies
 // * The current max-exemplars setting. If it changed, tsdb will resize the buffer; if it didn't change tsdb will return quickly.
 // * The current out-of-order time window. If it changes from 0 to >0, then a new Write-Behind-Log gets created for that tenant.
@@ -698,6 +734,12 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, pushReq *push.Request) (
 		return nil, wrapWithUser(err, userID)
 	}
 
+	// Apply backpressure to the tenant before its WAL fills the disk shared with all the other tenants.
+	if limit := i.limits.MaxWALDiskUsageBytesPerUser(userID); limit > 0 && db.walDiskUsageBytes.Load() >= int64(limit) {
+		i.metrics.walDiskUsageLimitRejections.WithLabelValues(userID).Inc()
+		return nil, httpgrpc.Errorf(http.StatusTooManyRequests, wrapWithUser(makeWALDiskUsageLimitError(limit), userID).Error())
+	}
+
 	if err := db.acquireAppendLock(); err != nil {
 		return &mimirpb.WriteResponse{}, httpgrpc.Errorf(http.StatusServiceUnavailable, wrapWithUser(err, userID).Error())
 	}
@@ -5457,6 +5457,63 @@ func TestIngester_Push_SeriesWithBlankLabel(t *testing.T) {
 	assert.Equal(t, expected, res)
 }
 
+func TestIngester_PushWALDiskUsageLimit(t *testing.T) {
+	limits := defaultLimitsTestConfig()
+	limits.MaxWALDiskUsageBytesPerUser = 1
+
+	// The limit of user-2 is high enough to not be reached.
+	user2Limits := limits
+	user2Limits.MaxWALDiskUsageBytesPerUser = 1024 * 1024 * 1024
+
+	// The limit of user-3 is disabled, so its WAL disk usage is not computed.
+	user3Limits := limits
+	user3Limits.MaxWALDiskUsageBytesPerUser = 0
+
+	overrides, err := validation.NewOverrides(limits, validation.NewMockTenantLimits(map[string]*validation.Limits{"user-2": &user2Limits, "user-3": &user3Limits}))
+	require.NoError(t, err)
+
+	ing, err := prepareIngesterWithBlockStorageAndOverrides(t, defaultIngesterTestConfig(t), overrides, "", "", nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	// Wait until it's healthy
+	test.Poll(t, time.Second, 1, func() interface{} {
+		return ing.lifecycler.HealthyInstancesCount()
+	})
+
+	push := func(userID string, ts int64) error {
+		req, _, _, _ := mockWriteRequest(t, labels.FromStrings(labels.MetricName, "test"), 1, ts)
+		_, err := ing.Push(user.InjectOrgID(context.Background(), userID), req)
+		return err
+	}
+
+	// The WAL disk usage is unknown until computed, so the first write request succeeds.
+	require.NoError(t, push("user-1", 1))
+	require.NoError(t, push("user-2", 1))
+	require.NoError(t, push("user-3", 1))
+
+	// Compute the WAL disk usage, which now exceeds the limit of user-1.
+	ing.updateWALDiskUsage()
+	assert.Greater(t, testutil.ToFloat64(ing.metrics.walDiskUsageBytes.WithLabelValues("user-1")), float64(limits.MaxWALDiskUsageBytesPerUser))
+	assert.Equal(t, int64(0), ing.getTSDB("user-3").walDiskUsageBytes.Load())
+	assert.Equal(t, 2, testutil.CollectAndCount(ing.metrics.walDiskUsageBytes))
+
+	// The write requests of user-1 are rejected with a 429 status code, while user-2 can keep writing.
+	err = push("user-1", 2)
+	httpResp, ok := httpgrpc.HTTPResponseFromError(err)
+	require.True(t, ok, "returned error is not an httpgrpc response")
+	assert.Equal(t, http.StatusTooManyRequests, int(httpResp.Code))
+	assert.Equal(t, wrapWithUser(makeWALDiskUsageLimitError(limits.MaxWALDiskUsageBytesPerUser), "user-1").Error(), string(httpResp.Body))
+	assert.Contains(t, string(httpResp.Body), "err-mimir-max-wal-disk-usage-per-user")
+
+	require.NoError(t, push("user-2", 2))
+	require.NoError(t, push("user-3", 2))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(ing.metrics.walDiskUsageLimitRejections.WithLabelValues("user-1")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(ing.metrics.walDiskUsageLimitRejections.WithLabelValues("user-2")))
+}
+
 func TestIngesterUserLimitExceeded(t *testing.T) {
 	limits := defaultLimitsTestConfig()
 	limits.MaxGlobalSeriesPerUser = 1
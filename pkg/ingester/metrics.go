@@ -58,6 +58,10 @@ type ingesterMetrics struct {
 
 	discarded *discardedMetrics
 
+	// WAL disk usage metrics.
+	walDiskUsageBytes           *prometheus.GaugeVec
+	walDiskUsageLimitRejections *prometheus.CounterVec
+
 	// Discarded metadata
 	discardedMetadataPerUserMetadataLimit   *prometheus.CounterVec
 	discardedMetadataPerMetricMetadataLimit *prometheus.CounterVec
@@ -273,6 +277,15 @@ func newIngesterMetrics(
 
 		discarded: newDiscardedMetrics(r),
 
+		walDiskUsageBytes: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_ingester_tsdb_wal_disk_usage_bytes",
+			Help: "Disk space used by the WAL, the out-of-order WBL and the head chunks of the tenant TSDB.",
+		}, []string{"user"}),
+		walDiskUsageLimitRejections: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ingester_wal_disk_usage_limit_rejected_requests_total",
+			Help: "The total number of write requests rejected because the tenant reached the WAL disk usage limit.",
+		}, []string{"user"}),
+
 		discardedMetadataPerUserMetadataLimit:   validation.DiscardedMetadataCounter(r, perUserMetadataLimit),
 		discardedMetadataPerMetricMetadataLimit: validation.DiscardedMetadataCounter(r, perMetricMetadataLimit),
 	}
@@ -291,6 +304,9 @@ func (m *ingesterMetrics) deletePerUserMetrics(userID string) {
 
 	m.discardedMetadataPerUserMetadataLimit.DeleteLabelValues(userID)
 	m.discardedMetadataPerMetricMetadataLimit.DeleteLabelValues(userID)
+
+	m.walDiskUsageBytes.DeleteLabelValues(userID)
+	m.walDiskUsageLimitRejections.DeleteLabelValues(userID)
 }
 
 func (m *ingesterMetrics) deletePerGroupMetricsForUser(userID, group string) {
@@ -8,6 +8,8 @@ package ingester
 import (
 	"context"
 	"fmt"
+	"io/fs"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -16,6 +18,7 @@ import (
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/wlog"
 	"go.uber.org/atomic"
 
 	"github.com/grafana/mimir/pkg/ingester/activeseries"
@@ -23,6 +26,12 @@ import (
 	util_math "github.com/grafana/mimir/pkg/util/math"
 )
 
+const (
+	// Names of the TSDB directories holding the WAL and the head chunks.
+	walDirName        = "wal"
+	chunksHeadDirName = "chunks_head"
+)
+
 type tsdbState int
 
 const (
@@ -108,6 +117,9 @@ type userTSDB struct {
 	// Cached shipped blocks.
 	shippedBlocksMtx sync.Mutex
 	shippedBlocks    map[ulid.ULID]time.Time
+
+	// Disk space used by the WAL, the WBL and the head chunks, updated periodically.
+	walDiskUsageBytes atomic.Int64
 }
 
 // Explicitly wrapping the tsdb.DB functions that we use.
@@ -364,6 +376,39 @@ func (u *userTSDB) shouldCloseTSDB(idleTimeout time.Duration) tsdbCloseCheckResu
 	return tsdbIdle
 }
 
+// updateWALDiskUsage computes the disk space used by the WAL, the out-of-order WBL and the head chunks,
+// and stores it. Blocks are not accounted, because they're deleted once shipped and past the retention.
+func (u *userTSDB) updateWALDiskUsage() (int64, error) {
+	var size int64
+	for _, dir := range []string{walDirName, wlog.WblDirName, chunksHeadDirName} {
+		err := filepath.WalkDir(filepath.Join(u.db.Dir(), dir), func(_ string, d fs.DirEntry, err error) error {
+			// The WAL segments and head chunks files are deleted concurrently by the TSDB.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			info, err := d.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	u.walDiskUsageBytes.Store(size)
+	return size, nil
+}
+
 func (u *userTSDB) acquireAppendLock() error {
 	u.stateMtx.RLock()
 	defer u.stateMtx.RUnlock()
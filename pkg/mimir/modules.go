@@ -10,6 +10,7 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -44,6 +45,7 @@ import (
 	"github.com/grafana/mimir/pkg/ingester"
 	"github.com/grafana/mimir/pkg/querier"
 	"github.com/grafana/mimir/pkg/querier/engine"
+	"github.com/grafana/mimir/pkg/querier/export"
 	"github.com/grafana/mimir/pkg/querier/tenantfederation"
 	querier_worker "github.com/grafana/mimir/pkg/querier/worker"
 	"github.com/grafana/mimir/pkg/ruler"
@@ -78,6 +80,7 @@ const (
 	Flusher                    string = "flusher"
 	Querier                    string = "querier"
 	Queryable                  string = "queryable"
+	QuerierExport              string = "querier-export"
 	StoreQueryable             string = "store-queryable"
 	QueryFrontend              string = "query-frontend"
 	QueryFrontendTripperware   string = "query-frontend-tripperware"
@@ -460,6 +463,7 @@ func (t *Mimir) initQuerier() (serv services.Service, err error) {
 		t.Registerer,
 		util_log.Logger,
 		t.Overrides,
+		t.QuerierExport,
 	)
 
 	// If the querier is running standalone without the query-frontend or query-scheduler, we must register it's internal
@@ -468,6 +472,9 @@ func (t *Mimir) initQuerier() (serv services.Service, err error) {
 	if !t.Cfg.isAnyModuleEnabled(QueryFrontend, QueryScheduler, Read, All) {
 		// First, register the internal querier handler with the external HTTP server
 		t.API.RegisterQueryAPI(internalQuerierRouter, t.BuildInfoHandler)
+		if t.QuerierExport != nil {
+			t.API.RegisterExportAPI(internalQuerierRouter)
+		}
 
 		// Second, set the http.Handler that the frontend worker will use to process requests to point to
 		// the external HTTP server. This will allow the querier to consolidate query metrics both external
@@ -501,6 +508,31 @@ func (t *Mimir) initQuerier() (serv services.Service, err error) {
 	return querier_worker.NewQuerierWorker(t.Cfg.Worker, httpgrpc_server.NewServer(internalQuerierRouter), util_log.Logger, t.Registerer)
 }
 
+func (t *Mimir) initQuerierExport() (services.Service, error) {
+	if !t.Cfg.Querier.Export.Enabled {
+		return nil, nil
+	}
+
+	bucketClient, err := bucket.NewClient(context.Background(), t.Cfg.BlocksStorage.Bucket, QuerierExport, util_log.Logger, t.Registerer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create %s bucket client", QuerierExport)
+	}
+
+	// The jobs are owned by the querier ID, which defaults to the hostname like in the querier worker.
+	querierID := t.Cfg.Worker.QuerierID
+	if querierID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get hostname for configuring querier ID")
+		}
+		querierID = hostname
+	}
+
+	// The routes are registered by the querier and the query-frontend.
+	t.QuerierExport = export.NewManager(t.Cfg.Querier.Export, bucketClient, t.Overrides, t.Overrides, t.QuerierQueryable, querierID, util_log.Logger, t.Registerer)
+	return t.QuerierExport, nil
+}
+
 func (t *Mimir) initStoreQueryables() (services.Service, error) {
 	var servs []services.Service
 
@@ -587,7 +619,7 @@ func (t *Mimir) initQueryFrontendTripperware() (serv services.Service, err error
 	t.QueryFrontendCodec = querymiddleware.NewPrometheusCodec(t.Registerer, t.Cfg.Frontend.QueryMiddleware.QueryResultResponseFormat)
 	promqlEngineRegisterer := prometheus.WrapRegistererWith(prometheus.Labels{"engine": "query-frontend"}, t.Registerer)
 
-	tripperware, err := querymiddleware.NewTripperware(
+	tripperware, tripperwareSvc, err := querymiddleware.NewTripperware(
 		t.Cfg.Frontend.QueryMiddleware,
 		util_log.Logger,
 		t.Overrides,
@@ -600,8 +632,9 @@ func (t *Mimir) initQueryFrontendTripperware() (serv services.Service, err error
 		return nil, err
 	}
 
+	// The service runs the background tasks of the middlewares, if any.
 	t.QueryFrontendTripperware = tripperware
-	return nil, nil
+	return tripperwareSvc, nil
 }
 
 func (t *Mimir) initQueryFrontend() (serv services.Service, err error) {
@@ -618,6 +651,11 @@ func (t *Mimir) initQueryFrontend() (serv services.Service, err error) {
 	handler := transport.NewHandler(t.Cfg.Frontend.Handler, roundTripper, util_log.Logger, t.Registerer, t.ActivityTracker)
 	t.API.RegisterQueryFrontendHandler(handler, t.BuildInfoHandler)
 
+	// The export jobs are queued and run by the queriers, so the export API is forwarded to them.
+	if t.Cfg.Querier.Export.Enabled {
+		t.API.RegisterExportAPI(handler)
+	}
+
 	var frontendSvc services.Service
 	if frontendV1 != nil {
 		t.API.RegisterQueryFrontend1(frontendV1)
@@ -903,6 +941,7 @@ func (t *Mimir) setupModuleManager() error {
 	mm.RegisterModule(Flusher, t.initFlusher)
 	mm.RegisterModule(Queryable, t.initQueryable, modules.UserInvisibleModule)
 	mm.RegisterModule(Querier, t.initQuerier)
+	mm.RegisterModule(QuerierExport, t.initQuerierExport, modules.UserInvisibleModule)
 	mm.RegisterModule(StoreQueryable, t.initStoreQueryables, modules.UserInvisibleModule)
 	mm.RegisterModule(QueryFrontendTripperware, t.initQueryFrontendTripperware, modules.UserInvisibleModule)
 	mm.RegisterModule(QueryFrontend, t.initQueryFrontend)
@@ -935,7 +974,8 @@ func (t *Mimir) setupModuleManager() error {
 		IngesterService:          {Overrides, RuntimeConfig, MemberlistKV},
 		Flusher:                  {Overrides, API},
 		Queryable:                {Overrides, DistributorService, Ring, API, StoreQueryable, MemberlistKV},
-		Querier:                  {TenantFederation, Vault},
+		Querier:                  {TenantFederation, QuerierExport, Vault},
+		QuerierExport:            {Queryable},
 		StoreQueryable:           {Overrides, MemberlistKV},
 		QueryFrontendTripperware: {API, Overrides},
 		QueryFrontend:            {QueryFrontendTripperware, MemberlistKV, Vault},
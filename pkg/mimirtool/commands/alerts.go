@@ -36,6 +36,7 @@ type AlertmanagerCommand struct {
 	AlertmanagerURL        url.URL
 	AlertmanagerConfigFile string
 	TemplateFiles          []string
+	AlertsFile             string
 	DisableColor           bool
 	ValidateOnly           bool
 
@@ -86,6 +87,7 @@ func (a *AlertmanagerCommand) Register(app *kingpin.Application, envVars EnvVarN
 	verifyalertCmd := alertCmd.Command("verify", "Verify Alertmanager tenant configuration and template files.").Action(a.verifyAlertmanagerConfig)
 	verifyalertCmd.Arg("config", "Alertmanager configuration to verify").Required().StringVar(&a.AlertmanagerConfigFile)
 	verifyalertCmd.Arg("template-files", "The template files to verify").ExistingFilesVar(&a.TemplateFiles)
+	verifyalertCmd.Flag("alerts-file", "YAML file with a list of sample alerts, each one with its labels. If set, the routing of the alerts is simulated and, for each group of alerts, the receiver notified and the notification timing are printed, together with the inhibited alerts.").ExistingFileVar(&a.AlertsFile)
 }
 
 func (a *AlertmanagerCommand) setup(k *kingpin.ParseContext) error {
@@ -137,8 +139,21 @@ func (a *AlertmanagerCommand) readAlertManagerConfig(k *kingpin.ParseContext) (s
 }
 
 func (a *AlertmanagerCommand) verifyAlertmanagerConfig(k *kingpin.ParseContext) error {
-	_, _, err := a.readAlertManagerConfig(k)
-	return err
+	cfg, _, err := a.readAlertManagerConfig(k)
+	if err != nil || a.AlertsFile == "" {
+		return err
+	}
+
+	parsed, err := config.Load(cfg)
+	if err != nil {
+		return err
+	}
+	alerts, err := loadSampleAlerts(a.AlertsFile)
+	if err != nil {
+		return err
+	}
+
+	return printRoutingSimulation(os.Stdout, simulateRouting(parsed, alerts))
 }
 
 func (a *AlertmanagerCommand) loadConfig(k *kingpin.ParseContext) error {
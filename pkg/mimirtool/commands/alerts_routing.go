@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/inhibit"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// sampleAlert is a single alert of the sample alert set used to simulate the routing.
+type sampleAlert struct {
+	Labels map[string]string `yaml:"labels"`
+}
+
+// routedAlertGroup is an aggregation group resulting from the routing simulation: the alerts
+// routed to the same route with the same values of the group_by labels, which are notified together.
+type routedAlertGroup struct {
+	Receiver       string
+	RouteKey       string
+	GroupLabels    model.LabelSet
+	Alerts         []model.LabelSet
+	GroupWait      time.Duration
+	GroupInterval  time.Duration
+	RepeatInterval time.Duration
+}
+
+// inhibitedAlert is an alert of the sample alert set which is not notified because it's inhibited
+// by another alert of the same set.
+type inhibitedAlert struct {
+	Labels      model.LabelSet
+	InhibitedBy model.LabelSet
+}
+
+// routingSimulation is the result of the simulation of the routing of a set of alerts.
+type routingSimulation struct {
+	Groups    []*routedAlertGroup
+	Inhibited []inhibitedAlert
+}
+
+func loadSampleAlerts(filename string) ([]model.LabelSet, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load alerts file: "+filename)
+	}
+
+	var alerts []sampleAlert
+	if err := yaml.Unmarshal(content, &alerts); err != nil {
+		return nil, errors.Wrap(err, "unable to parse alerts file: "+filename)
+	}
+
+	sets := make([]model.LabelSet, 0, len(alerts))
+	for i, a := range alerts {
+		if len(a.Labels) == 0 {
+			return nil, fmt.Errorf("alert #%d in %s has no labels", i+1, filename)
+		}
+
+		lset := make(model.LabelSet, len(a.Labels))
+		for name, value := range a.Labels {
+			lset[model.LabelName(name)] = model.LabelValue(value)
+		}
+		if err := lset.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "alert #%d in %s has invalid labels", i+1, filename)
+		}
+		sets = append(sets, lset)
+	}
+	return sets, nil
+}
+
+// simulateRouting simulates the routing of the input alerts through the input Alertmanager configuration,
+// assuming all the alerts start firing at the same time. The alerts are matched against the routing tree,
+// aggregated in groups by the group_by labels of the matching routes, and the alerts inhibited by other
+// alerts of the same set are excluded from the notifications, like the Alertmanager does.
+func simulateRouting(cfg *config.Config, alerts []model.LabelSet) routingSimulation {
+	var (
+		root   = dispatch.NewRoute(cfg.Route, nil)
+		rules  = make([]*inhibit.InhibitRule, 0, len(cfg.InhibitRules))
+		groups = map[string]*routedAlertGroup{}
+		result routingSimulation
+	)
+
+	for _, cr := range cfg.InhibitRules {
+		rules = append(rules, inhibit.NewInhibitRule(cr))
+	}
+
+	for _, lset := range alerts {
+		if source, ok := inhibitingAlert(rules, alerts, lset); ok {
+			result.Inhibited = append(result.Inhibited, inhibitedAlert{Labels: lset, InhibitedBy: source})
+			continue
+		}
+
+		for _, route := range root.Match(lset) {
+			groupLabels := model.LabelSet{}
+			for name, value := range lset {
+				if _, ok := route.RouteOpts.GroupBy[name]; ok || route.RouteOpts.GroupByAll {
+					groupLabels[name] = value
+				}
+			}
+
+			key := route.Key() + ":" + groupLabels.String()
+			group, ok := groups[key]
+			if !ok {
+				group = &routedAlertGroup{
+					Receiver:       route.RouteOpts.Receiver,
+					RouteKey:       route.Key(),
+					GroupLabels:    groupLabels,
+					GroupWait:      route.RouteOpts.GroupWait,
+					GroupInterval:  route.RouteOpts.GroupInterval,
+					RepeatInterval: route.RouteOpts.RepeatInterval,
+				}
+				groups[key] = group
+				result.Groups = append(result.Groups, group)
+			}
+			group.Alerts = append(group.Alerts, lset)
+		}
+	}
+
+	sort.SliceStable(result.Groups, func(i, j int) bool {
+		if result.Groups[i].Receiver != result.Groups[j].Receiver {
+			return result.Groups[i].Receiver < result.Groups[j].Receiver
+		}
+		return result.Groups[i].GroupLabels.String() < result.Groups[j].GroupLabels.String()
+	})
+
+	return result
+}
+
+// inhibitingAlert returns the first alert among alerts which inhibits the target alert according to
+// the input rules. Like in the Alertmanager, alerts matching both the source and the target matchers
+// of a rule don't inhibit the alerts which match both too.
+func inhibitingAlert(rules []*inhibit.InhibitRule, alerts []model.LabelSet, target model.LabelSet) (model.LabelSet, bool) {
+	for _, r := range rules {
+		if !r.TargetMatchers.Matches(target) {
+			continue
+		}
+		excludeTwoSidedMatch := r.SourceMatchers.Matches(target)
+
+	Sources:
+		for _, source := range alerts {
+			if !r.SourceMatchers.Matches(source) {
+				continue
+			}
+			for name := range r.Equal {
+				if source[name] != target[name] {
+					continue Sources
+				}
+			}
+			if excludeTwoSidedMatch && r.TargetMatchers.Matches(source) {
+				continue
+			}
+			return source, true
+		}
+	}
+	return nil, false
+}
+
+// printRoutingSimulation prints, for each aggregation group, the receiver notified and when, followed
+// by the alerts which are not notified because inhibited.
+func printRoutingSimulation(w io.Writer, result routingSimulation) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "RECEIVER\tGROUP\tALERTS\tFIRST NOTIFICATION\tUPDATES EVERY\tREPEATS EVERY\tROUTE")
+	for _, g := range result.Groups {
+		fmt.Fprintf(tw, "%s\t%s\t%d\tafter %s\t%s\t%s\t%s\n",
+			g.Receiver, g.GroupLabels, len(g.Alerts),
+			model.Duration(g.GroupWait), model.Duration(g.GroupInterval), model.Duration(g.RepeatInterval),
+			g.RouteKey)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, g := range result.Groups {
+		alerts := make([]string, 0, len(g.Alerts))
+		for _, a := range g.Alerts {
+			alerts = append(alerts, a.String())
+		}
+		fmt.Fprintf(w, "\nAlerts notified to %s in group %s:\n  %s\n", g.Receiver, g.GroupLabels, strings.Join(alerts, "\n  "))
+	}
+
+	if len(result.Inhibited) > 0 {
+		fmt.Fprintln(w, "\nInhibited alerts, not notified:")
+		for _, a := range result.Inhibited {
+			fmt.Fprintf(w, "  %s inhibited by %s\n", a.Labels, a.InhibitedBy)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const routingTestConfig = `
+route:
+  receiver: default
+  group_by: [alertname]
+  group_wait: 30s
+  group_interval: 5m
+  repeat_interval: 4h
+  routes:
+    - receiver: team-a
+      matchers: [team="a"]
+      group_by: [alertname, cluster]
+      group_wait: 10s
+      continue: true
+    - receiver: team-a-pager
+      matchers: [team="a", severity="critical"]
+      repeat_interval: 1h
+inhibit_rules:
+  - source_matchers: [severity="critical"]
+    target_matchers: [severity="warning"]
+    equal: [alertname, cluster]
+receivers:
+  - name: default
+  - name: team-a
+  - name: team-a-pager
+`
+
+func TestSimulateRouting(t *testing.T) {
+	cfg, err := config.Load(routingTestConfig)
+	require.NoError(t, err)
+
+	var (
+		critical     = model.LabelSet{"alertname": "HighLatency", "cluster": "eu", "team": "a", "severity": "critical"}
+		warning      = model.LabelSet{"alertname": "HighLatency", "cluster": "eu", "team": "a", "severity": "warning"}
+		otherCluster = model.LabelSet{"alertname": "HighLatency", "cluster": "us", "team": "a", "severity": "warning"}
+		noTeam       = model.LabelSet{"alertname": "DiskFull", "cluster": "eu"}
+	)
+
+	result := simulateRouting(cfg, []model.LabelSet{critical, warning, otherCluster, noTeam})
+
+	require.Len(t, result.Groups, 4)
+
+	assert.Equal(t, "default", result.Groups[0].Receiver)
+	assert.Equal(t, model.LabelSet{"alertname": "DiskFull"}, result.Groups[0].GroupLabels)
+	assert.Equal(t, []model.LabelSet{noTeam}, result.Groups[0].Alerts)
+	assert.Equal(t, 30*time.Second, result.Groups[0].GroupWait)
+
+	assert.Equal(t, "team-a", result.Groups[1].Receiver)
+	assert.Equal(t, model.LabelSet{"alertname": "HighLatency", "cluster": "eu"}, result.Groups[1].GroupLabels)
+	assert.Equal(t, []model.LabelSet{critical}, result.Groups[1].Alerts)
+	assert.Equal(t, 10*time.Second, result.Groups[1].GroupWait)
+	assert.Equal(t, 5*time.Minute, result.Groups[1].GroupInterval)
+	assert.Equal(t, 4*time.Hour, result.Groups[1].RepeatInterval)
+
+	assert.Equal(t, "team-a", result.Groups[2].Receiver)
+	assert.Equal(t, model.LabelSet{"alertname": "HighLatency", "cluster": "us"}, result.Groups[2].GroupLabels)
+	assert.Equal(t, []model.LabelSet{otherCluster}, result.Groups[2].Alerts)
+
+	// The critical alert matches the second route too, because the first one continues.
+	assert.Equal(t, "team-a-pager", result.Groups[3].Receiver)
+	assert.Equal(t, model.LabelSet{"alertname": "HighLatency"}, result.Groups[3].GroupLabels)
+	assert.Equal(t, []model.LabelSet{critical}, result.Groups[3].Alerts)
+	assert.Equal(t, time.Hour, result.Groups[3].RepeatInterval)
+
+	// Only the warning alert in the same cluster of the critical one is inhibited.
+	assert.Equal(t, []inhibitedAlert{{Labels: warning, InhibitedBy: critical}}, result.Inhibited)
+}
+
+func TestSimulateRouting_ShouldNotInhibitAlertsMatchingBothSidesOfTheRule(t *testing.T) {
+	cfg, err := config.Load(`
+route:
+  receiver: default
+inhibit_rules:
+  - source_matchers: [severity=~"critical|warning"]
+    target_matchers: [severity=~"critical|warning"]
+    equal: [alertname]
+receivers:
+  - name: default
+`)
+	require.NoError(t, err)
+
+	alerts := []model.LabelSet{
+		{"alertname": "HighLatency", "severity": "critical"},
+		{"alertname": "HighLatency", "severity": "warning"},
+	}
+
+	result := simulateRouting(cfg, alerts)
+	assert.Empty(t, result.Inhibited)
+	require.Len(t, result.Groups, 1)
+	assert.Equal(t, alerts, result.Groups[0].Alerts)
+}
+
+func TestLoadSampleAlerts(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.yaml")
+	require.NoError(t, os.WriteFile(valid, []byte(`
+- labels:
+    alertname: HighLatency
+    severity: critical
+- labels:
+    alertname: DiskFull
+`), 0o644))
+
+	alerts, err := loadSampleAlerts(valid)
+	require.NoError(t, err)
+	assert.Equal(t, []model.LabelSet{
+		{"alertname": "HighLatency", "severity": "critical"},
+		{"alertname": "DiskFull"},
+	}, alerts)
+
+	noLabels := filepath.Join(dir, "no-labels.yaml")
+	require.NoError(t, os.WriteFile(noLabels, []byte(`
+- labels:
+    alertname: HighLatency
+- labels: {}
+`), 0o644))
+
+	_, err = loadSampleAlerts(noLabels)
+	assert.ErrorContains(t, err, "alert #2")
+}
+
+func TestPrintRoutingSimulation(t *testing.T) {
+	cfg, err := config.Load(routingTestConfig)
+	require.NoError(t, err)
+
+	result := simulateRouting(cfg, []model.LabelSet{
+		{"alertname": "HighLatency", "cluster": "eu", "team": "a", "severity": "critical"},
+		{"alertname": "HighLatency", "cluster": "eu", "team": "a", "severity": "warning"},
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, printRoutingSimulation(&buf, result))
+
+	out := buf.String()
+	assert.Contains(t, out, "RECEIVER")
+	assert.Contains(t, out, "team-a-pager")
+	assert.Contains(t, out, "after 10s")
+	assert.Contains(t, out, "Inhibited alerts, not notified:")
+	assert.Contains(t, out, `{alertname="HighLatency", cluster="eu", severity="warning", team="a"} inhibited by {alertname="HighLatency", cluster="eu", severity="critical", team="a"}`)
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 
 	"github.com/grafana/mimir/pkg/mimirtool/client"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 )
 
 type BackfillCommand struct {
@@ -23,6 +25,8 @@ type BackfillCommand struct {
 
 type blockList []string
 
+// Set adds the input block directory to the list. If the input directory is not a block but a TSDB
+// directory (e.g. created by "remote-read export"), then all blocks in the TSDB directory are added.
 func (l *blockList) Set(value string) error {
 	st, err := os.Stat(value)
 	if err != nil {
@@ -31,7 +35,28 @@ func (l *blockList) Set(value string) error {
 	if !st.IsDir() {
 		return fmt.Errorf("%q must be a directory", value)
 	}
-	*l = append(*l, value)
+
+	if isBlockDir(value) {
+		*l = append(*l, value)
+		return nil
+	}
+
+	entries, err := os.ReadDir(value)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %q: %w", value, err)
+	}
+
+	var blocks []string
+	for _, e := range entries {
+		if dir := filepath.Join(value, e.Name()); e.IsDir() && isBlockDir(dir) {
+			blocks = append(blocks, dir)
+		}
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("%q is neither a block nor a directory containing blocks", value)
+	}
+
+	*l = append(*l, blocks...)
 	return nil
 }
 
@@ -43,10 +68,16 @@ func (l blockList) IsCumulative() bool {
 	return true
 }
 
+// isBlockDir returns whether the input directory is a TSDB block, checking the existence of the meta file.
+func isBlockDir(dir string) bool {
+	st, err := os.Stat(filepath.Join(dir, block.MetaFilename))
+	return err == nil && st.Mode().IsRegular()
+}
+
 func (c *BackfillCommand) Register(app *kingpin.Application, envVars EnvVarNames) {
 	cmd := app.Command("backfill", "Upload Prometheus TSDB blocks to Grafana Mimir compactor.")
 	cmd.Action(c.backfill)
-	cmd.Arg("block-dir", "block to upload").Required().SetValue(&c.blocks)
+	cmd.Arg("block-dir", "block to upload, or directory containing the blocks to upload (e.g. the TSDB created by remote-read export)").Required().SetValue(&c.blocks)
 
 	cmd.Flag("address", "Address of the Grafana Mimir cluster; alternatively, set "+envVars.Address+".").
 		Envar(envVars.Address).
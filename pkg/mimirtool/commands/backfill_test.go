@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package commands
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirtool/backfill"
+)
+
+func TestBlockList_Set(t *testing.T) {
+	// Create a TSDB the same way "remote-read export" does, with samples spanning two 2h blocks.
+	tsdbDir := t.TempDir()
+	series := []*prompb.TimeSeries{{
+		Labels: []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{
+			{Timestamp: 0, Value: 1},
+			{Timestamp: (3 * time.Hour).Milliseconds(), Value: 2},
+		},
+	}}
+	iterator := func() backfill.Iterator {
+		return newTimeSeriesIterator(series)
+	}
+	require.NoError(t, backfill.CreateBlocks(iterator, 0, (3 * time.Hour).Milliseconds(), 1000, tsdbDir, false, io.Discard))
+	require.NoError(t, os.Mkdir(filepath.Join(tsdbDir, "wal"), 0755))
+
+	entries, err := os.ReadDir(tsdbDir)
+	require.NoError(t, err)
+
+	var expectedBlocks []string
+	for _, e := range entries {
+		if e.Name() != "wal" {
+			expectedBlocks = append(expectedBlocks, filepath.Join(tsdbDir, e.Name()))
+		}
+	}
+	require.Len(t, expectedBlocks, 2)
+
+	t.Run("should add a block directory", func(t *testing.T) {
+		var l blockList
+		require.NoError(t, l.Set(expectedBlocks[0]))
+		assert.Equal(t, blockList{expectedBlocks[0]}, l)
+	})
+
+	t.Run("should add all blocks in a TSDB directory", func(t *testing.T) {
+		var l blockList
+		require.NoError(t, l.Set(tsdbDir))
+		assert.Equal(t, blockList(expectedBlocks), l)
+	})
+
+	t.Run("should fail if the directory doesn't contain any block", func(t *testing.T) {
+		var l blockList
+		require.Error(t, l.Set(t.TempDir()))
+		assert.Empty(t, l)
+	})
+
+	t.Run("should fail if the directory doesn't exist", func(t *testing.T) {
+		var l blockList
+		require.Error(t, l.Set(filepath.Join(tsdbDir, "missing")))
+	})
+}
@@ -0,0 +1,330 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package export implements the asynchronous export of the series of a tenant to object storage. An export
+// job is requested through the API, and run in background by the querier which received the request, so that
+// large amounts of data can be extracted without running huge synchronous range queries.
+package export
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/tenant"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	// FormatCSV is the format of the exported data, with one row per sample: the labels of the series,
+	// the timestamp in milliseconds and the value.
+	FormatCSV = "csv"
+)
+
+var supportedFormats = []string{FormatCSV}
+
+type Config struct {
+	Enabled                bool          `yaml:"enabled" category:"experimental"`
+	MaxConcurrentJobs      int           `yaml:"max_concurrent_jobs" category:"experimental"`
+	MaxQueuedJobsPerTenant int           `yaml:"max_queued_jobs_per_tenant" category:"experimental"`
+	SplitInterval          time.Duration `yaml:"split_interval" category:"experimental"`
+}
+
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "querier.export.enabled", false, "True to enable the API to export the series of a tenant to the blocks storage bucket, as asynchronous jobs run in background by the querier.")
+	f.IntVar(&cfg.MaxConcurrentJobs, "querier.export.max-concurrent-jobs", 1, "Maximum number of export jobs run concurrently by each querier.")
+	f.IntVar(&cfg.MaxQueuedJobsPerTenant, "querier.export.max-queued-jobs-per-tenant", 10, "Maximum number of export jobs of each tenant queued in each querier, waiting to be run. The queued jobs of the tenants are run round-robin. Export requests exceeding the limit are rejected.")
+	f.DurationVar(&cfg.SplitInterval, "querier.export.split-interval", 2*time.Hour, "The time range of an export job is split into intervals of this duration, which are queried sequentially, to limit the memory used by each job. The intervals are capped to the max partial query length of the tenant.")
+}
+
+func (cfg *Config) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.MaxConcurrentJobs <= 0 {
+		return errors.New("the export max concurrent jobs must be greater than 0")
+	}
+	if cfg.MaxQueuedJobsPerTenant <= 0 {
+		return errors.New("the export max queued jobs per tenant must be greater than 0")
+	}
+	if cfg.SplitInterval <= 0 {
+		return errors.New("the export split interval must be greater than 0")
+	}
+	return nil
+}
+
+// Limits are the per-tenant limits of the queries, which are enforced on the export jobs too.
+type Limits interface {
+	MaxTotalQueryLength(userID string) time.Duration
+	MaxPartialQueryLength(userID string) time.Duration
+	MaxQueryLookback(userID string) time.Duration
+}
+
+type job struct {
+	userID string
+	status JobStatus
+}
+
+// Manager receives the export requests, and runs the export jobs in background.
+type Manager struct {
+	services.Service
+
+	cfg         Config
+	bucket      objstore.Bucket
+	cfgProvider bucket.TenantConfigProvider
+	limits      Limits
+	queryable   storage.Queryable
+	logger      log.Logger
+
+	// instanceID identifies the querier running the jobs, to find the jobs orphaned by a restart.
+	instanceID string
+
+	queue *jobQueue
+
+	jobsTotal       *prometheus.CounterVec
+	exportedSamples prometheus.Counter
+}
+
+func NewManager(cfg Config, bkt objstore.Bucket, cfgProvider bucket.TenantConfigProvider, limits Limits, queryable storage.Queryable, instanceID string, logger log.Logger, reg prometheus.Registerer) *Manager {
+	m := &Manager{
+		cfg:         cfg,
+		bucket:      bkt,
+		cfgProvider: cfgProvider,
+		limits:      limits,
+		queryable:   queryable,
+		instanceID:  instanceID,
+		logger:      logger,
+		queue:       newJobQueue(cfg.MaxQueuedJobsPerTenant),
+		jobsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_querier_export_jobs_total",
+			Help: "Total number of export jobs run by the querier, by outcome.",
+		}, []string{"outcome"}),
+		exportedSamples: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_querier_export_samples_total",
+			Help: "Total number of samples exported by the export jobs.",
+		}),
+	}
+
+	m.Service = services.NewBasicService(m.starting, m.running, nil)
+	return m
+}
+
+func (m *Manager) starting(ctx context.Context) error {
+	// The jobs orphaned by a restart are not a reason to fail the startup.
+	if err := m.failOrphanedJobs(ctx); err != nil {
+		level.Warn(m.logger).Log("msg", "failed to mark orphaned export jobs as failed", "err", err)
+	}
+	return nil
+}
+
+func (m *Manager) running(ctx context.Context) error {
+	done := make(chan struct{}, m.cfg.MaxConcurrentJobs)
+	for i := 0; i < m.cfg.MaxConcurrentJobs; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+
+			for {
+				j, ok := m.queue.dequeue()
+				if !ok {
+					return
+				}
+				m.runJob(ctx, j)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+
+	// The queued jobs will never run, so they're marked as failed.
+	for _, j := range m.queue.stop() {
+		m.failJob(j, errors.New("the querier has been shut down before running the job"))
+	}
+	for i := 0; i < m.cfg.MaxConcurrentJobs; i++ {
+		<-done
+	}
+	return nil
+}
+
+// CreateJobHandler handles the requests to create an export job. The job is run in background, and its
+// status is returned in the response.
+func (m *Manager) CreateJobHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	status, err := parseCreateJobRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := m.enforceQueryLimits(userID, &status); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	status.ID = ulid.MustNew(ulid.Now(), rand.Reader).String()
+	status.State = StatePending
+	status.Runner = m.instanceID
+	status.CreatedAt = time.Now()
+	status.UpdatedAt = status.CreatedAt
+
+	if m.State() != services.Running {
+		http.Error(w, "the export jobs can't be run at the moment", http.StatusServiceUnavailable)
+		return
+	}
+
+	userBkt := m.userBucket(userID)
+	if err := writeJobStatus(r.Context(), userBkt, status); err != nil {
+		level.Error(m.logger).Log("msg", "failed to write export job status", "user", userID, "job", status.ID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := m.queue.enqueue(job{userID: userID, status: status}); err != nil {
+		// Remove the job, so that it isn't listed as pending forever.
+		if err := deleteJob(r.Context(), userBkt, status.ID); err != nil {
+			level.Warn(m.logger).Log("msg", "failed to delete rejected export job", "user", userID, "job", status.ID, "err", err)
+		}
+
+		code := http.StatusTooManyRequests
+		if errors.Is(err, errQueueStopped) {
+			code = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	level.Info(m.logger).Log("msg", "export job queued", "user", userID, "job", status.ID, "selectors", strings.Join(status.Selectors, " "), "start", status.Start, "end", status.End)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// enforceQueryLimits enforces on the time range of the input job the limits enforced on the queries: the start
+// is clamped to the max query lookback, and the time range can't be longer than the max total query length.
+func (m *Manager) enforceQueryLimits(userID string, status *JobStatus) error {
+	if maxQueryLookback := m.limits.MaxQueryLookback(userID); maxQueryLookback > 0 {
+		minStart := time.Now().Add(-maxQueryLookback).UnixMilli()
+		if status.End < minStart {
+			return fmt.Errorf("the time range of the export job is entirely before the max query lookback (%s)", model.Duration(maxQueryLookback))
+		}
+		if status.Start < minStart {
+			status.Start = minStart
+		}
+	}
+
+	if maxQueryLength := m.limits.MaxTotalQueryLength(userID); maxQueryLength > 0 {
+		if length := time.Duration(status.End-status.Start) * time.Millisecond; length > maxQueryLength {
+			return validation.NewMaxTotalQueryLengthError(length, maxQueryLength)
+		}
+	}
+	return nil
+}
+
+// JobStatusHandler handles the requests to get the status of an export job.
+func (m *Manager) JobStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	jobID := mux.Vars(r)["job"]
+	if _, err := ulid.Parse(jobID); err != nil {
+		http.Error(w, "invalid export job ID", http.StatusBadRequest)
+		return
+	}
+
+	status, err := readJobStatus(r.Context(), m.userBucket(userID), jobID)
+	if err != nil {
+		if m.bucket.IsObjNotFoundErr(err) {
+			http.Error(w, "export job not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	util.WriteJSONResponse(w, status)
+}
+
+// ListJobsHandler handles the requests to list the export jobs of a tenant, along with their status.
+func (m *Manager) ListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	statuses, err := listJobs(r.Context(), m.userBucket(userID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	util.WriteJSONResponse(w, ListJobsResponse{Jobs: statuses})
+}
+
+// ListJobsResponse is the response of the list export jobs API.
+type ListJobsResponse struct {
+	Jobs []JobStatus `json:"jobs"`
+}
+
+func parseCreateJobRequest(r *http.Request) (JobStatus, error) {
+	if err := r.ParseForm(); err != nil {
+		return JobStatus{}, err
+	}
+
+	selectors := r.Form["match[]"]
+	if len(selectors) == 0 {
+		return JobStatus{}, errors.New("no match[] parameter provided")
+	}
+	for _, s := range selectors {
+		if _, err := parser.ParseMetricSelector(s); err != nil {
+			return JobStatus{}, fmt.Errorf("invalid match[] parameter %q: %w", s, err)
+		}
+	}
+
+	start, err := util.ParseTime(r.Form.Get("start"))
+	if err != nil {
+		return JobStatus{}, errors.New("invalid start parameter")
+	}
+	end, err := util.ParseTime(r.Form.Get("end"))
+	if err != nil {
+		return JobStatus{}, errors.New("invalid end parameter")
+	}
+	if end < start {
+		return JobStatus{}, errors.New("the end timestamp must not be before the start timestamp")
+	}
+
+	format := r.Form.Get("format")
+	if format == "" {
+		format = FormatCSV
+	}
+	if !util.StringsContain(supportedFormats, format) {
+		return JobStatus{}, fmt.Errorf("unsupported format %q, supported formats: %s", format, strings.Join(supportedFormats, ", "))
+	}
+
+	return JobStatus{Selectors: selectors, Start: start, End: end, Format: format}, nil
+}
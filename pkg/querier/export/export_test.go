@@ -0,0 +1,489 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package export
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/gorilla/mux"
+	"github.com/grafana/dskit/services"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	promstorage "github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/teststorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/providers/filesystem"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		setup       func(cfg *Config)
+		expectedErr string
+	}{
+		"should pass with the default config": {
+			setup: func(*Config) {},
+		},
+		"should pass with the default config when enabled": {
+			setup: func(cfg *Config) { cfg.Enabled = true },
+		},
+		"should fail if the max concurrent jobs is 0": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.MaxConcurrentJobs = 0
+			},
+			expectedErr: "max concurrent jobs",
+		},
+		"should fail if the max queued jobs per tenant is 0": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.MaxQueuedJobsPerTenant = 0
+			},
+			expectedErr: "max queued jobs per tenant",
+		},
+		"should fail if the split interval is 0": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.SplitInterval = 0
+			},
+			expectedErr: "split interval",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg := Config{MaxConcurrentJobs: 1, MaxQueuedJobsPerTenant: 10, SplitInterval: 2 * time.Hour}
+			testData.setup(&cfg)
+
+			err := cfg.Validate()
+			if testData.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), testData.expectedErr)
+			}
+		})
+	}
+}
+
+func TestManager_CreateJobHandler_InvalidRequests(t *testing.T) {
+	m, _, _ := prepareManager(t, mockLimits{})
+
+	for testName, testData := range map[string]struct {
+		params      url.Values
+		expectedErr string
+	}{
+		"missing selectors": {
+			params:      url.Values{"start": {"0"}, "end": {"10"}},
+			expectedErr: "no match[] parameter provided",
+		},
+		"invalid selector": {
+			params:      url.Values{"match[]": {"sum(up)"}, "start": {"0"}, "end": {"10"}},
+			expectedErr: "invalid match[] parameter",
+		},
+		"invalid start": {
+			params:      url.Values{"match[]": {"up"}, "start": {"yesterday"}, "end": {"10"}},
+			expectedErr: "invalid start parameter",
+		},
+		"end before start": {
+			params:      url.Values{"match[]": {"up"}, "start": {"10"}, "end": {"0"}},
+			expectedErr: "the end timestamp must not be before the start timestamp",
+		},
+		"unsupported format": {
+			params:      url.Values{"match[]": {"up"}, "start": {"0"}, "end": {"10"}, "format": {"parquet"}},
+			expectedErr: `unsupported format "parquet"`,
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			rec := createJob(t, m, "user-1", testData.params)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), testData.expectedErr)
+		})
+	}
+}
+
+func TestManager_CreateJobHandler_QueryLimits(t *testing.T) {
+	now := time.Now()
+
+	for testName, testData := range map[string]struct {
+		limits        mockLimits
+		start, end    time.Time
+		expectedErr   string
+		expectedStart time.Time
+	}{
+		"time range within the limits": {
+			limits: mockLimits{maxTotalQueryLength: 24 * time.Hour, maxQueryLookback: 24 * time.Hour},
+			start:  now.Add(-12 * time.Hour),
+			end:    now,
+		},
+		"time range exceeding the max total query length": {
+			limits:      mockLimits{maxTotalQueryLength: 24 * time.Hour},
+			start:       now.Add(-48 * time.Hour),
+			end:         now,
+			expectedErr: "the total query time range exceeds the limit",
+		},
+		"start before the max query lookback": {
+			limits:        mockLimits{maxQueryLookback: 24 * time.Hour},
+			start:         now.Add(-48 * time.Hour),
+			end:           now,
+			expectedStart: now.Add(-24 * time.Hour),
+		},
+		"time range entirely before the max query lookback": {
+			limits:      mockLimits{maxQueryLookback: 24 * time.Hour},
+			start:       now.Add(-72 * time.Hour),
+			end:         now.Add(-48 * time.Hour),
+			expectedErr: "the time range of the export job is entirely before the max query lookback",
+		},
+		"time range exceeding the max total query length before being clamped to the max query lookback": {
+			limits:        mockLimits{maxTotalQueryLength: 36 * time.Hour, maxQueryLookback: 24 * time.Hour},
+			start:         now.Add(-48 * time.Hour),
+			end:           now,
+			expectedStart: now.Add(-24 * time.Hour),
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			m, _, _ := prepareManager(t, testData.limits)
+
+			rec := createJob(t, m, "user-1", url.Values{
+				"match[]": {"up"},
+				"start":   {strconv.FormatInt(testData.start.Unix(), 10)},
+				"end":     {strconv.FormatInt(testData.end.Unix(), 10)},
+			})
+			if testData.expectedErr != "" {
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+				assert.Contains(t, rec.Body.String(), testData.expectedErr)
+				return
+			}
+
+			require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+			var created JobStatus
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+			if testData.expectedStart.IsZero() {
+				assert.Equal(t, testData.start.Truncate(time.Second).UnixMilli(), created.Start)
+			} else {
+				assert.InDelta(t, testData.expectedStart.UnixMilli(), created.Start, float64(time.Minute.Milliseconds()))
+			}
+		})
+	}
+}
+
+func TestManager_ExportJob(t *testing.T) {
+	m, bkt, reg := prepareManager(t, mockLimits{})
+
+	// The split interval is 1h: the samples of the second series are split across multiple intervals.
+	rec := createJob(t, m, "user-1", url.Values{
+		"match[]": {`series_1`, `{__name__=~"series_.*", job="b"}`},
+		"start":   {"0"},
+		"end":     {"10800"},
+	})
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+	var created JobStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, StatePending, created.State)
+	assert.Equal(t, FormatCSV, created.Format)
+
+	var status JobStatus
+	require.Eventually(t, func() bool {
+		status = getJobStatus(t, m, "user-1", created.ID)
+		return status.State == StateSucceeded || status.State == StateFailed
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, StateSucceeded, status.State, status.Error)
+	assert.Equal(t, path.Join(ExportsPathname, created.ID, "data.csv"), status.Object)
+	assert.Equal(t, int64(5), status.Samples)
+
+	r, err := bkt.Get(context.Background(), path.Join("user-1", status.Object))
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	// The series matching both selectors are exported once, and the samples outside the time range are not exported.
+	assert.Equal(t, strings.Join([]string{
+		"series,timestamp,value",
+		`"{__name__=""series_1"", job=""a""}",0,1`,
+		`"{__name__=""series_1"", job=""a""}",1800000,2`,
+		`"{__name__=""series_2"", job=""b""}",1800000,10`,
+		`"{__name__=""series_1"", job=""a""}",3600000,3`,
+		`"{__name__=""series_2"", job=""b""}",7200000,20`,
+		"",
+	}, "\n"), string(data))
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_querier_export_jobs_total Total number of export jobs run by the querier, by outcome.
+		# TYPE cortex_querier_export_jobs_total counter
+		cortex_querier_export_jobs_total{outcome="succeeded"} 1
+	`), "cortex_querier_export_jobs_total"))
+
+	// The job is listed for the tenant which created it only.
+	assert.Equal(t, []JobStatus{status}, listJobStatuses(t, m, "user-1"))
+	assert.Empty(t, listJobStatuses(t, m, "user-2"))
+
+	rec = httptest.NewRecorder()
+	m.JobStatusHandler(rec, jobStatusRequest("user-2", created.ID))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestManager_ExportJob_ShouldCapSplitIntervalToMaxPartialQueryLength(t *testing.T) {
+	cfg := Config{Enabled: true, MaxConcurrentJobs: 1, MaxQueuedJobsPerTenant: 1, SplitInterval: time.Hour}
+	queryable := &recordingQueryable{}
+
+	m := NewManager(cfg, objstore.NewInMemBucket(), nil, mockLimits{maxPartialQueryLength: 30 * time.Minute}, queryable, "querier-1", log.NewNopLogger(), nil)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), m))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), m))
+	})
+
+	rec := createJob(t, m, "user-1", url.Values{"match[]": {"up"}, "start": {"0"}, "end": {"3600"}})
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+	var created JobStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	var status JobStatus
+	require.Eventually(t, func() bool {
+		status = getJobStatus(t, m, "user-1", created.ID)
+		return status.State == StateSucceeded || status.State == StateFailed
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, StateSucceeded, status.State, status.Error)
+
+	assert.Equal(t, [][2]int64{{0, 1799999}, {1800000, 3599999}, {3600000, 3600000}}, queryable.intervals())
+}
+
+func TestManager_JobStatusHandler_InvalidJobID(t *testing.T) {
+	m, _, _ := prepareManager(t, mockLimits{})
+
+	rec := httptest.NewRecorder()
+	m.JobStatusHandler(rec, jobStatusRequest("user-1", "../other"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestManager_CreateJobHandler_TooManyQueuedJobs(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	cfg := Config{Enabled: true, MaxConcurrentJobs: 1, MaxQueuedJobsPerTenant: 1, SplitInterval: time.Hour}
+
+	// The in-memory bucket is locked while uploading an object, so the filesystem bucket is used instead.
+	bkt, err := filesystem.NewBucket(t.TempDir())
+	require.NoError(t, err)
+
+	// The jobs are blocked until the test completes, so that the queue fills up.
+	blocked := make(chan struct{})
+	t.Cleanup(func() { close(blocked) })
+	queryable := blockingQueryable{blocked: blocked}
+
+	m := NewManager(cfg, bkt, nil, mockLimits{}, queryable, "querier-1", log.NewNopLogger(), reg)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), m))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), m))
+	})
+
+	params := url.Values{"match[]": {"up"}, "start": {"0"}, "end": {"10"}}
+
+	// The first job is run, and the second one is queued.
+	rec := createJob(t, m, "user-1", params)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var running JobStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &running))
+	require.Eventually(t, func() bool {
+		return getJobStatus(t, m, "user-1", running.ID).State == StateRunning
+	}, time.Second, time.Millisecond)
+	require.Equal(t, http.StatusAccepted, createJob(t, m, "user-1", params).Code)
+
+	rec = createJob(t, m, "user-1", params)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	// The limit is per tenant, so the jobs of another tenant can still be queued.
+	assert.Equal(t, http.StatusAccepted, createJob(t, m, "user-2", params).Code)
+
+	// The rejected job is not listed.
+	assert.Len(t, listJobStatuses(t, m, "user-1"), 2)
+}
+
+func TestManager_ShouldFailOrphanedJobsAtStartup(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	now := time.Now()
+
+	statuses := map[string]JobStatus{
+		"running":            {State: StateRunning, Runner: "querier-1"},
+		"pending":            {State: StatePending, Runner: "querier-1"},
+		"succeeded":          {State: StateSucceeded, Runner: "querier-1"},
+		"running-in-another": {State: StateRunning, Runner: "querier-2"},
+	}
+	ids := map[string]string{}
+	for name, status := range statuses {
+		status.ID = ulid.MustNew(ulid.Now(), rand.Reader).String()
+		status.CreatedAt = now
+		status.UpdatedAt = now
+		ids[name] = status.ID
+		require.NoError(t, writeJobStatus(context.Background(), bucket.NewUserBucketClient("user-1", bkt, nil), status))
+	}
+
+	cfg := Config{Enabled: true, MaxConcurrentJobs: 1, MaxQueuedJobsPerTenant: 1, SplitInterval: time.Hour}
+	m := NewManager(cfg, bkt, nil, mockLimits{}, blockingQueryable{}, "querier-1", log.NewNopLogger(), nil)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), m))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), m))
+	})
+
+	for name, expectedState := range map[string]string{
+		"running":            StateFailed,
+		"pending":            StateFailed,
+		"succeeded":          StateSucceeded,
+		"running-in-another": StateRunning,
+	} {
+		status := getJobStatus(t, m, "user-1", ids[name])
+		assert.Equal(t, expectedState, status.State, name)
+		if expectedState == StateFailed {
+			assert.Equal(t, "the querier has been restarted while running the job", status.Error, name)
+		}
+	}
+}
+
+func prepareManager(t *testing.T, limits mockLimits) (*Manager, objstore.Bucket, *prometheus.Registry) {
+	storage := teststorage.New(t)
+	t.Cleanup(func() { _ = storage.Close() })
+
+	app := storage.Appender(context.Background())
+	for _, s := range []struct {
+		series labels.Labels
+		ts     int64
+		value  float64
+	}{
+		{labels.FromStrings(labels.MetricName, "series_1", "job", "a"), 0, 1},
+		{labels.FromStrings(labels.MetricName, "series_1", "job", "a"), 1800000, 2},
+		{labels.FromStrings(labels.MetricName, "series_1", "job", "a"), 3600000, 3},
+		{labels.FromStrings(labels.MetricName, "series_2", "job", "b"), 1800000, 10},
+		{labels.FromStrings(labels.MetricName, "series_2", "job", "b"), 7200000, 20},
+		{labels.FromStrings(labels.MetricName, "series_2", "job", "b"), 14400000, 30},
+		{labels.FromStrings(labels.MetricName, "series_3", "job", "c"), 0, 100},
+	} {
+		_, err := app.Append(0, s.series, s.ts, s.value)
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+
+	reg := prometheus.NewPedanticRegistry()
+	bkt := objstore.NewInMemBucket()
+	cfg := Config{Enabled: true, MaxConcurrentJobs: 1, MaxQueuedJobsPerTenant: 10, SplitInterval: time.Hour}
+
+	m := NewManager(cfg, bkt, nil, limits, storage, "querier-1", log.NewNopLogger(), reg)
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), m))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), m))
+	})
+
+	return m, bkt, reg
+}
+
+func createJob(t *testing.T, m *Manager, userID string, params url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/export", strings.NewReader(params.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(user.InjectOrgID(req.Context(), userID))
+
+	rec := httptest.NewRecorder()
+	m.CreateJobHandler(rec, req)
+	return rec
+}
+
+func jobStatusRequest(userID, jobID string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/export/"+jobID, nil)
+	req = req.WithContext(user.InjectOrgID(req.Context(), userID))
+	return mux.SetURLVars(req, map[string]string{"job": jobID})
+}
+
+func getJobStatus(t *testing.T, m *Manager, userID, jobID string) JobStatus {
+	rec := httptest.NewRecorder()
+	m.JobStatusHandler(rec, jobStatusRequest(userID, jobID))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var status JobStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	return status
+}
+
+func listJobStatuses(t *testing.T, m *Manager, userID string) []JobStatus {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/export", nil)
+	req = req.WithContext(user.InjectOrgID(req.Context(), userID))
+
+	rec := httptest.NewRecorder()
+	m.ListJobsHandler(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var res ListJobsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	return res.Jobs
+}
+
+type mockLimits struct {
+	maxTotalQueryLength   time.Duration
+	maxPartialQueryLength time.Duration
+	maxQueryLookback      time.Duration
+}
+
+func (l mockLimits) MaxTotalQueryLength(string) time.Duration {
+	return l.maxTotalQueryLength
+}
+
+func (l mockLimits) MaxPartialQueryLength(string) time.Duration {
+	return l.maxPartialQueryLength
+}
+
+func (l mockLimits) MaxQueryLookback(string) time.Duration {
+	return l.maxQueryLookback
+}
+
+// blockingQueryable is a queryable whose queriers can't be created until the blocked channel is closed.
+type blockingQueryable struct {
+	blocked chan struct{}
+}
+
+func (q blockingQueryable) Querier(ctx context.Context, _, _ int64) (promstorage.Querier, error) {
+	select {
+	case <-q.blocked:
+		return promstorage.NoopQuerier(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// recordingQueryable is a queryable which records the time range of each querier, and returns no series.
+type recordingQueryable struct {
+	mtx    sync.Mutex
+	ranges [][2]int64
+}
+
+func (q *recordingQueryable) Querier(_ context.Context, mint, maxt int64) (promstorage.Querier, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.ranges = append(q.ranges, [2]int64{mint, maxt})
+	return promstorage.NoopQuerier(), nil
+}
+
+func (q *recordingQueryable) intervals() [][2]int64 {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return append([][2]int64(nil), q.ranges...)
+}
@@ -0,0 +1,331 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/concurrency"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/thanos-io/objstore"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb"
+)
+
+const (
+	// ExportsPathname is the path, in the bucket of a tenant, where the export jobs are stored.
+	ExportsPathname = "exports"
+
+	jobStatusFilename = "status.json"
+
+	// Timeout used to update the status of a job after it has been interrupted.
+	updateStatusTimeout = 30 * time.Second
+
+	// Number of tenants whose export jobs are concurrently checked for orphaned jobs at startup.
+	orphanedJobsConcurrency = 16
+)
+
+// States of an export job.
+const (
+	StatePending   = "pending"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+// JobStatus is the status of an export job, stored in the bucket along with the exported data.
+type JobStatus struct {
+	ID        string   `json:"id"`
+	State     string   `json:"state"`
+	Selectors []string `json:"selectors"`
+	Start     int64    `json:"start"`
+	End       int64    `json:"end"`
+	Format    string   `json:"format"`
+
+	// Runner is the ID of the querier which queues and runs the job.
+	Runner string `json:"runner,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Object is the path of the exported data, relative to the tenant bucket. It's set when the job succeeds.
+	Object string `json:"object,omitempty"`
+
+	// Samples is the number of exported samples.
+	Samples int64 `json:"samples"`
+
+	// Error is the reason why the job failed.
+	Error string `json:"error,omitempty"`
+}
+
+func jobStatusPath(jobID string) string {
+	return path.Join(ExportsPathname, jobID, jobStatusFilename)
+}
+
+func jobDataPath(jobID, format string) string {
+	return path.Join(ExportsPathname, jobID, "data."+format)
+}
+
+func writeJobStatus(ctx context.Context, bkt objstore.Bucket, status JobStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return errors.Wrap(err, "marshal export job status")
+	}
+	return errors.Wrap(bkt.Upload(ctx, jobStatusPath(status.ID), bytes.NewReader(data)), "upload export job status")
+}
+
+func readJobStatus(ctx context.Context, bkt objstore.Bucket, jobID string) (JobStatus, error) {
+	r, err := bkt.Get(ctx, jobStatusPath(jobID))
+	if err != nil {
+		return JobStatus{}, err
+	}
+	defer func() { _ = r.Close() }()
+
+	var status JobStatus
+	if err := json.NewDecoder(r).Decode(&status); err != nil {
+		return JobStatus{}, errors.Wrap(err, "decode export job status")
+	}
+	return status, nil
+}
+
+func deleteJob(ctx context.Context, bkt objstore.Bucket, jobID string) error {
+	return bkt.Delete(ctx, jobStatusPath(jobID))
+}
+
+// listJobs returns the status of all the export jobs in the bucket, sorted by creation time.
+func listJobs(ctx context.Context, bkt objstore.Bucket) ([]JobStatus, error) {
+	statuses := []JobStatus{}
+
+	err := bkt.Iter(ctx, ExportsPathname+"/", func(name string) error {
+		jobID := path.Base(strings.TrimSuffix(name, "/"))
+		if _, err := ulid.Parse(jobID); err != nil {
+			return nil
+		}
+
+		status, err := readJobStatus(ctx, bkt, jobID)
+		if err != nil {
+			if bkt.IsObjNotFoundErr(err) {
+				return nil
+			}
+			return err
+		}
+		statuses = append(statuses, status)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list export jobs")
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].CreatedAt.Before(statuses[j].CreatedAt)
+	})
+	return statuses, nil
+}
+
+// runJob runs the input export job, updating its status in the bucket.
+func (m *Manager) runJob(ctx context.Context, j job) {
+	logger := log.With(m.logger, "user", j.userID, "job", j.status.ID)
+	userBkt := m.userBucket(j.userID)
+
+	j.status.State = StateRunning
+	j.status.UpdatedAt = time.Now()
+	if err := writeJobStatus(ctx, userBkt, j.status); err != nil {
+		level.Warn(logger).Log("msg", "failed to update export job status", "err", err)
+	}
+
+	level.Info(logger).Log("msg", "export job started")
+	start := time.Now()
+
+	object := jobDataPath(j.status.ID, j.status.Format)
+	err := m.export(user.InjectOrgID(ctx, j.userID), j.userID, userBkt, object, &j.status)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = errors.New("the querier has been shut down while running the job")
+		}
+		level.Warn(logger).Log("msg", "export job failed", "err", err)
+		m.failJob(j, err)
+		return
+	}
+
+	j.status.State = StateSucceeded
+	j.status.Object = object
+	j.status.UpdatedAt = time.Now()
+	if err := writeJobStatus(ctx, userBkt, j.status); err != nil {
+		level.Warn(logger).Log("msg", "failed to update export job status", "err", err)
+	}
+
+	m.jobsTotal.WithLabelValues(StateSucceeded).Inc()
+	level.Info(logger).Log("msg", "export job succeeded", "samples", j.status.Samples, "duration", time.Since(start))
+}
+
+// failJob marks the input job as failed. The status is updated even if the manager is stopping.
+func (m *Manager) failJob(j job, cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), updateStatusTimeout)
+	defer cancel()
+
+	j.status.State = StateFailed
+	j.status.Error = cause.Error()
+	j.status.UpdatedAt = time.Now()
+	if err := writeJobStatus(ctx, m.userBucket(j.userID), j.status); err != nil {
+		level.Warn(m.logger).Log("msg", "failed to update export job status", "user", j.userID, "job", j.status.ID, "err", err)
+	}
+
+	m.jobsTotal.WithLabelValues(StateFailed).Inc()
+}
+
+// failOrphanedJobs marks as failed the jobs which were pending or running in this querier before it has been
+// restarted, because they'll never complete.
+func (m *Manager) failOrphanedJobs(ctx context.Context) error {
+	userIDs, err := tsdb.ListUsers(ctx, m.bucket)
+	if err != nil {
+		return errors.Wrap(err, "list users")
+	}
+
+	return concurrency.ForEachUser(ctx, userIDs, orphanedJobsConcurrency, func(ctx context.Context, userID string) error {
+		statuses, err := listJobs(ctx, m.userBucket(userID))
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.Runner != m.instanceID || (status.State != StatePending && status.State != StateRunning) {
+				continue
+			}
+
+			level.Warn(m.logger).Log("msg", "marking orphaned export job as failed", "user", userID, "job", status.ID, "state", status.State)
+			m.failJob(job{userID: userID, status: status}, errors.New("the querier has been restarted while running the job"))
+		}
+		return nil
+	})
+}
+
+// export queries the series of the job, and uploads them to the input object. The time range of the job
+// is split into intervals, queried sequentially, so that the series of a single interval are loaded at a time.
+func (m *Manager) export(ctx context.Context, userID string, bkt objstore.Bucket, object string, status *JobStatus) error {
+	matchers := make([][]*labels.Matcher, 0, len(status.Selectors))
+	for _, s := range status.Selectors {
+		ms, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return errors.Wrapf(err, "parse selector %q", s)
+		}
+		matchers = append(matchers, ms)
+	}
+
+	// Each interval is queried like a query, so it can't be longer than the max partial query length.
+	splitInterval := m.cfg.SplitInterval
+	if maxQueryLength := m.limits.MaxPartialQueryLength(userID); maxQueryLength > 0 && maxQueryLength < splitInterval {
+		splitInterval = maxQueryLength
+	}
+
+	pr, pw := io.Pipe()
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		_ = pw.CloseWithError(m.writeCSV(ctx, pw, matchers, splitInterval, status))
+	}()
+
+	err := bkt.Upload(ctx, object, pr)
+	// Stop the writer, if the upload failed before the whole data has been read.
+	_ = pr.CloseWithError(err)
+	<-writerDone
+	return err
+}
+
+func (m *Manager) writeCSV(ctx context.Context, w io.Writer, matchers [][]*labels.Matcher, splitInterval time.Duration, status *JobStatus) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"series", "timestamp", "value"}); err != nil {
+		return err
+	}
+
+	for mint := status.Start; mint <= status.End; mint += splitInterval.Milliseconds() {
+		// The intervals don't overlap, so that each sample is exported once.
+		maxt := mint + splitInterval.Milliseconds() - 1
+		if maxt > status.End {
+			maxt = status.End
+		}
+
+		if err := m.writeIntervalCSV(ctx, cw, matchers, mint, maxt, status); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func (m *Manager) writeIntervalCSV(ctx context.Context, cw *csv.Writer, matchers [][]*labels.Matcher, mint, maxt int64, status *JobStatus) error {
+	q, err := m.queryable.Querier(ctx, mint, maxt)
+	if err != nil {
+		return errors.Wrap(err, "create querier")
+	}
+	defer func() { _ = q.Close() }()
+
+	hints := &storage.SelectHints{Start: mint, End: maxt}
+
+	// The series matching multiple selectors are exported once.
+	sets := make([]storage.SeriesSet, 0, len(matchers))
+	for _, ms := range matchers {
+		sets = append(sets, q.Select(len(matchers) > 1, hints, ms...))
+	}
+	set := sets[0]
+	if len(sets) > 1 {
+		set = storage.NewMergeSeriesSet(sets, storage.ChainedSeriesMerge)
+	}
+
+	var it chunkenc.Iterator
+	for set.Next() {
+		series := set.At()
+		seriesLabels := series.Labels().String()
+
+		it = series.Iterator(it)
+		for valType := it.Next(); valType != chunkenc.ValNone; valType = it.Next() {
+			// Only float samples are exported.
+			if valType != chunkenc.ValFloat {
+				continue
+			}
+
+			t, v := it.At()
+			if t < mint || t > maxt {
+				continue
+			}
+
+			if err := cw.Write([]string{seriesLabels, strconv.FormatInt(t, 10), strconv.FormatFloat(v, 'f', -1, 64)}); err != nil {
+				return err
+			}
+			status.Samples++
+			m.exportedSamples.Inc()
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+	}
+	if err := set.Err(); err != nil {
+		return err
+	}
+
+	// Flush the rows of each interval, so that the upload progresses.
+	cw.Flush()
+	return cw.Error()
+}
+
+func (m *Manager) userBucket(userID string) objstore.Bucket {
+	return bucket.NewUserBucketClient(userID, m.bucket, m.cfgProvider)
+}
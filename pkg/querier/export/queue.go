@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package export
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	errTooManyQueuedJobs = errors.New("too many export jobs queued, please retry later")
+	errQueueStopped      = errors.New("the export jobs can't be run at the moment")
+)
+
+// jobQueue is the queue of the export jobs waiting to be run. Each tenant has its own queue, with a limited
+// number of jobs, and the tenants are served round-robin so that a tenant can't starve the others.
+type jobQueue struct {
+	maxJobsPerTenant int
+
+	mtx     sync.Mutex
+	cond    *sync.Cond
+	stopped bool
+
+	// tenants is the round-robin order of the tenants with queued jobs.
+	tenants []string
+	jobs    map[string][]job
+}
+
+func newJobQueue(maxJobsPerTenant int) *jobQueue {
+	q := &jobQueue{
+		maxJobsPerTenant: maxJobsPerTenant,
+		jobs:             map[string][]job{},
+	}
+	q.cond = sync.NewCond(&q.mtx)
+	return q
+}
+
+// enqueue adds the input job to the queue of its tenant.
+func (q *jobQueue) enqueue(j job) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.stopped {
+		return errQueueStopped
+	}
+
+	jobs, ok := q.jobs[j.userID]
+	if len(jobs) >= q.maxJobsPerTenant {
+		return errTooManyQueuedJobs
+	}
+	if !ok {
+		q.tenants = append(q.tenants, j.userID)
+	}
+	q.jobs[j.userID] = append(jobs, j)
+
+	q.cond.Signal()
+	return nil
+}
+
+// dequeue waits until a job is queued, and returns the oldest job of the next tenant. It returns false once
+// the queue has been stopped.
+func (q *jobQueue) dequeue() (job, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	for len(q.tenants) == 0 && !q.stopped {
+		q.cond.Wait()
+	}
+	if q.stopped {
+		return job{}, false
+	}
+
+	userID := q.tenants[0]
+	q.tenants = q.tenants[1:]
+
+	jobs := q.jobs[userID]
+	if len(jobs) == 1 {
+		delete(q.jobs, userID)
+	} else {
+		q.jobs[userID] = jobs[1:]
+		q.tenants = append(q.tenants, userID)
+	}
+	return jobs[0], true
+}
+
+// stop stops the queue, and returns the jobs which were still queued.
+func (q *jobQueue) stop() []job {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.stopped = true
+	q.cond.Broadcast()
+
+	var queued []job
+	for _, userID := range q.tenants {
+		queued = append(queued, q.jobs[userID]...)
+	}
+	q.tenants = nil
+	q.jobs = map[string][]job{}
+	return queued
+}
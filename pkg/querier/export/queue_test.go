@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package export
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobQueue(t *testing.T) {
+	q := newJobQueue(2)
+
+	newJob := func(userID, jobID string) job {
+		return job{userID: userID, status: JobStatus{ID: jobID}}
+	}
+
+	require.NoError(t, q.enqueue(newJob("user-1", "1")))
+	require.NoError(t, q.enqueue(newJob("user-1", "2")))
+	require.NoError(t, q.enqueue(newJob("user-2", "3")))
+
+	// The limit is per tenant.
+	assert.ErrorIs(t, q.enqueue(newJob("user-1", "4")), errTooManyQueuedJobs)
+	require.NoError(t, q.enqueue(newJob("user-2", "5")))
+
+	// The tenants are served round-robin.
+	var dequeued []string
+	for i := 0; i < 3; i++ {
+		j, ok := q.dequeue()
+		require.True(t, ok)
+		dequeued = append(dequeued, j.status.ID)
+	}
+	assert.Equal(t, []string{"1", "3", "2"}, dequeued)
+
+	// The jobs still queued are returned when stopping, and no job can be queued or dequeued anymore.
+	assert.Equal(t, []job{newJob("user-2", "5")}, q.stop())
+	assert.ErrorIs(t, q.enqueue(newJob("user-1", "6")), errQueueStopped)
+	_, ok := q.dequeue()
+	assert.False(t, ok)
+}
+
+func TestJobQueue_ShouldUnblockDequeueOnStop(t *testing.T) {
+	q := newJobQueue(1)
+
+	done := make(chan bool)
+	go func() {
+		_, ok := q.dequeue()
+		done <- ok
+	}()
+
+	assert.Empty(t, q.stop())
+	assert.False(t, <-done)
+}
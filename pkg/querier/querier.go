@@ -26,9 +26,11 @@ import (
 
 	"github.com/grafana/mimir/pkg/querier/batch"
 	"github.com/grafana/mimir/pkg/querier/engine"
+	"github.com/grafana/mimir/pkg/querier/export"
 	"github.com/grafana/mimir/pkg/querier/iterators"
 	"github.com/grafana/mimir/pkg/storage/chunk"
 	"github.com/grafana/mimir/pkg/storage/lazyquery"
+	"github.com/grafana/mimir/pkg/storage/series"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/activitytracker"
 	"github.com/grafana/mimir/pkg/util/limiter"
@@ -52,6 +54,8 @@ type Config struct {
 
 	// PromQL engine config.
 	EngineConfig engine.Config `yaml:",inline"`
+
+	Export export.Config `yaml:"export"`
 }
 
 const (
@@ -75,6 +79,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.ShuffleShardingIngestersEnabled, "querier.shuffle-sharding-ingesters-enabled", true, fmt.Sprintf("Fetch in-memory series from the minimum set of required ingesters, selecting only ingesters which may have received series since -%s. If this setting is false or -%s is '0', queriers always query all ingesters (ingesters shuffle sharding on read path is disabled).", queryIngestersWithinFlag, queryIngestersWithinFlag))
 
 	cfg.EngineConfig.RegisterFlags(f)
+	cfg.Export.RegisterFlags(f)
 }
 
 // Validate the config
@@ -86,6 +91,10 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	if err := cfg.Export.Validate(); err != nil {
+		return fmt.Errorf("invalid export config: %w", err)
+	}
+
 	return nil
 }
 
@@ -170,7 +179,9 @@ func NewQueryable(distributor QueryableWithFilter, stores []QueryableWithFilter,
 			return nil, err
 		}
 
-		ctx = limiter.AddQueryLimiterToContext(ctx, limiter.NewQueryLimiter(limits.MaxFetchedSeriesPerQuery(userID), limits.MaxFetchedChunkBytesPerQuery(userID), limits.MaxChunksPerQuery(userID)))
+		queryLimiter := limiter.NewQueryLimiter(limits.MaxFetchedSeriesPerQuery(userID), limits.MaxFetchedChunkBytesPerQuery(userID), limits.MaxChunksPerQuery(userID)).
+			WithSoftLimits(limits.SoftMaxFetchedSeriesPerQuery(userID), limits.SoftMaxChunksPerQuery(userID))
+		ctx = limiter.AddQueryLimiterToContext(ctx, queryLimiter)
 
 		mint, maxt, err = validateQueryTimeRange(ctx, userID, mint, maxt, limits, cfg.MaxQueryIntoFuture, logger)
 		if errors.Is(err, errEmptyTimeRange) {
@@ -276,7 +287,7 @@ func (q querier) Select(_ bool, sp *storage.SelectHints, matchers ...*labels.Mat
 	}
 
 	if len(q.queriers) == 1 {
-		return q.queriers[0].Select(true, sp, matchers...)
+		return withSoftLimitsWarnings(ctx, q.queriers[0].Select(true, sp, matchers...), log)
 	}
 
 	sets := make(chan storage.SeriesSet, len(q.queriers))
@@ -299,7 +310,21 @@ func (q querier) Select(_ bool, sp *storage.SelectHints, matchers ...*labels.Mat
 	// we have all the sets from different sources (chunk from store, chunks from ingesters,
 	// time series from store and time series from ingesters).
 	// mergeSeriesSets will return sorted set.
-	return q.mergeSeriesSets(result)
+	return withSoftLimitsWarnings(ctx, q.mergeSeriesSets(result), log)
+}
+
+// withSoftLimitsWarnings attaches the warnings about the soft limits exceeded by the query so far to the input
+// series set. The series are fetched by the queriers when selected, so the limits have been checked at this point.
+func withSoftLimitsWarnings(ctx context.Context, set storage.SeriesSet, logger log.Logger) storage.SeriesSet {
+	warnings := limiter.QueryLimiterFromContextWithFallback(ctx).Warnings()
+	if len(warnings) == 0 {
+		return set
+	}
+
+	for _, warning := range warnings {
+		level.Warn(logger).Log("msg", "query exceeded a soft limit", "warning", warning)
+	}
+	return series.NewSeriesSetWithWarnings(set, warnings)
 }
 
 // LabelValues implements storage.Querier.
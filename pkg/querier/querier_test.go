@@ -29,6 +29,7 @@ import (
 	"github.com/grafana/mimir/pkg/ingester/client"
 	"github.com/grafana/mimir/pkg/mimirpb"
 	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/limiter"
 	"github.com/grafana/mimir/pkg/util/test"
 	"github.com/grafana/mimir/pkg/util/validation"
 )
@@ -310,6 +311,94 @@ func TestQuerier_QueryableReturnsChunksOutsideQueriedRange(t *testing.T) {
 	}, m[0].Points)
 }
 
+func TestQuerier_SoftLimits(t *testing.T) {
+	var (
+		logger     = log.NewNopLogger()
+		queryStart = mustParseTime("2021-11-01T06:00:00Z")
+		queryEnd   = mustParseTime("2021-11-01T06:05:00Z")
+		queryStep  = time.Minute
+	)
+
+	var cfg Config
+	flagext.DefaultValues(&cfg)
+	cfg.QueryIngestersWithin = 0 // Always query ingesters in this test.
+
+	newSeries := func(name string) client.TimeSeriesChunk {
+		return client.TimeSeriesChunk{
+			Labels: []mimirpb.LabelAdapter{{Name: labels.MetricName, Value: name}},
+			Chunks: convertToChunks(t, []interface{}{
+				mimirpb.Sample{TimestampMs: queryStart.Unix() * 1000, Value: 1},
+			}),
+		}
+	}
+
+	tests := map[string]struct {
+		softMaxSeries    int
+		softMaxChunks    int
+		expectedWarnings []string
+	}{
+		"no soft limits": {},
+		"soft limits not exceeded": {
+			softMaxSeries: 2,
+			softMaxChunks: 2,
+		},
+		"soft limit on series exceeded": {
+			softMaxSeries:    1,
+			expectedWarnings: []string{fmt.Sprintf(limiter.SoftMaxSeriesHitMsgFormat, 1)},
+		},
+		"soft limits on series and chunks exceeded": {
+			softMaxSeries: 1,
+			softMaxChunks: 1,
+			expectedWarnings: []string{
+				fmt.Sprintf(limiter.SoftMaxChunksPerQueryLimitMsgFormat, 1),
+				fmt.Sprintf(limiter.SoftMaxSeriesHitMsgFormat, 1),
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			res := &client.QueryStreamResponse{Chunkseries: []client.TimeSeriesChunk{newSeries("one"), newSeries("two")}}
+
+			// Mock the distributor to account the fetched series and chunks in the query limiter, like the real one.
+			distributor := &mockDistributor{}
+			distributor.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				queryLimiter := limiter.QueryLimiterFromContextWithFallback(args.Get(0).(context.Context))
+				require.NoError(t, queryLimiter.AddChunks(res.ChunksCount()))
+				for _, s := range res.Chunkseries {
+					require.NoError(t, queryLimiter.AddSeries(s.Labels))
+				}
+			}).Return(res, nil)
+
+			limits := defaultLimitsConfig()
+			limits.SoftMaxFetchedSeriesPerQuery = testData.softMaxSeries
+			limits.SoftMaxChunksPerQuery = testData.softMaxChunks
+			overrides, err := validation.NewOverrides(limits, nil)
+			require.NoError(t, err)
+
+			engine := promql.NewEngine(promql.EngineOpts{
+				Logger:     logger,
+				MaxSamples: 1e6,
+				Timeout:    1 * time.Minute,
+			})
+
+			queryable, _, _ := New(cfg, overrides, distributor, nil, nil, logger, nil)
+			query, err := engine.NewRangeQuery(queryable, nil, `sum({__name__=~".+"})`, queryStart, queryEnd, queryStep)
+			require.NoError(t, err)
+
+			// The query succeeds even if a soft limit has been exceeded.
+			r := query.Exec(user.InjectOrgID(context.Background(), "user-1"))
+			require.NoError(t, r.Err)
+
+			var warnings []string
+			for _, w := range r.Warnings {
+				warnings = append(warnings, w.Error())
+			}
+			assert.Equal(t, testData.expectedWarnings, warnings)
+		})
+	}
+}
+
 // TestBatchMergeChunks is a regression test to catch one particular case
 // when the Batch merger iterator was corrupting memory by not copying
 // Batches by value because the Batch itself was not possible to copy
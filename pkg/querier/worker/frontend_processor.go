@@ -36,6 +36,7 @@ func newFrontendProcessor(cfg Config, handler RequestHandler, log log.Logger) *f
 		handler:        handler,
 		maxMessageSize: cfg.GRPCClientConfig.MaxSendMsgSize,
 		querierID:      cfg.QuerierID,
+		callOptions:    responseCallOptions(cfg.ResponseCompression),
 
 		frontendClientFactory: func(conn *grpc.ClientConn) frontendv1pb.FrontendClient {
 			return frontendv1pb.NewFrontendClient(conn)
@@ -49,6 +50,9 @@ type frontendProcessor struct {
 	maxMessageSize int
 	querierID      string
 
+	// callOptions are the options of the stream sending the query results to the query-frontend.
+	callOptions []grpc.CallOption
+
 	log log.Logger
 
 	frontendClientFactory func(conn *grpc.ClientConn) frontendv1pb.FrontendClient
@@ -77,7 +81,7 @@ func (fp *frontendProcessor) processQueriesOnSingleStream(workerCtx context.Cont
 
 	backoff := backoff.New(execCtx, processorBackoffConfig)
 	for backoff.Ongoing() {
-		c, err := client.Process(execCtx)
+		c, err := client.Process(execCtx, fp.callOptions...)
 		if err != nil {
 			level.Error(fp.log).Log("msg", "error contacting frontend", "address", address, "err", err)
 			backoff.Wait()
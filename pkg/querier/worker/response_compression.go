@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package worker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/dskit/grpcencoding/snappy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+
+	"github.com/grafana/mimir/pkg/util/grpcencoding/zstd"
+)
+
+// Supported codecs of the query results sent to the query-frontends.
+const (
+	ResponseCompressionNone   = "none"
+	ResponseCompressionSnappy = snappy.Name
+	ResponseCompressionZstd   = zstd.Name
+)
+
+var supportedResponseCompressions = []string{ResponseCompressionNone, ResponseCompressionSnappy, ResponseCompressionZstd}
+
+func validateResponseCompression(compression string) error {
+	if compression == "" {
+		return nil
+	}
+	for _, supported := range supportedResponseCompressions {
+		if compression == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported response compression: %s (supported values: %s)", compression, strings.Join(supportedResponseCompressions, ", "))
+}
+
+// responseCallOptions returns the gRPC call options used to send the query results to the query-frontends
+// with the input compression. If the compression is empty, the query results are compressed like the other
+// messages sent to the query-frontends.
+func responseCallOptions(compression string) []grpc.CallOption {
+	switch compression {
+	case "":
+		return nil
+	case ResponseCompressionNone:
+		return []grpc.CallOption{grpc.UseCompressor(encoding.Identity)}
+	default:
+		return []grpc.CallOption{grpc.UseCompressor(compression)}
+	}
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package worker
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/stats"
+
+	"github.com/grafana/mimir/pkg/frontend/v2/frontendv2pb"
+)
+
+func TestResponseCallOptions(t *testing.T) {
+	for compression, expectedCompression := range map[string]string{
+		"":                        "snappy",
+		ResponseCompressionNone:   "none",
+		ResponseCompressionSnappy: "snappy",
+		ResponseCompressionZstd:   "zstd",
+	} {
+		t.Run(compression, func(t *testing.T) {
+			l, err := net.Listen("tcp", "localhost:0")
+			require.NoError(t, err)
+
+			// The query-frontend tracks the compression of the received query results.
+			received := atomic.NewString("")
+			server := grpc.NewServer(grpc.StatsHandler(&receivedCompressionHandler{compression: received}))
+			frontendv2pb.RegisterFrontendForQuerierServer(server, &frontendForQuerierMock{})
+			go func() { _ = server.Serve(l) }()
+			t.Cleanup(server.Stop)
+
+			// The other messages are compressed with snappy.
+			conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithDefaultCallOptions(grpc.UseCompressor("snappy")))
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = conn.Close() })
+
+			_, err = frontendv2pb.NewFrontendForQuerierClient(conn).QueryResult(context.Background(), &frontendv2pb.QueryResultRequest{
+				QueryID:      1,
+				HttpResponse: &httpgrpc.HTTPResponse{Code: 200, Body: []byte("query result")},
+			}, responseCallOptions(compression)...)
+			require.NoError(t, err)
+			assert.Equal(t, expectedCompression, received.Load())
+		})
+	}
+}
+
+type frontendForQuerierMock struct{}
+
+func (frontendForQuerierMock) QueryResult(context.Context, *frontendv2pb.QueryResultRequest) (*frontendv2pb.QueryResultResponse, error) {
+	return &frontendv2pb.QueryResultResponse{}, nil
+}
+
+type receivedCompressionHandler struct {
+	compression *atomic.String
+}
+
+func (h *receivedCompressionHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *receivedCompressionHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if s, ok := s.(*stats.InHeader); ok {
+		h.compression.Store(transportCompressionLabel(s.Compression))
+	}
+}
+
+func (h *receivedCompressionHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *receivedCompressionHandler) HandleConn(context.Context, stats.ConnStats) {}
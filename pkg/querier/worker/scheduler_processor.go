@@ -37,13 +37,15 @@ import (
 	util_log "github.com/grafana/mimir/pkg/util/log"
 )
 
-func newSchedulerProcessor(cfg Config, handler RequestHandler, log log.Logger, reg prometheus.Registerer) (*schedulerProcessor, []services.Service) {
+func newSchedulerProcessor(cfg Config, handler RequestHandler, transportStats *transportStatsHandler, log log.Logger, reg prometheus.Registerer) (*schedulerProcessor, []services.Service) {
 	p := &schedulerProcessor{
 		log:            log,
 		handler:        handler,
 		maxMessageSize: cfg.GRPCClientConfig.MaxSendMsgSize,
 		querierID:      cfg.QuerierID,
 		grpcConfig:     cfg.GRPCClientConfig,
+		transportStats: transportStats,
+		callOptions:    responseCallOptions(cfg.ResponseCompression),
 
 		schedulerClientFactory: func(conn *grpc.ClientConn) schedulerpb.SchedulerForQuerierClient {
 			return schedulerpb.NewSchedulerForQuerierClient(conn)
@@ -76,9 +78,13 @@ type schedulerProcessor struct {
 	log            log.Logger
 	handler        RequestHandler
 	grpcConfig     grpcclient.Config
+	transportStats *transportStatsHandler
 	maxMessageSize int
 	querierID      string
 
+	// callOptions are the options of the requests sending the query results to the query-frontends.
+	callOptions []grpc.CallOption
+
 	frontendPool                  *client.Pool
 	frontendClientRequestDuration *prometheus.HistogramVec
 
@@ -213,7 +219,7 @@ func (sp *schedulerProcessor) runRequest(ctx context.Context, logger log.Logger,
 			QueryID:      queryID,
 			HttpResponse: response,
 			Stats:        stats,
-		})
+		}, sp.callOptions...)
 	}
 	if err != nil {
 		level.Error(logger).Log("msg", "error notifying frontend about finished query", "err", err, "frontend", frontendAddress)
@@ -230,6 +236,9 @@ func (sp *schedulerProcessor) createFrontendClient(addr string) (client.PoolClie
 	if err != nil {
 		return nil, err
 	}
+	if sp.transportStats != nil {
+		opts = append(opts, grpc.WithStatsHandler(sp.transportStats))
+	}
 
 	conn, err := grpc.Dial(addr, opts...)
 	if err != nil {
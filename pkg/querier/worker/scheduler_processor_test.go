@@ -139,7 +139,7 @@ func prepareSchedulerProcessor() (*schedulerProcessor, *querierLoopClientMock, *
 
 	requestHandler := &requestHandlerMock{}
 
-	sp, _ := newSchedulerProcessor(Config{QuerierID: "test-querier-id"}, requestHandler, log.NewNopLogger(), nil)
+	sp, _ := newSchedulerProcessor(Config{QuerierID: "test-querier-id"}, requestHandler, nil, log.NewNopLogger(), nil)
 	sp.schedulerClientFactory = func(_ *grpc.ClientConn) schedulerpb.SchedulerForQuerierClient {
 		return schedulerClient
 	}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package worker
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/stats"
+)
+
+const (
+	transportDirectionSent     = "sent"
+	transportDirectionReceived = "received"
+
+	// transportCompressionNone is the compression label value used when compression is disabled.
+	transportCompressionNone = "none"
+)
+
+// transportStatsHandler is a gRPC stats.Handler tracking the throughput of the messages exchanged
+// with query-frontends and query-schedulers, both before and after compression, so that the
+// effectiveness of the configured compression can be observed. The compression of each RPC is
+// the one negotiated in its headers, since the query results may be sent with a different compression.
+type transportStatsHandler struct {
+	payloadBytes *prometheus.CounterVec
+	wireBytes    *prometheus.CounterVec
+}
+
+func newTransportStatsHandler(reg prometheus.Registerer) *transportStatsHandler {
+	return &transportStatsHandler{
+		payloadBytes: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_querier_frontend_transport_payload_bytes_total",
+			Help: "Total uncompressed size of the messages exchanged with query-frontends and query-schedulers.",
+		}, []string{"compression", "direction"}),
+		wireBytes: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_querier_frontend_transport_wire_bytes_total",
+			Help: "Total size on the wire, after compression, of the messages exchanged with query-frontends and query-schedulers.",
+		}, []string{"compression", "direction"}),
+	}
+}
+
+type rpcCompressionKey struct{}
+
+// rpcCompression is the compression of the messages sent and received by a single RPC. The messages
+// may be sent and received concurrently by a stream.
+type rpcCompression struct {
+	sent     *atomic.String
+	received *atomic.String
+}
+
+// TagRPC implements stats.Handler.
+func (h *transportStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, rpcCompressionKey{}, rpcCompression{
+		sent:     atomic.NewString(transportCompressionNone),
+		received: atomic.NewString(transportCompressionNone),
+	})
+}
+
+// HandleRPC implements stats.Handler.
+func (h *transportStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	compression, ok := ctx.Value(rpcCompressionKey{}).(rpcCompression)
+	if !ok {
+		return
+	}
+
+	switch s := s.(type) {
+	case *stats.OutHeader:
+		compression.sent.Store(transportCompressionLabel(s.Compression))
+	case *stats.InHeader:
+		compression.received.Store(transportCompressionLabel(s.Compression))
+	case *stats.OutPayload:
+		h.payloadBytes.WithLabelValues(compression.sent.Load(), transportDirectionSent).Add(float64(s.Length))
+		h.wireBytes.WithLabelValues(compression.sent.Load(), transportDirectionSent).Add(float64(s.WireLength))
+	case *stats.InPayload:
+		h.payloadBytes.WithLabelValues(compression.received.Load(), transportDirectionReceived).Add(float64(s.Length))
+		h.wireBytes.WithLabelValues(compression.received.Load(), transportDirectionReceived).Add(float64(s.WireLength))
+	}
+}
+
+// TagConn implements stats.Handler.
+func (h *transportStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn implements stats.Handler.
+func (h *transportStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+func transportCompressionLabel(compression string) string {
+	if compression == "" || compression == encoding.Identity {
+		return transportCompressionNone
+	}
+	return compression
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package worker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/stats"
+)
+
+func TestTransportStatsHandler(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	h := newTransportStatsHandler(reg)
+
+	// The query results are sent with zstd, while the responses are received uncompressed.
+	ctx := h.TagRPC(context.Background(), &stats.RPCTagInfo{FullMethodName: "/frontendv2pb.FrontendForQuerier/QueryResult"})
+	h.HandleRPC(ctx, &stats.OutHeader{Client: true, Compression: "zstd"})
+	h.HandleRPC(ctx, &stats.OutPayload{Length: 1000, WireLength: 400})
+	h.HandleRPC(ctx, &stats.OutPayload{Length: 500, WireLength: 200})
+	h.HandleRPC(ctx, &stats.InHeader{Client: true, Compression: "identity"})
+	h.HandleRPC(ctx, &stats.InPayload{Length: 30, WireLength: 30})
+	h.HandleRPC(ctx, &stats.End{})
+
+	// The messages of another RPC are compressed with snappy.
+	ctx = h.TagRPC(context.Background(), &stats.RPCTagInfo{FullMethodName: "/schedulerpb.SchedulerForQuerier/QuerierLoop"})
+	h.HandleRPC(ctx, &stats.OutHeader{Client: true, Compression: "snappy"})
+	h.HandleRPC(ctx, &stats.OutPayload{Length: 100, WireLength: 80})
+	h.HandleRPC(ctx, &stats.InHeader{Client: true, Compression: "snappy"})
+	h.HandleRPC(ctx, &stats.InPayload{Length: 300, WireLength: 100})
+
+	// The stats of untagged RPCs are ignored.
+	h.HandleRPC(context.Background(), &stats.OutPayload{Length: 100, WireLength: 100})
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_querier_frontend_transport_payload_bytes_total Total uncompressed size of the messages exchanged with query-frontends and query-schedulers.
+		# TYPE cortex_querier_frontend_transport_payload_bytes_total counter
+		cortex_querier_frontend_transport_payload_bytes_total{compression="none",direction="received"} 30
+		cortex_querier_frontend_transport_payload_bytes_total{compression="snappy",direction="received"} 300
+		cortex_querier_frontend_transport_payload_bytes_total{compression="snappy",direction="sent"} 100
+		cortex_querier_frontend_transport_payload_bytes_total{compression="zstd",direction="sent"} 1500
+
+		# HELP cortex_querier_frontend_transport_wire_bytes_total Total size on the wire, after compression, of the messages exchanged with query-frontends and query-schedulers.
+		# TYPE cortex_querier_frontend_transport_wire_bytes_total counter
+		cortex_querier_frontend_transport_wire_bytes_total{compression="none",direction="received"} 30
+		cortex_querier_frontend_transport_wire_bytes_total{compression="snappy",direction="received"} 100
+		cortex_querier_frontend_transport_wire_bytes_total{compression="snappy",direction="sent"} 80
+		cortex_querier_frontend_transport_wire_bytes_total{compression="zstd",direction="sent"} 600
+	`), "cortex_querier_frontend_transport_payload_bytes_total", "cortex_querier_frontend_transport_wire_bytes_total"))
+}
@@ -9,6 +9,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"strings"
 	"os"
 	"sync"
 	"time"
@@ -33,6 +34,8 @@ type Config struct {
 	QuerierID        string            `yaml:"id" category:"advanced"`
 	GRPCClientConfig grpcclient.Config `yaml:"grpc_client_config" doc:"description=Configures the gRPC client used to communicate between the queriers and the query-frontends / query-schedulers."`
 
+	ResponseCompression string `yaml:"response_compression" category:"experimental"`
+
 	// This configuration is injected internally.
 	MaxConcurrentRequests   int                       `yaml:"-"` // Must be same as passed to PromQL Engine.
 	QuerySchedulerDiscovery schedulerdiscovery.Config `yaml:"-"`
@@ -45,6 +48,8 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&cfg.QuerierID, "querier.id", "", "Querier ID, sent to the query-frontend to identify requests from the same querier. Defaults to hostname.")
 
 	cfg.GRPCClientConfig.RegisterFlagsWithPrefix("querier.frontend-client", f)
+
+	f.StringVar(&cfg.ResponseCompression, "querier.response-compression", "", fmt.Sprintf("Compression of the query results sent by the querier to the query-frontend. Supported values are: %s. If empty, the query results are compressed with the compression configured by -querier.frontend-client.grpc-compression.", strings.Join(supportedResponseCompressions, ", ")))
 }
 
 func (cfg *Config) Validate(log log.Logger) error {
@@ -55,6 +60,10 @@ func (cfg *Config) Validate(log log.Logger) error {
 		return fmt.Errorf("frontend address and scheduler address cannot be specified when query-scheduler service discovery mode is set to '%s'", cfg.QuerySchedulerDiscovery.Mode)
 	}
 
+	if err := validateResponseCompression(cfg.ResponseCompression); err != nil {
+		return err
+	}
+
 	return cfg.GRPCClientConfig.Validate(log)
 }
 
@@ -94,6 +103,10 @@ type querierWorker struct {
 
 	processor processor
 
+	// Tracks the throughput of the messages exchanged with query-frontends and query-schedulers.
+	// It may be nil in tests.
+	transportStats *transportStatsHandler
+
 	// Subservices manager.
 	subservices        *services.Manager
 	subservicesWatcher *services.FailureWatcher
@@ -116,6 +129,8 @@ func NewQuerierWorker(cfg Config, handler RequestHandler, log log.Logger, reg pr
 	var servs []services.Service
 	var factory serviceDiscoveryFactory
 
+	transportStats := newTransportStatsHandler(reg)
+
 	switch {
 	case cfg.SchedulerAddress != "" || cfg.QuerySchedulerDiscovery.Mode == schedulerdiscovery.ModeRing:
 		level.Info(log).Log("msg", "Starting querier worker connected to query-scheduler", "scheduler", cfg.SchedulerAddress)
@@ -124,7 +139,7 @@ func NewQuerierWorker(cfg Config, handler RequestHandler, log log.Logger, reg pr
 			return schedulerdiscovery.New(cfg.QuerySchedulerDiscovery, cfg.SchedulerAddress, cfg.DNSLookupPeriod, "querier", receiver, log, reg)
 		}
 
-		processor, servs = newSchedulerProcessor(cfg, handler, log, reg)
+		processor, servs = newSchedulerProcessor(cfg, handler, transportStats, log, reg)
 
 	case cfg.FrontendAddress != "":
 		level.Info(log).Log("msg", "Starting querier worker connected to query-frontend", "frontend", cfg.FrontendAddress)
@@ -139,7 +154,13 @@ func NewQuerierWorker(cfg Config, handler RequestHandler, log log.Logger, reg pr
 		return nil, errors.New("no query-scheduler or query-frontend address")
 	}
 
-	return newQuerierWorkerWithProcessor(cfg, log, processor, factory, servs)
+	w, err := newQuerierWorkerWithProcessor(cfg, log, processor, factory, servs)
+	if err != nil {
+		return nil, err
+	}
+
+	w.transportStats = transportStats
+	return w, nil
 }
 
 func newQuerierWorkerWithProcessor(cfg Config, log log.Logger, processor processor, newServiceDiscovery serviceDiscoveryFactory, servs []services.Service) (*querierWorker, error) {
@@ -364,6 +385,9 @@ func (w *querierWorker) connect(ctx context.Context, address string) (*grpc.Clie
 	if err != nil {
 		return nil, err
 	}
+	if w.transportStats != nil {
+		opts = append(opts, grpc.WithStatsHandler(w.transportStats))
+	}
 
 	conn, err := grpc.DialContext(ctx, address, opts...)
 	if err != nil {
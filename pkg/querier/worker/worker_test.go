@@ -67,6 +67,17 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expectedErr: `frontend address and scheduler address cannot be specified when query-scheduler service discovery mode is set to 'ring'`,
 		},
+		"should pass if response compression is set to a supported codec": {
+			setup: func(cfg *Config) {
+				cfg.ResponseCompression = ResponseCompressionZstd
+			},
+		},
+		"should fail if response compression is set to an unsupported codec": {
+			setup: func(cfg *Config) {
+				cfg.ResponseCompression = "gzip"
+			},
+			expectedErr: "unsupported response compression: gzip",
+		},
 	}
 
 	for testName, testData := range tests {
@@ -48,10 +48,11 @@ type PusherAppender struct {
 	histogramLabels []labels.Labels
 	histograms      []mimirpb.Histogram
 	userID          string
+	externalLabels  labels.Labels
 }
 
 func (a *PusherAppender) Append(_ storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
-	a.labels = append(a.labels, l)
+	a.labels = append(a.labels, addExternalLabels(l, a.externalLabels))
 	a.samples = append(a.samples, mimirpb.Sample{
 		TimestampMs: t,
 		Value:       v,
@@ -68,7 +69,7 @@ func (a *PusherAppender) UpdateMetadata(_ storage.SeriesRef, _ labels.Labels, _
 }
 
 func (a *PusherAppender) AppendHistogram(_ storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram) (storage.SeriesRef, error) {
-	a.histogramLabels = append(a.histogramLabels, l)
+	a.histogramLabels = append(a.histogramLabels, addExternalLabels(l, a.externalLabels))
 	var hp mimirpb.Histogram
 	if h != nil {
 		hp = mimirpb.FromHistogramToHistogramProto(t, h)
@@ -110,6 +111,7 @@ func (a *PusherAppender) Rollback() error {
 type PusherAppendable struct {
 	pusher Pusher
 	userID string
+	limits RulesLimits
 
 	totalWrites  prometheus.Counter
 	failedWrites prometheus.Counter
@@ -119,6 +121,7 @@ func NewPusherAppendable(pusher Pusher, userID string, limits RulesLimits, total
 	return &PusherAppendable{
 		pusher:       pusher,
 		userID:       userID,
+		limits:       limits,
 		totalWrites:  totalWrites,
 		failedWrites: failedWrites,
 	}
@@ -126,16 +129,56 @@ func NewPusherAppendable(pusher Pusher, userID string, limits RulesLimits, total
 
 // Appender returns a storage.Appender
 func (t *PusherAppendable) Appender(ctx context.Context) storage.Appender {
+	var externalLabels labels.Labels
+	if t.limits != nil {
+		externalLabels = t.limits.RulerExternalLabels(t.userID)
+	}
+
 	return &PusherAppender{
 		failedWrites: t.failedWrites,
 		totalWrites:  t.totalWrites,
 
-		ctx:    ctx,
-		pusher: t.pusher,
-		userID: t.userID,
+		ctx:            ctx,
+		pusher:         t.pusher,
+		userID:         t.userID,
+		externalLabels: externalLabels,
 	}
 }
 
+// externalLabelsSender is a rules.Sender adding the tenant's external labels to the alerts
+// before sending them.
+type externalLabelsSender struct {
+	next   rules.Sender
+	userID string
+	limits RulesLimits
+}
+
+func (s *externalLabelsSender) Send(alerts ...*notifier.Alert) {
+	externalLabels := s.limits.RulerExternalLabels(s.userID)
+	if !externalLabels.IsEmpty() {
+		for _, a := range alerts {
+			a.Labels = addExternalLabels(a.Labels, externalLabels)
+		}
+	}
+	s.next.Send(alerts...)
+}
+
+// addExternalLabels returns the input labels with the external labels added. Like in Prometheus,
+// an external label is not added if the input labels already have a label with the same name.
+func addExternalLabels(lbls, externalLabels labels.Labels) labels.Labels {
+	if externalLabels.IsEmpty() {
+		return lbls
+	}
+
+	b := labels.NewBuilder(lbls)
+	externalLabels.Range(func(l labels.Label) {
+		if lbls.Get(l.Name) == "" {
+			b.Set(l.Name, l.Value)
+		}
+	})
+	return b.Labels(nil)
+}
+
 // RulesLimits defines limits used by Ruler.
 type RulesLimits interface {
 	EvaluationDelay(userID string) time.Duration
@@ -144,6 +187,7 @@ type RulesLimits interface {
 	RulerMaxRulesPerRuleGroup(userID string) int
 	RulerRecordingRulesEvaluationEnabled(userID string) bool
 	RulerAlertingRulesEvaluationEnabled(userID string) bool
+	RulerExternalLabels(userID string) labels.Labels
 }
 
 func MetricsQueryFunc(qf rules.QueryFunc, queries, failedQueries prometheus.Counter) rules.QueryFunc {
@@ -294,7 +338,7 @@ func DefaultTenantManagerFactory(
 			Context:                    user.InjectOrgID(ctx, userID),
 			GroupEvaluationContextFunc: FederatedGroupContextFunc,
 			ExternalURL:                cfg.ExternalURL.URL,
-			NotifyFunc:                 rules.SendAlerts(notifier, cfg.ExternalURL.String()),
+			NotifyFunc:                 rules.SendAlerts(&externalLabelsSender{next: notifier, userID: userID, limits: overrides}, cfg.ExternalURL.String()),
 			Logger:                     log.With(logger, "user", userID),
 			Registerer:                 reg,
 			OutageTolerance:            cfg.OutageTolerance,
@@ -263,6 +263,51 @@ func TestPusherErrors(t *testing.T) {
 	}
 }
 
+func TestPusherAppendable_ExternalLabels(t *testing.T) {
+	pusher := &fakePusher{response: &mimirpb.WriteResponse{}}
+	limits := validation.MockOverrides(func(_ *validation.Limits, tenantLimits map[string]*validation.Limits) {
+		tenantLimits["user-1"] = validation.MockDefaultLimits()
+		tenantLimits["user-1"].RulerExternalLabels = map[string]string{"cluster": "eu", "env": "prod"}
+	})
+	pa := NewPusherAppendable(pusher, "user-1", limits, promauto.With(nil).NewCounter(prometheus.CounterOpts{}), promauto.With(nil).NewCounter(prometheus.CounterOpts{}))
+
+	a := pa.Appender(context.Background())
+	_, err := a.Append(0, labels.FromStrings(labels.MetricName, "foo_bar", "env", "dev"), 1000, 1)
+	require.NoError(t, err)
+	require.NoError(t, a.Commit())
+
+	// The existing labels are not overridden by the external labels.
+	require.Len(t, pusher.request.Timeseries, 1)
+	require.Equal(t, labels.FromStrings(labels.MetricName, "foo_bar", "cluster", "eu", "env", "dev"), mimirpb.FromLabelAdaptersToLabels(pusher.request.Timeseries[0].Labels))
+}
+
+type alertsSenderMock struct {
+	alerts []*notifier.Alert
+}
+
+func (s *alertsSenderMock) Send(alerts ...*notifier.Alert) {
+	s.alerts = append(s.alerts, alerts...)
+}
+
+func TestExternalLabelsSender(t *testing.T) {
+	limits := validation.MockOverrides(func(_ *validation.Limits, tenantLimits map[string]*validation.Limits) {
+		tenantLimits["user-1"] = validation.MockDefaultLimits()
+		tenantLimits["user-1"].RulerExternalLabels = map[string]string{"cluster": "eu", "env": "prod"}
+	})
+
+	for userID, expected := range map[string]labels.Labels{
+		"user-1": labels.FromStrings(labels.AlertName, "test", "cluster", "eu", "env", "dev"),
+		"user-2": labels.FromStrings(labels.AlertName, "test", "env", "dev"),
+	} {
+		next := &alertsSenderMock{}
+		sender := &externalLabelsSender{next: next, userID: userID, limits: limits}
+		sender.Send(&notifier.Alert{Labels: labels.FromStrings(labels.AlertName, "test", "env", "dev")})
+
+		require.Len(t, next.alerts, 1)
+		require.Equal(t, expected, next.alerts[0].Labels, userID)
+	}
+}
+
 func TestMetricsQueryFuncErrors(t *testing.T) {
 	for name, tc := range map[string]struct {
 		returnedError         error
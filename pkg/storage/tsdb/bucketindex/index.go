@@ -24,7 +24,7 @@ const (
 	IndexFilename           = "bucket-index.json"
 	IndexCompressedFilename = IndexFilename + ".gz"
 	IndexVersion1           = 1
-	IndexVersion2           = 2 // Added CompactorShardID field.
+	IndexVersion2           = 2 // Added CompactorShardID field. The optional SizeBytes and CompactionLevel fields have been added later.
 	SegmentsFormatUnknown   = ""
 
 	// SegmentsFormat1Based6Digits defined segments numbered with 6 digits numbers in a sequence starting from number 1
@@ -91,6 +91,15 @@ type Block struct {
 
 	// Block's compactor shard ID, copied from tsdb.CompactorShardIDExternalLabel label.
 	CompactorShardID string `json:"compactor_shard_id,omitempty"`
+
+	// SizeBytes is the total size of the block files, if known from the meta.json. 0 if unknown.
+	// This field is optional, so that the index can still be read and updated by the versions
+	// which don't know it.
+	SizeBytes int64 `json:"size_bytes,omitempty"`
+
+	// CompactionLevel is the compaction level of the block, copied from the meta.json. 0 if the block
+	// has been indexed by a version which doesn't know this optional field.
+	CompactionLevel int `json:"compaction_level,omitempty"`
 }
 
 // Within returns whether the block contains samples within the provided range.
@@ -147,6 +156,11 @@ func (m *Block) String() string {
 func BlockFromThanosMeta(meta metadata.Meta) *Block {
 	segmentsFormat, segmentsNum := detectBlockSegmentsFormat(meta)
 
+	var sizeBytes int64
+	for _, f := range meta.Thanos.Files {
+		sizeBytes += f.SizeBytes
+	}
+
 	return &Block{
 		ID:               meta.ULID,
 		MinTime:          meta.MinTime,
@@ -154,6 +168,8 @@ func BlockFromThanosMeta(meta metadata.Meta) *Block {
 		SegmentsFormat:   segmentsFormat,
 		SegmentsNum:      segmentsNum,
 		CompactorShardID: meta.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel],
+		SizeBytes:        sizeBytes,
+		CompactionLevel:  meta.Compaction.Level,
 	}
 }
 
@@ -91,7 +91,12 @@ func (w *Updater) updateBlocks(ctx context.Context, old []*Block) (blocks []*Blo
 	}
 
 	// Since blocks are immutable, all blocks already existing in the index can just be copied.
+	// The blocks indexed before the optional fields were added to the index have no compaction
+	// level, so their meta.json is fetched again, like for the new blocks, to fill them in.
 	for _, b := range old {
+		if b.CompactionLevel == 0 {
+			continue
+		}
 		if _, ok := discovered[b.ID]; ok {
 			blocks = append(blocks, b)
 			delete(discovered, b.ID)
@@ -229,6 +229,35 @@ func TestUpdater_UpdateIndexFromVersion1ToVersion2(t *testing.T) {
 		[]*metadata.DeletionMark{})
 }
 
+func TestUpdater_UpdateIndex_ShouldFillInTheOptionalFieldsOfTheBlocksIndexedWithoutThem(t *testing.T) {
+	const userID = "user-1"
+
+	bkt, _ := testutil.PrepareFilesystemBucket(t)
+
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	bkt = BucketWithGlobalMarkers(bkt)
+	block1 := testutil.MockStorageBlockWithExtLabels(t, bkt, userID, 10, 20, nil)
+	block2 := testutil.MockStorageBlockWithExtLabels(t, bkt, userID, 20, 30, nil)
+
+	w := NewUpdater(bkt, userID, nil, logger)
+	returnedIdx, _, err := w.UpdateIndex(ctx, nil)
+	require.NoError(t, err)
+
+	// Simulate an index written by a version which doesn't know the optional fields. The index
+	// is still read with the same version, and it's updated in place.
+	for _, b := range returnedIdx.Blocks {
+		b.CompactionLevel = 0
+	}
+
+	returnedIdx, _, err = w.UpdateIndex(ctx, returnedIdx)
+	require.NoError(t, err)
+	assertBucketIndexEqual(t, returnedIdx, bkt, userID,
+		[]metadata.Meta{block1, block2},
+		[]*metadata.DeletionMark{})
+}
+
 func getBlockUploadedAt(t testing.TB, bkt objstore.Bucket, userID string, blockID ulid.ULID) int64 {
 	metaFile := path.Join(userID, blockID.String(), block.MetaFilename)
 
@@ -251,6 +280,7 @@ func assertBucketIndexEqual(t testing.TB, idx *Index, bkt objstore.Bucket, userI
 			MaxTime:          b.MaxTime,
 			UploadedAt:       getBlockUploadedAt(t, bkt, userID, b.ULID),
 			CompactorShardID: b.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel],
+			CompactionLevel:  b.Compaction.Level,
 		})
 	}
 
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucketindex
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/concurrency"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+// readUsageConcurrency is the number of bucket indexes read concurrently by ReadUsages.
+const readUsageConcurrency = 16
+
+// Usage is the storage usage summary of a tenant, computed from its bucket index.
+type Usage struct {
+	TenantID string `json:"tenant_id"`
+
+	// Blocks is the number of complete blocks in the bucket, including the blocks marked for deletion.
+	Blocks                  int `json:"blocks"`
+	BlocksMarkedForDeletion int `json:"blocks_marked_for_deletion"`
+
+	// SizeBytes is the total size of the blocks in the bucket. The size of the blocks indexed
+	// before the bucket index tracked it is unknown until the compactor fills it in, and so not accounted.
+	SizeBytes int64 `json:"size_bytes"`
+
+	// OldestBlockMinTime and NewestBlockMaxTime are the time range covered by the blocks (millis precision).
+	// Both are 0 if there are no blocks.
+	OldestBlockMinTime int64 `json:"oldest_block_min_time"`
+	NewestBlockMaxTime int64 `json:"newest_block_max_time"`
+
+	// CompactionLevels is the number of blocks by compaction level. Level 0 holds the blocks
+	// whose compaction level is unknown, because indexed before the bucket index tracked it
+	// and not filled in by the compactor yet.
+	CompactionLevels map[int]int `json:"compaction_levels"`
+
+	// UpdatedAt is a unix timestamp (seconds precision) of when the bucket index has been updated.
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// Usage returns the storage usage summary of the input tenant, computed from the index.
+func (idx *Index) Usage(userID string) Usage {
+	u := Usage{
+		TenantID:                userID,
+		Blocks:                  len(idx.Blocks),
+		BlocksMarkedForDeletion: len(idx.BlockDeletionMarks),
+		CompactionLevels:        map[int]int{},
+		UpdatedAt:               idx.UpdatedAt,
+	}
+
+	for i, b := range idx.Blocks {
+		if i == 0 || b.MinTime < u.OldestBlockMinTime {
+			u.OldestBlockMinTime = b.MinTime
+		}
+		if i == 0 || b.MaxTime > u.NewestBlockMaxTime {
+			u.NewestBlockMaxTime = b.MaxTime
+		}
+		u.SizeBytes += b.SizeBytes
+		u.CompactionLevels[b.CompactionLevel]++
+	}
+
+	return u
+}
+
+// ReadUsages reads the bucket index of each input tenant, and returns their storage usage summary sorted
+// by tenant ID. Tenants without a bucket index, because not created yet, are skipped.
+func ReadUsages(ctx context.Context, bkt objstore.Bucket, userIDs []string, cfgProvider bucket.TenantConfigProvider, logger log.Logger) ([]Usage, error) {
+	var (
+		mtx    sync.Mutex
+		usages = make([]Usage, 0, len(userIDs))
+	)
+
+	err := concurrency.ForEachJob(ctx, len(userIDs), readUsageConcurrency, func(ctx context.Context, idx int) error {
+		userID := userIDs[idx]
+
+		index, err := ReadIndex(ctx, bkt, userID, cfgProvider, logger)
+		if errors.Is(err, ErrIndexNotFound) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "read bucket index of tenant %s", userID)
+		}
+
+		mtx.Lock()
+		usages = append(usages, index.Usage(userID))
+		mtx.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].TenantID < usages[j].TenantID
+	})
+	return usages, nil
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucketindex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mimir_testutil "github.com/grafana/mimir/pkg/storage/tsdb/testutil"
+)
+
+func TestIndex_Usage(t *testing.T) {
+	t.Run("empty index", func(t *testing.T) {
+		idx := &Index{Version: IndexVersion2, UpdatedAt: 100}
+
+		assert.Equal(t, Usage{
+			TenantID:         "user-1",
+			CompactionLevels: map[int]int{},
+			UpdatedAt:        100,
+		}, idx.Usage("user-1"))
+	})
+
+	t.Run("index with blocks", func(t *testing.T) {
+		idx := &Index{
+			Version: IndexVersion2,
+			Blocks: []*Block{
+				{ID: ulid.MustNew(1, nil), MinTime: 20, MaxTime: 30, SizeBytes: 100, CompactionLevel: 1},
+				{ID: ulid.MustNew(2, nil), MinTime: 10, MaxTime: 20, SizeBytes: 200, CompactionLevel: 2},
+				{ID: ulid.MustNew(3, nil), MinTime: 30, MaxTime: 40, SizeBytes: 300, CompactionLevel: 2},
+				// Indexed before the bucket index tracked the size and compaction level.
+				{ID: ulid.MustNew(4, nil), MinTime: 15, MaxTime: 25},
+			},
+			BlockDeletionMarks: []*BlockDeletionMark{{ID: ulid.MustNew(2, nil)}},
+			UpdatedAt:          100,
+		}
+
+		assert.Equal(t, Usage{
+			TenantID:                "user-1",
+			Blocks:                  4,
+			BlocksMarkedForDeletion: 1,
+			SizeBytes:               600,
+			OldestBlockMinTime:      10,
+			NewestBlockMaxTime:      40,
+			CompactionLevels:        map[int]int{0: 1, 1: 1, 2: 2},
+			UpdatedAt:               100,
+		}, idx.Usage("user-1"))
+	})
+}
+
+func TestReadUsages(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	bkt, _ := mimir_testutil.PrepareFilesystemBucket(t)
+	bkt = BucketWithGlobalMarkers(bkt)
+
+	for _, userID := range []string{"user-2", "user-1"} {
+		mimir_testutil.MockStorageBlock(t, bkt, userID, 10, 20)
+		mimir_testutil.MockStorageBlock(t, bkt, userID, 20, 30)
+
+		idx, _, err := NewUpdater(bkt, userID, nil, logger).UpdateIndex(ctx, nil)
+		require.NoError(t, err)
+		require.NoError(t, WriteIndex(ctx, bkt, userID, nil, idx))
+	}
+
+	// A tenant whose bucket index has not been created yet.
+	mimir_testutil.MockStorageBlock(t, bkt, "user-3", 10, 20)
+
+	usages, err := ReadUsages(ctx, bkt, []string{"user-1", "user-2", "user-3"}, nil, logger)
+	require.NoError(t, err)
+	require.Len(t, usages, 2)
+
+	for i, userID := range []string{"user-1", "user-2"} {
+		assert.Equal(t, userID, usages[i].TenantID)
+		assert.Equal(t, 2, usages[i].Blocks)
+		assert.Equal(t, int64(10), usages[i].OldestBlockMinTime)
+		assert.Equal(t, int64(30), usages[i].NewestBlockMaxTime)
+	}
+}
@@ -8,10 +8,12 @@ package tsdb
 import (
 	"flag"
 	"fmt"
+	"math"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/go-kit/log"
 	"github.com/golang/snappy"
 	"github.com/grafana/dskit/cache"
@@ -28,6 +30,8 @@ import (
 	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
 )
 
+var errInvalidChunksDiskCacheMaxSizeBytes = errors.New("invalid chunks disk cache max size bytes, it must be greater than 0")
+
 // subrangeSize is the size of each subrange that bucket objects are split into for better caching
 const subrangeSize int64 = 16000
 
@@ -41,6 +45,8 @@ type ChunksCacheConfig struct {
 	AttributesInMemoryMaxItems      int           `yaml:"attributes_in_memory_max_items" category:"advanced"`
 	SubrangeTTL                     time.Duration `yaml:"subrange_ttl" category:"advanced"`
 	FineGrainedChunksCachingEnabled bool          `yaml:"fine_grained_chunks_caching_enabled" category:"experimental"`
+
+	Disk ChunksDiskCacheConfig `yaml:"disk"`
 }
 
 func (cfg *ChunksCacheConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix string, logger log.Logger) {
@@ -56,12 +62,39 @@ func (cfg *ChunksCacheConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix st
 	f.IntVar(&cfg.AttributesInMemoryMaxItems, prefix+"attributes-in-memory-max-items", 50000, "Maximum number of object attribute items to keep in a first level in-memory LRU cache. Metadata will be stored and fetched in-memory before hitting the cache backend. 0 to disable the in-memory cache.")
 	f.DurationVar(&cfg.SubrangeTTL, prefix+"subrange-ttl", 24*time.Hour, "TTL for caching individual chunks subranges.")
 	f.BoolVar(&cfg.FineGrainedChunksCachingEnabled, prefix+"fine-grained-chunks-caching-enabled", false, "Enable fine-grained caching of chunks in the store-gateway. This reduces the required bandwidth and memory utilization.")
+
+	cfg.Disk.RegisterFlagsWithPrefix(f, prefix+"disk.")
 }
 
 func (cfg *ChunksCacheConfig) Validate() error {
+	if err := cfg.Disk.Validate(); err != nil {
+		return errors.Wrap(err, "disk")
+	}
 	return cfg.BackendConfig.Validate()
 }
 
+// ChunksDiskCacheConfig holds the config options of the local disk tier of the chunks cache.
+type ChunksDiskCacheConfig struct {
+	Directory    string `yaml:"directory" category:"experimental"`
+	MaxSizeBytes uint64 `yaml:"max_size_bytes" category:"experimental"`
+}
+
+func (cfg *ChunksDiskCacheConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix string) {
+	f.StringVar(&cfg.Directory, prefix+"directory", "", "Directory on the local disk of the store-gateway where to cache the chunks, in addition to the chunks cache backend, if any. Chunks missing from the chunks cache backend are looked up on the local disk before being fetched from the object storage. Empty to disable the local disk tier.")
+	f.Uint64Var(&cfg.MaxSizeBytes, prefix+"max-size-bytes", uint64(10*units.Gibibyte), "Maximum size in bytes of the chunks cached on the local disk. The least recently used chunks are evicted once the limit is exceeded.")
+}
+
+func (cfg *ChunksDiskCacheConfig) Enabled() bool {
+	return cfg.Directory != ""
+}
+
+func (cfg *ChunksDiskCacheConfig) Validate() error {
+	if cfg.Enabled() && (cfg.MaxSizeBytes == 0 || cfg.MaxSizeBytes > math.MaxInt64) {
+		return errInvalidChunksDiskCacheMaxSizeBytes
+	}
+	return nil
+}
+
 type MetadataCacheConfig struct {
 	cache.BackendConfig `yaml:",inline"`
 
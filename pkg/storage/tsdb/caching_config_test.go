@@ -39,3 +39,14 @@ func TestIsBlockIndexFile(t *testing.T) {
 	assert.True(t, isBlockIndexFile(fmt.Sprintf("%s/index", blockID.String())))
 	assert.True(t, isBlockIndexFile(fmt.Sprintf("/%s/index", blockID.String())))
 }
+
+func TestChunksDiskCacheConfig_Validate(t *testing.T) {
+	cfg := ChunksDiskCacheConfig{}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Directory = "/data/chunks-cache"
+	assert.Equal(t, errInvalidChunksDiskCacheMaxSizeBytes, cfg.Validate())
+
+	cfg.MaxSizeBytes = 1024
+	assert.NoError(t, cfg.Validate())
+}
@@ -95,6 +95,8 @@ var (
 	errInvalidStripeSize            = errors.New("invalid TSDB stripe size")
 	errInvalidStreamingBatchSize    = errors.New("invalid store-gateway streaming batch size")
 	errEmptyBlockranges             = errors.New("empty block ranges for TSDB")
+
+	errInvalidPostingsCacheWarmingMaxSelectors = errors.New("invalid postings cache warming max selectors, it must be greater than 0")
 )
 
 // BlocksStorageConfig holds the config information for the blocks storage.
@@ -357,6 +359,9 @@ type BucketStoreConfig struct {
 
 	StreamingBatchSize   int `yaml:"streaming_series_batch_size" category:"advanced"`
 	ChunkRangesPerSeries int `yaml:"fine_grained_chunks_caching_ranges_per_series" category:"experimental"`
+
+	// Controls experimental warming of the postings caches for newly loaded blocks.
+	PostingsCacheWarming PostingsCacheWarmingConfig `yaml:"postings_cache_warming" category:"experimental"`
 }
 
 // RegisterFlags registers the BucketStore flags
@@ -366,6 +371,7 @@ func (cfg *BucketStoreConfig) RegisterFlags(f *flag.FlagSet, logger log.Logger)
 	cfg.MetadataCache.RegisterFlagsWithPrefix(f, "blocks-storage.bucket-store.metadata-cache.")
 	cfg.BucketIndex.RegisterFlagsWithPrefix(f, "blocks-storage.bucket-store.bucket-index.")
 	cfg.IndexHeader.RegisterFlagsWithPrefix(f, "blocks-storage.bucket-store.index-header.")
+	cfg.PostingsCacheWarming.RegisterFlagsWithPrefix(f, "blocks-storage.bucket-store.postings-cache-warming.")
 
 	f.StringVar(&cfg.SyncDir, "blocks-storage.bucket-store.sync-dir", "./tsdb-sync/", "Directory to store synchronized TSDB index headers. This directory is not required to be persisted between restarts, but it's highly recommended in order to improve the store-gateway startup time.")
 	f.DurationVar(&cfg.SyncInterval, "blocks-storage.bucket-store.sync-interval", 15*time.Minute, "How frequently to scan the bucket, or to refresh the bucket index (if enabled), in order to look for changes (new blocks shipped by ingesters and blocks deleted by retention or compaction).")
@@ -403,12 +409,35 @@ func (cfg *BucketStoreConfig) Validate(logger log.Logger) error {
 	if err := cfg.MetadataCache.Validate(); err != nil {
 		return errors.Wrap(err, "metadata-cache configuration")
 	}
+	if err := cfg.PostingsCacheWarming.Validate(); err != nil {
+		return errors.Wrap(err, "postings-cache-warming configuration")
+	}
 	if cfg.DeprecatedConsistencyDelay > 0 {
 		util.WarnDeprecatedConfig(consistencyDelayFlag, logger)
 	}
 	return nil
 }
 
+// PostingsCacheWarmingConfig holds the config options of the postings cache warming.
+type PostingsCacheWarmingConfig struct {
+	Enabled                   bool          `yaml:"enabled" category:"experimental"`
+	MaxSelectors              int           `yaml:"max_selectors" category:"experimental"`
+	MinExpandPostingsDuration time.Duration `yaml:"min_expand_postings_duration" category:"experimental"`
+}
+
+func (cfg *PostingsCacheWarmingConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix string) {
+	f.BoolVar(&cfg.Enabled, prefix+"enabled", false, "If enabled, the store-gateway tracks the label matchers of the recent expensive queries, and replays them against newly loaded blocks, in order to pre-populate the postings and expanded postings caches. The tracked label matchers are persisted in the sync directory, so that the caches are warmed up after a restart too.")
+	f.IntVar(&cfg.MaxSelectors, prefix+"max-selectors", 100, "Maximum number of label matchers of recent expensive queries tracked per tenant. When the limit is reached, the least recently seen ones are evicted.")
+	f.DurationVar(&cfg.MinExpandPostingsDuration, prefix+"min-expand-postings-duration", 100*time.Millisecond, "Minimum time spent expanding the postings of a query, for the query label matchers to be considered expensive and tracked.")
+}
+
+func (cfg *PostingsCacheWarmingConfig) Validate() error {
+	if cfg.Enabled && cfg.MaxSelectors <= 0 {
+		return errInvalidPostingsCacheWarmingMaxSelectors
+	}
+	return nil
+}
+
 type BucketIndexConfig struct {
 	Enabled               bool          `yaml:"enabled"`
 	UpdateOnErrorInterval time.Duration `yaml:"update_on_error_interval" category:"advanced"`
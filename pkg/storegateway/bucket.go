@@ -42,6 +42,7 @@ import (
 
 	"github.com/grafana/mimir/pkg/mimirpb"
 	"github.com/grafana/mimir/pkg/storage/sharding"
+	"github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketcache"
 	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
@@ -133,6 +134,11 @@ type BucketStore struct {
 
 	// Additional configuration for experimental indexheader.BinaryReader behaviour.
 	indexHeaderCfg indexheader.Config
+
+	// postingsCacheWarmingCfg configures the warming of the postings caches of newly loaded blocks.
+	// The expensiveSelectors tracker is nil if the warming is disabled.
+	postingsCacheWarmingCfg tsdb.PostingsCacheWarmingConfig
+	expensiveSelectors      *expensiveSelectors
 }
 
 type noopCache struct{}
@@ -216,6 +222,14 @@ func WithFineGrainedChunksCaching(enabled bool) BucketStoreOption {
 	}
 }
 
+// WithPostingsCacheWarming enables the warming of the postings caches of newly loaded blocks,
+// replaying the label matchers of the recent expensive Series() requests.
+func WithPostingsCacheWarming(cfg tsdb.PostingsCacheWarmingConfig) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.postingsCacheWarmingCfg = cfg
+	}
+}
+
 // NewBucketStore creates a new bucket backed store that implements the store API against
 // an object store bucket. It is optimized to work against high latency backends.
 func NewBucketStore(
@@ -272,6 +286,13 @@ func NewBucketStore(
 		return nil, errors.Wrap(err, "create dir")
 	}
 
+	if s.postingsCacheWarmingCfg.Enabled {
+		s.expensiveSelectors = newExpensiveSelectors(s.postingsCacheWarmingCfg.MaxSelectors)
+		if err := s.expensiveSelectors.load(s.expensiveSelectorsPath(), time.Now()); err != nil {
+			level.Warn(s.logger).Log("msg", "failed to load expensive selectors to warm postings caches", "err", err)
+		}
+	}
+
 	return s, nil
 }
 
@@ -305,8 +326,12 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 		return metaFetchErr
 	}
 
-	var wg sync.WaitGroup
-	blockc := make(chan *metadata.Meta)
+	var (
+		wg           sync.WaitGroup
+		blockc       = make(chan *metadata.Meta)
+		newBlocksMx  sync.Mutex
+		newBlocksIDs []ulid.ULID
+	)
 
 	for i := 0; i < s.blockSyncConcurrency; i++ {
 		wg.Add(1)
@@ -315,6 +340,10 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 				if err := s.addBlock(ctx, meta); err != nil {
 					continue
 				}
+
+				newBlocksMx.Lock()
+				newBlocksIDs = append(newBlocksIDs, meta.ULID)
+				newBlocksMx.Unlock()
 			}
 			wg.Done()
 		}()
@@ -333,6 +362,20 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 	close(blockc)
 	wg.Wait()
 
+	if s.expensiveSelectors != nil {
+		newBlocks := make([]*bucketBlock, 0, len(newBlocksIDs))
+		for _, id := range newBlocksIDs {
+			if b := s.getBlock(id); b != nil {
+				newBlocks = append(newBlocks, b)
+			}
+		}
+		s.warmPostingsCaches(ctx, newBlocks)
+
+		if err := s.expensiveSelectors.persist(s.expensiveSelectorsPath()); err != nil {
+			level.Warn(s.logger).Log("msg", "failed to persist expensive selectors to warm postings caches", "err", err)
+		}
+	}
+
 	if metaFetchErr != nil {
 		return metaFetchErr
 	}
@@ -592,6 +635,7 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		seriesLimiter    = s.seriesLimiterFactory(s.metrics.queriesDropped.WithLabelValues("series"))
 	)
 	defer s.recordSeriesCallResult(stats)
+	defer s.recordExpensiveSelector(matchers, stats)
 
 	if req.Hints != nil {
 		reqHints := &hintspb.SeriesRequestHints{}
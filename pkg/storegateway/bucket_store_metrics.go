@@ -52,6 +52,9 @@ type BucketStoreMetrics struct {
 	seriesFetchDuration   prometheus.Histogram
 	postingsFetchDuration prometheus.Histogram
 
+	postingsCacheWarmingSelectors prometheus.Counter
+	postingsCacheWarmingFailures  prometheus.Counter
+
 	indexHeaderReaderMetrics *indexheader.ReaderPoolMetrics
 }
 
@@ -168,6 +171,15 @@ func NewBucketStoreMetrics(reg prometheus.Registerer) *BucketStoreMetrics {
 		},
 	})
 
+	m.postingsCacheWarmingSelectors = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_bucket_store_postings_cache_warming_selectors_total",
+		Help: "Total number of label matchers selectors replayed against newly loaded blocks to warm the postings caches.",
+	})
+	m.postingsCacheWarmingFailures = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_bucket_store_postings_cache_warming_failures_total",
+		Help: "Total number of label matchers selectors which failed to be replayed against newly loaded blocks to warm the postings caches.",
+	})
+
 	m.indexHeaderReaderMetrics = indexheader.NewReaderPoolMetrics(prometheus.WrapRegistererWithPrefix("cortex_bucket_store_", reg))
 
 	m.streamingSeriesRequestDurationByStage = promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
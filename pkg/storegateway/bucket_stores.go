@@ -18,6 +18,7 @@ import (
 	"github.com/grafana/dskit/backoff"
 	"github.com/grafana/dskit/cache"
 	"github.com/grafana/dskit/gate"
+	"github.com/grafana/dskit/services"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -44,6 +45,8 @@ const GrpcContextMetadataTenantID = "__org_id__"
 
 // BucketStores is a multi-tenant wrapper of Thanos BucketStore.
 type BucketStores struct {
+	services.Service
+
 	logger             log.Logger
 	cfg                tsdb.BlocksStorageConfig
 	limits             *validation.Overrides
@@ -56,6 +59,9 @@ type BucketStores struct {
 	// Index cache shared across all tenants.
 	indexCache indexcache.IndexCache
 
+	// Local disk tier of the chunks cache shared across all tenants, if enabled.
+	chunksDiskCache *chunkscache.DiskCache
+
 	chunksCache chunkscache.Cache
 
 	// Series hash cache shared across all tenants.
@@ -89,6 +95,15 @@ func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStra
 		return nil, errors.Wrapf(err, "chunks-cache")
 	}
 
+	// The local disk tier of the chunks cache sits between the chunks cache backend, if any, and the object storage.
+	var chunksDiskCache *chunkscache.DiskCache
+	if diskCfg := cfg.BucketStore.ChunksCache.Disk; diskCfg.Enabled() {
+		if chunksDiskCache, err = chunkscache.NewDiskCache(chunksCacheClient, diskCfg.Directory, int64(diskCfg.MaxSizeBytes), logger, reg); err != nil {
+			return nil, errors.Wrap(err, "chunks-cache disk")
+		}
+		chunksCacheClient = chunksDiskCache
+	}
+
 	cachingBucket, err := tsdb.CreateCachingBucket(chunksCacheClient, cfg.BucketStore.ChunksCache, cfg.BucketStore.MetadataCache, bucketClient, logger, reg)
 	if err != nil {
 		return nil, errors.Wrapf(err, "create caching bucket")
@@ -111,6 +126,7 @@ func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStra
 		queryGate:          queryGate,
 		partitioners:       newGapBasedPartitioners(cfg.BucketStore.PartitionerMaxGapBytes, reg),
 		seriesHashCache:    hashcache.NewSeriesHashCache(cfg.BucketStore.SeriesHashCacheMaxBytes),
+		chunksDiskCache:    chunksDiskCache,
 		syncBackoffConfig: backoff.Config{
 			MinBackoff: 1 * time.Second,
 			MaxBackoff: 10 * time.Second,
@@ -161,9 +177,18 @@ func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStra
 		reg.MustRegister(u.metaFetcherMetrics)
 	}
 
+	u.Service = services.NewIdleService(nil, u.stopping)
 	return u, nil
 }
 
+// stopping stops writing the queued items to the local disk tier of the chunks cache, if enabled.
+func (u *BucketStores) stopping(_ error) error {
+	if u.chunksDiskCache != nil {
+		u.chunksDiskCache.Stop()
+	}
+	return nil
+}
+
 // InitialSync does an initial synchronization of blocks for all users.
 func (u *BucketStores) InitialSync(ctx context.Context) error {
 	level.Info(u.logger).Log("msg", "synchronizing TSDB blocks for all users")
@@ -470,6 +495,7 @@ func (u *BucketStores) getOrCreateStore(userID string) (*BucketStore, error) {
 		WithQueryGate(u.queryGate),
 		WithChunkPool(u.chunksPool),
 		WithFineGrainedChunksCaching(u.cfg.BucketStore.ChunksCache.FineGrainedChunksCachingEnabled),
+		WithPostingsCacheWarming(u.cfg.BucketStore.PostingsCacheWarming),
 	}
 
 	bs, err := NewBucketStore(
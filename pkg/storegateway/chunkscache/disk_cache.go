@@ -0,0 +1,535 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package chunkscache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/cache"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	diskCacheItemExt    = ".item"
+	diskCacheItemTmpExt = ".tmp"
+
+	// diskCacheItemHeaderSize is the size of the item header: the magic, the expiration time and the key length.
+	diskCacheItemHeaderSize = 4 + 8 + 4
+	// diskCacheItemFooterSize is the size of the item footer: the checksum of the header, key and value.
+	diskCacheItemFooterSize = 4
+
+	diskCacheWriteQueueLength = 10000
+	diskCacheWriteConcurrency = 4
+
+	// diskCacheFileLocks is the number of locks serializing the writes and removals of the items.
+	diskCacheFileLocks = 256
+)
+
+var (
+	diskCacheItemMagic = []byte{'M', 'D', 'C', '1'}
+	diskCacheCRC32     = crc32.MakeTable(crc32.Castagnoli)
+
+	errDiskCacheItemCorrupted = errors.New("disk cache item is corrupted")
+)
+
+var _ cache.Cache = (*DiskCache)(nil)
+
+// DiskCache is a cache tier storing the items on the local disk, between the next cache tier and the object storage.
+// Items are fetched from the next cache tier first, if any, and the missing ones are fetched from the local disk.
+// Stored items are written to both tiers. The local disk tier is limited in size, and the least recently used items
+// are evicted once the limit is exceeded. Each item is checksummed, and corrupted items are removed when read.
+//
+// The items are stored in a flat directory, one file per item, named after the hash of the key. The key is stored
+// in the file too, to detect hash collisions.
+type DiskCache struct {
+	next         cache.Cache
+	dir          string
+	maxSizeBytes int64
+	logger       log.Logger
+
+	// Protects the index of the items on disk, which is kept in LRU order, and its size.
+	mtx       sync.Mutex
+	items     map[string]*list.Element
+	lru       *list.List
+	sizeBytes int64
+
+	// Serialize the writes and removals of the items stored in the same file, so that an item written in the
+	// meanwhile isn't removed because the previous item stored in the file was expired or corrupted. The files
+	// are striped across a fixed number of locks.
+	fileLocks [diskCacheFileLocks]sync.Mutex
+
+	writeQueue chan diskCacheWrite
+	stopCh     chan struct{}
+	workers    sync.WaitGroup
+
+	requests       prometheus.Counter
+	hits           prometheus.Counter
+	corruptedItems prometheus.Counter
+	evictedItems   prometheus.Counter
+	droppedWrites  prometheus.Counter
+	failedWrites   prometheus.Counter
+}
+
+// diskCacheItem is the index entry of an item stored on disk.
+type diskCacheItem struct {
+	file      string
+	sizeBytes int64
+}
+
+type diskCacheWrite struct {
+	data map[string][]byte
+	ttl  time.Duration
+}
+
+// NewDiskCache makes a new DiskCache storing the items in dir, up to maxSizeBytes. The items already stored in dir
+// are kept, so that the cache survives restarts. The next cache tier is optional.
+func NewDiskCache(next cache.Cache, dir string, maxSizeBytes int64, logger log.Logger, reg prometheus.Registerer) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, errors.Wrap(err, "create disk cache directory")
+	}
+
+	c := &DiskCache{
+		next:         next,
+		dir:          dir,
+		maxSizeBytes: maxSizeBytes,
+		logger:       logger,
+		items:        map[string]*list.Element{},
+		lru:          list.New(),
+		writeQueue:   make(chan diskCacheWrite, diskCacheWriteQueueLength),
+		stopCh:       make(chan struct{}),
+
+		requests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_chunks_disk_cache_requests_total",
+			Help: "Total number of items requested from the chunks disk cache.",
+		}),
+		hits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_chunks_disk_cache_hits_total",
+			Help: "Total number of items retrieved from the chunks disk cache.",
+		}),
+		corruptedItems: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_chunks_disk_cache_corrupted_items_total",
+			Help: "Total number of items of the chunks disk cache which failed the integrity check and have been removed.",
+		}),
+		evictedItems: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_chunks_disk_cache_evicted_items_total",
+			Help: "Total number of items evicted from the chunks disk cache because the max size has been exceeded.",
+		}),
+		droppedWrites: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_chunks_disk_cache_dropped_writes_total",
+			Help: "Total number of writes to the chunks disk cache dropped because the write queue was full.",
+		}),
+		failedWrites: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_chunks_disk_cache_failed_writes_total",
+			Help: "Total number of items which failed to be written to the chunks disk cache.",
+		}),
+	}
+
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cortex_bucket_store_chunks_disk_cache_size_bytes",
+		Help: "Total size of the items currently in the chunks disk cache.",
+	}, func() float64 {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		return float64(c.sizeBytes)
+	})
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cortex_bucket_store_chunks_disk_cache_items",
+		Help: "Total number of items currently in the chunks disk cache.",
+	}, func() float64 {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		return float64(c.lru.Len())
+	})
+
+	if err := c.loadItems(); err != nil {
+		return nil, errors.Wrap(err, "load disk cache items")
+	}
+
+	c.workers.Add(diskCacheWriteConcurrency)
+	for i := 0; i < diskCacheWriteConcurrency; i++ {
+		go c.writeLoop()
+	}
+
+	level.Info(logger).Log("msg", "created chunks disk cache", "dir", dir, "max_size_bytes", maxSizeBytes, "items", c.lru.Len(), "size_bytes", c.sizeBytes)
+	return c, nil
+}
+
+// loadItems indexes the items already stored on disk, from the least to the most recently modified, and removes
+// the leftovers of interrupted writes.
+func (c *DiskCache) loadItems() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type loadedItem struct {
+		diskCacheItem
+		modTime time.Time
+	}
+	loaded := make([]loadedItem, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), diskCacheItemTmpExt) {
+			_ = os.Remove(filepath.Join(c.dir, entry.Name()))
+			continue
+		}
+		if !strings.HasSuffix(entry.Name(), diskCacheItemExt) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// The file may have been removed in the meanwhile.
+			continue
+		}
+		loaded = append(loaded, loadedItem{diskCacheItem: diskCacheItem{file: entry.Name(), sizeBytes: info.Size()}, modTime: info.ModTime()})
+	}
+
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].modTime.Before(loaded[j].modTime)
+	})
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, item := range loaded {
+		c.items[item.file] = c.lru.PushFront(&diskCacheItem{file: item.file, sizeBytes: item.sizeBytes})
+		c.sizeBytes += item.sizeBytes
+	}
+	c.evictLocked()
+	return nil
+}
+
+// StoreAsync implements cache.Cache. The items are written to the next cache tier, if any, and queued to be
+// written to disk. If the queue is full, the items are not written to disk.
+func (c *DiskCache) StoreAsync(data map[string][]byte, ttl time.Duration) {
+	if c.next != nil {
+		c.next.StoreAsync(data, ttl)
+	}
+
+	select {
+	case c.writeQueue <- diskCacheWrite{data: data, ttl: ttl}:
+	default:
+		c.droppedWrites.Add(float64(len(data)))
+	}
+}
+
+func (c *DiskCache) writeLoop() {
+	defer c.workers.Done()
+
+	for {
+		select {
+		case w := <-c.writeQueue:
+			for key, value := range w.data {
+				if err := c.write(key, value, w.ttl); err != nil {
+					c.failedWrites.Inc()
+					level.Warn(c.logger).Log("msg", "failed to write item to the chunks disk cache", "key", key, "err", err)
+				}
+			}
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// write stores the item to a temporary file, which is then renamed, so that readers never see a partial item.
+func (c *DiskCache) write(key string, value []byte, ttl time.Duration) error {
+	// Items larger than the max size would be evicted right away.
+	sizeBytes := int64(diskCacheItemHeaderSize + len(key) + len(value) + diskCacheItemFooterSize)
+	if sizeBytes > c.maxSizeBytes {
+		return nil
+	}
+
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixNano()
+	}
+
+	file := diskCacheFileName(key)
+
+	// The temporary file name is unique, because the same key may be written concurrently.
+	tmp, err := os.CreateTemp(c.dir, file+".*"+diskCacheItemTmpExt)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(encodeDiskCacheItem(key, value, expiresAt))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	fileLock := c.fileLock(file)
+	fileLock.Lock()
+	defer fileLock.Unlock()
+
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, file)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// The item is indexed with a new element, so that a concurrent read of the previous item doesn't remove it.
+	if elem, ok := c.items[file]; ok {
+		c.sizeBytes -= elem.Value.(*diskCacheItem).sizeBytes
+		c.lru.Remove(elem)
+	}
+	c.items[file] = c.lru.PushFront(&diskCacheItem{file: file, sizeBytes: sizeBytes})
+	c.sizeBytes += sizeBytes
+	c.evictLocked()
+	return nil
+}
+
+func (c *DiskCache) fileLock(file string) *sync.Mutex {
+	return &c.fileLocks[xxhash.Sum64String(file)%diskCacheFileLocks]
+}
+
+// evictLocked removes the least recently used items until the size of the cache is within the limit.
+// Must be called with the lock held.
+func (c *DiskCache) evictLocked() {
+	for c.sizeBytes > c.maxSizeBytes {
+		elem := c.lru.Back()
+		if elem == nil {
+			return
+		}
+
+		c.removeLocked(elem)
+		c.evictedItems.Inc()
+	}
+}
+
+// removeLocked removes the item from the index and the disk. Must be called with the lock held.
+func (c *DiskCache) removeLocked(elem *list.Element) {
+	item := elem.Value.(*diskCacheItem)
+	c.lru.Remove(elem)
+	delete(c.items, item.file)
+	c.sizeBytes -= item.sizeBytes
+
+	if err := os.Remove(filepath.Join(c.dir, item.file)); err != nil && !os.IsNotExist(err) {
+		level.Warn(c.logger).Log("msg", "failed to remove item from the chunks disk cache", "file", item.file, "err", err)
+	}
+}
+
+// remove removes the item stored in the input file, if it's still indexed. If the expected element isn't nil,
+// the item is removed only if it hasn't been written again since the element was read from the index.
+func (c *DiskCache) remove(file string, expected *list.Element) {
+	fileLock := c.fileLock(file)
+	fileLock.Lock()
+	defer fileLock.Unlock()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if elem, ok := c.items[file]; ok && (expected == nil || elem == expected) {
+		c.removeLocked(elem)
+	}
+}
+
+// Fetch implements cache.Cache. The keys are fetched from the next cache tier first, if any, and the missing
+// ones from disk.
+func (c *DiskCache) Fetch(ctx context.Context, keys []string, opts ...cache.Option) map[string][]byte {
+	var found map[string][]byte
+	if c.next != nil {
+		found = c.next.Fetch(ctx, keys, opts...)
+	}
+	if found == nil {
+		found = make(map[string][]byte, len(keys))
+	}
+
+	options := &cache.Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	requests, hits := 0, 0
+	for _, key := range keys {
+		if _, ok := found[key]; ok {
+			continue
+		}
+
+		requests++
+		if value, ok := c.read(key, options.Alloc); ok {
+			found[key] = value
+			hits++
+		}
+	}
+
+	c.requests.Add(float64(requests))
+	c.hits.Add(float64(hits))
+	return found
+}
+
+// read returns the value of the item with the input key, if it's stored on disk, not expired and not corrupted.
+func (c *DiskCache) read(key string, alloc cache.Allocator) ([]byte, bool) {
+	file := diskCacheFileName(key)
+
+	c.mtx.Lock()
+	elem, ok := c.items[file]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mtx.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	data, buf, err := readDiskCacheFile(filepath.Join(c.dir, file), alloc)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			level.Warn(c.logger).Log("msg", "failed to read item from the chunks disk cache", "file", file, "err", err)
+		}
+		releaseDiskCacheBuffer(alloc, buf)
+		c.remove(file, elem)
+		return nil, false
+	}
+
+	storedKey, value, expiresAt, err := decodeDiskCacheItem(data)
+	if err != nil {
+		c.corruptedItems.Inc()
+		level.Warn(c.logger).Log("msg", "removing corrupted item from the chunks disk cache", "file", file, "err", err)
+		releaseDiskCacheBuffer(alloc, buf)
+		c.remove(file, elem)
+		return nil, false
+	}
+
+	if expiresAt > 0 && time.Now().UnixNano() > expiresAt {
+		releaseDiskCacheBuffer(alloc, buf)
+		c.remove(file, elem)
+		return nil, false
+	}
+
+	// The item is a hash collision with another key, which is kept.
+	if storedKey != key {
+		releaseDiskCacheBuffer(alloc, buf)
+		return nil, false
+	}
+
+	return value, true
+}
+
+// Delete implements cache.Cache.
+func (c *DiskCache) Delete(ctx context.Context, key string) error {
+	c.remove(diskCacheFileName(key), nil)
+
+	if c.next != nil {
+		return c.next.Delete(ctx, key)
+	}
+	return nil
+}
+
+// Name implements cache.Cache.
+func (c *DiskCache) Name() string {
+	if c.next != nil {
+		return "disk-" + c.next.Name()
+	}
+	return "disk"
+}
+
+// Stop stops writing the queued items to disk.
+func (c *DiskCache) Stop() {
+	close(c.stopCh)
+	c.workers.Wait()
+}
+
+func diskCacheFileName(key string) string {
+	return fmt.Sprintf("%016x%s", xxhash.Sum64String(key), diskCacheItemExt)
+}
+
+// readDiskCacheFile reads the content of the file into a buffer obtained from the allocator, if any. The buffer
+// is returned too, so that it can be released to the allocator if the content is not returned to the caller.
+func readDiskCacheFile(path string, alloc cache.Allocator) (data []byte, buf *[]byte, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size := int(info.Size())
+	if alloc != nil {
+		buf = alloc.Get(size)
+		data = (*buf)[:size]
+	} else {
+		data = make([]byte, size)
+	}
+
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, buf, err
+	}
+	return data, buf, nil
+}
+
+func releaseDiskCacheBuffer(alloc cache.Allocator, buf *[]byte) {
+	if alloc != nil && buf != nil {
+		alloc.Put(buf)
+	}
+}
+
+// encodeDiskCacheItem encodes the item as: the magic, the expiration time, the key length, the key, the value and
+// the CRC32 checksum of all the preceding bytes.
+func encodeDiskCacheItem(key string, value []byte, expiresAt int64) []byte {
+	data := make([]byte, diskCacheItemHeaderSize+len(key)+len(value)+diskCacheItemFooterSize)
+	copy(data, diskCacheItemMagic)
+	binary.BigEndian.PutUint64(data[4:12], uint64(expiresAt))
+	binary.BigEndian.PutUint32(data[12:16], uint32(len(key)))
+	copy(data[diskCacheItemHeaderSize:], key)
+	copy(data[diskCacheItemHeaderSize+len(key):], value)
+
+	payloadSize := len(data) - diskCacheItemFooterSize
+	binary.BigEndian.PutUint32(data[payloadSize:], crc32.Checksum(data[:payloadSize], diskCacheCRC32))
+	return data
+}
+
+// decodeDiskCacheItem decodes the item encoded by encodeDiskCacheItem, returning an error if the integrity check fails.
+func decodeDiskCacheItem(data []byte) (key string, value []byte, expiresAt int64, err error) {
+	if len(data) < diskCacheItemHeaderSize+diskCacheItemFooterSize {
+		return "", nil, 0, errors.Wrapf(errDiskCacheItemCorrupted, "size %d is too small", len(data))
+	}
+
+	payload, checksum := data[:len(data)-diskCacheItemFooterSize], binary.BigEndian.Uint32(data[len(data)-diskCacheItemFooterSize:])
+	if actual := crc32.Checksum(payload, diskCacheCRC32); actual != checksum {
+		return "", nil, 0, errors.Wrapf(errDiskCacheItemCorrupted, "checksum mismatch (expected: %x, actual: %x)", checksum, actual)
+	}
+	if !bytes.Equal(payload[:len(diskCacheItemMagic)], diskCacheItemMagic) {
+		return "", nil, 0, errors.Wrap(errDiskCacheItemCorrupted, "unexpected magic")
+	}
+
+	expiresAt = int64(binary.BigEndian.Uint64(payload[4:12]))
+	keyLen := int(binary.BigEndian.Uint32(payload[12:16]))
+	if diskCacheItemHeaderSize+keyLen > len(payload) {
+		return "", nil, 0, errors.Wrapf(errDiskCacheItemCorrupted, "key length %d exceeds the item size", keyLen)
+	}
+
+	key = string(payload[diskCacheItemHeaderSize : diskCacheItemHeaderSize+keyLen])
+	value = payload[diskCacheItemHeaderSize+keyLen:]
+	return key, value, expiresAt, nil
+}
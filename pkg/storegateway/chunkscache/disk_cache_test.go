@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package chunkscache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskCacheItem_EncodeDecode(t *testing.T) {
+	for _, value := range [][]byte{nil, {}, []byte("value")} {
+		key, actualValue, expiresAt, err := decodeDiskCacheItem(encodeDiskCacheItem("key", value, 123))
+		require.NoError(t, err)
+		assert.Equal(t, "key", key)
+		assert.Equal(t, len(value), len(actualValue))
+		assert.Equal(t, string(value), string(actualValue))
+		assert.Equal(t, int64(123), expiresAt)
+	}
+}
+
+func TestDiskCacheItem_DecodeShouldFailOnCorruptedItems(t *testing.T) {
+	data := encodeDiskCacheItem("key", []byte("value"), 0)
+
+	for name, corrupted := range map[string][]byte{
+		"truncated":       data[:len(data)-1],
+		"too small":       data[:diskCacheItemHeaderSize],
+		"flipped bit":     func() []byte { d := append([]byte{}, data...); d[diskCacheItemHeaderSize+1] ^= 1; return d }(),
+		"flipped trailer": func() []byte { d := append([]byte{}, data...); d[len(d)-1] ^= 1; return d }(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, _, err := decodeDiskCacheItem(corrupted)
+			assert.ErrorIs(t, err, errDiskCacheItemCorrupted)
+		})
+	}
+}
+
+func TestDiskCache_StoreAndFetch(t *testing.T) {
+	ctx := context.Background()
+	next := cache.NewMockCache()
+	c := newTestDiskCache(t, next, t.TempDir(), 1024, prometheus.NewPedanticRegistry())
+
+	storeAndWait(t, c, map[string][]byte{"key-1": []byte("value-1"), "key-2": []byte("value-2")}, time.Hour)
+
+	// The items are stored in both tiers.
+	assert.Equal(t, map[string][]byte{"key-1": []byte("value-1"), "key-2": []byte("value-2")}, next.Fetch(ctx, []string{"key-1", "key-2"}))
+
+	// Once evicted from the next tier, the items are fetched from disk.
+	require.NoError(t, next.Delete(ctx, "key-1"))
+	assert.Equal(t, map[string][]byte{"key-1": []byte("value-1"), "key-2": []byte("value-2")}, c.Fetch(ctx, []string{"key-1", "key-2", "key-3"}))
+	assert.Equal(t, 2.0, prom_testutil.ToFloat64(c.requests))
+	assert.Equal(t, 1.0, prom_testutil.ToFloat64(c.hits))
+
+	// Deleted items are removed from both tiers.
+	require.NoError(t, c.Delete(ctx, "key-2"))
+	assert.Empty(t, c.Fetch(ctx, []string{"key-2"}))
+}
+
+func TestDiskCache_ShouldWorkWithoutNextTier(t *testing.T) {
+	c := newTestDiskCache(t, nil, t.TempDir(), 1024, prometheus.NewPedanticRegistry())
+
+	storeAndWait(t, c, map[string][]byte{"key": []byte("value")}, time.Hour)
+	assert.Equal(t, map[string][]byte{"key": []byte("value")}, c.Fetch(context.Background(), []string{"key"}))
+	assert.Equal(t, "disk", c.Name())
+}
+
+func TestDiskCache_ShouldNotReturnExpiredItems(t *testing.T) {
+	c := newTestDiskCache(t, nil, t.TempDir(), 1024, prometheus.NewPedanticRegistry())
+
+	storeAndWait(t, c, map[string][]byte{"key": []byte("value")}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	assert.Empty(t, c.Fetch(context.Background(), []string{"key"}))
+	assert.Equal(t, 0, c.lru.Len())
+}
+
+func TestDiskCache_ShouldEvictLeastRecentlyUsedItemsOnceMaxSizeIsExceeded(t *testing.T) {
+	ctx := context.Background()
+	value := []byte(strings.Repeat("x", 100))
+	itemSize := int64(diskCacheItemHeaderSize + len("key-1") + len(value) + diskCacheItemFooterSize)
+	c := newTestDiskCache(t, nil, t.TempDir(), 2*itemSize, prometheus.NewPedanticRegistry())
+
+	storeAndWait(t, c, map[string][]byte{"key-1": value}, time.Hour)
+	storeAndWait(t, c, map[string][]byte{"key-2": value}, time.Hour)
+
+	// Fetching key-1 makes key-2 the least recently used item.
+	require.Len(t, c.Fetch(ctx, []string{"key-1"}), 1)
+	storeAndWait(t, c, map[string][]byte{"key-3": value}, time.Hour)
+
+	assert.Equal(t, []string{"key-1", "key-3"}, sortedKeys(c.Fetch(ctx, []string{"key-1", "key-2", "key-3"})))
+	assert.Equal(t, 2*itemSize, c.sizeBytes)
+	assert.Equal(t, 1.0, prom_testutil.ToFloat64(c.evictedItems))
+
+	// Items larger than the max size are not stored.
+	storeAndWait(t, c, map[string][]byte{"key-4": []byte(strings.Repeat("x", int(2*itemSize)+1))}, time.Hour)
+	assert.Empty(t, c.Fetch(ctx, []string{"key-4"}))
+
+	files, err := os.ReadDir(c.dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestDiskCache_ShouldRemoveCorruptedItems(t *testing.T) {
+	c := newTestDiskCache(t, nil, t.TempDir(), 1024, prometheus.NewPedanticRegistry())
+	storeAndWait(t, c, map[string][]byte{"key": []byte("value")}, time.Hour)
+
+	path := filepath.Join(c.dir, diskCacheFileName("key"))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[diskCacheItemHeaderSize+len("key")] ^= 1
+	require.NoError(t, os.WriteFile(path, data, 0o640))
+
+	assert.Empty(t, c.Fetch(context.Background(), []string{"key"}))
+	assert.Equal(t, 1.0, prom_testutil.ToFloat64(c.corruptedItems))
+	assert.NoFileExists(t, path)
+	assert.Equal(t, int64(0), c.sizeBytes)
+}
+
+func TestDiskCache_ShouldNotRemoveItemsWrittenAgainSinceTheyWereRead(t *testing.T) {
+	c := newTestDiskCache(t, nil, t.TempDir(), 1024, prometheus.NewPedanticRegistry())
+	file := diskCacheFileName("key")
+	require.NoError(t, c.write("key", []byte("expired"), time.Hour))
+
+	c.mtx.Lock()
+	readElem := c.items[file]
+	c.mtx.Unlock()
+
+	// The item is written again before the read removes the previous one, so it's kept.
+	require.NoError(t, c.write("key", []byte("value"), time.Hour))
+	c.remove(file, readElem)
+	assert.Equal(t, map[string][]byte{"key": []byte("value")}, c.Fetch(context.Background(), []string{"key"}))
+
+	// Deleting the key removes the item regardless.
+	require.NoError(t, c.Delete(context.Background(), "key"))
+	assert.Empty(t, c.Fetch(context.Background(), []string{"key"}))
+	assert.NoFileExists(t, filepath.Join(c.dir, file))
+}
+
+func TestDiskCache_ShouldLoadItemsStoredBeforeRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	c := newTestDiskCache(t, nil, dir, 1024, prometheus.NewPedanticRegistry())
+	storeAndWait(t, c, map[string][]byte{"key": []byte("value")}, time.Hour)
+
+	// Leftovers of interrupted writes are removed.
+	tmpPath := filepath.Join(dir, diskCacheFileName("other")+".123"+diskCacheItemTmpExt)
+	require.NoError(t, os.WriteFile(tmpPath, []byte("partial"), 0o640))
+
+	restarted := newTestDiskCache(t, nil, dir, 1024, prometheus.NewPedanticRegistry())
+	assert.Equal(t, map[string][]byte{"key": []byte("value")}, restarted.Fetch(context.Background(), []string{"key"}))
+	assert.Equal(t, c.sizeBytes, restarted.sizeBytes)
+	assert.NoFileExists(t, tmpPath)
+}
+
+func newTestDiskCache(t *testing.T, next cache.Cache, dir string, maxSizeBytes int64, reg prometheus.Registerer) *DiskCache {
+	c, err := NewDiskCache(next, dir, maxSizeBytes, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	t.Cleanup(c.Stop)
+	return c
+}
+
+// storeAndWait stores the items, and waits until they have been written to disk.
+func storeAndWait(t *testing.T, c *DiskCache, data map[string][]byte, ttl time.Duration) {
+	c.StoreAsync(data, ttl)
+	require.Eventually(t, func() bool {
+		return len(c.writeQueue) == 0 && writtenItems(c, data)
+	}, 5*time.Second, time.Millisecond)
+}
+
+// writtenItems returns whether each input item has been written to disk, or is too large to be written.
+func writtenItems(c *DiskCache, data map[string][]byte) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for key, value := range data {
+		if _, ok := c.items[diskCacheFileName(key)]; !ok && int64(len(value)) <= c.maxSizeBytes {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 	"github.com/grafana/mimir/pkg/util"
 )
 
@@ -33,3 +34,24 @@ func (s *StoreGateway) TenantsHandler(w http.ResponseWriter, req *http.Request)
 		Tenants: tenantIDs,
 	}, tenantsTemplate, req)
 }
+
+type tenantsUsageResponse struct {
+	Tenants []bucketindex.Usage `json:"tenants"`
+}
+
+// TenantsUsageHandler responds with the storage usage summary of each tenant, computed from the bucket indexes.
+func (s *StoreGateway) TenantsUsageHandler(w http.ResponseWriter, req *http.Request) {
+	userIDs, err := s.stores.scanUsers(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usages, err := bucketindex.ReadUsages(req.Context(), s.stores.bucket, userIDs, s.stores.limits, s.logger)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	util.WriteJSONResponse(w, tenantsUsageResponse{Tenants: usages})
+}
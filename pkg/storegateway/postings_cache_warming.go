@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/concurrency"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// expensiveSelectorsFilename is the name of the file, in the tenant sync directory, where the
+// label matchers of the recent expensive queries are persisted.
+const expensiveSelectorsFilename = "expensive-selectors.json"
+
+// expensiveSelectors tracks the label matchers of the most recent expensive Series() requests.
+// Selectors are keyed by their string representation, which can be parsed back to label matchers.
+type expensiveSelectors struct {
+	maxSelectors int
+
+	mtx      sync.Mutex
+	lastSeen map[string]time.Time
+}
+
+func newExpensiveSelectors(maxSelectors int) *expensiveSelectors {
+	return &expensiveSelectors{
+		maxSelectors: maxSelectors,
+		lastSeen:     map[string]time.Time{},
+	}
+}
+
+// record tracks the input label matchers as seen now. If the max number of selectors is exceeded,
+// the least recently seen selector is evicted.
+func (e *expensiveSelectors) record(matchers []*labels.Matcher, now time.Time) {
+	if len(matchers) == 0 {
+		return
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.lastSeen[selectorString(matchers)] = now
+
+	for len(e.lastSeen) > e.maxSelectors {
+		var (
+			oldestSelector string
+			oldestTime     time.Time
+		)
+		for selector, ts := range e.lastSeen {
+			if oldestSelector == "" || ts.Before(oldestTime) {
+				oldestSelector, oldestTime = selector, ts
+			}
+		}
+		delete(e.lastSeen, oldestSelector)
+	}
+}
+
+// selectors returns the tracked selectors, sorted from the most recently seen.
+func (e *expensiveSelectors) selectors() []string {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	out := make([]string, 0, len(e.lastSeen))
+	for selector := range e.lastSeen {
+		out = append(out, selector)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return e.lastSeen[out[i]].After(e.lastSeen[out[j]])
+	})
+	return out
+}
+
+// load reads the selectors persisted in the input file, if any. The loaded selectors are
+// tracked as seen at the input time, in the persisted order.
+func (e *expensiveSelectors) load(path string, now time.Time) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var selectors []string
+	if err := json.Unmarshal(data, &selectors); err != nil {
+		return errors.Wrap(err, "decode expensive selectors")
+	}
+
+	// The selectors are persisted from the most recently seen, so they're loaded in reverse order.
+	for i := len(selectors) - 1; i >= 0; i-- {
+		matchers, err := parser.ParseMetricSelector(selectors[i])
+		if err != nil {
+			continue
+		}
+		e.record(matchers, now.Add(time.Duration(len(selectors)-i)*time.Nanosecond))
+	}
+	return nil
+}
+
+// persist writes the tracked selectors to the input file.
+func (e *expensiveSelectors) persist(path string) error {
+	data, err := json.Marshal(e.selectors())
+	if err != nil {
+		return err
+	}
+
+	// Write the file in an atomic way, to avoid partial writes (e.g. during a restart or crash of the store-gateway).
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// selectorString returns the string representation of the input label matchers, in the
+// PromQL selector format.
+func selectorString(matchers []*labels.Matcher) string {
+	parts := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		parts = append(parts, m.String())
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// expensiveSelectorsPath returns the path of the file where the expensive selectors are persisted.
+func (s *BucketStore) expensiveSelectorsPath() string {
+	return filepath.Join(s.dir, expensiveSelectorsFilename)
+}
+
+// recordExpensiveSelector tracks the input label matchers if the postings expansion of the Series()
+// request was expensive, so that they can be used to warm the postings caches of new blocks.
+func (s *BucketStore) recordExpensiveSelector(matchers []*labels.Matcher, stats *safeQueryStats) {
+	if s.expensiveSelectors == nil {
+		return
+	}
+	if stats.export().streamingSeriesExpandPostingsDuration < s.postingsCacheWarmingCfg.MinExpandPostingsDuration {
+		return
+	}
+	s.expensiveSelectors.record(matchers, time.Now())
+}
+
+// warmPostingsCaches replays the tracked expensive selectors against the input blocks, in order to
+// pre-populate the postings and expanded postings caches.
+func (s *BucketStore) warmPostingsCaches(ctx context.Context, blocks []*bucketBlock) {
+	if s.expensiveSelectors == nil || len(blocks) == 0 {
+		return
+	}
+
+	var selectors [][]*labels.Matcher
+	for _, selector := range s.expensiveSelectors.selectors() {
+		matchers, err := parser.ParseMetricSelector(selector)
+		if err != nil {
+			level.Warn(s.logger).Log("msg", "failed to parse expensive selector to warm postings caches", "selector", selector, "err", err)
+			continue
+		}
+		selectors = append(selectors, matchers)
+	}
+	if len(selectors) == 0 {
+		return
+	}
+
+	start := time.Now()
+	_ = concurrency.ForEachJob(ctx, len(blocks), s.blockSyncConcurrency, func(ctx context.Context, idx int) error {
+		s.warmBlockPostingsCaches(ctx, blocks[idx], selectors)
+		return nil
+	})
+	level.Info(s.logger).Log("msg", "warmed postings caches of new blocks", "blocks", len(blocks), "selectors", len(selectors), "elapsed", time.Since(start))
+}
+
+func (s *BucketStore) warmBlockPostingsCaches(ctx context.Context, b *bucketBlock, selectors [][]*labels.Matcher) {
+	logger := log.With(s.logger, "block", b.meta.ULID)
+
+	indexr := b.indexReader()
+	defer func() {
+		if err := indexr.Close(); err != nil {
+			level.Warn(logger).Log("msg", "failed to close block index reader", "err", err)
+		}
+	}()
+
+	for _, matchers := range selectors {
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.metrics.postingsCacheWarmingSelectors.Inc()
+		if _, err := indexr.ExpandedPostings(ctx, matchers, newSafeQueryStats()); err != nil {
+			s.metrics.postingsCacheWarmingFailures.Inc()
+			level.Warn(logger).Log("msg", "failed to warm postings caches", "selector", selectorString(matchers), "err", err)
+		}
+	}
+}
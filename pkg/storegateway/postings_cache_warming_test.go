@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/storegateway/indexcache"
+)
+
+func TestExpensiveSelectors(t *testing.T) {
+	now := time.Now()
+	selector := func(value string) []*labels.Matcher {
+		return []*labels.Matcher{
+			labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "series"),
+			labels.MustNewMatcher(labels.MatchRegexp, "pod", value),
+		}
+	}
+
+	t.Run("should track the most recently seen selectors and evict the oldest ones", func(t *testing.T) {
+		e := newExpensiveSelectors(2)
+		e.record(nil, now)
+		e.record(selector("a.*"), now)
+		e.record(selector("b.*"), now.Add(time.Second))
+		e.record(selector("a.*"), now.Add(2*time.Second))
+		e.record(selector("c.*"), now.Add(3*time.Second))
+
+		assert.Equal(t, []string{`{__name__="series",pod=~"c.*"}`, `{__name__="series",pod=~"a.*"}`}, e.selectors())
+	})
+
+	t.Run("should persist and load the selectors", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), expensiveSelectorsFilename)
+
+		// Loading a non existing file is a no-op.
+		loaded := newExpensiveSelectors(3)
+		require.NoError(t, loaded.load(path, now))
+		assert.Empty(t, loaded.selectors())
+
+		e := newExpensiveSelectors(3)
+		e.record(selector("a.*"), now)
+		e.record(selector("b.*"), now.Add(time.Second))
+		e.record(selector("c.*"), now.Add(2*time.Second))
+		require.NoError(t, e.persist(path))
+
+		// The selectors order is preserved, even if the max number of selectors is lower.
+		loaded = newExpensiveSelectors(2)
+		require.NoError(t, loaded.load(path, now))
+		assert.Equal(t, []string{`{__name__="series",pod=~"c.*"}`, `{__name__="series",pod=~"b.*"}`}, loaded.selectors())
+	})
+}
+
+func TestBucketStore_PostingsCacheWarming(t *testing.T) {
+	cfg := tsdb.PostingsCacheWarmingConfig{Enabled: true, MaxSelectors: 10, MinExpandPostingsDuration: 100 * time.Millisecond}
+	cache := &expandedPostingsTrackingCache{}
+	_, store, _, _, block1, _, close := setupStoreForHintsTest(t, 5000, WithPostingsCacheWarming(cfg), WithIndexCache(cache))
+	defer close()
+
+	ctx := context.Background()
+	matchers := []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "ext1", "1")}
+
+	// Unload a block and track an expensive selector, then sync the block back.
+	require.NoError(t, store.removeBlock(block1))
+	store.recordExpensiveSelector(matchers, newSafeQueryStats())
+	require.Empty(t, store.expensiveSelectors.selectors())
+
+	stats := newSafeQueryStats()
+	stats.update(func(stats *queryStats) {
+		stats.streamingSeriesExpandPostingsDuration = time.Second
+	})
+	store.recordExpensiveSelector(matchers, stats)
+	require.NoError(t, store.SyncBlocks(ctx))
+
+	// The newly loaded block postings should have been warmed.
+	assert.Equal(t, []expandedPostingsCacheKey{{blockID: block1, key: indexcache.CanonicalLabelMatchersKey(matchers)}}, cache.stored)
+	assert.Equal(t, float64(1), testutil.ToFloat64(store.metrics.postingsCacheWarmingSelectors))
+	assert.Equal(t, float64(0), testutil.ToFloat64(store.metrics.postingsCacheWarmingFailures))
+
+	// The selectors should have been persisted, to be loaded by a new store.
+	loaded := newExpensiveSelectors(cfg.MaxSelectors)
+	require.NoError(t, loaded.load(store.expensiveSelectorsPath(), time.Now()))
+	assert.Equal(t, []string{`{ext1=~"1"}`}, loaded.selectors())
+}
+
+type expandedPostingsCacheKey struct {
+	blockID ulid.ULID
+	key     indexcache.LabelMatchersKey
+}
+
+// expandedPostingsTrackingCache is an index cache tracking the stored expanded postings.
+type expandedPostingsTrackingCache struct {
+	noopCache
+
+	mtx    sync.Mutex
+	stored []expandedPostingsCacheKey
+}
+
+func (c *expandedPostingsTrackingCache) StoreExpandedPostings(_ string, blockID ulid.ULID, key indexcache.LabelMatchersKey, _ []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.stored = append(c.stored, expandedPostingsCacheKey{blockID: blockID, key: key})
+}
@@ -27,6 +27,7 @@ const (
 	MaxMetadataPerMetric          ID = "max-metadata-per-metric"
 	MaxSeriesPerUser              ID = "max-series-per-user"
 	MaxMetadataPerUser            ID = "max-metadata-per-user"
+	MaxWALDiskUsagePerUser        ID = "max-wal-disk-usage-per-user"
 	MaxChunksPerQuery             ID = "max-chunks-per-query"
 	MaxSeriesPerQuery             ID = "max-series-per-query"
 	MaxChunkBytesPerQuery         ID = "max-chunks-bytes-per-query"
@@ -52,9 +53,13 @@ const (
 	MaxQueryLength              ID = "max-query-length"
 	MaxTotalQueryLength         ID = "max-total-query-length"
 	MaxQueryExpressionSizeBytes ID = "max-query-expression-size-bytes"
+	MaxQueryMemoryBytes         ID = "max-query-memory-bytes"
+	MaxQueryResponseSizeBytes   ID = "max-query-response-size-bytes"
+	CatchAllQuery               ID = "catch-all-query"
 	RequestRateLimited          ID = "tenant-max-request-rate"
 	IngestionRateLimited        ID = "tenant-max-ingestion-rate"
 	TooManyHAClusters           ID = "tenant-too-many-ha-clusters"
+	TenantReadOnly              ID = "tenant-read-only"
 
 	SampleTimestampTooOld    ID = "sample-timestamp-too-old"
 	SampleOutOfOrder         ID = "sample-out-of-order"
@@ -64,7 +69,8 @@ const (
 	StoreConsistencyCheckFailed ID = "store-consistency-check-failed"
 	BucketIndexTooOld           ID = "bucket-index-too-old"
 
-	DistributorMaxWriteMessageSize ID = "distributor-max-write-message-size"
+	DistributorMaxWriteMessageSize  ID = "distributor-max-write-message-size"
+	DistributorMaxRequestLabelBytes ID = "distributor-max-request-label-bytes"
 )
 
 // Message returns the provided msg, appending the error id.
@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/encoding"
+)
+
+func TestCompressor(t *testing.T) {
+	c := encoding.GetCompressor(Name)
+	require.NotNil(t, c)
+
+	// The encoders and decoders are reused across messages.
+	for _, input := range []string{"", "a", strings.Repeat("series", 100_000), "another message"} {
+		buf := &bytes.Buffer{}
+		w, err := c.Compress(buf)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(input))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		r, err := c.Decompress(buf)
+		require.NoError(t, err)
+		output, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, input, string(output))
+	}
+}
@@ -142,21 +142,39 @@ const (
 // ParseProtoReader parses a compressed proto from an io.Reader.
 // You can pass in and receive back the decompression buffer for pooling, or pass in nil and ignore the return.
 func ParseProtoReader(ctx context.Context, reader io.Reader, expectedSize, maxSize int, dst []byte, req proto.Message, compression CompressionType) ([]byte, error) {
+	body, err := DecompressProtoReader(ctx, reader, expectedSize, maxSize, dst, compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := UnmarshalProto(ctx, body, req); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// DecompressProtoReader reads and decompresses a proto from an io.Reader, without unmarshalling it.
+// Both the compressed and decompressed size are checked against maxSize before the body is decompressed.
+// You can pass in and receive back the decompression buffer for pooling, or pass in nil and ignore the return.
+func DecompressProtoReader(ctx context.Context, reader io.Reader, expectedSize, maxSize int, dst []byte, compression CompressionType) ([]byte, error) {
 	sp := opentracing.SpanFromContext(ctx)
 	if sp != nil {
 		sp.LogFields(otlog.Event("util.ParseProtoRequest[start reading]"))
 	}
-	body, err := decompressRequest(dst, reader, expectedSize, maxSize, compression, sp)
-	if err != nil {
-		return nil, err
-	}
+	return decompressRequest(dst, reader, expectedSize, maxSize, compression, sp)
+}
 
+// UnmarshalProto unmarshals the input decompressed body into req.
+func UnmarshalProto(ctx context.Context, body []byte, req proto.Message) error {
+	sp := opentracing.SpanFromContext(ctx)
 	if sp != nil {
 		sp.LogFields(otlog.Event("util.ParseProtoRequest[unmarshal]"), otlog.Int("size", len(body)))
 	}
 
 	// We re-implement proto.Unmarshal here as it calls XXX_Unmarshal first,
 	// which we can't override without upsetting golint.
+	var err error
 	req.Reset()
 	if u, ok := req.(proto.Unmarshaler); ok {
 		err = u.Unmarshal(body)
@@ -168,21 +186,27 @@ func ParseProtoReader(ctx context.Context, reader io.Reader, expectedSize, maxSi
 			sp.LogFields(otlog.Event("util.ParseProtoRequest[unmarshal done]"), otlog.Error(err))
 		}
 
-		return nil, err
+		return err
 	}
 
 	if sp != nil {
 		sp.LogFields(otlog.Event("util.ParseProtoRequest[unmarshal done]"))
 	}
 
-	return body, nil
+	return nil
 }
 
 type MsgSizeTooLargeErr struct {
 	Actual, Limit int
+
+	// Decompressed is true if the limit has been exceeded by the decompressed size of the message.
+	Decompressed bool
 }
 
 func (e MsgSizeTooLargeErr) Error() string {
+	if e.Decompressed {
+		return fmt.Sprintf("the request has been rejected because its decompressed size of %d bytes exceeds the limit of %d bytes", e.Actual, e.Limit)
+	}
 	return fmt.Sprintf("the request has been rejected because its size of %d bytes exceeds the limit of %d bytes", e.Actual, e.Limit)
 }
 
@@ -254,7 +278,7 @@ func decompressFromBuffer(dst []byte, buffer *bytes.Buffer, maxSize int, compres
 			return nil, err
 		}
 		if size > maxSize {
-			return nil, MsgSizeTooLargeErr{Actual: size, Limit: maxSize}
+			return nil, MsgSizeTooLargeErr{Actual: size, Limit: maxSize, Decompressed: true}
 		}
 		body, err := snappy.Decode(dst, buffer.Bytes())
 		if err != nil {
@@ -21,6 +21,7 @@ import (
 type MetricsServer struct {
 	port     int
 	registry *prometheus.Registry
+	handlers map[string]http.Handler
 	srv      *http.Server
 }
 
@@ -29,9 +30,15 @@ func NewMetricsServer(port int, registry *prometheus.Registry) *MetricsServer {
 	return &MetricsServer{
 		port:     port,
 		registry: registry,
+		handlers: map[string]http.Handler{},
 	}
 }
 
+// Handle registers an additional handler for the given path. It must be called before Start.
+func (s *MetricsServer) Handle(path string, handler http.Handler) {
+	s.handlers[path] = handler
+}
+
 // Start the instrumentation server.
 func (s *MetricsServer) Start() error {
 	// Setup listener first, so we can fail early if the port is in use.
@@ -42,6 +49,9 @@ func (s *MetricsServer) Start() error {
 
 	router := mux.NewRouter()
 	router.Handle("/metrics", promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}))
+	for path, handler := range s.handlers {
+		router.Handle(path, handler)
+	}
 
 	s.srv = &http.Server{
 		Handler: router,
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/prometheus/prometheus/storage"
 	"go.uber.org/atomic"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
@@ -33,6 +34,14 @@ var (
 		"the query exceeded the maximum number of chunks (limit: %d chunks)",
 		validation.MaxChunksPerQueryFlag,
 	)
+	SoftMaxSeriesHitMsgFormat = globalerror.MaxSeriesPerQuery.MessageWithPerTenantLimitConfig(
+		"the query exceeded the soft limit on the maximum number of series (limit: %d series), the query will fail once the limit is enforced",
+		validation.SoftMaxSeriesPerQueryFlag,
+	)
+	SoftMaxChunksPerQueryLimitMsgFormat = globalerror.MaxChunksPerQuery.MessageWithPerTenantLimitConfig(
+		"the query exceeded the soft limit on the maximum number of chunks (limit: %d chunks), the query will fail once the limit is enforced",
+		validation.SoftMaxChunksPerQueryFlag,
+	)
 )
 
 type QueryLimiter struct {
@@ -45,6 +54,16 @@ type QueryLimiter struct {
 	maxSeriesPerQuery     int
 	maxChunkBytesPerQuery int
 	maxChunksPerQuery     int
+
+	softMaxSeriesPerQuery int
+	softMaxChunksPerQuery int
+
+	// Warnings about the exceeded soft limits which haven't been returned yet,
+	// and whether each soft limit has been exceeded, so that it's warned once.
+	warningsMx       sync.Mutex
+	warnings         storage.Warnings
+	softSeriesWarned bool
+	softChunksWarned bool
 }
 
 // NewQueryLimiter makes a new per-query limiter. Each query limiter
@@ -75,10 +94,18 @@ func QueryLimiterFromContextWithFallback(ctx context.Context) *QueryLimiter {
 	return ql
 }
 
+// WithSoftLimits sets the soft limits of the query limiter, and returns it. When a soft limit is exceeded,
+// the query doesn't fail, but a warning is returned by Warnings. It must be called before using the limiter.
+func (ql *QueryLimiter) WithSoftLimits(softMaxSeriesPerQuery, softMaxChunksPerQuery int) *QueryLimiter {
+	ql.softMaxSeriesPerQuery = softMaxSeriesPerQuery
+	ql.softMaxChunksPerQuery = softMaxChunksPerQuery
+	return ql
+}
+
 // AddSeries adds the input series and returns an error if the limit is reached.
 func (ql *QueryLimiter) AddSeries(seriesLabels []mimirpb.LabelAdapter) error {
 	// If the max series is unlimited just return without managing map
-	if ql.maxSeriesPerQuery == 0 {
+	if ql.maxSeriesPerQuery == 0 && ql.softMaxSeriesPerQuery == 0 {
 		return nil
 	}
 	fingerprint := mimirpb.FromLabelAdaptersToLabels(seriesLabels).Hash()
@@ -87,10 +114,13 @@ func (ql *QueryLimiter) AddSeries(seriesLabels []mimirpb.LabelAdapter) error {
 	defer ql.uniqueSeriesMx.Unlock()
 
 	ql.uniqueSeries[fingerprint] = struct{}{}
-	if len(ql.uniqueSeries) > ql.maxSeriesPerQuery {
+	if ql.maxSeriesPerQuery > 0 && len(ql.uniqueSeries) > ql.maxSeriesPerQuery {
 		// Format error with max limit
 		return fmt.Errorf(MaxSeriesHitMsgFormat, ql.maxSeriesPerQuery)
 	}
+	if ql.softMaxSeriesPerQuery > 0 && len(ql.uniqueSeries) > ql.softMaxSeriesPerQuery {
+		ql.warnOnce(&ql.softSeriesWarned, fmt.Errorf(SoftMaxSeriesHitMsgFormat, ql.softMaxSeriesPerQuery))
+	}
 	return nil
 }
 
@@ -113,12 +143,39 @@ func (ql *QueryLimiter) AddChunkBytes(chunkSizeInBytes int) error {
 }
 
 func (ql *QueryLimiter) AddChunks(count int) error {
-	if ql.maxChunksPerQuery == 0 {
+	if ql.maxChunksPerQuery == 0 && ql.softMaxChunksPerQuery == 0 {
 		return nil
 	}
 
-	if ql.chunkCount.Add(int64(count)) > int64(ql.maxChunksPerQuery) {
+	total := ql.chunkCount.Add(int64(count))
+	if ql.maxChunksPerQuery > 0 && total > int64(ql.maxChunksPerQuery) {
 		return fmt.Errorf(MaxChunksPerQueryLimitMsgFormat, ql.maxChunksPerQuery)
 	}
+	if ql.softMaxChunksPerQuery > 0 && total > int64(ql.softMaxChunksPerQuery) {
+		ql.warnOnce(&ql.softChunksWarned, fmt.Errorf(SoftMaxChunksPerQueryLimitMsgFormat, ql.softMaxChunksPerQuery))
+	}
 	return nil
 }
+
+// warnOnce records the input warning, unless a warning has already been recorded for the same soft limit.
+func (ql *QueryLimiter) warnOnce(warned *bool, warning error) {
+	ql.warningsMx.Lock()
+	defer ql.warningsMx.Unlock()
+
+	if *warned {
+		return
+	}
+	*warned = true
+	ql.warnings = append(ql.warnings, warning)
+}
+
+// Warnings returns the warnings about the exceeded soft limits recorded since the previous call,
+// so that each warning is returned once even if the limiter is shared by multiple selects.
+func (ql *QueryLimiter) Warnings() storage.Warnings {
+	ql.warningsMx.Lock()
+	defer ql.warningsMx.Unlock()
+
+	warnings := ql.warnings
+	ql.warnings = nil
+	return warnings
+}
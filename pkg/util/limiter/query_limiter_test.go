@@ -75,6 +75,52 @@ func TestQueryLimiter_AddChunkBytes(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestQueryLimiter_SoftLimits(t *testing.T) {
+	series := func(name string) []mimirpb.LabelAdapter {
+		return mimirpb.FromLabelsToLabelAdapters(labels.FromStrings(labels.MetricName, name))
+	}
+
+	t.Run("should warn once when the soft limit on series is exceeded", func(t *testing.T) {
+		limiter := NewQueryLimiter(0, 0, 0).WithSoftLimits(1, 0)
+
+		require.NoError(t, limiter.AddSeries(series("series_1")))
+		assert.Empty(t, limiter.Warnings())
+
+		require.NoError(t, limiter.AddSeries(series("series_2")))
+		require.NoError(t, limiter.AddSeries(series("series_3")))
+		assert.Equal(t, []error{fmt.Errorf(SoftMaxSeriesHitMsgFormat, 1)}, []error(limiter.Warnings()))
+
+		// The warning has already been returned.
+		require.NoError(t, limiter.AddSeries(series("series_4")))
+		assert.Empty(t, limiter.Warnings())
+	})
+
+	t.Run("should warn once when the soft limit on chunks is exceeded", func(t *testing.T) {
+		limiter := NewQueryLimiter(0, 0, 0).WithSoftLimits(0, 10)
+
+		require.NoError(t, limiter.AddChunks(10))
+		assert.Empty(t, limiter.Warnings())
+
+		require.NoError(t, limiter.AddChunks(1))
+		require.NoError(t, limiter.AddChunks(1))
+		assert.Equal(t, []error{fmt.Errorf(SoftMaxChunksPerQueryLimitMsgFormat, 10)}, []error(limiter.Warnings()))
+		assert.Empty(t, limiter.Warnings())
+	})
+
+	t.Run("should still fail when the hard limit is exceeded", func(t *testing.T) {
+		limiter := NewQueryLimiter(2, 0, 2).WithSoftLimits(1, 1)
+
+		require.NoError(t, limiter.AddSeries(series("series_1")))
+		require.NoError(t, limiter.AddSeries(series("series_2")))
+		require.Error(t, limiter.AddSeries(series("series_3")))
+
+		require.NoError(t, limiter.AddChunks(2))
+		require.Error(t, limiter.AddChunks(1))
+
+		assert.Len(t, limiter.Warnings(), 2)
+	})
+}
+
 func BenchmarkQueryLimiter_AddSeries(b *testing.B) {
 	const (
 		metricName = "test_metric"
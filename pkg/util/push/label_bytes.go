@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package push
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/grafana/mimir/pkg/util/globalerror"
+)
+
+// Field numbers of the WriteRequest messages walked by requestLabelBytes.
+const (
+	writeRequestTimeseriesField = 1
+	timeSeriesLabelsField       = 1
+	labelPairNameField          = 1
+	labelPairValueField         = 2
+)
+
+type maxRequestLabelBytesErr struct {
+	limit int
+}
+
+func (e maxRequestLabelBytesErr) Error() string {
+	return globalerror.DistributorMaxRequestLabelBytes.MessageWithPerInstanceLimitConfig(
+		fmt.Sprintf("the incoming push request has been rejected because the total size of its series labels is larger than the allowed limit of %d bytes", e.limit),
+		maxRequestLabelBytesFlag)
+}
+
+// requestLabelBytes returns the total size of the names and values of the series labels in the input
+// serialized WriteRequest, walking the protobuf wire format without unmarshalling it. This allows to reject
+// requests before the series and labels are materialized. The walk stops as soon as the total size exceeds
+// the limit, in which case the returned size is the one computed so far. A limit of 0 disables the early stop.
+func requestLabelBytes(body []byte, limit int) (int, error) {
+	total := 0
+
+	err := walkProtoFields(body, func(num protowire.Number, typ protowire.Type, series []byte) error {
+		if num != writeRequestTimeseriesField || typ != protowire.BytesType {
+			return nil
+		}
+
+		return walkProtoFields(series, func(num protowire.Number, typ protowire.Type, label []byte) error {
+			if num != timeSeriesLabelsField || typ != protowire.BytesType {
+				return nil
+			}
+
+			return walkProtoFields(label, func(num protowire.Number, typ protowire.Type, value []byte) error {
+				if (num != labelPairNameField && num != labelPairValueField) || typ != protowire.BytesType {
+					return nil
+				}
+
+				total += len(value)
+				if limit > 0 && total > limit {
+					return maxRequestLabelBytesErr{limit: limit}
+				}
+				return nil
+			})
+		})
+	})
+
+	return total, err
+}
+
+// walkProtoFields calls fn for each field of the input serialized protobuf message. The value passed to fn
+// is the content of length-delimited fields, and nil for any other field type.
+func walkProtoFields(b []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var value []byte
+		if typ == protowire.BytesType {
+			value, n = protowire.ConsumeBytes(b)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package push
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestRequestLabelBytes(t *testing.T) {
+	req := mimirpb.WriteRequest{
+		Timeseries: []mimirpb.PreallocTimeseries{
+			{TimeSeries: &mimirpb.TimeSeries{
+				Labels:  []mimirpb.LabelAdapter{{Name: "__name__", Value: "foo"}, {Name: "job", Value: "test"}},
+				Samples: []mimirpb.Sample{{TimestampMs: 1, Value: 1}},
+				Exemplars: []mimirpb.Exemplar{{
+					Labels: []mimirpb.LabelAdapter{{Name: "trace_id", Value: "123"}}, TimestampMs: 1, Value: 1,
+				}},
+			}},
+			{TimeSeries: &mimirpb.TimeSeries{
+				Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "bar"}},
+			}},
+		},
+		Metadata: []*mimirpb.MetricMetadata{{MetricFamilyName: "foo", Help: "help"}},
+		Source:   mimirpb.RULE,
+	}
+	body, err := req.Marshal()
+	require.NoError(t, err)
+
+	// Only the series labels are taken into account.
+	const expected = len("__name__") + len("foo") + len("job") + len("test") + len("__name__") + len("bar")
+
+	t.Run("should return the total size of the series labels", func(t *testing.T) {
+		actual, err := requestLabelBytes(body, 0)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+
+		actual, err = requestLabelBytes(body, expected)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("should return an error as soon as the limit is exceeded", func(t *testing.T) {
+		actual, err := requestLabelBytes(body, 10)
+		require.ErrorAs(t, err, &maxRequestLabelBytesErr{})
+		assert.Equal(t, len("__name__")+len("foo"), actual)
+	})
+
+	t.Run("should return an error on malformed requests", func(t *testing.T) {
+		_, err := requestLabelBytes(body[:len(body)-1], 0)
+		require.Error(t, err)
+	})
+}
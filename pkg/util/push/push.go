@@ -13,6 +13,8 @@ import (
 	"sync"
 
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/middleware"
 
@@ -40,24 +42,84 @@ var bufferPool = sync.Pool{
 const SkipLabelNameValidationHeader = "X-Mimir-SkipLabelNameValidation"
 const statusClientClosedRequest = 499
 
+const (
+	maxRecvMsgSizeFlag       = "distributor.max-recv-msg-size"
+	maxRequestLabelBytesFlag = "distributor.max-request-label-bytes"
+
+	rejectReasonMessageSize             = "message_size"
+	rejectReasonDecompressedMessageSize = "decompressed_message_size"
+	rejectReasonLabelBytes              = "label_bytes"
+)
+
+type responseHeadersContextKey int
+
+const responseHeadersKey responseHeadersContextKey = 0
+
+// SetResponseHeader sets a header in the HTTP response to the push request. It's a no-op if the
+// push request has not been received through the HTTP Handler. It must be called before the push
+// Func returns.
+func SetResponseHeader(ctx context.Context, key, value string) {
+	if headers, ok := ctx.Value(responseHeadersKey).(http.Header); ok {
+		headers.Set(key, value)
+	}
+}
+
 // Handler is a http.Handler which accepts WriteRequests.
+//
+// The request body is decompressed and checked against the limits before being unmarshalled, so that
+// oversized requests are rejected before their series are materialized. The body isn't decoded in a
+// streaming fashion: the snappy block format requires decompressing it in full, which is bounded by
+// maxRecvMsgSize. A maxRequestLabelBytes of 0 disables the limit on the total size of the series labels.
 func Handler(
 	maxRecvMsgSize int,
+	maxRequestLabelBytes int,
 	sourceIPs *middleware.SourceIPExtractor,
 	allowSkipLabelNameValidation bool,
+	reg prometheus.Registerer,
 	push Func,
 ) http.Handler {
+	rejectedRequests := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_distributor_push_requests_rejected_total",
+		Help: "Total number of write requests rejected before being unmarshalled because they exceeded a limit.",
+	}, []string{"reason"})
+
 	return handler(maxRecvMsgSize, sourceIPs, allowSkipLabelNameValidation, push, func(ctx context.Context, r *http.Request, maxRecvMsgSize int, dst []byte, req *mimirpb.PreallocWriteRequest) ([]byte, error) {
-		res, err := util.ParseProtoReader(ctx, r.Body, int(r.ContentLength), maxRecvMsgSize, dst, req, util.RawSnappy)
-		if errors.Is(err, util.MsgSizeTooLargeErr{}) {
-			err = distributorMaxWriteMessageSizeErr{actual: int(r.ContentLength), limit: maxRecvMsgSize}
+		body, err := util.DecompressProtoReader(ctx, r.Body, int(r.ContentLength), maxRecvMsgSize, dst, util.RawSnappy)
+		if err != nil {
+			var sizeErr util.MsgSizeTooLargeErr
+			if errors.As(err, &sizeErr) {
+				var sizeLimitErr distributorMaxWriteMessageSizeErr
+				if sizeErr.Decompressed {
+					rejectedRequests.WithLabelValues(rejectReasonDecompressedMessageSize).Inc()
+					sizeLimitErr = distributorMaxWriteMessageSizeErr{actual: sizeErr.Actual, limit: maxRecvMsgSize, decompressed: true}
+				} else {
+					rejectedRequests.WithLabelValues(rejectReasonMessageSize).Inc()
+					sizeLimitErr = distributorMaxWriteMessageSizeErr{actual: int(r.ContentLength), limit: maxRecvMsgSize}
+				}
+				err = httpgrpc.Errorf(http.StatusRequestEntityTooLarge, sizeLimitErr.Error())
+			}
+			return nil, err
 		}
-		return res, err
+
+		if maxRequestLabelBytes > 0 {
+			if _, err := requestLabelBytes(body, maxRequestLabelBytes); err != nil {
+				if errors.As(err, &maxRequestLabelBytesErr{}) {
+					rejectedRequests.WithLabelValues(rejectReasonLabelBytes).Inc()
+				}
+				return nil, err
+			}
+		}
+
+		if err := util.UnmarshalProto(ctx, body, req); err != nil {
+			return nil, err
+		}
+		return body, nil
 	})
 }
 
 type distributorMaxWriteMessageSizeErr struct {
 	actual, limit int
+	decompressed  bool
 }
 
 func (e distributorMaxWriteMessageSizeErr) Error() string {
@@ -65,7 +127,11 @@ func (e distributorMaxWriteMessageSizeErr) Error() string {
 	if e.actual < 0 {
 		msgSizeDesc = ""
 	}
-	return globalerror.DistributorMaxWriteMessageSize.MessageWithPerInstanceLimitConfig(fmt.Sprintf("the incoming push request has been rejected because its message size%s is larger than the allowed limit of %d bytes", msgSizeDesc, e.limit), "distributor.max-recv-msg-size")
+	msgSizeKind := "message size"
+	if e.decompressed {
+		msgSizeKind = "decompressed message size"
+	}
+	return globalerror.DistributorMaxWriteMessageSize.MessageWithPerInstanceLimitConfig(fmt.Sprintf("the incoming push request has been rejected because its %s%s is larger than the allowed limit of %d bytes", msgSizeKind, msgSizeDesc, e.limit), maxRecvMsgSizeFlag)
 }
 
 func handler(maxRecvMsgSize int,
@@ -75,7 +141,7 @@ func handler(maxRecvMsgSize int,
 	parser parserFunc,
 ) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
+		ctx := context.WithValue(r.Context(), responseHeadersKey, w.Header())
 		logger := log.WithContext(ctx, log.Logger)
 		if sourceIPs != nil {
 			source := sourceIPs.Get(r)
@@ -13,11 +13,14 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/snappy"
 	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/prometheus/prometheus/storage/remote"
@@ -36,11 +39,90 @@ import (
 func TestHandler_remoteWrite(t *testing.T) {
 	req := createRequest(t, createPrometheusRemoteWriteProtobuf(t))
 	resp := httptest.NewRecorder()
-	handler := Handler(100000, nil, false, verifyWritePushFunc(t, mimirpb.API))
+	handler := Handler(100000, 0, nil, false, nil, verifyWritePushFunc(t, mimirpb.API))
 	handler.ServeHTTP(resp, req)
 	assert.Equal(t, 200, resp.Code)
 }
 
+func TestHandler_remoteWriteLimits(t *testing.T) {
+	// The label value is highly compressible, so that the decompressed request is much bigger than the compressed one.
+	protobuf, err := (&prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "foo"}, {Name: "bar", Value: strings.Repeat("x", 1000)}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC).UnixMilli()}},
+		}},
+	}).Marshal()
+	require.NoError(t, err)
+
+	compressedSize := len(snappy.Encode(nil, protobuf))
+	labelBytes := len("__name__") + len("foo") + len("bar") + 1000
+
+	tests := map[string]struct {
+		maxRecvMsgSize       int
+		maxRequestLabelBytes int
+		expectedCode         int
+		expectedErr          string
+		expectedReason       string
+	}{
+		"should accept a request within the limits": {
+			maxRecvMsgSize:       100000,
+			maxRequestLabelBytes: labelBytes,
+			expectedCode:         http.StatusOK,
+		},
+		"should reject a request whose compressed size exceeds the limit": {
+			maxRecvMsgSize: compressedSize - 1,
+			expectedCode:   http.StatusRequestEntityTooLarge,
+			expectedErr:    fmt.Sprintf("its message size of %d bytes is larger than the allowed limit", compressedSize),
+			expectedReason: rejectReasonMessageSize,
+		},
+		"should reject a request whose decompressed size exceeds the limit": {
+			maxRecvMsgSize: compressedSize,
+			expectedCode:   http.StatusRequestEntityTooLarge,
+			expectedErr:    fmt.Sprintf("its decompressed message size of %d bytes is larger than the allowed limit", len(protobuf)),
+			expectedReason: rejectReasonDecompressedMessageSize,
+		},
+		"should reject a request whose series labels size exceeds the limit": {
+			maxRecvMsgSize:       100000,
+			maxRequestLabelBytes: labelBytes - 1,
+			expectedCode:         http.StatusBadRequest,
+			expectedErr:          "the total size of its series labels is larger than the allowed limit",
+			expectedReason:       rejectReasonLabelBytes,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			handler := Handler(testData.maxRecvMsgSize, testData.maxRequestLabelBytes, nil, false, reg, func(ctx context.Context, pushReq *Request) (*mimirpb.WriteResponse, error) {
+				request, err := pushReq.WriteRequest()
+				if err != nil {
+					return nil, err
+				}
+				assert.Len(t, request.Timeseries, 1)
+				pushReq.CleanUp()
+				return &mimirpb.WriteResponse{}, nil
+			})
+
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, createRequest(t, protobuf))
+			assert.Equal(t, testData.expectedCode, resp.Code)
+			if testData.expectedErr != "" {
+				assert.Contains(t, resp.Body.String(), testData.expectedErr)
+			}
+
+			expectedMetrics := ""
+			if testData.expectedReason != "" {
+				expectedMetrics = fmt.Sprintf(`
+					# HELP cortex_distributor_push_requests_rejected_total Total number of write requests rejected before being unmarshalled because they exceeded a limit.
+					# TYPE cortex_distributor_push_requests_rejected_total counter
+					cortex_distributor_push_requests_rejected_total{reason=%q} 1
+				`, testData.expectedReason)
+			}
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expectedMetrics), "cortex_distributor_push_requests_rejected_total"))
+		})
+	}
+}
+
 func TestHandlerOTLPPush(t *testing.T) {
 	sampleSeries :=
 		[]prompb.TimeSeries{
@@ -321,7 +403,7 @@ func TestHandler_mimirWriteRequest(t *testing.T) {
 	req := createRequest(t, createMimirWriteRequestProtobuf(t, false))
 	resp := httptest.NewRecorder()
 	sourceIPs, _ := middleware.NewSourceIPs("SomeField", "(.*)")
-	handler := Handler(100000, sourceIPs, false, verifyWritePushFunc(t, mimirpb.RULE))
+	handler := Handler(100000, 0, sourceIPs, false, nil, verifyWritePushFunc(t, mimirpb.RULE))
 	handler.ServeHTTP(resp, req)
 	assert.Equal(t, 200, resp.Code)
 }
@@ -330,7 +412,7 @@ func TestHandler_contextCanceledRequest(t *testing.T) {
 	req := createRequest(t, createMimirWriteRequestProtobuf(t, false))
 	resp := httptest.NewRecorder()
 	sourceIPs, _ := middleware.NewSourceIPs("SomeField", "(.*)")
-	handler := Handler(100000, sourceIPs, false, func(_ context.Context, req *Request) (*mimirpb.WriteResponse, error) {
+	handler := Handler(100000, 0, sourceIPs, false, nil, func(_ context.Context, req *Request) (*mimirpb.WriteResponse, error) {
 		defer req.CleanUp()
 		return nil, fmt.Errorf("the request failed: %w", context.Canceled)
 	})
@@ -338,6 +420,40 @@ func TestHandler_contextCanceledRequest(t *testing.T) {
 	assert.Equal(t, 499, resp.Code)
 }
 
+func TestHandler_SetResponseHeader(t *testing.T) {
+	t.Run("successful request", func(t *testing.T) {
+		req := createRequest(t, createMimirWriteRequestProtobuf(t, false))
+		resp := httptest.NewRecorder()
+		handler := Handler(100000, 0, nil, false, nil, func(ctx context.Context, req *Request) (*mimirpb.WriteResponse, error) {
+			defer req.CleanUp()
+			SetResponseHeader(ctx, "X-Test", "value")
+			return &mimirpb.WriteResponse{}, nil
+		})
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, "value", resp.Header().Get("X-Test"))
+	})
+
+	t.Run("failed request", func(t *testing.T) {
+		req := createRequest(t, createMimirWriteRequestProtobuf(t, false))
+		resp := httptest.NewRecorder()
+		handler := Handler(100000, 0, nil, false, nil, func(ctx context.Context, req *Request) (*mimirpb.WriteResponse, error) {
+			defer req.CleanUp()
+			SetResponseHeader(ctx, "X-Test", "value")
+			return nil, httpgrpc.Errorf(http.StatusInternalServerError, "failed")
+		})
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, 500, resp.Code)
+		assert.Equal(t, "value", resp.Header().Get("X-Test"))
+	})
+
+	t.Run("should be a no-op if the request has not been received through the handler", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			SetResponseHeader(context.Background(), "X-Test", "value")
+		})
+	})
+}
+
 func TestHandler_EnsureSkipLabelNameValidationBehaviour(t *testing.T) {
 	tests := []struct {
 		name                                      string
@@ -439,7 +555,7 @@ func TestHandler_EnsureSkipLabelNameValidationBehaviour(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			resp := httptest.NewRecorder()
-			handler := Handler(100000, nil, tc.allowSkipLabelNameValidation, tc.verifyReqHandler)
+			handler := Handler(100000, 0, nil, tc.allowSkipLabelNameValidation, nil, tc.verifyReqHandler)
 			if !tc.includeAllowSkiplabelNameValidationHeader {
 				tc.req.Header.Set(SkipLabelNameValidationHeader, "true")
 			}
@@ -593,7 +709,7 @@ func BenchmarkPushHandler(b *testing.B) {
 		pushReq.CleanUp()
 		return &mimirpb.WriteResponse{}, nil
 	}
-	handler := Handler(100000, nil, false, pushFunc)
+	handler := Handler(100000, 0, nil, false, nil, pushFunc)
 	b.ResetTimer()
 	for iter := 0; iter < b.N; iter++ {
 		req.Body = bufCloser{Buffer: buf} // reset Body so it can be read each time round the loop
@@ -618,6 +734,13 @@ func TestNewDistributorMaxWriteMessageSizeErr(t *testing.T) {
 	assert.Equal(t, msg, err.Error())
 }
 
+func TestNewDistributorMaxWriteMessageSizeErr_Decompressed(t *testing.T) {
+	err := distributorMaxWriteMessageSizeErr{actual: 100, limit: 50, decompressed: true}
+	msg := `the incoming push request has been rejected because its decompressed message size of 100 bytes is larger than the allowed limit of 50 bytes (err-mimir-distributor-max-write-message-size). To adjust the related limit, configure -distributor.max-recv-msg-size, or contact your service administrator.`
+
+	assert.Equal(t, msg, err.Error())
+}
+
 func TestHandler_ErrorTranslation(t *testing.T) {
 	testCases := []struct {
 		name               string
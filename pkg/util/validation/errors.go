@@ -264,12 +264,36 @@ func NewMaxQueryExpressionSizeBytesError(actualSizeBytes, maxQuerySizeBytes int)
 		maxQueryExpressionSizeBytesFlag))
 }
 
+func NewMaxQueryMemoryBytesError(maxQueryMemoryBytes int) LimitError {
+	return LimitError(globalerror.MaxQueryMemoryBytes.MessageWithPerTenantLimitConfig(
+		fmt.Sprintf("the memory allocated by the query-frontend to decode and merge the query results exceeds the limit (limit: %d bytes)", maxQueryMemoryBytes),
+		maxQueryMemoryBytesFlag))
+}
+
+func NewMaxQueryResponseSizeBytesError(actualSizeBytes, maxQueryResponseSizeBytes int) LimitError {
+	return LimitError(globalerror.MaxQueryResponseSizeBytes.MessageWithPerTenantLimitConfig(
+		fmt.Sprintf("the size of the encoded query response exceeds the limit (response size: %d bytes, limit: %d bytes)", actualSizeBytes, maxQueryResponseSizeBytes),
+		maxQueryResponseSizeBytesFlag))
+}
+
+func NewCatchAllQueryError(selector, policy string) LimitError {
+	return LimitError(globalerror.CatchAllQuery.MessageWithPerTenantLimitConfig(
+		fmt.Sprintf("the query contains the catch-all selector %s, which is not allowed by the catch-all query policy (policy: %s)", selector, policy),
+		catchAllQueryPolicyFlag))
+}
+
 func NewRequestRateLimitedError(limit float64, burst int) LimitError {
 	return LimitError(globalerror.RequestRateLimited.MessageWithPerTenantLimitConfig(
 		fmt.Sprintf("the request has been rejected because the tenant exceeded the request rate limit, set to %v requests/s across all distributors with a maximum allowed burst of %d", limit, burst),
 		requestRateFlag, requestBurstSizeFlag))
 }
 
+func NewTenantReadOnlyError() LimitError {
+	return LimitError(globalerror.TenantReadOnly.MessageWithPerTenantLimitConfig(
+		"the request has been rejected because the tenant is in read-only mode, where writes are rejected while queries keep working",
+		readOnlyFlag))
+}
+
 func NewIngestionRateLimitedError(limit float64, burst int) LimitError {
 	return LimitError(globalerror.IngestionRateLimited.MessageWithPerTenantLimitConfig(
 		fmt.Sprintf("the request has been rejected because the tenant exceeded the ingestion rate limit, set to %v items/s with a maximum allowed burst of %d. This limit is applied on the total number of samples, exemplars and metadata received across all distributors", limit, burst),
@@ -8,6 +8,7 @@ package validation
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"math"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/grafana/dskit/flagext"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
 	"golang.org/x/time/rate"
 	"gopkg.in/yaml.v3"
@@ -30,9 +32,12 @@ const (
 	MaxMetadataPerMetricFlag               = "ingester.max-global-metadata-per-metric"
 	MaxSeriesPerUserFlag                   = "ingester.max-global-series-per-user"
 	MaxMetadataPerUserFlag                 = "ingester.max-global-metadata-per-user"
+	MaxWALDiskUsagePerUserFlag             = "ingester.max-wal-disk-usage-bytes-per-user"
 	MaxChunksPerQueryFlag                  = "querier.max-fetched-chunks-per-query"
 	MaxChunkBytesPerQueryFlag              = "querier.max-fetched-chunk-bytes-per-query"
 	MaxSeriesPerQueryFlag                  = "querier.max-fetched-series-per-query"
+	SoftMaxChunksPerQueryFlag              = "querier.soft-max-fetched-chunks-per-query"
+	SoftMaxSeriesPerQueryFlag              = "querier.soft-max-fetched-series-per-query"
 	maxLabelNamesPerSeriesFlag             = "validation.max-label-names-per-series"
 	maxLabelNameLengthFlag                 = "validation.max-length-label-name"
 	maxLabelValueLengthFlag                = "validation.max-length-label-value"
@@ -42,18 +47,66 @@ const (
 	maxPartialQueryLengthFlag              = "querier.max-partial-query-length"
 	maxTotalQueryLengthFlag                = "query-frontend.max-total-query-length"
 	maxQueryExpressionSizeBytesFlag        = "query-frontend.max-query-expression-size-bytes"
+	maxQueryMemoryBytesFlag                = "query-frontend.max-query-memory-bytes"
+	maxQueryResponseSizeBytesFlag          = "query-frontend.max-query-response-size-bytes"
+	maxConcurrentHeavyQueriesFlag          = "query-frontend.max-concurrent-heavy-queries"
+	heavyQueryMinEstimatedCostFlag         = "query-frontend.heavy-query-min-estimated-cost"
+	catchAllQueryPolicyFlag                = "query-frontend.catch-all-query-policy"
+	catchAllQueryMaxRangeFlag              = "query-frontend.catch-all-query-max-range"
+	labelsAndSeriesMaxLimitFlag            = "query-frontend.labels-and-series-max-limit"
+	labelsAndSeriesDefaultLimitFlag        = "query-frontend.labels-and-series-default-limit"
 	requestRateFlag                        = "distributor.request-rate-limit"
 	requestBurstSizeFlag                   = "distributor.request-burst-size"
 	ingestionRateFlag                      = "distributor.ingestion-rate-limit"
 	ingestionBurstSizeFlag                 = "distributor.ingestion-burst-size"
+	readOnlyFlag                           = "distributor.read-only"
+	writeAckLevelFlag                      = "distributor.write-ack-level"
 	HATrackerMaxClustersFlag               = "distributor.ha-tracker.max-clusters"
 	resultsCacheTTLFlag                    = "query-frontend.results-cache-ttl"
 	resultsCacheTTLForOutOfOrderWindowFlag = "query-frontend.results-cache-ttl-for-out-of-order-time-window"
+	federationResultsCacheTTLFlag          = "query-frontend.federation-results-cache-ttl"
 
 	// MinCompactorPartialBlockDeletionDelay is the minimum partial blocks deletion delay that can be configured in Mimir.
 	MinCompactorPartialBlockDeletionDelay = 4 * time.Hour
 )
 
+// Supported write acknowledgment levels, from the weakest to the strongest.
+const (
+	WriteAckLevelAny      = "any"
+	WriteAckLevelQuorum   = "quorum"
+	WriteAckLevelAllZones = "all-zones"
+)
+
+var supportedWriteAckLevels = []string{WriteAckLevelQuorum, WriteAckLevelAllZones, WriteAckLevelAny}
+
+func isSupportedWriteAckLevel(level string) bool {
+	for _, l := range supportedWriteAckLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// Supported policies for the queries containing catch-all selectors, from the least to the most restrictive.
+const (
+	CatchAllQueryPolicyAllow                   = "allow"
+	CatchAllQueryPolicyCapRange                = "cap-range"
+	CatchAllQueryPolicyRequireNarrowingMatcher = "require-narrowing-matcher"
+	CatchAllQueryPolicyReject                  = "reject"
+)
+
+var supportedCatchAllQueryPolicies = []string{CatchAllQueryPolicyAllow, CatchAllQueryPolicyCapRange, CatchAllQueryPolicyRequireNarrowingMatcher, CatchAllQueryPolicyReject}
+
+func isSupportedCatchAllQueryPolicy(policy string) bool {
+	for _, p := range supportedCatchAllQueryPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
 // LimitError are errors that do not comply with the limits specified.
 type LimitError string
 
@@ -69,6 +122,14 @@ type ForwardingRule struct {
 // ForwardingRules are keyed by metric names, excluding labels.
 type ForwardingRules map[string]ForwardingRule
 
+type AggregationRule struct {
+	// DropLabels defines the labels removed from the series of the metric, before the resulting colliding series are sum-aggregated.
+	DropLabels []string `yaml:"drop_labels" json:"drop_labels"`
+}
+
+// AggregationRules are keyed by metric names, excluding labels.
+type AggregationRules map[string]AggregationRule
+
 // Limits describe all the limits for users; can be used to describe global default
 // limits via flags, or per-user limits via yaml config.
 type Limits struct {
@@ -90,6 +151,9 @@ type Limits struct {
 	EnforceMetadataMetricName bool                `yaml:"enforce_metadata_metric_name" json:"enforce_metadata_metric_name" category:"advanced"`
 	IngestionTenantShardSize  int                 `yaml:"ingestion_tenant_shard_size" json:"ingestion_tenant_shard_size"`
 	MetricRelabelConfigs      []*relabel.Config   `yaml:"metric_relabel_configs,omitempty" json:"metric_relabel_configs,omitempty" doc:"nocli|description=List of metric relabel configurations. Note that in most situations, it is more effective to use metrics relabeling directly in the Prometheus server, e.g. remote_write.write_relabel_configs." category:"experimental"`
+	ReadOnly                  bool                `yaml:"read_only" json:"read_only" category:"experimental"`
+	AggregationRules          AggregationRules    `yaml:"aggregation_rules" json:"aggregation_rules" doc:"nocli|description=Rules, keyed by metric name, defining the labels to drop from the series of a metric at ingestion. The series colliding after the labels have been dropped are sum-aggregated by the distributor within a single write request before being stored. No state is kept across write requests, so the series aggregated together must be sent in the same write request, for example by the same Prometheus server: otherwise, each request writes a partial sum to the same aggregated series." category:"experimental"`
+	WriteAckLevel             string              `yaml:"write_ack_level" json:"write_ack_level" category:"experimental"`
 
 	// Ingester enforced limits.
 	// Series
@@ -100,6 +164,8 @@ type Limits struct {
 	MaxGlobalMetadataPerMetric          int `yaml:"max_global_metadata_per_metric" json:"max_global_metadata_per_metric"`
 	// Exemplars
 	MaxGlobalExemplarsPerUser int `yaml:"max_global_exemplars_per_user" json:"max_global_exemplars_per_user" category:"experimental"`
+	// WAL
+	MaxWALDiskUsageBytesPerUser int `yaml:"max_wal_disk_usage_bytes_per_user" json:"max_wal_disk_usage_bytes_per_user" category:"experimental"`
 	// Native histograms
 	NativeHistogramsIngestionEnabled bool `yaml:"native_histograms_ingestion_enabled" json:"native_histograms_ingestion_enabled" category:"experimental"`
 	// Active series custom trackers
@@ -115,6 +181,8 @@ type Limits struct {
 	MaxChunksPerQuery               int            `yaml:"max_fetched_chunks_per_query" json:"max_fetched_chunks_per_query"`
 	MaxFetchedSeriesPerQuery        int            `yaml:"max_fetched_series_per_query" json:"max_fetched_series_per_query"`
 	MaxFetchedChunkBytesPerQuery    int            `yaml:"max_fetched_chunk_bytes_per_query" json:"max_fetched_chunk_bytes_per_query"`
+	SoftMaxChunksPerQuery           int            `yaml:"soft_max_fetched_chunks_per_query" json:"soft_max_fetched_chunks_per_query" category:"experimental"`
+	SoftMaxFetchedSeriesPerQuery    int            `yaml:"soft_max_fetched_series_per_query" json:"soft_max_fetched_series_per_query" category:"experimental"`
 	MaxQueryLookback                model.Duration `yaml:"max_query_lookback" json:"max_query_lookback"`
 	MaxQueryLength                  model.Duration `yaml:"max_query_length" json:"max_query_length" doc:"hidden"` // TODO: deprecated, remove in 2.8
 	MaxPartialQueryLength           model.Duration `yaml:"max_partial_query_length" json:"max_partial_query_length"`
@@ -131,7 +199,17 @@ type Limits struct {
 	MaxTotalQueryLength                    model.Duration `yaml:"max_total_query_length" json:"max_total_query_length"`
 	ResultsCacheTTL                        model.Duration `yaml:"results_cache_ttl" json:"results_cache_ttl" category:"experimental"`
 	ResultsCacheTTLForOutOfOrderTimeWindow model.Duration `yaml:"results_cache_ttl_for_out_of_order_time_window" json:"results_cache_ttl_for_out_of_order_time_window" category:"experimental"`
+	FederationResultsCacheTTL              model.Duration `yaml:"federation_results_cache_ttl" json:"federation_results_cache_ttl" category:"experimental"`
 	MaxQueryExpressionSizeBytes            int            `yaml:"max_query_expression_size_bytes" json:"max_query_expression_size_bytes" category:"experimental"`
+	MaxQueryMemoryBytes                    int            `yaml:"max_query_memory_bytes" json:"max_query_memory_bytes" category:"experimental"`
+	MaxQueryResponseSizeBytes              int            `yaml:"max_query_response_size_bytes" json:"max_query_response_size_bytes" category:"experimental"`
+	MaxConcurrentHeavyQueries              int            `yaml:"max_concurrent_heavy_queries" json:"max_concurrent_heavy_queries" category:"experimental"`
+	HeavyQueryMinEstimatedCost             model.Duration `yaml:"heavy_query_min_estimated_cost" json:"heavy_query_min_estimated_cost" category:"experimental"`
+	ChaosInjectionEnabled                  bool           `yaml:"chaos_injection_enabled" json:"chaos_injection_enabled" category:"experimental"`
+	CatchAllQueryPolicy                    string         `yaml:"catch_all_query_policy" json:"catch_all_query_policy" category:"experimental"`
+	CatchAllQueryMaxRange                  model.Duration `yaml:"catch_all_query_max_range" json:"catch_all_query_max_range" category:"experimental"`
+	LabelsAndSeriesMaxLimit                int            `yaml:"labels_and_series_max_limit" json:"labels_and_series_max_limit" category:"experimental"`
+	LabelsAndSeriesDefaultLimit            int            `yaml:"labels_and_series_default_limit" json:"labels_and_series_default_limit" category:"experimental"`
 
 	// Cardinality
 	CardinalityAnalysisEnabled                    bool `yaml:"cardinality_analysis_enabled" json:"cardinality_analysis_enabled"`
@@ -139,12 +217,13 @@ type Limits struct {
 	LabelValuesMaxCardinalityLabelNamesPerRequest int  `yaml:"label_values_max_cardinality_label_names_per_request" json:"label_values_max_cardinality_label_names_per_request"`
 
 	// Ruler defaults and limits.
-	RulerEvaluationDelay                 model.Duration `yaml:"ruler_evaluation_delay_duration" json:"ruler_evaluation_delay_duration"`
-	RulerTenantShardSize                 int            `yaml:"ruler_tenant_shard_size" json:"ruler_tenant_shard_size"`
-	RulerMaxRulesPerRuleGroup            int            `yaml:"ruler_max_rules_per_rule_group" json:"ruler_max_rules_per_rule_group"`
-	RulerMaxRuleGroupsPerTenant          int            `yaml:"ruler_max_rule_groups_per_tenant" json:"ruler_max_rule_groups_per_tenant"`
-	RulerRecordingRulesEvaluationEnabled bool           `yaml:"ruler_recording_rules_evaluation_enabled" json:"ruler_recording_rules_evaluation_enabled" category:"experimental"`
-	RulerAlertingRulesEvaluationEnabled  bool           `yaml:"ruler_alerting_rules_evaluation_enabled" json:"ruler_alerting_rules_evaluation_enabled" category:"experimental"`
+	RulerEvaluationDelay                 model.Duration    `yaml:"ruler_evaluation_delay_duration" json:"ruler_evaluation_delay_duration"`
+	RulerTenantShardSize                 int               `yaml:"ruler_tenant_shard_size" json:"ruler_tenant_shard_size"`
+	RulerMaxRulesPerRuleGroup            int               `yaml:"ruler_max_rules_per_rule_group" json:"ruler_max_rules_per_rule_group"`
+	RulerMaxRuleGroupsPerTenant          int               `yaml:"ruler_max_rule_groups_per_tenant" json:"ruler_max_rule_groups_per_tenant"`
+	RulerRecordingRulesEvaluationEnabled bool              `yaml:"ruler_recording_rules_evaluation_enabled" json:"ruler_recording_rules_evaluation_enabled" category:"experimental"`
+	RulerAlertingRulesEvaluationEnabled  bool              `yaml:"ruler_alerting_rules_evaluation_enabled" json:"ruler_alerting_rules_evaluation_enabled" category:"experimental"`
+	RulerExternalLabels                  map[string]string `yaml:"ruler_external_labels" json:"ruler_external_labels" doc:"nocli|description=Labels added to the series generated by recording rules and to the alerts sent to the Alertmanager. A label is not added if the series or the alert already has a label with the same name." category:"experimental"`
 
 	// Store-gateway.
 	StoreGatewayTenantShardSize int `yaml:"store_gateway_tenant_shard_size" json:"store_gateway_tenant_shard_size"`
@@ -193,6 +272,8 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.RequestBurstSize, requestBurstSizeFlag, 0, "Per-tenant allowed request burst size. 0 to disable.")
 	f.Float64Var(&l.IngestionRate, ingestionRateFlag, 10000, "Per-tenant ingestion rate limit in samples per second.")
 	f.IntVar(&l.IngestionBurstSize, ingestionBurstSizeFlag, 200000, "Per-tenant allowed ingestion burst size (in number of samples).")
+	f.BoolVar(&l.ReadOnly, readOnlyFlag, false, "True to put the tenant in read-only mode: write requests are rejected with the 423 status code, while queries keep working. Useful during migrations and offboarding.")
+	f.StringVar(&l.WriteAckLevel, writeAckLevelFlag, WriteAckLevelQuorum, fmt.Sprintf("The number of ingesters which must acknowledge each series of a write request before the distributor returns success. %s requires a quorum of the replicas, %s requires all the replicas, which are in different zones when zone-awareness is enabled, and %s requires a single replica. The acknowledgment level achieved by each successful write request is returned in the X-Mimir-Write-Ack-Level response header. Supported values: %s.", WriteAckLevelQuorum, WriteAckLevelAllZones, WriteAckLevelAny, strings.Join(supportedWriteAckLevels, ", ")))
 	f.BoolVar(&l.AcceptHASamples, "distributor.ha-tracker.enable-for-all-users", false, "Flag to enable, for all tenants, handling of samples with external labels identifying replicas in an HA Prometheus setup.")
 	f.StringVar(&l.HAClusterLabel, "distributor.ha-tracker.cluster", "cluster", "Prometheus label to look for in samples to identify a Prometheus HA cluster.")
 	f.StringVar(&l.HAReplicaLabel, "distributor.ha-tracker.replica", "__replica__", "Prometheus label to look for in samples to identify a Prometheus HA replica.")
@@ -212,6 +293,7 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.MaxGlobalMetricsWithMetadataPerUser, MaxMetadataPerUserFlag, 0, "The maximum number of in-memory metrics with metadata per tenant, across the cluster. 0 to disable.")
 	f.IntVar(&l.MaxGlobalMetadataPerMetric, MaxMetadataPerMetricFlag, 0, "The maximum number of metadata per metric, across the cluster. 0 to disable.")
 	f.IntVar(&l.MaxGlobalExemplarsPerUser, "ingester.max-global-exemplars-per-user", 0, "The maximum number of exemplars in memory, across the cluster. 0 to disable exemplars ingestion.")
+	f.IntVar(&l.MaxWALDiskUsageBytesPerUser, MaxWALDiskUsagePerUserFlag, 0, "The maximum disk space, in bytes, used by the WAL, the out-of-order WBL and the head chunks of a tenant on each ingester. When the limit is reached, the write requests of the tenant are rejected with the 429 status code, until the disk space is reclaimed by the next head compaction. This limit is per-ingester, not across the cluster. 0 to disable.")
 	f.Var(&l.ActiveSeriesCustomTrackersConfig, "ingester.active-series-custom-trackers", "Additional active series metrics, matching the provided matchers. Matchers should be in form <name>:<matcher>, like 'foobar:{foo=\"bar\"}'. Multiple matchers can be provided either providing the flag multiple times or providing multiple semicolon-separated values to a single flag.")
 	f.Var(&l.OutOfOrderTimeWindow, "ingester.out-of-order-time-window", fmt.Sprintf("Non-zero value enables out-of-order support for most recent samples that are within the time window in relation to the TSDB's maximum time, i.e., within [db.maxTime-timeWindow, db.maxTime]). The ingester will need more memory as a factor of rate of out-of-order samples being ingested and the number of series that are getting out-of-order samples. If query falls into this window, cached results will use value from -%s option to specify TTL for resulting cache entry.", resultsCacheTTLForOutOfOrderWindowFlag))
 	f.BoolVar(&l.NativeHistogramsIngestionEnabled, "ingester.native-histograms-ingestion-enabled", false, "Enable ingestion of native histogram samples. If false, native histogram samples are ignored without an error. To query native histograms with query-sharding enabled make sure to set -query-frontend.query-result-response-format to 'protobuf'.")
@@ -222,6 +304,8 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.MaxChunksPerQuery, MaxChunksPerQueryFlag, 2e6, "Maximum number of chunks that can be fetched in a single query from ingesters and long-term storage. This limit is enforced in the querier, ruler and store-gateway. 0 to disable.")
 	f.IntVar(&l.MaxFetchedSeriesPerQuery, MaxSeriesPerQueryFlag, 0, "The maximum number of unique series for which a query can fetch samples from each ingesters and storage. This limit is enforced in the querier, ruler and store-gateway. 0 to disable")
 	f.IntVar(&l.MaxFetchedChunkBytesPerQuery, MaxChunkBytesPerQueryFlag, 0, "The maximum size of all chunks in bytes that a query can fetch from each ingester and storage. This limit is enforced in the querier and ruler. 0 to disable.")
+	f.IntVar(&l.SoftMaxChunksPerQuery, SoftMaxChunksPerQueryFlag, 0, fmt.Sprintf("Soft limit on the number of chunks that can be fetched in a single query from ingesters and long-term storage. When exceeded, the query doesn't fail, but a warning is attached to the query result. It can be used to evaluate the impact of a value of -%s before enforcing it. This limit is enforced in the querier and ruler. 0 to disable.", MaxChunksPerQueryFlag))
+	f.IntVar(&l.SoftMaxFetchedSeriesPerQuery, SoftMaxSeriesPerQueryFlag, 0, fmt.Sprintf("Soft limit on the number of unique series for which a query can fetch samples from each ingesters and storage. When exceeded, the query doesn't fail, but a warning is attached to the query result. It can be used to evaluate the impact of a value of -%s before enforcing it. This limit is enforced in the querier and ruler. 0 to disable.", MaxSeriesPerQueryFlag))
 	// TODO: Deprecated in Mimir 2.6, remove in Mimir 2.8
 	f.Var(&l.MaxQueryLength, maxQueryLengthFlag, fmt.Sprintf("Deprecated: Limit the query time range (end - start time). This limit is enforced in the querier (on the query possibly split by the query-frontend) and ruler. 0 to disable. This option is deprecated, use -%s or -%s instead.", maxPartialQueryLengthFlag, maxTotalQueryLengthFlag))
 	f.Var(&l.MaxPartialQueryLength, maxPartialQueryLengthFlag, fmt.Sprintf("Limit the time range for partial queries at the querier level. Defaults to the value of -%s if set to 0.", maxQueryLengthFlag))
@@ -263,7 +347,20 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&l.ResultsCacheTTL, resultsCacheTTLFlag, fmt.Sprintf("Time to live duration for cached query results. If query falls into out-of-order time window, -%s is used instead.", resultsCacheTTLForOutOfOrderWindowFlag))
 	_ = l.ResultsCacheTTLForOutOfOrderTimeWindow.Set("10m")
 	f.Var(&l.ResultsCacheTTLForOutOfOrderTimeWindow, resultsCacheTTLForOutOfOrderWindowFlag, fmt.Sprintf("Time to live duration for cached query results if query falls into out-of-order time window. This is lower than -%s so that incoming out-of-order samples are returned in the query results sooner.", resultsCacheTTLFlag))
+	_ = l.FederationResultsCacheTTL.Set("10s")
+	f.Var(&l.FederationResultsCacheTTL, federationResultsCacheTTLFlag, "Time to live duration for cached results of /federate requests. The results cache is used only if query results caching is enabled. It should be lower than the scrape interval of the Prometheus servers federating from Mimir, so that each scrape returns recent samples. 0 to disable caching of /federate results.")
 	f.IntVar(&l.MaxQueryExpressionSizeBytes, maxQueryExpressionSizeBytesFlag, 0, "Max size of the raw query, in bytes. 0 to not apply a limit to the size of the query.")
+	f.IntVar(&l.MaxQueryMemoryBytes, maxQueryMemoryBytesFlag, 0, "Max memory, in bytes, that the query-frontend can allocate to decode and merge the responses of the partial queries of a single query. The query fails when the limit is exceeded. The limit is enforced only if -query-frontend.query-memory-limit-enabled is true. 0 to disable the limit.")
+	f.IntVar(&l.MaxQueryResponseSizeBytes, maxQueryResponseSizeBytesFlag, 0, "Max size, in bytes, of the encoded response of a single query. The query fails when the limit is exceeded. The size is estimated before encoding the response, so that the encoding of responses clearly exceeding the limit is not even attempted. 0 to disable the limit.")
+	f.IntVar(&l.MaxConcurrentHeavyQueries, maxConcurrentHeavyQueriesFlag, 0, fmt.Sprintf("Max number of heavy queries, as classified by -%s, executed concurrently by each query-frontend for the tenant. Heavy queries exceeding the limit wait in a FIFO queue, while the other queries are not affected. The limit is enforced only if -query-frontend.heavy-queries-limit-enabled is true. 0 to disable the limit.", heavyQueryMinEstimatedCostFlag))
+	_ = l.HeavyQueryMinEstimatedCost.Set("7d")
+	f.Var(&l.HeavyQueryMinEstimatedCost, heavyQueryMinEstimatedCostFlag, fmt.Sprintf("Queries whose estimated cost is greater than or equal to this value are classified as heavy, and subject to -%s. The estimated cost of a query is the sum of the time range queried by each of its selectors, including ranges and subqueries.", maxConcurrentHeavyQueriesFlag))
+	f.BoolVar(&l.ChaosInjectionEnabled, "query-frontend.chaos-injection-enabled", false, "Enable the query-frontend to inject the latency or errors requested by a signed chaos header into the tenant requests, to test the behavior of dashboards and alerts when Mimir is degraded. Requires -query-frontend.chaos-header-signing-key to be set.")
+	f.StringVar(&l.CatchAllQueryPolicy, catchAllQueryPolicyFlag, CatchAllQueryPolicyAllow, fmt.Sprintf("How the query-frontend treats the queries containing a catch-all selector, which doesn't narrow the selected series by metric name, such as {__name__=~\".+\"} or {job!=\"\"}. %s executes the queries as they are, %s caps the time range of range queries to -%s, %s rejects the queries unless each catch-all selector narrows the selected series by another label, and %s rejects the queries. The policy is enforced only if -query-frontend.catch-all-query-policy-enabled is true. Supported values: %s.", CatchAllQueryPolicyAllow, CatchAllQueryPolicyCapRange, catchAllQueryMaxRangeFlag, CatchAllQueryPolicyRequireNarrowingMatcher, CatchAllQueryPolicyReject, strings.Join(supportedCatchAllQueryPolicies, ", ")))
+	_ = l.CatchAllQueryMaxRange.Set("1h")
+	f.Var(&l.CatchAllQueryMaxRange, catchAllQueryMaxRangeFlag, fmt.Sprintf("Max time range of the range queries containing a catch-all selector, when -%s is %s. The start of longer queries is moved forward, so that the most recent part of the time range is queried.", catchAllQueryPolicyFlag, CatchAllQueryPolicyCapRange))
+	f.IntVar(&l.LabelsAndSeriesMaxLimit, labelsAndSeriesMaxLimitFlag, 0, "Maximum value of the limit parameter of the label names, label values and series requests. Requests without a limit, or with a greater limit, are served with this limit. The results exceeding the limit are truncated by the query-frontend, and a warning is returned. The queriers still fetch all the results, so the limit doesn't reduce the load of the requests. 0 to disable.")
+	f.IntVar(&l.LabelsAndSeriesDefaultLimit, labelsAndSeriesDefaultLimitFlag, 0, fmt.Sprintf("Limit applied to the label names, label values and series requests which don't set the limit parameter. Must not be greater than -%s, if set. 0 to disable.", labelsAndSeriesMaxLimitFlag))
 
 	// Store-gateway.
 	f.IntVar(&l.StoreGatewayTenantShardSize, "store-gateway.tenant-shard-size", 0, "The tenant's shard size, used when store-gateway sharding is enabled. Value of 0 disables shuffle sharding for the tenant, that is all tenant blocks are sharded across all store-gateway replicas.")
@@ -330,6 +427,35 @@ func (l *Limits) validate() error {
 		}
 	}
 
+	for metricName, rule := range l.AggregationRules {
+		for _, name := range rule.DropLabels {
+			if name == model.MetricNameLabel || !model.LabelName(name).IsValid() {
+				return fmt.Errorf("invalid aggregation_rules for metric %q: %q is not a valid label name to drop", metricName, name)
+			}
+		}
+	}
+
+	if l.WriteAckLevel != "" && !isSupportedWriteAckLevel(l.WriteAckLevel) {
+		return fmt.Errorf("invalid write_ack_level %q (supported values: %s)", l.WriteAckLevel, strings.Join(supportedWriteAckLevels, ", "))
+	}
+
+	if l.CatchAllQueryPolicy != "" && !isSupportedCatchAllQueryPolicy(l.CatchAllQueryPolicy) {
+		return fmt.Errorf("invalid catch_all_query_policy %q (supported values: %s)", l.CatchAllQueryPolicy, strings.Join(supportedCatchAllQueryPolicies, ", "))
+	}
+
+	if l.LabelsAndSeriesMaxLimit < 0 || l.LabelsAndSeriesDefaultLimit < 0 {
+		return errors.New("labels_and_series_max_limit and labels_and_series_default_limit must be greater than or equal to 0")
+	}
+	if l.LabelsAndSeriesMaxLimit > 0 && l.LabelsAndSeriesDefaultLimit > l.LabelsAndSeriesMaxLimit {
+		return fmt.Errorf("labels_and_series_default_limit %d must not be greater than labels_and_series_max_limit %d", l.LabelsAndSeriesDefaultLimit, l.LabelsAndSeriesMaxLimit)
+	}
+
+	for name := range l.RulerExternalLabels {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("invalid ruler_external_labels: %q is not a valid label name", name)
+		}
+	}
+
 	return nil
 }
 
@@ -387,6 +513,16 @@ func (o *Overrides) RequestBurstSize(userID string) int {
 	return o.getOverridesForUser(userID).RequestBurstSize
 }
 
+// ReadOnly returns whether the tenant is in read-only mode, where write requests are rejected.
+func (o *Overrides) ReadOnly(userID string) bool {
+	return o.getOverridesForUser(userID).ReadOnly
+}
+
+// AggregationRules returns the rules defining the labels to drop and aggregate away at ingestion for a given user.
+func (o *Overrides) AggregationRules(userID string) AggregationRules {
+	return o.getOverridesForUser(userID).AggregationRules
+}
+
 // IngestionRate returns the limit on ingester rate (samples per second).
 func (o *Overrides) IngestionRate(userID string) float64 {
 	return o.getOverridesForUser(userID).IngestionRate
@@ -464,6 +600,11 @@ func (o *Overrides) MaxGlobalSeriesPerUser(userID string) int {
 	return o.getOverridesForUser(userID).MaxGlobalSeriesPerUser
 }
 
+// MaxWALDiskUsageBytesPerUser returns the maximum disk space, in bytes, a user's WAL, WBL and head chunks are allowed to use on each ingester.
+func (o *Overrides) MaxWALDiskUsageBytesPerUser(userID string) int {
+	return o.getOverridesForUser(userID).MaxWALDiskUsageBytesPerUser
+}
+
 // MaxGlobalSeriesPerMetric returns the maximum number of series allowed per metric across the cluster.
 func (o *Overrides) MaxGlobalSeriesPerMetric(userID string) int {
 	return o.getOverridesForUser(userID).MaxGlobalSeriesPerMetric
@@ -485,6 +626,18 @@ func (o *Overrides) MaxFetchedChunkBytesPerQuery(userID string) int {
 	return o.getOverridesForUser(userID).MaxFetchedChunkBytesPerQuery
 }
 
+// SoftMaxChunksPerQuery returns the soft limit on the number of chunks fetched per query, above which
+// a warning is attached to the query result.
+func (o *Overrides) SoftMaxChunksPerQuery(userID string) int {
+	return o.getOverridesForUser(userID).SoftMaxChunksPerQuery
+}
+
+// SoftMaxFetchedSeriesPerQuery returns the soft limit on the number of series fetched per query, above which
+// a warning is attached to the query result.
+func (o *Overrides) SoftMaxFetchedSeriesPerQuery(userID string) int {
+	return o.getOverridesForUser(userID).SoftMaxFetchedSeriesPerQuery
+}
+
 // MaxQueryLookback returns the max lookback period of queries.
 func (o *Overrides) MaxQueryLookback(userID string) time.Duration {
 	return time.Duration(o.getOverridesForUser(userID).MaxQueryLookback)
@@ -518,6 +671,28 @@ func (o *Overrides) MaxQueryExpressionSizeBytes(userID string) int {
 	return o.getOverridesForUser(userID).MaxQueryExpressionSizeBytes
 }
 
+// MaxQueryMemoryBytes returns the limit of the memory allocated by the query-frontend to decode
+// and merge the responses of the partial queries of a single query, in bytes.
+func (o *Overrides) MaxQueryMemoryBytes(userID string) int {
+	return o.getOverridesForUser(userID).MaxQueryMemoryBytes
+}
+
+// MaxQueryResponseSizeBytes returns the limit of the size of the encoded response of a single query, in bytes.
+func (o *Overrides) MaxQueryResponseSizeBytes(userID string) int {
+	return o.getOverridesForUser(userID).MaxQueryResponseSizeBytes
+}
+
+// MaxConcurrentHeavyQueries returns the max number of heavy queries executed concurrently
+// by each query-frontend for a given user.
+func (o *Overrides) MaxConcurrentHeavyQueries(userID string) int {
+	return o.getOverridesForUser(userID).MaxConcurrentHeavyQueries
+}
+
+// HeavyQueryMinEstimatedCost returns the min estimated cost of a query to be classified as heavy for a given user.
+func (o *Overrides) HeavyQueryMinEstimatedCost(userID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(userID).HeavyQueryMinEstimatedCost)
+}
+
 // MaxLabelsQueryLength returns the limit of the length (in time) of a label names or values request.
 func (o *Overrides) MaxLabelsQueryLength(userID string) time.Duration {
 	return time.Duration(o.getOverridesForUser(userID).MaxLabelsQueryLength)
@@ -604,6 +779,15 @@ func (o *Overrides) SeparateMetricsGroupLabel(userID string) string {
 	return o.getOverridesForUser(userID).SeparateMetricsGroupLabel
 }
 
+// WriteAckLevel returns the number of ingesters which must acknowledge each series of a write request.
+// The quorum is returned if not set.
+func (o *Overrides) WriteAckLevel(userID string) string {
+	if level := o.getOverridesForUser(userID).WriteAckLevel; level != "" {
+		return level
+	}
+	return WriteAckLevelQuorum
+}
+
 // IngestionTenantShardSize returns the ingesters shard size for a given user.
 func (o *Overrides) IngestionTenantShardSize(userID string) int {
 	return o.getOverridesForUser(userID).IngestionTenantShardSize
@@ -698,6 +882,11 @@ func (o *Overrides) RulerAlertingRulesEvaluationEnabled(userID string) bool {
 	return o.getOverridesForUser(userID).RulerAlertingRulesEvaluationEnabled
 }
 
+// RulerExternalLabels returns the labels added to the series generated by recording rules and to the alerts for a given user.
+func (o *Overrides) RulerExternalLabels(userID string) labels.Labels {
+	return labels.FromMap(o.getOverridesForUser(userID).RulerExternalLabels)
+}
+
 // StoreGatewayTenantShardSize returns the store-gateway shard size for a given user.
 func (o *Overrides) StoreGatewayTenantShardSize(userID string) int {
 	return o.getOverridesForUser(userID).StoreGatewayTenantShardSize
@@ -827,6 +1016,54 @@ func (o *Overrides) ResultsCacheTTLForOutOfOrderTimeWindow(user string) time.Dur
 	return time.Duration(o.getOverridesForUser(user).ResultsCacheTTLForOutOfOrderTimeWindow)
 }
 
+func (o *Overrides) FederationResultsCacheTTL(user string) time.Duration {
+	return time.Duration(o.getOverridesForUser(user).FederationResultsCacheTTL)
+}
+
+func (o *Overrides) ChaosInjectionEnabled(user string) bool {
+	return o.getOverridesForUser(user).ChaosInjectionEnabled
+}
+
+// CatchAllQueryPolicy returns how the query-frontend treats the queries containing a catch-all selector.
+// The queries are allowed if not set.
+func (o *Overrides) CatchAllQueryPolicy(userID string) string {
+	if policy := o.getOverridesForUser(userID).CatchAllQueryPolicy; policy != "" {
+		return policy
+	}
+	return CatchAllQueryPolicyAllow
+}
+
+// CatchAllQueryMaxRange returns the max time range of the range queries containing a catch-all selector,
+// when their range is capped.
+func (o *Overrides) CatchAllQueryMaxRange(userID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(userID).CatchAllQueryMaxRange)
+}
+
+// LabelsAndSeriesMaxLimit returns the max limit of the label names, label values and series requests.
+func (o *Overrides) LabelsAndSeriesMaxLimit(userID string) int {
+	return o.getOverridesForUser(userID).LabelsAndSeriesMaxLimit
+}
+
+// LabelsAndSeriesDefaultLimit returns the limit of the label names, label values and series requests
+// which don't set the limit parameter.
+func (o *Overrides) LabelsAndSeriesDefaultLimit(userID string) int {
+	return o.getOverridesForUser(userID).LabelsAndSeriesDefaultLimit
+}
+
+// StrictestCatchAllQueryPolicyPerTenant returns the most restrictive catch-all query policy of the input tenants.
+func StrictestCatchAllQueryPolicyPerTenant(tenantIDs []string, f func(string) string) string {
+	strictest := 0
+	for _, tenantID := range tenantIDs {
+		policy := f(tenantID)
+		for i := strictest + 1; i < len(supportedCatchAllQueryPolicies); i++ {
+			if supportedCatchAllQueryPolicies[i] == policy {
+				strictest = i
+			}
+		}
+	}
+	return supportedCatchAllQueryPolicies[strictest]
+}
+
 func (o *Overrides) getOverridesForUser(userID string) *Limits {
 	if o.tenantLimits != nil {
 		l := o.tenantLimits.ByUserID(userID)
@@ -647,6 +647,119 @@ metric_relabel_configs:
 	})
 }
 
+func TestUnmarshalRulerExternalLabels(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		limits := Limits{}
+		require.NoError(t, yaml.Unmarshal([]byte(`{ruler_external_labels: {cluster: eu}}`), &limits))
+		assert.Equal(t, map[string]string{"cluster": "eu"}, limits.RulerExternalLabels)
+	})
+
+	t.Run("invalid label name", func(t *testing.T) {
+		limits := Limits{}
+		err := yaml.Unmarshal([]byte(`{ruler_external_labels: {"invalid-name": eu}}`), &limits)
+		require.ErrorContains(t, err, "invalid ruler_external_labels")
+	})
+}
+
+func TestUnmarshalAggregationRules(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		limits := Limits{}
+		require.NoError(t, yaml.Unmarshal([]byte(`{aggregation_rules: {http_requests_total: {drop_labels: [pod, instance]}}}`), &limits))
+		assert.Equal(t, AggregationRules{"http_requests_total": {DropLabels: []string{"pod", "instance"}}}, limits.AggregationRules)
+	})
+
+	t.Run("invalid label name", func(t *testing.T) {
+		limits := Limits{}
+		err := yaml.Unmarshal([]byte(`{aggregation_rules: {http_requests_total: {drop_labels: ["invalid-name"]}}}`), &limits)
+		require.ErrorContains(t, err, "invalid aggregation_rules")
+	})
+
+	t.Run("metric name label", func(t *testing.T) {
+		limits := Limits{}
+		err := yaml.Unmarshal([]byte(`{aggregation_rules: {http_requests_total: {drop_labels: [__name__]}}}`), &limits)
+		require.ErrorContains(t, err, "invalid aggregation_rules")
+	})
+}
+
+func TestWriteAckLevelValidation(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		limits := Limits{}
+		require.NoError(t, yaml.Unmarshal([]byte(`{write_ack_level: all-zones}`), &limits))
+		assert.Equal(t, WriteAckLevelAllZones, limits.WriteAckLevel)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		limits := Limits{}
+		err := yaml.Unmarshal([]byte(`{write_ack_level: all}`), &limits)
+		require.ErrorContains(t, err, "invalid write_ack_level")
+	})
+}
+
+func TestCatchAllQueryPolicyValidation(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		limits := Limits{}
+		require.NoError(t, yaml.Unmarshal([]byte(`{catch_all_query_policy: require-narrowing-matcher}`), &limits))
+		assert.Equal(t, CatchAllQueryPolicyRequireNarrowingMatcher, limits.CatchAllQueryPolicy)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		limits := Limits{}
+		err := yaml.Unmarshal([]byte(`{catch_all_query_policy: deny}`), &limits)
+		require.ErrorContains(t, err, "invalid catch_all_query_policy")
+	})
+}
+
+func TestLabelsAndSeriesLimitsValidation(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config      string
+		expectedErr string
+	}{
+		"no limits": {
+			config: `{}`,
+		},
+		"default limit lower than the max limit": {
+			config: `{labels_and_series_max_limit: 1000, labels_and_series_default_limit: 100}`,
+		},
+		"default limit without max limit": {
+			config: `{labels_and_series_default_limit: 100}`,
+		},
+		"default limit greater than the max limit": {
+			config:      `{labels_and_series_max_limit: 100, labels_and_series_default_limit: 1000}`,
+			expectedErr: "labels_and_series_default_limit 1000 must not be greater than labels_and_series_max_limit 100",
+		},
+		"negative limit": {
+			config:      `{labels_and_series_max_limit: -1}`,
+			expectedErr: "must be greater than or equal to 0",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			limits := Limits{}
+			err := yaml.Unmarshal([]byte(tc.config), &limits)
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestStrictestCatchAllQueryPolicyPerTenant(t *testing.T) {
+	policies := map[string]string{
+		"allow":   CatchAllQueryPolicyAllow,
+		"cap":     CatchAllQueryPolicyCapRange,
+		"require": CatchAllQueryPolicyRequireNarrowingMatcher,
+		"reject":  CatchAllQueryPolicyReject,
+	}
+	f := func(tenantID string) string { return policies[tenantID] }
+
+	assert.Equal(t, CatchAllQueryPolicyAllow, StrictestCatchAllQueryPolicyPerTenant(nil, f))
+	assert.Equal(t, CatchAllQueryPolicyAllow, StrictestCatchAllQueryPolicyPerTenant([]string{"allow"}, f))
+	assert.Equal(t, CatchAllQueryPolicyCapRange, StrictestCatchAllQueryPolicyPerTenant([]string{"allow", "cap"}, f))
+	assert.Equal(t, CatchAllQueryPolicyRequireNarrowingMatcher, StrictestCatchAllQueryPolicyPerTenant([]string{"require", "cap"}, f))
+	assert.Equal(t, CatchAllQueryPolicyReject, StrictestCatchAllQueryPolicyPerTenant([]string{"cap", "reject", "allow"}, f))
+}
+
 type structExtension struct {
 	Foo int `yaml:"foo"`
 }
@@ -55,6 +55,9 @@ var (
 
 	// ReasonTooManyHAClusters is one of the reasons for discarding samples.
 	ReasonTooManyHAClusters = "too_many_ha_clusters"
+
+	// ReasonTenantReadOnly is the reason for discarding requests of tenants in read-only mode.
+	ReasonTenantReadOnly = metricReasonFromErrorID(globalerror.TenantReadOnly)
 )
 
 func metricReasonFromErrorID(id globalerror.ID) string {